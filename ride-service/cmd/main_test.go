@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// freePort returns a loopback port nothing listens on.
+func freePort(t *testing.T) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+}
+
+// post sends body as JSON and decodes the response into out, if not nil.
+func post(t *testing.T, url, token string, body, out any) int {
+	t.Helper()
+	data, _ := json.Marshal(body)
+	req, _ := http.NewRequest(http.MethodPost, url, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("POST %s: %v", url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+// TestRunInMemory boots the service with STORAGE=memory, with nothing else
+// running, requests a trip through the API, then shuts it down.
+func TestRunInMemory(t *testing.T) {
+	port := freePort(t)
+	t.Setenv("STORAGE", "memory")
+	t.Setenv("EVENT_BUS", "memory")
+	t.Setenv("GEO_BACKEND", "memory")
+	t.Setenv("PORT", port)
+	t.Setenv("GRPC_PORT", freePort(t))
+	t.Setenv("BLOB_DIR", t.TempDir())
+	t.Setenv("CHALLENGE_PROVIDER", "off")
+	t.Setenv("JWT_SECRET", "in-memory-test-secret-at-least-32-bytes")
+
+	stop, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run(stop)
+	}()
+
+	base := "http://127.0.0.1:" + port
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		resp, err := http.Get(base + "/health")
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("service did not come up: %v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	var auth struct {
+		Token string `json:"token"`
+	}
+	code := post(t, base+"/users/register", "", map[string]any{
+		"name": "Asha Rider", "email": "asha@example.com", "phone": "9876543210", "password": "secret123",
+	}, &auth)
+	if code != http.StatusCreated || auth.Token == "" {
+		t.Fatalf("register: status %d, token %q", code, auth.Token)
+	}
+
+	var trip struct {
+		ID     string `json:"trip_id"`
+		Status string `json:"status"`
+	}
+	code = post(t, base+"/trips/request", auth.Token, map[string]any{
+		"pickupLat": 12.9716, "pickupLng": 77.5946, "dropLat": 12.9352, "dropLng": 77.6245,
+	}, &trip)
+	if code != http.StatusCreated || trip.ID == "" {
+		t.Fatalf("request trip: status %d, trip %+v", code, trip)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, base+"/trips/"+trip.ID, nil)
+	req.Header.Set("Authorization", "Bearer "+auth.Token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("get trip: status %d", resp.StatusCode)
+	}
+
+	// Everything kept in PostgreSQL only is not served.
+	if resp, err := http.Get(base + "/status"); err != nil {
+		t.Fatal(err)
+	} else if resp.Body.Close(); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("GET /status: status %d, want 404", resp.StatusCode)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(15 * time.Second):
+		t.Fatal("service did not shut down")
+	}
+}
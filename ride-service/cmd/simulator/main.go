@@ -0,0 +1,392 @@
+// Command simulator drives synthetic riders and drivers through full trip
+// lifecycles against a running ride-service and reports latency and
+// throughput per API call. It is a load-testing tool for matching and the
+// trip WebSocket fan-out; it creates real accounts, so point it at a
+// development or load-test environment only.
+//
+// Drivers register, then report their location every -ping. Each rider
+// requests trips one after another: the trip is matched by the service, the
+// matched driver accepts, drives to the pickup, starts, sends a chat message
+// the rider receives over /ws/trips/:id, drives to the drop and ends it.
+//
+//	go run ./cmd/simulator -base http://localhost:8080 -drivers 50 -riders 20 -trips 200
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type options struct {
+	base         string
+	drivers      int
+	riders       int
+	trips        int
+	lat, lng     float64
+	spreadKm     float64
+	ping         time.Duration
+	matchTimeout time.Duration
+	ws           bool
+}
+
+// account is a registered simulated rider or driver.
+type account struct {
+	id    string
+	token string
+
+	mu       sync.Mutex // guards lat, lng
+	lat, lng float64
+}
+
+func (a *account) moveTo(lat, lng float64) {
+	a.mu.Lock()
+	a.lat, a.lng = lat, lng
+	a.mu.Unlock()
+}
+
+func (a *account) position() (float64, float64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.lat, a.lng
+}
+
+// trip is the part of a trip response the simulator reads.
+type trip struct {
+	ID       string  `json:"id"`
+	Status   string  `json:"status"`
+	DriverID *string `json:"driver_id"`
+	Version  int     `json:"version"`
+}
+
+type sim struct {
+	opts    options
+	c       *client
+	run     int64 // unique per run, so accounts never collide
+	drivers map[string]*account
+	terms   map[string]string // the versions in force, accepted at registration
+
+	completed, unmatched, failed atomic.Int64
+	fanout                       atomic.Int64 // chat messages received over WebSocket
+}
+
+func main() {
+	var o options
+	flag.StringVar(&o.base, "base", "http://localhost:8080", "ride-service base URL")
+	flag.IntVar(&o.drivers, "drivers", 20, "simulated drivers")
+	flag.IntVar(&o.riders, "riders", 10, "simulated riders, each running one trip at a time")
+	flag.IntVar(&o.trips, "trips", 50, "trips to run in total")
+	flag.Float64Var(&o.lat, "lat", 12.9716, "latitude of the area centre")
+	flag.Float64Var(&o.lng, "lng", 77.5946, "longitude of the area centre")
+	flag.Float64Var(&o.spreadKm, "spread", 3, "km around the centre that drivers and pickups are placed in")
+	flag.DurationVar(&o.ping, "ping", 2*time.Second, "driver location update interval")
+	flag.DurationVar(&o.matchTimeout, "match-timeout", 30*time.Second, "how long a rider waits for a driver")
+	flag.BoolVar(&o.ws, "ws", true, "subscribe riders to /ws/trips/:id and time chat fan-out")
+	flag.Parse()
+	if o.drivers < 1 || o.riders < 1 || o.trips < 1 || o.ping <= 0 || o.matchTimeout <= 0 {
+		log.Fatal("-drivers, -riders, -trips, -ping and -match-timeout must be positive")
+	}
+	if o.drivers > 9999 || o.riders > 9999 {
+		log.Fatal("-drivers and -riders must be at most 9999") // they number phone numbers
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	s := &sim{
+		opts:    o,
+		c:       &client{base: strings.TrimRight(o.base, "/"), http: &http.Client{Timeout: 10 * time.Second}, stats: newStats()},
+		run:     time.Now().Unix() % 100000,
+		drivers: map[string]*account{},
+	}
+	if err := s.setup(ctx); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("simulating %d trips with %d riders and %d drivers against %s", o.trips, o.riders, len(s.drivers), o.base)
+	elapsed := s.simulate(ctx)
+
+	fmt.Println()
+	s.c.stats.report(os.Stdout, elapsed)
+	fmt.Printf("\ntrips: %d completed, %d unmatched, %d failed in %s (%.2f completed/s)\n",
+		s.completed.Load(), s.unmatched.Load(), s.failed.Load(), elapsed.Round(time.Millisecond),
+		float64(s.completed.Load())/elapsed.Seconds())
+	if o.ws {
+		fmt.Printf("websocket: %d of %d chat messages delivered\n", s.fanout.Load(), s.completed.Load())
+	}
+}
+
+// setup registers the drivers and places each one near the centre. Every
+// account accepts the terms in force as it registers, or it could not
+// change trips.
+func (s *sim) setup(ctx context.Context) error {
+	if err := s.c.do(ctx, "terms", http.MethodGet, "/terms", "", 0, nil, &s.terms); err != nil {
+		return fmt.Errorf("terms: %w", err)
+	}
+	for i := 0; i < s.opts.drivers; i++ {
+		var resp struct {
+			Token  string `json:"token"`
+			Driver struct {
+				ID string `json:"id"`
+			} `json:"driver"`
+		}
+		err := s.c.do(ctx, "driver.register", http.MethodPost, "/drivers/register", "", 0, map[string]string{
+			"name":            fmt.Sprintf("Sim Driver %05d-%d", s.run, i),
+			"email":           fmt.Sprintf("sim-driver-%05d-%d@example.com", s.run, i),
+			"phone":           fmt.Sprintf("+917%05d%04d", s.run, i),
+			"password":        "simulator",
+			"vehicle_type":    "sedan",
+			"license_plate":   fmt.Sprintf("SIM-%05d-%04d", s.run, i),
+			"terms_version":   s.terms["terms_version"],
+			"privacy_version": s.terms["privacy_version"],
+		}, &resp)
+		if err != nil {
+			return fmt.Errorf("register driver: %w", err)
+		}
+		d := &account{id: resp.Driver.ID, token: resp.Token}
+		d.moveTo(s.near(s.opts.lat, s.opts.lng))
+		s.drivers[d.id] = d
+	}
+	return nil
+}
+
+// simulate runs every trip and returns how long that took. Drivers keep
+// reporting their location until the last trip is done.
+func (s *sim) simulate(ctx context.Context) time.Duration {
+	pingCtx, stopPings := context.WithCancel(ctx)
+	var pings sync.WaitGroup
+	for _, d := range s.drivers {
+		s.ping(pingCtx, d) // in the pool before the first request
+		pings.Add(1)
+		go func(d *account) {
+			defer pings.Done()
+			t := time.NewTicker(s.opts.ping)
+			defer t.Stop()
+			for {
+				select {
+				case <-pingCtx.Done():
+					return
+				case <-t.C:
+					s.ping(pingCtx, d)
+				}
+			}
+		}(d)
+	}
+
+	start := time.Now()
+	jobs := make(chan int)
+	var riders sync.WaitGroup
+	for i := 0; i < s.opts.riders; i++ {
+		rider, err := s.register(ctx, i)
+		if err != nil {
+			log.Printf("rider %d: %v", i, err)
+			continue
+		}
+		riders.Add(1)
+		go func() {
+			defer riders.Done()
+			for range jobs {
+				if err := s.trip(ctx, rider); err != nil {
+					s.failed.Add(1)
+					log.Print(err)
+				}
+			}
+		}()
+	}
+	for n := 0; n < s.opts.trips && ctx.Err() == nil; n++ {
+		jobs <- n
+	}
+	close(jobs)
+	riders.Wait()
+	elapsed := time.Since(start)
+
+	stopPings()
+	pings.Wait()
+	return elapsed
+}
+
+func (s *sim) register(ctx context.Context, i int) (*account, error) {
+	var resp struct {
+		Token string `json:"token"`
+		User  struct {
+			ID string `json:"id"`
+		} `json:"user"`
+	}
+	err := s.c.do(ctx, "rider.register", http.MethodPost, "/users/register", "", 0, map[string]string{
+		"name":            fmt.Sprintf("Sim Rider %05d-%d", s.run, i),
+		"email":           fmt.Sprintf("sim-rider-%05d-%d@example.com", s.run, i),
+		"phone":           fmt.Sprintf("+918%05d%04d", s.run, i),
+		"password":        "simulator",
+		"terms_version":   s.terms["terms_version"],
+		"privacy_version": s.terms["privacy_version"],
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+	return &account{id: resp.User.ID, token: resp.Token}, nil
+}
+
+func (s *sim) ping(ctx context.Context, d *account) {
+	lat, lng := d.position()
+	err := s.c.do(ctx, "driver.location", http.MethodPatch, "/drivers/"+d.id+"/location", d.token, 0,
+		map[string]float64{"lat": lat, "lng": lng}, nil)
+	if err != nil && ctx.Err() == nil {
+		log.Printf("driver %s: %v", d.id, err)
+	}
+}
+
+// trip takes one trip from request to completion for rider.
+func (s *sim) trip(ctx context.Context, rider *account) error {
+	begun := time.Now()
+	pickupLat, pickupLng := s.near(s.opts.lat, s.opts.lng)
+	dropLat, dropLng := s.near(pickupLat, pickupLng)
+
+	var created struct {
+		TripID string `json:"trip_id"`
+	}
+	if err := s.c.do(ctx, "trip.request", http.MethodPost, "/trips/request", rider.token, 0, map[string]float64{
+		"pickupLat": pickupLat, "pickupLng": pickupLng, "dropLat": dropLat, "dropLng": dropLng,
+	}, &created); err != nil {
+		return err
+	}
+	id := created.TripID
+
+	var chat <-chan time.Duration
+	if s.opts.ws {
+		conn, err := s.subscribe(ctx, id, rider.token)
+		if err != nil {
+			return fmt.Errorf("trip %s: %w", id, err)
+		}
+		defer conn.Close()
+		chat = fanout(conn)
+	}
+
+	t, err := s.awaitDriver(ctx, id, rider.token)
+	if err != nil {
+		return fmt.Errorf("trip %s: %w", id, err)
+	}
+	if t == nil {
+		s.unmatched.Add(1)
+		return nil
+	}
+	d, ok := s.drivers[*t.DriverID]
+	if !ok {
+		return fmt.Errorf("trip %s: matched to driver %s, who is not simulated", id, *t.DriverID)
+	}
+
+	path := "/trips/" + id
+	if err := s.c.do(ctx, "trip.accept", http.MethodPatch, path+"/accept", d.token, t.Version, nil, t); err != nil {
+		return err
+	}
+	d.moveTo(pickupLat, pickupLng)
+	if err := s.c.do(ctx, "trip.start", http.MethodPatch, path+"/start", d.token, t.Version, nil, t); err != nil {
+		return err
+	}
+	if s.opts.ws {
+		body := "sim " + strconv.FormatInt(time.Now().UnixNano(), 10)
+		if err := s.c.do(ctx, "chat.send", http.MethodPost, path+"/messages", d.token, 0, map[string]string{"body": body}, nil); err != nil {
+			return err
+		}
+	}
+	d.moveTo(dropLat, dropLng)
+	if err := s.c.do(ctx, "trip.end", http.MethodPatch, path+"/end", d.token, t.Version, map[string]any{}, t); err != nil {
+		return err
+	}
+	s.c.stats.record("trip.lifecycle", time.Since(begun), nil)
+	s.completed.Add(1)
+
+	if chat != nil {
+		select {
+		case d := <-chat:
+			s.c.stats.record("ws.fanout", d, nil)
+			s.fanout.Add(1)
+		case <-time.After(2 * time.Second):
+			s.c.stats.record("ws.fanout", 0, errors.New("not delivered"))
+		}
+	}
+	return nil
+}
+
+// awaitDriver polls the trip until a driver is assigned and records how long
+// that took. It returns nil if nobody is assigned within -match-timeout.
+func (s *sim) awaitDriver(ctx context.Context, id, token string) (*trip, error) {
+	start := time.Now()
+	deadline := start.Add(s.opts.matchTimeout)
+	for time.Now().Before(deadline) {
+		var t trip
+		if err := s.c.do(ctx, "trip.get", http.MethodGet, "/trips/"+id, token, 0, nil, &t); err != nil {
+			return nil, err
+		}
+		if t.DriverID != nil && t.Status == "DRIVER_ASSIGNED" {
+			s.c.stats.record("trip.match", time.Since(start), nil)
+			return &t, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+	s.c.stats.record("trip.match", time.Since(start), errors.New("timed out"))
+	return nil, nil
+}
+
+// subscribe opens the trip's WebSocket as token's owner.
+func (s *sim) subscribe(ctx context.Context, tripID, token string) (*websocket.Conn, error) {
+	url := "ws" + strings.TrimPrefix(s.c.base, "http") + "/ws/trips/" + tripID
+	start := time.Now()
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, url, http.Header{"Authorization": {"Bearer " + token}})
+	s.c.stats.record("ws.connect", time.Since(start), err)
+	return conn, err
+}
+
+// fanout reads conn until it closes and sends, for the simulator's chat
+// message, how long after sending it arrived.
+func fanout(conn *websocket.Conn) <-chan time.Duration {
+	out := make(chan time.Duration, 1)
+	go func() {
+		for {
+			var n struct {
+				Type    string `json:"type"`
+				Message *struct {
+					Body string `json:"body"`
+				} `json:"message"`
+			}
+			if err := conn.ReadJSON(&n); err != nil {
+				return // closed once the trip is done
+			}
+			if n.Type != "chat.message" || n.Message == nil {
+				continue
+			}
+			sent, err := strconv.ParseInt(strings.TrimPrefix(n.Message.Body, "sim "), 10, 64)
+			if err != nil {
+				continue
+			}
+			select {
+			case out <- time.Since(time.Unix(0, sent)):
+			default:
+			}
+		}
+	}()
+	return out
+}
+
+// near returns a random point within -spread km of lat, lng.
+func (s *sim) near(lat, lng float64) (float64, float64) {
+	dLat := (rand.Float64()*2 - 1) * s.opts.spreadKm / 111
+	dLng := (rand.Float64()*2 - 1) * s.opts.spreadKm / (111 * math.Cos(lat*math.Pi/180))
+	return lat + dLat, lng + dLng
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// stats collects latencies and failures per operation.
+type stats struct {
+	mu  sync.Mutex
+	ops map[string]*opStats
+}
+
+type opStats struct {
+	took   []time.Duration // successful calls
+	failed int
+}
+
+func newStats() *stats { return &stats{ops: map[string]*opStats{}} }
+
+// record adds one call of op that took d; a non-nil err counts it as failed.
+func (s *stats) record(op string, d time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.ops[op]
+	if !ok {
+		o = &opStats{}
+		s.ops[op] = o
+	}
+	if err != nil {
+		o.failed++
+		return
+	}
+	o.took = append(o.took, d)
+}
+
+// report writes a table of every operation: calls, failures, throughput over
+// elapsed and latency percentiles.
+func (s *stats) report(w io.Writer, elapsed time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.ops))
+	for name := range s.ops {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "operation\tok\tfailed\tper sec\tp50\tp95\tp99\tmax\t")
+	for _, name := range names {
+		o := s.ops[name]
+		slices.Sort(o.took)
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f\t%s\t%s\t%s\t%s\t\n", name, len(o.took), o.failed,
+			float64(len(o.took))/elapsed.Seconds(),
+			percentile(o.took, 50), percentile(o.took, 95), percentile(o.took, 99), percentile(o.took, 100))
+	}
+	tw.Flush()
+}
+
+// percentile returns the p-th percentile of sorted, rounded for display.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := (len(sorted)*p+99)/100 - 1
+	return sorted[max(i, 0)].Round(100 * time.Microsecond)
+}
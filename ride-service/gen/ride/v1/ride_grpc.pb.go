@@ -0,0 +1,521 @@
+// Internal service-to-service API for ride-service. Served over gRPC on
+// GRPC_PORT alongside the public HTTP API; callers authenticate with a JWT
+// carrying the "service" or "admin" role in the `authorization` metadata.
+//
+// Regenerate with `make proto` after editing.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: ride/v1/ride.proto
+
+package ridev1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	TripService_GetTrip_FullMethodName         = "/ride.v1.TripService/GetTrip"
+	TripService_AssignDriver_FullMethodName    = "/ride.v1.TripService/AssignDriver"
+	TripService_StartTrip_FullMethodName       = "/ride.v1.TripService/StartTrip"
+	TripService_EndTrip_FullMethodName         = "/ride.v1.TripService/EndTrip"
+	TripService_ListActiveTrips_FullMethodName = "/ride.v1.TripService/ListActiveTrips"
+)
+
+// TripServiceClient is the client API for TripService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type TripServiceClient interface {
+	GetTrip(ctx context.Context, in *GetTripRequest, opts ...grpc.CallOption) (*Trip, error)
+	AssignDriver(ctx context.Context, in *AssignDriverRequest, opts ...grpc.CallOption) (*Trip, error)
+	StartTrip(ctx context.Context, in *StartTripRequest, opts ...grpc.CallOption) (*Trip, error)
+	EndTrip(ctx context.Context, in *EndTripRequest, opts ...grpc.CallOption) (*Trip, error)
+	ListActiveTrips(ctx context.Context, in *ListActiveTripsRequest, opts ...grpc.CallOption) (*ListActiveTripsResponse, error)
+}
+
+type tripServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewTripServiceClient(cc grpc.ClientConnInterface) TripServiceClient {
+	return &tripServiceClient{cc}
+}
+
+func (c *tripServiceClient) GetTrip(ctx context.Context, in *GetTripRequest, opts ...grpc.CallOption) (*Trip, error) {
+	out := new(Trip)
+	err := c.cc.Invoke(ctx, TripService_GetTrip_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tripServiceClient) AssignDriver(ctx context.Context, in *AssignDriverRequest, opts ...grpc.CallOption) (*Trip, error) {
+	out := new(Trip)
+	err := c.cc.Invoke(ctx, TripService_AssignDriver_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tripServiceClient) StartTrip(ctx context.Context, in *StartTripRequest, opts ...grpc.CallOption) (*Trip, error) {
+	out := new(Trip)
+	err := c.cc.Invoke(ctx, TripService_StartTrip_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tripServiceClient) EndTrip(ctx context.Context, in *EndTripRequest, opts ...grpc.CallOption) (*Trip, error) {
+	out := new(Trip)
+	err := c.cc.Invoke(ctx, TripService_EndTrip_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *tripServiceClient) ListActiveTrips(ctx context.Context, in *ListActiveTripsRequest, opts ...grpc.CallOption) (*ListActiveTripsResponse, error) {
+	out := new(ListActiveTripsResponse)
+	err := c.cc.Invoke(ctx, TripService_ListActiveTrips_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// TripServiceServer is the server API for TripService service.
+// All implementations must embed UnimplementedTripServiceServer
+// for forward compatibility
+type TripServiceServer interface {
+	GetTrip(context.Context, *GetTripRequest) (*Trip, error)
+	AssignDriver(context.Context, *AssignDriverRequest) (*Trip, error)
+	StartTrip(context.Context, *StartTripRequest) (*Trip, error)
+	EndTrip(context.Context, *EndTripRequest) (*Trip, error)
+	ListActiveTrips(context.Context, *ListActiveTripsRequest) (*ListActiveTripsResponse, error)
+	mustEmbedUnimplementedTripServiceServer()
+}
+
+// UnimplementedTripServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedTripServiceServer struct {
+}
+
+func (UnimplementedTripServiceServer) GetTrip(context.Context, *GetTripRequest) (*Trip, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetTrip not implemented")
+}
+func (UnimplementedTripServiceServer) AssignDriver(context.Context, *AssignDriverRequest) (*Trip, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AssignDriver not implemented")
+}
+func (UnimplementedTripServiceServer) StartTrip(context.Context, *StartTripRequest) (*Trip, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StartTrip not implemented")
+}
+func (UnimplementedTripServiceServer) EndTrip(context.Context, *EndTripRequest) (*Trip, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method EndTrip not implemented")
+}
+func (UnimplementedTripServiceServer) ListActiveTrips(context.Context, *ListActiveTripsRequest) (*ListActiveTripsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListActiveTrips not implemented")
+}
+func (UnimplementedTripServiceServer) mustEmbedUnimplementedTripServiceServer() {}
+
+// UnsafeTripServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to TripServiceServer will
+// result in compilation errors.
+type UnsafeTripServiceServer interface {
+	mustEmbedUnimplementedTripServiceServer()
+}
+
+func RegisterTripServiceServer(s grpc.ServiceRegistrar, srv TripServiceServer) {
+	s.RegisterService(&TripService_ServiceDesc, srv)
+}
+
+func _TripService_GetTrip_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetTripRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TripServiceServer).GetTrip(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TripService_GetTrip_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TripServiceServer).GetTrip(ctx, req.(*GetTripRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TripService_AssignDriver_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AssignDriverRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TripServiceServer).AssignDriver(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TripService_AssignDriver_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TripServiceServer).AssignDriver(ctx, req.(*AssignDriverRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TripService_StartTrip_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StartTripRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TripServiceServer).StartTrip(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TripService_StartTrip_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TripServiceServer).StartTrip(ctx, req.(*StartTripRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TripService_EndTrip_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EndTripRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TripServiceServer).EndTrip(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TripService_EndTrip_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TripServiceServer).EndTrip(ctx, req.(*EndTripRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TripService_ListActiveTrips_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListActiveTripsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TripServiceServer).ListActiveTrips(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: TripService_ListActiveTrips_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TripServiceServer).ListActiveTrips(ctx, req.(*ListActiveTripsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// TripService_ServiceDesc is the grpc.ServiceDesc for TripService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var TripService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ride.v1.TripService",
+	HandlerType: (*TripServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetTrip",
+			Handler:    _TripService_GetTrip_Handler,
+		},
+		{
+			MethodName: "AssignDriver",
+			Handler:    _TripService_AssignDriver_Handler,
+		},
+		{
+			MethodName: "StartTrip",
+			Handler:    _TripService_StartTrip_Handler,
+		},
+		{
+			MethodName: "EndTrip",
+			Handler:    _TripService_EndTrip_Handler,
+		},
+		{
+			MethodName: "ListActiveTrips",
+			Handler:    _TripService_ListActiveTrips_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "ride/v1/ride.proto",
+}
+
+const (
+	DriverService_GetDriver_FullMethodName         = "/ride.v1.DriverService/GetDriver"
+	DriverService_GetVehicleCard_FullMethodName    = "/ride.v1.DriverService/GetVehicleCard"
+	DriverService_ListNearbyDrivers_FullMethodName = "/ride.v1.DriverService/ListNearbyDrivers"
+)
+
+// DriverServiceClient is the client API for DriverService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type DriverServiceClient interface {
+	GetDriver(ctx context.Context, in *GetDriverRequest, opts ...grpc.CallOption) (*Driver, error)
+	GetVehicleCard(ctx context.Context, in *GetVehicleCardRequest, opts ...grpc.CallOption) (*VehicleCard, error)
+	ListNearbyDrivers(ctx context.Context, in *ListNearbyDriversRequest, opts ...grpc.CallOption) (*ListNearbyDriversResponse, error)
+}
+
+type driverServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewDriverServiceClient(cc grpc.ClientConnInterface) DriverServiceClient {
+	return &driverServiceClient{cc}
+}
+
+func (c *driverServiceClient) GetDriver(ctx context.Context, in *GetDriverRequest, opts ...grpc.CallOption) (*Driver, error) {
+	out := new(Driver)
+	err := c.cc.Invoke(ctx, DriverService_GetDriver_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *driverServiceClient) GetVehicleCard(ctx context.Context, in *GetVehicleCardRequest, opts ...grpc.CallOption) (*VehicleCard, error) {
+	out := new(VehicleCard)
+	err := c.cc.Invoke(ctx, DriverService_GetVehicleCard_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *driverServiceClient) ListNearbyDrivers(ctx context.Context, in *ListNearbyDriversRequest, opts ...grpc.CallOption) (*ListNearbyDriversResponse, error) {
+	out := new(ListNearbyDriversResponse)
+	err := c.cc.Invoke(ctx, DriverService_ListNearbyDrivers_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DriverServiceServer is the server API for DriverService service.
+// All implementations must embed UnimplementedDriverServiceServer
+// for forward compatibility
+type DriverServiceServer interface {
+	GetDriver(context.Context, *GetDriverRequest) (*Driver, error)
+	GetVehicleCard(context.Context, *GetVehicleCardRequest) (*VehicleCard, error)
+	ListNearbyDrivers(context.Context, *ListNearbyDriversRequest) (*ListNearbyDriversResponse, error)
+	mustEmbedUnimplementedDriverServiceServer()
+}
+
+// UnimplementedDriverServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedDriverServiceServer struct {
+}
+
+func (UnimplementedDriverServiceServer) GetDriver(context.Context, *GetDriverRequest) (*Driver, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetDriver not implemented")
+}
+func (UnimplementedDriverServiceServer) GetVehicleCard(context.Context, *GetVehicleCardRequest) (*VehicleCard, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetVehicleCard not implemented")
+}
+func (UnimplementedDriverServiceServer) ListNearbyDrivers(context.Context, *ListNearbyDriversRequest) (*ListNearbyDriversResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListNearbyDrivers not implemented")
+}
+func (UnimplementedDriverServiceServer) mustEmbedUnimplementedDriverServiceServer() {}
+
+// UnsafeDriverServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to DriverServiceServer will
+// result in compilation errors.
+type UnsafeDriverServiceServer interface {
+	mustEmbedUnimplementedDriverServiceServer()
+}
+
+func RegisterDriverServiceServer(s grpc.ServiceRegistrar, srv DriverServiceServer) {
+	s.RegisterService(&DriverService_ServiceDesc, srv)
+}
+
+func _DriverService_GetDriver_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetDriverRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DriverServiceServer).GetDriver(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DriverService_GetDriver_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DriverServiceServer).GetDriver(ctx, req.(*GetDriverRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DriverService_GetVehicleCard_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetVehicleCardRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DriverServiceServer).GetVehicleCard(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DriverService_GetVehicleCard_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DriverServiceServer).GetVehicleCard(ctx, req.(*GetVehicleCardRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DriverService_ListNearbyDrivers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListNearbyDriversRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DriverServiceServer).ListNearbyDrivers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DriverService_ListNearbyDrivers_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DriverServiceServer).ListNearbyDrivers(ctx, req.(*ListNearbyDriversRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// DriverService_ServiceDesc is the grpc.ServiceDesc for DriverService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var DriverService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ride.v1.DriverService",
+	HandlerType: (*DriverServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetDriver",
+			Handler:    _DriverService_GetDriver_Handler,
+		},
+		{
+			MethodName: "GetVehicleCard",
+			Handler:    _DriverService_GetVehicleCard_Handler,
+		},
+		{
+			MethodName: "ListNearbyDrivers",
+			Handler:    _DriverService_ListNearbyDrivers_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "ride/v1/ride.proto",
+}
+
+const (
+	MatchingService_FindCandidates_FullMethodName = "/ride.v1.MatchingService/FindCandidates"
+)
+
+// MatchingServiceClient is the client API for MatchingService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type MatchingServiceClient interface {
+	// FindCandidates returns the drivers the matcher would consider for a
+	// pickup, without assigning any of them.
+	FindCandidates(ctx context.Context, in *FindCandidatesRequest, opts ...grpc.CallOption) (*FindCandidatesResponse, error)
+}
+
+type matchingServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMatchingServiceClient(cc grpc.ClientConnInterface) MatchingServiceClient {
+	return &matchingServiceClient{cc}
+}
+
+func (c *matchingServiceClient) FindCandidates(ctx context.Context, in *FindCandidatesRequest, opts ...grpc.CallOption) (*FindCandidatesResponse, error) {
+	out := new(FindCandidatesResponse)
+	err := c.cc.Invoke(ctx, MatchingService_FindCandidates_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// MatchingServiceServer is the server API for MatchingService service.
+// All implementations must embed UnimplementedMatchingServiceServer
+// for forward compatibility
+type MatchingServiceServer interface {
+	// FindCandidates returns the drivers the matcher would consider for a
+	// pickup, without assigning any of them.
+	FindCandidates(context.Context, *FindCandidatesRequest) (*FindCandidatesResponse, error)
+	mustEmbedUnimplementedMatchingServiceServer()
+}
+
+// UnimplementedMatchingServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedMatchingServiceServer struct {
+}
+
+func (UnimplementedMatchingServiceServer) FindCandidates(context.Context, *FindCandidatesRequest) (*FindCandidatesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method FindCandidates not implemented")
+}
+func (UnimplementedMatchingServiceServer) mustEmbedUnimplementedMatchingServiceServer() {}
+
+// UnsafeMatchingServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MatchingServiceServer will
+// result in compilation errors.
+type UnsafeMatchingServiceServer interface {
+	mustEmbedUnimplementedMatchingServiceServer()
+}
+
+func RegisterMatchingServiceServer(s grpc.ServiceRegistrar, srv MatchingServiceServer) {
+	s.RegisterService(&MatchingService_ServiceDesc, srv)
+}
+
+func _MatchingService_FindCandidates_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FindCandidatesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MatchingServiceServer).FindCandidates(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MatchingService_FindCandidates_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MatchingServiceServer).FindCandidates(ctx, req.(*FindCandidatesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// MatchingService_ServiceDesc is the grpc.ServiceDesc for MatchingService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var MatchingService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ride.v1.MatchingService",
+	HandlerType: (*MatchingServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "FindCandidates",
+			Handler:    _MatchingService_FindCandidates_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "ride/v1/ride.proto",
+}
@@ -0,0 +1,61 @@
+package audit
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Actions recorded by the services, with before/after snapshots. Other admin
+// mutations are recorded by Middleware as "admin:<METHOD> <route>".
+const (
+	UserDeactivate   = "user.deactivate"
+	UserRestore      = "user.restore"
+	DriverDeactivate = "driver.deactivate"
+	DriverRestore    = "driver.restore"
+	TripAssign       = "trip.assign"     // manual assignment, bypassing matching
+	LoginLockout     = "auth.lockout"    // an account's logins locked after failures
+	LoginIPLockout   = "auth.ip_lockout" // a client IP's logins locked after failures
+)
+
+// Target types.
+const (
+	TargetUser   = "user"
+	TargetDriver = "driver"
+	TargetTrip   = "trip"
+	TargetIP     = "ip"
+)
+
+// ActorSystem is the actor of changes made without a caller token.
+const ActorSystem = "system"
+
+// Entry is one audit_log row.
+type Entry struct {
+	ID         string          `json:"id"`
+	ActorID    string          `json:"actor_id"`
+	ActorRole  string          `json:"actor_role,omitempty"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type,omitempty"`
+	TargetID   string          `json:"target_id,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+// Filter narrows GET /admin/audit. Zero values mean "any".
+type Filter struct {
+	ActorID    string
+	Action     string // exact, or a prefix ending in "." or ":" (e.g. "user.")
+	TargetType string
+	TargetID   string
+	From, To   time.Time // [From, To)
+	Limit      int
+	Offset     int
+}
+
+// Page is a page of GET /admin/audit, newest first. Total counts every match.
+type Page struct {
+	Entries []Entry `json:"entries"`
+	Total   int     `json:"total"`
+	Limit   int     `json:"limit"`
+	Offset  int     `json:"offset"`
+}
@@ -0,0 +1,140 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/pkg/jwt"
+	"ride-service/pkg/logging"
+)
+
+var logger = logging.For("audit")
+
+// Service appends to and reads the audit log.
+type Service struct {
+	db *pgxpool.Pool
+}
+
+// NewService creates an audit service. A nil *Service records nothing, for
+// services built without a database (tests, memory repos).
+func NewService(db *pgxpool.Pool) *Service {
+	return &Service{db: db}
+}
+
+type recordedKey struct{}
+
+// Record appends an entry for the caller in ctx (ActorSystem without one).
+// before and after are JSON snapshots of the target; either may be nil. The
+// change has already happened when Record runs, so a failed write is logged
+// rather than returned.
+func (s *Service) Record(ctx context.Context, action, targetType, targetID string, before, after any) {
+	if s == nil {
+		return
+	}
+	e := Entry{ActorID: ActorSystem, Action: action, TargetType: targetType, TargetID: targetID}
+	if c := jwt.GetClaims(ctx); c != nil {
+		e.ActorID, e.ActorRole = c.UserID, c.Role
+	}
+	var err error
+	if e.Before, err = snapshot(before); err == nil {
+		e.After, err = snapshot(after)
+	}
+	if err == nil {
+		err = s.insert(ctx, e)
+	}
+	if err != nil {
+		logger.Error("audit write failed", "action", action, "target", targetID, "actor", e.ActorID, "err", err)
+		return
+	}
+	if done, ok := ctx.Value(recordedKey{}).(*bool); ok {
+		*done = true
+	}
+}
+
+func (s *Service) insert(ctx context.Context, e Entry) error {
+	// Detached from the request: the change is made, so its record must not
+	// be lost to a client hanging up.
+	_, err := s.db.Exec(context.WithoutCancel(ctx),
+		`INSERT INTO audit_log (id,actor_id,actor_role,action,target_type,target_id,before,after)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7,$8)`,
+		uuid.New().String(), e.ActorID, e.ActorRole, e.Action, e.TargetType, e.TargetID, []byte(e.Before), []byte(e.After))
+	return err
+}
+
+func snapshot(v any) (json.RawMessage, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if raw, ok := v.(json.RawMessage); ok {
+		return raw, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil || string(b) == "null" { // typed nil pointer
+		return nil, err
+	}
+	return b, nil
+}
+
+// List returns one page of entries matching f, newest first.
+func (s *Service) List(ctx context.Context, f Filter) (*Page, error) {
+	var where []string
+	var args []any
+	add := func(cond string, v any) {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	if f.ActorID != "" {
+		add("actor_id = $%d", f.ActorID)
+	}
+	switch {
+	case strings.HasSuffix(f.Action, ".") || strings.HasSuffix(f.Action, ":"):
+		add("starts_with(action, $%d)", f.Action)
+	case f.Action != "":
+		add("action = $%d", f.Action)
+	}
+	if f.TargetType != "" {
+		add("target_type = $%d", f.TargetType)
+	}
+	if f.TargetID != "" {
+		add("target_id = $%d", f.TargetID)
+	}
+	if !f.From.IsZero() {
+		add("created_at >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		add("created_at < $%d", f.To)
+	}
+	cond := ""
+	if len(where) > 0 {
+		cond = "WHERE " + strings.Join(where, " AND ")
+	}
+
+	page := &Page{Entries: []Entry{}, Limit: f.Limit, Offset: f.Offset}
+	if err := s.db.QueryRow(ctx, `SELECT COUNT(*) FROM audit_log `+cond, args...).Scan(&page.Total); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(ctx,
+		`SELECT id,actor_id,actor_role,action,target_type,target_id,before,after,created_at FROM audit_log `+cond+
+			fmt.Sprintf(` ORDER BY created_at DESC, id LIMIT $%d OFFSET $%d`, len(args)+1, len(args)+2),
+		append(args, f.Limit, f.Offset)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e Entry
+		var before, after []byte
+		if err := rows.Scan(&e.ID, &e.ActorID, &e.ActorRole, &e.Action, &e.TargetType, &e.TargetID,
+			&before, &after, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.Before, e.After = before, after
+		page.Entries = append(page.Entries, e)
+	}
+	return page, rows.Err()
+}
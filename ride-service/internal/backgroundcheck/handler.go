@@ -0,0 +1,82 @@
+package backgroundcheck
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+	"ride-service/pkg/webhook"
+)
+
+// maxCallbackBytes caps a vendor callback body.
+const maxCallbackBytes = 64 << 10
+
+// Handler exposes a driver's check to them and to staff, and takes the
+// vendor's callbacks.
+type Handler struct {
+	svc    *Service
+	secret []byte
+}
+
+// NewHandler wires a handler to the background check service. secret
+// verifies vendor callbacks; they are refused without one.
+func NewHandler(svc *Service, secret string) *Handler {
+	return &Handler{svc: svc, secret: []byte(secret)}
+}
+
+// Routes returns the routes mounted at /drivers/{id}/background-check.
+func (h *Handler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Post("/callback", h.Callback) // the vendor, signed with X-Ride-Signature
+
+	r.Group(func(r chi.Router) {
+		r.Use(jwt.RequireAuth)
+		r.Get("/", h.Get)
+	})
+	return r
+}
+
+func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	claims := jwt.GetClaims(r.Context())
+	if claims.UserID != id && claims.Role != "admin" && claims.Role != "support" {
+		apierror.Write(w, apierror.Forbidden("forbidden"))
+		return
+	}
+	c, err := h.svc.Get(r.Context(), id)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, c)
+}
+
+// Callback takes a status report from the vendor. The body must be signed
+// like our own webhooks: X-Ride-Signature: sha256=<hex HMAC-SHA256 of the
+// body> with the shared secret.
+func (h *Handler) Callback(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxCallbackBytes))
+	if err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	if !webhook.Verify(h.secret, body, r.Header.Get(webhook.SignatureHeader)) {
+		apierror.Write(w, apierror.Unauthorized("unauthorized"))
+		return
+	}
+	var req CallbackRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	c, err := h.svc.Report(r.Context(), chi.URLParam(r, "id"), req)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, c)
+}
@@ -0,0 +1,47 @@
+package backgroundcheck
+
+import "time"
+
+// Statuses a driver's background check can have. Drivers start at
+// NotStarted; the vendor moves them to Pending when it opens a check, then
+// to Passed or Failed. A result the vendor wants a person to adjudicate
+// stays Pending until it is settled.
+const (
+	NotStarted = "not_started"
+	Pending    = "pending"
+	Passed     = "passed"
+	Failed     = "failed"
+)
+
+// Reported are the statuses a vendor may report.
+var Reported = []string{Pending, Passed, Failed}
+
+// Check is a driver's background check status and the reports behind it.
+type Check struct {
+	DriverID  string     `json:"driver_id"`
+	Status    string     `json:"status"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"` // when the vendor reached Status
+	Reports   []Report   `json:"reports"`              // newest first
+}
+
+// Report is one status a vendor reported.
+type Report struct {
+	ID         string    `json:"id"`
+	Vendor     string    `json:"vendor"`
+	Reference  string    `json:"reference"`
+	Status     string    `json:"status"`
+	Reason     string    `json:"reason,omitempty"`
+	OccurredAt time.Time `json:"occurred_at"`
+	ReceivedAt time.Time `json:"received_at"`
+}
+
+// CallbackRequest is the body vendors send to
+// POST /drivers/:id/background-check/callback. Each vendor's adapter maps
+// its own outcome names to Status.
+type CallbackRequest struct {
+	Vendor     string    `json:"vendor" validate:"required,maxLength=50"`
+	Reference  string    `json:"reference" validate:"required,maxLength=200"` // the vendor's ID for the check
+	Status     string    `json:"status" validate:"required"`                  // pending | passed | failed
+	Reason     string    `json:"reason" validate:"maxLength=1000"`            // why a check failed, shown to the driver
+	OccurredAt time.Time `json:"occurred_at"`                                 // when the status changed; defaults to now
+}
@@ -0,0 +1,141 @@
+// Package backgroundcheck keeps drivers' background check status, as
+// reported by an external check vendor. Which vendor runs the checks does
+// not matter here: each reports in the same callback format.
+package backgroundcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/db"
+	"ride-service/pkg/logging"
+	"ride-service/pkg/validation"
+)
+
+var logger = logging.For("backgroundcheck")
+
+var (
+	ErrDriverNotFound = apierror.NotFound("driver not found")
+	ErrInvalid        = apierror.Validation("invalid request")
+)
+
+// maxReports caps the reports returned with a check.
+const maxReports = 50
+
+// Listener is told when a driver's status changes, e.g. to take a driver
+// whose check failed offline, or to tell them. Listeners handle their own
+// errors.
+type Listener interface {
+	BackgroundCheckChanged(ctx context.Context, driverID, status string)
+}
+
+// Service records vendor reports and keeps drivers.background_check.
+type Service struct {
+	db        *pgxpool.Pool
+	listeners []Listener
+}
+
+// NewService creates a background check service telling listeners about
+// status changes, in order.
+func NewService(db *pgxpool.Pool, listeners ...Listener) *Service {
+	return &Service{db: db, listeners: listeners}
+}
+
+// Get returns the driver's status and latest reports.
+func (s *Service) Get(ctx context.Context, driverID string) (*Check, error) {
+	c := &Check{DriverID: driverID}
+	err := s.db.QueryRow(ctx, `SELECT background_check, background_check_at FROM drivers WHERE id=$1`, driverID).
+		Scan(&c.Status, &c.UpdatedAt)
+	if isNotFound(err) {
+		return nil, ErrDriverNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(ctx,
+		`SELECT id,vendor,reference,status,COALESCE(reason,''),occurred_at,received_at
+		 FROM background_check_reports WHERE driver_id=$1 ORDER BY occurred_at DESC, received_at DESC LIMIT $2`,
+		driverID, maxReports)
+	if err != nil {
+		return nil, err
+	}
+	c.Reports, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (Report, error) {
+		var r Report
+		err := row.Scan(&r.ID, &r.Vendor, &r.Reference, &r.Status, &r.Reason, &r.OccurredAt, &r.ReceivedAt)
+		return r, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Report records a status the vendor reported for the driver and returns
+// their check. A report is kept once however often the vendor sends it, and
+// one older than the driver's current status (callbacks arriving out of
+// order) goes into the history without changing it.
+func (s *Service) Report(ctx context.Context, driverID string, req CallbackRequest) (*Check, error) {
+	if err := validation.Struct(req); err != nil {
+		return nil, err
+	}
+	if !slices.Contains(Reported, req.Status) {
+		return nil, fmt.Errorf("%w: status must be one of %s", ErrInvalid, strings.Join(Reported, ", "))
+	}
+	now := time.Now()
+	if req.OccurredAt.IsZero() || req.OccurredAt.After(now) {
+		req.OccurredAt = now
+	}
+
+	var from string
+	changed := false
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		var at *time.Time
+		err := tx.QueryRow(ctx, `SELECT background_check, background_check_at FROM drivers WHERE id=$1 FOR UPDATE`, driverID).
+			Scan(&from, &at)
+		if isNotFound(err) {
+			return ErrDriverNotFound
+		}
+		if err != nil {
+			return err
+		}
+		tag, err := tx.Exec(ctx,
+			`INSERT INTO background_check_reports (id,driver_id,vendor,reference,status,reason,occurred_at)
+			 VALUES ($1,$2,$3,$4,$5,NULLIF($6,''),$7) ON CONFLICT (vendor,reference,status) DO NOTHING`,
+			uuid.NewString(), driverID, req.Vendor, req.Reference, req.Status, req.Reason, req.OccurredAt)
+		if err != nil || tag.RowsAffected() == 0 {
+			return err
+		}
+		if at != nil && req.OccurredAt.Before(*at) {
+			return nil
+		}
+		changed = from != req.Status
+		_, err = tx.Exec(ctx, `UPDATE drivers SET background_check=$1, background_check_at=$2 WHERE id=$3`,
+			req.Status, req.OccurredAt, driverID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if changed {
+		logger.Info("background check changed", "driver", driverID, "from", from, "to", req.Status, "vendor", req.Vendor)
+		for _, l := range s.listeners {
+			l.BackgroundCheckChanged(ctx, driverID, req.Status)
+		}
+	}
+	return s.Get(ctx, driverID)
+}
+
+func isNotFound(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.Is(err, pgx.ErrNoRows) || errors.As(err, &pgErr) && pgErr.Code == "22P02" // malformed uuid
+}
@@ -0,0 +1,111 @@
+package blocks
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+)
+
+// Handler exposes blocks to riders, drivers and staff.
+type Handler struct{ svc *Service }
+
+// NewHandler wires a handler to the block service.
+func NewHandler(svc *Service) *Handler { return &Handler{svc: svc} }
+
+// TripRoutes returns the routes mounted at /trips/{id}/block.
+func (h *Handler) TripRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+
+	r.Post("/", h.Block)
+
+	return r
+}
+
+// Routes returns the routes mounted at /blocks: the caller's own blocks.
+func (h *Handler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+
+	r.Get("/", h.Mine)
+	r.Delete("/{id}", h.Unblock)
+
+	return r
+}
+
+// AdminRoutes returns the routes mounted under /admin/blocks.
+func (h *Handler) AdminRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth, jwt.RequireRole("admin", "support"))
+
+	r.Get("/", h.List)
+	r.Delete("/{id}", h.Clear)
+
+	return r
+}
+
+func (h *Handler) Block(w http.ResponseWriter, r *http.Request) {
+	var req BlockRequest
+	// The body is optional: a block needs no reason.
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	b, err := h.svc.Block(r.Context(), chi.URLParam(r, "id"), jwt.GetClaims(r.Context()).UserID, req)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusCreated, b)
+}
+
+func (h *Handler) Mine(w http.ResponseWriter, r *http.Request) {
+	l, err := h.svc.Mine(r.Context(), jwt.GetClaims(r.Context()).UserID)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, l)
+}
+
+func (h *Handler) Unblock(w http.ResponseWriter, r *http.Request) {
+	if err := h.svc.Unblock(r.Context(), chi.URLParam(r, "id"), jwt.GetClaims(r.Context()).UserID); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]string{"status": "unblocked"})
+}
+
+// List serves GET /admin/blocks?rider_id=&driver_id=&limit=&offset=.
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := 50
+	if v, err := strconv.Atoi(q.Get("limit")); err == nil && v > 0 && v <= 200 {
+		limit = v
+	}
+	offset := 0
+	if v, err := strconv.Atoi(q.Get("offset")); err == nil && v > 0 {
+		offset = v
+	}
+	page, err := h.svc.List(r.Context(), q.Get("rider_id"), q.Get("driver_id"), limit, offset)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, page)
+}
+
+func (h *Handler) Clear(w http.ResponseWriter, r *http.Request) {
+	if err := h.svc.Clear(r.Context(), chi.URLParam(r, "id")); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]string{"status": "unblocked"})
+}
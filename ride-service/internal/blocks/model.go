@@ -0,0 +1,42 @@
+package blocks
+
+import "time"
+
+// MaxReason caps the reason given for a block, in characters.
+const MaxReason = 500
+
+// Sides of a block: who asked for it.
+const (
+	ByRider  = "rider"
+	ByDriver = "driver"
+)
+
+// Block keeps a rider and a driver apart: the matcher never pairs them
+// again, whichever side asked.
+type Block struct {
+	ID        string    `json:"id"`
+	RiderID   string    `json:"rider_id"`
+	DriverID  string    `json:"driver_id"`
+	BlockedBy string    `json:"blocked_by"` // rider | driver
+	TripID    string    `json:"trip_id"`    // the trip they shared
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BlockRequest is the body for POST /trips/{id}/block.
+type BlockRequest struct {
+	Reason string `json:"reason" validate:"maxLength=500"`
+}
+
+// List is the caller's blocks for GET /blocks, newest first.
+type List struct {
+	Blocks []Block `json:"blocks"`
+}
+
+// Page is a page of GET /admin/blocks, newest first.
+type Page struct {
+	Blocks []Block `json:"blocks"`
+	Total  int     `json:"total"`
+	Limit  int     `json:"limit"`
+	Offset int     `json:"offset"`
+}
@@ -0,0 +1,186 @@
+package blocks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/internal/trips"
+	"ride-service/pkg/apierror"
+)
+
+var (
+	ErrTripNotFound   = apierror.NotFound("trip not found")
+	ErrNotFound       = apierror.NotFound("block not found")
+	ErrNotParticipant = apierror.Forbidden("not a participant in this trip")
+	ErrNoDriver       = apierror.Conflict("trip has no driver to block")
+	ErrAlreadyBlocked = apierror.Conflict("already blocked").WithCode("already_blocked")
+	ErrInvalid        = apierror.Validation("invalid block")
+)
+
+const columns = `id,rider_id,driver_id,blocked_by,trip_id,reason,created_at`
+
+// mine matches the blocks $1 made, as the rider or as the driver.
+const mine = `((blocked_by='rider' AND rider_id=$1) OR (blocked_by='driver' AND driver_id=$1))`
+
+// TripReader returns trips; trips.TripRepo implements it.
+type TripReader interface {
+	GetByID(ctx context.Context, id string) (*trips.Trip, error)
+}
+
+// Service keeps riders' and drivers' blocks of each other. Each side blocks
+// the other from a trip they shared, so nobody can block an account they
+// never met; the matcher asks Blocked before offering a driver to a rider.
+type Service struct {
+	db    *pgxpool.Pool
+	trips TripReader
+}
+
+// NewService creates a block service.
+func NewService(db *pgxpool.Pool, t TripReader) *Service {
+	return &Service{db: db, trips: t}
+}
+
+// Block blocks the other side of the trip for userID, its rider or its
+// driver. A side blocks the other once.
+func (s *Service) Block(ctx context.Context, tripID, userID string, req BlockRequest) (*Block, error) {
+	reason := strings.TrimSpace(req.Reason)
+	if utf8.RuneCountInString(reason) > MaxReason {
+		return nil, fmt.Errorf("%w: reason is at most %d characters", ErrInvalid, MaxReason)
+	}
+	t, err := s.trips.GetByID(ctx, tripID)
+	if errors.Is(err, trips.ErrNotFound) {
+		return nil, ErrTripNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	riderID, driverID := t.RiderID, t.DriverID
+	var by string
+	switch {
+	case userID == riderID:
+		by = ByRider
+	case driverID != nil && userID == *driverID:
+		by = ByDriver
+	default:
+		return nil, ErrNotParticipant
+	}
+	if driverID == nil {
+		return nil, ErrNoDriver
+	}
+	b, err := scanBlock(s.db.QueryRow(ctx,
+		`INSERT INTO blocks (id,rider_id,driver_id,blocked_by,trip_id,reason) VALUES ($1,$2,$3,$4,$5,$6)
+		 ON CONFLICT (rider_id,driver_id,blocked_by) DO NOTHING RETURNING `+columns,
+		uuid.New().String(), riderID, *driverID, by, tripID, reason))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrAlreadyBlocked
+	}
+	return b, err
+}
+
+// Mine returns the blocks userID made, newest first. Blocks of them by
+// others are not shown.
+func (s *Service) Mine(ctx context.Context, userID string) (*List, error) {
+	rows, err := s.db.Query(ctx, `SELECT `+columns+` FROM blocks WHERE `+mine+` ORDER BY created_at DESC, id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	l := &List{Blocks: []Block{}}
+	l.Blocks, err = collect(rows, l.Blocks)
+	return l, err
+}
+
+// Unblock lifts a block userID made.
+func (s *Service) Unblock(ctx context.Context, id, userID string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrNotFound
+	}
+	tag, err := s.db.Exec(ctx, `DELETE FROM blocks WHERE id=$2 AND `+mine, userID, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// List returns one page of blocks for staff, newest first, narrowed to a
+// rider and/or a driver when given.
+func (s *Service) List(ctx context.Context, riderID, driverID string, limit, offset int) (*Page, error) {
+	for _, id := range []string{riderID, driverID} {
+		if _, err := uuid.Parse(id); id != "" && err != nil {
+			return nil, fmt.Errorf("%w: rider_id and driver_id must be UUIDs", ErrInvalid)
+		}
+	}
+	const where = `($1='' OR rider_id::text=$1) AND ($2='' OR driver_id::text=$2)`
+	p := &Page{Blocks: []Block{}, Limit: limit, Offset: offset}
+	if err := s.db.QueryRow(ctx, `SELECT COUNT(*) FROM blocks WHERE `+where, riderID, driverID).Scan(&p.Total); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(ctx,
+		`SELECT `+columns+` FROM blocks WHERE `+where+` ORDER BY created_at DESC, id LIMIT $3 OFFSET $4`,
+		riderID, driverID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	p.Blocks, err = collect(rows, p.Blocks)
+	return p, err
+}
+
+// Clear lifts any block for staff.
+func (s *Service) Clear(ctx context.Context, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrNotFound
+	}
+	tag, err := s.db.Exec(ctx, `DELETE FROM blocks WHERE id=$1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Blocked returns those of driverIDs who must not be matched with riderID:
+// a block either way keeps them apart.
+func (s *Service) Blocked(ctx context.Context, riderID string, driverIDs []string) ([]string, error) {
+	if len(driverIDs) == 0 {
+		return nil, nil
+	}
+	if _, err := uuid.Parse(riderID); err != nil {
+		return nil, nil
+	}
+	rows, err := s.db.Query(ctx,
+		`SELECT DISTINCT driver_id FROM blocks WHERE rider_id=$1 AND driver_id = ANY($2::uuid[])`, riderID, driverIDs)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+func collect(rows pgx.Rows, into []Block) ([]Block, error) {
+	defer rows.Close()
+	for rows.Next() {
+		b, err := scanBlock(rows)
+		if err != nil {
+			return nil, err
+		}
+		into = append(into, *b)
+	}
+	return into, rows.Err()
+}
+
+func scanBlock(row pgx.Row) (*Block, error) {
+	var b Block
+	if err := row.Scan(&b.ID, &b.RiderID, &b.DriverID, &b.BlockedBy, &b.TripID, &b.Reason, &b.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
@@ -0,0 +1,62 @@
+package chat
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+)
+
+// Handler exposes trip chat endpoints.
+type Handler struct{ svc *Service }
+
+// NewHandler wires a handler to the chat service.
+func NewHandler(svc *Service) *Handler { return &Handler{svc: svc} }
+
+// Routes returns the routes mounted at /trips/{id}/messages.
+func (h *Handler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+
+	r.Get("/", h.List)
+	r.Post("/", h.Send)
+
+	return r
+}
+
+func (h *Handler) Send(w http.ResponseWriter, r *http.Request) {
+	var req SendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	m, err := h.svc.Send(r.Context(), chi.URLParam(r, "id"), jwt.GetClaims(r.Context()).UserID, req.Body)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusCreated, m)
+}
+
+// List serves GET /trips/{id}/messages?since=<RFC 3339>.
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	var since time.Time
+	if raw := r.URL.Query().Get("since"); raw != "" {
+		t, err := time.Parse(time.RFC3339Nano, raw)
+		if err != nil {
+			apierror.Write(w, apierror.Validation("since must be an RFC 3339 time"))
+			return
+		}
+		since = t
+	}
+	msgs, err := h.svc.List(r.Context(), chi.URLParam(r, "id"), jwt.GetClaims(r.Context()), since)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]any{"messages": msgs})
+}
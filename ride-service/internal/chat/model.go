@@ -0,0 +1,46 @@
+package chat
+
+import "time"
+
+// MaxLength caps a message body, in characters.
+const MaxLength = 1000
+
+// Sender roles.
+const (
+	RoleRider  = "rider"
+	RoleDriver = "driver"
+)
+
+// Message is one chat message on a trip.
+type Message struct {
+	ID         string    `json:"id"`
+	TripID     string    `json:"trip_id"`
+	SenderID   string    `json:"sender_id"`
+	SenderRole string    `json:"sender_role"`
+	Body       string    `json:"body"`
+	SentAt     time.Time `json:"sent_at"`
+}
+
+// SendRequest is the body for POST /trips/{id}/messages.
+type SendRequest struct {
+	Body string `json:"body" validate:"required,maxLength=1000"`
+}
+
+// Notification is pushed to the trip's WebSocket subscribers.
+type Notification struct {
+	Type    string   `json:"type"` // chat.message
+	Message *Message `json:"message"`
+}
+
+// wsSend is a chat message sent over the trip's WebSocket:
+// {"type":"chat.send","body":"…"}.
+type wsSend struct {
+	Type string `json:"type"`
+	Body string `json:"body"`
+}
+
+// wsError answers a WebSocket chat.send that failed, to the sender only.
+type wsError struct {
+	Type  string `json:"type"` // chat.error
+	Error string `json:"error"`
+}
@@ -0,0 +1,205 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/internal/trips"
+	"ride-service/internal/trips/statemachine"
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+	"ride-service/pkg/logging"
+)
+
+var logger = logging.For("chat")
+
+var (
+	ErrTripNotFound   = apierror.NotFound("trip not found")
+	ErrNotParticipant = apierror.Forbidden("not a participant in this trip")
+	ErrClosed         = apierror.Conflict("chat is only open while a driver is assigned and the trip has not ended, or while a lost item report is open")
+	ErrInvalid        = apierror.Validation("invalid message")
+)
+
+// maxHistory caps the messages one List returns.
+const maxHistory = 500
+
+const columns = `id,trip_id,sender_id,sender_role,body,sent_at`
+
+// Notifier delivers chat messages to the trip's live subscribers (rider and
+// driver apps on /ws/trips/:id).
+type Notifier interface {
+	Notify(tripID string, msg any)
+}
+
+// TripReader returns trips; trips.TripRepo implements it.
+type TripReader interface {
+	GetByID(ctx context.Context, id string) (*trips.Trip, error)
+}
+
+// Service stores trip chat messages and relays them live.
+type Service struct {
+	db        *pgxpool.Pool
+	trips     TripReader
+	notify    Notifier
+	retention time.Duration
+}
+
+// NewService creates a chat service. Messages older than retention are
+// deleted by StartPurger.
+func NewService(db *pgxpool.Pool, t TripReader, n Notifier, retention time.Duration) *Service {
+	return &Service{db: db, trips: t, notify: n, retention: retention}
+}
+
+// open reports whether the trip's status allows chatting: from assignment
+// until the trip completes or is cancelled.
+func open(status string) bool {
+	return status == statemachine.DriverAssigned || status == statemachine.Started
+}
+
+// reopened reports whether a completed trip has a lost item report still
+// waiting on the driver or the return, which reopens chat until it closes.
+func (s *Service) reopened(ctx context.Context, tripID string) (bool, error) {
+	var ok bool
+	err := s.db.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM lost_items WHERE trip_id=$1 AND status IN ('reported','found'))`, tripID).Scan(&ok)
+	return ok, err
+}
+
+// participant returns the caller's role on the trip and the trip's status.
+func (s *Service) participant(ctx context.Context, tripID, userID string) (role, status string, err error) {
+	t, err := s.trips.GetByID(ctx, tripID)
+	if errors.Is(err, trips.ErrNotFound) {
+		return "", "", ErrTripNotFound
+	} else if err != nil {
+		return "", "", err
+	}
+	status = t.Status
+	switch {
+	case userID == t.RiderID:
+		return RoleRider, status, nil
+	case t.DriverID != nil && userID == *t.DriverID:
+		return RoleDriver, status, nil
+	}
+	return "", status, ErrNotParticipant
+}
+
+// Send stores a message from the trip's rider or assigned driver and pushes
+// it to everyone connected to the trip.
+func (s *Service) Send(ctx context.Context, tripID, userID, body string) (*Message, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return nil, fmt.Errorf("%w: body is required", ErrInvalid)
+	}
+	if utf8.RuneCountInString(body) > MaxLength {
+		return nil, fmt.Errorf("%w: at most %d characters", ErrInvalid, MaxLength)
+	}
+	role, status, err := s.participant(ctx, tripID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !open(status) {
+		if status != statemachine.Completed {
+			return nil, ErrClosed
+		}
+		if ok, err := s.reopened(ctx, tripID); err != nil {
+			return nil, err
+		} else if !ok {
+			return nil, ErrClosed
+		}
+	}
+	var m Message
+	err = s.db.QueryRow(ctx,
+		`INSERT INTO trip_messages (id,trip_id,sender_id,sender_role,body) VALUES ($1,$2,$3,$4,$5)
+		 RETURNING `+columns,
+		uuid.New().String(), tripID, userID, role, body).
+		Scan(&m.ID, &m.TripID, &m.SenderID, &m.SenderRole, &m.Body, &m.SentAt)
+	if err != nil {
+		return nil, err
+	}
+	s.notify.Notify(tripID, Notification{Type: "chat.message", Message: &m})
+	return &m, nil
+}
+
+// List returns the trip's messages, oldest first, optionally only those sent
+// after since. Participants and staff can read them, also after the trip.
+func (s *Service) List(ctx context.Context, tripID string, claims *jwt.Claims, since time.Time) ([]Message, error) {
+	if claims.Role != "admin" && claims.Role != "support" {
+		if _, _, err := s.participant(ctx, tripID, claims.UserID); err != nil {
+			return nil, err
+		}
+	} else if _, err := uuid.Parse(tripID); err != nil {
+		return nil, ErrTripNotFound
+	}
+	rows, err := s.db.Query(ctx,
+		`SELECT `+columns+` FROM trip_messages WHERE trip_id=$1 AND sent_at > $2
+		 ORDER BY sent_at, id LIMIT $3`, tripID, since, maxHistory)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	msgs := []Message{}
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.ID, &m.TripID, &m.SenderID, &m.SenderRole, &m.Body, &m.SentAt); err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, m)
+	}
+	return msgs, rows.Err()
+}
+
+// HandleWS is the hub's handler for client messages: {"type":"chat.send",
+// "body":"…"} is sent like POST /trips/{id}/messages. Other types are not
+// chat's and are ignored.
+func (s *Service) HandleWS(ctx context.Context, tripID string, claims *jwt.Claims, msg []byte) any {
+	var in wsSend
+	if err := json.Unmarshal(msg, &in); err != nil || in.Type != "chat.send" {
+		return nil
+	}
+	if claims == nil {
+		return wsError{Type: "chat.error", Error: "unauthorized"}
+	}
+	if _, err := s.Send(ctx, tripID, claims.UserID, in.Body); err != nil {
+		if !errors.Is(err, ErrInvalid) && !errors.Is(err, ErrClosed) &&
+			!errors.Is(err, ErrNotParticipant) && !errors.Is(err, ErrTripNotFound) {
+			logger.Error("chat send failed", "trip", tripID, "err", err)
+			err = errors.New("message not sent")
+		}
+		return wsError{Type: "chat.error", Error: err.Error()}
+	}
+	return nil // the sender receives its message with the broadcast
+}
+
+// StartPurger deletes messages past retention every interval until ctx is
+// cancelled.
+func (s *Service) StartPurger(ctx context.Context, every time.Duration) {
+	go func() {
+		t := time.NewTicker(every)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				tag, err := s.db.Exec(ctx, `DELETE FROM trip_messages WHERE sent_at < $1`, time.Now().Add(-s.retention))
+				if err != nil {
+					if ctx.Err() == nil {
+						logger.Error("purge chat messages failed", "err", err)
+					}
+					continue
+				}
+				if n := tag.RowsAffected(); n > 0 {
+					logger.Info("purged chat messages", "count", n)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,72 @@
+package contact
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+)
+
+// SecretHeader carries the provider's shared secret on POST /contact/resolve.
+const SecretHeader = "X-Contact-Secret"
+
+// Handler exposes masked contact to trip participants and the telephony
+// provider.
+type Handler struct {
+	svc    *Service
+	secret []byte
+}
+
+// NewHandler wires a handler to the contact service. secret authenticates
+// the provider; resolving is refused without one.
+func NewHandler(svc *Service, secret string) *Handler {
+	return &Handler{svc: svc, secret: []byte(secret)}
+}
+
+// TripRoutes returns the routes mounted at /trips/{id}/contact.
+func (h *Handler) TripRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+	r.Get("/", h.Token)
+	return r
+}
+
+// ProviderRoutes returns the routes mounted at /contact, called by the
+// telephony provider rather than the apps.
+func (h *Handler) ProviderRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Post("/resolve", h.Resolve)
+	return r
+}
+
+func (h *Handler) Token(w http.ResponseWriter, r *http.Request) {
+	c, err := h.svc.Token(r.Context(), chi.URLParam(r, "id"), jwt.GetClaims(r.Context()).UserID)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, c)
+}
+
+func (h *Handler) Resolve(w http.ResponseWriter, r *http.Request) {
+	got := []byte(r.Header.Get(SecretHeader))
+	if len(h.secret) == 0 || subtle.ConstantTimeCompare(got, h.secret) != 1 {
+		apierror.Write(w, apierror.Unauthorized("unauthorized"))
+		return
+	}
+	var req ResolveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || (req.Token == "") == (req.PIN == "") {
+		apierror.Write(w, apierror.Validation("send either token or pin"))
+		return
+	}
+	sess, err := h.svc.Resolve(r.Context(), req)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, sess)
+}
@@ -0,0 +1,27 @@
+package contact
+
+import "time"
+
+// Contact is the response for GET /trips/{id}/contact: how to reach the
+// other party without seeing their number. The app either dials Number and
+// enters PIN, or hands Token to a provider SDK.
+type Contact struct {
+	Token     string    `json:"token"`
+	Number    string    `json:"number"`
+	PIN       string    `json:"pin"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Session is what a token stands for.
+type Session struct {
+	TripID     string `json:"trip_id"`
+	CallerRole string `json:"caller_role"` // rider | driver
+	From       string `json:"from"`        // the caller's real number
+	To         string `json:"to"`          // the number to connect them to
+}
+
+// ResolveRequest is the body for POST /contact/resolve: a token or a PIN.
+type ResolveRequest struct {
+	Token string `json:"token" validate:"maxLength=64"`
+	PIN   string `json:"pin" validate:"maxLength=6"`
+}
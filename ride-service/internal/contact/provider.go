@@ -0,0 +1,21 @@
+package contact
+
+import "context"
+
+// Provider is the telephony integration that connects masked calls. Open is
+// called when a token is issued and returns the number the caller dials;
+// Close when the trip's sessions are dropped. A provider connects a call by
+// resolving the token or PIN the caller presents (POST /contact/resolve).
+type Provider interface {
+	Open(ctx context.Context, token string, s Session) (number string, err error)
+	Close(ctx context.Context, tripID string) error
+}
+
+// ProxyNumber is a Provider with one shared dial-in number: the provider's
+// IVR asks for the PIN and resolves it, so there is nothing to set up or
+// tear down per session.
+type ProxyNumber string
+
+func (p ProxyNumber) Open(context.Context, string, Session) (string, error) { return string(p), nil }
+
+func (p ProxyNumber) Close(context.Context, string) error { return nil }
@@ -0,0 +1,216 @@
+package contact
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/internal/events"
+	"ride-service/internal/trips"
+	"ride-service/internal/trips/statemachine"
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/eventbus"
+	"ride-service/pkg/logging"
+	"ride-service/pkg/pii"
+	rredis "ride-service/pkg/redis"
+)
+
+var logger = logging.For("contact")
+
+var (
+	ErrUnavailable    = apierror.New(http.StatusServiceUnavailable, apierror.CodeUnavailable, "masked calling is not configured")
+	ErrTripNotFound   = apierror.NotFound("trip not found")
+	ErrNotParticipant = apierror.Forbidden("not a participant in this trip")
+	ErrClosed         = apierror.Conflict("contact is only available while a driver is assigned and the trip has not ended")
+	ErrUnknown        = apierror.NotFound("unknown or expired contact token")
+)
+
+// pinAttempts bounds retries when a random PIN is already in use.
+const pinAttempts = 5
+
+// TripReader returns trips; trips.TripRepo implements it.
+type TripReader interface {
+	GetByID(ctx context.Context, id string) (*trips.Trip, error)
+}
+
+// Service issues masked contact tokens for trips and resolves them for the
+// telephony provider. Tokens live in Redis and are dropped when the trip
+// completes.
+type Service struct {
+	db       *pgxpool.Pool
+	trips    TripReader
+	redis    *rredis.Client
+	cipher   *pii.Cipher // phone numbers are stored encrypted
+	provider Provider    // nil: masked calling is off
+	ttl      time.Duration
+}
+
+// NewService creates a contact service. provider may be nil.
+func NewService(db *pgxpool.Pool, t TripReader, redis *rredis.Client, cipher *pii.Cipher, provider Provider, ttl time.Duration) *Service {
+	return &Service{db: db, trips: t, redis: redis, cipher: cipher, provider: provider, ttl: ttl}
+}
+
+// open reports whether the trip's status allows contact.
+func open(status string) bool {
+	return status == statemachine.DriverAssigned || status == statemachine.Started
+}
+
+// Token issues a token for the trip's rider or assigned driver to call the
+// other party.
+func (s *Service) Token(ctx context.Context, tripID, userID string) (*Contact, error) {
+	if s.provider == nil {
+		return nil, ErrUnavailable
+	}
+	t, err := s.trips.GetByID(ctx, tripID)
+	if errors.Is(err, trips.ErrNotFound) {
+		return nil, ErrTripNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	sess := Session{TripID: tripID}
+	switch {
+	case userID == t.RiderID:
+		sess.CallerRole = "rider"
+	case t.DriverID != nil && userID == *t.DriverID:
+		sess.CallerRole = "driver"
+	default:
+		return nil, ErrNotParticipant
+	}
+	if !open(t.Status) || t.DriverID == nil {
+		return nil, ErrClosed
+	}
+	riderPhone, err := s.phone(ctx, `SELECT phone FROM users WHERE id=$1`, t.RiderID)
+	if err != nil {
+		return nil, err
+	}
+	driverPhone, err := s.phone(ctx, `SELECT phone FROM drivers WHERE id=$1`, *t.DriverID)
+	if err != nil {
+		return nil, err
+	}
+	if sess.From, sess.To = riderPhone, driverPhone; sess.CallerRole == "driver" {
+		sess.From, sess.To = driverPhone, riderPhone
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+	number, err := s.provider.Open(ctx, token, sess)
+	if err != nil {
+		return nil, fmt.Errorf("contact: provider: %w", err)
+	}
+	value, err := json.Marshal(sess)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i < pinAttempts; i++ {
+		pin, err := newPIN()
+		if err != nil {
+			return nil, err
+		}
+		ok, err := s.redis.PutContact(ctx, tripID, token, pin, string(value), s.ttl)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return &Contact{Token: token, Number: number, PIN: pin, ExpiresAt: time.Now().Add(s.ttl).UTC()}, nil
+		}
+	}
+	return nil, errors.New("contact: no free PIN")
+}
+
+// phone reads and decrypts the phone number query returns for id.
+func (s *Service) phone(ctx context.Context, query, id string) (string, error) {
+	var sealed string
+	if err := s.db.QueryRow(ctx, query, id).Scan(&sealed); err != nil {
+		return "", err
+	}
+	return s.cipher.Decrypt(pii.Phone, sealed)
+}
+
+// Resolve returns the session for a token or PIN, for the provider to
+// connect the call. Sessions of a trip that has ended are dropped.
+func (s *Service) Resolve(ctx context.Context, req ResolveRequest) (*Session, error) {
+	var value string
+	var ok bool
+	var err error
+	switch {
+	case req.Token != "":
+		value, ok, err = s.redis.Contact(ctx, req.Token)
+	case req.PIN != "":
+		_, value, ok, err = s.redis.ContactByPIN(ctx, req.PIN)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrUnknown
+	}
+	var sess Session
+	if err := json.Unmarshal([]byte(value), &sess); err != nil {
+		return nil, ErrUnknown
+	}
+	// A trip can end without trip.completed (e.g. cancellation), so check.
+	t, err := s.trips.GetByID(ctx, sess.TripID)
+	if err != nil {
+		return nil, err
+	}
+	if !open(t.Status) {
+		if err := s.invalidate(ctx, sess.TripID); err != nil {
+			logger.Warn("drop contact sessions failed", "trip", sess.TripID, "err", err)
+		}
+		return nil, ErrUnknown
+	}
+	return &sess, nil
+}
+
+// Start drops a trip's contact sessions when it completes. Dropping is
+// idempotent, so failures are returned for the consumer to retry.
+func (s *Service) Start(ctx context.Context, bus eventbus.Bus) {
+	bus.Subscribe(ctx, eventbus.TopicTripCompleted, "contact-trip-completed", func(ctx context.Context, data []byte) error {
+		var ev events.TripCompletedEvent
+		env, err := events.Unwrap(data, &ev)
+		if errors.Is(err, events.ErrUnsupportedVersion) {
+			logger.Warn("skipping event", "event_id", env.EventID, "err", err)
+			return nil
+		} else if err != nil {
+			return err
+		}
+		return s.invalidate(ctx, ev.TripID)
+	})
+}
+
+func (s *Service) invalidate(ctx context.Context, tripID string) error {
+	if err := s.redis.DeleteTripContacts(ctx, tripID); err != nil {
+		return err
+	}
+	if s.provider != nil {
+		return s.provider.Close(ctx, tripID)
+	}
+	return nil
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// newPIN returns a random 6-digit PIN.
+func newPIN() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
@@ -0,0 +1,68 @@
+package deadletter
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+)
+
+// Handler exposes the admin DLQ endpoints.
+type Handler struct{ svc *Service }
+
+// NewHandler wires a handler to the dead-letter service.
+func NewHandler(svc *Service) *Handler { return &Handler{svc: svc} }
+
+// Routes returns a chi.Router for the /admin/dlq mount point.
+func (h *Handler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+	r.Use(jwt.RequireRole("admin"))
+
+	r.Get("/{topic}", h.List)
+	r.Post("/{topic}/replay", h.Replay)
+
+	return r
+}
+
+// ReplayRequest identifies a message in a DLQ topic.
+type ReplayRequest struct {
+	Partition int   `json:"partition"`
+	Offset    int64 `json:"offset"`
+}
+
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	limit := 50
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 500 {
+			apierror.Write(w, apierror.Validation("limit must be 1-500"))
+			return
+		}
+		limit = n
+	}
+	entries, err := h.svc.List(r.Context(), chi.URLParam(r, "topic"), limit)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]any{"messages": entries})
+}
+
+func (h *Handler) Replay(w http.ResponseWriter, r *http.Request) {
+	var req ReplayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	dl, err := h.svc.Replay(r.Context(), chi.URLParam(r, "topic"), req.Partition, req.Offset)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]any{"status": "replayed", "message": dl})
+}
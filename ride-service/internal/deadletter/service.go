@@ -0,0 +1,89 @@
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/eventbus"
+)
+
+var (
+	// ErrUnknownTopic is returned for topics that have no dead-letter queue.
+	ErrUnknownTopic = apierror.NotFound("no dead-letter queue for topic")
+	// ErrNoMessage is returned by Replay when the DLQ holds nothing at the
+	// given partition and offset.
+	ErrNoMessage = apierror.NotFound("no dead letter at that partition and offset")
+)
+
+// Entry is one dead-lettered message as shown to admins. DLQPartition and
+// DLQOffset locate it in the DLQ topic and are what Replay takes.
+type Entry struct {
+	DLQPartition int   `json:"dlq_partition"`
+	DLQOffset    int64 `json:"dlq_offset"`
+	eventbus.DeadLetter
+}
+
+// Service inspects and replays dead-letter queues.
+type Service struct {
+	bus    eventbus.Bus
+	topics map[string]bool
+}
+
+// NewService creates a service for the DLQs of the given source topics.
+func NewService(bus eventbus.Bus, topics ...string) *Service {
+	known := make(map[string]bool, len(topics))
+	for _, t := range topics {
+		known[t] = true
+	}
+	return &Service{bus: bus, topics: known}
+}
+
+// List returns up to limit recent dead letters per partition for topic.
+func (s *Service) List(ctx context.Context, topic string, limit int) ([]Entry, error) {
+	if !s.topics[topic] {
+		return nil, ErrUnknownTopic
+	}
+	recs, err := s.bus.Tail(ctx, eventbus.DLQTopic(topic), limit)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Entry, 0, len(recs))
+	for _, r := range recs {
+		e := Entry{DLQPartition: r.Partition, DLQOffset: r.Offset}
+		if err := json.Unmarshal(r.Value, &e.DeadLetter); err != nil {
+			e.DeadLetter.Error = "undecodable dead letter: " + err.Error()
+		}
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+// Replay republishes the original message stored at partition/offset of the
+// topic's DLQ back onto the source topic. The dead letter itself is left in
+// place; topics are append-only.
+func (s *Service) Replay(ctx context.Context, topic string, partition int, offset int64) (*eventbus.DeadLetter, error) {
+	if !s.topics[topic] {
+		return nil, ErrUnknownTopic
+	}
+	rec, err := s.bus.ReadAt(ctx, eventbus.DLQTopic(topic), partition, offset)
+	if errors.Is(err, eventbus.ErrNoRecord) {
+		return nil, ErrNoMessage
+	}
+	if err != nil {
+		return nil, err
+	}
+	var dl eventbus.DeadLetter
+	if err := json.Unmarshal(rec.Value, &dl); err != nil {
+		return nil, err
+	}
+	value, err := dl.OriginalValue()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.bus.PublishRaw(ctx, dl.Topic, dl.Key, value); err != nil {
+		return nil, err
+	}
+	return &dl, nil
+}
@@ -0,0 +1,107 @@
+package disputes
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+)
+
+// Handler exposes fare disputes to riders and staff.
+type Handler struct{ svc *Service }
+
+// NewHandler wires a handler to the dispute service.
+func NewHandler(svc *Service) *Handler { return &Handler{svc: svc} }
+
+// TripRoutes returns the routes mounted at /trips/{id}/dispute.
+func (h *Handler) TripRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+
+	r.Get("/", h.ForTrip)
+	r.Post("/", h.File)
+
+	return r
+}
+
+// AdminRoutes returns the routes mounted under /admin/disputes. Support
+// agents see the queue; only admins change fares.
+func (h *Handler) AdminRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth, jwt.RequireRole("admin", "support"))
+
+	r.Get("/", h.List)
+	r.Get("/{id}", h.Get)
+	r.With(jwt.RequireRole("admin")).Post("/{id}/resolve", h.Resolve)
+
+	return r
+}
+
+func (h *Handler) File(w http.ResponseWriter, r *http.Request) {
+	var req DisputeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	d, err := h.svc.File(r.Context(), chi.URLParam(r, "id"), jwt.GetClaims(r.Context()).UserID, req)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusCreated, d)
+}
+
+func (h *Handler) ForTrip(w http.ResponseWriter, r *http.Request) {
+	d, err := h.svc.ForTrip(r.Context(), chi.URLParam(r, "id"), jwt.GetClaims(r.Context()))
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, d)
+}
+
+// List serves GET /admin/disputes?status=&limit=&offset=.
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := 50
+	if v, err := strconv.Atoi(q.Get("limit")); err == nil && v > 0 && v <= 200 {
+		limit = v
+	}
+	offset := 0
+	if v, err := strconv.Atoi(q.Get("offset")); err == nil && v > 0 {
+		offset = v
+	}
+	page, err := h.svc.List(r.Context(), q.Get("status"), limit, offset)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, page)
+}
+
+func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
+	d, err := h.svc.Get(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, d)
+}
+
+func (h *Handler) Resolve(w http.ResponseWriter, r *http.Request) {
+	var req ResolveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	d, err := h.svc.Resolve(r.Context(), chi.URLParam(r, "id"), jwt.GetClaims(r.Context()).UserID, req)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, d)
+}
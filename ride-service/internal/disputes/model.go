@@ -0,0 +1,73 @@
+package disputes
+
+import (
+	"time"
+
+	"ride-service/pkg/money"
+)
+
+// MaxComment caps a rider's comment and a resolution note, in characters.
+const MaxComment = 1000
+
+// Reasons a rider can dispute a fare for.
+const (
+	ReasonLongRoute      = "long_route"      // the driver took a longer route than needed
+	ReasonWrongSurcharge = "wrong_surcharge" // charged for extras or waiting that did not happen
+	ReasonFareTooHigh    = "fare_too_high"   // more than the estimate or a usual trip
+	ReasonTripNotTaken   = "trip_not_taken"  // the rider never took the trip
+	ReasonOther          = "other"
+)
+
+// Reasons lists every reason code.
+var Reasons = []string{ReasonLongRoute, ReasonWrongSurcharge, ReasonFareTooHigh, ReasonTripNotTaken, ReasonOther}
+
+// Dispute statuses. open → adjusted | rejected.
+const (
+	StatusOpen     = "open"
+	StatusAdjusted = "adjusted"
+	StatusRejected = "rejected"
+)
+
+// Statuses lists every status.
+var Statuses = []string{StatusOpen, StatusAdjusted, StatusRejected}
+
+// Dispute is a rider's dispute of a completed trip's fare.
+type Dispute struct {
+	ID       string      `json:"id"`
+	TripID   string      `json:"trip_id"`
+	RiderID  string      `json:"rider_id"`
+	DriverID string      `json:"driver_id"`
+	Reason   string      `json:"reason"`
+	Comment  string      `json:"comment,omitempty"`
+	Status   string      `json:"status"`
+	Fare     money.Money `json:"fare"` // when the dispute was filed
+	// AdjustedFare is the fare staff settled on, once adjusted.
+	AdjustedFare *money.Money `json:"adjusted_fare,omitempty"`
+	Resolution   *string      `json:"resolution,omitempty"` // staff note to the rider
+	ResolvedBy   *string      `json:"resolved_by,omitempty"`
+	CreatedAt    time.Time    `json:"created_at"`
+	ResolvedAt   *time.Time   `json:"resolved_at,omitempty"`
+}
+
+// DisputeRequest is the body for POST /trips/{id}/dispute.
+type DisputeRequest struct {
+	Reason  string `json:"reason" validate:"required,maxLength=30"` // one of Reasons
+	Comment string `json:"comment" validate:"maxLength=1000"`
+}
+
+// ResolveRequest is the body for POST /admin/disputes/{id}/resolve. Fare is
+// the adjusted fare, a decimal in the major unit of the trip's currency;
+// leaving it empty rejects the dispute and the fare stands.
+type ResolveRequest struct {
+	Fare string `json:"fare" validate:"maxLength=20"`
+	Note string `json:"note" validate:"required,maxLength=1000"`
+}
+
+// Page is a page of GET /admin/disputes, oldest first so the queue is
+// worked in order.
+type Page struct {
+	Disputes []Dispute `json:"disputes"`
+	Total    int       `json:"total"`
+	Limit    int       `json:"limit"`
+	Offset   int       `json:"offset"`
+}
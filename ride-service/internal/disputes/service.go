@@ -0,0 +1,285 @@
+package disputes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/internal/events"
+	"ride-service/internal/trips"
+	"ride-service/internal/trips/statemachine"
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/db"
+	"ride-service/pkg/eventbus"
+	"ride-service/pkg/jwt"
+	"ride-service/pkg/logging"
+	"ride-service/pkg/money"
+)
+
+var logger = logging.For("disputes")
+
+var (
+	ErrTripNotFound   = apierror.NotFound("trip not found")
+	ErrNotFound       = apierror.NotFound("dispute not found")
+	ErrNotParticipant = apierror.Forbidden("not a participant in this trip")
+	ErrForbidden      = apierror.Forbidden("only the trip's rider can dispute its fare")
+	ErrClosed         = apierror.Conflict("fares can only be disputed on a completed trip within the dispute window")
+	ErrAlreadyFiled   = apierror.Conflict("trip's fare is already disputed").WithCode("already_disputed")
+	ErrResolved       = apierror.Conflict("dispute is already resolved").WithCode("dispute_resolved")
+	ErrInvalid        = apierror.Validation("invalid dispute")
+)
+
+const columns = `id,trip_id,rider_id,driver_id,reason,comment,status,fare_minor,adjusted_fare_minor,currency,
+		resolution,resolved_by,created_at,resolved_at`
+
+// Service runs fare disputes: riders dispute a completed trip's fare, and
+// staff resolve each by adjusting the fare or rejecting it. An adjustment
+// publishes fare.adjusted, from which payments charges or refunds the
+// difference, invoices revise the receipt and reports correct revenue.
+type Service struct {
+	db         *pgxpool.Pool
+	trips      Trips
+	bus        eventbus.Bus
+	window     time.Duration
+	onAdjusted func(ctx context.Context, tripID string)
+}
+
+// Trips reads trips and adjusts their fares; trips.TripRepo implements it.
+type Trips interface {
+	GetByID(ctx context.Context, id string) (*trips.Trip, error)
+	AdjustFare(ctx context.Context, tripID string, version int, fn func(t *trips.Trip) (money.Money, error)) (*trips.Trip, error)
+}
+
+// NewService creates a dispute service. Riders can dispute a fare up to
+// window after their trip completed.
+func NewService(db *pgxpool.Pool, t Trips, bus eventbus.Bus, window time.Duration) *Service {
+	return &Service{db: db, trips: t, bus: bus, window: window}
+}
+
+// trip returns tripID, reporting a missing one as ErrTripNotFound.
+func (s *Service) trip(ctx context.Context, tripID string) (*trips.Trip, error) {
+	t, err := s.trips.GetByID(ctx, tripID)
+	if errors.Is(err, trips.ErrNotFound) {
+		return nil, ErrTripNotFound
+	}
+	return t, err
+}
+
+// OnAdjusted sets the function told when a trip's fare changed, e.g. to
+// drop cached copies of the trip. Call it before serving.
+func (s *Service) OnAdjusted(fn func(ctx context.Context, tripID string)) { s.onAdjusted = fn }
+
+// File disputes the fare of the rider's completed trip. A trip takes one
+// dispute.
+func (s *Service) File(ctx context.Context, tripID, userID string, req DisputeRequest) (*Dispute, error) {
+	comment := strings.TrimSpace(req.Comment)
+	if !slices.Contains(Reasons, req.Reason) {
+		return nil, fmt.Errorf("%w: reason must be one of %s", ErrInvalid, strings.Join(Reasons, ", "))
+	}
+	if utf8.RuneCountInString(comment) > MaxComment {
+		return nil, fmt.Errorf("%w: comment is at most %d characters", ErrInvalid, MaxComment)
+	}
+	t, err := s.trip(ctx, tripID)
+	if err != nil {
+		return nil, err
+	}
+	if userID != t.RiderID {
+		if t.DriverID != nil && userID == *t.DriverID {
+			return nil, ErrForbidden
+		}
+		return nil, ErrNotParticipant
+	}
+	if t.Status != statemachine.Completed || t.DriverID == nil || t.Fare == nil ||
+		t.CompletedAt == nil || time.Since(*t.CompletedAt) > s.window {
+		return nil, ErrClosed
+	}
+	d, err := scanDispute(s.db.QueryRow(ctx,
+		`INSERT INTO fare_disputes (id,trip_id,rider_id,driver_id,reason,comment,fare_minor,currency)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7,$8) ON CONFLICT (trip_id) DO NOTHING RETURNING `+columns,
+		uuid.New().String(), tripID, t.RiderID, *t.DriverID, req.Reason, comment, t.Fare.Amount, t.Fare.Currency))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrAlreadyFiled
+	}
+	return d, err
+}
+
+// ForTrip returns a trip's dispute to its rider, its driver or staff.
+func (s *Service) ForTrip(ctx context.Context, tripID string, claims *jwt.Claims) (*Dispute, error) {
+	t, err := s.trip(ctx, tripID)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Role != "admin" && claims.Role != "support" &&
+		claims.UserID != t.RiderID && (t.DriverID == nil || claims.UserID != *t.DriverID) {
+		return nil, ErrNotParticipant
+	}
+	d, err := scanDispute(s.db.QueryRow(ctx, `SELECT `+columns+` FROM fare_disputes WHERE trip_id=$1`, tripID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return d, err
+}
+
+// Get returns one dispute, for staff.
+func (s *Service) Get(ctx context.Context, id string) (*Dispute, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+	d, err := scanDispute(s.db.QueryRow(ctx, `SELECT `+columns+` FROM fare_disputes WHERE id=$1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return d, err
+}
+
+// List returns one page of disputes in status (every status if empty),
+// oldest first.
+func (s *Service) List(ctx context.Context, status string, limit, offset int) (*Page, error) {
+	if status != "" && !slices.Contains(Statuses, status) {
+		return nil, fmt.Errorf("%w: status must be one of %s", ErrInvalid, strings.Join(Statuses, ", "))
+	}
+	p := &Page{Disputes: []Dispute{}, Limit: limit, Offset: offset}
+	if err := s.db.QueryRow(ctx,
+		`SELECT COUNT(*) FROM fare_disputes WHERE ($1='' OR status=$1)`, status).Scan(&p.Total); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(ctx,
+		`SELECT `+columns+` FROM fare_disputes WHERE ($1='' OR status=$1)
+		 ORDER BY created_at, id LIMIT $2 OFFSET $3`, status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		d, err := scanDispute(rows)
+		if err != nil {
+			return nil, err
+		}
+		p.Disputes = append(p.Disputes, *d)
+	}
+	return p, rows.Err()
+}
+
+// Resolve closes an open dispute for staff. With a fare, the trip's fare
+// becomes that amount through the trip repository, which recomputes its
+// commission at the rate it was priced with and bumps its version, and
+// fare.adjusted is published; without one the dispute is rejected and the
+// fare stands. The trip is locked throughout, so the fare cannot change
+// under it.
+func (s *Service) Resolve(ctx context.Context, id, staffID string, req ResolveRequest) (*Dispute, error) {
+	note := strings.TrimSpace(req.Note)
+	switch {
+	case note == "":
+		return nil, fmt.Errorf("%w: note is required", ErrInvalid)
+	case utf8.RuneCountInString(note) > MaxComment:
+		return nil, fmt.Errorf("%w: note is at most %d characters", ErrInvalid, MaxComment)
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+	var d *Dispute
+	var oldFare money.Money
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		cur, err := scanDispute(tx.QueryRow(ctx, `SELECT `+columns+` FROM fare_disputes WHERE id=$1 FOR UPDATE`, id))
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		} else if err != nil {
+			return err
+		}
+		if cur.Status != StatusOpen {
+			return ErrResolved
+		}
+		if strings.TrimSpace(req.Fare) == "" {
+			d, err = scanDispute(tx.QueryRow(ctx,
+				`UPDATE fare_disputes SET status=$2, resolution=$3, resolved_by=$4, resolved_at=NOW()
+				 WHERE id=$1 RETURNING `+columns, id, StatusRejected, note, staffID))
+			return err
+		}
+
+		// Staff resolve against whatever the trip is now, not a version
+		// they read.
+		t, err := s.trips.AdjustFare(db.Within(ctx, tx), cur.TripID, trips.AnyVersion, func(t *trips.Trip) (money.Money, error) {
+			if t.Fare == nil {
+				return money.Money{}, fmt.Errorf("%w: trip has no fare", ErrInvalid)
+			}
+			oldFare = *t.Fare
+			fare, err := money.Parse(req.Fare, oldFare.Currency)
+			if err != nil {
+				return money.Money{}, fmt.Errorf("%w: fare: %v", ErrInvalid, err)
+			}
+			if fare.Amount < 0 {
+				return money.Money{}, fmt.Errorf("%w: fare must not be negative", ErrInvalid)
+			}
+			if fare.Amount == oldFare.Amount {
+				return money.Money{}, fmt.Errorf("%w: fare is unchanged; leave it empty to reject the dispute", ErrInvalid)
+			}
+			return fare, nil
+		})
+		if err != nil {
+			return err
+		}
+		d, err = scanDispute(tx.QueryRow(ctx,
+			`UPDATE fare_disputes SET status=$2, adjusted_fare_minor=$3, resolution=$4, resolved_by=$5, resolved_at=NOW()
+			 WHERE id=$1 RETURNING `+columns, id, StatusAdjusted, t.Fare.Amount, note, staffID))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if d.Status == StatusAdjusted {
+		if s.onAdjusted != nil {
+			s.onAdjusted(ctx, d.TripID)
+		}
+		s.publishAdjusted(d, oldFare)
+	}
+	return d, nil
+}
+
+// publishAdjusted asynchronously publishes fare.adjusted for d, adjusted
+// from oldFare.
+func (s *Service) publishAdjusted(d *Dispute, oldFare money.Money) {
+	ev := events.FareAdjustedEvent{
+		TripID:       d.TripID,
+		DisputeID:    d.ID,
+		RiderID:      d.RiderID,
+		DriverID:     d.DriverID,
+		OldFareMinor: oldFare.Amount,
+		NewFareMinor: d.AdjustedFare.Amount,
+		Currency:     oldFare.Currency,
+		Reason:       d.Reason,
+		AdjustedAt:   d.ResolvedAt.Format(time.RFC3339),
+	}
+	go func() {
+		env, err := events.Wrap(ev)
+		if err == nil {
+			err = s.bus.Publish(context.Background(), eventbus.TopicFareAdjusted, ev.TripID, env)
+		}
+		if err != nil {
+			logger.Error("publish fare.adjusted failed", "trip", ev.TripID, "err", err)
+		}
+	}()
+}
+
+func scanDispute(row pgx.Row) (*Dispute, error) {
+	var d Dispute
+	var adjusted *int64
+	var currency string
+	if err := row.Scan(&d.ID, &d.TripID, &d.RiderID, &d.DriverID, &d.Reason, &d.Comment, &d.Status,
+		&d.Fare.Amount, &adjusted, &currency, &d.Resolution, &d.ResolvedBy, &d.CreatedAt, &d.ResolvedAt); err != nil {
+		return nil, err
+	}
+	d.Fare.Currency = currency
+	if adjusted != nil {
+		m := money.New(*adjusted, currency)
+		d.AdjustedFare = &m
+	}
+	return &d, nil
+}
@@ -0,0 +1,171 @@
+package documents
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+)
+
+// Handler exposes driver document uploads and the admin review queue.
+type Handler struct{ svc *Service }
+
+// NewHandler wires a handler to the document service.
+func NewHandler(svc *Service) *Handler { return &Handler{svc: svc} }
+
+// DriverRoutes returns the routes mounted at /drivers/{id}/documents. Drivers
+// manage their own documents; admin and support can read them.
+func (h *Handler) DriverRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+
+	r.Get("/", h.Verification)
+	r.Post("/{kind}", h.Upload)
+	r.Get("/{docID}/file", h.DriverFile)
+
+	return r
+}
+
+// AdminRoutes returns the review queue, mounted at /admin/documents.
+func (h *Handler) AdminRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+	r.Use(jwt.RequireRole("admin"))
+
+	r.Get("/", h.Queue)
+	r.Get("/{docID}/file", h.AdminFile)
+	r.Post("/{docID}/approve", h.Approve)
+	r.Post("/{docID}/reject", h.Reject)
+
+	return r
+}
+
+// Upload accepts the raw file (PDF, JPEG or PNG) as the request body.
+func (h *Handler) Upload(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !isSelf(r, id) {
+		apierror.Write(w, apierror.Forbidden("forbidden"))
+		return
+	}
+	body := http.MaxBytesReader(w, r.Body, MaxDocumentBytes)
+	d, err := h.svc.Upload(r.Context(), id, chi.URLParam(r, "kind"), body)
+	if err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			apierror.Write(w, apierror.New(http.StatusRequestEntityTooLarge, apierror.CodeTooLarge, "document too large"))
+			return
+		}
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusCreated, d)
+}
+
+func (h *Handler) Verification(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !isSelf(r, id) && !isStaff(r) {
+		apierror.Write(w, apierror.Forbidden("forbidden"))
+		return
+	}
+	v, err := h.svc.Verification(r.Context(), id)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, v)
+}
+
+func (h *Handler) DriverFile(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !isSelf(r, id) && !isStaff(r) {
+		apierror.Write(w, apierror.Forbidden("forbidden"))
+		return
+	}
+	h.serveFile(w, r, id)
+}
+
+func (h *Handler) AdminFile(w http.ResponseWriter, r *http.Request) {
+	h.serveFile(w, r, "")
+}
+
+// serveFile streams a document, checking it belongs to driverID when set.
+func (h *Handler) serveFile(w http.ResponseWriter, r *http.Request, driverID string) {
+	rc, d, err := h.svc.Open(r.Context(), chi.URLParam(r, "docID"))
+	if err == nil && driverID != "" && d.DriverID != driverID {
+		rc.Close()
+		err = ErrNotFound
+	}
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	defer rc.Close()
+	w.Header().Set("Content-Type", mime.TypeByExtension(path.Ext(d.BlobKey)))
+	w.Header().Set("Cache-Control", "private, no-store")
+	if _, err := io.Copy(w, rc); err != nil {
+		log.Printf("[documents] file stream error: %v", err)
+	}
+}
+
+// Queue serves GET /admin/documents?limit=&offset=, oldest pending first.
+func (h *Handler) Queue(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := 20
+	if v, err := strconv.Atoi(q.Get("limit")); err == nil && v > 0 && v <= 100 {
+		limit = v
+	}
+	offset := 0
+	if v, err := strconv.Atoi(q.Get("offset")); err == nil && v > 0 {
+		offset = v
+	}
+	docs, err := h.svc.Queue(r.Context(), limit, offset)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]any{"documents": docs})
+}
+
+func (h *Handler) Approve(w http.ResponseWriter, r *http.Request) {
+	claims := jwt.GetClaims(r.Context())
+	d, err := h.svc.Approve(r.Context(), chi.URLParam(r, "docID"), claims.UserID)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, d)
+}
+
+func (h *Handler) Reject(w http.ResponseWriter, r *http.Request) {
+	var req RejectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	claims := jwt.GetClaims(r.Context())
+	d, err := h.svc.Reject(r.Context(), chi.URLParam(r, "docID"), claims.UserID, req.Reason)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, d)
+}
+
+func isSelf(r *http.Request, id string) bool {
+	claims := jwt.GetClaims(r.Context())
+	return claims != nil && claims.UserID == id
+}
+
+func isStaff(r *http.Request) bool {
+	claims := jwt.GetClaims(r.Context())
+	return claims != nil && (claims.Role == "admin" || claims.Role == "support")
+}
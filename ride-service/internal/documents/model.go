@@ -0,0 +1,51 @@
+package documents
+
+import "time"
+
+// Document kinds a driver must have approved before taking trips.
+const (
+	KindLicense      = "license"
+	KindRegistration = "registration"
+	KindInsurance    = "insurance"
+)
+
+// Kinds lists every required document kind.
+var Kinds = []string{KindLicense, KindRegistration, KindInsurance}
+
+// Review states. An upload supersedes the driver's earlier pending document
+// of the same kind so the review queue only shows the latest.
+const (
+	StatusPending    = "pending"
+	StatusApproved   = "approved"
+	StatusRejected   = "rejected"
+	StatusSuperseded = "superseded"
+)
+
+// Document is one uploaded file and its review outcome.
+type Document struct {
+	ID           string     `json:"id"`
+	DriverID     string     `json:"driver_id"`
+	Kind         string     `json:"kind"`
+	Status       string     `json:"status"`
+	ContentType  string     `json:"content_type"`
+	SizeBytes    int64      `json:"size_bytes"`
+	RejectReason string     `json:"reject_reason,omitempty"`
+	ReviewedBy   *string    `json:"reviewed_by,omitempty"`
+	UploadedAt   time.Time  `json:"uploaded_at"`
+	ReviewedAt   *time.Time `json:"reviewed_at,omitempty"`
+	BlobKey      string     `json:"-"`
+}
+
+// Verification summarises a driver's documents.
+type Verification struct {
+	DriverID   string     `json:"driver_id"`
+	Verified   bool       `json:"verified"`
+	VerifiedAt *time.Time `json:"verified_at,omitempty"`
+	Missing    []string   `json:"missing"` // kinds without an approved document
+	Documents  []Document `json:"documents"`
+}
+
+// RejectRequest is the body for POST /admin/documents/:id/reject.
+type RejectRequest struct {
+	Reason string `json:"reason"`
+}
@@ -0,0 +1,275 @@
+package documents
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/blob"
+	"ride-service/pkg/db"
+	"ride-service/pkg/logging"
+)
+
+var logger = logging.For("documents")
+
+var (
+	ErrDriverNotFound = apierror.NotFound("driver not found")
+	ErrNotFound       = apierror.NotFound("document not found")
+	ErrNotPending     = apierror.Conflict("document has already been reviewed")
+	ErrUnsupported    = apierror.New(http.StatusUnsupportedMediaType, apierror.CodeUnsupportedMediaType, "document must be pdf, jpeg or png")
+	ErrInvalid        = apierror.Validation("invalid request")
+)
+
+// MaxDocumentBytes caps a single upload.
+const MaxDocumentBytes = 10 << 20
+
+var fileExt = map[string]string{
+	"application/pdf": ".pdf",
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+}
+
+// Service stores driver documents and runs the review workflow.
+type Service struct {
+	db         *pgxpool.Pool
+	blobs      blob.Store
+	onVerified func(ctx context.Context, driverID string)
+}
+
+// NewService creates a document service.
+func NewService(db *pgxpool.Pool, blobs blob.Store) *Service {
+	return &Service{db: db, blobs: blobs}
+}
+
+// OnVerified sets the function told when an approval may have verified a
+// driver, e.g. to drop cached copies of them. Call it before serving.
+func (s *Service) OnVerified(fn func(ctx context.Context, driverID string)) { s.onVerified = fn }
+
+const columns = `id,driver_id,kind,status,content_type,size_bytes,COALESCE(reject_reason,''),
+		        reviewed_by,uploaded_at,reviewed_at,blob_key`
+
+// Upload stores a new document for review. The file type is sniffed from the
+// content, not trusted from the client.
+func (s *Service) Upload(ctx context.Context, driverID, kind string, r io.Reader) (*Document, error) {
+	if !slices.Contains(Kinds, kind) {
+		return nil, fmt.Errorf("%w: kind must be one of %s", ErrInvalid, strings.Join(Kinds, ", "))
+	}
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, ErrUnsupported
+	}
+	contentType := http.DetectContentType(head[:n])
+	ext, ok := fileExt[contentType]
+	if !ok {
+		return nil, ErrUnsupported
+	}
+
+	d := &Document{ID: uuid.New().String(), DriverID: driverID, Kind: kind, Status: StatusPending, ContentType: contentType}
+	d.BlobKey = "documents/" + driverID + "/" + d.ID + ext
+	counted := &countingReader{r: io.MultiReader(bytes.NewReader(head[:n]), r)}
+	if err := s.blobs.Put(ctx, d.BlobKey, counted); err != nil {
+		return nil, err
+	}
+	d.SizeBytes = counted.n
+
+	err = db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx,
+			`UPDATE driver_documents SET status=$1 WHERE driver_id=$2 AND kind=$3 AND status=$4`,
+			StatusSuperseded, driverID, kind, StatusPending); err != nil {
+			return err
+		}
+		return tx.QueryRow(ctx,
+			`INSERT INTO driver_documents (id,driver_id,kind,status,blob_key,content_type,size_bytes)
+			 VALUES ($1,$2,$3,$4,$5,$6,$7) RETURNING uploaded_at`,
+			d.ID, driverID, kind, d.Status, d.BlobKey, d.ContentType, d.SizeBytes).Scan(&d.UploadedAt)
+	})
+	if err != nil {
+		_ = s.blobs.Delete(ctx, d.BlobKey)
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && (pgErr.Code == "23503" || pgErr.Code == "22P02") { // FK violation / malformed uuid
+			return nil, ErrDriverNotFound
+		}
+		return nil, err
+	}
+	logger.Info("document uploaded", "driver", driverID, "document", d.ID, "kind", kind, "bytes", d.SizeBytes)
+	return d, nil
+}
+
+// Verification lists a driver's documents, newest first, and what is missing.
+func (s *Service) Verification(ctx context.Context, driverID string) (*Verification, error) {
+	v := &Verification{DriverID: driverID, Missing: []string{}}
+	err := s.db.QueryRow(ctx, `SELECT verified_at FROM drivers WHERE id=$1`, driverID).Scan(&v.VerifiedAt)
+	var pgErr *pgconn.PgError
+	if errors.Is(err, pgx.ErrNoRows) || errors.As(err, &pgErr) && pgErr.Code == "22P02" {
+		return nil, ErrDriverNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	v.Verified = v.VerifiedAt != nil
+
+	v.Documents, err = s.list(ctx,
+		`SELECT `+columns+` FROM driver_documents WHERE driver_id=$1 ORDER BY uploaded_at DESC`, driverID)
+	if err != nil {
+		return nil, err
+	}
+	for _, kind := range Kinds {
+		if !slices.ContainsFunc(v.Documents, func(d Document) bool { return d.Kind == kind && d.Status == StatusApproved }) {
+			v.Missing = append(v.Missing, kind)
+		}
+	}
+	return v, nil
+}
+
+// Queue returns documents awaiting review, oldest first.
+func (s *Service) Queue(ctx context.Context, limit, offset int) ([]Document, error) {
+	return s.list(ctx,
+		`SELECT `+columns+` FROM driver_documents WHERE status=$1 ORDER BY uploaded_at LIMIT $2 OFFSET $3`,
+		StatusPending, limit, offset)
+}
+
+// Get fetches one document.
+func (s *Service) Get(ctx context.Context, id string) (*Document, error) {
+	return scanDocument(s.db.QueryRow(ctx, `SELECT `+columns+` FROM driver_documents WHERE id=$1`, id))
+}
+
+// Open returns the document's file. The caller must close the reader.
+func (s *Service) Open(ctx context.Context, id string) (io.ReadCloser, *Document, error) {
+	d, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	rc, err := s.blobs.Get(ctx, d.BlobKey)
+	if errors.Is(err, blob.ErrNotFound) {
+		return nil, nil, fmt.Errorf("%w: its file is missing", ErrNotFound)
+	}
+	return rc, d, err
+}
+
+// Approve accepts a pending document. Approving the last missing kind marks
+// the driver verified.
+func (s *Service) Approve(ctx context.Context, id, adminID string) (*Document, error) {
+	d, err := s.review(ctx, id, adminID, StatusApproved, "")
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("document approved", "document", id, "driver", d.DriverID, "kind", d.Kind, "admin", adminID)
+	return d, nil
+}
+
+// Reject declines a pending document; the driver uploads a new one.
+func (s *Service) Reject(ctx context.Context, id, adminID, reason string) (*Document, error) {
+	reason = strings.TrimSpace(reason)
+	switch {
+	case reason == "":
+		return nil, fmt.Errorf("%w: reason is required", ErrInvalid)
+	case len(reason) > 500:
+		return nil, fmt.Errorf("%w: reason exceeds 500 characters", ErrInvalid)
+	}
+	d, err := s.review(ctx, id, adminID, StatusRejected, reason)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("document rejected", "document", id, "driver", d.DriverID, "kind", d.Kind, "admin", adminID)
+	return d, nil
+}
+
+func (s *Service) review(ctx context.Context, id, adminID, status, reason string) (*Document, error) {
+	var d *Document
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		var err error
+		d, err = scanDocument(tx.QueryRow(ctx, `SELECT `+columns+` FROM driver_documents WHERE id=$1 FOR UPDATE`, id))
+		if err != nil {
+			return err
+		}
+		if d.Status != StatusPending {
+			return ErrNotPending
+		}
+		d, err = scanDocument(tx.QueryRow(ctx,
+			`UPDATE driver_documents SET status=$1, reject_reason=NULLIF($2,''), reviewed_by=$3, reviewed_at=NOW()
+			 WHERE id=$4 RETURNING `+columns,
+			status, reason, adminID, id))
+		if err != nil || status != StatusApproved {
+			return err
+		}
+
+		// Serialise approvals per driver so two reviewers finishing the last
+		// kinds at once still see each other's approval.
+		if _, err := tx.Exec(ctx, `SELECT 1 FROM drivers WHERE id=$1 FOR UPDATE`, d.DriverID); err != nil {
+			return err
+		}
+		tag, err := tx.Exec(ctx,
+			`UPDATE drivers SET verified_at=NOW()
+			 WHERE id=$1 AND verified_at IS NULL
+			   AND (SELECT COUNT(DISTINCT kind) FROM driver_documents
+			        WHERE driver_id=$1 AND status=$2 AND kind = ANY($3)) = $4`,
+			d.DriverID, StatusApproved, Kinds, len(Kinds))
+		if err == nil && tag.RowsAffected() > 0 {
+			logger.Info("driver verified", "driver", d.DriverID)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if status == StatusApproved && s.onVerified != nil {
+		s.onVerified(ctx, d.DriverID)
+	}
+	return d, nil
+}
+
+func (s *Service) list(ctx context.Context, query string, args ...any) ([]Document, error) {
+	rows, err := s.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Document{}
+	for rows.Next() {
+		d, err := scanDocument(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *d)
+	}
+	return out, rows.Err()
+}
+
+func scanDocument(row pgx.Row) (*Document, error) {
+	var d Document
+	err := row.Scan(&d.ID, &d.DriverID, &d.Kind, &d.Status, &d.ContentType, &d.SizeBytes, &d.RejectReason,
+		&d.ReviewedBy, &d.UploadedAt, &d.ReviewedAt, &d.BlobKey)
+	var pgErr *pgconn.PgError
+	if errors.Is(err, pgx.ErrNoRows) || errors.As(err, &pgErr) && pgErr.Code == "22P02" { // malformed uuid
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// countingReader records how many bytes were read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,110 @@
+package drivers
+
+import (
+	"context"
+
+	"ride-service/pkg/cache"
+	"ride-service/pkg/config"
+	"ride-service/pkg/db"
+)
+
+// CachedRepo is a DriverRepo that serves GetByID through a two-tier cache
+// and invalidates the driver on every write to their account or vehicles.
+type CachedRepo struct {
+	DriverRepo
+	drivers *cache.Cache[cachedDriver]
+}
+
+// cachedDriver keeps what Driver leaves out of its JSON.
+type cachedDriver struct {
+	Driver
+	PhotoKey string `json:"photo_key"`
+}
+
+// Cached wraps repo in a cache backed by store.
+func Cached(repo DriverRepo, store cache.Store, cfg config.Cache) *CachedRepo {
+	return &CachedRepo{
+		DriverRepo: repo,
+		drivers:    cache.New[cachedDriver](store, "driver:", cfg.LocalSize, cfg.LocalTTL, cfg.TTL),
+	}
+}
+
+// Invalidate drops the cached driver. Writes made through the repo do this
+// themselves; call it after writing to drivers elsewhere.
+func (r *CachedRepo) Invalidate(ctx context.Context, id string) { r.drivers.Invalidate(ctx, id) }
+
+// BackgroundCheckChanged drops the cached driver, whose status the
+// background check service wrote; it is a backgroundcheck.Listener.
+func (r *CachedRepo) BackgroundCheckChanged(ctx context.Context, id, _ string) { r.Invalidate(ctx, id) }
+
+func (r *CachedRepo) GetByID(ctx context.Context, id string) (*Driver, error) {
+	c, err := r.drivers.Get(ctx, id, func(ctx context.Context) (cachedDriver, error) {
+		// Fill from the primary so replica lag is never cached.
+		d, err := r.DriverRepo.GetByID(db.RequirePrimary(ctx), id)
+		if err != nil {
+			return cachedDriver{}, err
+		}
+		return cachedDriver{Driver: *d, PhotoKey: d.PhotoKey}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	d := c.Driver
+	d.PhotoKey = c.PhotoKey
+	return &d, nil
+}
+
+func (r *CachedRepo) Create(ctx context.Context, d *Driver, v *Vehicle) error {
+	defer r.Invalidate(ctx, d.ID)
+	return r.DriverRepo.Create(ctx, d, v)
+}
+
+func (r *CachedRepo) SoftDelete(ctx context.Context, id string) error {
+	defer r.Invalidate(ctx, id)
+	return r.DriverRepo.SoftDelete(ctx, id)
+}
+
+func (r *CachedRepo) Restore(ctx context.Context, id string) error {
+	defer r.Invalidate(ctx, id)
+	return r.DriverRepo.Restore(ctx, id)
+}
+
+func (r *CachedRepo) UpdateProfile(ctx context.Context, id string, p Profile) error {
+	defer r.Invalidate(ctx, id)
+	return r.DriverRepo.UpdateProfile(ctx, id, p)
+}
+
+func (r *CachedRepo) SetStatus(ctx context.Context, id, status string) error {
+	defer r.Invalidate(ctx, id)
+	return r.DriverRepo.SetStatus(ctx, id, status)
+}
+
+func (r *CachedRepo) SwapStatus(ctx context.Context, id, from, to string) (bool, error) {
+	defer r.Invalidate(ctx, id)
+	return r.DriverRepo.SwapStatus(ctx, id, from, to)
+}
+
+func (r *CachedRepo) AddVehicle(ctx context.Context, v *Vehicle) error {
+	defer r.Invalidate(ctx, v.DriverID)
+	return r.DriverRepo.AddVehicle(ctx, v)
+}
+
+func (r *CachedRepo) UpdateVehicle(ctx context.Context, v *Vehicle) error {
+	defer r.Invalidate(ctx, v.DriverID)
+	return r.DriverRepo.UpdateVehicle(ctx, v)
+}
+
+func (r *CachedRepo) SetPhotoKey(ctx context.Context, driverID, vehicleID, key string) error {
+	defer r.Invalidate(ctx, driverID)
+	return r.DriverRepo.SetPhotoKey(ctx, driverID, vehicleID, key)
+}
+
+func (r *CachedRepo) RemoveVehicle(ctx context.Context, driverID, vehicleID string) error {
+	defer r.Invalidate(ctx, driverID)
+	return r.DriverRepo.RemoveVehicle(ctx, driverID, vehicleID)
+}
+
+func (r *CachedRepo) SetActiveVehicle(ctx context.Context, driverID, vehicleID string) error {
+	defer r.Invalidate(ctx, driverID)
+	return r.DriverRepo.SetActiveVehicle(ctx, driverID, vehicleID)
+}
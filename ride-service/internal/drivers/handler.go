@@ -1,21 +1,42 @@
 package drivers
 
 import (
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
 	"net/http"
+	"path"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/blob"
 	"ride-service/pkg/jwt"
 	"ride-service/pkg/validation"
+	"ride-service/pkg/verification"
 )
 
 // Handler exposes driver HTTP endpoints.
-type Handler struct{ svc *Service }
+type Handler struct {
+	svc         *Service
+	fleetSecret []byte
+}
+
+// FleetSecretHeader carries a fleet partner's shared secret on
+// POST /drivers/locations/batch.
+const FleetSecretHeader = "X-Fleet-Secret"
 
-// NewHandler wires a handler to the driver service.
-func NewHandler(svc *Service) *Handler { return &Handler{svc: svc} }
+// NewHandler wires a handler to the driver service. fleetSecret
+// authenticates fleet partners; batch ingestion is refused without one.
+func NewHandler(svc *Service, fleetSecret string) *Handler {
+	return &Handler{svc: svc, fleetSecret: []byte(fleetSecret)}
+}
 
 // Routes returns a chi.Router with all driver routes.
 func (h *Handler) Routes() chi.Router {
@@ -24,132 +45,544 @@ func (h *Handler) Routes() chi.Router {
 	// Public
 	r.Post("/register", h.Register)
 	r.Post("/login", h.Login)
+	r.Post("/locations/batch", h.UpdateLocations) // fleet partners, X-Fleet-Secret
 
 	// Protected
 	r.Group(func(r chi.Router) {
 		r.Use(jwt.RequireAuth)
 		r.Get("/nearby", h.GetNearby) // must come before /{id}
+		r.With(jwt.RequireRole("admin", "support")).Get("/", h.List)
 		r.Get("/{id}", h.GetByID)
+		r.Patch("/{id}", h.UpdateProfile)
+		r.Post("/{id}/verify", h.VerifyChange)
+		r.Delete("/{id}", h.Delete)
 		r.Patch("/{id}/location", h.UpdateLocation)
+		r.Post("/{id}/online", h.GoOnline)
+		r.Post("/{id}/offline", h.GoOffline)
+		r.Get("/{id}/sessions", h.Sessions)
+		r.Get("/{id}/preferences", h.Preferences)
+		r.Patch("/{id}/preferences", h.UpdatePreferences)
+		r.Patch("/{id}/vehicle", h.UpdateVehicle)
+		r.Put("/{id}/vehicle/photo", h.UploadVehiclePhoto)
+		r.Get("/{id}/vehicle/photo", h.GetVehiclePhoto)
+		r.Get("/{id}/vehicles", h.Vehicles)
+		r.Post("/{id}/vehicles", h.AddVehicle)
+		r.Patch("/{id}/vehicles/{vehicleID}", h.EditVehicle)
+		r.Delete("/{id}/vehicles/{vehicleID}", h.RemoveVehicle)
+		r.Post("/{id}/vehicles/{vehicleID}/activate", h.SelectVehicle)
+		r.Post("/{id}/devices", h.RegisterDevice)
+		r.Delete("/{id}/devices/{deviceID}", h.RevokeDevice)
 	})
 
 	return r
 }
 
+// AdminRoutes returns the routes mounted under /admin/drivers.
+func (h *Handler) AdminRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth, jwt.RequireRole("admin"))
+	r.Post("/{id}/restore", h.Restore)
+	r.Get("/location-flushes", h.LocationFlushes)
+	return r
+}
+
 func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 	var req RegisterRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid body"})
+		apierror.Write(w, apierror.Validation("invalid body"))
 		return
 	}
-	if !validation.ValidateName(req.Name) {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid name"})
+	if req.Country == "" {
+		req.Country = validation.DefaultCountry
+	}
+	phone, err := validation.NormalizePhone(req.Phone, req.Country)
+	if err != nil {
+		apierror.Write(w, apierror.Validation(err.Error()))
 		return
 	}
-	if !validation.ValidateEmail(req.Email) {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid email"})
+	req.Phone, req.Country = phone, strings.ToUpper(req.Country)
+
+	resp, err := h.svc.Register(r.Context(), req)
+	if err != nil {
+		apierror.Write(w, err)
 		return
 	}
-	if !validation.ValidatePhone(req.Phone) {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid phone"})
+	apierror.WriteJSON(w, http.StatusCreated, resp)
+}
+
+func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
+	var req LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
 		return
 	}
-	if !validation.ValidatePassword(req.Password) {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "password must be at least 6 characters"})
+	resp, err := h.svc.Login(r.Context(), req)
+	if err != nil {
+		apierror.Write(w, err)
 		return
 	}
-	resp, err := h.svc.Register(r.Context(), req)
+	apierror.WriteJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) GetByID(w http.ResponseWriter, r *http.Request) {
+	d, err := h.svc.Profile(r.Context(), chi.URLParam(r, "id"))
 	if err != nil {
-		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+		apierror.Write(w, err)
 		return
 	}
-	writeJSON(w, http.StatusCreated, resp)
+	apierror.WriteJSON(w, http.StatusOK, d)
 }
 
-func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
-	var req LoginRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid body"})
+// Delete deactivates the caller's own account; admins may deactivate any.
+func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !isSelf(r, id) && jwt.GetClaims(r.Context()).Role != "admin" {
+		apierror.Write(w, apierror.Forbidden("forbidden"))
 		return
 	}
-	if !validation.ValidateEmail(req.Email) {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid email"})
+	err := h.svc.Delete(r.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		apierror.Write(w, apierror.NotFound("driver not found or already deactivated"))
 		return
 	}
-	resp, err := h.svc.Login(r.Context(), req)
 	if err != nil {
-		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": err.Error()})
+		apierror.Write(w, err)
 		return
 	}
-	writeJSON(w, http.StatusOK, resp)
+	apierror.WriteJSON(w, http.StatusOK, map[string]string{"status": "deactivated"})
 }
 
-func (h *Handler) GetByID(w http.ResponseWriter, r *http.Request) {
-	d, err := h.svc.GetByID(r.Context(), chi.URLParam(r, "id"))
+func (h *Handler) Restore(w http.ResponseWriter, r *http.Request) {
+	d, err := h.svc.Restore(r.Context(), chi.URLParam(r, "id"))
+	if errors.Is(err, ErrNotFound) {
+		apierror.Write(w, apierror.NotFound("driver not found or not deactivated"))
+		return
+	}
 	if err != nil {
-		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		apierror.Write(w, err)
 		return
 	}
-	writeJSON(w, http.StatusOK, d)
+	apierror.WriteJSON(w, http.StatusOK, d)
+}
+
+// List serves GET /drivers?status=&vehicle_type=&city=&min_rating=&max_rating=&q=&limit=&offset=.
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := ListFilter{
+		Status:      q.Get("status"),
+		VehicleType: q.Get("vehicle_type"),
+		City:        q.Get("city"),
+		Query:       q.Get("q"),
+		Limit:       20,
+	}
+	if v, err := strconv.Atoi(q.Get("limit")); err == nil && v > 0 && v <= 100 {
+		f.Limit = v
+	}
+	if v, err := strconv.Atoi(q.Get("offset")); err == nil && v > 0 {
+		f.Offset = v
+	}
+	for name, dst := range map[string]**float64{"min_rating": &f.MinRating, "max_rating": &f.MaxRating} {
+		if raw := q.Get(name); raw != "" {
+			v, err := strconv.ParseFloat(raw, 64)
+			if err != nil {
+				apierror.Write(w, apierror.Validation(name+" must be a number"))
+				return
+			}
+			*dst = &v
+		}
+	}
+
+	list, err := h.svc.List(r.Context(), f)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, list)
 }
 
 func (h *Handler) UpdateLocation(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	var loc LocationUpdate
 	if err := json.NewDecoder(r.Body).Decode(&loc); err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid body"})
+		apierror.Write(w, apierror.Validation("invalid body"))
 		return
 	}
-	if !validation.ValidateCoordinates(loc.Lat, loc.Lng) {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid coordinates"})
+	if err := h.svc.UpdateLocation(r.Context(), id, loc.Lat, loc.Lng); err != nil {
+		apierror.Write(w, err)
 		return
 	}
-	if err := h.svc.UpdateLocation(r.Context(), id, loc.Lat, loc.Lng); err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	apierror.WriteJSON(w, http.StatusOK, map[string]string{"status": "location_updated"})
+}
+
+// UpdateLocations serves POST /drivers/locations/batch: a JSON array of
+// pings from a fleet partner. Each ping's outcome is in the response.
+func (h *Handler) UpdateLocations(w http.ResponseWriter, r *http.Request) {
+	got := []byte(r.Header.Get(FleetSecretHeader))
+	if len(h.fleetSecret) == 0 || subtle.ConstantTimeCompare(got, h.fleetSecret) != 1 {
+		apierror.Write(w, apierror.Unauthorized("unauthorized"))
+		return
+	}
+	var pings []LocationPing
+	if err := json.NewDecoder(r.Body).Decode(&pings); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
 		return
 	}
-	writeJSON(w, http.StatusOK, map[string]string{"status": "location_updated"})
+	res, err := h.svc.UpdateLocations(r.Context(), pings)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, res)
 }
 
-func (h *Handler) GetNearby(w http.ResponseWriter, r *http.Request) {
-	latStr := r.URL.Query().Get("lat")
-	lngStr := r.URL.Query().Get("lng")
-	if latStr == "" || lngStr == "" {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "lat and lng are required"})
+// LocationFlushes serves GET /admin/drivers/location-flushes: how location
+// updates are being batched into Redis.
+func (h *Handler) LocationFlushes(w http.ResponseWriter, _ *http.Request) {
+	apierror.WriteJSON(w, http.StatusOK, h.svc.LocationFlushStats())
+}
+
+func (h *Handler) GoOnline(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !isSelf(r, id) {
+		apierror.Write(w, apierror.Forbidden("forbidden"))
+		return
+	}
+	sess, err := h.svc.GoOnline(r.Context(), id)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, sess)
+}
+
+func (h *Handler) GoOffline(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !isSelf(r, id) {
+		apierror.Write(w, apierror.Forbidden("forbidden"))
 		return
 	}
-	lat, err := strconv.ParseFloat(latStr, 64)
+	sess, err := h.svc.GoOffline(r.Context(), id)
 	if err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid lat"})
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, sess)
+}
+
+// Sessions serves GET /drivers/:id/sessions?from=&to=. Bounds are RFC 3339
+// timestamps or YYYY-MM-DD (UTC midnight); the default is the last 7 days.
+func (h *Handler) Sessions(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !isSelf(r, id) && !isStaff(r) {
+		apierror.Write(w, apierror.Forbidden("forbidden"))
+		return
+	}
+	q := r.URL.Query()
+	to, err := parseBound(q.Get("to"), time.Now())
+	if err != nil {
+		apierror.Write(w, apierror.Validation("to: "+err.Error()))
+		return
+	}
+	from, err := parseBound(q.Get("from"), to.UTC().Truncate(24*time.Hour).AddDate(0, 0, -6))
+	if err != nil {
+		apierror.Write(w, apierror.Validation("from: "+err.Error()))
+		return
+	}
+	report, err := h.svc.Sessions(r.Context(), id, from, to)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, report)
+}
+
+// Preferences serves GET /drivers/:id/preferences.
+func (h *Handler) Preferences(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !isSelf(r, id) && !isStaff(r) {
+		apierror.Write(w, apierror.Forbidden("forbidden"))
 		return
 	}
-	lng, err := strconv.ParseFloat(lngStr, 64)
+	p, err := h.svc.Preferences(r.Context(), id)
 	if err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid lng"})
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, p)
+}
+
+// UpdatePreferences serves PATCH /drivers/:id/preferences.
+func (h *Handler) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !isSelf(r, id) {
+		apierror.Write(w, apierror.Forbidden("forbidden"))
+		return
+	}
+	var req PreferencesUpdate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid request body"))
 		return
 	}
-	if !validation.ValidateCoordinates(lat, lng) {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid coordinates"})
+	p, err := h.svc.UpdatePreferences(r.Context(), id, req)
+	if err != nil {
+		apierror.Write(w, err)
 		return
 	}
+	apierror.WriteJSON(w, http.StatusOK, p)
+}
+
+func parseBound(v string, fallback time.Time) (time.Time, error) {
+	if v == "" {
+		return fallback, nil
+	}
+	if t, err := time.Parse(time.DateOnly, v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+func (h *Handler) GetNearby(w http.ResponseWriter, r *http.Request) {
+	// Presence and ranges are enforced by the OpenAPI validator.
+	q := r.URL.Query()
+	lat, _ := strconv.ParseFloat(q.Get("lat"), 64)
+	lng, _ := strconv.ParseFloat(q.Get("lng"), 64)
 	radius := 5.0
-	if v := r.URL.Query().Get("radius"); v != "" {
-		radius, err = strconv.ParseFloat(v, 64)
-		if err != nil || radius <= 0 {
-			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid radius"})
-			return
-		}
+	if v, err := strconv.ParseFloat(q.Get("radius"), 64); err == nil && v > 0 {
+		radius = v
 	}
 	ids, err := h.svc.GetNearby(r.Context(), lat, lng, radius)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		apierror.Write(w, err)
 		return
 	}
-	writeJSON(w, http.StatusOK, map[string]any{"drivers": ids})
+	apierror.WriteJSON(w, http.StatusOK, map[string]any{"drivers": ids})
+}
+
+func (h *Handler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !isSelf(r, id) {
+		apierror.Write(w, apierror.Forbidden("forbidden"))
+		return
+	}
+	var req UpdateProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	if req.Password != nil && req.CurrentPassword == "" {
+		apierror.Write(w, apierror.Validation("current_password is required to change the password"))
+		return
+	}
+	resp, err := h.svc.UpdateProfile(r.Context(), id, req)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) VerifyChange(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !isSelf(r, id) {
+		apierror.Write(w, apierror.Forbidden("forbidden"))
+		return
+	}
+	var req VerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	if req.Field != verification.Email && req.Field != verification.Phone {
+		apierror.Write(w, apierror.Validation("field must be email or phone"))
+		return
+	}
+	d, err := h.svc.VerifyChange(r.Context(), id, req)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, d)
+}
+
+func (h *Handler) UpdateVehicle(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !isSelf(r, id) {
+		apierror.Write(w, apierror.Forbidden("forbidden"))
+		return
+	}
+	var req VehicleUpdate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	d, err := h.svc.UpdateVehicle(r.Context(), id, req)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, d)
+}
+
+// Vehicles serves GET /drivers/:id/vehicles.
+func (h *Handler) Vehicles(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !isSelf(r, id) && !isStaff(r) {
+		apierror.Write(w, apierror.Forbidden("forbidden"))
+		return
+	}
+	vs, err := h.svc.Vehicles(r.Context(), id)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]any{"vehicles": vs})
+}
+
+// AddVehicle serves POST /drivers/:id/vehicles.
+func (h *Handler) AddVehicle(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !isSelf(r, id) {
+		apierror.Write(w, apierror.Forbidden("forbidden"))
+		return
+	}
+	var req VehicleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	v, err := h.svc.AddVehicle(r.Context(), id, req)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusCreated, v)
+}
+
+// EditVehicle serves PATCH /drivers/:id/vehicles/:vehicleID.
+func (h *Handler) EditVehicle(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !isSelf(r, id) {
+		apierror.Write(w, apierror.Forbidden("forbidden"))
+		return
+	}
+	var req VehicleUpdate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	v, err := h.svc.EditVehicle(r.Context(), id, chi.URLParam(r, "vehicleID"), req)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, v)
+}
+
+// RemoveVehicle serves DELETE /drivers/:id/vehicles/:vehicleID.
+func (h *Handler) RemoveVehicle(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !isSelf(r, id) {
+		apierror.Write(w, apierror.Forbidden("forbidden"))
+		return
+	}
+	if err := h.svc.RemoveVehicle(r.Context(), id, chi.URLParam(r, "vehicleID")); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]string{"status": "vehicle_removed"})
+}
+
+// SelectVehicle serves POST /drivers/:id/vehicles/:vehicleID/activate.
+func (h *Handler) SelectVehicle(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !isSelf(r, id) {
+		apierror.Write(w, apierror.Forbidden("forbidden"))
+		return
+	}
+	d, err := h.svc.SelectVehicle(r.Context(), id, chi.URLParam(r, "vehicleID"))
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, d)
+}
+
+// UploadVehiclePhoto accepts the raw image as the request body.
+func (h *Handler) UploadVehiclePhoto(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !isSelf(r, id) {
+		apierror.Write(w, apierror.Forbidden("forbidden"))
+		return
+	}
+	body := http.MaxBytesReader(w, r.Body, MaxPhotoBytes)
+	if err := h.svc.SetVehiclePhoto(r.Context(), id, body); err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			err = apierror.New(http.StatusRequestEntityTooLarge, apierror.CodeTooLarge, "photo too large")
+		}
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]string{"status": "photo_updated"})
+}
+
+func (h *Handler) GetVehiclePhoto(w http.ResponseWriter, r *http.Request) {
+	rc, key, err := h.svc.VehiclePhoto(r.Context(), chi.URLParam(r, "id"))
+	if errors.Is(err, blob.ErrNotFound) {
+		apierror.Write(w, apierror.NotFound("photo not found"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	defer rc.Close()
+	w.Header().Set("Content-Type", mime.TypeByExtension(path.Ext(key)))
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	if _, err := io.Copy(w, rc); err != nil {
+		log.Printf("[drivers] photo stream error: %v", err)
+	}
+}
+
+func (h *Handler) RegisterDevice(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !isSelf(r, id) {
+		apierror.Write(w, apierror.Forbidden("forbidden"))
+		return
+	}
+	var req DeviceRequest
+	// body is optional
+	json.NewDecoder(r.Body).Decode(&req)
+
+	reg, err := h.svc.RegisterDevice(r.Context(), id, req.Label)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusCreated, reg)
+}
+
+func (h *Handler) RevokeDevice(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !isSelf(r, id) {
+		apierror.Write(w, apierror.Forbidden("forbidden"))
+		return
+	}
+	if err := h.svc.RevokeDevice(r.Context(), id, chi.URLParam(r, "deviceID")); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]string{"status": "device_revoked"})
+}
+
+// isStaff reports whether the caller is an admin or support agent.
+func isStaff(r *http.Request) bool {
+	claims := jwt.GetClaims(r.Context())
+	return claims != nil && (claims.Role == "admin" || claims.Role == "support")
 }
 
-func writeJSON(w http.ResponseWriter, status int, v any) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(v)
+// isSelf reports whether the caller is the driver identified by id.
+func isSelf(r *http.Request, id string) bool {
+	claims := jwt.GetClaims(r.Context())
+	return claims != nil && claims.UserID == id
 }
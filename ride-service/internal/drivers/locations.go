@@ -0,0 +1,145 @@
+package drivers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"ride-service/pkg/geo"
+)
+
+// Limits on POST /drivers/locations/batch.
+const (
+	MaxLocationBatch = 5000
+	// MaxPingAge is how old a ping may be and still place the driver; a
+	// partner's clock may run up to MaxPingSkew ahead of ours.
+	MaxPingAge  = 5 * time.Minute
+	MaxPingSkew = time.Minute
+)
+
+// Outcomes of a ping in a batch. A ping is skipped when the same batch holds
+// a newer one for the driver.
+const (
+	PingAccepted = "accepted"
+	PingSkipped  = "skipped"
+	PingRejected = "rejected"
+)
+
+// LocationPing is one item of the body for POST /drivers/locations/batch.
+// Items are checked one by one, so a bad item does not fail the batch.
+type LocationPing struct {
+	DriverID string    `json:"driverID"`
+	Lat      *float64  `json:"lat"`
+	Lng      *float64  `json:"lng"`
+	TS       time.Time `json:"ts"` // when the position was taken
+}
+
+// LocationResult is what happened to the ping at Index of a batch.
+type LocationResult struct {
+	Index    int    `json:"index"`
+	DriverID string `json:"driver_id"`
+	Status   string `json:"status"` // accepted | skipped | rejected
+	Error    string `json:"error,omitempty"`
+}
+
+// LocationBatchResult is the response for POST /drivers/locations/batch.
+type LocationBatchResult struct {
+	Accepted int              `json:"accepted"`
+	Skipped  int              `json:"skipped"`
+	Rejected int              `json:"rejected"`
+	Results  []LocationResult `json:"results"` // in request order
+}
+
+// UpdateLocations is UpdateLocation for a fleet partner's batch of pings.
+// Only each driver's newest ping is stored; all of them go to Redis in one
+// pipeline, and those of busy drivers, kept out of the pool, in another. Pings that cannot place their driver are rejected individually;
+// an error is only returned when the batch as a whole could not be stored.
+func (s *Service) UpdateLocations(ctx context.Context, pings []LocationPing) (*LocationBatchResult, error) {
+	if len(pings) > MaxLocationBatch {
+		return nil, fmt.Errorf("%w: at most %d locations per batch", ErrInvalid, MaxLocationBatch)
+	}
+	now := time.Now()
+	results := make([]LocationResult, len(pings))
+	newest := map[string]int{} // driver → index of their newest valid ping
+	for i, p := range pings {
+		results[i] = LocationResult{Index: i, DriverID: p.DriverID}
+		id, err := p.check(now)
+		if err != nil {
+			results[i].Status, results[i].Error = PingRejected, err.Error()
+			continue
+		}
+		pings[i].DriverID = id
+		if j, ok := newest[id]; ok {
+			if !p.TS.After(pings[j].TS) {
+				results[i].Status = PingSkipped
+				continue
+			}
+			results[j].Status = PingSkipped
+		}
+		newest[id] = i
+	}
+
+	var positions []geo.Position
+	var placed []int
+	for i, p := range pings {
+		if results[i].Status != "" {
+			continue
+		}
+		err := s.ensureOnline(ctx, p.DriverID)
+		switch {
+		case errors.Is(err, ErrNotFound), errors.Is(err, ErrNotVerified), errors.Is(err, ErrCheckNotPassed), errors.Is(err, ErrOnBreak), errors.Is(err, ErrNoVehicle):
+			results[i].Status, results[i].Error = PingRejected, err.Error()
+			continue
+		case err != nil:
+			return nil, err
+		}
+		positions = append(positions, geo.Position{DriverID: p.DriverID, Lat: *p.Lat, Lng: *p.Lng})
+		placed = append(placed, i)
+	}
+	if err := s.storePositions(ctx, positions); err != nil {
+		return nil, err
+	}
+	for _, i := range placed {
+		results[i].Status = PingAccepted
+		for _, o := range s.watch {
+			o.DriverMoved(ctx, pings[i].DriverID, *pings[i].Lat, *pings[i].Lng)
+		}
+	}
+
+	res := &LocationBatchResult{Results: results}
+	for _, r := range results {
+		switch r.Status {
+		case PingAccepted:
+			res.Accepted++
+		case PingSkipped:
+			res.Skipped++
+		default:
+			res.Rejected++
+		}
+	}
+	logger.Info("location batch stored", "pings", len(pings), "accepted", res.Accepted, "rejected", res.Rejected)
+	return res, nil
+}
+
+// check validates p against now and returns its driver ID in canonical form.
+func (p LocationPing) check(now time.Time) (string, error) {
+	id, err := uuid.Parse(p.DriverID)
+	switch {
+	case err != nil:
+		return "", errors.New("driverID must be a UUID")
+	case p.Lat == nil || p.Lng == nil:
+		return "", errors.New("lat and lng are required")
+	case *p.Lat < -90 || *p.Lat > 90 || *p.Lng < -180 || *p.Lng > 180:
+		return "", errors.New("coordinates out of range")
+	case p.TS.IsZero():
+		return "", errors.New("ts is required")
+	case p.TS.Before(now.Add(-MaxPingAge)):
+		return "", fmt.Errorf("ts is more than %s old", MaxPingAge)
+	case p.TS.After(now.Add(MaxPingSkew)):
+		return "", errors.New("ts is in the future")
+	}
+	return id.String(), nil
+}
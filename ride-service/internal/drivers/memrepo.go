@@ -0,0 +1,473 @@
+package drivers
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ride-service/internal/events"
+)
+
+type memDevice struct {
+	driverID string
+	secret   []byte
+	revoked  bool
+}
+
+// MemoryRepo is an in-memory DriverRepo for tests and local experiments.
+type MemoryRepo struct {
+	mu       sync.Mutex
+	drivers  map[string]Driver
+	devices  map[string]memDevice
+	sessions []Session
+	prefs    map[string]Preferences
+	vehicles map[string]Vehicle
+}
+
+// NewMemoryRepo returns an empty MemoryRepo.
+func NewMemoryRepo() *MemoryRepo {
+	return &MemoryRepo{drivers: map[string]Driver{}, devices: map[string]memDevice{}, prefs: map[string]Preferences{},
+		vehicles: map[string]Vehicle{}}
+}
+
+func (m *MemoryRepo) EmailTaken(_ context.Context, email string) (bool, error) {
+	_, ok := m.find(func(d Driver) bool { return d.Email == email })
+	return ok, nil
+}
+
+func (m *MemoryRepo) PhoneTaken(_ context.Context, phone string) (bool, error) {
+	_, ok := m.find(func(d Driver) bool { return d.Phone == phone })
+	return ok, nil
+}
+
+func (m *MemoryRepo) Create(_ context.Context, d *Driver, v *Vehicle) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d.CreatedAt = time.Now()
+	v.CreatedAt = d.CreatedAt
+	m.vehicles[v.ID] = *v
+	stored := *d
+	stored.ActiveVehicleID = &v.ID
+	m.drivers[d.ID] = stored
+	return nil
+}
+
+func (m *MemoryRepo) GetByEmail(_ context.Context, email string) (*Driver, error) {
+	d, ok := m.find(func(d Driver) bool { return d.Email == email && d.DeletedAt == nil })
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &d, nil
+}
+
+func (m *MemoryRepo) GetByID(_ context.Context, id string) (*Driver, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.drivers[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	d = m.withVehicle(d)
+	d.PasswordHash = ""
+	return &d, nil
+}
+
+func (m *MemoryRepo) List(_ context.Context, f ListFilter) ([]Driver, int, error) {
+	m.mu.Lock()
+	matched := []Driver{}
+	for _, d := range m.drivers {
+		if d = m.withVehicle(d); matches(d, f) {
+			d.PasswordHash = ""
+			matched = append(matched, d)
+		}
+	}
+	m.mu.Unlock()
+
+	sort.Slice(matched, func(i, j int) bool {
+		a, b := matched[i], matched[j]
+		if a.Rating != b.Rating {
+			return a.Rating > b.Rating
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.Before(b.CreatedAt)
+		}
+		return a.ID < b.ID
+	})
+	total := len(matched)
+	start := min(f.Offset, total)
+	end := min(start+f.Limit, total)
+	return matched[start:end], total, nil
+}
+
+func matches(d Driver, f ListFilter) bool {
+	q := strings.ToLower(f.Query)
+	switch {
+	case d.DeletedAt != nil,
+		f.Status != "" && d.Status != f.Status,
+		f.VehicleType != "" && d.VehicleType != f.VehicleType,
+		f.City != "" && !strings.EqualFold(d.City, f.City),
+		f.MinRating != nil && d.Rating < *f.MinRating,
+		f.MaxRating != nil && d.Rating > *f.MaxRating,
+		q != "" && !strings.Contains(strings.ToLower(d.Name), q) &&
+			!strings.Contains(strings.ToLower(d.LicensePlate), q):
+		return false
+	}
+	return true
+}
+
+func (m *MemoryRepo) PasswordHash(_ context.Context, id string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.drivers[id]
+	if !ok || d.DeletedAt != nil {
+		return "", ErrNotFound
+	}
+	return d.PasswordHash, nil
+}
+
+func (m *MemoryRepo) UpdateProfile(_ context.Context, id string, p Profile) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.drivers[id]
+	if !ok || d.DeletedAt != nil {
+		return ErrNotFound
+	}
+	for oid, o := range m.drivers {
+		switch {
+		case oid == id:
+		case p.Email != nil && o.Email == *p.Email:
+			return ErrEmailTaken
+		case p.Phone != nil && o.Phone == *p.Phone:
+			return ErrPhoneTaken
+		}
+	}
+	set(&d.Name, p.Name)
+	set(&d.Email, p.Email)
+	set(&d.Phone, p.Phone)
+	set(&d.Country, p.Country)
+	set(&d.PasswordHash, p.PasswordHash)
+	m.drivers[id] = d
+	return nil
+}
+
+func set(dst *string, v *string) {
+	if v != nil {
+		*dst = *v
+	}
+}
+
+// withVehicle fills in d's active vehicle fields. m.mu must be held.
+func (m *MemoryRepo) withVehicle(d Driver) Driver {
+	d.VehicleType, d.LicensePlate, d.VehicleModel, d.VehicleColor, d.PhotoKey = "", "", "", "", ""
+	if d.ActiveVehicleID != nil {
+		if v, ok := m.vehicles[*d.ActiveVehicleID]; ok {
+			d.VehicleType, d.LicensePlate, d.VehicleModel, d.VehicleColor, d.PhotoKey = v.Type, v.LicensePlate, v.Model, v.Color, v.PhotoKey
+		}
+	}
+	return d
+}
+
+func (m *MemoryRepo) Vehicles(_ context.Context, driverID string) ([]Vehicle, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d := m.drivers[driverID]
+	out := []Vehicle{}
+	for _, v := range m.vehicles {
+		if v.DriverID == driverID {
+			v.Active = d.ActiveVehicleID != nil && *d.ActiveVehicleID == v.ID
+			out = append(out, v)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.Before(out[j].CreatedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out, nil
+}
+
+func (m *MemoryRepo) AddVehicle(_ context.Context, v *Vehicle) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.drivers[v.DriverID]
+	if !ok {
+		return ErrNotFound
+	}
+	v.CreatedAt = time.Now()
+	m.vehicles[v.ID] = *v
+	if d.ActiveVehicleID == nil {
+		id := v.ID
+		d.ActiveVehicleID = &id
+		m.drivers[d.ID] = d
+	}
+	return nil
+}
+
+func (m *MemoryRepo) UpdateVehicle(_ context.Context, v *Vehicle) error {
+	return m.updateVehicle(v.DriverID, v.ID, func(stored *Vehicle) {
+		photo, created := stored.PhotoKey, stored.CreatedAt
+		*stored = *v
+		stored.PhotoKey, stored.CreatedAt, stored.Active = photo, created, false
+	})
+}
+
+func (m *MemoryRepo) SetPhotoKey(_ context.Context, driverID, vehicleID, key string) error {
+	return m.updateVehicle(driverID, vehicleID, func(v *Vehicle) { v.PhotoKey = key })
+}
+
+func (m *MemoryRepo) RemoveVehicle(_ context.Context, driverID, vehicleID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.vehicles[vehicleID]
+	d := m.drivers[driverID]
+	if !ok || v.DriverID != driverID || (d.ActiveVehicleID != nil && *d.ActiveVehicleID == vehicleID) {
+		return ErrVehicleNotFound
+	}
+	delete(m.vehicles, vehicleID)
+	return nil
+}
+
+func (m *MemoryRepo) SetActiveVehicle(_ context.Context, driverID, vehicleID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.vehicles[vehicleID]
+	d, found := m.drivers[driverID]
+	if !ok || !found || v.DriverID != driverID {
+		return ErrVehicleNotFound
+	}
+	d.ActiveVehicleID = &vehicleID
+	m.drivers[driverID] = d
+	return nil
+}
+
+func (m *MemoryRepo) updateVehicle(driverID, vehicleID string, fn func(*Vehicle)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	v, ok := m.vehicles[vehicleID]
+	if !ok || v.DriverID != driverID {
+		return ErrVehicleNotFound
+	}
+	fn(&v)
+	m.vehicles[vehicleID] = v
+	return nil
+}
+
+func (m *MemoryRepo) SoftDelete(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.drivers[id]
+	if !ok || d.DeletedAt != nil {
+		return ErrNotFound
+	}
+	now := time.Now()
+	d.DeletedAt, d.Status = &now, "offline"
+	m.drivers[id] = d
+	return nil
+}
+
+func (m *MemoryRepo) Restore(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.drivers[id]
+	if !ok || d.DeletedAt == nil {
+		return ErrNotFound
+	}
+	d.DeletedAt = nil
+	m.drivers[id] = d
+	return nil
+}
+
+func (m *MemoryRepo) SetStatus(_ context.Context, id, status string) error {
+	return m.update(id, func(d *Driver) { d.Status = status })
+}
+
+func (m *MemoryRepo) SwapStatus(_ context.Context, id, from, to string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.drivers[id]
+	if !ok || d.Status != from {
+		return false, nil
+	}
+	d.Status = to
+	m.drivers[id] = d
+	return true, nil
+}
+
+func (m *MemoryRepo) CreateDevice(_ context.Context, id, driverID string, secret []byte, _ string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.devices[id] = memDevice{driverID: driverID, secret: append([]byte(nil), secret...)}
+	return nil
+}
+
+func (m *MemoryRepo) RevokeDevice(_ context.Context, driverID, deviceID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dev, ok := m.devices[deviceID]
+	if !ok || dev.driverID != driverID || dev.revoked {
+		return ErrDeviceNotFound
+	}
+	dev.revoked = true
+	m.devices[deviceID] = dev
+	return nil
+}
+
+func (m *MemoryRepo) DeviceKey(_ context.Context, driverID, deviceID string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dev, ok := m.devices[deviceID]
+	if !ok || dev.driverID != driverID || dev.revoked {
+		return nil, ErrDeviceNotFound
+	}
+	return append([]byte(nil), dev.secret...), nil
+}
+
+func (m *MemoryRepo) OpenSession(_ context.Context, s *Session) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, existing := range m.sessions {
+		if existing.DriverID == s.DriverID && existing.EndedAt == nil {
+			return false, nil
+		}
+	}
+	m.sessions = append(m.sessions, *s)
+	return true, nil
+}
+
+func (m *MemoryRepo) ActiveSession(_ context.Context, driverID string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range m.sessions {
+		if s.DriverID == driverID && s.EndedAt == nil {
+			return &s, nil
+		}
+	}
+	return nil, ErrNoSession
+}
+
+func (m *MemoryRepo) LastSession(_ context.Context, driverID string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var last *Session
+	for i := range m.sessions {
+		s := m.sessions[i]
+		if s.DriverID == driverID && s.EndedAt != nil && (last == nil || s.EndedAt.After(*last.EndedAt)) {
+			last = &s
+		}
+	}
+	if last == nil {
+		return nil, ErrNoSession
+	}
+	return last, nil
+}
+
+func (m *MemoryRepo) CloseSession(_ context.Context, driverID string, at time.Time, reason string) (*Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.sessions {
+		if s := &m.sessions[i]; s.DriverID == driverID && s.EndedAt == nil {
+			s.EndedAt, s.EndReason = &at, reason
+			closed := *s
+			return &closed, nil
+		}
+	}
+	return nil, ErrNoSession
+}
+
+func (m *MemoryRepo) Sessions(_ context.Context, driverID string, from, to time.Time) ([]Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := []Session{}
+	for _, s := range m.sessions {
+		if s.DriverID == driverID && s.StartedAt.Before(to) && (s.EndedAt == nil || s.EndedAt.After(from)) {
+			out = append(out, s)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].StartedAt.Before(out[j].StartedAt) })
+	return out, nil
+}
+
+// OfferCounts reports no offers: they are recorded by the trip repository,
+// which the memory repo does not share.
+func (m *MemoryRepo) OfferCounts(_ context.Context, _ []string, _ time.Time) (map[string]Scores, error) {
+	return map[string]Scores{}, nil
+}
+
+// CandidateStats has no trips to find the last one in; LastTripAt stays nil.
+func (m *MemoryRepo) CandidateStats(_ context.Context, driverIDs []string) (map[string]events.DriverStats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := map[string]events.DriverStats{}
+	for _, id := range driverIDs {
+		if d, ok := m.drivers[id]; ok {
+			st := events.DriverStats{Rating: d.Rating, Gender: d.Gender}
+			if d.ActiveVehicleID != nil {
+				v := m.vehicles[*d.ActiveVehicleID]
+				st.VehicleType, st.Capacity, st.Accessibility = v.Type, v.Capacity, v.Accessibility
+				st.ChildSeats, st.LuggageLitres = v.ChildSeats, v.LuggageLitres
+			}
+			out[id] = st
+		}
+	}
+	return out, nil
+}
+
+func (m *MemoryRepo) Preferences(_ context.Context, driverIDs []string) (map[string]Preferences, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := map[string]Preferences{}
+	for _, id := range driverIDs {
+		if p, ok := m.prefs[id]; ok {
+			out[id] = p
+		}
+	}
+	return out, nil
+}
+
+func (m *MemoryRepo) SavePreferences(_ context.Context, driverID string, p *Preferences) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	saved := *p
+	saved.UpdatedAt = &now
+	m.prefs[driverID] = saved
+	return nil
+}
+
+func (m *MemoryRepo) OverdueSessions(_ context.Context, since time.Time) ([]Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := []Session{}
+	for _, s := range m.sessions {
+		if s.EndedAt == nil && !s.ContinuousSince.After(since) {
+			out = append(out, s)
+		}
+	}
+	return out, nil
+}
+
+func (m *MemoryRepo) find(match func(Driver) bool) (Driver, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, d := range m.drivers {
+		if match(d) {
+			return m.withVehicle(d), true
+		}
+	}
+	return Driver{}, false
+}
+
+func (m *MemoryRepo) update(id string, fn func(*Driver)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.drivers[id]
+	if !ok {
+		return ErrNotFound
+	}
+	fn(&d)
+	m.drivers[id] = d
+	return nil
+}
@@ -4,38 +4,207 @@ import "time"
 
 // Driver represents a driver account.
 type Driver struct {
-	ID           string    `json:"id"`
-	Name         string    `json:"name"`
-	Email        string    `json:"email"`
-	Phone        string    `json:"phone"`
-	PasswordHash string    `json:"-"`
-	VehicleType  string    `json:"vehicle_type"`
-	LicensePlate string    `json:"license_plate"`
-	Status       string    `json:"status"` // available | busy | offline
-	Rating       float64   `json:"rating"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID           string `json:"id"`
+	Name         string `json:"name"`
+	Email        string `json:"email"`
+	Phone        string `json:"phone"`   // E.164
+	Country      string `json:"country"` // ISO 3166-1 alpha-2
+	City         string `json:"city,omitempty"`
+	Gender       string `json:"gender,omitempty"` // set at registration; see events.Genders
+	PasswordHash string `json:"-"`
+	// The vehicle fields describe the active vehicle and are empty without
+	// one; GET /drivers/:id/vehicles lists them all.
+	ActiveVehicleID *string    `json:"active_vehicle_id,omitempty"`
+	VehicleType     string     `json:"vehicle_type"`
+	LicensePlate    string     `json:"license_plate"`
+	VehicleModel    string     `json:"vehicle_model,omitempty"`
+	VehicleColor    string     `json:"vehicle_color,omitempty"`
+	PhotoKey        string     `json:"-"`
+	Status          string     `json:"status"` // available | busy | offline
+	Rating          float64    `json:"rating"`
+	VerifiedAt      *time.Time `json:"verified_at,omitempty"` // set once all required documents are approved
+	BackgroundCheck string     `json:"background_check"`      // not_started | pending | passed | failed
+	CreatedAt       time.Time  `json:"created_at"`
+	DeletedAt       *time.Time `json:"deleted_at,omitempty"` // set while the account is deactivated
+	Scores          *Scores    `json:"scores,omitempty"`     // profile only
+	Safety          *Safety    `json:"safety,omitempty"`     // profile only, once safety is scored
+}
+
+// Scores are a driver's trip offer statistics over the rolling score window.
+// The rates stay null until the driver has answered enough offers to judge.
+type Scores struct {
+	Offers           int      `json:"offers"`   // accepted + declined
+	Accepted         int      `json:"accepted"` // including those cancelled later
+	Declined         int      `json:"declined"`
+	Cancelled        int      `json:"cancelled"` // accepted, then cancelled before the trip started
+	AcceptanceRate   *float64 `json:"acceptance_rate"`
+	CancellationRate *float64 `json:"cancellation_rate"`
+	WindowDays       int      `json:"window_days"`
+}
+
+// Safety is how a driver has driven over the safety window, judged from
+// the speed between their location pings. Each count is an episode: a
+// stretch over the speed limit, or one harsh acceleration or braking.
+type Safety struct {
+	// Score is 100 without incidents, less the more of them per km; null
+	// until the driver has driven enough in the window to judge.
+	Score        *float64 `json:"score"`
+	Km           float64  `json:"km"`
+	Speeding     int      `json:"speeding"`
+	HarshAccel   int      `json:"harsh_acceleration"`
+	HarshBraking int      `json:"harsh_braking"`
+	WindowDays   int      `json:"window_days"`
 }
 
 // RegisterRequest is the body for POST /drivers/register.
 type RegisterRequest struct {
-	Name         string `json:"name"`
-	Email        string `json:"email"`
-	Phone        string `json:"phone"`
-	Password     string `json:"password"`
-	VehicleType  string `json:"vehicle_type"`
-	LicensePlate string `json:"license_plate"`
+	Name         string `json:"name" validate:"required,minLength=2,maxLength=200"`
+	Email        string `json:"email" validate:"required,format=email,maxLength=200"`
+	Phone        string `json:"phone" validate:"required,maxLength=30"`
+	Country      string `json:"country" validate:"minLength=2,maxLength=2"` // ISO 3166-1 alpha-2, defaults to IN
+	City         string `json:"city" validate:"maxLength=100"`
+	Gender       string `json:"gender" validate:"maxLength=20"` // optional: female, male or nonbinary
+	Password     string `json:"password" validate:"required,minLength=6,maxLength=100"`
+	VehicleType  string `json:"vehicle_type" validate:"maxLength=50"`
+	LicensePlate string `json:"license_plate" validate:"maxLength=20"`
+	// Terms of service and privacy policy versions the driver accepts,
+	// optional; see users.RegisterRequest.
+	TermsVersion   string `json:"terms_version" validate:"maxLength=20"`
+	PrivacyVersion string `json:"privacy_version" validate:"maxLength=20"`
+	// CAPTCHA token, as for riders.
+	ChallengeToken string `json:"challenge_token,omitempty" validate:"maxLength=4096"`
+}
+
+// ListFilter narrows GET /drivers. Zero values mean "any".
+type ListFilter struct {
+	Status      string
+	VehicleType string
+	City        string   // case-insensitive exact match
+	MinRating   *float64 // inclusive
+	MaxRating   *float64 // inclusive
+	Query       string   // substring of name or license plate
+	Limit       int
+	Offset      int
+}
+
+// DriverList is a page of GET /drivers. Total counts every match.
+type DriverList struct {
+	Drivers []Driver `json:"drivers"`
+	Total   int      `json:"total"`
+	Limit   int      `json:"limit"`
+	Offset  int      `json:"offset"`
+}
+
+// Session end reasons.
+const (
+	EndDriver        = "driver"         // the driver went offline
+	EndMaxContinuous = "max_continuous" // forced offline after the driving limit
+	EndDeleted       = "deleted"        // the account was deactivated
+	EndCheckFailed   = "check_failed"   // the background check stopped passing
+)
+
+// Session is one online span. EndedAt is nil while the driver is online.
+// ContinuousSince is when the current run of sessions started: going back
+// online before a full break continues the run instead of resetting it.
+type Session struct {
+	ID              string     `json:"id"`
+	DriverID        string     `json:"driver_id"`
+	StartedAt       time.Time  `json:"started_at"`
+	ContinuousSince time.Time  `json:"continuous_since"`
+	EndedAt         *time.Time `json:"ended_at,omitempty"`
+	EndReason       string     `json:"end_reason,omitempty"`
+	Hours           float64    `json:"hours"` // within the requested range
+}
+
+// DayTotal is the time online on one UTC calendar day.
+type DayTotal struct {
+	Date        string  `json:"date"` // YYYY-MM-DD
+	OnlineHours float64 `json:"online_hours"`
+}
+
+// SessionReport is the body of GET /drivers/:id/sessions.
+type SessionReport struct {
+	DriverID   string     `json:"driver_id"`
+	From       time.Time  `json:"from"`
+	To         time.Time  `json:"to"`
+	Online     bool       `json:"online"`
+	TotalHours float64    `json:"total_hours"`
+	Days       []DayTotal `json:"days"`
+	Sessions   []Session  `json:"sessions"`
 }
 
 // LoginRequest is the body for POST /drivers/login.
 type LoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required,format=email"`
+	Password string `json:"password" validate:"required"`
+	// OTP is the authenticator or backup code of an account with
+	// two-factor authentication.
+	OTP string `json:"otp,omitempty"`
 }
 
 // LocationUpdate is the body for PATCH /drivers/:id/location.
 type LocationUpdate struct {
-	Lat float64 `json:"lat"`
-	Lng float64 `json:"lng"`
+	Lat float64 `json:"lat" validate:"required,min=-90,max=90"`
+	Lng float64 `json:"lng" validate:"required,min=-180,max=180"`
+}
+
+// VehicleUpdate is the body for PATCH /drivers/:id/vehicle (the active
+// vehicle) and PATCH /drivers/:id/vehicles/:vehicleID. Omitted fields are
+// left unchanged.
+type VehicleUpdate struct {
+	Model         *string   `json:"vehicle_model,omitempty" validate:"maxLength=100"`
+	Color         *string   `json:"vehicle_color,omitempty" validate:"maxLength=50"`
+	LicensePlate  *string   `json:"license_plate,omitempty" validate:"maxLength=20"`
+	Type          *string   `json:"vehicle_type,omitempty" validate:"maxLength=50"`
+	Capacity      *int      `json:"capacity,omitempty" validate:"min=1,max=8"`
+	Year          *int      `json:"year,omitempty" validate:"min=1980"`
+	Accessibility *[]string `json:"accessibility,omitempty" validate:"maxItems=4"`
+	ChildSeats    *int      `json:"child_seats,omitempty" validate:"min=0,max=3"`
+	LuggageLitres *int      `json:"luggage_litres,omitempty" validate:"min=0,max=2000"`
+}
+
+// UpdateProfileRequest is the body for PATCH /drivers/:id. Omitted fields
+// are left unchanged. Email and phone changes wait for a verification code
+// sent to the new address; a new password needs the current one.
+type UpdateProfileRequest struct {
+	Name            *string `json:"name,omitempty" validate:"minLength=2,maxLength=200"`
+	Email           *string `json:"email,omitempty" validate:"format=email,maxLength=200"`
+	Phone           *string `json:"phone,omitempty" validate:"maxLength=30"`
+	Country         *string `json:"country,omitempty" validate:"minLength=2,maxLength=2"` // for phone; defaults to the account's
+	Password        *string `json:"password,omitempty" validate:"minLength=6,maxLength=100"`
+	CurrentPassword string  `json:"current_password,omitempty"`
+}
+
+// ProfileResponse is returned by PATCH /drivers/:id.
+type ProfileResponse struct {
+	Driver *Driver `json:"driver"`
+	// Pending lists the fields ("email", "phone") awaiting a code.
+	Pending []string `json:"pending_verification,omitempty"`
+	// Token replaces the tokens revoked by a password change.
+	Token string `json:"token,omitempty"`
+}
+
+// VerifyRequest is the body for POST /drivers/:id/verify.
+type VerifyRequest struct {
+	Field string `json:"field" validate:"required"` // email | phone
+	Code  string `json:"code" validate:"required,minLength=6,maxLength=6"`
+}
+
+// Profile holds account columns to change; nil fields are left as they are.
+type Profile struct {
+	Name, Email, Phone, Country, PasswordHash *string
+}
+
+// DeviceRequest is the body for POST /drivers/:id/devices.
+type DeviceRequest struct {
+	Label string `json:"label" validate:"maxLength=100"`
+}
+
+// DeviceRegistration is returned once when a device is registered. The key is
+// never shown again; the app keeps it to sign offline trip completions.
+type DeviceRegistration struct {
+	DeviceID string `json:"device_id"`
+	Key      string `json:"key"` // base64 (std) encoded HMAC-SHA256 key
 }
 
 // AuthResponse is returned on register / login.
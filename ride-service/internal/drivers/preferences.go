@@ -0,0 +1,247 @@
+package drivers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"ride-service/internal/events"
+	"ride-service/pkg/apierror"
+)
+
+// ErrInvalidPreferences is returned for a PATCH /drivers/:id/preferences the
+// service cannot store.
+var ErrInvalidPreferences = apierror.Validation("invalid preferences")
+
+// Limits on what a driver can store.
+const (
+	MaxShifts      = 14
+	MaxAreas       = 10
+	MaxAreaKm      = 50.0
+	MaxWindDownMin = 180
+)
+
+// weekdays are the day names shifts use, Sunday first like time.Weekday.
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// Preferences are a driver's working hours and areas, and when the matcher
+// should only offer them trips that head home.
+type Preferences struct {
+	TimeZone string  `json:"time_zone"` // IANA; shift times are local to it
+	Shifts   []Shift `json:"shifts"`
+	Areas    []Area  `json:"areas"` // where the driver prefers to work
+	Home     *Area   `json:"home,omitempty"`
+	// WindDownMinutes before a shift ends the driver is winding down: only
+	// trips that drop off within the home area are offered. Needs Home.
+	WindDownMinutes int `json:"wind_down_minutes"`
+	// GoHome winds the driver down now, whatever the shifts say.
+	GoHome bool `json:"go_home"`
+	// WindingDown says whether the matcher is currently holding the driver
+	// to trips towards home.
+	WindingDown bool       `json:"winding_down"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+}
+
+// Shift is a weekly working window. End before Start runs past midnight
+// into the next day; Days are the days it starts on.
+type Shift struct {
+	Days  []string `json:"days" validate:"required,maxItems=7"`   // sun … sat
+	Start string   `json:"start" validate:"required,maxLength=5"` // HH:MM
+	End   string   `json:"end" validate:"required,maxLength=5"`   // HH:MM
+}
+
+// Area is a circle on the map.
+type Area struct {
+	Name     string  `json:"name,omitempty" validate:"maxLength=100"`
+	Lat      float64 `json:"lat" validate:"min=-90,max=90"`
+	Lng      float64 `json:"lng" validate:"min=-180,max=180"`
+	RadiusKm float64 `json:"radius_km" validate:"min=0,max=50"`
+}
+
+// PreferencesUpdate is the body for PATCH /drivers/:id/preferences. Omitted
+// fields are left unchanged; a home with a zero radius removes it.
+type PreferencesUpdate struct {
+	TimeZone        *string  `json:"time_zone,omitempty" validate:"maxLength=64"`
+	Shifts          *[]Shift `json:"shifts,omitempty" validate:"maxItems=14"`
+	Areas           *[]Area  `json:"areas,omitempty" validate:"maxItems=10"`
+	Home            *Area    `json:"home,omitempty"`
+	WindDownMinutes *int     `json:"wind_down_minutes,omitempty" validate:"min=0,max=180"`
+	GoHome          *bool    `json:"go_home,omitempty"`
+}
+
+// defaultPreferences are what a driver who never set any has.
+func defaultPreferences() Preferences {
+	return Preferences{TimeZone: "UTC", Shifts: []Shift{}, Areas: []Area{}}
+}
+
+// Preferences returns the driver's preferences.
+func (s *Service) Preferences(ctx context.Context, driverID string) (*Preferences, error) {
+	if _, err := s.GetByID(ctx, driverID); err != nil {
+		return nil, err
+	}
+	stored, err := s.repo.Preferences(ctx, []string{driverID})
+	if err != nil {
+		return nil, err
+	}
+	p, ok := stored[driverID]
+	if !ok {
+		p = defaultPreferences()
+	}
+	p.WindingDown = p.windingDown(time.Now())
+	return &p, nil
+}
+
+// UpdatePreferences applies upd to the driver's preferences.
+func (s *Service) UpdatePreferences(ctx context.Context, driverID string, upd PreferencesUpdate) (*Preferences, error) {
+	p, err := s.Preferences(ctx, driverID)
+	if err != nil {
+		return nil, err
+	}
+	if upd.TimeZone != nil {
+		p.TimeZone = strings.TrimSpace(*upd.TimeZone)
+	}
+	if upd.Shifts != nil {
+		p.Shifts = *upd.Shifts
+	}
+	if upd.Areas != nil {
+		p.Areas = *upd.Areas
+	}
+	if upd.Home != nil {
+		p.Home = upd.Home
+		if upd.Home.RadiusKm == 0 {
+			p.Home = nil
+		}
+	}
+	if upd.WindDownMinutes != nil {
+		p.WindDownMinutes = *upd.WindDownMinutes
+	}
+	if upd.GoHome != nil {
+		p.GoHome = *upd.GoHome
+	}
+	if err := p.check(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPreferences, err)
+	}
+	if err := s.repo.SavePreferences(ctx, driverID, p); err != nil {
+		return nil, err
+	}
+	return s.Preferences(ctx, driverID)
+}
+
+func (p *Preferences) check() error {
+	if _, err := time.LoadLocation(p.TimeZone); err != nil || p.TimeZone == "" {
+		return fmt.Errorf("unknown time zone %q", p.TimeZone)
+	}
+	if len(p.Shifts) > MaxShifts {
+		return fmt.Errorf("at most %d shifts", MaxShifts)
+	}
+	for i := range p.Shifts {
+		sh := &p.Shifts[i]
+		if len(sh.Days) == 0 {
+			return errors.New("a shift needs at least one day")
+		}
+		for j, d := range sh.Days {
+			sh.Days[j] = strings.ToLower(strings.TrimSpace(d))
+			if !slices.Contains(weekdays, sh.Days[j]) {
+				return fmt.Errorf("unknown day %q (use sun … sat)", d)
+			}
+		}
+		start, err1 := clock(sh.Start)
+		end, err2 := clock(sh.End)
+		if err1 != nil || err2 != nil {
+			return errors.New("shift start and end are HH:MM")
+		}
+		if start == end {
+			return errors.New("a shift cannot start and end at the same time")
+		}
+	}
+	if len(p.Areas) > MaxAreas {
+		return fmt.Errorf("at most %d areas", MaxAreas)
+	}
+	for _, a := range p.Areas {
+		if err := a.check(); err != nil {
+			return err
+		}
+	}
+	if p.Home != nil {
+		if err := p.Home.check(); err != nil {
+			return fmt.Errorf("home: %w", err)
+		}
+	}
+	if p.WindDownMinutes < 0 || p.WindDownMinutes > MaxWindDownMin {
+		return fmt.Errorf("wind_down_minutes must be between 0 and %d", MaxWindDownMin)
+	}
+	if (p.WindDownMinutes > 0 || p.GoHome) && p.Home == nil {
+		return errors.New("winding down needs a home area")
+	}
+	return nil
+}
+
+func (a Area) check() error {
+	if a.Lat < -90 || a.Lat > 90 || a.Lng < -180 || a.Lng > 180 {
+		return errors.New("area coordinates out of range")
+	}
+	if a.RadiusKm <= 0 || a.RadiusKm > MaxAreaKm {
+		return fmt.Errorf("area radius must be above 0 and at most %g km", MaxAreaKm)
+	}
+	return nil
+}
+
+// clock parses HH:MM into minutes after midnight.
+func clock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// windingDown reports whether the driver is going home at now: by choice,
+// or within WindDownMinutes of the end of a shift they are in.
+func (p *Preferences) windingDown(now time.Time) bool {
+	if p.Home == nil {
+		return false
+	}
+	if p.GoHome {
+		return true
+	}
+	if p.WindDownMinutes == 0 {
+		return false
+	}
+	loc, err := time.LoadLocation(p.TimeZone)
+	if err != nil {
+		return false
+	}
+	now = now.In(loc)
+	mins := now.Hour()*60 + now.Minute()
+	today := weekdays[now.Weekday()]
+	yesterday := weekdays[(now.Weekday()+6)%7]
+	for _, sh := range p.Shifts {
+		start, _ := clock(sh.Start)
+		end, _ := clock(sh.End)
+		// Minutes left until the shift ends, if it is running now.
+		left := -1
+		switch {
+		case start < end && slices.Contains(sh.Days, today) && mins >= start && mins < end:
+			left = end - mins
+		case start > end && slices.Contains(sh.Days, today) && mins >= start:
+			left = 24*60 - mins + end
+		case start > end && slices.Contains(sh.Days, yesterday) && mins < end:
+			left = end - mins
+		}
+		if left >= 0 && left <= p.WindDownMinutes {
+			return true
+		}
+	}
+	return false
+}
+
+// goHome is what the matcher needs to know about a winding-down driver.
+func (p *Preferences) goHome(now time.Time) *events.GoHome {
+	if !p.windingDown(now) {
+		return nil
+	}
+	return &events.GoHome{Lat: p.Home.Lat, Lng: p.Home.Lng, RadiusKm: p.Home.RadiusKm}
+}
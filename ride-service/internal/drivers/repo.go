@@ -0,0 +1,625 @@
+package drivers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/internal/events"
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/db"
+	"ride-service/pkg/pii"
+)
+
+var (
+	ErrNotFound       = apierror.NotFound("driver not found")
+	ErrDeviceNotFound = apierror.NotFound("device not found")
+	ErrNoSession      = apierror.Conflict("driver is not online")
+	// ErrDeleted is returned when acting on a deactivated account.
+	ErrDeleted = apierror.NotFound("account is deactivated")
+
+	ErrEmailTaken    = apierror.Conflict("email already exists")
+	ErrPhoneTaken    = apierror.Conflict("phone already exists")
+	ErrWrongPassword = apierror.Forbidden("current password is incorrect")
+)
+
+// DriverRepo persists driver accounts and their signing devices.
+type DriverRepo interface {
+	EmailTaken(ctx context.Context, email string) (bool, error)
+	PhoneTaken(ctx context.Context, phone string) (bool, error)
+	// Create inserts d with v as its active vehicle.
+	Create(ctx context.Context, d *Driver, v *Vehicle) error
+	// GetByEmail includes PasswordHash and skips deactivated accounts;
+	// GetByID leaves the hash empty and returns deactivated accounts too.
+	GetByEmail(ctx context.Context, email string) (*Driver, error)
+	GetByID(ctx context.Context, id string) (*Driver, error)
+	// List returns one page of active drivers matching f, best rated first,
+	// and the number of matches across all pages.
+	List(ctx context.Context, f ListFilter) ([]Driver, int, error)
+	// SoftDelete sets deleted_at and Restore clears it; both return
+	// ErrNotFound unless the account exists in the opposite state.
+	SoftDelete(ctx context.Context, id string) error
+	Restore(ctx context.Context, id string) error
+	// PasswordHash returns the hash of an active account.
+	PasswordHash(ctx context.Context, id string) (string, error)
+	// UpdateProfile writes p to an active account, returning ErrNotFound if
+	// there is none and ErrEmailTaken/ErrPhoneTaken on a uniqueness clash.
+	UpdateProfile(ctx context.Context, id string, p Profile) error
+	SetStatus(ctx context.Context, id, status string) error
+	// SwapStatus sets the status to to if it is from, reporting whether it
+	// was.
+	SwapStatus(ctx context.Context, id, from, to string) (bool, error)
+
+	// Vehicles returns the driver's vehicles, oldest first.
+	Vehicles(ctx context.Context, driverID string) ([]Vehicle, error)
+	// AddVehicle inserts v, making it the active vehicle if the driver has none.
+	AddVehicle(ctx context.Context, v *Vehicle) error
+	UpdateVehicle(ctx context.Context, v *Vehicle) error
+	SetPhotoKey(ctx context.Context, driverID, vehicleID, key string) error
+	// RemoveVehicle and SetActiveVehicle return ErrVehicleNotFound unless
+	// the vehicle is the driver's.
+	RemoveVehicle(ctx context.Context, driverID, vehicleID string) error
+	SetActiveVehicle(ctx context.Context, driverID, vehicleID string) error
+
+	CreateDevice(ctx context.Context, id, driverID string, secret []byte, label string) error
+	RevokeDevice(ctx context.Context, driverID, deviceID string) error
+	// DeviceKey returns the secret of an unrevoked device.
+	DeviceKey(ctx context.Context, driverID, deviceID string) ([]byte, error)
+
+	// OpenSession inserts s unless the driver already has an open session,
+	// in which case it reports false.
+	OpenSession(ctx context.Context, s *Session) (bool, error)
+	// ActiveSession and LastSession return ErrNoSession when there is none.
+	ActiveSession(ctx context.Context, driverID string) (*Session, error)
+	LastSession(ctx context.Context, driverID string) (*Session, error)
+	CloseSession(ctx context.Context, driverID string, at time.Time, reason string) (*Session, error)
+	// Sessions returns sessions overlapping [from, to), oldest first.
+	Sessions(ctx context.Context, driverID string, from, to time.Time) ([]Session, error)
+	// OverdueSessions returns open sessions whose run began before since.
+	OverdueSessions(ctx context.Context, since time.Time) ([]Session, error)
+
+	// OfferCounts tallies the answered trip offers of driverIDs made since
+	// then. Drivers without any are left out; rates are not filled in.
+	OfferCounts(ctx context.Context, driverIDs []string, since time.Time) (map[string]Scores, error)
+	// CandidateStats returns the rating, vehicle type and last completed trip
+	// of driverIDs for the matcher. Rates are left for the caller to fill in.
+	CandidateStats(ctx context.Context, driverIDs []string) (map[string]events.DriverStats, error)
+
+	// Preferences returns the stored preferences of driverIDs; drivers who
+	// never saved any are left out.
+	Preferences(ctx context.Context, driverIDs []string) (map[string]Preferences, error)
+	SavePreferences(ctx context.Context, driverID string, p *Preferences) error
+}
+
+type pgRepo struct {
+	db     *pgxpool.Pool
+	reads  *db.Router  // GetByID, List and Vehicles may use a replica
+	cipher *pii.Cipher // email and phone are stored encrypted
+}
+
+// NewPostgresRepo returns a DriverRepo backed by the drivers, vehicles and
+// driver_devices tables.
+func NewPostgresRepo(router *db.Router, cipher *pii.Cipher) DriverRepo {
+	return &pgRepo{db: router.Primary(), reads: router, cipher: cipher}
+}
+
+// columns are read from driversFrom: the driver and their active vehicle.
+const columns = `d.id,d.name,d.email,d.phone,d.country,COALESCE(d.city,''),d.gender,d.active_vehicle_id,
+		        COALESCE(v.type,''),COALESCE(v.plate,''),COALESCE(v.model,''),COALESCE(v.color,''),COALESCE(v.photo_key,''),
+		        d.status,d.rating,d.verified_at,d.background_check,d.created_at,d.deleted_at`
+
+const driversFrom = ` FROM drivers d LEFT JOIN vehicles v ON v.id = d.active_vehicle_id`
+
+const vehicleColumns = `v.id,v.driver_id,v.type,v.capacity,v.plate,v.year,v.model,v.color,v.accessibility,
+		        v.child_seats,v.luggage_litres,COALESCE(v.photo_key,''),(v.id = d.active_vehicle_id) IS TRUE,v.created_at`
+
+// EmailTaken and PhoneTaken match the blind index, or the plaintext of a
+// row not yet encrypted.
+func (r *pgRepo) EmailTaken(ctx context.Context, email string) (bool, error) {
+	var exists bool
+	err := r.db.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM drivers WHERE email_idx=$1 OR email=$2)",
+		r.cipher.Index(pii.Email, email), email).Scan(&exists)
+	return exists, err
+}
+
+func (r *pgRepo) PhoneTaken(ctx context.Context, phone string) (bool, error) {
+	var exists bool
+	err := r.db.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM drivers WHERE phone_idx=$1 OR phone=$2)",
+		r.cipher.Index(pii.Phone, phone), phone).Scan(&exists)
+	return exists, err
+}
+
+func (r *pgRepo) Create(ctx context.Context, d *Driver, v *Vehicle) error {
+	email, emailIdx, err := r.cipher.Seal(pii.Email, d.Email)
+	if err != nil {
+		return err
+	}
+	phone, phoneIdx, err := r.cipher.Seal(pii.Phone, d.Phone)
+	if err != nil {
+		return err
+	}
+	return db.WithTx(ctx, r.db, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx,
+			`INSERT INTO drivers (id,name,email,phone,email_idx,phone_idx,country,city,password_hash,status,rating,gender)
+			 VALUES ($1,$2,$3,$4,$5,$6,$7,NULLIF($8,''),$9,$10,$11,$12) RETURNING created_at`,
+			d.ID, d.Name, email, phone, emailIdx, phoneIdx, d.Country, d.City, d.PasswordHash, d.Status, d.Rating, d.Gender).
+			Scan(&d.CreatedAt)
+		if err != nil {
+			return err
+		}
+		if err := insertVehicle(ctx, tx, v); err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `UPDATE drivers SET active_vehicle_id=$1 WHERE id=$2`, v.ID, d.ID)
+		return err
+	})
+}
+
+func (r *pgRepo) GetByEmail(ctx context.Context, email string) (*Driver, error) {
+	var hash string
+	d, err := r.scanDriver(r.db.QueryRow(ctx,
+		`SELECT `+columns+`,d.password_hash`+driversFrom+` WHERE (d.email_idx=$1 OR d.email=$2) AND d.deleted_at IS NULL`,
+		r.cipher.Index(pii.Email, email), email), &hash)
+	if err != nil {
+		return nil, err
+	}
+	d.PasswordHash = hash
+	return d, nil
+}
+
+func (r *pgRepo) GetByID(ctx context.Context, id string) (*Driver, error) {
+	return r.scanDriver(r.reads.Reader(ctx).QueryRow(ctx, `SELECT `+columns+driversFrom+` WHERE d.id=$1`, id))
+}
+
+func (r *pgRepo) List(ctx context.Context, f ListFilter) ([]Driver, int, error) {
+	where := []string{"d.deleted_at IS NULL"}
+	var args []any
+	add := func(cond string, v any) {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	if f.Status != "" {
+		add("d.status=$%d", f.Status)
+	}
+	if f.VehicleType != "" {
+		add("v.type=$%d", f.VehicleType)
+	}
+	if f.City != "" {
+		add("lower(d.city)=lower($%d)", f.City)
+	}
+	if f.MinRating != nil {
+		add("d.rating>=$%d", *f.MinRating)
+	}
+	if f.MaxRating != nil {
+		add("d.rating<=$%d", *f.MaxRating)
+	}
+	if f.Query != "" {
+		add("(d.name ILIKE $%[1]d OR v.plate ILIKE $%[1]d)", "%"+escapeLike(f.Query)+"%")
+	}
+	cond := ` WHERE ` + strings.Join(where, " AND ")
+	page := append(args, f.Limit, f.Offset)
+	pool := r.reads.Reader(ctx)
+	rows, err := pool.Query(ctx,
+		`SELECT `+columns+`,COUNT(*) OVER()`+driversFrom+cond+
+			fmt.Sprintf(` ORDER BY d.rating DESC, d.created_at, d.id LIMIT $%d OFFSET $%d`, len(page)-1, len(page)),
+		page...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	out := []Driver{}
+	total := 0
+	for rows.Next() {
+		d, err := r.scanDriver(rows, &total)
+		if err != nil {
+			return nil, 0, err
+		}
+		out = append(out, *d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	// Past the last page there is no row to carry the window count.
+	if len(out) == 0 && f.Offset > 0 {
+		err = pool.QueryRow(ctx, `SELECT COUNT(*)`+driversFrom+cond, args...).Scan(&total)
+	}
+	return out, total, err
+}
+
+func (r *pgRepo) SoftDelete(ctx context.Context, id string) error {
+	return r.setDeleted(ctx, `UPDATE drivers SET deleted_at=NOW(), status='offline' WHERE id=$1 AND deleted_at IS NULL`, id)
+}
+
+func (r *pgRepo) Restore(ctx context.Context, id string) error {
+	return r.setDeleted(ctx, `UPDATE drivers SET deleted_at=NULL WHERE id=$1 AND deleted_at IS NOT NULL`, id)
+}
+
+func (r *pgRepo) setDeleted(ctx context.Context, query, id string) error {
+	tag, err := r.db.Exec(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// escapeLike makes s match literally inside an ILIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+func (r *pgRepo) PasswordHash(ctx context.Context, id string) (string, error) {
+	var hash string
+	err := r.db.QueryRow(ctx, `SELECT password_hash FROM drivers WHERE id=$1 AND deleted_at IS NULL`, id).Scan(&hash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	return hash, err
+}
+
+func (r *pgRepo) UpdateProfile(ctx context.Context, id string, p Profile) error {
+	email, emailIdx, err := r.cipher.SealOptional(pii.Email, p.Email)
+	if err != nil {
+		return err
+	}
+	phone, phoneIdx, err := r.cipher.SealOptional(pii.Phone, p.Phone)
+	if err != nil {
+		return err
+	}
+	tag, err := r.db.Exec(ctx,
+		`UPDATE drivers SET name=COALESCE($1,name), email=COALESCE($2,email), phone=COALESCE($3,phone),
+		                    email_idx=COALESCE($4,email_idx), phone_idx=COALESCE($5,phone_idx),
+		                    country=COALESCE($6,country), password_hash=COALESCE($7,password_hash)
+		 WHERE id=$8 AND deleted_at IS NULL`,
+		p.Name, email, phone, emailIdx, phoneIdx, p.Country, p.PasswordHash, id)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" { // unique violation
+		if pgErr.ConstraintName == "drivers_phone_idx_key" {
+			return ErrPhoneTaken
+		}
+		return ErrEmailTaken
+	}
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *pgRepo) Vehicles(ctx context.Context, driverID string) ([]Vehicle, error) {
+	rows, err := r.reads.Reader(ctx).Query(ctx,
+		`SELECT `+vehicleColumns+` FROM vehicles v JOIN drivers d ON d.id = v.driver_id
+		 WHERE v.driver_id=$1 ORDER BY v.created_at, v.id`, driverID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Vehicle{}
+	for rows.Next() {
+		var v Vehicle
+		if err := rows.Scan(&v.ID, &v.DriverID, &v.Type, &v.Capacity, &v.LicensePlate, &v.Year, &v.Model, &v.Color,
+			&v.Accessibility, &v.ChildSeats, &v.LuggageLitres, &v.PhotoKey, &v.Active, &v.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+func (r *pgRepo) AddVehicle(ctx context.Context, v *Vehicle) error {
+	return db.WithTx(ctx, r.db, func(tx pgx.Tx) error {
+		if err := insertVehicle(ctx, tx, v); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx,
+			`UPDATE drivers SET active_vehicle_id=$1 WHERE id=$2 AND active_vehicle_id IS NULL`, v.ID, v.DriverID)
+		return err
+	})
+}
+
+func insertVehicle(ctx context.Context, tx pgx.Tx, v *Vehicle) error {
+	return tx.QueryRow(ctx,
+		`INSERT INTO vehicles (id,driver_id,type,capacity,plate,year,model,color,accessibility,child_seats,luggage_litres)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11) RETURNING created_at`,
+		v.ID, v.DriverID, v.Type, v.Capacity, v.LicensePlate, v.Year, v.Model, v.Color, v.Accessibility,
+		v.ChildSeats, v.LuggageLitres).
+		Scan(&v.CreatedAt)
+}
+
+func (r *pgRepo) UpdateVehicle(ctx context.Context, v *Vehicle) error {
+	tag, err := r.db.Exec(ctx,
+		`UPDATE vehicles SET type=$1, capacity=$2, plate=$3, year=$4, model=$5, color=$6, accessibility=$7,
+		        child_seats=$8, luggage_litres=$9
+		 WHERE id=$10 AND driver_id=$11`,
+		v.Type, v.Capacity, v.LicensePlate, v.Year, v.Model, v.Color, v.Accessibility,
+		v.ChildSeats, v.LuggageLitres, v.ID, v.DriverID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrVehicleNotFound
+	}
+	return nil
+}
+
+func (r *pgRepo) SetPhotoKey(ctx context.Context, driverID, vehicleID, key string) error {
+	tag, err := r.db.Exec(ctx, `UPDATE vehicles SET photo_key=$1 WHERE id=$2 AND driver_id=$3`, key, vehicleID, driverID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrVehicleNotFound
+	}
+	return nil
+}
+
+func (r *pgRepo) RemoveVehicle(ctx context.Context, driverID, vehicleID string) error {
+	tag, err := r.db.Exec(ctx,
+		`DELETE FROM vehicles v USING drivers d
+		 WHERE v.id=$1 AND v.driver_id=$2 AND d.id = v.driver_id AND d.active_vehicle_id IS DISTINCT FROM v.id`,
+		vehicleID, driverID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrVehicleNotFound
+	}
+	return nil
+}
+
+func (r *pgRepo) SetActiveVehicle(ctx context.Context, driverID, vehicleID string) error {
+	tag, err := r.db.Exec(ctx,
+		`UPDATE drivers SET active_vehicle_id=$1
+		 WHERE id=$2 AND EXISTS (SELECT 1 FROM vehicles WHERE id=$1 AND driver_id=$2)`, vehicleID, driverID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrVehicleNotFound
+	}
+	return nil
+}
+
+func (r *pgRepo) SwapStatus(ctx context.Context, id, from, to string) (bool, error) {
+	tag, err := r.db.Exec(ctx, `UPDATE drivers SET status=$1 WHERE id=$2 AND status=$3`, to, id, from)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *pgRepo) SetStatus(ctx context.Context, id, status string) error {
+	tag, err := r.db.Exec(ctx, `UPDATE drivers SET status=$1 WHERE id=$2`, status, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *pgRepo) CreateDevice(ctx context.Context, id, driverID string, secret []byte, label string) error {
+	_, err := r.db.Exec(ctx,
+		`INSERT INTO driver_devices (id,driver_id,secret,label) VALUES ($1,$2,$3,$4)`,
+		id, driverID, secret, label)
+	return err
+}
+
+func (r *pgRepo) RevokeDevice(ctx context.Context, driverID, deviceID string) error {
+	tag, err := r.db.Exec(ctx,
+		`UPDATE driver_devices SET revoked_at=NOW()
+		 WHERE id=$1 AND driver_id=$2 AND revoked_at IS NULL`, deviceID, driverID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrDeviceNotFound
+	}
+	return nil
+}
+
+func (r *pgRepo) DeviceKey(ctx context.Context, driverID, deviceID string) ([]byte, error) {
+	var key []byte
+	err := r.db.QueryRow(ctx,
+		`SELECT secret FROM driver_devices
+		 WHERE id=$1 AND driver_id=$2 AND revoked_at IS NULL`, deviceID, driverID).Scan(&key)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDeviceNotFound
+	}
+	return key, err
+}
+
+const sessionColumns = `id,driver_id,started_at,continuous_since,ended_at,COALESCE(end_reason,'')`
+
+func (r *pgRepo) OpenSession(ctx context.Context, s *Session) (bool, error) {
+	tag, err := r.db.Exec(ctx,
+		`INSERT INTO driver_sessions (id,driver_id,started_at,continuous_since) VALUES ($1,$2,$3,$4)
+		 ON CONFLICT (driver_id) WHERE ended_at IS NULL DO NOTHING`,
+		s.ID, s.DriverID, s.StartedAt, s.ContinuousSince)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && (pgErr.Code == "23503" || pgErr.Code == "22P02") { // FK violation / malformed uuid
+		return false, ErrNotFound
+	}
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func (r *pgRepo) ActiveSession(ctx context.Context, driverID string) (*Session, error) {
+	return scanSession(r.db.QueryRow(ctx,
+		`SELECT `+sessionColumns+` FROM driver_sessions WHERE driver_id=$1 AND ended_at IS NULL`, driverID))
+}
+
+func (r *pgRepo) LastSession(ctx context.Context, driverID string) (*Session, error) {
+	return scanSession(r.db.QueryRow(ctx,
+		`SELECT `+sessionColumns+` FROM driver_sessions
+		 WHERE driver_id=$1 AND ended_at IS NOT NULL ORDER BY ended_at DESC LIMIT 1`, driverID))
+}
+
+func (r *pgRepo) CloseSession(ctx context.Context, driverID string, at time.Time, reason string) (*Session, error) {
+	return scanSession(r.db.QueryRow(ctx,
+		`UPDATE driver_sessions SET ended_at=$1, end_reason=$2
+		 WHERE driver_id=$3 AND ended_at IS NULL RETURNING `+sessionColumns,
+		at, reason, driverID))
+}
+
+func (r *pgRepo) Sessions(ctx context.Context, driverID string, from, to time.Time) ([]Session, error) {
+	return r.querySessions(ctx,
+		`SELECT `+sessionColumns+` FROM driver_sessions
+		 WHERE driver_id=$1 AND started_at < $3 AND (ended_at IS NULL OR ended_at > $2)
+		 ORDER BY started_at`, driverID, from, to)
+}
+
+func (r *pgRepo) OverdueSessions(ctx context.Context, since time.Time) ([]Session, error) {
+	return r.querySessions(ctx,
+		`SELECT `+sessionColumns+` FROM driver_sessions WHERE ended_at IS NULL AND continuous_since <= $1`, since)
+}
+
+func (r *pgRepo) OfferCounts(ctx context.Context, driverIDs []string, since time.Time) (map[string]Scores, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT driver_id::text,
+		        COUNT(*) FILTER (WHERE status IN ('accepted','cancelled')),
+		        COUNT(*) FILTER (WHERE status = 'declined'),
+		        COUNT(*) FILTER (WHERE status = 'cancelled')
+		 FROM driver_offers
+		 WHERE driver_id = ANY($1::uuid[]) AND offered_at >= $2 AND status <> 'pending'
+		 GROUP BY driver_id`, driverIDs, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[string]Scores{}
+	for rows.Next() {
+		var id string
+		var sc Scores
+		if err := rows.Scan(&id, &sc.Accepted, &sc.Declined, &sc.Cancelled); err != nil {
+			return nil, err
+		}
+		sc.Offers = sc.Accepted + sc.Declined
+		out[id] = sc
+	}
+	return out, rows.Err()
+}
+
+func (r *pgRepo) CandidateStats(ctx context.Context, driverIDs []string) (map[string]events.DriverStats, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT d.id::text, d.rating, d.gender, COALESCE(v.type,''), COALESCE(v.capacity,0), COALESCE(v.accessibility,'{}'),
+		        COALESCE(v.child_seats,0), COALESCE(v.luggage_litres,0),
+		        (SELECT MAX(t.completed_at) FROM trips t WHERE t.driver_id = d.id AND t.status = 'COMPLETED')
+		`+driversFrom+` WHERE d.id = ANY($1::uuid[])`, driverIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[string]events.DriverStats{}
+	for rows.Next() {
+		var id string
+		var st events.DriverStats
+		if err := rows.Scan(&id, &st.Rating, &st.Gender, &st.VehicleType, &st.Capacity, &st.Accessibility,
+			&st.ChildSeats, &st.LuggageLitres, &st.LastTripAt); err != nil {
+			return nil, err
+		}
+		out[id] = st
+	}
+	return out, rows.Err()
+}
+
+func (r *pgRepo) Preferences(ctx context.Context, driverIDs []string) (map[string]Preferences, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT driver_id::text, time_zone, shifts, areas, home, wind_down_minutes, go_home, updated_at
+		 FROM driver_preferences WHERE driver_id = ANY($1::uuid[])`, driverIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[string]Preferences{}
+	for rows.Next() {
+		var id string
+		var p Preferences
+		if err := rows.Scan(&id, &p.TimeZone, &p.Shifts, &p.Areas, &p.Home, &p.WindDownMinutes, &p.GoHome, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		out[id] = p
+	}
+	return out, rows.Err()
+}
+
+func (r *pgRepo) SavePreferences(ctx context.Context, driverID string, p *Preferences) error {
+	_, err := r.db.Exec(ctx,
+		`INSERT INTO driver_preferences (driver_id,time_zone,shifts,areas,home,wind_down_minutes,go_home,updated_at)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7,NOW())
+		 ON CONFLICT (driver_id) DO UPDATE SET time_zone=$2, shifts=$3, areas=$4, home=$5,
+		     wind_down_minutes=$6, go_home=$7, updated_at=NOW()`,
+		driverID, p.TimeZone, p.Shifts, p.Areas, p.Home, p.WindDownMinutes, p.GoHome)
+	return err
+}
+
+func (r *pgRepo) querySessions(ctx context.Context, query string, args ...any) ([]Session, error) {
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Session{}
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *s)
+	}
+	return out, rows.Err()
+}
+
+func scanSession(row pgx.Row) (*Session, error) {
+	var s Session
+	err := row.Scan(&s.ID, &s.DriverID, &s.StartedAt, &s.ContinuousSince, &s.EndedAt, &s.EndReason)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNoSession
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// scanDriver reads columns, followed by any extra destinations, and
+// decrypts the email and phone.
+func (r *pgRepo) scanDriver(row pgx.Row, extra ...any) (*Driver, error) {
+	var d Driver
+	dest := append([]any{&d.ID, &d.Name, &d.Email, &d.Phone, &d.Country, &d.City, &d.Gender, &d.ActiveVehicleID,
+		&d.VehicleType, &d.LicensePlate, &d.VehicleModel, &d.VehicleColor, &d.PhotoKey,
+		&d.Status, &d.Rating, &d.VerifiedAt, &d.BackgroundCheck, &d.CreatedAt, &d.DeletedAt}, extra...)
+	err := row.Scan(dest...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if d.Email, err = r.cipher.Decrypt(pii.Email, d.Email); err != nil {
+		return nil, err
+	}
+	if d.Phone, err = r.cipher.Decrypt(pii.Phone, d.Phone); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
@@ -0,0 +1,110 @@
+package drivers
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"ride-service/internal/events"
+)
+
+// Scores computes the driver's acceptance and cancellation rates over the
+// rolling score window.
+func (s *Service) Scores(ctx context.Context, driverID string) (*Scores, error) {
+	counts, err := s.repo.OfferCounts(ctx, []string{driverID}, time.Now().Add(-s.cfg.ScoreWindow))
+	if err != nil {
+		return nil, err
+	}
+	sc := s.rates(counts[driverID])
+	return &sc, nil
+}
+
+// Profile is the driver with their offer scores and driving safety, as
+// shown on GET /drivers/:id.
+func (s *Service) Profile(ctx context.Context, driverID string) (*Driver, error) {
+	d, err := s.GetByID(ctx, driverID)
+	if err != nil {
+		return nil, err
+	}
+	if d.Scores, err = s.Scores(ctx, driverID); err != nil {
+		return nil, err
+	}
+	if s.safety != nil {
+		safety, err := s.safety.Safety(ctx, []string{driverID})
+		if err != nil {
+			return nil, err
+		}
+		if sf, ok := safety[driverID]; ok {
+			d.Safety = &sf
+		}
+	}
+	return d, nil
+}
+
+// CandidateStats returns what the matcher weighs about each of driverIDs.
+// Rates are set only for drivers with enough answered offers, and the
+// safety score for those with enough driving.
+func (s *Service) CandidateStats(ctx context.Context, driverIDs []string) (map[string]events.DriverStats, error) {
+	stats, err := s.repo.CandidateStats(ctx, driverIDs)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := s.repo.OfferCounts(ctx, driverIDs, time.Now().Add(-s.cfg.ScoreWindow))
+	if err != nil {
+		return nil, err
+	}
+	for id, c := range counts {
+		st, ok := stats[id]
+		if !ok {
+			continue
+		}
+		sc := s.rates(c)
+		st.AcceptanceRate, st.CancellationRate = sc.AcceptanceRate, sc.CancellationRate
+		stats[id] = st
+	}
+	prefs, err := s.repo.Preferences(ctx, driverIDs)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for id, p := range prefs {
+		if st, ok := stats[id]; ok {
+			st.GoHome = p.goHome(now)
+			stats[id] = st
+		}
+	}
+	if s.safety == nil {
+		return stats, nil
+	}
+	safety, err := s.safety.Safety(ctx, driverIDs)
+	if err != nil {
+		return nil, err
+	}
+	for id, sf := range safety {
+		if st, ok := stats[id]; ok {
+			st.SafetyScore = sf.Score
+			stats[id] = st
+		}
+	}
+	return stats, nil
+}
+
+// rates fills in the rates of sc once it covers ScoreMinOffers answers.
+func (s *Service) rates(sc Scores) Scores {
+	sc.WindowDays = int(s.cfg.ScoreWindow.Hours() / 24)
+	if sc.Offers < s.cfg.ScoreMinOffers {
+		return sc
+	}
+	accept := ratio(sc.Accepted, sc.Offers)
+	sc.AcceptanceRate = &accept
+	if sc.Accepted > 0 {
+		cancel := ratio(sc.Cancelled, sc.Accepted)
+		sc.CancellationRate = &cancel
+	}
+	return sc
+}
+
+// ratio is n/d rounded to three decimals.
+func ratio(n, d int) float64 {
+	return math.Round(float64(n)/float64(d)*1000) / 1000
+}
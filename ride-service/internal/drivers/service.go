@@ -1,42 +1,190 @@
 package drivers
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/base64"
 	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v5/pgxpool"
 	"golang.org/x/crypto/bcrypt"
 
+	"ride-service/internal/audit"
+	"ride-service/internal/backgroundcheck"
+	"ride-service/internal/events"
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/blob"
+	"ride-service/pkg/challenge"
+	"ride-service/pkg/config"
+	"ride-service/pkg/geo"
 	"ride-service/pkg/jwt"
+	"ride-service/pkg/lockout"
+	"ride-service/pkg/logging"
 	rredis "ride-service/pkg/redis"
+	"ride-service/pkg/validation"
+	"ride-service/pkg/verification"
 )
 
+var logger = logging.For("drivers")
+
 // Service contains driver business logic.
 type Service struct {
-	db    *pgxpool.Pool
-	redis *rredis.Client
+	repo      DriverRepo
+	redis     *rredis.Client
+	locations geo.Index
+	blobs     blob.Store
+	codes     *verification.Codes
+	audit     *audit.Service
+	watch     []LocationObserver
+	terms     TermsRecorder
+	guard     *lockout.Guard
+	twoFactor SecondFactor
+	challenge challenge.Verifier
+	safety    SafetySource
+	cfg       config.Drivers
+}
+
+// LocationObserver is told about online drivers' location updates and about
+// drivers leaving the pool. Observers handle their own errors.
+type LocationObserver interface {
+	DriverMoved(ctx context.Context, driverID string, lat, lng float64)
+	DriverLeft(ctx context.Context, driverID string)
+}
+
+// NewService creates a driver service. Positions are stored in locations;
+// codes confirms email and phone changes; deactivations and restores go to
+// auditLog. Location updates and going offline are reported to watch.
+func NewService(repo DriverRepo, redis *rredis.Client, locations geo.Index, blobs blob.Store, codes *verification.Codes, auditLog *audit.Service, cfg config.Drivers, watch ...LocationObserver) *Service {
+	return &Service{repo: repo, redis: redis, locations: locations, blobs: blobs, codes: codes, audit: auditLog, watch: watch, cfg: cfg}
+}
+
+// MaxPhotoBytes caps vehicle photo uploads.
+const MaxPhotoBytes = 5 << 20
+
+var photoExt = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+}
+
+// ErrUnsupportedPhoto is returned for uploads that are not JPEG, PNG or WebP.
+var ErrUnsupportedPhoto = apierror.New(http.StatusUnsupportedMediaType, apierror.CodeUnsupportedMediaType, "photo must be jpeg, png or webp")
+
+// ErrNotVerified is returned when an unverified driver tries to go online or
+// is picked for a trip while verification is required.
+var ErrNotVerified = apierror.Forbidden("driver documents are not verified")
+
+// ErrCheckNotPassed is returned like ErrNotVerified while background checks
+// are required and the driver's has not passed.
+var ErrCheckNotPassed = apierror.Forbidden("driver background check has not passed").WithCode("background_check_required")
+
+// ErrInvalidCredentials is returned by Login for an unknown email or a wrong
+// password alike.
+var ErrInvalidCredentials = apierror.Unauthorized("invalid credentials")
+
+// ErrInvalid is returned for listing filters that cannot be satisfied.
+var ErrInvalid = apierror.Validation("invalid request")
+
+// ErrInvalidGender is returned at registration for a gender outside
+// events.Genders.
+var ErrInvalidGender = apierror.Validation("gender must be one of " + strings.Join(events.Genders, ", ") + ", or empty")
+
+// Statuses are the values a driver's status can take.
+var Statuses = []string{"available", "busy", "offline"}
+
+// TermsRecorder validates and stores the terms a driver accepts when they
+// sign up.
+type TermsRecorder interface {
+	Check(termsVersion, privacyVersion string) error
+	Record(ctx context.Context, accountID, termsVersion, privacyVersion string) error
+}
+
+// RecordTerms sets the recorder for sign-up acceptances, which are ignored
+// until it is set. Call it before serving.
+func (s *Service) RecordTerms(t TermsRecorder) { s.terms = t }
+
+// GuardLogins sets the guard that slows down and locks repeated failed
+// logins; without it they are unlimited. Call it before serving.
+func (s *Service) GuardLogins(g *lockout.Guard) { s.guard = g }
+
+// SecondFactor checks the two-factor code given at login, passing accounts
+// that have not enabled two-factor authentication.
+type SecondFactor interface {
+	Check(ctx context.Context, accountID, code string) error
 }
 
-// NewService creates a driver service.
-func NewService(db *pgxpool.Pool, redis *rredis.Client) *Service {
-	return &Service{db: db, redis: redis}
+// RequireSecondFactor makes drivers with two-factor authentication give its
+// code at login. Call it before serving.
+func (s *Service) RequireSecondFactor(sf SecondFactor) { s.twoFactor = sf }
+
+// RequireChallenge sets the verifier of the CAPTCHA drivers solve to sign
+// up; without it none is asked for. Call it before serving.
+func (s *Service) RequireChallenge(v challenge.Verifier) { s.challenge = v }
+
+// SafetySource returns the safety of each of driverIDs that has driven in
+// the safety window; the safety service implements it.
+type SafetySource interface {
+	Safety(ctx context.Context, driverIDs []string) (map[string]Safety, error)
+}
+
+// ScoreSafety adds driving safety to profiles and candidate stats; without
+// it neither has any. Call it before serving.
+func (s *Service) ScoreSafety(src SafetySource) { s.safety = src }
+
+// checkTerms fails a sign-up naming versions other than those in force.
+func (s *Service) checkTerms(termsVersion, privacyVersion string) error {
+	if s.terms == nil || termsVersion == "" && privacyVersion == "" {
+		return nil
+	}
+	return s.terms.Check(termsVersion, privacyVersion)
+}
+
+// recordTerms stores a new driver's acceptance. A failure only means they
+// are asked again before their first trip, so it is logged.
+func (s *Service) recordTerms(ctx context.Context, accountID, termsVersion, privacyVersion string) {
+	if s.terms == nil || termsVersion == "" && privacyVersion == "" {
+		return
+	}
+	if err := s.terms.Record(ctx, accountID, termsVersion, privacyVersion); err != nil {
+		logger.Error("record terms acceptance failed", "account", accountID, "err", err)
+	}
 }
 
 // Register creates a new driver account and returns a JWT.
 func (s *Service) Register(ctx context.Context, req RegisterRequest) (*AuthResponse, error) {
-	var exists bool
-	if err := s.db.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM drivers WHERE email=$1)", req.Email).Scan(&exists); err != nil {
+	if s.challenge != nil {
+		if err := s.challenge.Verify(ctx, req.ChallengeToken, jwt.ClientIP(ctx)); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.checkTerms(req.TermsVersion, req.PrivacyVersion); err != nil {
+		return nil, err
+	}
+	// Gender is only given here: women-only matching relies on it, so a
+	// correction goes through support rather than the profile.
+	gender := strings.ToLower(strings.TrimSpace(req.Gender))
+	if gender != "" && !slices.Contains(events.Genders, gender) {
+		return nil, ErrInvalidGender
+	}
+	exists, err := s.repo.EmailTaken(ctx, req.Email)
+	if err != nil {
 		return nil, err
 	}
 	if exists {
-		return nil, errors.New("email already exists")
+		return nil, ErrEmailTaken
 	}
-	if err := s.db.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM drivers WHERE phone=$1)", req.Phone).Scan(&exists); err != nil {
+	if exists, err = s.repo.PhoneTaken(ctx, req.Phone); err != nil {
 		return nil, err
 	}
 	if exists {
-		return nil, errors.New("phone already exists")
+		return nil, ErrPhoneTaken
 	}
 
 	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
@@ -44,78 +192,492 @@ func (s *Service) Register(ctx context.Context, req RegisterRequest) (*AuthRespo
 		return nil, err
 	}
 
-	id := uuid.New().String()
 	vt := req.VehicleType
 	if vt == "" {
 		vt = "sedan"
 	}
-
-	_, err = s.db.Exec(ctx,
-		`INSERT INTO drivers (id,name,email,phone,password_hash,vehicle_type,license_plate,status,rating)
-		 VALUES ($1,$2,$3,$4,$5,$6,$7,'available',5.0)`,
-		id, req.Name, req.Email, req.Phone, string(hash), vt, req.LicensePlate)
-	if err != nil {
+	d := &Driver{
+		ID: uuid.New().String(), Name: req.Name, Email: req.Email, Phone: req.Phone, Country: req.Country,
+		City: strings.TrimSpace(req.City), Gender: gender, PasswordHash: string(hash), VehicleType: vt, LicensePlate: req.LicensePlate,
+		Status: "available", Rating: 5.0,
+	}
+	// The vehicle registered with the account is the driver's first, and active, one.
+	v := &Vehicle{ID: uuid.New().String(), DriverID: d.ID, Type: vt, Capacity: DefaultCapacity, LicensePlate: req.LicensePlate}
+	if err := v.normalize(); err != nil {
+		return nil, err
+	}
+	d.ActiveVehicleID, d.VehicleType, d.LicensePlate = &v.ID, v.Type, v.LicensePlate
+	if err := s.repo.Create(ctx, d, v); err != nil {
 		return nil, err
 	}
+	s.recordTerms(ctx, d.ID, req.TermsVersion, req.PrivacyVersion)
 
-	token, err := jwt.Generate(id, req.Email, "driver")
+	token, err := jwt.Generate(ctx, d.ID, d.Email, "driver")
 	if err != nil {
 		return nil, err
 	}
-
-	return &AuthResponse{
-		Token: token,
-		Driver: &Driver{
-			ID: id, Name: req.Name, Email: req.Email, Phone: req.Phone,
-			VehicleType: vt, LicensePlate: req.LicensePlate,
-			Status: "available", Rating: 5.0,
-		},
-	}, nil
+	return &AuthResponse{Token: token, Driver: d}, nil
 }
 
-// Login authenticates a driver and returns a JWT.
+// Login authenticates a driver and returns a JWT. Drivers' failed logins
+// are counted apart from riders', under the same policy.
 func (s *Service) Login(ctx context.Context, req LoginRequest) (*AuthResponse, error) {
-	var d Driver
-	var hash string
-	err := s.db.QueryRow(ctx,
-		`SELECT id,name,email,phone,password_hash,vehicle_type,license_plate,status,rating,created_at
-		 FROM drivers WHERE email=$1`, req.Email).
-		Scan(&d.ID, &d.Name, &d.Email, &d.Phone, &hash,
-			&d.VehicleType, &d.LicensePlate, &d.Status, &d.Rating, &d.CreatedAt)
+	account, ip := "driver:"+req.Email, jwt.ClientIP(ctx)
+	if err := s.guard.Check(ctx, account, ip); err != nil {
+		return nil, err
+	}
+	d, err := s.repo.GetByEmail(ctx, req.Email)
+	if errors.Is(err, ErrNotFound) {
+		s.loginFailed(ctx, account, ip, "")
+		return nil, ErrInvalidCredentials
+	}
 	if err != nil {
-		return nil, errors.New("invalid credentials")
+		return nil, err
 	}
-	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(req.Password)) != nil {
-		return nil, errors.New("invalid credentials")
+	if bcrypt.CompareHashAndPassword([]byte(d.PasswordHash), []byte(req.Password)) != nil {
+		s.loginFailed(ctx, account, ip, d.ID)
+		return nil, ErrInvalidCredentials
 	}
+	if s.twoFactor != nil {
+		if err := s.twoFactor.Check(ctx, d.ID, req.OTP); err != nil {
+			if req.OTP != "" {
+				s.loginFailed(ctx, account, ip, d.ID)
+			}
+			return nil, err
+		}
+	}
+	s.guard.Succeeded(ctx, account)
 
-	token, err := jwt.Generate(d.ID, d.Email, "driver")
+	token, err := jwt.Generate(ctx, d.ID, d.Email, "driver")
 	if err != nil {
 		return nil, err
 	}
-	return &AuthResponse{Token: token, Driver: &d}, nil
+	return &AuthResponse{Token: token, Driver: d}, nil
+}
+
+// loginFailed counts a failed login and audits the lockouts it caused.
+func (s *Service) loginFailed(ctx context.Context, account, ip, driverID string) {
+	out := s.guard.Failed(ctx, account, ip)
+	if out.AccountLocked {
+		target := audit.TargetDriver
+		if driverID == "" {
+			target = ""
+		}
+		s.audit.Record(ctx, audit.LoginLockout, target, driverID, nil, out)
+	}
+	if out.IPLocked {
+		s.audit.Record(ctx, audit.LoginIPLockout, audit.TargetIP, ip, nil, out)
+	}
 }
 
 // GetByID fetches a driver by primary key.
 func (s *Service) GetByID(ctx context.Context, id string) (*Driver, error) {
-	var d Driver
-	err := s.db.QueryRow(ctx,
-		`SELECT id,name,email,phone,vehicle_type,license_plate,status,rating,created_at
-		 FROM drivers WHERE id=$1`, id).
-		Scan(&d.ID, &d.Name, &d.Email, &d.Phone,
-			&d.VehicleType, &d.LicensePlate, &d.Status, &d.Rating, &d.CreatedAt)
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+	d, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// List returns one page of drivers for the admin console and support tools.
+func (s *Service) List(ctx context.Context, f ListFilter) (*DriverList, error) {
+	f.Status = strings.ToLower(strings.TrimSpace(f.Status))
+	f.City = strings.TrimSpace(f.City)
+	f.Query = strings.TrimSpace(f.Query)
+	switch {
+	case f.Status != "" && !slices.Contains(Statuses, f.Status):
+		return nil, fmt.Errorf("%w: status must be one of %s", ErrInvalid, strings.Join(Statuses, ", "))
+	case f.MinRating != nil && f.MaxRating != nil && *f.MinRating > *f.MaxRating:
+		return nil, fmt.Errorf("%w: min_rating is above max_rating", ErrInvalid)
+	}
+	drivers, total, err := s.repo.List(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	return &DriverList{Drivers: drivers, Total: total, Limit: f.Limit, Offset: f.Offset}, nil
+}
+
+// CheckVerified returns ErrDeleted, ErrNotVerified or ErrCheckNotPassed
+// unless the driver may take trips.
+func (s *Service) CheckVerified(ctx context.Context, driverID string) error {
+	d, err := s.GetByID(ctx, driverID)
+	if err != nil {
+		return err
+	}
+	if d.DeletedAt != nil {
+		return ErrDeleted
+	}
+	if s.cfg.RequireVerification && d.VerifiedAt == nil {
+		return ErrNotVerified
+	}
+	if s.cfg.RequireBackgroundCheck && d.BackgroundCheck != backgroundcheck.Passed {
+		return ErrCheckNotPassed
+	}
+	return nil
+}
+
+// BackgroundCheckChanged takes an online driver whose background check no
+// longer passes offline, while checks are required. A trip in progress
+// continues. It is a backgroundcheck.Listener.
+func (s *Service) BackgroundCheckChanged(ctx context.Context, driverID, status string) {
+	if !s.cfg.RequireBackgroundCheck || status == backgroundcheck.Passed {
+		return
+	}
+	if _, err := s.endSession(ctx, driverID, time.Now(), EndCheckFailed); err != nil && !errors.Is(err, ErrNoSession) {
+		logger.Error("taking driver offline after background check failed", "driver", driverID, "err", err)
+	}
+}
+
+// Delete deactivates the driver: their session ends, they leave the matching
+// pool, their tokens stop working and they can no longer log in or be
+// assigned. Their trips and earnings history are kept.
+func (s *Service) Delete(ctx context.Context, driverID string) error {
+	before, err := s.repo.GetByID(ctx, driverID)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.SoftDelete(ctx, driverID); err != nil {
+		return err
+	}
+	if _, err := s.repo.CloseSession(ctx, driverID, time.Now(), EndDeleted); err != nil && !errors.Is(err, ErrNoSession) {
+		logger.Error("close session of deactivated driver failed", "driver", driverID, "err", err)
+	}
+	if err := s.locations.RemoveDriverLocation(ctx, driverID); err != nil {
+		logger.Error("remove deactivated driver from matching pool failed", "driver", driverID, "err", err)
+	}
+	s.driverLeft(ctx, driverID)
+	if err := jwt.Revoke(ctx, driverID); err != nil {
+		// The account is deactivated; tokens still expire within jwt.TokenTTL.
+		logger.Error("token revocation failed", "driver", driverID, "err", err)
+	}
+	logger.Info("driver deactivated", "driver", driverID)
+	after, _ := s.repo.GetByID(ctx, driverID)
+	s.audit.Record(ctx, audit.DriverDeactivate, audit.TargetDriver, driverID, before, after)
+	return nil
+}
+
+// Restore reactivates a deactivated driver. They come back offline and go
+// online as usual.
+func (s *Service) Restore(ctx context.Context, driverID string) (*Driver, error) {
+	before, err := s.repo.GetByID(ctx, driverID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Restore(ctx, driverID); err != nil {
+		return nil, err
+	}
+	if err := jwt.Unrevoke(ctx, driverID); err != nil {
+		logger.Warn("token revocation clear failed", "driver", driverID, "err", err)
+	}
+	logger.Info("driver restored", "driver", driverID)
+	d, err := s.GetByID(ctx, driverID)
+	if err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, audit.DriverRestore, audit.TargetDriver, driverID, before, d)
+	return d, nil
+}
+
+// UpdateProfile is users.Service.UpdateProfile for drivers. Revoking tokens
+// on a password change does not end the driver's session; the app carries on
+// with the returned token.
+func (s *Service) UpdateProfile(ctx context.Context, id string, req UpdateProfileRequest) (*ProfileResponse, error) {
+	d, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if d.DeletedAt != nil {
+		return nil, ErrDeleted
+	}
+
+	p := Profile{Name: req.Name}
+	if req.Password != nil {
+		hash, err := s.repo.PasswordHash(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(req.CurrentPassword)) != nil {
+			return nil, ErrWrongPassword
+		}
+		newHash, err := bcrypt.GenerateFromPassword([]byte(*req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		h := string(newHash)
+		p.PasswordHash = &h
+	}
+
+	resp := &ProfileResponse{}
+	account := "user:" + id
+	if req.Email != nil && *req.Email != d.Email {
+		if taken, err := s.repo.EmailTaken(ctx, *req.Email); err != nil {
+			return nil, err
+		} else if taken {
+			return nil, ErrEmailTaken
+		}
+		if err := s.codes.Start(ctx, account, verification.Email, *req.Email, *req.Email); err != nil {
+			return nil, err
+		}
+		resp.Pending = append(resp.Pending, verification.Email)
+	}
+	if req.Phone != nil {
+		country := d.Country
+		if req.Country != nil {
+			country = strings.ToUpper(*req.Country)
+		}
+		phone, err := validation.NormalizePhone(*req.Phone, country)
+		if err != nil {
+			return nil, err
+		}
+		if phone != d.Phone || country != d.Country {
+			if taken, err := s.repo.PhoneTaken(ctx, phone); err != nil {
+				return nil, err
+			} else if taken && phone != d.Phone {
+				return nil, ErrPhoneTaken
+			}
+			if err := s.codes.Start(ctx, account, verification.Phone, phone, country+":"+phone); err != nil {
+				return nil, err
+			}
+			resp.Pending = append(resp.Pending, verification.Phone)
+		}
+	}
+
+	if p.Name != nil || p.PasswordHash != nil {
+		if err := s.repo.UpdateProfile(ctx, id, p); err != nil {
+			return nil, err
+		}
+	}
+	if p.PasswordHash != nil {
+		if err := jwt.Revoke(ctx, id); err != nil {
+			// The password is changed; old tokens still expire within jwt.TokenTTL.
+			logger.Error("token revocation failed", "driver", id, "err", err)
+		}
+		if resp.Token, err = jwt.Generate(ctx, d.ID, d.Email, "driver"); err != nil {
+			return nil, err
+		}
+		logger.Info("password changed", "driver", id)
+	}
+	if resp.Driver, err = s.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// VerifyChange applies the driver's pending email or phone change once the
+// code matches and the address is still free.
+func (s *Service) VerifyChange(ctx context.Context, id string, req VerifyRequest) (*Driver, error) {
+	value, err := s.codes.Confirm(ctx, "driver:"+id, req.Field, req.Code)
+	if err != nil {
+		return nil, err
+	}
+	d, err := s.repo.GetByID(ctx, id)
 	if err != nil {
-		return nil, errors.New("driver not found")
+		return nil, err
+	}
+	var p Profile
+	switch req.Field {
+	case verification.Email:
+		if taken, err := s.repo.EmailTaken(ctx, value); err != nil {
+			return nil, err
+		} else if taken {
+			return nil, ErrEmailTaken
+		}
+		p.Email = &value
+	case verification.Phone:
+		country, phone, _ := strings.Cut(value, ":")
+		if taken, err := s.repo.PhoneTaken(ctx, phone); err != nil {
+			return nil, err
+		} else if taken && phone != d.Phone {
+			return nil, ErrPhoneTaken
+		}
+		p.Phone, p.Country = &phone, &country
+	}
+	if err := s.repo.UpdateProfile(ctx, id, p); err != nil {
+		return nil, err
 	}
-	return &d, nil
+	logger.Info("contact changed", "driver", id, "field", req.Field)
+	return s.GetByID(ctx, id)
 }
 
-// UpdateLocation stores the driver's current position in Redis.
+// UpdateLocation stores the driver's current position in Redis, which puts
+// them in the matching pool unless they are busy on a trip. A driver without
+// an open session goes online first, so unverified drivers and drivers on a
+// forced break are kept out.
 func (s *Service) UpdateLocation(ctx context.Context, driverID string, lat, lng float64) error {
-	return s.redis.SetDriverLocation(ctx, driverID, lat, lng)
+	if err := s.ensureOnline(ctx, driverID); err != nil {
+		return err
+	}
+	busy, err := s.busy(ctx, driverID)
+	if err != nil {
+		return err
+	}
+	if busy {
+		err = s.locations.SetDriverPositions(ctx, []geo.Position{{DriverID: driverID, Lat: lat, Lng: lng}})
+	} else {
+		err = s.locations.SetDriverLocation(ctx, driverID, lat, lng)
+	}
+	if err != nil {
+		return err
+	}
+	for _, o := range s.watch {
+		o.DriverMoved(ctx, driverID, lat, lng)
+	}
+	return nil
+}
+
+// ensureOnline opens a session for the driver unless they have one.
+func (s *Service) ensureOnline(ctx context.Context, driverID string) error {
+	_, err := s.repo.ActiveSession(ctx, driverID)
+	if errors.Is(err, ErrNoSession) {
+		_, err = s.GoOnline(ctx, driverID)
+	}
+	return err
+}
+
+func (s *Service) driverLeft(ctx context.Context, driverID string) {
+	for _, o := range s.watch {
+		o.DriverLeft(ctx, driverID)
+	}
+}
+
+// LocationFlushStats reports on the batching of location updates into Redis.
+func (s *Service) LocationFlushStats() rredis.FlushStats {
+	return s.redis.LocationFlushStats()
 }
 
 // GetNearby returns driver IDs within radiusKm of the given point.
 func (s *Service) GetNearby(ctx context.Context, lat, lng, radiusKm float64) ([]string, error) {
-	return s.redis.GetNearbyDrivers(ctx, lat, lng, radiusKm, 10)
+	return s.locations.GetNearbyDrivers(ctx, lat, lng, radiusKm, 10)
+}
+
+// UpdateVehicle is EditVehicle for the driver's active vehicle.
+func (s *Service) UpdateVehicle(ctx context.Context, driverID string, upd VehicleUpdate) (*Driver, error) {
+	vehicleID, err := s.activeVehicle(ctx, driverID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.EditVehicle(ctx, driverID, vehicleID, upd); err != nil {
+		return nil, err
+	}
+	return s.GetByID(ctx, driverID)
+}
+
+// SetVehiclePhoto stores a new photo of the driver's active vehicle.
+// The image type is sniffed from the content, not trusted from the client.
+func (s *Service) SetVehiclePhoto(ctx context.Context, driverID string, r io.Reader) error {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return ErrUnsupportedPhoto
+	}
+	ext, ok := photoExt[http.DetectContentType(head[:n])]
+	if !ok {
+		return ErrUnsupportedPhoto
+	}
+
+	d, err := s.GetByID(ctx, driverID)
+	if err != nil {
+		return err
+	}
+
+	if d.ActiveVehicleID == nil {
+		return ErrNoVehicle
+	}
+
+	key := "vehicles/" + driverID + "/" + uuid.New().String() + ext
+	if err := s.blobs.Put(ctx, key, io.MultiReader(bytes.NewReader(head[:n]), r)); err != nil {
+		return err
+	}
+	if err := s.repo.SetPhotoKey(ctx, driverID, *d.ActiveVehicleID, key); err != nil {
+		_ = s.blobs.Delete(ctx, key)
+		return err
+	}
+	if d.PhotoKey != "" {
+		_ = s.blobs.Delete(ctx, d.PhotoKey)
+	}
+	return nil
+}
+
+// VehiclePhoto opens the photo of the driver's active vehicle. The returned key
+// carries the file extension, which callers use to pick a Content-Type.
+func (s *Service) VehiclePhoto(ctx context.Context, driverID string) (io.ReadCloser, string, error) {
+	d, err := s.GetByID(ctx, driverID)
+	if err != nil {
+		return nil, "", err
+	}
+	if d.PhotoKey == "" {
+		return nil, "", blob.ErrNotFound
+	}
+	rc, err := s.blobs.Get(ctx, d.PhotoKey)
+	return rc, d.PhotoKey, err
+}
+
+// VehicleCard builds the rider-facing vehicle summary for a driver.
+func (s *Service) VehicleCard(ctx context.Context, driverID string) (*events.VehicleCard, error) {
+	d, err := s.GetByID(ctx, driverID)
+	if err != nil {
+		return nil, err
+	}
+	card := &events.VehicleCard{
+		Type:  d.VehicleType,
+		Model: d.VehicleModel,
+		Color: d.VehicleColor,
+		Plate: d.LicensePlate,
+	}
+	if d.PhotoKey != "" {
+		card.PhotoURL = "/drivers/" + driverID + "/vehicle/photo"
+	}
+	return card, nil
+}
+
+// RegisterDevice issues a new signing key for one of the driver's devices.
+func (s *Service) RegisterDevice(ctx context.Context, driverID, label string) (*DeviceRegistration, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	id := uuid.New().String()
+	if err := s.repo.CreateDevice(ctx, id, driverID, key, label); err != nil {
+		return nil, err
+	}
+	return &DeviceRegistration{DeviceID: id, Key: base64.StdEncoding.EncodeToString(key)}, nil
+}
+
+// RevokeDevice stops a device's key from being accepted.
+func (s *Service) RevokeDevice(ctx context.Context, driverID, deviceID string) error {
+	if _, err := uuid.Parse(deviceID); err != nil {
+		return ErrDeviceNotFound
+	}
+	return s.repo.RevokeDevice(ctx, driverID, deviceID)
+}
+
+// DeviceKey returns the active signing key of a driver's device.
+// City returns the city the driver is based in, "" if unset. Trips are
+// priced by it.
+func (s *Service) City(ctx context.Context, driverID string) (string, error) {
+	d, err := s.GetByID(ctx, driverID)
+	if err != nil {
+		return "", err
+	}
+	return d.City, nil
+}
+
+// Gender returns the gender the driver registered with, "" if none.
+func (s *Service) Gender(ctx context.Context, driverID string) (string, error) {
+	d, err := s.GetByID(ctx, driverID)
+	if err != nil {
+		return "", err
+	}
+	return d.Gender, nil
+}
+
+func (s *Service) DeviceKey(ctx context.Context, driverID, deviceID string) ([]byte, error) {
+	key, err := s.repo.DeviceKey(ctx, driverID, deviceID)
+	if err != nil {
+		return nil, ErrDeviceNotFound
+	}
+	return key, nil
 }
@@ -0,0 +1,187 @@
+package drivers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+
+	"ride-service/pkg/apierror"
+)
+
+// ErrOnBreak is returned when a driver forced offline tries to come back
+// before their break is over.
+var ErrOnBreak = apierror.Forbidden("driver must finish their break before going online")
+
+// MaxSessionRange caps the window of GET /drivers/:id/sessions.
+const MaxSessionRange = 31 * 24 * time.Hour
+
+// GoOnline opens a session and makes the driver available with their active
+// vehicle, which they must have selected. Coming back within MinBreak of the
+// last session continues its run towards MaxContinuousOnline; after a forced
+// stop it is refused until the break is over. Calling it while online
+// returns the open session.
+func (s *Service) GoOnline(ctx context.Context, driverID string) (*Session, error) {
+	if err := s.CheckVerified(ctx, driverID); err != nil {
+		return nil, err
+	}
+	if _, err := s.activeVehicle(ctx, driverID); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	sess := &Session{ID: uuid.New().String(), DriverID: driverID, StartedAt: now, ContinuousSince: now}
+
+	last, err := s.repo.LastSession(ctx, driverID)
+	switch {
+	case errors.Is(err, ErrNoSession):
+	case err != nil:
+		return nil, err
+	case now.Before(last.EndedAt.Add(s.cfg.MinBreak)):
+		if last.EndReason == EndMaxContinuous {
+			return nil, fmt.Errorf("%w (until %s)", ErrOnBreak, last.EndedAt.Add(s.cfg.MinBreak).UTC().Format(time.RFC3339))
+		}
+		sess.ContinuousSince = last.ContinuousSince
+	}
+
+	opened, err := s.repo.OpenSession(ctx, sess)
+	if err != nil {
+		return nil, err
+	}
+	if !opened {
+		return s.repo.ActiveSession(ctx, driverID)
+	}
+	if err := s.repo.SetStatus(ctx, driverID, "available"); err != nil {
+		return nil, err
+	}
+	logger.Info("driver online", "driver", driverID, "session", sess.ID, "continuous_since", sess.ContinuousSince)
+	return sess, nil
+}
+
+// GoOffline closes the driver's session and takes them out of matching.
+func (s *Service) GoOffline(ctx context.Context, driverID string) (*Session, error) {
+	return s.endSession(ctx, driverID, time.Now(), EndDriver)
+}
+
+func (s *Service) endSession(ctx context.Context, driverID string, at time.Time, reason string) (*Session, error) {
+	sess, err := s.repo.CloseSession(ctx, driverID, at, reason)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetStatus(ctx, driverID, "offline"); err != nil {
+		return nil, err
+	}
+	if err := s.locations.RemoveDriverLocation(ctx, driverID); err != nil {
+		logger.Warn("remove from matching pool failed", "driver", driverID, "err", err)
+	}
+	s.driverLeft(ctx, driverID)
+	return sess, nil
+}
+
+// StartShiftEnforcer forces drivers offline every interval once they have
+// been online for MaxContinuousOnline without a full break. A trip already
+// in progress continues; the driver just receives no new ones.
+func (s *Service) StartShiftEnforcer(ctx context.Context, every time.Duration) {
+	go func() {
+		t := time.NewTicker(every)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				if err := s.enforceShifts(ctx); err != nil && ctx.Err() == nil {
+					logger.Error("enforce driving limit failed", "err", err)
+				}
+			}
+		}
+	}()
+}
+
+func (s *Service) enforceShifts(ctx context.Context) error {
+	now := time.Now()
+	overdue, err := s.repo.OverdueSessions(ctx, now.Add(-s.cfg.MaxContinuousOnline))
+	if err != nil {
+		return err
+	}
+	for _, o := range overdue {
+		_, err := s.endSession(ctx, o.DriverID, now, EndMaxContinuous)
+		if errors.Is(err, ErrNoSession) {
+			continue // went offline meanwhile
+		}
+		if err != nil {
+			return err
+		}
+		logger.Warn("driver forced offline", "driver", o.DriverID, "session", o.ID,
+			"continuous_hours", hours(now.Sub(o.ContinuousSince)))
+	}
+	return nil
+}
+
+// Sessions reports the driver's online time in [from, to), per UTC day.
+func (s *Service) Sessions(ctx context.Context, driverID string, from, to time.Time) (*SessionReport, error) {
+	switch {
+	case !to.After(from):
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalid)
+	case to.Sub(from) > MaxSessionRange:
+		return nil, fmt.Errorf("%w: range must not exceed 31 days", ErrInvalid)
+	}
+	if _, err := s.GetByID(ctx, driverID); err != nil {
+		return nil, err
+	}
+	sessions, err := s.repo.Sessions(ctx, driverID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	report := &SessionReport{DriverID: driverID, From: from, To: to, Sessions: sessions, Days: []DayTotal{}}
+	perDay := map[string]time.Duration{}
+	for i := range sessions {
+		sess := &sessions[i]
+		end := now
+		if sess.EndedAt != nil {
+			end = *sess.EndedAt
+		} else {
+			report.Online = true
+		}
+		start, end := later(sess.StartedAt, from), earlier(end, to)
+		sess.Hours = hours(end.Sub(start))
+		for start.Before(end) {
+			midnight := start.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+			chunk := earlier(midnight, end)
+			perDay[start.UTC().Format(time.DateOnly)] += chunk.Sub(start)
+			start = chunk
+		}
+	}
+
+	var total time.Duration
+	for day := from.UTC().Truncate(24 * time.Hour); day.Before(to); day = day.Add(24 * time.Hour) {
+		d := perDay[day.Format(time.DateOnly)]
+		total += d
+		report.Days = append(report.Days, DayTotal{Date: day.Format(time.DateOnly), OnlineHours: hours(d)})
+	}
+	report.TotalHours = hours(total)
+	return report, nil
+}
+
+// hours rounds d to hundredths of an hour.
+func hours(d time.Duration) float64 {
+	return math.Round(d.Hours()*100) / 100
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func earlier(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
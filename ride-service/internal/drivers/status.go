@@ -0,0 +1,114 @@
+package drivers
+
+import (
+	"context"
+	"errors"
+
+	"ride-service/internal/events"
+	"ride-service/pkg/eventbus"
+	"ride-service/pkg/geo"
+)
+
+// TripLookup tells whether a driver has a trip in progress.
+type TripLookup interface {
+	OnTrip(ctx context.Context, driverID string) (bool, error)
+}
+
+// StartStatusSync keeps drivers' status in step with their trips: an
+// available driver who is matched (driver.assigned) becomes busy and leaves
+// the matchable pool, and a busy one becomes available again when the trip
+// ends (trip.completed) or they come off it (trip.cancelled), unless trips
+// says they are on another. The status in PostgreSQL decides whether
+// location updates put a driver back in the pool.
+func (s *Service) StartStatusSync(ctx context.Context, bus eventbus.Bus, trips TripLookup) {
+	bus.Subscribe(ctx, eventbus.TopicDriverAssigned, "drivers-driver-assigned", func(ctx context.Context, data []byte) error {
+		var ev events.DriverAssignedEvent
+		if err := unwrap(data, &ev); err != nil || ev.DriverID == "" {
+			return err
+		}
+		busy, err := s.repo.SwapStatus(ctx, ev.DriverID, "available", "busy")
+		if err != nil {
+			return err
+		}
+		if busy {
+			logger.Info("driver busy", "driver", ev.DriverID, "trip", ev.TripID)
+		}
+		return s.locations.RemoveDriverLocation(ctx, ev.DriverID)
+	})
+	bus.Subscribe(ctx, eventbus.TopicTripCompleted, "drivers-trip-completed", func(ctx context.Context, data []byte) error {
+		var ev events.TripCompletedEvent
+		if err := unwrap(data, &ev); err != nil {
+			return err
+		}
+		return s.freed(ctx, trips, ev.DriverID, ev.TripID)
+	})
+	bus.Subscribe(ctx, eventbus.TopicTripCancelled, "drivers-trip-cancelled", func(ctx context.Context, data []byte) error {
+		var ev events.TripCancelledEvent
+		if err := unwrap(data, &ev); err != nil {
+			return err
+		}
+		return s.freed(ctx, trips, ev.DriverID, ev.TripID)
+	})
+}
+
+// freed makes a busy driver who left tripID available, unless they are on
+// another trip. Their next location update puts them back in the pool.
+func (s *Service) freed(ctx context.Context, trips TripLookup, driverID, tripID string) error {
+	if driverID == "" {
+		return nil
+	}
+	if onTrip, err := trips.OnTrip(ctx, driverID); err != nil || onTrip {
+		return err
+	}
+	available, err := s.repo.SwapStatus(ctx, driverID, "busy", "available")
+	if err != nil {
+		return err
+	}
+	if available {
+		logger.Info("driver available", "driver", driverID, "trip", tripID)
+	}
+	return nil
+}
+
+// unwrap decodes an event for the status sync. Events newer than this
+// consumer understands are skipped, with nil returned and into left empty.
+func unwrap(data []byte, into events.Event) error {
+	env, err := events.Unwrap(data, into)
+	if errors.Is(err, events.ErrUnsupportedVersion) {
+		logger.Warn("skipping event", "event_id", env.EventID, "err", err)
+		return nil
+	}
+	return err
+}
+
+// busy reports whether the driver's status keeps them out of the pool.
+func (s *Service) busy(ctx context.Context, driverID string) (bool, error) {
+	d, err := s.repo.GetByID(ctx, driverID)
+	if err != nil {
+		return false, err
+	}
+	return d.Status == "busy", nil
+}
+
+// storePositions stores a batch of positions: available drivers join the
+// matchable pool, busy ones are only tracked.
+func (s *Service) storePositions(ctx context.Context, positions []geo.Position) error {
+	var pooled, tracked []geo.Position
+	for _, p := range positions {
+		busy, err := s.busy(ctx, p.DriverID)
+		if err != nil {
+			return err
+		}
+		if busy {
+			tracked = append(tracked, p)
+		} else {
+			pooled = append(pooled, p)
+		}
+	}
+	if len(tracked) > 0 {
+		if err := s.locations.SetDriverPositions(ctx, tracked); err != nil {
+			return err
+		}
+	}
+	return s.locations.SetDriverLocations(ctx, pooled)
+}
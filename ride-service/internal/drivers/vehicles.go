@@ -0,0 +1,270 @@
+package drivers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"ride-service/internal/events"
+	"ride-service/pkg/apierror"
+)
+
+var (
+	ErrVehicleNotFound = apierror.NotFound("vehicle not found")
+	ErrInvalidVehicle  = apierror.Validation("invalid vehicle")
+	ErrTooManyVehicles = apierror.Conflict("too many vehicles")
+	// ErrNoVehicle is returned when going online, or acting on the active
+	// vehicle, without one selected.
+	ErrNoVehicle = apierror.Conflict("no active vehicle; select one first")
+	// ErrVehicleLocked is returned for switching vehicles, or changing what
+	// matching and pricing use about the active one, while online.
+	ErrVehicleLocked = apierror.Conflict("go offline before changing the active vehicle")
+	ErrVehicleActive = apierror.Conflict("select another vehicle before removing the active one")
+)
+
+// Limits on a driver's vehicles.
+const (
+	MaxVehicles      = 5
+	MaxCapacity      = 8
+	MinVehicleYear   = 1980
+	DefaultCapacity  = 4
+	MaxChildSeats    = 3
+	MaxLuggageLitres = 2000
+)
+
+// Vehicle is one of a driver's vehicles. The active one is the one they
+// drive while online: matching and pricing go by it.
+type Vehicle struct {
+	ID            string    `json:"id"`
+	DriverID      string    `json:"driver_id"`
+	Type          string    `json:"vehicle_type"`
+	Capacity      int       `json:"capacity"` // passenger seats
+	LicensePlate  string    `json:"license_plate"`
+	Year          *int      `json:"year,omitempty"`
+	Model         string    `json:"vehicle_model,omitempty"`
+	Color         string    `json:"vehicle_color,omitempty"`
+	Accessibility []string  `json:"accessibility"`
+	ChildSeats    int       `json:"child_seats"`    // child seats carried
+	LuggageLitres int       `json:"luggage_litres"` // boot space
+	PhotoKey      string    `json:"-"`
+	Active        bool      `json:"active"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// VehicleRequest is the body for POST /drivers/:id/vehicles.
+type VehicleRequest struct {
+	Type          string   `json:"vehicle_type" validate:"required,maxLength=50"`
+	Capacity      int      `json:"capacity" validate:"min=0,max=8"` // defaults to 4
+	LicensePlate  string   `json:"license_plate" validate:"required,maxLength=20"`
+	Year          *int     `json:"year,omitempty" validate:"min=1980"`
+	Model         string   `json:"vehicle_model" validate:"maxLength=100"`
+	Color         string   `json:"vehicle_color" validate:"maxLength=50"`
+	Accessibility []string `json:"accessibility" validate:"maxItems=4"` // wheelchair, assistance, service_animal, hearing_support
+	ChildSeats    int      `json:"child_seats" validate:"min=0,max=3"`
+	LuggageLitres int      `json:"luggage_litres" validate:"min=0,max=2000"`
+}
+
+// Vehicles lists the driver's vehicles, oldest first.
+func (s *Service) Vehicles(ctx context.Context, driverID string) ([]Vehicle, error) {
+	if _, err := s.GetByID(ctx, driverID); err != nil {
+		return nil, err
+	}
+	return s.repo.Vehicles(ctx, driverID)
+}
+
+// AddVehicle registers another vehicle. A driver's first vehicle becomes
+// the active one.
+func (s *Service) AddVehicle(ctx context.Context, driverID string, req VehicleRequest) (*Vehicle, error) {
+	existing, err := s.Vehicles(ctx, driverID)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) >= MaxVehicles {
+		return nil, fmt.Errorf("%w: at most %d per driver", ErrTooManyVehicles, MaxVehicles)
+	}
+	if strings.TrimSpace(req.LicensePlate) == "" {
+		return nil, fmt.Errorf("%w: license_plate is required", ErrInvalidVehicle)
+	}
+	if req.Capacity == 0 {
+		req.Capacity = DefaultCapacity
+	}
+	v := &Vehicle{
+		ID: uuid.New().String(), DriverID: driverID,
+		Type: req.Type, Capacity: req.Capacity, LicensePlate: req.LicensePlate, Year: req.Year,
+		Model: req.Model, Color: req.Color, Accessibility: req.Accessibility,
+		ChildSeats: req.ChildSeats, LuggageLitres: req.LuggageLitres,
+	}
+	if err := v.normalize(); err != nil {
+		return nil, err
+	}
+	if err := s.repo.AddVehicle(ctx, v); err != nil {
+		return nil, err
+	}
+	logger.Info("vehicle added", "driver", driverID, "vehicle", v.ID, "type", v.Type)
+	return s.vehicle(ctx, driverID, v.ID)
+}
+
+// EditVehicle changes one of the driver's vehicles. Model, colour and plate
+// can change at any time; the rest of the active vehicle only while offline.
+func (s *Service) EditVehicle(ctx context.Context, driverID, vehicleID string, upd VehicleUpdate) (*Vehicle, error) {
+	v, err := s.vehicle(ctx, driverID, vehicleID)
+	if err != nil {
+		return nil, err
+	}
+	if v.Active && (upd.Type != nil || upd.Capacity != nil || upd.Accessibility != nil ||
+		upd.ChildSeats != nil || upd.LuggageLitres != nil) {
+		if err := s.checkOffline(ctx, driverID); err != nil {
+			return nil, err
+		}
+	}
+	set(&v.Model, upd.Model)
+	set(&v.Color, upd.Color)
+	set(&v.LicensePlate, upd.LicensePlate)
+	set(&v.Type, upd.Type)
+	if upd.Capacity != nil {
+		v.Capacity = *upd.Capacity
+	}
+	if upd.Year != nil {
+		v.Year = upd.Year
+	}
+	if upd.Accessibility != nil {
+		v.Accessibility = *upd.Accessibility
+	}
+	if upd.ChildSeats != nil {
+		v.ChildSeats = *upd.ChildSeats
+	}
+	if upd.LuggageLitres != nil {
+		v.LuggageLitres = *upd.LuggageLitres
+	}
+	if err := v.normalize(); err != nil {
+		return nil, err
+	}
+	if err := s.repo.UpdateVehicle(ctx, v); err != nil {
+		return nil, err
+	}
+	return s.vehicle(ctx, driverID, vehicleID)
+}
+
+// RemoveVehicle deletes one of the driver's vehicles other than the active one.
+func (s *Service) RemoveVehicle(ctx context.Context, driverID, vehicleID string) error {
+	v, err := s.vehicle(ctx, driverID, vehicleID)
+	if err != nil {
+		return err
+	}
+	if v.Active {
+		return ErrVehicleActive
+	}
+	if err := s.repo.RemoveVehicle(ctx, driverID, vehicleID); err != nil {
+		return err
+	}
+	if v.PhotoKey != "" {
+		_ = s.blobs.Delete(ctx, v.PhotoKey)
+	}
+	logger.Info("vehicle removed", "driver", driverID, "vehicle", vehicleID)
+	return nil
+}
+
+// SelectVehicle makes one of the driver's vehicles the active one. Drivers
+// switch while offline, before going online with it.
+func (s *Service) SelectVehicle(ctx context.Context, driverID, vehicleID string) (*Driver, error) {
+	if _, err := s.vehicle(ctx, driverID, vehicleID); err != nil {
+		return nil, err
+	}
+	if err := s.checkOffline(ctx, driverID); err != nil {
+		return nil, err
+	}
+	if err := s.repo.SetActiveVehicle(ctx, driverID, vehicleID); err != nil {
+		return nil, err
+	}
+	logger.Info("vehicle selected", "driver", driverID, "vehicle", vehicleID)
+	return s.GetByID(ctx, driverID)
+}
+
+// VehicleType returns the type of the driver's active vehicle, "" without
+// one. Trips are priced by it.
+func (s *Service) VehicleType(ctx context.Context, driverID string) (string, error) {
+	d, err := s.GetByID(ctx, driverID)
+	if err != nil {
+		return "", err
+	}
+	return d.VehicleType, nil
+}
+
+func (s *Service) vehicle(ctx context.Context, driverID, vehicleID string) (*Vehicle, error) {
+	vs, err := s.Vehicles(ctx, driverID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range vs {
+		if vs[i].ID == vehicleID {
+			return &vs[i], nil
+		}
+	}
+	return nil, ErrVehicleNotFound
+}
+
+// activeVehicle returns the ID of the driver's active vehicle.
+func (s *Service) activeVehicle(ctx context.Context, driverID string) (string, error) {
+	d, err := s.GetByID(ctx, driverID)
+	if err != nil {
+		return "", err
+	}
+	if d.ActiveVehicleID == nil {
+		return "", ErrNoVehicle
+	}
+	return *d.ActiveVehicleID, nil
+}
+
+func (s *Service) checkOffline(ctx context.Context, driverID string) error {
+	_, err := s.repo.ActiveSession(ctx, driverID)
+	switch {
+	case errors.Is(err, ErrNoSession):
+		return nil
+	case err != nil:
+		return err
+	}
+	return ErrVehicleLocked
+}
+
+// normalize trims v's fields, lower-casing the type and features, and
+// checks them.
+func (v *Vehicle) normalize() error {
+	v.Type = strings.ToLower(strings.TrimSpace(v.Type))
+	v.LicensePlate = strings.TrimSpace(v.LicensePlate)
+	v.Model = strings.TrimSpace(v.Model)
+	v.Color = strings.TrimSpace(v.Color)
+	features := []string{}
+	for _, f := range v.Accessibility {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if !slices.Contains(events.AccessibilityFeatures, f) {
+			return fmt.Errorf("%w: unknown accessibility feature %q (use %s)", ErrInvalidVehicle, f,
+				strings.Join(events.AccessibilityFeatures, ", "))
+		}
+		if !slices.Contains(features, f) {
+			features = append(features, f)
+		}
+	}
+	v.Accessibility = features
+	switch {
+	case v.Type == "" || len(v.Type) > 50:
+		return fmt.Errorf("%w: vehicle_type is required (at most 50 characters)", ErrInvalidVehicle)
+	case len(v.LicensePlate) > 20:
+		return fmt.Errorf("%w: license_plate is at most 20 characters", ErrInvalidVehicle)
+	case len(v.Model) > 100 || len(v.Color) > 50:
+		return fmt.Errorf("%w: vehicle_model or vehicle_color too long", ErrInvalidVehicle)
+	case v.Capacity < 1 || v.Capacity > MaxCapacity:
+		return fmt.Errorf("%w: capacity must be between 1 and %d", ErrInvalidVehicle, MaxCapacity)
+	case v.ChildSeats < 0 || v.ChildSeats > MaxChildSeats:
+		return fmt.Errorf("%w: child_seats must be between 0 and %d", ErrInvalidVehicle, MaxChildSeats)
+	case v.LuggageLitres < 0 || v.LuggageLitres > MaxLuggageLitres:
+		return fmt.Errorf("%w: luggage_litres must be between 0 and %d", ErrInvalidVehicle, MaxLuggageLitres)
+	case v.Year != nil && (*v.Year < MinVehicleYear || *v.Year > time.Now().Year()+1):
+		return fmt.Errorf("%w: year must be between %d and %d", ErrInvalidVehicle, MinVehicleYear, time.Now().Year()+1)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package emergency
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+)
+
+// Handler lets riders keep emergency contacts and send an SOS.
+type Handler struct{ svc *Service }
+
+// NewHandler wires a handler to the emergency service.
+func NewHandler(svc *Service) *Handler { return &Handler{svc: svc} }
+
+// TripRoutes returns the routes mounted at /trips/{id}/sos.
+func (h *Handler) TripRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth, jwt.RequireRole("rider"))
+
+	r.Post("/", h.SOS)
+
+	return r
+}
+
+// Routes returns the routes mounted at /emergency-contacts: the caller's
+// contacts.
+func (h *Handler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth, jwt.RequireRole("rider"))
+
+	r.Get("/", h.Mine)
+	r.Post("/", h.Add)
+	r.Delete("/{id}", h.Remove)
+
+	return r
+}
+
+func (h *Handler) SOS(w http.ResponseWriter, r *http.Request) {
+	a, err := h.svc.SOS(r.Context(), chi.URLParam(r, "id"), jwt.GetClaims(r.Context()).UserID)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusAccepted, a)
+}
+
+func (h *Handler) Add(w http.ResponseWriter, r *http.Request) {
+	var req ContactRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	c, err := h.svc.Add(r.Context(), jwt.GetClaims(r.Context()).UserID, req)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusCreated, c)
+}
+
+func (h *Handler) Mine(w http.ResponseWriter, r *http.Request) {
+	l, err := h.svc.Mine(r.Context(), jwt.GetClaims(r.Context()).UserID)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, l)
+}
+
+func (h *Handler) Remove(w http.ResponseWriter, r *http.Request) {
+	if err := h.svc.Remove(r.Context(), chi.URLParam(r, "id"), jwt.GetClaims(r.Context()).UserID); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]string{"status": "removed"})
+}
@@ -0,0 +1,63 @@
+package emergency
+
+import "time"
+
+// MaxContacts caps a rider's emergency contacts.
+const MaxContacts = 5
+
+// Alert reasons.
+const (
+	ReasonSOS            = "sos"             // the rider asked for help
+	ReasonRouteDeviation = "route_deviation" // the trip left its planned route
+)
+
+// Contact is someone a rider wants told when they may need help. They need
+// no account; alerts go to their phone by SMS and their email.
+type Contact struct {
+	ID        string    `json:"id"`
+	RiderID   string    `json:"rider_id"`
+	Name      string    `json:"name"`
+	Phone     string    `json:"phone,omitempty"` // E.164
+	Email     string    `json:"email,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// List is the body of GET /emergency-contacts.
+type List struct {
+	Contacts []Contact `json:"contacts"`
+}
+
+// ContactRequest is the body for POST /emergency-contacts. At least one of
+// Phone and Email is required; Country reads a national Phone and defaults
+// to IN.
+type ContactRequest struct {
+	Name    string `json:"name" validate:"required,maxLength=100"`
+	Phone   string `json:"phone" validate:"maxLength=30"`
+	Country string `json:"country" validate:"maxLength=2"`
+	Email   string `json:"email" validate:"maxLength=254,format=email"`
+}
+
+// Alert is one alert sent to a rider's contacts about a trip. Alerts for
+// the same trip and reason are not repeated within the cooldown: the
+// earlier one is returned instead, without the link, which is not kept.
+type Alert struct {
+	ID       string `json:"id"`
+	TripID   string `json:"trip_id"`
+	Reason   string `json:"reason"`
+	Notified int    `json:"notified"` // contacts told
+	// ShareURL is the trip share link the contacts got, valid until
+	// ExpiresAt.
+	ShareURL  string     `json:"share_url,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Notice is what a contact is told about an alert: whose trip, why, and the
+// link to follow it live.
+type Notice struct {
+	TripID    string
+	RiderName string
+	Reason    string
+	ShareURL  string
+	ExpiresAt time.Time
+}
@@ -0,0 +1,266 @@
+// Package emergency keeps riders' emergency contacts and alerts them, with a
+// live link to the trip, when the rider sends an SOS or the trip leaves its
+// planned route.
+package emergency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/internal/routemonitor"
+	"ride-service/internal/sharing"
+	"ride-service/internal/trips"
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/logging"
+	"ride-service/pkg/pii"
+	"ride-service/pkg/validation"
+)
+
+var logger = logging.For("emergency")
+
+var (
+	ErrTripNotFound    = apierror.NotFound("trip not found")
+	ErrNotFound        = apierror.NotFound("emergency contact not found")
+	ErrNotRider        = apierror.Forbidden("only the trip's rider can send an SOS")
+	ErrTripInactive    = apierror.Conflict("trip is not in progress")
+	ErrInvalid         = apierror.Validation("invalid emergency contact")
+	ErrTooManyContacts = apierror.Conflict(fmt.Sprintf("at most %d emergency contacts", MaxContacts)).WithCode("too_many_contacts")
+)
+
+// alertCooldown is how long an alert for a trip stands before the same
+// reason alerts the contacts again.
+const alertCooldown = 10 * time.Minute
+
+// alertable are the statuses a trip can raise alerts in: from assignment
+// until it ends.
+var alertable = []string{trips.StatusDriverAssigned, trips.StatusStarted}
+
+// Sharer creates the trip share links contacts are sent; the sharing
+// service implements it.
+type Sharer interface {
+	Create(ctx context.Context, tripID, riderID string) (*sharing.Share, error)
+}
+
+// NotifyFunc tells one contact about an alert.
+type NotifyFunc func(ctx context.Context, c Contact, n Notice)
+
+// TripReader returns trips; trips.TripRepo implements it.
+type TripReader interface {
+	GetByID(ctx context.Context, id string) (*trips.Trip, error)
+}
+
+// Service keeps emergency contacts and sends alerts to them.
+type Service struct {
+	db       *pgxpool.Pool
+	trips    TripReader
+	cipher   *pii.Cipher
+	shares   Sharer
+	onNotify NotifyFunc
+}
+
+// NewService creates an emergency service. Contacts' email and phone are
+// sealed with cipher.
+func NewService(db *pgxpool.Pool, t TripReader, cipher *pii.Cipher, shares Sharer) *Service {
+	return &Service{db: db, trips: t, cipher: cipher, shares: shares}
+}
+
+// trip returns tripID, reporting a missing one as ErrTripNotFound.
+func (s *Service) trip(ctx context.Context, tripID string) (*trips.Trip, error) {
+	t, err := s.trips.GetByID(ctx, tripID)
+	if errors.Is(err, trips.ErrNotFound) {
+		return nil, ErrTripNotFound
+	}
+	return t, err
+}
+
+// OnNotify sets the function that tells contacts about alerts. Without it
+// alerts are only recorded. Call it before serving.
+func (s *Service) OnNotify(fn NotifyFunc) { s.onNotify = fn }
+
+// Add stores an emergency contact for riderID.
+func (s *Service) Add(ctx context.Context, riderID string, req ContactRequest) (*Contact, error) {
+	if err := validation.Struct(req); err != nil {
+		return nil, err
+	}
+	c := &Contact{ID: uuid.NewString(), RiderID: riderID, Name: strings.TrimSpace(req.Name), Email: strings.TrimSpace(req.Email)}
+	if c.Name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalid)
+	}
+	if strings.TrimSpace(req.Phone) != "" {
+		phone, err := validation.NormalizePhone(req.Phone, req.Country)
+		if err != nil {
+			return nil, err
+		}
+		c.Phone = phone
+	}
+	if c.Phone == "" && c.Email == "" {
+		return nil, fmt.Errorf("%w: phone or email is required", ErrInvalid)
+	}
+
+	var n int
+	if err := s.db.QueryRow(ctx, `SELECT COUNT(*) FROM emergency_contacts WHERE rider_id=$1`, riderID).Scan(&n); err != nil {
+		return nil, err
+	}
+	if n >= MaxContacts {
+		return nil, ErrTooManyContacts
+	}
+	email, emailIdx, err := s.cipher.Seal(pii.Email, c.Email)
+	if err != nil {
+		return nil, err
+	}
+	phone, phoneIdx, err := s.cipher.Seal(pii.Phone, c.Phone)
+	if err != nil {
+		return nil, err
+	}
+	err = s.db.QueryRow(ctx,
+		`INSERT INTO emergency_contacts (id,rider_id,name,email,phone,email_idx,phone_idx)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7) RETURNING created_at`,
+		c.ID, riderID, c.Name, email, phone, emailIdx, phoneIdx).
+		Scan(&c.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Mine returns riderID's emergency contacts, oldest first.
+func (s *Service) Mine(ctx context.Context, riderID string) (*List, error) {
+	contacts, err := s.contacts(ctx, riderID)
+	if err != nil {
+		return nil, err
+	}
+	return &List{Contacts: contacts}, nil
+}
+
+// Remove deletes riderID's emergency contact id.
+func (s *Service) Remove(ctx context.Context, id, riderID string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrNotFound
+	}
+	tag, err := s.db.Exec(ctx, `DELETE FROM emergency_contacts WHERE id=$1 AND rider_id=$2`, id, riderID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// SOS alerts the contacts of riderID, the rider of trip tripID, that they
+// asked for help.
+func (s *Service) SOS(ctx context.Context, tripID, riderID string) (*Alert, error) {
+	t, err := s.trip(ctx, tripID)
+	if err != nil {
+		return nil, err
+	}
+	if t.RiderID != riderID {
+		return nil, ErrNotRider
+	}
+	logger.Warn("rider sent an SOS", "trip", tripID, "rider", riderID)
+	return s.Alert(ctx, tripID, ReasonSOS)
+}
+
+// RouteDeviated alerts the rider's contacts that their trip left its
+// planned route; it is a routemonitor.Listener.
+func (s *Service) RouteDeviated(ctx context.Context, d routemonitor.Deviation) {
+	if _, err := s.Alert(ctx, d.TripID, ReasonRouteDeviation); err != nil {
+		logger.Error("route deviation alert failed", "trip", d.TripID, "deviation", d.ID, "err", err)
+	}
+}
+
+// Alert tells the contacts of trip tripID's rider why they may need help,
+// with a new share link to follow the trip. The trip must be assigned or
+// started. An alert for the same trip and reason within the cooldown is
+// returned instead of sending another.
+func (s *Service) Alert(ctx context.Context, tripID, reason string) (*Alert, error) {
+	t, err := s.trip(ctx, tripID)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(alertable, t.Status) {
+		return nil, ErrTripInactive
+	}
+	riderID := t.RiderID
+	var riderName string
+	if err := s.db.QueryRow(ctx, `SELECT name FROM users WHERE id=$1`, riderID).Scan(&riderName); err != nil {
+		return nil, err
+	}
+
+	a := &Alert{TripID: tripID, Reason: reason}
+	err = s.db.QueryRow(ctx,
+		`SELECT id, notified, created_at FROM emergency_alerts
+		 WHERE trip_id=$1 AND reason=$2 AND created_at > $3 ORDER BY created_at DESC LIMIT 1`,
+		tripID, reason, time.Now().Add(-alertCooldown)).
+		Scan(&a.ID, &a.Notified, &a.CreatedAt)
+	if err == nil {
+		return a, nil
+	} else if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	contacts, err := s.contacts(ctx, riderID)
+	if err != nil {
+		return nil, err
+	}
+	a.ID = uuid.NewString()
+	var shareID *string
+	if len(contacts) > 0 {
+		sh, err := s.shares.Create(ctx, tripID, riderID)
+		if err != nil {
+			return nil, err
+		}
+		shareID, a.ShareURL, a.ExpiresAt = &sh.ID, sh.URL, &sh.ExpiresAt
+		a.Notified = len(contacts)
+	}
+	err = s.db.QueryRow(ctx,
+		`INSERT INTO emergency_alerts (id,trip_id,rider_id,reason,share_id,notified) VALUES ($1,$2,$3,$4,$5,$6)
+		 RETURNING created_at`,
+		a.ID, tripID, riderID, reason, shareID, a.Notified).
+		Scan(&a.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.onNotify != nil && a.ExpiresAt != nil {
+		n := Notice{TripID: tripID, RiderName: riderName, Reason: reason, ShareURL: a.ShareURL, ExpiresAt: *a.ExpiresAt}
+		for _, c := range contacts {
+			s.onNotify(ctx, c, n)
+		}
+	}
+	logger.Warn("emergency contacts alerted", "trip", tripID, "alert", a.ID, "reason", reason, "contacts", a.Notified)
+	return a, nil
+}
+
+// contacts returns riderID's contacts with their email and phone opened.
+func (s *Service) contacts(ctx context.Context, riderID string) ([]Contact, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT id,rider_id,name,email,phone,created_at FROM emergency_contacts WHERE rider_id=$1 ORDER BY created_at`, riderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Contact{}
+	for rows.Next() {
+		var c Contact
+		if err := rows.Scan(&c.ID, &c.RiderID, &c.Name, &c.Email, &c.Phone, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		if c.Email, err = s.cipher.Decrypt(pii.Email, c.Email); err != nil {
+			return nil, err
+		}
+		if c.Phone, err = s.cipher.Decrypt(pii.Phone, c.Phone); err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,75 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrUnsupportedVersion means the event is newer than this consumer
+	// understands. Consumers should skip (and commit) such events.
+	ErrUnsupportedVersion = errors.New("unsupported event version")
+	// ErrWrongType means the envelope carries a different event type.
+	ErrWrongType = errors.New("unexpected event type")
+)
+
+// Event is implemented by every payload published to Kafka.
+//
+// Versioning rule: adding optional fields keeps the version; removing or
+// changing the meaning of a field bumps it. Consumers accept any version up
+// to the one they were built with and skip newer ones.
+type Event interface {
+	EventType() string
+	EventVersion() int
+}
+
+// Envelope wraps every Kafka payload.
+type Envelope struct {
+	EventID    string          `json:"event_id"`
+	Type       string          `json:"type"`
+	Version    int             `json:"version"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// Wrap builds an envelope around ev with a fresh event ID.
+func Wrap(ev Event) (*Envelope, error) {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return nil, err
+	}
+	return &Envelope{
+		EventID:    uuid.New().String(),
+		Type:       ev.EventType(),
+		Version:    ev.EventVersion(),
+		OccurredAt: time.Now().UTC(),
+		Payload:    payload,
+	}, nil
+}
+
+// Unwrap decodes data into into, checking type and version against it.
+// Payloads published before envelopes existed are accepted as version 1.
+func Unwrap(data []byte, into Event) (*Envelope, error) {
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, err
+	}
+	if env.Type == "" && env.Payload == nil {
+		env = Envelope{Type: into.EventType(), Version: 1, Payload: data}
+	}
+	if env.Type != into.EventType() {
+		return &env, fmt.Errorf("%w: got %q, want %q", ErrWrongType, env.Type, into.EventType())
+	}
+	if env.Version > into.EventVersion() {
+		return &env, fmt.Errorf("%w: %s v%d (understand up to v%d)",
+			ErrUnsupportedVersion, env.Type, env.Version, into.EventVersion())
+	}
+	if err := json.Unmarshal(env.Payload, into); err != nil {
+		return &env, err
+	}
+	return &env, nil
+}
@@ -1,9 +1,15 @@
 package events
 
+import (
+	"time"
+
+	"ride-service/pkg/money"
+)
+
 // LatLng is a coordinate pair used in event payloads.
 type LatLng struct {
-	Lat float64 `json:"lat"`
-	Lng float64 `json:"lng"`
+	Lat float64 `json:"lat" validate:"required,min=-90,max=90"`
+	Lng float64 `json:"lng" validate:"required,min=-180,max=180"`
 }
 
 // RideRequestedEvent is published to ride.requested.
@@ -13,20 +19,263 @@ type RideRequestedEvent struct {
 	Pickup      LatLng `json:"pickup"`
 	Drop        LatLng `json:"drop"`
 	RequestedAt string `json:"requested_at"`
+	TripVersion int    `json:"trip_version,omitempty"` // trip version the match is made against
+	VehicleType string `json:"vehicle_type,omitempty"` // requested vehicle type; empty for any
+	// Seats and Accessibility are what the vehicle must offer; zero and
+	// empty ask for nothing in particular.
+	Seats         int      `json:"seats,omitempty"`
+	Accessibility []string `json:"accessibility,omitempty"`
+	// WomenOnly limits the match to drivers whose profile says female.
+	WomenOnly bool `json:"women_only,omitempty"`
+	// ChildSeats and LuggageLitres are likewise minimums for the vehicle.
+	ChildSeats    int `json:"child_seats,omitempty"`
+	LuggageLitres int `json:"luggage_litres,omitempty"`
+	// ExcludeDrivers lists drivers who already declined or cancelled the
+	// trip; the matcher does not offer it to them again.
+	ExcludeDrivers []string `json:"exclude_drivers,omitempty"`
+	// Retry counts the times the trip watchdog re-published the request of
+	// a trip still without a driver; consumers that count requests skip
+	// retries.
+	Retry int `json:"retry,omitempty"`
 }
 
 // DriverAssignedEvent is published to driver.assigned.
 type DriverAssignedEvent struct {
-	TripID   string `json:"trip_id"`
-	DriverID string `json:"driver_id"`
+	TripID   string       `json:"trip_id"`
+	DriverID string       `json:"driver_id"`
+	Vehicle  *VehicleCard `json:"vehicle,omitempty"`
+	// TripVersion echoes RideRequestedEvent.TripVersion; the assignment is
+	// dropped if the trip has changed since. Zero (older producers) skips the check.
+	TripVersion int `json:"trip_version,omitempty"`
+	// Score explains why the matcher picked this driver.
+	Score *MatchScore `json:"score,omitempty"`
+}
+
+// MatchWeights weigh the components of a MatchScore.
+type MatchWeights struct {
+	Distance   float64 `json:"distance"`
+	Rating     float64 `json:"rating"`
+	Acceptance float64 `json:"acceptance"`
+	Vehicle    float64 `json:"vehicle"`
+	Idle       float64 `json:"idle"`
+	Safety     float64 `json:"safety"`
+}
+
+// MatchScore is the matcher's scoring breakdown for one driver. Each
+// component is in [0,1], higher is better; Total is their weighted sum.
+type MatchScore struct {
+	Total      float64 `json:"total"`
+	DistanceKm float64 `json:"distance_km"`
+	Distance   float64 `json:"distance"`   // 1 at the pickup, 0 at the edge of the radius
+	Rating     float64 `json:"rating"`     // driver rating mapped from 1–5
+	Acceptance float64 `json:"acceptance"` // acceptance rate; 1 until there is enough history
+	Vehicle    float64 `json:"vehicle"`    // 1 if the vehicle type matches the request
+	Idle       float64 `json:"idle"`       // time since the last completed trip, saturating
+	Safety     float64 `json:"safety"`     // driving safety score mapped from 0–100; 1 until there is enough driving
+	// Deprioritized is set when the driver was outside the acceptance or
+	// cancellation thresholds and only picked for lack of anyone else.
+	Deprioritized bool    `json:"deprioritized,omitempty"`
+	Candidates    int     `json:"candidates"` // drivers considered
+	RadiusKm      float64 `json:"radius_km"`  // the search radius Distance is relative to
+	// ChainedTrip is the trip the driver was finishing when matched: they
+	// come on from its drop, and DistanceKm counts the way there.
+	ChainedTrip string `json:"chained_trip,omitempty"`
+	// Favorite is set when the rider marked the driver as a favorite, who
+	// was then offered the trip ahead of the other candidates.
+	Favorite bool         `json:"favorite,omitempty"`
+	Batch    int          `json:"batch,omitempty"` // requests solved together in batch mode
+	Weights  MatchWeights `json:"weights"`
+	// Algorithm is "v2" when the trip was ranked with the v2 score; empty
+	// for the original one.
+	Algorithm string `json:"algorithm,omitempty"`
 }
 
 // TripCompletedEvent is published to trip.completed.
 type TripCompletedEvent struct {
-	TripID          string  `json:"trip_id"`
-	DriverID        string  `json:"driver_id"`
-	RiderID         string  `json:"rider_id"`
+	TripID   string `json:"trip_id"`
+	DriverID string `json:"driver_id"`
+	RiderID  string `json:"rider_id"`
+	// Fare is in major units for consumers that predate currencies; read
+	// FareAmount instead.
 	Fare            float64 `json:"fare"`
+	FareMinor       int64   `json:"fare_minor,omitempty"`
+	Currency        string  `json:"currency,omitempty"`
 	CompletedAt     string  `json:"completed_at"`
 	DurationSeconds int64   `json:"duration_seconds"`
+	// Surcharges are the extras included in the fare.
+	Surcharges []Surcharge `json:"surcharges,omitempty"`
+	// DestinationChanges counts the drops changed mid-trip.
+	DestinationChanges int `json:"destination_changes,omitempty"`
+}
+
+// Surcharge is an extra priced on top of the distance fare.
+type Surcharge struct {
+	Name   string      `json:"name"`  // child_seat | luggage | waiting
+	Units  int         `json:"units"` // child seats, started 100 litres of luggage, or started minutes paused
+	Amount money.Money `json:"amount"`
+}
+
+// Surcharge names.
+const (
+	SurchargeChildSeat = "child_seat"
+	SurchargeLuggage   = "luggage"
+	SurchargeWaiting   = "waiting"
+)
+
+// FareAmount returns the fare. Events from producers that predate
+// currencies only carry Fare, which was always in rupees.
+func (e TripCompletedEvent) FareAmount() money.Money {
+	if e.Currency == "" {
+		return money.FromMajor(e.Fare, "INR")
+	}
+	return money.New(e.FareMinor, e.Currency)
+}
+
+// TipAddedEvent is published to tip.added when a rider tips the driver of a
+// completed trip. The driver gets all of it.
+type TipAddedEvent struct {
+	TripID      string `json:"trip_id"`
+	DriverID    string `json:"driver_id"`
+	RiderID     string `json:"rider_id"`
+	AmountMinor int64  `json:"amount_minor"`
+	Currency    string `json:"currency"`
+	AddedAt     string `json:"added_at"`
+}
+
+// Amount returns the tip.
+func (e TipAddedEvent) Amount() money.Money { return money.New(e.AmountMinor, e.Currency) }
+
+// TripNoShowEvent is published to trip.no_show when the driver gave up
+// waiting at the pickup and cancelled the trip. The rider owes the fee.
+type TripNoShowEvent struct {
+	TripID    string `json:"trip_id"`
+	DriverID  string `json:"driver_id"`
+	RiderID   string `json:"rider_id"`
+	FeeMinor  int64  `json:"fee_minor"`
+	Currency  string `json:"currency"`
+	ArrivedAt string `json:"arrived_at"`
+	NoShowAt  string `json:"no_show_at"`
+}
+
+// Fee returns the no-show fee.
+func (e TripNoShowEvent) Fee() money.Money { return money.New(e.FeeMinor, e.Currency) }
+
+// TripCancelledEvent is published to trip.cancelled when a driver comes off
+// a trip without completing it: the rider did not show up or cancelled (the
+// trip is CANCELLED), the driver declined or withdrew, or the match was
+// superseded before it was recorded (the trip is matched again). It is also
+// published, without a driver, when no driver was found in time and the trip
+// is CANCELLED.
+//
+// Reason is what happened. Cancellations proper (not declines or superseded
+// matches) also carry who cancelled and why, from the trips package's
+// reason taxonomy.
+type TripCancelledEvent struct {
+	TripID       string `json:"trip_id"`
+	DriverID     string `json:"driver_id,omitempty"`
+	RiderID      string `json:"rider_id,omitempty"`
+	Reason       string `json:"reason"`                  // no_show | declined | withdrawn | superseded | no_driver | rider_cancelled
+	Actor        string `json:"actor,omitempty"`         // rider | driver | system
+	CancelReason string `json:"cancel_reason,omitempty"` // e.g. wait_too_long, vehicle_issue
+	CancelNote   string `json:"cancel_note,omitempty"`
+	CancelledAt  string `json:"cancelled_at"`
+}
+
+// Reasons of a TripCancelledEvent.
+const (
+	CancelNoShow     = "no_show"
+	CancelDeclined   = "declined"
+	CancelWithdrawn  = "withdrawn"
+	CancelSuperseded = "superseded"
+	CancelNoDriver   = "no_driver"
+	CancelByRider    = "rider_cancelled"
+)
+
+// FareAdjustedEvent is published to fare.adjusted when staff resolve a
+// rider's dispute by changing a completed trip's fare. The trip row already
+// has the new fare; consumers bring what they derived from the old one in
+// line.
+type FareAdjustedEvent struct {
+	TripID       string `json:"trip_id"`
+	DisputeID    string `json:"dispute_id"`
+	RiderID      string `json:"rider_id"`
+	DriverID     string `json:"driver_id"`
+	OldFareMinor int64  `json:"old_fare_minor"`
+	NewFareMinor int64  `json:"new_fare_minor"`
+	Currency     string `json:"currency"`
+	Reason       string `json:"reason"`
+	AdjustedAt   string `json:"adjusted_at"`
+}
+
+// OldFare and NewFare return the fare before and after the adjustment.
+func (e FareAdjustedEvent) OldFare() money.Money { return money.New(e.OldFareMinor, e.Currency) }
+
+func (e FareAdjustedEvent) NewFare() money.Money { return money.New(e.NewFareMinor, e.Currency) }
+
+func (RideRequestedEvent) EventType() string  { return "ride.requested" }
+func (RideRequestedEvent) EventVersion() int  { return 1 }
+func (DriverAssignedEvent) EventType() string { return "driver.assigned" }
+func (DriverAssignedEvent) EventVersion() int { return 1 }
+func (TripCompletedEvent) EventType() string  { return "trip.completed" }
+func (TripCompletedEvent) EventVersion() int  { return 1 }
+func (TipAddedEvent) EventType() string       { return "tip.added" }
+func (TipAddedEvent) EventVersion() int       { return 1 }
+func (TripNoShowEvent) EventType() string     { return "trip.no_show" }
+func (TripNoShowEvent) EventVersion() int     { return 1 }
+func (FareAdjustedEvent) EventType() string   { return "fare.adjusted" }
+func (FareAdjustedEvent) EventVersion() int   { return 1 }
+func (TripCancelledEvent) EventType() string  { return "trip.cancelled" }
+func (TripCancelledEvent) EventVersion() int  { return 1 }
+
+// DriverStats is what the matcher weighs about a candidate driver.
+type DriverStats struct {
+	Rating           float64
+	Gender           string     // as on the profile; "" if not given
+	VehicleType      string     // of the active vehicle
+	Capacity         int        // seats in the active vehicle; 0 without one
+	Accessibility    []string   // features of the active vehicle
+	ChildSeats       int        // child seats carried in the active vehicle
+	LuggageLitres    int        // boot space of the active vehicle
+	AcceptanceRate   *float64   // nil until the driver has answered enough offers
+	CancellationRate *float64   // likewise
+	LastTripAt       *time.Time // last completed trip; nil if none
+	SafetyScore      *float64   // 0–100; nil until the driver has driven enough to judge
+	GoHome           *GoHome    // set while the driver is winding down
+}
+
+// FinishingDriver is a driver on a trip that ends near a pickup, a
+// candidate for chained dispatch.
+type FinishingDriver struct {
+	DriverID    string
+	TripID      string  // the STARTED trip they are finishing
+	RemainingKm float64 // straight line from their last position to its drop
+	ToPickupKm  float64 // from its drop to the pickup
+}
+
+// GoHome is the home area of a driver winding down: they are only offered
+// trips that drop off inside it.
+type GoHome struct {
+	Lat, Lng, RadiusKm float64
+}
+
+// AccessibilityFeatures are the features a vehicle can offer and a trip can
+// ask for: a wheelchair-accessible vehicle, a driver who helps the rider in
+// and out, room for a service animal, and a driver set up for riders with
+// hearing loss. Child seats are counted separately.
+var AccessibilityFeatures = []string{"wheelchair", "assistance", "service_animal", "hearing_support"}
+
+// Genders riders and drivers may give on their profile; it is optional and
+// only women-only trips look at it.
+var Genders = []string{GenderFemale, "male", "nonbinary"}
+
+// GenderFemale is the gender women-only trips match on, on both sides.
+const GenderFemale = "female"
+
+// VehicleCard is the rider-facing description of the car coming to pick them up.
+type VehicleCard struct {
+	Type     string `json:"type"`
+	Model    string `json:"model,omitempty"`
+	Color    string `json:"color,omitempty"`
+	Plate    string `json:"plate,omitempty"`
+	PhotoURL string `json:"photo_url,omitempty"`
 }
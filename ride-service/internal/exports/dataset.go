@@ -0,0 +1,106 @@
+package exports
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+
+	"ride-service/internal/trips"
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/parquet"
+)
+
+// Dataset is something staff can export: a table of typed columns and the
+// rows matching a job's filters.
+type Dataset interface {
+	Columns() []parquet.Column
+	// Check reports whether filters are valid, before the job is queued.
+	Check(filters map[string]string) error
+	// Rows calls fn with up to limit rows matching filters, one value per
+	// column (string, int64, float64, time.Time or nil), stopping at fn's
+	// first error.
+	Rows(ctx context.Context, filters map[string]string, limit int, fn func([]any) error) error
+}
+
+// tripData exports the trips GET /admin/trips finds, newest first.
+type tripData struct{ search *trips.Search }
+
+var tripColumns = []parquet.Column{
+	{Name: "id", Type: parquet.String},
+	{Name: "status", Type: parquet.String},
+	{Name: "created_at", Type: parquet.Timestamp},
+	{Name: "completed_at", Type: parquet.Timestamp},
+	{Name: "cancelled_at", Type: parquet.Timestamp},
+	{Name: "city", Type: parquet.String},
+	{Name: "rider_id", Type: parquet.String},
+	{Name: "rider_name", Type: parquet.String},
+	{Name: "driver_id", Type: parquet.String},
+	{Name: "driver_name", Type: parquet.String},
+	{Name: "vehicle_type", Type: parquet.String},
+	{Name: "pickup_lat", Type: parquet.Double},
+	{Name: "pickup_lng", Type: parquet.Double},
+	{Name: "drop_lat", Type: parquet.Double},
+	{Name: "drop_lng", Type: parquet.Double},
+	{Name: "fare_minor", Type: parquet.Int64},
+	{Name: "currency", Type: parquet.String},
+	{Name: "cancel_reason", Type: parquet.String},
+	{Name: "pickup_km", Type: parquet.Double},
+}
+
+func (tripData) Columns() []parquet.Column { return tripColumns }
+
+func (d tripData) Check(filters map[string]string) error {
+	_, err := d.filter(filters)
+	return err
+}
+
+func (d tripData) Rows(ctx context.Context, filters map[string]string, limit int, fn func([]any) error) error {
+	f, err := d.filter(filters)
+	if err != nil {
+		return err
+	}
+	return d.search.Each(ctx, f, limit, func(t trips.SearchResult) error {
+		row := []any{t.ID, t.Status, t.CreatedAt, timeOrNil(t.CompletedAt), timeOrNil(t.CancelledAt), stringOrNil(t.City),
+			t.RiderID, stringOrNil(t.RiderName), nil, stringOrNil(t.DriverName), stringOrNil(t.VehicleType),
+			t.PickupLat, t.PickupLng, t.DropLat, t.DropLng, nil, nil, stringOrNil(t.CancelReason), nil}
+		if t.DriverID != nil {
+			row[8] = *t.DriverID
+		}
+		if t.Fare != nil {
+			row[15], row[16] = t.Fare.Amount, t.Fare.Currency
+		}
+		if t.PickupKm != nil {
+			row[18] = *t.PickupKm
+		}
+		return fn(row)
+	})
+}
+
+// filter reads filters as the query of GET /admin/trips. Paging is the
+// export's own business, so only the search filters are taken.
+func (tripData) filter(filters map[string]string) (trips.SearchFilter, error) {
+	q := url.Values{}
+	for k, v := range filters {
+		if !slices.Contains(trips.SearchParams, k) {
+			return trips.SearchFilter{}, apierror.Validation(fmt.Sprintf("unknown trip filter %q", k))
+		}
+		q.Set(k, v)
+	}
+	return trips.ParseSearch(q)
+}
+
+func stringOrNil(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func timeOrNil(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return *t
+}
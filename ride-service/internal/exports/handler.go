@@ -0,0 +1,92 @@
+package exports
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/featureflags"
+	"ride-service/pkg/jwt"
+)
+
+// Handler lets staff queue exports and anyone with a signed link download
+// the file.
+type Handler struct {
+	svc   *Service
+	flags *featureflags.Flags
+}
+
+// NewHandler wires a handler to the export service. New exports can be
+// switched off with the api.exports flag.
+func NewHandler(svc *Service, flags *featureflags.Flags) *Handler {
+	return &Handler{svc: svc, flags: flags}
+}
+
+// AdminRoutes returns the routes mounted under /admin/exports.
+func (h *Handler) AdminRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth, jwt.RequireRole("admin", "support"))
+
+	r.With(h.flags.Require(featureflags.ExportsAPI)).Post("/", h.Create)
+	r.Get("/{id}", h.Get)
+
+	return r
+}
+
+// Routes returns the routes mounted at /exports. The download link carries
+// its own signature, so it needs no token.
+func (h *Handler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Get("/{id}/download", h.Download)
+	return r
+}
+
+func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
+	var req Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	j, err := h.svc.Create(r.Context(), jwt.GetClaims(r.Context()).UserID, req)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusAccepted, j)
+}
+
+func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
+	j, err := h.svc.Get(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, j)
+}
+
+// Download serves GET /exports/{id}/download?expires=&sig=, the link in a
+// done job.
+func (h *Handler) Download(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	j, file, err := h.svc.Download(r.Context(), chi.URLParam(r, "id"), q.Get("expires"), q.Get("sig"))
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	defer file.Close()
+	contentType := "text/csv; charset=utf-8"
+	if j.Format == FormatParquet {
+		contentType = "application/vnd.apache.parquet"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.%s"`, j.Dataset, j.ID, j.Format))
+	w.Header().Set("Content-Length", strconv.FormatInt(j.Bytes, 10))
+	if _, err := io.Copy(w, file); err != nil {
+		logger.Warn("export download interrupted", "job", j.ID, "err", err)
+	}
+}
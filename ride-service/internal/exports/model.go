@@ -0,0 +1,50 @@
+package exports
+
+import "time"
+
+// Job states.
+const (
+	StatusQueued  = "queued"
+	StatusRunning = "running"
+	StatusDone    = "done"
+	StatusFailed  = "failed"
+	StatusExpired = "expired" // done, and the file has been deleted
+)
+
+// File formats.
+const (
+	FormatCSV     = "csv"
+	FormatParquet = "parquet"
+)
+
+// Job is a bulk export: the rows of Dataset matching Filters, written as one
+// file. DownloadURL is set on a done job, valid until DownloadExpiresAt.
+type Job struct {
+	ID          string            `json:"id"`
+	RequestedBy string            `json:"requested_by"`
+	Dataset     string            `json:"dataset"`
+	Format      string            `json:"format"`
+	Filters     map[string]string `json:"filters"`
+	Status      string            `json:"status"`
+	Attempts    int               `json:"attempts"`
+	Rows        int64             `json:"rows"`
+	Bytes       int64             `json:"bytes"`
+	// Truncated is set when more rows matched than an export may hold.
+	Truncated         bool       `json:"truncated,omitempty"`
+	Error             string     `json:"error,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	StartedAt         *time.Time `json:"started_at,omitempty"`
+	FinishedAt        *time.Time `json:"finished_at,omitempty"`
+	DownloadURL       string     `json:"download_url,omitempty"`
+	DownloadExpiresAt *time.Time `json:"download_expires_at,omitempty"`
+
+	blobKey string
+}
+
+// Request is the body of POST /admin/exports. Filters are the dataset's
+// search parameters; for trips, those of GET /admin/trips.
+type Request struct {
+	Dataset string            `json:"dataset"`
+	Format  string            `json:"format"` // csv (default) or parquet
+	Filters map[string]string `json:"filters"`
+}
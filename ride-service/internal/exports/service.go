@@ -0,0 +1,418 @@
+// Package exports runs the bulk exports staff queue at /admin/exports. A
+// job names a dataset, its filters and a file format; a worker writes the
+// matching rows to the blob store as one CSV or Parquet file, which is then
+// downloaded through a signed link without a token.
+package exports
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/internal/trips"
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/blob"
+	"ride-service/pkg/config"
+	"ride-service/pkg/logging"
+	"ride-service/pkg/parquet"
+)
+
+var logger = logging.For("exports")
+
+var (
+	ErrNotFound       = apierror.NotFound("export not found")
+	ErrUnknownDataset = apierror.Validation("unknown dataset").WithCode("unknown_dataset")
+	ErrFormat         = apierror.Validation("format must be csv or parquet")
+	ErrBadLink        = apierror.Forbidden("the download link is invalid or has expired").WithCode("export_link_invalid")
+)
+
+// maxAttempts is how many times a job is started before it is failed. A
+// job is retried when its run fails or its worker dies mid-run.
+const maxAttempts = 3
+
+const columns = `j.id,j.requested_by,j.dataset,j.format,j.filters,j.status,j.attempts,j.row_count,j.size_bytes,
+		j.truncated,j.error,j.created_at,j.started_at,j.finished_at,COALESCE(j.blob_key,'')`
+
+// Service queues export jobs, runs them and signs their download links.
+type Service struct {
+	db       *pgxpool.Pool
+	store    blob.Store
+	datasets map[string]Dataset
+	cfg      config.Exports
+}
+
+// NewService creates an export service writing files to store. Trips are
+// exported through search.
+func NewService(db *pgxpool.Pool, store blob.Store, search *trips.Search, cfg config.Exports) *Service {
+	return &Service{db: db, store: store, cfg: cfg, datasets: map[string]Dataset{
+		"trips": tripData{search: search},
+	}}
+}
+
+// Create queues an export of req for staff member requestedBy.
+func (s *Service) Create(ctx context.Context, requestedBy string, req Request) (*Job, error) {
+	dataset := strings.ToLower(strings.TrimSpace(req.Dataset))
+	ds, ok := s.datasets[dataset]
+	if !ok {
+		return nil, ErrUnknownDataset
+	}
+	format := strings.ToLower(strings.TrimSpace(req.Format))
+	if format == "" {
+		format = FormatCSV
+	}
+	if format != FormatCSV && format != FormatParquet {
+		return nil, ErrFormat
+	}
+	if req.Filters == nil {
+		req.Filters = map[string]string{}
+	}
+	if err := ds.Check(req.Filters); err != nil {
+		return nil, err
+	}
+	filters, err := json.Marshal(req.Filters)
+	if err != nil {
+		return nil, err
+	}
+	j := &Job{ID: uuid.NewString(), RequestedBy: requestedBy, Dataset: dataset, Format: format,
+		Filters: req.Filters, Status: StatusQueued}
+	err = s.db.QueryRow(ctx,
+		`INSERT INTO export_jobs (id,requested_by,dataset,format,filters,status) VALUES ($1,$2,$3,$4,$5,$6)
+		 RETURNING created_at`,
+		j.ID, j.RequestedBy, j.Dataset, j.Format, filters, j.Status).Scan(&j.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("export queued", "job", j.ID, "dataset", j.Dataset, "format", j.Format, "by", requestedBy)
+	return j, nil
+}
+
+// Get returns job id, with a fresh download link once it is done.
+func (s *Service) Get(ctx context.Context, id string) (*Job, error) {
+	j, err := s.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if j.Status == StatusDone {
+		s.sign(j)
+	}
+	return j, nil
+}
+
+func (s *Service) get(ctx context.Context, id string) (*Job, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+	j, err := scanJob(s.db.QueryRow(ctx, `SELECT `+columns+` FROM export_jobs j WHERE j.id=$1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return j, err
+}
+
+// sign sets j's download link, valid for LinkTTL from now.
+func (s *Service) sign(j *Job) {
+	expires := time.Now().Add(s.cfg.LinkTTL).Truncate(time.Second)
+	j.DownloadURL = fmt.Sprintf("%s/exports/%s/download?expires=%d&sig=%s",
+		strings.TrimRight(s.cfg.BaseURL, "/"), j.ID, expires.Unix(), s.signature(j.ID, expires.Unix()))
+	j.DownloadExpiresAt = &expires
+}
+
+// signature is the hex HMAC-SHA256 of a link to export id valid until
+// expires (Unix seconds).
+func (s *Service) signature(id string, expires int64) string {
+	mac := hmac.New(sha256.New, []byte(s.cfg.Secret))
+	fmt.Fprintf(mac, "%s|%d", id, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Download opens the file of export id for a link with expires and sig.
+// The caller must close the reader.
+func (s *Service) Download(ctx context.Context, id, expires, sig string) (*Job, io.ReadCloser, error) {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp || !hmac.Equal([]byte(sig), []byte(s.signature(id, exp))) {
+		return nil, nil, ErrBadLink
+	}
+	j, err := s.get(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if j.Status != StatusDone {
+		return nil, nil, ErrNotFound
+	}
+	file, err := s.store.Get(ctx, j.blobKey)
+	if errors.Is(err, blob.ErrNotFound) {
+		return nil, nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return j, file, nil
+}
+
+// Start runs the worker until ctx is cancelled: every PollInterval it runs
+// the queued jobs one after another and deletes files past Retention.
+// Several instances can run it; each claims its own jobs.
+func (s *Service) Start(ctx context.Context) {
+	go func() {
+		t := time.NewTicker(s.cfg.PollInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				s.runQueued(ctx)
+				s.expire(ctx)
+			}
+		}
+	}()
+	logger.Info("export worker started", "interval", s.cfg.PollInterval)
+}
+
+func (s *Service) runQueued(ctx context.Context) {
+	for ctx.Err() == nil {
+		j, err := s.claim(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Error("claim export failed", "err", err)
+			}
+			return
+		}
+		if j == nil {
+			return
+		}
+		if j.Attempts > maxAttempts {
+			s.finish(ctx, j, StatusFailed, "the export was interrupted too many times")
+			continue
+		}
+		s.run(ctx, j)
+	}
+}
+
+// claim takes the oldest queued job, or a running one whose lease ran out,
+// and leases it for a run. It returns nil when there is none.
+func (s *Service) claim(ctx context.Context) (*Job, error) {
+	j, err := scanJob(s.db.QueryRow(ctx,
+		`WITH next AS (
+		   SELECT id FROM export_jobs
+		   WHERE status=$1 OR (status=$2 AND lease_until<NOW())
+		   ORDER BY created_at LIMIT 1 FOR UPDATE SKIP LOCKED)
+		 UPDATE export_jobs j SET status=$2, attempts=j.attempts+1, lease_until=$3, started_at=NOW(), error=''
+		 FROM next WHERE j.id=next.id
+		 RETURNING `+columns,
+		StatusQueued, StatusRunning, time.Now().Add(s.cfg.Timeout+time.Minute)))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	return j, err
+}
+
+// run writes j's file. The rows are streamed through a pipe into the blob
+// store, so only a Parquet row group is held in memory here.
+func (s *Service) run(parent context.Context, j *Job) {
+	ctx, cancel := context.WithTimeout(parent, s.cfg.Timeout)
+	defer cancel()
+	key := fmt.Sprintf("exports/%s.%s", j.ID, j.Format)
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := s.write(ctx, j, pw)
+		pw.CloseWithError(err)
+		done <- err
+	}()
+	file := &counter{r: pr}
+	err := s.store.Put(ctx, key, file)
+	pr.CloseWithError(io.ErrClosedPipe) // unblocks the writer if Put gave up early
+	if werr := <-done; err == nil {
+		err = werr
+	}
+
+	bg := context.WithoutCancel(parent)
+	if err != nil {
+		if delErr := s.store.Delete(bg, key); delErr != nil {
+			logger.Warn("delete partial export failed", "job", j.ID, "err", delErr)
+		}
+		if parent.Err() != nil {
+			// Shutting down: hand the job to the next worker without
+			// counting this attempt.
+			if _, dbErr := s.db.Exec(bg, `UPDATE export_jobs SET status=$2, attempts=attempts-1, lease_until=NULL
+			                              WHERE id=$1`, j.ID, StatusQueued); dbErr != nil {
+				logger.Error("requeue export failed", "job", j.ID, "err", dbErr)
+			}
+			return
+		}
+		logger.Error("export failed", "job", j.ID, "attempt", j.Attempts, "err", err)
+		status := StatusQueued
+		if j.Attempts >= maxAttempts {
+			status = StatusFailed
+		}
+		s.finish(bg, j, status, err.Error())
+		return
+	}
+
+	_, err = s.db.Exec(bg,
+		`UPDATE export_jobs SET status=$2, row_count=$3, size_bytes=$4, truncated=$5, blob_key=$6, error='',
+		        lease_until=NULL, finished_at=NOW()
+		 WHERE id=$1`, j.ID, StatusDone, j.Rows, file.n, j.Truncated, key)
+	if err != nil {
+		logger.Error("record export failed", "job", j.ID, "err", err)
+		return
+	}
+	logger.Info("export done", "job", j.ID, "rows", j.Rows, "bytes", file.n, "truncated", j.Truncated)
+}
+
+// finish records that j stopped with msg: queued again for a retry, or
+// failed.
+func (s *Service) finish(ctx context.Context, j *Job, status, msg string) {
+	var finished *time.Time
+	if status == StatusFailed {
+		now := time.Now()
+		finished = &now
+	}
+	if _, err := s.db.Exec(ctx,
+		`UPDATE export_jobs SET status=$2, error=$3, lease_until=NULL, finished_at=$4 WHERE id=$1`,
+		j.ID, status, msg, finished); err != nil {
+		logger.Error("record export failure failed", "job", j.ID, "err", err)
+	}
+}
+
+// write encodes j's rows to w, at most MaxRows of them, and sets j.Rows and
+// j.Truncated.
+func (s *Service) write(ctx context.Context, j *Job, w io.Writer) error {
+	ds, ok := s.datasets[j.Dataset]
+	if !ok {
+		return fmt.Errorf("exports: unknown dataset %q", j.Dataset)
+	}
+	j.Rows, j.Truncated = 0, false
+	var out rowWriter
+	if j.Format == FormatParquet {
+		out = parquet.NewWriter(w, ds.Columns())
+	} else {
+		out = newCSVWriter(w, ds.Columns())
+	}
+	err := ds.Rows(ctx, j.Filters, s.cfg.MaxRows+1, func(row []any) error {
+		if j.Rows == int64(s.cfg.MaxRows) {
+			j.Truncated = true
+			return nil
+		}
+		j.Rows++
+		return out.Write(row)
+	})
+	if err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// expire deletes the files of jobs finished more than Retention ago.
+func (s *Service) expire(ctx context.Context) {
+	rows, err := s.db.Query(ctx,
+		`SELECT id, blob_key FROM export_jobs WHERE status=$1 AND finished_at<$2 ORDER BY finished_at LIMIT 100`,
+		StatusDone, time.Now().Add(-s.cfg.Retention))
+	if err != nil {
+		logger.Error("list expired exports failed", "err", err)
+		return
+	}
+	type stale struct{ id, key string }
+	var due []stale
+	for rows.Next() {
+		var st stale
+		if err := rows.Scan(&st.id, &st.key); err != nil {
+			rows.Close()
+			logger.Error("list expired exports failed", "err", err)
+			return
+		}
+		due = append(due, st)
+	}
+	rows.Close()
+	for _, st := range due {
+		if err := s.store.Delete(ctx, st.key); err != nil {
+			logger.Warn("delete expired export failed", "job", st.id, "err", err)
+			continue
+		}
+		if _, err := s.db.Exec(ctx, `UPDATE export_jobs SET status=$2, blob_key=NULL WHERE id=$1`, st.id, StatusExpired); err != nil {
+			logger.Error("expire export failed", "job", st.id, "err", err)
+		}
+	}
+}
+
+// rowWriter encodes rows of typed values as one file format.
+type rowWriter interface {
+	Write(row []any) error
+	Close() error
+}
+
+// csvWriter writes rows as CSV under a header of the column names.
+// Timestamps are RFC 3339 in UTC and nulls empty.
+type csvWriter struct{ w *csv.Writer }
+
+func newCSVWriter(w io.Writer, cols []parquet.Column) *csvWriter {
+	c := &csvWriter{w: csv.NewWriter(w)}
+	header := make([]string, len(cols))
+	for i, col := range cols {
+		header[i] = col.Name
+	}
+	_ = c.w.Write(header) // errors stay in the writer until Close
+	return c
+}
+
+func (c *csvWriter) Write(row []any) error {
+	record := make([]string, len(row))
+	for i, v := range row {
+		switch x := v.(type) {
+		case string:
+			record[i] = x
+		case int64:
+			record[i] = strconv.FormatInt(x, 10)
+		case float64:
+			record[i] = strconv.FormatFloat(x, 'f', -1, 64)
+		case time.Time:
+			record[i] = x.UTC().Format(time.RFC3339)
+		}
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// counter counts the bytes read through it.
+type counter struct {
+	r io.Reader
+	n int64
+}
+
+func (c *counter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func scanJob(row pgx.Row) (*Job, error) {
+	var j Job
+	var filters []byte
+	if err := row.Scan(&j.ID, &j.RequestedBy, &j.Dataset, &j.Format, &filters, &j.Status, &j.Attempts, &j.Rows,
+		&j.Bytes, &j.Truncated, &j.Error, &j.CreatedAt, &j.StartedAt, &j.FinishedAt, &j.blobKey); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(filters, &j.Filters); err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
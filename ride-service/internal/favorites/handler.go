@@ -0,0 +1,63 @@
+package favorites
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+)
+
+// Handler lets riders keep their favorite drivers.
+type Handler struct{ svc *Service }
+
+// NewHandler wires a handler to the favorites service.
+func NewHandler(svc *Service) *Handler { return &Handler{svc: svc} }
+
+// TripRoutes returns the routes mounted at /trips/{id}/favorite.
+func (h *Handler) TripRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth, jwt.RequireRole("rider"))
+
+	r.Post("/", h.Add)
+
+	return r
+}
+
+// Routes returns the routes mounted at /favorites: the caller's favorites.
+func (h *Handler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth, jwt.RequireRole("rider"))
+
+	r.Get("/", h.Mine)
+	r.Delete("/{id}", h.Remove)
+
+	return r
+}
+
+func (h *Handler) Add(w http.ResponseWriter, r *http.Request) {
+	f, err := h.svc.Add(r.Context(), chi.URLParam(r, "id"), jwt.GetClaims(r.Context()).UserID)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusCreated, f)
+}
+
+func (h *Handler) Mine(w http.ResponseWriter, r *http.Request) {
+	l, err := h.svc.Mine(r.Context(), jwt.GetClaims(r.Context()).UserID)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, l)
+}
+
+func (h *Handler) Remove(w http.ResponseWriter, r *http.Request) {
+	if err := h.svc.Remove(r.Context(), chi.URLParam(r, "id"), jwt.GetClaims(r.Context()).UserID); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]string{"status": "removed"})
+}
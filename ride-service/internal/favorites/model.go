@@ -0,0 +1,23 @@
+package favorites
+
+import "time"
+
+// MaxFavorites caps how many favorite drivers a rider keeps.
+const MaxFavorites = 20
+
+// Favorite is a driver a rider wants to ride with again: when they are in
+// the matching pool near the rider's pickup, they are offered the trip
+// before anyone else.
+type Favorite struct {
+	ID         string    `json:"id"`
+	RiderID    string    `json:"rider_id"`
+	DriverID   string    `json:"driver_id"`
+	DriverName string    `json:"driver_name"`
+	TripID     string    `json:"trip_id"` // the completed trip they were favorited from
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// List is the rider's favorites for GET /favorites, newest first.
+type List struct {
+	Favorites []Favorite `json:"favorites"`
+}
@@ -0,0 +1,134 @@
+// Package favorites keeps the drivers riders marked as favorites. The
+// matcher offers a rider's trip to a favorite driver nearby first.
+package favorites
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/internal/trips"
+	"ride-service/pkg/apierror"
+)
+
+var (
+	ErrTripNotFound     = apierror.NotFound("trip not found")
+	ErrNotFound         = apierror.NotFound("favorite not found")
+	ErrNotRider         = apierror.Forbidden("only the trip's rider can favorite its driver")
+	ErrNotCompleted     = apierror.Conflict("only a driver from a completed trip can be a favorite").WithCode("trip_not_completed")
+	ErrAlreadyFavorite  = apierror.Conflict("driver is already a favorite").WithCode("already_favorite")
+	ErrTooManyFavorites = apierror.Conflict(fmt.Sprintf("at most %d favorite drivers", MaxFavorites)).WithCode("too_many_favorites")
+)
+
+const columns = `f.id,f.rider_id,f.driver_id,d.name,f.trip_id,f.created_at`
+
+// TripReader returns trips; trips.TripRepo implements it.
+type TripReader interface {
+	GetByID(ctx context.Context, id string) (*trips.Trip, error)
+}
+
+// Service keeps riders' favorite drivers. A driver is favorited from a trip
+// the rider completed with them; the matcher asks Favorites for the drivers
+// to offer a rider's trip first.
+type Service struct {
+	db    *pgxpool.Pool
+	trips TripReader
+}
+
+// NewService creates a favorites service.
+func NewService(db *pgxpool.Pool, t TripReader) *Service {
+	return &Service{db: db, trips: t}
+}
+
+// Add makes the driver of riderID's completed trip tripID one of their
+// favorites.
+func (s *Service) Add(ctx context.Context, tripID, riderID string) (*Favorite, error) {
+	t, err := s.trips.GetByID(ctx, tripID)
+	if errors.Is(err, trips.ErrNotFound) {
+		return nil, ErrTripNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	switch {
+	case t.RiderID != riderID:
+		return nil, ErrNotRider
+	case t.Status != trips.StatusCompleted || t.DriverID == nil:
+		return nil, ErrNotCompleted
+	}
+	var n int
+	if err := s.db.QueryRow(ctx, `SELECT COUNT(*) FROM favorite_drivers WHERE rider_id=$1`, riderID).Scan(&n); err != nil {
+		return nil, err
+	}
+	if n >= MaxFavorites {
+		return nil, ErrTooManyFavorites
+	}
+	f, err := scanFavorite(s.db.QueryRow(ctx,
+		`WITH f AS (
+		   INSERT INTO favorite_drivers (id,rider_id,driver_id,trip_id) VALUES ($1,$2,$3,$4)
+		   ON CONFLICT (rider_id,driver_id) DO NOTHING RETURNING *)
+		 SELECT `+columns+` FROM f JOIN drivers d ON d.id=f.driver_id`,
+		uuid.New().String(), riderID, *t.DriverID, tripID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrAlreadyFavorite
+	}
+	return f, err
+}
+
+// Mine returns riderID's favorites, newest first.
+func (s *Service) Mine(ctx context.Context, riderID string) (*List, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT `+columns+` FROM favorite_drivers f JOIN drivers d ON d.id=f.driver_id
+		 WHERE f.rider_id=$1 ORDER BY f.created_at DESC, f.id`, riderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	l := &List{Favorites: []Favorite{}}
+	for rows.Next() {
+		f, err := scanFavorite(rows)
+		if err != nil {
+			return nil, err
+		}
+		l.Favorites = append(l.Favorites, *f)
+	}
+	return l, rows.Err()
+}
+
+// Remove drops a favorite riderID made.
+func (s *Service) Remove(ctx context.Context, id, riderID string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrNotFound
+	}
+	tag, err := s.db.Exec(ctx, `DELETE FROM favorite_drivers WHERE id=$1 AND rider_id=$2`, id, riderID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Favorites returns the IDs of riderID's favorite drivers.
+func (s *Service) Favorites(ctx context.Context, riderID string) ([]string, error) {
+	if _, err := uuid.Parse(riderID); err != nil {
+		return nil, nil
+	}
+	rows, err := s.db.Query(ctx, `SELECT driver_id FROM favorite_drivers WHERE rider_id=$1`, riderID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+func scanFavorite(row pgx.Row) (*Favorite, error) {
+	var f Favorite
+	if err := row.Scan(&f.ID, &f.RiderID, &f.DriverID, &f.DriverName, &f.TripID, &f.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
@@ -0,0 +1,80 @@
+package fraud
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+)
+
+// Handler exposes the fraud review queue to admins.
+type Handler struct{ svc *Service }
+
+// NewHandler wires a handler to the fraud service.
+func NewHandler(svc *Service) *Handler { return &Handler{svc: svc} }
+
+// AdminRoutes returns the routes mounted under /admin/fraud.
+func (h *Handler) AdminRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth, jwt.RequireRole("admin"))
+
+	r.Get("/", h.List)
+	r.Get("/{id}", h.Get)
+	r.Post("/{id}/review", h.Review)
+
+	return r
+}
+
+// List serves GET /admin/fraud?status=&rule=&subject_type=&subject_id=&limit=&offset=.
+// status defaults to open; status=all lists every flag.
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := Filter{Status: q.Get("status"), Rule: q.Get("rule"), SubjectType: q.Get("subject_type"), SubjectID: q.Get("subject_id")}
+	switch f.Status {
+	case "":
+		f.Status = StatusOpen
+	case "all":
+		f.Status = ""
+	}
+	limit := 50
+	if v, err := strconv.Atoi(q.Get("limit")); err == nil && v > 0 && v <= 200 {
+		limit = v
+	}
+	offset := 0
+	if v, err := strconv.Atoi(q.Get("offset")); err == nil && v > 0 {
+		offset = v
+	}
+	page, err := h.svc.List(r.Context(), f, limit, offset)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, page)
+}
+
+func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
+	f, err := h.svc.Get(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, f)
+}
+
+func (h *Handler) Review(w http.ResponseWriter, r *http.Request) {
+	var req ReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	f, err := h.svc.Review(r.Context(), chi.URLParam(r, "id"), jwt.GetClaims(r.Context()).UserID, req)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, f)
+}
@@ -0,0 +1,72 @@
+package fraud
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Rules.
+const (
+	RuleTeleport      = "teleport"        // GPS jump during a trip
+	RuleCollusion     = "collusion"       // the same rider and driver keep riding together
+	RuleCancellations = "cancellations"   // a driver cancels too many accepted trips
+	RuleFare          = "fare"            // fare far above the route, or an impossible speed
+	RuleLongTrip      = "long_trip"       // a trip STARTED for implausibly long
+	RuleDeviation     = "route_deviation" // the driver left the planned route
+)
+
+// Rules lists every rule.
+var Rules = []string{RuleTeleport, RuleCollusion, RuleCancellations, RuleFare, RuleLongTrip, RuleDeviation}
+
+// What a flag is about.
+const (
+	SubjectTrip   = "trip"
+	SubjectDriver = "driver"
+	SubjectRider  = "rider"
+)
+
+// Review states.
+const (
+	StatusOpen      = "open"
+	StatusConfirmed = "confirmed"
+	StatusDismissed = "dismissed"
+)
+
+// Flag is one rule hit in the review queue.
+type Flag struct {
+	ID          string          `json:"id"`
+	Rule        string          `json:"rule"`
+	SubjectType string          `json:"subject_type"`
+	SubjectID   string          `json:"subject_id"`
+	TripID      *string         `json:"trip_id,omitempty"`
+	DriverID    *string         `json:"driver_id,omitempty"`
+	RiderID     *string         `json:"rider_id,omitempty"`
+	Details     json.RawMessage `json:"details"` // what the rule saw
+	Status      string          `json:"status"`
+	ReviewedBy  *string         `json:"reviewed_by,omitempty"`
+	ReviewNote  *string         `json:"review_note,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	ReviewedAt  *time.Time      `json:"reviewed_at,omitempty"`
+}
+
+// Filter narrows GET /admin/fraud. Empty fields match everything.
+type Filter struct {
+	Status      string
+	Rule        string
+	SubjectType string
+	SubjectID   string
+}
+
+// Page is a page of GET /admin/fraud, newest first.
+type Page struct {
+	Flags  []Flag `json:"flags"`
+	Total  int    `json:"total"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+}
+
+// ReviewRequest is the body for POST /admin/fraud/{id}/review.
+type ReviewRequest struct {
+	Status string `json:"status"` // confirmed | dismissed
+	Note   string `json:"note"`
+}
@@ -0,0 +1,447 @@
+package fraud
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/internal/events"
+	"ride-service/internal/pricing"
+	"ride-service/internal/trips"
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/config"
+	"ride-service/pkg/eventbus"
+	"ride-service/pkg/logging"
+	rredis "ride-service/pkg/redis"
+)
+
+var logger = logging.For("fraud")
+
+var (
+	ErrNotFound      = apierror.NotFound("fraud flag not found")
+	ErrInvalid       = apierror.Validation("invalid review")
+	ErrAlreadyClosed = apierror.Conflict("fraud flag already reviewed")
+)
+
+// pingTTL is how long a driver's last ping is kept to compare the next one
+// with.
+const pingTTL = 10 * time.Minute
+
+const flagColumns = `id,rule,subject_type,subject_id,trip_id,driver_id,rider_id,details,status,reviewed_by,review_note,created_at,reviewed_at`
+
+// TripReader returns trips; trips.TripRepo implements it.
+type TripReader interface {
+	GetByID(ctx context.Context, id string) (*trips.Trip, error)
+	ListActiveByDrivers(ctx context.Context, driverIDs []string) ([]trips.Trip, error)
+}
+
+// Service evaluates the fraud rules and keeps the review queue.
+//
+// Rules run as data arrives: teleportation on driver location updates, the
+// others on Kafka events. A hit is written to fraud_flags once, however
+// often its event is delivered.
+type Service struct {
+	db      *pgxpool.Pool
+	trips   TripReader
+	redis   *rredis.Client
+	pricing *pricing.Service
+	cfg     config.Fraud
+}
+
+// NewService creates a fraud service. pricing is used to tell what a route
+// should cost.
+func NewService(db *pgxpool.Pool, t TripReader, redis *rredis.Client, pricing *pricing.Service, cfg config.Fraud) *Service {
+	return &Service{db: db, trips: t, redis: redis, pricing: pricing, cfg: cfg}
+}
+
+// DriverMoved checks the jump from the driver's previous ping. A jump faster
+// than the configured speed while the driver has a trip in progress flags
+// the trip.
+func (s *Service) DriverMoved(ctx context.Context, driverID string, lat, lng float64) {
+	now := time.Now()
+	prev, ok, err := s.redis.SwapLastPing(ctx, driverID, rredis.Ping{Lat: lat, Lng: lng, At: now}, pingTTL)
+	if err != nil {
+		logger.Warn("last ping swap failed", "driver", driverID, "err", err)
+		return
+	}
+	if !ok {
+		return
+	}
+	km := haversineKm(prev.Lat, prev.Lng, lat, lng)
+	secs := now.Sub(prev.At).Seconds()
+	if km < s.cfg.TeleportMinKm || secs <= 0 {
+		return
+	}
+	kmh := km / (secs / 3600)
+	if kmh <= s.cfg.TeleportSpeedKmh {
+		return
+	}
+	active, err := s.trips.ListActiveByDrivers(ctx, []string{driverID})
+	if err != nil {
+		logger.Warn("active trip lookup failed", "driver", driverID, "err", err)
+		return
+	}
+	// STARTED trips come first.
+	if len(active) == 0 || active[0].Status != trips.StatusStarted {
+		return // not on a trip: a phone left on a plane is not fraud
+	}
+	tripID, riderID := active[0].ID, active[0].RiderID
+	s.raise(ctx, Flag{
+		Rule: RuleTeleport, SubjectType: SubjectTrip, SubjectID: tripID,
+		TripID: &tripID, DriverID: &driverID, RiderID: &riderID,
+	}, RuleTeleport+":"+tripID, map[string]any{
+		"from":        []float64{prev.Lat, prev.Lng},
+		"to":          []float64{lat, lng},
+		"km":          round2(km),
+		"seconds":     round2(secs),
+		"speed_kmh":   round2(kmh),
+		"limit_kmh":   s.cfg.TeleportSpeedKmh,
+		"observed_at": now.UTC(),
+	})
+}
+
+// DriverLeft forgets the driver's last ping, so coming back online elsewhere
+// is not a jump.
+func (s *Service) DriverLeft(ctx context.Context, driverID string) {
+	if err := s.redis.ClearLastPing(ctx, driverID); err != nil {
+		logger.Warn("last ping clear failed", "driver", driverID, "err", err)
+	}
+}
+
+// Start evaluates the event rules: collusion and fare anomalies on
+// trip.completed, excessive cancellations on ride.requested (a driver's
+// cancellation re-requests the trip). Flags are idempotent, so failures are
+// returned for the consumer to retry.
+func (s *Service) Start(ctx context.Context, bus eventbus.Bus) {
+	bus.Subscribe(ctx, eventbus.TopicTripCompleted, "fraud-trip-completed", func(ctx context.Context, data []byte) error {
+		var ev events.TripCompletedEvent
+		env, err := events.Unwrap(data, &ev)
+		if errors.Is(err, events.ErrUnsupportedVersion) {
+			logger.Warn("skipping event", "event_id", env.EventID, "err", err)
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !validIDs(ev.TripID, ev.DriverID, ev.RiderID) {
+			logger.Warn("skipping trip.completed with bad ids", "trip", ev.TripID)
+			return nil
+		}
+		if err := s.checkCollusion(ctx, ev); err != nil {
+			return err
+		}
+		return s.checkFare(ctx, ev)
+	})
+
+	bus.Subscribe(ctx, eventbus.TopicRideRequested, "fraud-ride-requested", func(ctx context.Context, data []byte) error {
+		var ev events.RideRequestedEvent
+		env, err := events.Unwrap(data, &ev)
+		if errors.Is(err, events.ErrUnsupportedVersion) {
+			logger.Warn("skipping event", "event_id", env.EventID, "err", err)
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if ev.Retry > 0 || len(ev.ExcludeDrivers) == 0 || !validIDs(ev.ExcludeDrivers...) {
+			return nil
+		}
+		return s.checkCancellations(ctx, ev.ExcludeDrivers)
+	})
+}
+
+// checkCollusion flags a rider and driver who completed too many trips
+// together recently.
+func (s *Service) checkCollusion(ctx context.Context, ev events.TripCompletedEvent) error {
+	since := time.Now().Add(-s.cfg.CollusionWindow)
+	var n int
+	if err := s.db.QueryRow(ctx,
+		`SELECT COUNT(*) FROM trips WHERE rider_id=$1 AND driver_id=$2 AND status=$3 AND completed_at > $4`,
+		ev.RiderID, ev.DriverID, trips.StatusCompleted, since).Scan(&n); err != nil {
+		return err
+	}
+	if n < s.cfg.CollusionTrips {
+		return nil
+	}
+	return s.flag(ctx, Flag{
+		Rule: RuleCollusion, SubjectType: SubjectDriver, SubjectID: ev.DriverID,
+		TripID: &ev.TripID, DriverID: &ev.DriverID, RiderID: &ev.RiderID,
+	}, fmt.Sprintf("%s:%s:%s:%s", RuleCollusion, ev.DriverID, ev.RiderID, day()), map[string]any{
+		"trips_together": n,
+		"window":         s.cfg.CollusionWindow.String(),
+		"limit":          s.cfg.CollusionTrips,
+	})
+}
+
+// checkFare flags a fare far above what the straight-line route costs, or a
+// charged distance the trip could not have covered in its duration.
+func (s *Service) checkFare(ctx context.Context, ev events.TripCompletedEvent) error {
+	t, err := s.trips.GetByID(ctx, ev.TripID)
+	if errors.Is(err, trips.ErrNotFound) {
+		logger.Warn("trip.completed for unknown trip", "trip", ev.TripID)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var city, vehicleType string
+	if t.DriverID != nil {
+		err = s.db.QueryRow(ctx,
+			`SELECT COALESCE(d.city,''), COALESCE(v.type,'') FROM drivers d LEFT JOIN vehicles v ON v.id=d.active_vehicle_id WHERE d.id=$1`,
+			*t.DriverID).Scan(&city, &vehicleType)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+	}
+
+	// Surcharges do not depend on the route; compare the distance fare.
+	fare := ev.FareAmount()
+	for _, l := range ev.Surcharges {
+		fare.Amount -= l.Amount.Amount
+	}
+	// Compare with the fare rule the trip was priced with, or for trips
+	// priced before rules were versioned, the one in force.
+	var rate config.Rate
+	if t.PricingVersion != nil {
+		rate, err = s.pricing.Version(ctx, *t.PricingVersion, vehicleType)
+	} else {
+		var q pricing.Quote
+		q, err = s.pricing.For(ctx, city, vehicleType)
+		rate = q.Rate
+	}
+	if err != nil {
+		return err
+	}
+	if rate.Base.Currency != fare.Currency {
+		// Priced before the city's currency changed; nothing to compare with.
+		return nil
+	}
+	details := map[string]any{"fare": fare}
+	var reasons []string
+	straightKm := trips.RouteKm(t)
+	expected := rate.Fare(straightKm)
+	if expected.Amount > 0 && float64(fare.Amount) > s.cfg.FareMaxRatio*float64(expected.Amount) {
+		reasons = append(reasons, "fare above route")
+		details["straight_line_km"] = round2(straightKm)
+		details["straight_line_fare"] = expected
+		details["ratio"] = round2(float64(fare.Amount) / float64(expected.Amount))
+	}
+	if rate.PerKm.Amount > 0 && ev.DurationSeconds > 0 {
+		chargedKm := float64(fare.Amount-rate.Base.Amount) / float64(rate.PerKm.Amount)
+		if kmh := chargedKm / (float64(ev.DurationSeconds) / 3600); kmh > s.cfg.TeleportSpeedKmh {
+			reasons = append(reasons, "impossible speed")
+			details["charged_km"] = round2(chargedKm)
+			details["duration_seconds"] = ev.DurationSeconds
+			details["speed_kmh"] = round2(kmh)
+		}
+	}
+	if len(reasons) == 0 {
+		return nil
+	}
+	details["reasons"] = reasons
+	return s.flag(ctx, Flag{
+		Rule: RuleFare, SubjectType: SubjectTrip, SubjectID: ev.TripID,
+		TripID: &ev.TripID, DriverID: &ev.DriverID, RiderID: &ev.RiderID,
+	}, RuleFare+":"+ev.TripID, details)
+}
+
+// checkCancellations flags the given drivers if they cancelled too many
+// accepted trips recently.
+func (s *Service) checkCancellations(ctx context.Context, driverIDs []string) error {
+	rows, err := s.db.Query(ctx,
+		`SELECT driver_id, COUNT(*) FROM driver_offers
+		 WHERE driver_id = ANY($1) AND status=$2 AND cancelled_at > $3
+		 GROUP BY driver_id HAVING COUNT(*) >= $4`,
+		driverIDs, trips.OfferCancelled, time.Now().Add(-s.cfg.CancellationWindow), s.cfg.CancellationLimit)
+	if err != nil {
+		return err
+	}
+	counts := map[string]int{}
+	for rows.Next() {
+		var id string
+		var n int
+		if err := rows.Scan(&id, &n); err != nil {
+			rows.Close()
+			return err
+		}
+		counts[id] = n
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for id, n := range counts {
+		if err := s.flag(ctx, Flag{
+			Rule: RuleCancellations, SubjectType: SubjectDriver, SubjectID: id, DriverID: &id,
+		}, fmt.Sprintf("%s:%s:%s", RuleCancellations, id, day()), map[string]any{
+			"cancellations": n,
+			"window":        s.cfg.CancellationWindow.String(),
+			"limit":         s.cfg.CancellationLimit,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FlagLongTrip queues a trip that has been STARTED for longer than limit,
+// once, for the trips watchdog.
+func (s *Service) FlagLongTrip(ctx context.Context, tripID, driverID, riderID string, startedAt time.Time, limit time.Duration) error {
+	if !validIDs(tripID, driverID, riderID) {
+		return nil
+	}
+	return s.flag(ctx, Flag{Rule: RuleLongTrip, SubjectType: SubjectTrip, SubjectID: tripID, TripID: &tripID, DriverID: &driverID, RiderID: &riderID},
+		RuleLongTrip+":"+tripID, map[string]any{
+			"started_at":    startedAt.UTC().Format(time.RFC3339),
+			"running_hours": round2(time.Since(startedAt).Hours()),
+			"limit_hours":   round2(limit.Hours()),
+		})
+}
+
+// FlagDeviation queues a trip whose driver left the planned route, once, for
+// the route monitor. Later deviations on the trip are in its record, not
+// flagged again.
+func (s *Service) FlagDeviation(ctx context.Context, tripID, driverID, riderID, deviationID string, maxKm float64, startedAt time.Time) error {
+	if !validIDs(tripID, driverID, riderID) {
+		return nil
+	}
+	return s.flag(ctx, Flag{Rule: RuleDeviation, SubjectType: SubjectTrip, SubjectID: tripID, TripID: &tripID, DriverID: &driverID, RiderID: &riderID},
+		RuleDeviation+":"+tripID, map[string]any{
+			"deviation_id": deviationID,
+			"started_at":   startedAt.UTC().Format(time.RFC3339),
+			"max_km":       maxKm,
+		})
+}
+
+// flag writes f unless a flag with key exists.
+func (s *Service) flag(ctx context.Context, f Flag, key string, details map[string]any) error {
+	raw, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+	tag, err := s.db.Exec(ctx,
+		`INSERT INTO fraud_flags (id,rule,subject_type,subject_id,trip_id,driver_id,rider_id,details,dedupe_key)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9) ON CONFLICT (dedupe_key) DO NOTHING`,
+		uuid.New().String(), f.Rule, f.SubjectType, f.SubjectID, f.TripID, f.DriverID, f.RiderID, raw, key)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 1 {
+		logger.Warn("fraud flag raised", "rule", f.Rule, "subject_type", f.SubjectType, "subject", f.SubjectID)
+	}
+	return nil
+}
+
+// raise is flag for callers that cannot retry.
+func (s *Service) raise(ctx context.Context, f Flag, key string, details map[string]any) {
+	if err := s.flag(ctx, f, key, details); err != nil {
+		logger.Error("fraud flag write failed", "rule", f.Rule, "subject", f.SubjectID, "err", err)
+	}
+}
+
+// List returns one page of flags matching f, newest first.
+func (s *Service) List(ctx context.Context, f Filter, limit, offset int) (*Page, error) {
+	if f.Rule != "" && !slices.Contains(Rules, f.Rule) {
+		return nil, fmt.Errorf("%w: unknown rule %q", ErrInvalid, f.Rule)
+	}
+	if f.SubjectID != "" {
+		if _, err := uuid.Parse(f.SubjectID); err != nil {
+			return nil, fmt.Errorf("%w: subject_id must be a UUID", ErrInvalid)
+		}
+	}
+	where := `($1='' OR status=$1) AND ($2='' OR rule=$2) AND ($3='' OR subject_type=$3) AND ($4='' OR subject_id::text=$4)`
+	args := []any{f.Status, f.Rule, f.SubjectType, f.SubjectID}
+	p := &Page{Flags: []Flag{}, Limit: limit, Offset: offset}
+	if err := s.db.QueryRow(ctx, `SELECT COUNT(*) FROM fraud_flags WHERE `+where, args...).Scan(&p.Total); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(ctx,
+		`SELECT `+flagColumns+` FROM fraud_flags WHERE `+where+` ORDER BY created_at DESC, id LIMIT $5 OFFSET $6`,
+		append(args, limit, offset)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		fl, err := scanFlag(rows)
+		if err != nil {
+			return nil, err
+		}
+		p.Flags = append(p.Flags, *fl)
+	}
+	return p, rows.Err()
+}
+
+// Get returns one flag.
+func (s *Service) Get(ctx context.Context, id string) (*Flag, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+	f, err := scanFlag(s.db.QueryRow(ctx, `SELECT `+flagColumns+` FROM fraud_flags WHERE id=$1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// Review closes an open flag as confirmed or dismissed.
+func (s *Service) Review(ctx context.Context, id, actorID string, req ReviewRequest) (*Flag, error) {
+	if req.Status != StatusConfirmed && req.Status != StatusDismissed {
+		return nil, fmt.Errorf("%w: status must be %s or %s", ErrInvalid, StatusConfirmed, StatusDismissed)
+	}
+	note := strings.TrimSpace(req.Note)
+	if len(note) > 2000 {
+		return nil, fmt.Errorf("%w: note is at most 2000 characters", ErrInvalid)
+	}
+	if _, err := s.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	f, err := scanFlag(s.db.QueryRow(ctx,
+		`UPDATE fraud_flags SET status=$2, reviewed_by=$3, review_note=NULLIF($4,''), reviewed_at=NOW()
+		 WHERE id=$1 AND status=$5 RETURNING `+flagColumns,
+		id, req.Status, actorID, note, StatusOpen))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrAlreadyClosed
+	}
+	return f, err
+}
+
+func scanFlag(row pgx.Row) (*Flag, error) {
+	var f Flag
+	if err := row.Scan(&f.ID, &f.Rule, &f.SubjectType, &f.SubjectID, &f.TripID, &f.DriverID, &f.RiderID, &f.Details,
+		&f.Status, &f.ReviewedBy, &f.ReviewNote, &f.CreatedAt, &f.ReviewedAt); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func validIDs(ids ...string) bool {
+	for _, id := range ids {
+		if _, err := uuid.Parse(id); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// day is the UTC date account-level flags are keyed by, so an account is
+// flagged at most once a day per rule.
+func day() string { return time.Now().UTC().Format(time.DateOnly) }
+
+func haversineKm(lat1, lng1, lat2, lng2 float64) float64 {
+	const R = 6371.0
+	dLat := (lat2 - lat1) * math.Pi / 180
+	dLng := (lng2 - lng1) * math.Pi / 180
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*
+			math.Sin(dLng/2)*math.Sin(dLng/2)
+	return R * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+func round2(v float64) float64 { return math.Round(v*100) / 100 }
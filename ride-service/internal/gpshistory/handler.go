@@ -0,0 +1,56 @@
+package gpshistory
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+)
+
+// Handler exposes GPS exports and the archiver's stats to admins.
+type Handler struct{ svc *Service }
+
+// NewHandler wires a handler to the GPS history service.
+func NewHandler(svc *Service) *Handler { return &Handler{svc: svc} }
+
+// ExportRoutes returns the dispute routes, mounted at /admin/trips/{id}/gps.
+func (h *Handler) ExportRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth, jwt.RequireRole("admin"))
+
+	r.Get("/", h.Export)
+
+	return r
+}
+
+// AdminRoutes returns the routes mounted under /admin/gps-history.
+func (h *Handler) AdminRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth, jwt.RequireRole("admin"))
+
+	r.Get("/", h.Stats)
+
+	return r
+}
+
+// Export requires ?incident_id= so every export is tied to an investigation.
+func (h *Handler) Export(w http.ResponseWriter, r *http.Request) {
+	incidentID := r.URL.Query().Get("incident_id")
+	if incidentID == "" {
+		apierror.Write(w, apierror.Validation("incident_id is required"))
+		return
+	}
+	claims := jwt.GetClaims(r.Context())
+	e, err := h.svc.ExportForIncident(r.Context(), chi.URLParam(r, "id"), claims.UserID, incidentID)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, e)
+}
+
+func (h *Handler) Stats(w http.ResponseWriter, r *http.Request) {
+	apierror.WriteJSON(w, http.StatusOK, h.svc.Stats())
+}
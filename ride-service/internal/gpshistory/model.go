@@ -0,0 +1,30 @@
+package gpshistory
+
+import "time"
+
+// Point is one raw location ping as archived. The driver is in the batch's
+// blob key, not in each point.
+type Point struct {
+	Lat float64   `json:"lat"`
+	Lng float64   `json:"lng"`
+	TS  time.Time `json:"ts"`
+}
+
+// Export is a trip's raw GPS trace, for disputes: every ping its driver sent
+// between the ride request and completion, oldest first.
+type Export struct {
+	TripID   string    `json:"trip_id"`
+	DriverID string    `json:"driver_id"`
+	From     time.Time `json:"from"`
+	To       time.Time `json:"to"`
+	Points   []Point   `json:"points"`
+}
+
+// Stats describes the archiver's buffer and its last flush.
+type Stats struct {
+	Buffered     int        `json:"buffered"`      // pings waiting for the next flush
+	Dropped      int64      `json:"dropped"`       // pings lost to a full buffer since start
+	Batches      int64      `json:"batches"`       // batches written since start
+	FailedWrites int64      `json:"failed_writes"` // batch writes that failed and were retried
+	LastFlushAt  *time.Time `json:"last_flush_at,omitempty"`
+}
@@ -0,0 +1,256 @@
+// Package gpshistory archives raw driver location pings to the blob store
+// and exports a trip's trace for disputes.
+package gpshistory
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/internal/trips"
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/blob"
+	"ride-service/pkg/config"
+	"ride-service/pkg/logging"
+)
+
+var logger = logging.For("gpshistory")
+
+var (
+	ErrTripNotFound = apierror.NotFound("trip not found")
+	ErrNoDriver     = apierror.Conflict("trip never had a driver")
+)
+
+// dayLayout partitions blob keys and gps_batches by UTC date.
+const dayLayout = "2006-01-02"
+
+// batchKey identifies the pings of one driver on one day.
+type batchKey struct {
+	driverID string
+	day      string
+}
+
+// Service buffers location pings in memory and writes them to the blob store
+// once per flush interval, one gzipped JSON-lines object per driver and day
+// under gps/<day>/<driver>/. Each object is indexed in gps_batches. Pings
+// still buffered when the process dies are lost; Flush on shutdown writes
+// them out.
+type Service struct {
+	db    *pgxpool.Pool
+	trips TripReader
+	blobs blob.Store
+	cfg   config.GPSHistory
+
+	mu       sync.Mutex
+	buf      map[batchKey][]Point
+	buffered int
+	stats    Stats
+}
+
+// TripReader returns trips; trips.TripRepo implements it.
+type TripReader interface {
+	GetByID(ctx context.Context, id string) (*trips.Trip, error)
+}
+
+// NewService creates the archiver. Start it to begin flushing.
+func NewService(db *pgxpool.Pool, t TripReader, blobs blob.Store, cfg config.GPSHistory) *Service {
+	return &Service{db: db, trips: t, blobs: blobs, cfg: cfg, buf: map[batchKey][]Point{}}
+}
+
+// DriverMoved buffers an online driver's location update. Once the buffer
+// holds MaxBuffered pings, new ones are dropped until the next flush.
+func (s *Service) DriverMoved(_ context.Context, driverID string, lat, lng float64) {
+	now := time.Now().UTC()
+	k := batchKey{driverID: driverID, day: now.Format(dayLayout)}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.buffered >= s.cfg.MaxBuffered {
+		s.stats.Dropped++
+		return
+	}
+	s.buf[k] = append(s.buf[k], Point{Lat: lat, Lng: lng, TS: now})
+	s.buffered++
+}
+
+// DriverLeft does nothing; the history keeps the last ping.
+func (s *Service) DriverLeft(context.Context, string) {}
+
+// Start flushes the buffer every FlushInterval until ctx is done.
+func (s *Service) Start(ctx context.Context) {
+	go func() {
+		t := time.NewTicker(s.cfg.FlushInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				s.Flush(ctx)
+			}
+		}
+	}()
+	logger.Info("gps archiver started", "interval", s.cfg.FlushInterval)
+}
+
+// Flush writes every buffered batch. Batches that fail go back into the
+// buffer for the next flush.
+func (s *Service) Flush(ctx context.Context) {
+	s.mu.Lock()
+	pending := s.buf
+	s.buf = map[batchKey][]Point{}
+	s.buffered = 0
+	s.mu.Unlock()
+
+	var written, failed int64
+	for k, points := range pending {
+		if err := s.write(ctx, k, points); err != nil {
+			logger.Error("gps batch write failed", "driver", k.driverID, "day", k.day, "points", len(points), "err", err)
+			failed++
+			s.requeue(k, points)
+			continue
+		}
+		written++
+	}
+
+	s.mu.Lock()
+	now := time.Now().UTC()
+	s.stats.Batches += written
+	s.stats.FailedWrites += failed
+	s.stats.LastFlushAt = &now
+	s.mu.Unlock()
+	if written > 0 || failed > 0 {
+		logger.Debug("gps history flushed", "batches", written, "failed", failed)
+	}
+}
+
+// requeue puts a batch that failed to write back in front of newer pings.
+func (s *Service) requeue(k batchKey, points []Point) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buf[k] = append(points, s.buf[k]...)
+	s.buffered += len(points)
+}
+
+// write stores one batch and indexes it. The blob is written first, so an
+// indexed batch always exists; a failed insert leaves an orphan blob that the
+// retry does not reuse.
+func (s *Service) write(ctx context.Context, k batchKey, points []Point) error {
+	var body bytes.Buffer
+	zw := gzip.NewWriter(&body)
+	enc := json.NewEncoder(zw)
+	for _, p := range points {
+		if err := enc.Encode(p); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	key := fmt.Sprintf("gps/%s/%s/%s.jsonl.gz", k.day, k.driverID, uuid.NewString())
+	if err := s.blobs.Put(ctx, key, &body); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(ctx,
+		`INSERT INTO gps_batches (driver_id,day,blob_key,first_at,last_at,points) VALUES ($1,$2,$3,$4,$5,$6)`,
+		k.driverID, k.day, key, points[0].TS, points[len(points)-1].TS, len(points))
+	return err
+}
+
+// Stats returns the archiver's counters.
+func (s *Service) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := s.stats
+	st.Buffered = s.buffered
+	return st
+}
+
+// ExportForIncident returns a trip's raw GPS trace to an admin investigating
+// incidentID, and records the export in gps_export_log. The trace covers the
+// ride request until completion, or until now for a trip still under way.
+// Pings not yet flushed are not included.
+func (s *Service) ExportForIncident(ctx context.Context, tripID, adminID, incidentID string) (*Export, error) {
+	t, err := s.trips.GetByID(ctx, tripID)
+	if errors.Is(err, trips.ErrNotFound) {
+		return nil, ErrTripNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t.DriverID == nil {
+		return nil, ErrNoDriver
+	}
+	e := Export{TripID: tripID, DriverID: *t.DriverID, From: t.CreatedAt, To: time.Now(), Points: []Point{}}
+	if t.RequestedAt != nil {
+		e.From = *t.RequestedAt
+	}
+	if t.CompletedAt != nil {
+		e.To = *t.CompletedAt
+	}
+
+	rows, err := s.db.Query(ctx,
+		`SELECT blob_key FROM gps_batches
+		 WHERE driver_id=$1 AND first_at <= $3 AND last_at >= $2
+		 ORDER BY first_at`, e.DriverID, e.From, e.To)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		points, err := s.read(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("gps batch %s: %w", key, err)
+		}
+		for _, p := range points {
+			if !p.TS.Before(e.From) && !p.TS.After(e.To) {
+				e.Points = append(e.Points, p)
+			}
+		}
+	}
+	sort.SliceStable(e.Points, func(i, j int) bool { return e.Points[i].TS.Before(e.Points[j].TS) })
+
+	if _, err := s.db.Exec(ctx,
+		`INSERT INTO gps_export_log (trip_id,admin_id,incident_id,points) VALUES ($1,$2,$3,$4)`,
+		tripID, adminID, incidentID, len(e.Points)); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// read decodes one archived batch.
+func (s *Service) read(ctx context.Context, key string) ([]Point, error) {
+	rc, err := s.blobs.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	zr, err := gzip.NewReader(rc)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	var points []Point
+	sc := bufio.NewScanner(zr)
+	for sc.Scan() {
+		var p Point
+		if err := json.Unmarshal(sc.Bytes(), &p); err != nil {
+			return nil, err
+		}
+		points = append(points, p)
+	}
+	return points, sc.Err()
+}
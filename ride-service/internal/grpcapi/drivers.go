@@ -0,0 +1,63 @@
+package grpcapi
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	ridev1 "ride-service/gen/ride/v1"
+	"ride-service/internal/drivers"
+	"ride-service/pkg/validation"
+)
+
+type driverServer struct {
+	ridev1.UnimplementedDriverServiceServer
+	svc *drivers.Service
+}
+
+func (s *driverServer) GetDriver(ctx context.Context, req *ridev1.GetDriverRequest) (*ridev1.Driver, error) {
+	d, err := s.svc.GetByID(ctx, req.GetDriverId())
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return &ridev1.Driver{
+		Id:           d.ID,
+		Name:         d.Name,
+		Email:        d.Email,
+		Phone:        d.Phone,
+		Country:      d.Country,
+		VehicleType:  d.VehicleType,
+		LicensePlate: d.LicensePlate,
+		VehicleModel: d.VehicleModel,
+		VehicleColor: d.VehicleColor,
+		Status:       d.Status,
+		Rating:       d.Rating,
+		CreatedAt:    timestamppb.New(d.CreatedAt),
+	}, nil
+}
+
+func (s *driverServer) GetVehicleCard(ctx context.Context, req *ridev1.GetVehicleCardRequest) (*ridev1.VehicleCard, error) {
+	card, err := s.svc.VehicleCard(ctx, req.GetDriverId())
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return vehicleProto(card), nil
+}
+
+func (s *driverServer) ListNearbyDrivers(ctx context.Context, req *ridev1.ListNearbyDriversRequest) (*ridev1.ListNearbyDriversResponse, error) {
+	p := req.GetPosition()
+	if p == nil || !validation.ValidateCoordinates(p.GetLat(), p.GetLng()) {
+		return nil, status.Error(codes.InvalidArgument, "invalid position")
+	}
+	radius := req.GetRadiusKm()
+	if radius <= 0 {
+		radius = 5
+	}
+	ids, err := s.svc.GetNearby(ctx, p.GetLat(), p.GetLng(), radius)
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	return &ridev1.ListNearbyDriversResponse{DriverIds: ids}, nil
+}
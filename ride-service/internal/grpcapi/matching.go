@@ -0,0 +1,59 @@
+package grpcapi
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	ridev1 "ride-service/gen/ride/v1"
+	"ride-service/internal/events"
+	"ride-service/internal/matching"
+	"ride-service/pkg/validation"
+)
+
+const (
+	defaultCandidates = 5
+	maxCandidates     = 50
+)
+
+type matchingServer struct {
+	ridev1.UnimplementedMatchingServiceServer
+	matcher *matching.Matcher
+	drivers vehicleCards
+}
+
+// vehicleCards is the slice of the driver service candidates are enriched from.
+type vehicleCards interface {
+	VehicleCard(ctx context.Context, driverID string) (*events.VehicleCard, error)
+}
+
+func (s *matchingServer) FindCandidates(ctx context.Context, req *ridev1.FindCandidatesRequest) (*ridev1.FindCandidatesResponse, error) {
+	p := req.GetPickup()
+	if p == nil || !validation.ValidateCoordinates(p.GetLat(), p.GetLng()) {
+		return nil, status.Error(codes.InvalidArgument, "invalid pickup")
+	}
+	limit := int(req.GetLimit())
+	if limit <= 0 {
+		limit = defaultCandidates
+	}
+	if limit > maxCandidates {
+		limit = maxCandidates
+	}
+
+	ids, err := s.matcher.Candidates(ctx, events.LatLng{Lat: p.GetLat(), Lng: p.GetLng()}, limit)
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	resp := &ridev1.FindCandidatesResponse{Candidates: make([]*ridev1.Candidate, len(ids))}
+	for i, id := range ids {
+		c := &ridev1.Candidate{DriverId: id}
+		if card, err := s.drivers.VehicleCard(ctx, id); err == nil {
+			c.Vehicle = vehicleProto(card)
+		} else {
+			logger.Warn("vehicle card lookup failed", "driver", id, "err", err)
+		}
+		resp.Candidates[i] = c
+	}
+	return resp, nil
+}
@@ -0,0 +1,65 @@
+// Package grpcapi serves ride-service's internal gRPC API (proto/ride/v1) for
+// other backend services. It is a thin adapter over the same services the HTTP
+// handlers use; business rules live there, not here.
+package grpcapi
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	ridev1 "ride-service/gen/ride/v1"
+	"ride-service/internal/drivers"
+	"ride-service/internal/matching"
+	"ride-service/internal/trips"
+	"ride-service/pkg/jwt"
+	"ride-service/pkg/logging"
+)
+
+var logger = logging.For("grpc")
+
+// callerRoles may use the internal API: other backend services, and admins
+// for debugging with grpcurl.
+var callerRoles = map[string]bool{"service": true, "admin": true}
+
+// NewServer returns a gRPC server with the trip, driver and matching services
+// registered behind JWT authentication.
+func NewServer(tripSvc *trips.Service, driverSvc *drivers.Service, matcher *matching.Matcher) *grpc.Server {
+	srv := grpc.NewServer(grpc.ChainUnaryInterceptor(recoverPanics, authenticate))
+	ridev1.RegisterTripServiceServer(srv, &tripServer{svc: tripSvc})
+	ridev1.RegisterDriverServiceServer(srv, &driverServer{svc: driverSvc})
+	ridev1.RegisterMatchingServiceServer(srv, &matchingServer{matcher: matcher, drivers: driverSvc})
+	return srv
+}
+
+// authenticate requires `authorization: Bearer <jwt>` metadata with a caller
+// role, mirroring jwt.RequireAuth + jwt.RequireRole on the HTTP side.
+func authenticate(ctx context.Context, req any, info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (any, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	auth := md.Get("authorization")
+	if len(auth) == 0 || !strings.HasPrefix(auth[0], "Bearer ") {
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+	claims, err := jwt.Authenticate(ctx, strings.TrimPrefix(auth[0], "Bearer "))
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+	if !callerRoles[claims.Role] {
+		return nil, status.Error(codes.PermissionDenied, "role not allowed")
+	}
+	return next(jwt.WithClaims(ctx, claims), req)
+}
+
+func recoverPanics(ctx context.Context, req any, info *grpc.UnaryServerInfo, next grpc.UnaryHandler) (resp any, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			logger.Error("panic in handler", "method", info.FullMethod, "panic", p)
+			err = status.Error(codes.Internal, "internal error")
+		}
+	}()
+	return next(ctx, req)
+}
@@ -0,0 +1,147 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	ridev1 "ride-service/gen/ride/v1"
+	"ride-service/internal/events"
+	"ride-service/internal/trips"
+	"ride-service/pkg/money"
+	"ride-service/pkg/validation"
+)
+
+type tripServer struct {
+	ridev1.UnimplementedTripServiceServer
+	svc *trips.Service
+}
+
+func (s *tripServer) GetTrip(ctx context.Context, req *ridev1.GetTripRequest) (*ridev1.Trip, error) {
+	t, err := s.svc.GetByID(ctx, req.GetTripId())
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	return tripProto(t), nil
+}
+
+func (s *tripServer) AssignDriver(ctx context.Context, req *ridev1.AssignDriverRequest) (*ridev1.Trip, error) {
+	if req.GetDriverId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "driver_id is required")
+	}
+	if req.GetExpectedVersion() < 1 {
+		return nil, errNoVersion
+	}
+	t, err := s.svc.AssignDriver(ctx, req.GetTripId(), req.GetDriverId(), int(req.GetExpectedVersion()))
+	if err != nil {
+		return nil, transitionError(err)
+	}
+	return tripProto(t), nil
+}
+
+func (s *tripServer) StartTrip(ctx context.Context, req *ridev1.StartTripRequest) (*ridev1.Trip, error) {
+	if req.GetExpectedVersion() < 1 {
+		return nil, errNoVersion
+	}
+	t, err := s.svc.Start(ctx, req.GetTripId(), int(req.GetExpectedVersion()))
+	if err != nil {
+		return nil, transitionError(err)
+	}
+	return tripProto(t), nil
+}
+
+func (s *tripServer) EndTrip(ctx context.Context, req *ridev1.EndTripRequest) (*ridev1.Trip, error) {
+	if req.GetExpectedVersion() < 1 {
+		return nil, errNoVersion
+	}
+	t, err := s.svc.End(ctx, req.GetTripId(), int(req.GetExpectedVersion()), req.DistanceKm)
+	if err != nil {
+		return nil, transitionError(err)
+	}
+	return tripProto(t), nil
+}
+
+func (s *tripServer) ListActiveTrips(ctx context.Context, req *ridev1.ListActiveTripsRequest) (*ridev1.ListActiveTripsResponse, error) {
+	box := trips.BoundingBox{MinLat: req.GetMinLat(), MinLng: req.GetMinLng(), MaxLat: req.GetMaxLat(), MaxLng: req.GetMaxLng()}
+	if !validation.ValidateCoordinates(box.MinLat, box.MinLng) ||
+		!validation.ValidateCoordinates(box.MaxLat, box.MaxLng) ||
+		box.MinLat >= box.MaxLat || box.MinLng >= box.MaxLng {
+		return nil, status.Error(codes.InvalidArgument, "invalid bounding box")
+	}
+	active, err := s.svc.ListActiveInBox(ctx, box)
+	if err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	resp := &ridev1.ListActiveTripsResponse{Trips: make([]*ridev1.ActiveTrip, len(active))}
+	for i := range active {
+		resp.Trips[i] = &ridev1.ActiveTrip{
+			Trip:           tripProto(&active[i].Trip),
+			DriverPosition: &ridev1.LatLng{Lat: active[i].DriverLat, Lng: active[i].DriverLng},
+		}
+	}
+	return resp, nil
+}
+
+var errNoVersion = status.Error(codes.InvalidArgument, "expected_version is required")
+
+// transitionError maps the trip service's state-change errors: a missing trip
+// is NotFound, a stale version is Aborted (re-read and retry), anything else
+// is a disallowed transition.
+func transitionError(err error) error {
+	switch {
+	case errors.Is(err, trips.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, trips.ErrVersionConflict):
+		return status.Error(codes.Aborted, err.Error())
+	}
+	return status.Error(codes.FailedPrecondition, err.Error())
+}
+
+// fare converts to the proto's major-unit double; the proto predates
+// currencies.
+func fare(m *money.Money) *float64 {
+	if m == nil {
+		return nil
+	}
+	v := m.Major()
+	return &v
+}
+
+func tripProto(t *trips.Trip) *ridev1.Trip {
+	out := &ridev1.Trip{
+		Id:          t.ID,
+		RiderId:     t.RiderID,
+		Pickup:      &ridev1.LatLng{Lat: t.PickupLat, Lng: t.PickupLng},
+		Drop:        &ridev1.LatLng{Lat: t.DropLat, Lng: t.DropLng},
+		Fare:        fare(t.Fare),
+		Status:      t.Status,
+		RequestedAt: timestamp(t.RequestedAt),
+		StartedAt:   timestamp(t.StartedAt),
+		CompletedAt: timestamp(t.CompletedAt),
+		CreatedAt:   timestamppb.New(t.CreatedAt),
+		Vehicle:     vehicleProto(t.Vehicle),
+		Version:     int32(t.Version),
+	}
+	if t.DriverID != nil {
+		out.DriverId = *t.DriverID
+	}
+	return out
+}
+
+func vehicleProto(c *events.VehicleCard) *ridev1.VehicleCard {
+	if c == nil {
+		return nil
+	}
+	return &ridev1.VehicleCard{Type: c.Type, Model: c.Model, Color: c.Color, Plate: c.Plate, PhotoUrl: c.PhotoURL}
+}
+
+func timestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
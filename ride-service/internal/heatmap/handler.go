@@ -0,0 +1,79 @@
+package heatmap
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+	"ride-service/pkg/validation"
+)
+
+// Handler exposes the heatmap to ops dashboards and the driver app.
+type Handler struct{ svc *Service }
+
+// NewHandler wires a handler to the heatmap service.
+func NewHandler(svc *Service) *Handler { return &Handler{svc: svc} }
+
+// AdminRoutes returns the routes mounted under /admin/heatmap. Drivers may
+// read it too, to see where riders are waiting.
+func (h *Handler) AdminRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth, jwt.RequireRole("admin", "driver"))
+	r.Get("/", h.Get)
+	return r
+}
+
+// Get serves GET /admin/heatmap?precision=&bbox=minLng,minLat,maxLng,maxLat.
+func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var precision int
+	if raw := q.Get("precision"); raw != "" {
+		p, err := strconv.Atoi(raw)
+		if err != nil {
+			apierror.Write(w, apierror.Validation("precision must be an integer"))
+			return
+		}
+		precision = p
+	}
+	var box *BoundingBox
+	if raw := q.Get("bbox"); raw != "" {
+		b, ok := parseBBox(raw)
+		if !ok {
+			apierror.Write(w, apierror.Validation("bbox must be minLng,minLat,maxLng,maxLat"))
+			return
+		}
+		box = &b
+	}
+	heat, err := h.svc.Snapshot(r.Context(), precision, box)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, heat)
+}
+
+func parseBBox(raw string) (BoundingBox, bool) {
+	parts := strings.Split(raw, ",")
+	if len(parts) != 4 {
+		return BoundingBox{}, false
+	}
+	var v [4]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return BoundingBox{}, false
+		}
+		v[i] = f
+	}
+	box := BoundingBox{MinLng: v[0], MinLat: v[1], MaxLng: v[2], MaxLat: v[3]}
+	if !validation.ValidateCoordinates(box.MinLat, box.MinLng) ||
+		!validation.ValidateCoordinates(box.MaxLat, box.MaxLng) ||
+		box.MinLat >= box.MaxLat || box.MinLng >= box.MaxLng {
+		return BoundingBox{}, false
+	}
+	return box, true
+}
@@ -0,0 +1,35 @@
+package heatmap
+
+import "time"
+
+// Cell is one geohash cell of the heatmap.
+type Cell struct {
+	Geohash string  `json:"geohash"`
+	Lat     float64 `json:"lat"` // cell centre
+	Lng     float64 `json:"lng"`
+	Demand  int     `json:"demand"` // ride requests in the demand window
+	Supply  int     `json:"supply"` // online drivers seen in the supply window
+	// Ratio is demand ÷ supply, omitted for cells without drivers.
+	Ratio *float64 `json:"ratio,omitempty"`
+}
+
+// Heatmap is the response for GET /admin/heatmap. Cells are ordered by how
+// far demand outstrips supply, worst first; cells with neither are left out.
+type Heatmap struct {
+	Precision    int       `json:"precision"`
+	DemandWindow string    `json:"demand_window"`
+	SupplyWindow string    `json:"supply_window"`
+	GeneratedAt  time.Time `json:"generated_at"`
+	Cells        []Cell    `json:"cells"`
+	TotalDemand  int       `json:"total_demand"`
+	TotalSupply  int       `json:"total_supply"`
+}
+
+// BoundingBox limits the heatmap to cells whose centre is inside it.
+type BoundingBox struct {
+	MinLng, MinLat, MaxLng, MaxLat float64
+}
+
+func (b BoundingBox) contains(lat, lng float64) bool {
+	return lat >= b.MinLat && lat <= b.MaxLat && lng >= b.MinLng && lng <= b.MaxLng
+}
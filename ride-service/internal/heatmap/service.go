@@ -0,0 +1,192 @@
+package heatmap
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"ride-service/internal/events"
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/config"
+	"ride-service/pkg/eventbus"
+	"ride-service/pkg/geohash"
+	"ride-service/pkg/logging"
+	rredis "ride-service/pkg/redis"
+)
+
+var logger = logging.For("heatmap")
+
+var ErrInvalid = apierror.Validation("invalid heatmap request")
+
+// StorePrecision is the geohash length counts are kept at (about 38m x 19m);
+// coarser heatmaps merge cells by prefix.
+const StorePrecision = 8
+
+// Service keeps per-cell demand and supply counts in Redis and reads the
+// heatmap from them.
+type Service struct {
+	redis *rredis.Client
+	cfg   config.Heatmap
+}
+
+// NewService creates a heatmap service.
+func NewService(redis *rredis.Client, cfg config.Heatmap) *Service {
+	return &Service{redis: redis, cfg: cfg}
+}
+
+// Start counts new ride requests as demand. Rematches of an existing trip
+// (which carry excluded drivers) and watchdog retries are not counted again. Counting is best
+// effort: a lost request only makes the heatmap slightly low.
+func (s *Service) Start(ctx context.Context, bus eventbus.Bus) {
+	bus.Subscribe(ctx, eventbus.TopicRideRequested, "heatmap-ride-requested", func(ctx context.Context, data []byte) error {
+		var ev events.RideRequestedEvent
+		env, err := events.Unwrap(data, &ev)
+		if err != nil {
+			logger.Warn("skipping undecodable ride.requested", "err", err)
+			return nil
+		}
+		if len(ev.ExcludeDrivers) > 0 || ev.Retry > 0 {
+			return nil
+		}
+		at, err := time.Parse(time.RFC3339, ev.RequestedAt)
+		if err != nil {
+			at = env.OccurredAt
+		}
+		if time.Since(at) > s.cfg.DemandWindow {
+			return nil // already outside every window, e.g. a replay
+		}
+		cell := geohash.Encode(ev.Pickup.Lat, ev.Pickup.Lng, StorePrecision)
+		if err := s.redis.AddDemand(ctx, cell, at, s.cfg.DemandWindow); err != nil {
+			logger.Error("record demand failed", "trip", ev.TripID, "err", err)
+		}
+		return nil
+	})
+}
+
+// DriverMoved counts an online driver's location update as supply.
+func (s *Service) DriverMoved(ctx context.Context, driverID string, lat, lng float64) {
+	cell := geohash.Encode(lat, lng, StorePrecision)
+	if err := s.redis.SetSupply(ctx, driverID, cell, time.Now(), s.cfg.SupplyWindow); err != nil {
+		logger.Error("record supply failed", "driver", driverID, "err", err)
+	}
+}
+
+// DriverLeft drops a driver who went offline from the supply.
+func (s *Service) DriverLeft(ctx context.Context, driverID string) {
+	now := time.Now()
+	if err := s.redis.ClearSupply(ctx, driverID, now.Add(-s.cfg.SupplyWindow), now); err != nil {
+		logger.Error("clear supply failed", "driver", driverID, "err", err)
+	}
+}
+
+// Pressure returns the demand and supply in the geohash cell of precision
+// around lat, lng, over the configured windows.
+func (s *Service) Pressure(ctx context.Context, lat, lng float64, precision int) (demand, supply int, err error) {
+	cell := geohash.Encode(lat, lng, min(precision, StorePrecision))
+	now := time.Now()
+	demands, err := s.redis.Demand(ctx, now.Add(-s.cfg.DemandWindow), now)
+	if err != nil {
+		return 0, 0, err
+	}
+	supplies, err := s.redis.Supply(ctx, now.Add(-s.cfg.SupplyWindow), now)
+	if err != nil {
+		return 0, 0, err
+	}
+	for stored, n := range demands {
+		if strings.HasPrefix(stored, cell) {
+			demand += n
+		}
+	}
+	for _, stored := range supplies {
+		if strings.HasPrefix(stored, cell) {
+			supply++
+		}
+	}
+	return demand, supply, nil
+}
+
+// Snapshot returns the heatmap at the given geohash precision (0 for the
+// configured default), optionally limited to box.
+func (s *Service) Snapshot(ctx context.Context, precision int, box *BoundingBox) (*Heatmap, error) {
+	if precision == 0 {
+		precision = min(s.cfg.Precision, StorePrecision)
+	}
+	if precision < 1 || precision > StorePrecision {
+		return nil, fmt.Errorf("%w: precision must be between 1 and %d", ErrInvalid, StorePrecision)
+	}
+	now := time.Now()
+	demand, err := s.redis.Demand(ctx, now.Add(-s.cfg.DemandWindow), now)
+	if err != nil {
+		return nil, err
+	}
+	supply, err := s.redis.Supply(ctx, now.Add(-s.cfg.SupplyWindow), now)
+	if err != nil {
+		return nil, err
+	}
+
+	h := &Heatmap{
+		Precision:    precision,
+		DemandWindow: s.cfg.DemandWindow.String(),
+		SupplyWindow: s.cfg.SupplyWindow.String(),
+		GeneratedAt:  now.UTC(),
+		Cells:        []Cell{},
+	}
+	cells := map[string]*Cell{}
+	// cell returns the aggregate a stored cell falls into, or nil when it is
+	// outside box.
+	cell := func(stored string) *Cell {
+		if len(stored) < precision {
+			return nil
+		}
+		if box != nil {
+			lat, lng, ok := geohash.Center(stored)
+			if !ok || !box.contains(lat, lng) {
+				return nil
+			}
+		}
+		key := stored[:precision]
+		c, ok := cells[key]
+		if !ok {
+			lat, lng, _ := geohash.Center(key)
+			c = &Cell{Geohash: key, Lat: round(lat, 6), Lng: round(lng, 6)}
+			cells[key] = c
+		}
+		return c
+	}
+	for stored, n := range demand {
+		if c := cell(stored); c != nil {
+			c.Demand += n
+			h.TotalDemand += n
+		}
+	}
+	for _, stored := range supply {
+		if c := cell(stored); c != nil {
+			c.Supply++
+			h.TotalSupply++
+		}
+	}
+
+	for _, c := range cells {
+		if c.Supply > 0 {
+			r := round(float64(c.Demand)/float64(c.Supply), 2)
+			c.Ratio = &r
+		}
+		h.Cells = append(h.Cells, *c)
+	}
+	slices.SortFunc(h.Cells, func(a, b Cell) int {
+		if d := cmp.Compare(b.Demand-b.Supply, a.Demand-a.Supply); d != 0 {
+			return d
+		}
+		return cmp.Compare(a.Geohash, b.Geohash)
+	})
+	return h, nil
+}
+
+func round(v float64, places int) float64 {
+	p := math.Pow(10, float64(places))
+	return math.Round(v*p) / p
+}
@@ -0,0 +1,68 @@
+package invoices
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+)
+
+// Handler exposes trip invoices to riders and tax summaries to drivers.
+type Handler struct{ svc *Service }
+
+// NewHandler wires a handler to the invoice service.
+func NewHandler(svc *Service) *Handler { return &Handler{svc: svc} }
+
+// TripRoutes returns the routes mounted at /trips/{id}/invoice.
+func (h *Handler) TripRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+	r.Get("/", h.Get)
+	return r
+}
+
+// DriverRoutes returns the routes mounted at /drivers/{id}/tax-summary.
+func (h *Handler) DriverRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+	r.Get("/", h.Summary)
+	return r
+}
+
+func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
+	inv, err := h.svc.ForRider(r.Context(), chi.URLParam(r, "id"), jwt.GetClaims(r.Context()))
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, inv)
+}
+
+// Summary serves GET /drivers/{id}/tax-summary?month=2026-09. The month
+// defaults to the current one (UTC).
+func (h *Handler) Summary(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	claims := jwt.GetClaims(r.Context())
+	if claims == nil || (claims.UserID != id && claims.Role != "admin" && claims.Role != "support") {
+		apierror.Write(w, apierror.Forbidden("forbidden"))
+		return
+	}
+	month := time.Now().UTC()
+	if raw := r.URL.Query().Get("month"); raw != "" {
+		m, err := time.Parse(MonthLayout, raw)
+		if err != nil {
+			apierror.Write(w, apierror.Validation("month must be YYYY-MM"))
+			return
+		}
+		month = m
+	}
+	sum, err := h.svc.TaxSummary(r.Context(), id, month)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, sum)
+}
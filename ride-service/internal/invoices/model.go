@@ -0,0 +1,56 @@
+package invoices
+
+import (
+	"time"
+
+	"ride-service/pkg/money"
+)
+
+// MonthLayout is the format of the month in tax summaries.
+const MonthLayout = "2006-01"
+
+// Invoice is the tax invoice for a completed trip. It is a snapshot: later
+// changes to the tax rules do not alter invoices already issued. Only a
+// fare adjusted after a dispute revises it, at the rates it was issued with.
+type Invoice struct {
+	Number       string      `json:"number"` // <jurisdiction>-<sequence>, e.g. IN-MH-000042
+	TripID       string      `json:"trip_id"`
+	RiderID      string      `json:"rider_id"`
+	DriverID     string      `json:"driver_id"`
+	Jurisdiction string      `json:"jurisdiction"`
+	Total        money.Money `json:"total"` // the fare, tax included
+	Net          money.Money `json:"net"`   // the fare before tax
+	Taxes        []TaxLine   `json:"taxes"`
+	IssuedAt     time.Time   `json:"issued_at"`
+	RevisedAt    *time.Time  `json:"revised_at,omitempty"`
+}
+
+// TaxLine is one tax on an invoice or receipt.
+type TaxLine struct {
+	Name   string      `json:"name"`
+	Rate   string      `json:"rate"` // percent
+	Amount money.Money `json:"amount"`
+}
+
+// Summary is the response for GET /drivers/{id}/tax-summary: a driver's
+// invoiced trips in one month, per currency.
+type Summary struct {
+	DriverID string            `json:"driver_id"`
+	Month    string            `json:"month"`
+	Totals   []CurrencySummary `json:"totals"`
+}
+
+// CurrencySummary totals one currency's invoices.
+type CurrencySummary struct {
+	Currency string      `json:"currency"`
+	Trips    int         `json:"trips"`
+	Gross    money.Money `json:"gross"`
+	Net      money.Money `json:"net"`
+	Taxes    []TaxTotal  `json:"taxes"`
+}
+
+// TaxTotal is the sum of one tax over a month.
+type TaxTotal struct {
+	Name   string      `json:"name"`
+	Amount money.Money `json:"amount"`
+}
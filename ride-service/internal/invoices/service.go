@@ -0,0 +1,294 @@
+package invoices
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/internal/events"
+	"ride-service/internal/trips"
+	"ride-service/internal/trips/statemachine"
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/config"
+	"ride-service/pkg/db"
+	"ride-service/pkg/eventbus"
+	"ride-service/pkg/jwt"
+	"ride-service/pkg/logging"
+	"ride-service/pkg/money"
+)
+
+var logger = logging.For("invoices")
+
+var (
+	ErrTripNotFound   = apierror.NotFound("trip not found")
+	ErrDriverNotFound = apierror.NotFound("driver not found")
+	ErrForbidden      = apierror.Forbidden("only the trip's rider can see its invoice")
+	ErrNotReady       = apierror.Conflict("trip has no invoice until it completes")
+)
+
+const columns = `number,trip_id,rider_id,driver_id,jurisdiction,currency,total_minor,net_minor,taxes,issued_at,revised_at`
+
+// TripReader returns trips; trips.TripRepo implements it.
+type TripReader interface {
+	GetByID(ctx context.Context, id string) (*trips.Trip, error)
+}
+
+// Service issues trip invoices, numbered in one gapless sequence per tax
+// jurisdiction, and sums them up for drivers.
+type Service struct {
+	db    *pgxpool.Pool
+	trips TripReader
+	taxes config.Taxes
+}
+
+// NewService creates an invoice service.
+func NewService(db *pgxpool.Pool, t TripReader, taxes config.Taxes) *Service {
+	return &Service{db: db, trips: t, taxes: taxes}
+}
+
+// Breakdown splits a tax-inclusive total into the net amount and one line
+// per rule. Lines are rounded to the minor unit and net absorbs the
+// remainder, so net plus the lines is always exactly total.
+func Breakdown(tax config.Tax, total money.Money) (net money.Money, lines []TaxLine) {
+	var sum int64
+	for _, r := range tax.Rules {
+		sum += r.BasisPoints()
+	}
+	net, lines = total, []TaxLine{}
+	for _, r := range tax.Rules {
+		amount := total.MulRatio(r.BasisPoints(), 10000+sum)
+		net.Amount -= amount.Amount
+		lines = append(lines, TaxLine{Name: r.Name, Rate: r.Rate, Amount: amount})
+	}
+	return net, lines
+}
+
+// ForRider returns a trip's invoice to its rider or staff, issuing it if
+// the consumer has not yet.
+func (s *Service) ForRider(ctx context.Context, tripID string, claims *jwt.Claims) (*Invoice, error) {
+	t, err := s.trips.GetByID(ctx, tripID)
+	if errors.Is(err, trips.ErrNotFound) {
+		return nil, ErrTripNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if claims.UserID != t.RiderID && claims.Role != "admin" && claims.Role != "support" {
+		return nil, ErrForbidden
+	}
+	return s.Issue(ctx, tripID)
+}
+
+// Issue returns the trip's invoice, issuing it on first call. The trip row
+// is locked while the number is drawn, and the sequence is bumped in the
+// same transaction, so numbers are neither repeated nor skipped.
+func (s *Service) Issue(ctx context.Context, tripID string) (*Invoice, error) {
+	var inv *Invoice
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		var riderID, status, city string
+		var driverID, currency *string
+		var fare *int64
+		err := tx.QueryRow(ctx,
+			`SELECT t.rider_id, t.driver_id, t.status, t.fare_minor, t.currency, COALESCE(d.city,'')
+			 FROM trips t LEFT JOIN drivers d ON d.id=t.driver_id WHERE t.id=$1 FOR UPDATE OF t`,
+			tripID).Scan(&riderID, &driverID, &status, &fare, &currency, &city)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrTripNotFound
+		} else if err != nil {
+			return err
+		}
+		inv, err = scanInvoice(tx.QueryRow(ctx, `SELECT `+columns+` FROM invoices WHERE trip_id=$1`, tripID))
+		if err == nil {
+			return nil
+		} else if !errors.Is(err, pgx.ErrNoRows) {
+			return err
+		}
+		if status != statemachine.Completed || driverID == nil || fare == nil || currency == nil {
+			return ErrNotReady
+		}
+
+		tax := s.taxes.For(city)
+		total := money.New(*fare, *currency)
+		net, lines := Breakdown(tax, total)
+		var seq int64
+		if err := tx.QueryRow(ctx,
+			`INSERT INTO invoice_series (jurisdiction,last_number) VALUES ($1,1)
+			 ON CONFLICT (jurisdiction) DO UPDATE SET last_number=invoice_series.last_number+1
+			 RETURNING last_number`, tax.Jurisdiction).Scan(&seq); err != nil {
+			return err
+		}
+		inv, err = scanInvoice(tx.QueryRow(ctx,
+			`INSERT INTO invoices (id,trip_id,rider_id,driver_id,jurisdiction,seq,number,currency,total_minor,net_minor,taxes)
+			 VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11) RETURNING `+columns,
+			uuid.New().String(), tripID, riderID, *driverID, tax.Jurisdiction, seq,
+			fmt.Sprintf("%s-%06d", tax.Jurisdiction, seq), total.Currency, total.Amount, net.Amount, lines))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// Revise brings a trip's invoice in line with its fare after an
+// adjustment, issuing it first if need be. The number stays; the taxes are
+// split again at the rates on the invoice. An invoice that already matches
+// the fare is returned as it is.
+func (s *Service) Revise(ctx context.Context, tripID string) (*Invoice, error) {
+	inv, err := s.Issue(ctx, tripID)
+	if err != nil {
+		return nil, err
+	}
+	err = db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		var fare int64
+		if err := tx.QueryRow(ctx, `SELECT fare_minor FROM trips WHERE id=$1 FOR UPDATE`, tripID).Scan(&fare); err != nil {
+			return err
+		}
+		cur, err := scanInvoice(tx.QueryRow(ctx, `SELECT `+columns+` FROM invoices WHERE trip_id=$1`, tripID))
+		if err != nil || cur.Total.Amount == fare {
+			inv = cur
+			return err
+		}
+		tax := config.Tax{Jurisdiction: cur.Jurisdiction}
+		for _, l := range cur.Taxes {
+			tax.Rules = append(tax.Rules, config.TaxRule{Name: l.Name, Rate: l.Rate})
+		}
+		net, lines := Breakdown(tax, money.New(fare, cur.Total.Currency))
+		inv, err = scanInvoice(tx.QueryRow(ctx,
+			`UPDATE invoices SET total_minor=$2, net_minor=$3, taxes=$4, revised_at=NOW() WHERE trip_id=$1 RETURNING `+columns,
+			tripID, fare, net.Amount, lines))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// Start issues invoices as trips complete and revises them as fares are
+// adjusted. Both are idempotent, so failures are returned for the consumer
+// to retry.
+func (s *Service) Start(ctx context.Context, bus eventbus.Bus) {
+	bus.Subscribe(ctx, eventbus.TopicTripCompleted, "invoices-trip-completed", func(ctx context.Context, data []byte) error {
+		var ev events.TripCompletedEvent
+		env, err := events.Unwrap(data, &ev)
+		if errors.Is(err, events.ErrUnsupportedVersion) {
+			logger.Warn("skipping event", "event_id", env.EventID, "err", err)
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if _, err := uuid.Parse(ev.TripID); err != nil {
+			logger.Warn("skipping trip.completed with bad trip id", "trip", ev.TripID)
+			return nil
+		}
+		inv, err := s.Issue(ctx, ev.TripID)
+		if errors.Is(err, ErrTripNotFound) || errors.Is(err, ErrNotReady) {
+			logger.Warn("no invoice for trip.completed", "trip", ev.TripID, "err", err)
+			return nil
+		} else if err != nil {
+			return err
+		}
+		logger.Debug("invoice issued", "trip", ev.TripID, "number", inv.Number)
+		return nil
+	})
+
+	bus.Subscribe(ctx, eventbus.TopicFareAdjusted, "invoices-fare-adjusted", func(ctx context.Context, data []byte) error {
+		var ev events.FareAdjustedEvent
+		env, err := events.Unwrap(data, &ev)
+		if errors.Is(err, events.ErrUnsupportedVersion) {
+			logger.Warn("skipping event", "event_id", env.EventID, "err", err)
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if _, err := uuid.Parse(ev.TripID); err != nil {
+			logger.Warn("skipping fare.adjusted with bad trip id", "trip", ev.TripID)
+			return nil
+		}
+		inv, err := s.Revise(ctx, ev.TripID)
+		if errors.Is(err, ErrTripNotFound) || errors.Is(err, ErrNotReady) {
+			logger.Warn("no invoice for fare.adjusted", "trip", ev.TripID, "err", err)
+			return nil
+		} else if err != nil {
+			return err
+		}
+		logger.Debug("invoice revised", "trip", ev.TripID, "number", inv.Number)
+		return nil
+	})
+}
+
+// TaxSummary totals the invoices of a driver's trips issued in month
+// (UTC), per currency.
+func (s *Service) TaxSummary(ctx context.Context, driverID string, month time.Time) (*Summary, error) {
+	if _, err := uuid.Parse(driverID); err != nil {
+		return nil, ErrDriverNotFound
+	}
+	var exists bool
+	if err := s.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM drivers WHERE id=$1)`, driverID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrDriverNotFound
+	}
+	from := time.Date(month.Year(), month.Month(), 1, 0, 0, 0, 0, time.UTC)
+	rows, err := s.db.Query(ctx,
+		`SELECT `+columns+` FROM invoices WHERE driver_id=$1 AND issued_at >= $2 AND issued_at < $3`,
+		driverID, from, from.AddDate(0, 1, 0))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byCurrency := map[string]*CurrencySummary{}
+	taxes := map[string]map[string]int64{} // currency → tax name → minor units
+	for rows.Next() {
+		inv, err := scanInvoice(rows)
+		if err != nil {
+			return nil, err
+		}
+		c := inv.Total.Currency
+		cs := byCurrency[c]
+		if cs == nil {
+			cs = &CurrencySummary{Currency: c, Gross: money.New(0, c), Net: money.New(0, c)}
+			byCurrency[c], taxes[c] = cs, map[string]int64{}
+		}
+		cs.Trips++
+		cs.Gross.Amount += inv.Total.Amount
+		cs.Net.Amount += inv.Net.Amount
+		for _, l := range inv.Taxes {
+			taxes[c][l.Name] += l.Amount.Amount
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sum := &Summary{DriverID: driverID, Month: from.Format(MonthLayout), Totals: []CurrencySummary{}}
+	for c, cs := range byCurrency {
+		cs.Taxes = []TaxTotal{}
+		for name, amount := range taxes[c] {
+			cs.Taxes = append(cs.Taxes, TaxTotal{Name: name, Amount: money.New(amount, c)})
+		}
+		sort.Slice(cs.Taxes, func(i, j int) bool { return cs.Taxes[i].Name < cs.Taxes[j].Name })
+		sum.Totals = append(sum.Totals, *cs)
+	}
+	sort.Slice(sum.Totals, func(i, j int) bool { return sum.Totals[i].Currency < sum.Totals[j].Currency })
+	return sum, nil
+}
+
+func scanInvoice(row pgx.Row) (*Invoice, error) {
+	var inv Invoice
+	var currency string
+	if err := row.Scan(&inv.Number, &inv.TripID, &inv.RiderID, &inv.DriverID, &inv.Jurisdiction,
+		&currency, &inv.Total.Amount, &inv.Net.Amount, &inv.Taxes, &inv.IssuedAt, &inv.RevisedAt); err != nil {
+		return nil, err
+	}
+	inv.Total.Currency, inv.Net.Currency = currency, currency
+	return &inv, nil
+}
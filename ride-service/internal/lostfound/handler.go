@@ -0,0 +1,150 @@
+package lostfound
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+)
+
+// Handler exposes lost-and-found to riders, drivers and admins.
+type Handler struct{ svc *Service }
+
+// NewHandler wires a handler to the lost-and-found service.
+func NewHandler(svc *Service) *Handler { return &Handler{svc: svc} }
+
+// TripRoutes returns the routes mounted at /trips/{id}/lost-item.
+func (h *Handler) TripRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+
+	r.Get("/", h.ForTrip)
+	r.Post("/", h.Report)
+	r.Post("/{itemID}/found", h.answer(h.svc.Found))
+	r.Post("/{itemID}/not-found", h.answer(h.svc.NotFound))
+	r.Post("/{itemID}/returned", h.Returned)
+
+	return r
+}
+
+// DriverRoutes returns the routes mounted at /drivers/{id}/lost-items.
+func (h *Handler) DriverRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+	r.Get("/", h.ForDriver)
+	return r
+}
+
+// AdminRoutes returns the routes mounted under /admin/lost-items.
+func (h *Handler) AdminRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth, jwt.RequireRole("admin", "support"))
+
+	r.Get("/", h.List)
+	r.Get("/{id}", h.Get)
+
+	return r
+}
+
+func (h *Handler) Report(w http.ResponseWriter, r *http.Request) {
+	var req ReportRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	it, err := h.svc.Report(r.Context(), chi.URLParam(r, "id"), jwt.GetClaims(r.Context()).UserID, req)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusCreated, it)
+}
+
+func (h *Handler) ForTrip(w http.ResponseWriter, r *http.Request) {
+	items, err := h.svc.ForTrip(r.Context(), chi.URLParam(r, "id"), jwt.GetClaims(r.Context()))
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+// answer serves the driver's found / not-found answers; the body is
+// optional.
+func (h *Handler) answer(fn func(ctx context.Context, tripID, itemID, userID, note string) (*Item, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req AnswerRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			apierror.Write(w, apierror.Validation("invalid body"))
+			return
+		}
+		it, err := fn(r.Context(), chi.URLParam(r, "id"), chi.URLParam(r, "itemID"), jwt.GetClaims(r.Context()).UserID, req.Note)
+		if err != nil {
+			apierror.Write(w, err)
+			return
+		}
+		apierror.WriteJSON(w, http.StatusOK, it)
+	}
+}
+
+func (h *Handler) Returned(w http.ResponseWriter, r *http.Request) {
+	it, err := h.svc.Returned(r.Context(), chi.URLParam(r, "id"), chi.URLParam(r, "itemID"), jwt.GetClaims(r.Context()).UserID)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, it)
+}
+
+// ForDriver serves GET /drivers/{id}/lost-items?status=all. By default only
+// open reports are listed.
+func (h *Handler) ForDriver(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	claims := jwt.GetClaims(r.Context())
+	if claims == nil || (claims.UserID != id && claims.Role != "admin" && claims.Role != "support") {
+		apierror.Write(w, apierror.Forbidden("forbidden"))
+		return
+	}
+	items, err := h.svc.ForDriver(r.Context(), id, r.URL.Query().Get("status") == "all")
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+// List serves GET /admin/lost-items?status=&trip_id=&driver_id=&limit=&offset=.
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := Filter{Status: q.Get("status"), TripID: q.Get("trip_id"), DriverID: q.Get("driver_id")}
+	limit := 50
+	if v, err := strconv.Atoi(q.Get("limit")); err == nil && v > 0 && v <= 200 {
+		limit = v
+	}
+	offset := 0
+	if v, err := strconv.Atoi(q.Get("offset")); err == nil && v > 0 {
+		offset = v
+	}
+	page, err := h.svc.List(r.Context(), f, limit, offset)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, page)
+}
+
+func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
+	it, err := h.svc.Get(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, it)
+}
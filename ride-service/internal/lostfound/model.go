@@ -0,0 +1,68 @@
+package lostfound
+
+import "time"
+
+// MaxDescription caps a report's description and a driver's note, in
+// characters.
+const MaxDescription = 1000
+
+// maxOpenPerTrip caps the reports a rider can have open on one trip.
+const maxOpenPerTrip = 5
+
+// Item statuses. reported → found → returned, or reported → not_found.
+const (
+	StatusReported = "reported"
+	StatusFound    = "found"
+	StatusNotFound = "not_found"
+	StatusReturned = "returned"
+)
+
+// Statuses lists every status.
+var Statuses = []string{StatusReported, StatusFound, StatusNotFound, StatusReturned}
+
+// Item is one lost item report on a completed trip.
+type Item struct {
+	ID          string     `json:"id"`
+	TripID      string     `json:"trip_id"`
+	RiderID     string     `json:"rider_id"`
+	DriverID    string     `json:"driver_id"`
+	Description string     `json:"description"`
+	Status      string     `json:"status"`
+	DriverNote  *string    `json:"driver_note,omitempty"`
+	ReportedAt  time.Time  `json:"reported_at"`
+	FoundAt     *time.Time `json:"found_at,omitempty"`
+	ClosedAt    *time.Time `json:"closed_at,omitempty"`
+}
+
+// ReportRequest is the body for POST /trips/{id}/lost-item.
+type ReportRequest struct {
+	Description string `json:"description" validate:"required,maxLength=1000"`
+}
+
+// AnswerRequest is the optional body for the driver's found / not-found
+// answers: where to pick the item up, or what was checked.
+type AnswerRequest struct {
+	Note string `json:"note" validate:"maxLength=1000"`
+}
+
+// Filter narrows GET /admin/lost-items. Empty fields match everything.
+type Filter struct {
+	Status   string
+	TripID   string
+	DriverID string
+}
+
+// Page is a page of GET /admin/lost-items, newest first.
+type Page struct {
+	Items  []Item `json:"items"`
+	Total  int    `json:"total"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+}
+
+// Notification is pushed to the trip's WebSocket subscribers when a report
+// is filed or changes status.
+type Notification struct {
+	Type string `json:"type"` // lost_item.updated
+	Item *Item  `json:"item"`
+}
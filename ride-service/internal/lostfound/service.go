@@ -0,0 +1,278 @@
+package lostfound
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/internal/trips"
+	"ride-service/internal/trips/statemachine"
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+)
+
+var (
+	ErrTripNotFound   = apierror.NotFound("trip not found")
+	ErrNotFound       = apierror.NotFound("lost item not found")
+	ErrNotParticipant = apierror.Forbidden("not a participant in this trip")
+	ErrForbidden      = apierror.Forbidden("not allowed for your role on this trip")
+	ErrClosed         = apierror.Conflict("lost items can only be reported on a completed trip within the reporting window")
+	ErrTooMany        = apierror.Conflict("too many open lost item reports on this trip")
+	ErrStatus         = apierror.Conflict("lost item is not in a status that allows this")
+	ErrInvalid        = apierror.Validation("invalid lost item")
+)
+
+const columns = `id,trip_id,rider_id,driver_id,description,status,driver_note,reported_at,found_at,closed_at`
+
+// Notifier delivers updates to the trip's live subscribers (rider and driver
+// apps on /ws/trips/:id).
+type Notifier interface {
+	Notify(tripID string, msg any)
+}
+
+// TripReader returns trips; trips.TripRepo implements it.
+type TripReader interface {
+	GetByID(ctx context.Context, id string) (*trips.Trip, error)
+}
+
+// Service runs the lost-and-found workflow: riders report items after a
+// trip, the driver answers, and either side confirms the return. While a
+// report is open the trip's chat stays open too (see chat.Service).
+type Service struct {
+	db     *pgxpool.Pool
+	trips  TripReader
+	notify Notifier
+	window time.Duration
+}
+
+// NewService creates a lost-and-found service. Riders can report items up to
+// window after their trip completed.
+func NewService(db *pgxpool.Pool, t TripReader, n Notifier, window time.Duration) *Service {
+	return &Service{db: db, trips: t, notify: n, window: window}
+}
+
+// trip returns tripID, reporting a missing one as ErrTripNotFound.
+func (s *Service) trip(ctx context.Context, tripID string) (*trips.Trip, error) {
+	t, err := s.trips.GetByID(ctx, tripID)
+	if errors.Is(err, trips.ErrNotFound) {
+		return nil, ErrTripNotFound
+	}
+	return t, err
+}
+
+// Report files a lost item on a completed trip for its rider.
+func (s *Service) Report(ctx context.Context, tripID, userID string, req ReportRequest) (*Item, error) {
+	desc := strings.TrimSpace(req.Description)
+	if desc == "" {
+		return nil, fmt.Errorf("%w: description is required", ErrInvalid)
+	}
+	if utf8.RuneCountInString(desc) > MaxDescription {
+		return nil, fmt.Errorf("%w: description is at most %d characters", ErrInvalid, MaxDescription)
+	}
+	t, err := s.trip(ctx, tripID)
+	if err != nil {
+		return nil, err
+	}
+	if userID != t.RiderID {
+		if t.DriverID != nil && userID == *t.DriverID {
+			return nil, ErrForbidden
+		}
+		return nil, ErrNotParticipant
+	}
+	if t.Status != statemachine.Completed || t.DriverID == nil || t.CompletedAt == nil ||
+		time.Since(*t.CompletedAt) > s.window {
+		return nil, ErrClosed
+	}
+	// The count and insert are one statement so concurrent reports can't
+	// both slip under the cap.
+	it, err := scanItem(s.db.QueryRow(ctx,
+		`INSERT INTO lost_items (id,trip_id,rider_id,driver_id,description)
+		 SELECT $1,$2,$3,$4,$5
+		 WHERE (SELECT COUNT(*) FROM lost_items WHERE trip_id=$2 AND status IN ('reported','found')) < $6
+		 RETURNING `+columns,
+		uuid.New().String(), tripID, t.RiderID, *t.DriverID, desc, maxOpenPerTrip))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrTooMany
+	} else if err != nil {
+		return nil, err
+	}
+	s.notify.Notify(tripID, Notification{Type: "lost_item.updated", Item: it})
+	return it, nil
+}
+
+// ForTrip lists a trip's reports, oldest first, for its rider, its driver
+// or staff.
+func (s *Service) ForTrip(ctx context.Context, tripID string, claims *jwt.Claims) ([]Item, error) {
+	t, err := s.trip(ctx, tripID)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Role != "admin" && claims.Role != "support" &&
+		claims.UserID != t.RiderID && (t.DriverID == nil || claims.UserID != *t.DriverID) {
+		return nil, ErrNotParticipant
+	}
+	return s.query(ctx, `SELECT `+columns+` FROM lost_items WHERE trip_id=$1 ORDER BY reported_at, id`, tripID)
+}
+
+// ForDriver lists reports on a driver's trips, newest first. Without all,
+// only those still waiting on the driver or the return are listed.
+func (s *Service) ForDriver(ctx context.Context, driverID string, all bool) ([]Item, error) {
+	if _, err := uuid.Parse(driverID); err != nil {
+		return []Item{}, nil
+	}
+	return s.query(ctx,
+		`SELECT `+columns+` FROM lost_items
+		 WHERE driver_id=$1 AND ($2 OR status IN ('reported','found'))
+		 ORDER BY reported_at DESC, id LIMIT 200`, driverID, all)
+}
+
+// Found records the driver finding the item; note says how to get it back.
+func (s *Service) Found(ctx context.Context, tripID, itemID, userID, note string) (*Item, error) {
+	return s.answer(ctx, tripID, itemID, userID, note, StatusFound,
+		`status='found', found_at=NOW(), driver_note=NULLIF($3,'')`)
+}
+
+// NotFound records the driver not finding the item, closing the report.
+func (s *Service) NotFound(ctx context.Context, tripID, itemID, userID, note string) (*Item, error) {
+	return s.answer(ctx, tripID, itemID, userID, note, StatusNotFound,
+		`status='not_found', closed_at=NOW(), driver_note=NULLIF($3,'')`)
+}
+
+// answer applies the driver's answer to a reported item.
+func (s *Service) answer(ctx context.Context, tripID, itemID, userID, note, to, set string) (*Item, error) {
+	note = strings.TrimSpace(note)
+	if utf8.RuneCountInString(note) > MaxDescription {
+		return nil, fmt.Errorf("%w: note is at most %d characters", ErrInvalid, MaxDescription)
+	}
+	it, err := s.item(ctx, tripID, itemID)
+	if err != nil {
+		return nil, err
+	}
+	if userID != it.DriverID {
+		if userID == it.RiderID {
+			return nil, ErrForbidden
+		}
+		return nil, ErrNotParticipant
+	}
+	return s.update(ctx, it, StatusReported, set, note)
+}
+
+// Returned records the item back with the rider. Either side can confirm.
+func (s *Service) Returned(ctx context.Context, tripID, itemID, userID string) (*Item, error) {
+	it, err := s.item(ctx, tripID, itemID)
+	if err != nil {
+		return nil, err
+	}
+	if userID != it.RiderID && userID != it.DriverID {
+		return nil, ErrNotParticipant
+	}
+	return s.update(ctx, it, StatusFound, `status='returned', closed_at=NOW()`)
+}
+
+// update moves it from status from, guarding against a concurrent change.
+// set is the SET clause; args fill its parameters from $3.
+func (s *Service) update(ctx context.Context, it *Item, from, set string, args ...any) (*Item, error) {
+	if it.Status != from {
+		return nil, fmt.Errorf("%w: item is %s", ErrStatus, it.Status)
+	}
+	updated, err := scanItem(s.db.QueryRow(ctx,
+		`UPDATE lost_items SET `+set+` WHERE id=$1 AND status=$2 RETURNING `+columns,
+		append([]any{it.ID, from}, args...)...))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w: item changed meanwhile", ErrStatus)
+	} else if err != nil {
+		return nil, err
+	}
+	s.notify.Notify(updated.TripID, Notification{Type: "lost_item.updated", Item: updated})
+	return updated, nil
+}
+
+func (s *Service) item(ctx context.Context, tripID, itemID string) (*Item, error) {
+	if _, err := uuid.Parse(tripID); err != nil {
+		return nil, ErrNotFound
+	}
+	if _, err := uuid.Parse(itemID); err != nil {
+		return nil, ErrNotFound
+	}
+	it, err := scanItem(s.db.QueryRow(ctx, `SELECT `+columns+` FROM lost_items WHERE id=$1 AND trip_id=$2`, itemID, tripID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return it, err
+}
+
+// List returns reports for GET /admin/lost-items, newest first.
+func (s *Service) List(ctx context.Context, f Filter, limit, offset int) (*Page, error) {
+	if f.Status != "" && !slices.Contains(Statuses, f.Status) {
+		return nil, fmt.Errorf("%w: unknown status %q", ErrInvalid, f.Status)
+	}
+	for name, id := range map[string]string{"trip_id": f.TripID, "driver_id": f.DriverID} {
+		if id == "" {
+			continue
+		}
+		if _, err := uuid.Parse(id); err != nil {
+			return nil, fmt.Errorf("%w: %s must be a UUID", ErrInvalid, name)
+		}
+	}
+	where := `($1='' OR status=$1) AND ($2='' OR trip_id::text=$2) AND ($3='' OR driver_id::text=$3)`
+	args := []any{f.Status, f.TripID, f.DriverID}
+	p := &Page{Limit: limit, Offset: offset}
+	if err := s.db.QueryRow(ctx, `SELECT COUNT(*) FROM lost_items WHERE `+where, args...).Scan(&p.Total); err != nil {
+		return nil, err
+	}
+	items, err := s.query(ctx,
+		`SELECT `+columns+` FROM lost_items WHERE `+where+` ORDER BY reported_at DESC, id LIMIT $4 OFFSET $5`,
+		append(args, limit, offset)...)
+	if err != nil {
+		return nil, err
+	}
+	p.Items = items
+	return p, nil
+}
+
+// Get returns one report.
+func (s *Service) Get(ctx context.Context, id string) (*Item, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+	it, err := scanItem(s.db.QueryRow(ctx, `SELECT `+columns+` FROM lost_items WHERE id=$1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return it, err
+}
+
+func (s *Service) query(ctx context.Context, sql string, args ...any) ([]Item, error) {
+	rows, err := s.db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Item{}
+	for rows.Next() {
+		it, err := scanItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, *it)
+	}
+	return items, rows.Err()
+}
+
+func scanItem(row pgx.Row) (*Item, error) {
+	var it Item
+	err := row.Scan(&it.ID, &it.TripID, &it.RiderID, &it.DriverID, &it.Description, &it.Status,
+		&it.DriverNote, &it.ReportedAt, &it.FoundAt, &it.ClosedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &it, nil
+}
@@ -0,0 +1,204 @@
+package matching
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"ride-service/internal/events"
+	"ride-service/pkg/eventbus"
+)
+
+// unreachable is the cost of leaving a request unmatched or pairing it with a
+// driver outside its radius. It dwarfs any real pickup distance, so the
+// solver matches as many requests as it can before minimising distance.
+const unreachable = 1e9
+
+// batcher collects ride requests per zone for Matching.BatchWindow and then
+// assigns the whole zone's batch at once, minimising total pickup distance
+// instead of serving each request its nearest driver in arrival order.
+//
+// Requests are acknowledged to the event bus when they join a batch, so a crash loses
+// at most one window of them (they stay REQUESTED). Flush on shutdown
+// assigns whatever is still waiting.
+type batcher struct {
+	m      *Matcher
+	window time.Duration
+
+	mu    sync.Mutex
+	zones map[string][]events.RideRequestedEvent
+}
+
+func newBatcher(m *Matcher, window time.Duration) *batcher {
+	return &batcher{m: m, window: window, zones: map[string][]events.RideRequestedEvent{}}
+}
+
+// add queues ev in its pickup zone; the first request of a zone starts the
+// zone's window.
+func (b *batcher) add(ev events.RideRequestedEvent) {
+	zone := b.zone(ev.Pickup)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.zones[zone]) == 0 {
+		time.AfterFunc(b.window, func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			b.flushZone(ctx, zone)
+		})
+	}
+	b.zones[zone] = append(b.zones[zone], ev)
+}
+
+// zone buckets pickups into square cells one matching radius wide, so a
+// batch only holds requests that can share drivers.
+func (b *batcher) zone(p events.LatLng) string {
+	cellLat := b.m.cfg.RadiusKm / 111.0
+	cellLng := cellLat / math.Max(math.Cos(p.Lat*math.Pi/180), 0.01)
+	return fmt.Sprintf("%d:%d", int(math.Floor(p.Lat/cellLat)), int(math.Floor(p.Lng/cellLng)))
+}
+
+// flush assigns every waiting batch now.
+func (b *batcher) flush(ctx context.Context) {
+	b.mu.Lock()
+	zones := make([]string, 0, len(b.zones))
+	for z := range b.zones {
+		zones = append(zones, z)
+	}
+	b.mu.Unlock()
+	for _, z := range zones {
+		b.flushZone(ctx, z)
+	}
+}
+
+func (b *batcher) flushZone(ctx context.Context, zone string) {
+	b.mu.Lock()
+	batch := b.zones[zone]
+	delete(b.zones, zone)
+	b.mu.Unlock()
+	if len(batch) > 0 {
+		b.m.assignBatch(ctx, batch)
+	}
+}
+
+// assignBatch pairs requests with nearby drivers so that the total pickup
+// distance is minimal. Drivers outside the rate thresholds count as further
+// away than any pickup in the batch, so they are used only when that frees a
+// closer driver for someone else or nobody else is free.
+func (m *Matcher) assignBatch(ctx context.Context, batch []events.RideRequestedEvent) {
+	dist := make([]map[string]float64, len(batch))
+	radii := make([]radius, len(batch))
+	chained := map[string]string{}
+	var drivers []string
+	for i, ev := range batch {
+		nearby, r, err := m.nearby(ctx, ev.Pickup, candidatePool)
+		radii[i] = r
+		if err == nil {
+			var finishing map[string]string
+			nearby, finishing = m.withChained(ctx, ev.Pickup, nearby, r)
+			maps.Copy(chained, finishing)
+			nearby, err = m.unblocked(ctx, ev.RiderID, nearby)
+		}
+		if err != nil {
+			logger.Error("nearby search failed", "trip", ev.TripID, "err", err)
+			m.requeue(ctx, ev)
+			batch[i] = events.RideRequestedEvent{} // requeued; leave it out of the batch
+			continue
+		}
+		dist[i] = map[string]float64{}
+		for _, d := range nearby {
+			if slices.Contains(ev.ExcludeDrivers, d.DriverID) {
+				continue
+			}
+			dist[i][d.DriverID] = d.DistanceKm
+			if !slices.Contains(drivers, d.DriverID) {
+				drivers = append(drivers, d.DriverID)
+			}
+		}
+	}
+
+	stats, err := m.drivers.CandidateStats(ctx, drivers)
+	if err != nil {
+		logger.Warn("candidate stats lookup failed; ranking by distance only", "err", err)
+	}
+	for i, ev := range batch {
+		for id := range dist[i] {
+			if st, ok := stats[id]; ok && !fits(st, ev) || !ok && ev.WomenOnly {
+				delete(dist[i], id)
+			}
+		}
+	}
+	// Radii expand and differ by city, and chained drivers are reached past
+	// them, so the configured radius can be shorter than the distances the
+	// penalty must outweigh.
+	widest := m.cfg.RadiusKm
+	for i := range dist {
+		widest = max(widest, radii[i].Km)
+		for _, d := range dist[i] {
+			widest = max(widest, d)
+		}
+	}
+	penalty := map[string]float64{}
+	for id, st := range stats {
+		if m.score(0, m.cfg.RadiusKm, st, "", events.MatchWeights{}, time.Now()).Deprioritized {
+			penalty[id] = widest
+		}
+	}
+
+	cost := make([][]float64, len(batch))
+	for i := range cost {
+		cost[i] = make([]float64, len(drivers))
+		for j, id := range drivers {
+			d, ok := dist[i][id]
+			if !ok || batch[i].TripID == "" {
+				cost[i][j] = unreachable
+				continue
+			}
+			cost[i][j] = d + penalty[id]
+		}
+	}
+
+	w := m.Weights()
+	now := time.Now()
+	var matched int
+	var totalKm float64
+	for i, j := range pair(cost, len(drivers)) {
+		if batch[i].TripID == "" {
+			continue
+		}
+		ev := batch[i]
+		if j < 0 {
+			logger.Info("no nearby drivers", "trip", ev.TripID, "radius_km", radii[i].Km, "batch", len(batch))
+			continue
+		}
+		st, ok := stats[drivers[j]]
+		if !ok {
+			st = events.DriverStats{Rating: 5}
+		}
+		score := m.score(dist[i][drivers[j]], radii[i].Km, st, ev.VehicleType, w, now)
+		score.Candidates, score.Batch = len(dist[i]), len(batch)
+		score.ChainedTrip = chained[drivers[j]]
+		if err := m.assign(ctx, ev, drivers[j], score); err != nil {
+			m.requeue(ctx, ev)
+			continue
+		}
+		matched++
+		totalKm += score.DistanceKm
+	}
+	logger.Info("batch assigned", "requests", len(batch), "drivers", len(drivers),
+		"matched", matched, "total_pickup_km", round3(totalKm))
+}
+
+// requeue publishes ev to ride.requested again so a later batch retries it.
+func (m *Matcher) requeue(ctx context.Context, ev events.RideRequestedEvent) {
+	env, err := events.Wrap(ev)
+	if err == nil {
+		err = m.bus.Publish(ctx, eventbus.TopicRideRequested, ev.TripID, env)
+	}
+	if err != nil {
+		logger.Error("requeue ride.requested failed; trip needs manual assignment", "trip", ev.TripID, "err", err)
+	}
+}
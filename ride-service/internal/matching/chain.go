@@ -0,0 +1,51 @@
+package matching
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	"ride-service/internal/events"
+	"ride-service/pkg/geo"
+)
+
+// ChainLookup finds drivers about to finish a trip near a pickup: those
+// whose drop is within dropKm of it and who are within reachKm of the drop.
+// The trips service implements it.
+type ChainLookup interface {
+	Finishing(ctx context.Context, pickup events.LatLng, dropKm, reachKm float64) ([]events.FinishingDriver, error)
+}
+
+// ChainFrom lets the matcher offer trips to drivers finishing one nearby, up
+// to Matching.ChainMaxETA from its drop. Without it, only pooled drivers are
+// matched.
+func (m *Matcher) ChainFrom(l ChainLookup) { m.chain = l }
+
+// withChained adds the drivers finishing a trip near pickup to nearby, as
+// far away as the rest of their trip plus the way from its drop, and
+// returns them nearest first with the trip each one is finishing. If the
+// lookup fails, matching goes on with the pooled drivers only.
+func (m *Matcher) withChained(ctx context.Context, pickup events.LatLng, nearby []geo.Nearby, r radius) ([]geo.Nearby, map[string]string) {
+	if m.chain == nil || m.cfg.ChainMaxETA <= 0 {
+		return nearby, nil
+	}
+	reachKm := m.cfg.ChainSpeedKmh * m.cfg.ChainMaxETA.Hours()
+	finishing, err := m.chain.Finishing(ctx, pickup, r.Km, reachKm)
+	if err != nil {
+		logger.Warn("finishing drivers lookup failed; matching pooled drivers only", "err", err)
+		return nearby, nil
+	}
+	if len(finishing) == 0 {
+		return nearby, nil
+	}
+	chained := make(map[string]string, len(finishing))
+	for _, f := range finishing {
+		if slices.ContainsFunc(nearby, func(d geo.Nearby) bool { return d.DriverID == f.DriverID }) {
+			continue
+		}
+		chained[f.DriverID] = f.TripID
+		nearby = append(nearby, geo.Nearby{DriverID: f.DriverID, DistanceKm: round3(f.RemainingKm + f.ToPickupKm)})
+	}
+	slices.SortStableFunc(nearby, func(a, b geo.Nearby) int { return cmp.Compare(a.DistanceKm, b.DistanceKm) })
+	return nearby, chained
+}
@@ -0,0 +1,57 @@
+package matching
+
+import (
+	"context"
+	"slices"
+
+	"ride-service/internal/events"
+	"ride-service/pkg/geo"
+)
+
+// FavoriteLookup returns the drivers a rider marked as favorites.
+type FavoriteLookup interface {
+	Favorites(ctx context.Context, riderID string) ([]string, error)
+}
+
+// PreferFavorites has the matcher offer a rider's trip to their favorite
+// drivers nearby before anyone else.
+func (m *Matcher) PreferFavorites(l FavoriteLookup) { m.favorites = l }
+
+// favored returns the rider's favorite drivers who are in the pool within
+// the radius of ev's pickup and can take it, best scored first. They get
+// the first offer, one at a time like any match: one declining brings the
+// trip back without them. A failed lookup only skips this step.
+func (m *Matcher) favored(ctx context.Context, ev events.RideRequestedEvent) []candidate {
+	if m.favorites == nil {
+		return nil
+	}
+	ids, err := m.favorites.Favorites(ctx, ev.RiderID)
+	if err != nil {
+		logger.Warn("favorite drivers lookup failed", "trip", ev.TripID, "err", err)
+		return nil
+	}
+	ids = slices.DeleteFunc(ids, func(id string) bool { return slices.Contains(ev.ExcludeDrivers, id) })
+	if len(ids) == 0 {
+		return nil
+	}
+	// The radius is the one a match would search, but favorites anywhere in
+	// it count, not only those among the nearest candidatePool drivers.
+	_, r, err := m.nearby(ctx, ev.Pickup, candidatePool)
+	var nearby []geo.Nearby
+	if err == nil {
+		nearby, err = m.locations.SearchNearbyDrivers(ctx, ev.Pickup.Lat, ev.Pickup.Lng, r.Km, 0)
+	}
+	if err == nil {
+		nearby = slices.DeleteFunc(nearby, func(d geo.Nearby) bool { return !slices.Contains(ids, d.DriverID) })
+		nearby, err = m.unblocked(ctx, ev.RiderID, nearby)
+	}
+	if err != nil {
+		logger.Warn("favorite drivers search failed", "trip", ev.TripID, "err", err)
+		return nil
+	}
+	ranked := m.rank(ctx, nearby, r.Km, &ev)
+	for i := range ranked {
+		ranked[i].Favorite = true
+	}
+	return ranked
+}
@@ -0,0 +1,74 @@
+package matching
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/internal/events"
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+)
+
+// Handler exposes the matcher's runtime settings to admins and queue
+// positions to drivers.
+type Handler struct{ m *Matcher }
+
+// NewHandler wires a handler to the matcher.
+func NewHandler(m *Matcher) *Handler { return &Handler{m: m} }
+
+// AdminRoutes returns the routes mounted at /admin/matching.
+func (h *Handler) AdminRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+	r.Use(jwt.RequireRole("admin"))
+
+	r.Get("/weights", h.Weights)
+	r.Put("/weights", h.SetWeights)
+
+	return r
+}
+
+// DriverRoutes returns the routes mounted at /drivers/{id}/queue.
+func (h *Handler) DriverRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+	r.Get("/", h.Queue)
+	return r
+}
+
+func (h *Handler) Weights(w http.ResponseWriter, _ *http.Request) {
+	apierror.WriteJSON(w, http.StatusOK, h.m.Weights())
+}
+
+// SetWeights replaces all six weights; omitted ones become zero.
+func (h *Handler) SetWeights(w http.ResponseWriter, r *http.Request) {
+	var req events.MatchWeights
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	if err := h.m.SetWeights(req); err != nil {
+		apierror.Write(w, apierror.Validation(err.Error()))
+		return
+	}
+	logger.Info("match weights changed", "weights", req, "by", jwt.GetClaims(r.Context()).UserID)
+	apierror.WriteJSON(w, http.StatusOK, h.m.Weights())
+}
+
+// Queue serves GET /drivers/{id}/queue to the driver and staff.
+func (h *Handler) Queue(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	claims := jwt.GetClaims(r.Context())
+	if claims == nil || (claims.UserID != id && claims.Role != "admin" && claims.Role != "support") {
+		apierror.Write(w, apierror.Forbidden("forbidden"))
+		return
+	}
+	pos, err := h.m.queues.Position(r.Context(), id)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, pos)
+}
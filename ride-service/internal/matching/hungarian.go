@@ -0,0 +1,93 @@
+package matching
+
+import "math"
+
+// pair matches the rows of a cost matrix of requests by drivers, cols wide,
+// to at most one column each so that the total cost is minimal. It returns
+// the column of each row, or -1 for a row left without one or only
+// reachable at the unreachable cost.
+func pair(cost [][]float64, cols int) []int {
+	n := max(len(cost), cols)
+	square := make([][]float64, n)
+	for i := range square {
+		square[i] = make([]float64, n)
+		for j := range square[i] {
+			switch {
+			case i >= len(cost):
+				// Spare driver: no request to serve.
+			case j >= cols:
+				square[i][j] = unreachable
+			default:
+				square[i][j] = cost[i][j]
+			}
+		}
+	}
+	out := hungarian(square)[:len(cost)]
+	for i, j := range out {
+		if j >= cols || cost[i][j] >= unreachable {
+			out[i] = -1
+		}
+	}
+	return out
+}
+
+// hungarian solves the assignment problem for a square cost matrix: it
+// returns, for each row, the column assigned to it so that the total cost is
+// minimal. It runs in O(n³), which is fine for the few dozen requests in a
+// batch.
+func hungarian(cost [][]float64) []int {
+	n := len(cost)
+	// Potentials and matching are 1-indexed; column 0 is a sentinel.
+	u := make([]float64, n+1)
+	v := make([]float64, n+1)
+	match := make([]int, n+1) // match[col] = row
+	way := make([]int, n+1)
+
+	for row := 1; row <= n; row++ {
+		match[0] = row
+		col0 := 0
+		minv := make([]float64, n+1)
+		used := make([]bool, n+1)
+		for j := range minv {
+			minv[j] = math.Inf(1)
+		}
+		for {
+			used[col0] = true
+			i0, delta, col1 := match[col0], math.Inf(1), 0
+			for j := 1; j <= n; j++ {
+				if used[j] {
+					continue
+				}
+				if cur := cost[i0-1][j-1] - u[i0] - v[j]; cur < minv[j] {
+					minv[j], way[j] = cur, col0
+				}
+				if minv[j] < delta {
+					delta, col1 = minv[j], j
+				}
+			}
+			for j := 0; j <= n; j++ {
+				if used[j] {
+					u[match[j]] += delta
+					v[j] -= delta
+				} else {
+					minv[j] -= delta
+				}
+			}
+			col0 = col1
+			if match[col0] == 0 {
+				break
+			}
+		}
+		for col0 != 0 {
+			col1 := way[col0]
+			match[col0] = match[col1]
+			col0 = col1
+		}
+	}
+
+	out := make([]int, n)
+	for col := 1; col <= n; col++ {
+		out[match[col]-1] = col - 1
+	}
+	return out
+}
@@ -0,0 +1,191 @@
+package matching
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// bruteForce returns the least total cost of giving each row a distinct
+// column of a square matrix, trying every permutation.
+func bruteForce(cost [][]float64) float64 {
+	n := len(cost)
+	cols := make([]int, n)
+	for i := range cols {
+		cols[i] = i
+	}
+	best := math.Inf(1)
+	var permute func(k int)
+	permute = func(k int) {
+		if k == n {
+			var total float64
+			for i, j := range cols {
+				total += cost[i][j]
+			}
+			best = min(best, total)
+			return
+		}
+		for i := k; i < n; i++ {
+			cols[k], cols[i] = cols[i], cols[k]
+			permute(k + 1)
+			cols[k], cols[i] = cols[i], cols[k]
+		}
+	}
+	permute(0)
+	return best
+}
+
+// checkAssignment fails unless assigned gives each row a distinct column.
+func checkAssignment(t *testing.T, assigned []int, cols int) {
+	t.Helper()
+	seen := make([]bool, cols)
+	for i, j := range assigned {
+		if j < 0 {
+			continue
+		}
+		if j >= cols || seen[j] {
+			t.Fatalf("row %d got column %d in %v", i, j, assigned)
+		}
+		seen[j] = true
+	}
+}
+
+func countUnmatched(assigned []int) int {
+	n := 0
+	for _, j := range assigned {
+		if j < 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func TestHungarianIsOptimal(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for n := 1; n <= 6; n++ {
+		for round := 0; round < 50; round++ {
+			cost := make([][]float64, n)
+			for i := range cost {
+				cost[i] = make([]float64, n)
+				for j := range cost[i] {
+					// Few distinct values, so ties are common.
+					cost[i][j] = float64(rng.Intn(8))
+				}
+			}
+			got := hungarian(cost)
+			if len(got) != n {
+				t.Fatalf("%d rows assigned, want %d", len(got), n)
+			}
+			checkAssignment(t, got, n)
+			var total float64
+			for i, j := range got {
+				total += cost[i][j]
+			}
+			if want := bruteForce(cost); total != want {
+				t.Fatalf("cost %v: total %v, optimum %v (assigned %v)", cost, total, want, got)
+			}
+		}
+	}
+}
+
+func TestHungarianPrefersTheGlobalOptimum(t *testing.T) {
+	// Greedy would give row 0 its nearest column 0 and leave row 1 with a
+	// cost of 10.
+	got := hungarian([][]float64{
+		{1, 2},
+		{1, 10},
+	})
+	if !slices.Equal(got, []int{1, 0}) {
+		t.Errorf("assigned %v, want [1 0]", got)
+	}
+}
+
+func TestPair(t *testing.T) {
+	u := unreachable
+	tests := []struct {
+		name string
+		cost [][]float64
+		cols int
+		want []int
+	}{
+		{"no requests", nil, 3, []int{}},
+		{"no drivers", [][]float64{{}, {}}, 0, []int{-1, -1}},
+		{"more drivers than requests", [][]float64{
+			{5, 1, 9, 4},
+			{2, 1, 8, 7},
+		}, 4, []int{1, 0}},
+		{"more requests than drivers", [][]float64{
+			{3, 8},
+			{1, 2},
+			{4, 9},
+		}, 2, []int{0, 1, -1}},
+		{"unreachable row", [][]float64{
+			{u, u},
+			{1, 2},
+		}, 2, []int{-1, 0}},
+		{"reachability first", [][]float64{
+			{1, 50},
+			{2, u},
+		}, 2, []int{1, 0}},
+		{"only unreachable left", [][]float64{
+			{1, u},
+			{1, u},
+		}, 2, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pair(tt.cost, tt.cols)
+			checkAssignment(t, got, tt.cols)
+			if tt.want == nil {
+				// Either row may get the one driver; the other goes without.
+				if matched := len(got) - countUnmatched(got); matched != 1 {
+					t.Errorf("pair = %v, want one row matched", got)
+				}
+				return
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("pair = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPairRectangularIsOptimal(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for rows := 1; rows <= 5; rows++ {
+		for cols := 1; cols <= 5; cols++ {
+			cost := make([][]float64, rows)
+			for i := range cost {
+				cost[i] = make([]float64, cols)
+				for j := range cost[i] {
+					cost[i][j] = float64(1 + rng.Intn(20))
+				}
+			}
+			got := pair(cost, cols)
+			checkAssignment(t, got, cols)
+			if matched := rows - countUnmatched(got); matched != min(rows, cols) {
+				t.Fatalf("%dx%d: %d matched, want %d", rows, cols, matched, min(rows, cols))
+			}
+
+			// The optimum of the padded square problem, brute-forced.
+			n := max(rows, cols)
+			square := make([][]float64, n)
+			for i := range square {
+				square[i] = make([]float64, n)
+				if i < rows {
+					copy(square[i], cost[i])
+				}
+			}
+			var total float64
+			for i, j := range got {
+				if j >= 0 {
+					total += cost[i][j]
+				}
+			}
+			if want := bruteForce(square); total != want {
+				t.Fatalf("%dx%d %v: total %v, optimum %v", rows, cols, cost, total, want)
+			}
+		}
+	}
+}
@@ -2,63 +2,276 @@ package matching
 
 import (
 	"context"
-	"encoding/json"
-	"log"
+	"errors"
+	"slices"
+	"sync"
 
 	"ride-service/internal/events"
-	"ride-service/pkg/kafka"
+	"ride-service/pkg/config"
+	"ride-service/pkg/eventbus"
+	"ride-service/pkg/featureflags"
+	"ride-service/pkg/geo"
+	"ride-service/pkg/logging"
 	rredis "ride-service/pkg/redis"
 )
 
-// Matcher consumes ride.requested events, finds the nearest driver,
-// and publishes driver.assigned.
+var logger = logging.For("matching")
+
+// errDriverTaken means another trip holds the driver's reservation.
+var errDriverTaken = errors.New("driver reserved for another trip")
+
+// candidatePool is how many of the nearest drivers are considered per match.
+const candidatePool = 10
+
+// Matcher consumes ride.requested events, scores the nearby drivers,
+// and publishes driver.assigned for the best one.
 type Matcher struct {
-	kafka *kafka.Client
-	redis *rredis.Client
+	bus       eventbus.Bus
+	redis     *rredis.Client
+	locations geo.Index
+	drivers   DriverLookup
+	blocks    BlockLookup // nil when there are no blocks to honor
+	cfg       config.Matching
+
+	mu      sync.RWMutex
+	weights events.MatchWeights
+
+	batch     *batcher // nil unless BatchWindow is set
+	queues    *Queues
+	chain     ChainLookup    // nil unless set with ChainFrom
+	favorites FavoriteLookup // nil unless set with PreferFavorites
+	flags     *featureflags.Flags
+}
+
+// DriverLookup resolves the vehicle card embedded in driver.assigned and the
+// stats candidates are scored on.
+type DriverLookup interface {
+	VehicleCard(ctx context.Context, driverID string) (*events.VehicleCard, error)
+	CandidateStats(ctx context.Context, driverIDs []string) (map[string]events.DriverStats, error)
+}
+
+// BlockLookup tells which drivers are blocked with a rider, by either side.
+type BlockLookup interface {
+	Blocked(ctx context.Context, riderID string, driverIDs []string) ([]string, error)
+}
+
+// NewMatcher creates a new matcher. Nearby drivers come from locations;
+// reservations are held in Redis. Pickups inside a queue zone go to the
+// drivers waiting in queues first. Drivers blocked with the rider are never
+// offered; blocks may be nil where nobody can block anyone, as in
+// STORAGE=memory.
+func NewMatcher(bus eventbus.Bus, r *rredis.Client, locations geo.Index, d DriverLookup, blocks BlockLookup, queues *Queues, cfg config.Matching) *Matcher {
+	m := &Matcher{bus: bus, redis: r, locations: locations, drivers: d, blocks: blocks, queues: queues, cfg: cfg, weights: events.MatchWeights(cfg.Weights)}
+	if cfg.BatchWindow > 0 {
+		m.batch = newBatcher(m, cfg.BatchWindow)
+	}
+	return m
+}
+
+// UseFlags has the matcher check flags for the matching.score_v2 rollout.
+// Without it every trip is ranked with the original score.
+func (m *Matcher) UseFlags(f *featureflags.Flags) { m.flags = f }
+
+// Weights returns the current score weights.
+func (m *Matcher) Weights() events.MatchWeights {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.weights
+}
+
+// SetWeights replaces the score weights for matches made from now on.
+func (m *Matcher) SetWeights(w events.MatchWeights) error {
+	if err := config.MatchWeights(w).Check(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.weights = w
+	m.mu.Unlock()
+	return nil
+}
+
+// Candidates returns up to limit available drivers within the matching radius
+// of pickup, best scored first. It does not reserve them.
+func (m *Matcher) Candidates(ctx context.Context, pickup events.LatLng, limit int) ([]string, error) {
+	nearby, r, err := m.nearby(ctx, pickup, limit)
+	if err != nil {
+		return nil, err
+	}
+	ranked := m.rank(ctx, nearby, r.Km, nil)
+	ids := make([]string, len(ranked))
+	for i, c := range ranked {
+		ids[i] = c.DriverID
+	}
+	return ids, nil
 }
 
-// NewMatcher creates a new matcher.
-func NewMatcher(k *kafka.Client, r *rredis.Client) *Matcher {
-	return &Matcher{kafka: k, redis: r}
+// Available reports whether any available driver within the matching radius
+// of ev's pickup can take it: one with the seats and accessibility features
+// it asks for, not blocked with the rider. It does not reserve them.
+func (m *Matcher) Available(ctx context.Context, ev events.RideRequestedEvent) (bool, error) {
+	nearby, r, err := m.nearby(ctx, ev.Pickup, candidatePool)
+	if err == nil {
+		nearby, _ = m.withChained(ctx, ev.Pickup, nearby, r)
+		nearby, err = m.unblocked(ctx, ev.RiderID, nearby)
+	}
+	if err != nil {
+		return false, err
+	}
+	return len(m.rank(ctx, nearby, r.Km, &ev)) > 0, nil
 }
 
 // Start begins consuming ride.requested in a background goroutine.
 func (m *Matcher) Start(ctx context.Context) {
-	m.kafka.Subscribe(ctx, kafka.TopicRideRequested, "matching-group", func(data []byte) error {
+	m.bus.Subscribe(ctx, eventbus.TopicRideRequested, "matching-group", func(ctx context.Context, data []byte) error {
 		var ev events.RideRequestedEvent
-		if err := json.Unmarshal(data, &ev); err != nil {
+		if env, err := events.Unwrap(data, &ev); errors.Is(err, events.ErrUnsupportedVersion) {
+			// Published by a newer service version; leave it for consumers that understand it.
+			logger.Warn("skipping event", "event_id", env.EventID, "err", err)
+			return nil
+		} else if err != nil {
 			return err
 		}
 
-		log.Printf("[matching] ride.requested → trip=%s rider=%s", ev.TripID, ev.RiderID)
+		logger.Info("ride.requested received", "trip", ev.TripID, "rider", ev.RiderID)
+		// Inside a queue zone the longest-waiting driver who fits gets the
+		// trip, without batching. With nobody queued it is matched as usual.
+		if zone, ok := m.queues.zoneAt(ev.Pickup.Lat, ev.Pickup.Lng); ok {
+			queued, err := m.fromQueue(ctx, zone, ev)
+			if err != nil {
+				logger.Error("queue lookup failed", "trip", ev.TripID, "zone", zone.Name, "err", err)
+				return err
+			}
+			for _, c := range queued {
+				if err := m.assign(ctx, ev, c.DriverID, c.MatchScore); !errors.Is(err, errDriverTaken) {
+					return err
+				}
+			}
+			logger.Info("no queued driver can take the trip", "trip", ev.TripID, "zone", zone.Name, "queued", len(queued))
+		}
+		// A favorite driver of the rider nearby gets the first offer, in or
+		// out of batch mode.
+		for _, c := range m.favored(ctx, ev) {
+			if err := m.assign(ctx, ev, c.DriverID, c.MatchScore); !errors.Is(err, errDriverTaken) {
+				return err
+			}
+		}
+		if m.batch != nil {
+			m.batch.add(ev)
+			return nil
+		}
 
-		// Find nearest driver within 5 km
-		drivers, err := m.redis.GetNearbyDrivers(ctx, ev.Pickup.Lat, ev.Pickup.Lng, 5.0, 1)
+		// Find the nearest drivers within the pickup's radius, and those
+		// finishing a trip close to it, skipping any who already declined or
+		// cancelled this trip or are blocked with the rider.
+		nearby, r, err := m.nearby(ctx, ev.Pickup, candidatePool)
 		if err != nil {
-			// Redis error — return error so Kafka does NOT commit the offset and retries.
-			log.Printf("[matching] redis error for trip %s: %v", ev.TripID, err)
+			// Redis error — return error so the message is retried (and dead-lettered if Redis stays down).
+			logger.Error("nearby search failed", "trip", ev.TripID, "err", err)
+			return err
+		}
+		nearby, chained := m.withChained(ctx, ev.Pickup, nearby, r)
+		nearby = slices.DeleteFunc(nearby, func(d geo.Nearby) bool {
+			return slices.Contains(ev.ExcludeDrivers, d.DriverID)
+		})
+		if nearby, err = m.unblocked(ctx, ev.RiderID, nearby); err != nil {
+			logger.Error("block lookup failed", "trip", ev.TripID, "err", err)
 			return err
 		}
-		if len(drivers) == 0 {
+		logger.Debug("nearby search", "trip", ev.TripID, "lat", ev.Pickup.Lat, "lng", ev.Pickup.Lng,
+			"radius_km", r.Km, "radius_city", r.City, "density", r.Density, "candidates", len(nearby), "chained", len(chained),
+			"excluded", ev.ExcludeDrivers)
+		if len(nearby) == 0 {
 			// No drivers available — expected case, commit offset, wait for manual assign.
-			log.Printf("[matching] no nearby drivers for trip %s", ev.TripID)
+			logger.Info("no nearby drivers", "trip", ev.TripID, "radius_km", r.Km, "radius_city", r.City)
 			return nil
 		}
 
-		assigned := events.DriverAssignedEvent{
-			TripID:   ev.TripID,
-			DriverID: drivers[0],
+		// Another instance may have reserved a driver since the search; fall
+		// through to the next best.
+		ranked := m.rank(ctx, nearby, r.Km, &ev)
+		if len(ranked) == 0 {
+			logger.Info("no nearby driver can take the trip", "trip", ev.TripID, "candidates", len(nearby),
+				"seats", ev.Seats, "accessibility", ev.Accessibility)
+			return nil
 		}
-
-		if err := m.kafka.Publish(ctx, kafka.TopicDriverAssigned, ev.TripID, assigned); err != nil {
-			log.Printf("[matching] failed to publish driver.assigned: %v", err)
-			return err
+		for _, c := range ranked {
+			c.ChainedTrip = chained[c.DriverID]
+			if err := m.assign(ctx, ev, c.DriverID, c.MatchScore); !errors.Is(err, errDriverTaken) {
+				return err
+			}
 		}
-
-		// Remove driver from available pool so they aren't double-assigned
-		_ = m.redis.RemoveDriverLocation(ctx, drivers[0])
-
-		log.Printf("[matching] assigned driver %s → trip %s", drivers[0], ev.TripID)
+		logger.Info("all nearby drivers reserved", "trip", ev.TripID, "candidates", len(nearby))
 		return nil
 	})
 }
+
+// unblocked drops the drivers blocked with riderID from nearby. A failed
+// lookup is returned rather than matching without it, so blocks always hold.
+func (m *Matcher) unblocked(ctx context.Context, riderID string, nearby []geo.Nearby) ([]geo.Nearby, error) {
+	if len(nearby) == 0 || m.blocks == nil {
+		return nearby, nil
+	}
+	ids := make([]string, len(nearby))
+	for i, d := range nearby {
+		ids[i] = d.DriverID
+	}
+	blocked, err := m.blocks.Blocked(ctx, riderID, ids)
+	if err != nil || len(blocked) == 0 {
+		return nearby, err
+	}
+	return slices.DeleteFunc(nearby, func(d geo.Nearby) bool { return slices.Contains(blocked, d.DriverID) }), nil
+}
+
+// Flush assigns the requests still waiting in batch mode. Call it on
+// shutdown after the consumers have stopped.
+func (m *Matcher) Flush(ctx context.Context) {
+	if m.batch != nil {
+		m.batch.flush(ctx)
+	}
+}
+
+// assign reserves the driver, publishes driver.assigned for ev and takes the
+// driver out of the matching pool. It returns errDriverTaken if the driver is
+// reserved for another trip.
+func (m *Matcher) assign(ctx context.Context, ev events.RideRequestedEvent, driverID string, score events.MatchScore) error {
+	ok, err := m.redis.ReserveDriver(ctx, driverID, ev.TripID, m.cfg.ReservationTTL)
+	if err != nil {
+		logger.Error("driver reservation failed", "trip", ev.TripID, "driver", driverID, "err", err)
+		return err
+	}
+	if !ok {
+		logger.Debug("driver already reserved", "trip", ev.TripID, "driver", driverID)
+		return errDriverTaken
+	}
+
+	assigned := events.DriverAssignedEvent{
+		TripID:      ev.TripID,
+		DriverID:    driverID,
+		TripVersion: ev.TripVersion,
+		Score:       &score,
+	}
+	if card, err := m.drivers.VehicleCard(ctx, driverID); err == nil {
+		assigned.Vehicle = card
+	} else {
+		logger.Warn("vehicle card lookup failed", "driver", driverID, "err", err)
+	}
+
+	env, err := events.Wrap(assigned)
+	if err == nil {
+		err = m.bus.Publish(ctx, eventbus.TopicDriverAssigned, ev.TripID, env)
+	}
+	if err != nil {
+		logger.Error("publish driver.assigned failed", "trip", ev.TripID, "err", err)
+		_ = m.redis.ReleaseDriver(ctx, driverID, ev.TripID)
+		return err
+	}
+
+	// Remove driver from available pool so they aren't double-assigned
+	_ = m.locations.RemoveDriverLocation(ctx, driverID)
+	m.queues.leave(ctx, driverID)
+
+	logger.Info("driver assigned", "driver", driverID, "trip", ev.TripID,
+		"score", score.Total, "distance_km", score.DistanceKm, "radius_km", score.RadiusKm,
+		"deprioritized", score.Deprioritized, "batch", score.Batch, "chained_trip", score.ChainedTrip, "favorite", score.Favorite)
+	return nil
+}
@@ -0,0 +1,162 @@
+package matching
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+
+	"ride-service/internal/events"
+	"ride-service/pkg/config"
+	"ride-service/pkg/eventbus"
+	"ride-service/pkg/geo"
+	"ride-service/pkg/kafka"
+	rredis "ride-service/pkg/redis"
+)
+
+type noDrivers struct{}
+
+func (noDrivers) VehicleCard(context.Context, string) (*events.VehicleCard, error) {
+	return nil, errors.New("no card")
+}
+
+func (noDrivers) CandidateStats(context.Context, []string) (map[string]events.DriverStats, error) {
+	return nil, nil
+}
+
+type noBlocks struct{}
+
+func (noBlocks) Blocked(context.Context, string, []string) ([]string, error) { return nil, nil }
+
+// failingBus refuses every publish.
+type failingBus struct{ eventbus.Bus }
+
+func (failingBus) Publish(context.Context, string, string, any) error {
+	return errors.New("bus down")
+}
+
+const testTTL = 30 * time.Second
+
+// newTestMatcher returns a matcher on bus with its reservations in a fresh
+// in-process Redis, and that Redis.
+func newTestMatcher(t *testing.T, bus eventbus.Bus) (*Matcher, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	r, err := rredis.NewClient(mr.Addr(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewMatcher(bus, r, geo.NewMemory(), noDrivers{}, noBlocks{}, NewQueues(r, nil),
+		config.Matching{RadiusKm: 5, ReservationTTL: testTTL})
+	return m, mr
+}
+
+func request(tripID string) events.RideRequestedEvent {
+	return events.RideRequestedEvent{TripID: tripID, RiderID: "rider-" + tripID, TripVersion: 1}
+}
+
+// assigned returns the driver.assigned events published to bus.
+func assigned(t *testing.T, bus eventbus.Bus) []events.DriverAssignedEvent {
+	t.Helper()
+	recs, err := bus.Tail(context.Background(), eventbus.TopicDriverAssigned, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make([]events.DriverAssignedEvent, len(recs))
+	for i, rec := range recs {
+		if _, err := events.Unwrap(rec.Value, &out[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return out
+}
+
+func TestAssignReservesTheDriverForOneTrip(t *testing.T) {
+	ctx := context.Background()
+	bus := kafka.NewMemory(eventbus.Retry{})
+	m, _ := newTestMatcher(t, bus)
+
+	const racers = 8
+	errs := make([]error, racers)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = m.assign(ctx, request(string(rune('a'+i))), "driver-1", events.MatchScore{})
+		}(i)
+	}
+	wg.Wait()
+
+	var won int
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			won++
+		case !errors.Is(err, errDriverTaken):
+			t.Fatalf("assign: %v", err)
+		}
+	}
+	if won != 1 {
+		t.Fatalf("%d trips got the driver, want 1", won)
+	}
+	got := assigned(t, bus)
+	if len(got) != 1 || got[0].DriverID != "driver-1" || got[0].TripVersion != 1 {
+		t.Fatalf("published %+v, want one driver.assigned for driver-1", got)
+	}
+
+	// A redelivered request for the winning trip is not a clash.
+	if err := m.assign(ctx, request(got[0].TripID), "driver-1", events.MatchScore{}); err != nil {
+		t.Errorf("reassigning the same trip: %v", err)
+	}
+}
+
+func TestAssignFreesTheDriverWhenTheReservationExpires(t *testing.T) {
+	ctx := context.Background()
+	m, mr := newTestMatcher(t, kafka.NewMemory(eventbus.Retry{}))
+	if err := m.assign(ctx, request("a"), "driver-1", events.MatchScore{}); err != nil {
+		t.Fatal(err)
+	}
+	mr.FastForward(testTTL - time.Second)
+	if err := m.assign(ctx, request("b"), "driver-1", events.MatchScore{}); !errors.Is(err, errDriverTaken) {
+		t.Fatalf("before the TTL: err = %v, want errDriverTaken", err)
+	}
+	mr.FastForward(2 * time.Second)
+	if err := m.assign(ctx, request("b"), "driver-1", events.MatchScore{}); err != nil {
+		t.Fatalf("after the TTL: %v", err)
+	}
+}
+
+func TestAssignReleasesTheDriverWhenPublishFails(t *testing.T) {
+	ctx := context.Background()
+	m, mr := newTestMatcher(t, failingBus{})
+	if err := m.assign(ctx, request("a"), "driver-1", events.MatchScore{}); err == nil {
+		t.Fatal("assign succeeded without publishing")
+	}
+	if mr.Exists("driver:reservation:driver-1") {
+		t.Error("reservation kept after the publish failed")
+	}
+}
+
+func TestReleaseOnlyDropsTheTripsOwnReservation(t *testing.T) {
+	ctx := context.Background()
+	m, mr := newTestMatcher(t, kafka.NewMemory(eventbus.Retry{}))
+	if ok, err := m.redis.ReserveDriver(ctx, "driver-1", "a", testTTL); !ok || err != nil {
+		t.Fatalf("reserve: %v, %v", ok, err)
+	}
+	if err := m.redis.ReleaseDriver(ctx, "driver-1", "b"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := mr.Get("driver:reservation:driver-1"); got != "a" {
+		t.Fatalf("another trip's release left %q, want a", got)
+	}
+	if err := m.redis.ReleaseDriver(ctx, "driver-1", "a"); err != nil {
+		t.Fatal(err)
+	}
+	if mr.Exists("driver:reservation:driver-1") {
+		t.Error("reservation kept after its trip released it")
+	}
+}
@@ -0,0 +1,125 @@
+package matching
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"time"
+
+	"ride-service/internal/events"
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/config"
+	"ride-service/pkg/geo"
+	rredis "ride-service/pkg/redis"
+)
+
+// ErrNotQueued means the driver is not waiting in any queue zone.
+var ErrNotQueued = apierror.NotFound("driver is not in a queue zone").WithCode("not_queued")
+
+// queueScan is how far into a queue, and into the pool around its zone, a
+// match looks.
+const queueScan = 100
+
+// QueuePosition is a driver's place in a queue zone.
+type QueuePosition struct {
+	Zone     string `json:"zone"`
+	Position int64  `json:"position"` // 1 is offered the next pickup
+	Length   int64  `json:"length"`
+}
+
+// Queues keeps the FIFO queues of the configured queue zones. It watches
+// driver locations: drivers inside a zone join the back of its queue and
+// leave it when they drive out, go offline or are assigned.
+type Queues struct {
+	redis *rredis.Client
+	zones []config.QueueZone
+}
+
+// NewQueues creates the queues of zones.
+func NewQueues(r *rredis.Client, zones []config.QueueZone) *Queues {
+	return &Queues{redis: r, zones: zones}
+}
+
+// zoneAt returns the zone containing (lat,lng); where zones overlap the
+// first configured wins.
+func (q *Queues) zoneAt(lat, lng float64) (config.QueueZone, bool) {
+	for _, z := range q.zones {
+		if haversineKm(z.Lat, z.Lng, lat, lng) <= z.RadiusKm {
+			return z, true
+		}
+	}
+	return config.QueueZone{}, false
+}
+
+// DriverMoved queues a driver who is inside a zone and dequeues one who is
+// not.
+func (q *Queues) DriverMoved(ctx context.Context, driverID string, lat, lng float64) {
+	if len(q.zones) == 0 {
+		return
+	}
+	z, ok := q.zoneAt(lat, lng)
+	if !ok {
+		q.leave(ctx, driverID)
+		return
+	}
+	joined, err := q.redis.JoinQueue(ctx, z.Name, driverID, time.Now())
+	if err != nil {
+		logger.Error("join queue failed", "zone", z.Name, "driver", driverID, "err", err)
+	} else if joined {
+		logger.Info("driver queued", "zone", z.Name, "driver", driverID)
+	}
+}
+
+// DriverLeft dequeues a driver who went offline.
+func (q *Queues) DriverLeft(ctx context.Context, driverID string) {
+	if len(q.zones) > 0 {
+		q.leave(ctx, driverID)
+	}
+}
+
+func (q *Queues) leave(ctx context.Context, driverID string) {
+	if err := q.redis.LeaveQueue(ctx, driverID); err != nil {
+		logger.Error("leave queue failed", "driver", driverID, "err", err)
+	}
+}
+
+// Position returns driverID's place in their queue.
+func (q *Queues) Position(ctx context.Context, driverID string) (*QueuePosition, error) {
+	zone, place, size, ok, err := q.redis.QueuePosition(ctx, driverID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotQueued
+	}
+	return &QueuePosition{Zone: zone, Position: place, Length: size}, nil
+}
+
+// fromQueue returns the drivers queued in zone who can take ev, longest
+// waiting first. Only drivers still in the matchable pool count, so ones
+// already reserved or assigned are skipped.
+func (m *Matcher) fromQueue(ctx context.Context, zone config.QueueZone, ev events.RideRequestedEvent) ([]candidate, error) {
+	queued, err := m.queues.redis.QueueHead(ctx, zone.Name, queueScan)
+	if err != nil || len(queued) == 0 {
+		return nil, err
+	}
+	// The pickup is inside the zone, so every driver in it is within two radii.
+	nearby, err := m.locations.SearchNearbyDrivers(ctx, ev.Pickup.Lat, ev.Pickup.Lng, 2*zone.RadiusKm, queueScan)
+	if err != nil {
+		return nil, err
+	}
+	place := make(map[string]int, len(queued))
+	for i, id := range queued {
+		place[id] = i
+	}
+	nearby = slices.DeleteFunc(nearby, func(d geo.Nearby) bool {
+		_, ok := place[d.DriverID]
+		return !ok || slices.Contains(ev.ExcludeDrivers, d.DriverID)
+	})
+	if nearby, err = m.unblocked(ctx, ev.RiderID, nearby); err != nil {
+		return nil, err
+	}
+	ranked := m.rank(ctx, nearby, m.cfg.RadiusKm, &ev)
+	sort.SliceStable(ranked, func(i, j int) bool { return place[ranked[i].DriverID] < place[ranked[j].DriverID] })
+	return ranked, nil
+}
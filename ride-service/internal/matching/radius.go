@@ -0,0 +1,58 @@
+package matching
+
+import (
+	"context"
+	"math"
+
+	"ride-service/internal/events"
+	"ride-service/pkg/geo"
+)
+
+// radius is the search radius chosen for one pickup.
+type radius struct {
+	Km   float64
+	City string // the radius city whose bounds applied; "" for the defaults
+	// Density is how many pooled drivers the search saw, up to the target.
+	Density int
+}
+
+// bounds returns the radius limits for a pickup: those of the first radius
+// city containing it, or the defaults.
+func (m *Matcher) bounds(p events.LatLng) (city string, minKm, maxKm float64) {
+	d := m.cfg.Density
+	for _, c := range d.Cities {
+		if haversineKm(c.Lat, c.Lng, p.Lat, p.Lng) <= c.AreaKm {
+			return c.Name, c.MinRadiusKm, c.MaxRadiusKm
+		}
+	}
+	return "", d.MinRadiusKm, d.MaxRadiusKm
+}
+
+// nearby returns up to count pooled drivers within the matching radius of
+// p, nearest first, and the radius. With density matching on, the radius
+// reaches the target-th nearest driver, within the pickup's bounds: a
+// sparse area searches up to the maximum, a busy one only the minimum.
+func (m *Matcher) nearby(ctx context.Context, p events.LatLng, count int) ([]geo.Nearby, radius, error) {
+	target := m.cfg.Density.TargetDrivers
+	if target <= 0 {
+		found, err := m.locations.SearchNearbyDrivers(ctx, p.Lat, p.Lng, m.cfg.RadiusKm, count)
+		return found, radius{Km: m.cfg.RadiusKm, Density: len(found)}, err
+	}
+	city, minKm, maxKm := m.bounds(p)
+	found, err := m.locations.SearchNearbyDrivers(ctx, p.Lat, p.Lng, maxKm, max(count, target))
+	if err != nil {
+		return nil, radius{}, err
+	}
+	r := radius{Km: maxKm, City: city, Density: min(len(found), target)}
+	if len(found) >= target {
+		r.Km = min(max(found[target-1].DistanceKm, minKm), maxKm)
+	}
+	r.Km = math.Ceil(r.Km*1000) / 1000 // rounded up to keep the target-th driver in
+	within := found[:0]
+	for _, d := range found {
+		if d.DistanceKm <= r.Km && len(within) < count {
+			within = append(within, d)
+		}
+	}
+	return within, r, nil
+}
@@ -0,0 +1,176 @@
+package matching
+
+import (
+	"context"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"ride-service/internal/events"
+	"ride-service/pkg/featureflags"
+	"ride-service/pkg/geo"
+)
+
+// idleFull is the time since a driver's last trip at which the idle
+// component reaches 1; waiting longer earns nothing more.
+const idleFull = time.Hour
+
+// candidate is a nearby driver and their score.
+type candidate struct {
+	DriverID string
+	events.MatchScore
+}
+
+// rank scores nearby drivers for trip, found within radiusKm, and orders
+// them best first. Drivers
+// outside the acceptance or cancellation thresholds go after all others
+// whatever their score, and drivers who cannot take the trip (see fits) are
+// left out. With a nil trip every driver is scored as if for any vehicle
+// type. If the driver stats cannot be loaded, everything but distance scores
+// the same for everyone, except that a women-only trip then matches nobody.
+func (m *Matcher) rank(ctx context.Context, nearby []geo.Nearby, radiusKm float64, trip *events.RideRequestedEvent) []candidate {
+	if len(nearby) == 0 {
+		return nil
+	}
+	ids := make([]string, len(nearby))
+	for i, d := range nearby {
+		ids[i] = d.DriverID
+	}
+	stats, err := m.drivers.CandidateStats(ctx, ids)
+	if err != nil {
+		logger.Warn("candidate stats lookup failed; ranking by distance only", "err", err)
+	}
+
+	w := m.Weights()
+	now := time.Now()
+	vehicleType, v2 := "", false
+	if trip != nil {
+		vehicleType, v2 = trip.VehicleType, m.scoresV2(*trip)
+	}
+	out := make([]candidate, 0, len(nearby))
+	for _, d := range nearby {
+		st, ok := stats[d.DriverID]
+		if !ok {
+			st = events.DriverStats{Rating: 5}
+		}
+		if trip != nil && (ok && !fits(st, *trip) || !ok && trip.WomenOnly) {
+			continue
+		}
+		s := m.score(d.DistanceKm, radiusKm, st, vehicleType, w, now)
+		if v2 {
+			s = scoreV2(s)
+		}
+		out = append(out, candidate{DriverID: d.DriverID, MatchScore: s})
+	}
+	for i := range out {
+		out[i].Candidates = len(out)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Deprioritized != out[j].Deprioritized {
+			return !out[i].Deprioritized
+		}
+		return out[i].Total > out[j].Total
+	})
+	return out
+}
+
+// score computes one driver's breakdown for a driver distKm from the pickup
+// of a search within radiusKm. Components are in [0,1].
+func (m *Matcher) score(distKm, radiusKm float64, st events.DriverStats, vehicleType string, w events.MatchWeights, now time.Time) events.MatchScore {
+	s := events.MatchScore{
+		DistanceKm: round3(distKm),
+		RadiusKm:   radiusKm,
+		Distance:   clamp01(1 - distKm/radiusKm),
+		Rating:     clamp01((st.Rating - 1) / 4),
+		Acceptance: 1,
+		Vehicle:    1,
+		Idle:       1,
+		Safety:     1,
+		Weights:    w,
+	}
+	if st.AcceptanceRate != nil {
+		s.Acceptance = *st.AcceptanceRate
+	}
+	if vehicleType != "" && !strings.EqualFold(vehicleType, st.VehicleType) {
+		s.Vehicle = 0
+	}
+	if st.LastTripAt != nil {
+		s.Idle = clamp01(float64(now.Sub(*st.LastTripAt)) / float64(idleFull))
+	}
+	if st.SafetyScore != nil {
+		s.Safety = round3(clamp01(*st.SafetyScore / 100))
+	}
+	s.Deprioritized = st.AcceptanceRate != nil && *st.AcceptanceRate < m.cfg.MinAcceptanceRate ||
+		st.CancellationRate != nil && *st.CancellationRate > m.cfg.MaxCancellationRate
+
+	s.Distance, s.Rating, s.Idle = round3(s.Distance), round3(s.Rating), round3(s.Idle)
+	s.Total = weighted(s)
+	return s
+}
+
+// scoresV2 reports whether trip is ranked with the v2 score: the
+// matching.score_v2 flag is on for its rider in the radius city of its
+// pickup.
+func (m *Matcher) scoresV2(trip events.RideRequestedEvent) bool {
+	city, _, _ := m.bounds(trip.Pickup)
+	return m.flags.Enabled(featureflags.MatchingScoreV2, featureflags.Subject{ID: trip.RiderID, City: city})
+}
+
+// scoreV2 rescores s with the v2 algorithm. Distance decays exponentially
+// rather than linearly, so the nearest drivers stand further apart from the
+// rest (a third of the radius away scores 0.37, the edge 0.05), and idle
+// time counts by its square root, so the first minutes of waiting earn the
+// most. The other components and the weights are unchanged.
+func scoreV2(s events.MatchScore) events.MatchScore {
+	s.Distance = round3(math.Exp(-3 * s.DistanceKm / s.RadiusKm))
+	s.Idle = round3(math.Sqrt(s.Idle))
+	s.Total = weighted(s)
+	s.Algorithm = "v2"
+	return s
+}
+
+// weighted is the weighted sum of s's components.
+func weighted(s events.MatchScore) float64 {
+	w := s.Weights
+	return round3(w.Distance*s.Distance + w.Rating*s.Rating + w.Acceptance*s.Acceptance +
+		w.Vehicle*s.Vehicle + w.Idle*s.Idle + w.Safety*s.Safety)
+}
+
+// fits reports whether the driver can take trip: their active vehicle has
+// the seats, accessibility features, child seats and luggage space it asks
+// for, and, if they are winding down, it drops off inside their home area.
+// A women-only trip needs a driver whose profile says female.
+func fits(st events.DriverStats, trip events.RideRequestedEvent) bool {
+	if trip.WomenOnly && st.Gender != events.GenderFemale {
+		return false
+	}
+	if st.Capacity < trip.Seats || st.ChildSeats < trip.ChildSeats || st.LuggageLitres < trip.LuggageLitres {
+		return false
+	}
+	for _, f := range trip.Accessibility {
+		if !slices.Contains(st.Accessibility, f) {
+			return false
+		}
+	}
+	return st.GoHome == nil || haversineKm(st.GoHome.Lat, st.GoHome.Lng, trip.Drop.Lat, trip.Drop.Lng) <= st.GoHome.RadiusKm
+}
+
+func haversineKm(lat1, lng1, lat2, lng2 float64) float64 {
+	const R = 6371.0
+	dLat := (lat2 - lat1) * math.Pi / 180
+	dLng := (lng2 - lng1) * math.Pi / 180
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*
+			math.Sin(dLng/2)*math.Sin(dLng/2)
+	return R * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+func round3(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
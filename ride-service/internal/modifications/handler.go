@@ -0,0 +1,108 @@
+package modifications
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/internal/trips"
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+)
+
+// Handler exposes trip modification endpoints.
+type Handler struct{ svc *Service }
+
+// NewHandler wires a handler to the modifications service.
+func NewHandler(svc *Service) *Handler { return &Handler{svc: svc} }
+
+// Routes returns the participant routes, mounted at /trips/{id}/modifications.
+func (h *Handler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+
+	r.Get("/", h.List)
+	r.Post("/", h.Request)
+	r.Post("/{modID}/approve", h.Approve)
+	r.Post("/{modID}/reject", h.Reject)
+
+	return r
+}
+
+// DestinationRoutes returns the rider's route mounted at
+// /trips/{id}/destination.
+func (h *Handler) DestinationRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+
+	r.With(jwt.RequireRole("rider")).Patch("/", h.ChangeDestination)
+
+	return r
+}
+
+func (h *Handler) Request(w http.ResponseWriter, r *http.Request) {
+	claims := jwt.GetClaims(r.Context())
+
+	var req Request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	m, err := h.svc.Request(r.Context(), chi.URLParam(r, "id"), claims.UserID, req)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusAccepted, m)
+}
+
+func (h *Handler) ChangeDestination(w http.ResponseWriter, r *http.Request) {
+	claims := jwt.GetClaims(r.Context())
+
+	var req DestinationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	m, err := h.svc.ChangeDestination(r.Context(), chi.URLParam(r, "id"), claims.UserID, req)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusAccepted, m)
+}
+
+// Approve changes the trip's route, so like other trip changes it takes the
+// trip version the driver last read in If-Match.
+func (h *Handler) Approve(w http.ResponseWriter, r *http.Request) {
+	version, ok := trips.IfMatch(w, r)
+	if !ok {
+		return
+	}
+	h.decide(w, r, version, true)
+}
+
+func (h *Handler) Reject(w http.ResponseWriter, r *http.Request) {
+	h.decide(w, r, trips.AnyVersion, false)
+}
+
+func (h *Handler) decide(w http.ResponseWriter, r *http.Request, version int, approve bool) {
+	claims := jwt.GetClaims(r.Context())
+	m, err := h.svc.Decide(r.Context(), chi.URLParam(r, "id"), chi.URLParam(r, "modID"), claims.UserID, version, approve)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, m)
+}
+
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	claims := jwt.GetClaims(r.Context())
+	mods, err := h.svc.List(r.Context(), chi.URLParam(r, "id"), claims)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]any{"modifications": mods})
+}
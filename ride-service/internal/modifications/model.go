@@ -0,0 +1,74 @@
+package modifications
+
+import (
+	"time"
+
+	"ride-service/internal/events"
+	"ride-service/pkg/money"
+)
+
+// Modification states.
+const (
+	StatusPending  = "PENDING"
+	StatusApproved = "APPROVED"
+	StatusRejected = "REJECTED"
+	StatusExpired  = "EXPIRED"
+)
+
+// MaxStops caps the extra stops a single request may add.
+const MaxStops = 3
+
+// Modification is a rider's request to change the route of an active trip.
+// Nothing changes on the trip until the driver approves it; a rejected or
+// expired request leaves the original route in place.
+type Modification struct {
+	ID          string          `json:"id"`
+	TripID      string          `json:"trip_id"`
+	RequestedBy string          `json:"requested_by"`
+	Drop        *events.LatLng  `json:"drop,omitempty"` // new destination, nil = unchanged
+	Stops       []events.LatLng `json:"stops"`          // appended to the trip's stops
+	// PreviousDrop is the destination an approved Drop replaced.
+	PreviousDrop *events.LatLng `json:"previous_drop,omitempty"`
+	// FareBefore and FareEstimate are the straight-line fares of the route
+	// without and with the change, as estimated when it was requested.
+	FareBefore   *money.Money `json:"fare_before,omitempty"`
+	FareEstimate *money.Money `json:"fare_estimate,omitempty"`
+	Status       string       `json:"status"`
+	ExpiresAt    time.Time    `json:"expires_at"`
+	DecidedAt    *time.Time   `json:"decided_at,omitempty"`
+	CreatedAt    time.Time    `json:"created_at"`
+}
+
+// Request is the body for POST /trips/:id/modifications.
+type Request struct {
+	Drop  *events.LatLng  `json:"drop,omitempty"`
+	Stops []events.LatLng `json:"stops,omitempty" validate:"maxItems=3"`
+}
+
+// DestinationRequest is the body for PATCH /trips/:id/destination.
+type DestinationRequest struct {
+	DropLat float64 `json:"dropLat" validate:"required,min=-90,max=90"`
+	DropLng float64 `json:"dropLng" validate:"required,min=-180,max=180"`
+}
+
+// Notification is pushed to the trip's WebSocket subscribers whenever a
+// modification is requested or resolved.
+type Notification struct {
+	Type         string        `json:"type"` // modification.requested | .approved | .rejected | .expired
+	Modification *Modification `json:"modification"`
+}
+
+// wsDecide is the driver's answer sent over the trip's WebSocket:
+// {"type":"modification.approve","modification_id":"…","version":7}, or
+// .reject, which needs no version.
+type wsDecide struct {
+	Type           string `json:"type"`
+	ModificationID string `json:"modification_id"`
+	Version        int    `json:"version"` // of the trip, as for If-Match
+}
+
+// wsError answers a WebSocket decision that failed, to the driver only.
+type wsError struct {
+	Type  string `json:"type"` // modification.error
+	Error string `json:"error"`
+}
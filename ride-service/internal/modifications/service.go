@@ -0,0 +1,393 @@
+package modifications
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/internal/events"
+	"ride-service/internal/trips"
+	"ride-service/internal/trips/statemachine"
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/db"
+	"ride-service/pkg/jwt"
+	"ride-service/pkg/logging"
+	"ride-service/pkg/money"
+	"ride-service/pkg/validation"
+)
+
+var logger = logging.For("modifications")
+
+var (
+	ErrTripNotFound   = apierror.NotFound("trip not found")
+	ErrNotRider       = apierror.Forbidden("only the trip's rider can request changes")
+	ErrNotDriver      = apierror.Forbidden("only the assigned driver can decide on changes")
+	ErrNotParticipant = apierror.Forbidden("not a participant in this trip")
+	ErrTripInactive   = apierror.Conflict("trip is not in progress")
+	ErrNotStarted     = apierror.Conflict("the destination can only be changed once the trip has started").WithCode("trip_not_started")
+	ErrPending        = apierror.Conflict("a modification is already awaiting the driver")
+	ErrNotPending     = apierror.Conflict("modification not found, already decided or expired")
+	ErrInvalid        = apierror.Validation("invalid modification")
+)
+
+// Notifier delivers modification updates to the trip's live subscribers
+// (rider and driver apps on /ws/trips/:id).
+type Notifier interface {
+	Notify(tripID string, msg any)
+}
+
+// FareEstimator re-estimates a trip's fare for a route change: the fare of
+// its route as it is, and with the drop moved to drop (if not nil) and
+// stops appended. The trips service implements it.
+type FareEstimator interface {
+	EstimateFare(ctx context.Context, tripID string, drop *events.LatLng, stops []events.LatLng) (before, after money.Money, err error)
+}
+
+// Trips reads and changes trips; trips.TripRepo implements it.
+type Trips interface {
+	GetByID(ctx context.Context, id string) (*trips.Trip, error)
+	Lock(ctx context.Context, tripID string) (*trips.Trip, error)
+	ChangeRoute(ctx context.Context, tripID, driverID string, version int, fn func(t *trips.Trip) (trips.RouteChange, error)) (*trips.Trip, error)
+}
+
+// Service manages driver-approved route changes for active trips.
+type Service struct {
+	db        *pgxpool.Pool
+	trips     Trips
+	notify    Notifier
+	timeout   time.Duration
+	fares     FareEstimator // nil: requests carry no fare estimate
+	onApplied func(ctx context.Context, tripID string)
+}
+
+// NewService creates a modifications service. Requests the driver has not
+// answered within timeout expire and the trip keeps its original route.
+func NewService(db *pgxpool.Pool, t Trips, n Notifier, timeout time.Duration) *Service {
+	return &Service{db: db, trips: t, notify: n, timeout: timeout}
+}
+
+// OnApplied sets the function told when an approved modification changed a
+// trip's route, e.g. to drop cached copies of it. Call it before serving.
+func (s *Service) OnApplied(fn func(ctx context.Context, tripID string)) { s.onApplied = fn }
+
+// EstimateWith sets how requests are priced, so both parties see the fare
+// a change leads to before the driver answers. Call it before serving.
+func (s *Service) EstimateWith(e FareEstimator) { s.fares = e }
+
+// trip returns tripID, reporting a missing one as ErrTripNotFound.
+func (s *Service) trip(ctx context.Context, tripID string) (*trips.Trip, error) {
+	t, err := s.trips.GetByID(ctx, tripID)
+	if errors.Is(err, trips.ErrNotFound) {
+		return nil, ErrTripNotFound
+	}
+	return t, err
+}
+
+func active(status string) bool {
+	return statemachine.Allows(statemachine.Modify, status)
+}
+
+// Request records a pending route change from the trip's rider and asks the
+// driver to approve it.
+func (s *Service) Request(ctx context.Context, tripID, riderID string, req Request) (*Modification, error) {
+	if req.Drop == nil && len(req.Stops) == 0 {
+		return nil, fmt.Errorf("%w: drop or stops is required", ErrInvalid)
+	}
+	if err := validation.Struct(req); err != nil {
+		return nil, err
+	}
+	return s.open(ctx, tripID, riderID, req.Drop, req.Stops, false)
+}
+
+// ChangeDestination asks the driver of a STARTED trip to take the rider to
+// a new drop instead, with the fare re-estimated for it. It is decided and
+// recorded like any other modification.
+func (s *Service) ChangeDestination(ctx context.Context, tripID, riderID string, req DestinationRequest) (*Modification, error) {
+	if err := validation.Struct(req); err != nil {
+		return nil, err
+	}
+	return s.open(ctx, tripID, riderID, &events.LatLng{Lat: req.DropLat, Lng: req.DropLng}, nil, true)
+}
+
+// open records a pending modification of tripID and notifies the driver.
+// With started, the trip must already be STARTED.
+func (s *Service) open(ctx context.Context, tripID, riderID string, drop *events.LatLng, stops []events.LatLng, started bool) (*Modification, error) {
+	t, err := s.trip(ctx, tripID)
+	if err != nil {
+		return nil, err
+	}
+	if t.RiderID != riderID {
+		return nil, ErrNotRider
+	}
+	if !active(t.Status) {
+		return nil, ErrTripInactive
+	}
+	if started && t.Status != statemachine.Started {
+		return nil, ErrNotStarted
+	}
+
+	m := &Modification{
+		ID:          uuid.New().String(),
+		TripID:      tripID,
+		RequestedBy: riderID,
+		Drop:        drop,
+		Stops:       stops,
+		Status:      StatusPending,
+	}
+	if m.Stops == nil {
+		m.Stops = []events.LatLng{}
+	}
+	var currency *string
+	var before, after *int64
+	if s.fares != nil {
+		b, a, err := s.fares.EstimateFare(ctx, tripID, m.Drop, m.Stops)
+		if err != nil {
+			return nil, err
+		}
+		m.FareBefore, m.FareEstimate = &b, &a
+		currency, before, after = &a.Currency, &b.Amount, &a.Amount
+	}
+	var dropLat, dropLng *float64
+	if m.Drop != nil {
+		dropLat, dropLng = &m.Drop.Lat, &m.Drop.Lng
+	}
+	err = s.db.QueryRow(ctx,
+		`INSERT INTO trip_modifications (id,trip_id,requested_by,drop_lat,drop_lng,stops,expires_at,
+		                                 currency,fare_before_minor,fare_estimate_minor)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
+		 RETURNING expires_at, created_at`,
+		m.ID, tripID, riderID, dropLat, dropLng, m.Stops, time.Now().Add(s.timeout), currency, before, after).
+		Scan(&m.ExpiresAt, &m.CreatedAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return nil, ErrPending
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.notify.Notify(tripID, Notification{Type: "modification.requested", Modification: m})
+	logger.Info("modification requested", "trip", tripID, "modification", m.ID)
+	return m, nil
+}
+
+// Decide applies the assigned driver's answer. Approval changes the trip's
+// route through the trip repository, checked against version (the trip's,
+// as the driver last read it) and the trip's state machine, in the same
+// transaction as the modification, with the trip locked so it cannot
+// complete against the old route meanwhile; the destination it replaces is
+// kept on the modification. Rejecting leaves the trip as it is and takes no
+// version.
+func (s *Service) Decide(ctx context.Context, tripID, modID, driverID string, version int, approve bool) (*Modification, error) {
+	next := StatusRejected
+	if approve {
+		next = StatusApproved
+	}
+
+	var m *Modification
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		inTx := db.Within(ctx, tx)
+		if !approve {
+			t, err := s.trips.Lock(inTx, tripID)
+			if err != nil {
+				return err
+			}
+			if t.DriverID == nil || *t.DriverID != driverID {
+				return ErrNotDriver
+			}
+			if !active(t.Status) {
+				return ErrTripInactive
+			}
+			m, err = s.claim(ctx, tx, tripID, modID, next)
+			return err
+		}
+
+		_, err := s.trips.ChangeRoute(inTx, tripID, driverID, version, func(t *trips.Trip) (trips.RouteChange, error) {
+			var err error
+			if m, err = s.claim(ctx, tx, tripID, modID, next); err != nil {
+				return trips.RouteChange{}, err
+			}
+			if m.Drop != nil {
+				m.PreviousDrop = &events.LatLng{Lat: t.DropLat, Lng: t.DropLng}
+				if _, err := tx.Exec(ctx,
+					`UPDATE trip_modifications SET prev_drop_lat=$1, prev_drop_lng=$2 WHERE id=$3`,
+					t.DropLat, t.DropLng, m.ID); err != nil {
+					return trips.RouteChange{}, err
+				}
+			}
+			return trips.RouteChange{Drop: m.Drop, Stops: m.Stops}, nil
+		})
+		return err
+	})
+	switch {
+	case errors.Is(err, trips.ErrNotFound):
+		return nil, ErrTripNotFound
+	case errors.Is(err, statemachine.ErrNotAssignedDriver):
+		return nil, ErrNotDriver
+	case errors.Is(err, trips.ErrStateChanged):
+		return nil, ErrTripInactive
+	case err != nil:
+		return nil, err
+	}
+	if approve && s.onApplied != nil {
+		s.onApplied(ctx, tripID)
+	}
+
+	s.notify.Notify(tripID, Notification{Type: "modification." + strings.ToLower(next), Modification: m})
+	logger.Info("modification decided", "trip", tripID, "modification", m.ID, "status", next)
+	return m, nil
+}
+
+// claim moves the pending modification modID of tripID to status, or
+// reports ErrNotPending.
+func (s *Service) claim(ctx context.Context, tx pgx.Tx, tripID, modID, status string) (*Modification, error) {
+	m, err := scanModification(tx.QueryRow(ctx,
+		`UPDATE trip_modifications SET status=$1, decided_at=NOW()
+		 WHERE id=$2 AND trip_id=$3 AND status=$4 AND expires_at > NOW()
+		 RETURNING `+columns,
+		status, modID, tripID, StatusPending))
+	if isNotFound(err) {
+		return nil, ErrNotPending
+	}
+	return m, err
+}
+
+// List returns the trip's modification history, newest first, to its rider
+// or assigned driver, or to staff looking into a receipt or dispute.
+func (s *Service) List(ctx context.Context, tripID string, claims *jwt.Claims) ([]Modification, error) {
+	t, err := s.trip(ctx, tripID)
+	if err != nil {
+		return nil, err
+	}
+	staff := claims.Role == "admin" || claims.Role == "support"
+	if !staff && t.RiderID != claims.UserID && (t.DriverID == nil || *t.DriverID != claims.UserID) {
+		return nil, ErrNotParticipant
+	}
+
+	rows, err := s.db.Query(ctx,
+		`SELECT `+columns+` FROM trip_modifications WHERE trip_id=$1 ORDER BY created_at DESC`, tripID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Modification{}
+	for rows.Next() {
+		m, err := scanModification(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *m)
+	}
+	return out, rows.Err()
+}
+
+// HandleWS is the hub's handler for the driver's answer on the trip's
+// WebSocket: {"type":"modification.approve","modification_id":"…"} (or
+// .reject) is decided like POST .../approve. Other types are ignored.
+func (s *Service) HandleWS(ctx context.Context, tripID string, claims *jwt.Claims, msg []byte) any {
+	var in wsDecide
+	if err := json.Unmarshal(msg, &in); err != nil ||
+		in.Type != "modification.approve" && in.Type != "modification.reject" {
+		return nil
+	}
+	if claims == nil {
+		return wsError{Type: "modification.error", Error: "unauthorized"}
+	}
+	approve := in.Type == "modification.approve"
+	if approve && in.Version < 1 {
+		return wsError{Type: "modification.error", Error: "version of the trip is required"}
+	}
+	if _, err := s.Decide(ctx, tripID, in.ModificationID, claims.UserID, in.Version, approve); err != nil {
+		var apiErr *apierror.Error
+		if !errors.As(err, &apiErr) {
+			logger.Error("modification decision failed", "trip", tripID, "modification", in.ModificationID, "err", err)
+			err = errors.New("decision not recorded")
+		}
+		return wsError{Type: "modification.error", Error: err.Error()}
+	}
+	return nil // the driver receives the outcome with the broadcast
+}
+
+// StartExpirer expires unanswered requests in the background until ctx is
+// cancelled, telling both parties the original route stands.
+func (s *Service) StartExpirer(ctx context.Context, every time.Duration) {
+	go func() {
+		t := time.NewTicker(every)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				if err := s.expire(ctx); err != nil && ctx.Err() == nil {
+					logger.Error("expire modifications failed", "err", err)
+				}
+			}
+		}
+	}()
+}
+
+func (s *Service) expire(ctx context.Context) error {
+	rows, err := s.db.Query(ctx,
+		`UPDATE trip_modifications SET status=$1, decided_at=NOW()
+		 WHERE status=$2 AND expires_at <= NOW()
+		 RETURNING `+columns,
+		StatusExpired, StatusPending)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		m, err := scanModification(rows)
+		if err != nil {
+			return err
+		}
+		s.notify.Notify(m.TripID, Notification{Type: "modification.expired", Modification: m})
+		logger.Info("modification expired", "trip", m.TripID, "modification", m.ID)
+	}
+	return rows.Err()
+}
+
+// ---- helpers ----
+
+const columns = `id,trip_id,requested_by,drop_lat,drop_lng,stops,status,expires_at,decided_at,created_at,
+		prev_drop_lat,prev_drop_lng,currency,fare_before_minor,fare_estimate_minor`
+
+func scanModification(row pgx.Row) (*Modification, error) {
+	var m Modification
+	var dropLat, dropLng, prevLat, prevLng *float64
+	var currency *string
+	var before, after *int64
+	if err := row.Scan(&m.ID, &m.TripID, &m.RequestedBy, &dropLat, &dropLng, &m.Stops,
+		&m.Status, &m.ExpiresAt, &m.DecidedAt, &m.CreatedAt,
+		&prevLat, &prevLng, &currency, &before, &after); err != nil {
+		return nil, err
+	}
+	if dropLat != nil && dropLng != nil {
+		m.Drop = &events.LatLng{Lat: *dropLat, Lng: *dropLng}
+	}
+	if prevLat != nil && prevLng != nil {
+		m.PreviousDrop = &events.LatLng{Lat: *prevLat, Lng: *prevLng}
+	}
+	if currency != nil && before != nil && after != nil {
+		b, a := money.New(*before, *currency), money.New(*after, *currency)
+		m.FareBefore, m.FareEstimate = &b, &a
+	}
+	return &m, nil
+}
+
+// isNotFound reports a missing row or a malformed id, which cannot match.
+func isNotFound(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.Is(err, pgx.ErrNoRows) || errors.As(err, &pgErr) && pgErr.Code == "22P02"
+}
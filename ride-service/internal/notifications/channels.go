@@ -0,0 +1,179 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"time"
+
+	"ride-service/pkg/config"
+	"ride-service/pkg/verification"
+	pkgwebhook "ride-service/pkg/webhook"
+)
+
+// Channel delivers a message to one address (a registration token, phone
+// number, email address or URL).
+type Channel interface {
+	Send(ctx context.Context, to string, m Message) error
+}
+
+// permanentError marks failures retrying cannot fix, such as a rejected
+// address; the delivery is given up at once.
+type permanentError struct{ error }
+
+func (e permanentError) Unwrap() error { return e.error }
+
+func isPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+// Channels are the configured channels by name. It also delivers
+// verification codes over SMS and email.
+type Channels map[string]Channel
+
+// NewChannels builds the channels cfg has credentials for.
+func NewChannels(cfg config.Notifications) (Channels, error) {
+	ch := Channels{}
+	if cfg.FCMCredentialsFile != "" {
+		f, err := newFCM(cfg.FCMCredentialsFile)
+		if err != nil {
+			return nil, fmt.Errorf("notifications: push: %w", err)
+		}
+		ch[Push] = f
+	}
+	if s := cfg.SMS; s.AccountSID != "" && s.AuthToken != "" && s.From != "" {
+		ch[SMS] = &twilioSMS{cfg: s, client: &http.Client{Timeout: 10 * time.Second}}
+	}
+	if e := cfg.Email; e.SMTPAddr != "" && e.From != "" {
+		ch[Email] = &smtpEmail{cfg: e}
+	}
+	if cfg.WebhookSecret != "" {
+		ch[Webhook] = newWebhook(cfg.WebhookSecret)
+	}
+	return ch, nil
+}
+
+// Send implements verification.Sender: codes for "email" go out by email and
+// for "phone" by SMS, once. Without that channel the code is logged.
+func (c Channels) Send(ctx context.Context, channel, to, message string) error {
+	name := Email
+	if channel == verification.Phone {
+		name = SMS
+	}
+	ch, ok := c[name]
+	if !ok {
+		return verification.LogSender{}.Send(ctx, channel, to, message)
+	}
+	return ch.Send(ctx, to, Message{Event: "verification", Title: "Verification code", Body: message})
+}
+
+// checkResponse turns an HTTP provider response into an error. Client errors
+// other than timeouts and rate limits are permanent.
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode < 300 {
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err := fmt.Errorf("provider returned %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	if resp.StatusCode >= 400 && resp.StatusCode < 500 &&
+		resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests {
+		return permanentError{err}
+	}
+	return err
+}
+
+// twilioSMS sends text messages through Twilio's REST API.
+type twilioSMS struct {
+	cfg    config.NotifySMS
+	client *http.Client
+}
+
+func (t *twilioSMS) Send(ctx context.Context, to string, m Message) error {
+	text := m.Body
+	if m.Title != "" {
+		text = m.Title + ": " + m.Body
+	}
+	form := url.Values{"To": {to}, "From": {t.cfg.From}, "Body": {text}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		"https://api.twilio.com/2010-04-01/Accounts/"+url.PathEscape(t.cfg.AccountSID)+"/Messages.json",
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(t.cfg.AccountSID, t.cfg.AuthToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkResponse(resp)
+}
+
+// smtpEmail sends plain-text email through an SMTP relay.
+type smtpEmail struct{ cfg config.NotifyEmail }
+
+func (e *smtpEmail) Send(_ context.Context, to string, m Message) error {
+	if strings.ContainsAny(to, "\r\n") {
+		return permanentError{errors.New("invalid email address")}
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\nTo: %s\r\nSubject: %s\r\n", e.cfg.From, to, mime.QEncoding.Encode("utf-8", m.Title))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(m.Body + "\r\n")
+
+	var auth smtp.Auth
+	if e.cfg.Username != "" {
+		host, _, _ := net.SplitHostPort(e.cfg.SMTPAddr)
+		auth = smtp.PlainAuth("", e.cfg.Username, e.cfg.Password, host)
+	}
+	return smtp.SendMail(e.cfg.SMTPAddr, auth, e.cfg.From, []string{to}, msg.Bytes())
+}
+
+// webhook POSTs the message as JSON to an account's https URL, signed with
+// the service-wide webhook secret.
+type webhook struct {
+	secret []byte
+	client *http.Client
+}
+
+func newWebhook(secret string) *webhook {
+	return &webhook{secret: []byte(secret), client: pkgwebhook.NewClient(10 * time.Second)}
+}
+
+func (w *webhook) Send(ctx context.Context, to string, m Message) error {
+	if err := pkgwebhook.ValidURL(to); err != nil {
+		return permanentError{err}
+	}
+	body, err := json.Marshal(struct {
+		Message
+		SentAt time.Time `json:"sent_at"`
+	}{m, time.Now().UTC()})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, to, bytes.NewReader(body))
+	if err != nil {
+		return permanentError{err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(pkgwebhook.SignatureHeader, pkgwebhook.Sign(w.secret, body))
+	resp, err := w.client.Do(req)
+	if errors.Is(err, pkgwebhook.ErrNotPublic) {
+		return permanentError{err}
+	} else if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return checkResponse(resp)
+}
@@ -0,0 +1,144 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+)
+
+const fcmScope = "https://www.googleapis.com/auth/firebase.messaging"
+
+// fcm sends push notifications through the Firebase Cloud Messaging HTTP v1
+// API, authenticating as a Google service account.
+type fcm struct {
+	projectID   string
+	clientEmail string
+	tokenURI    string
+	key         *rsa.PrivateKey
+	client      *http.Client
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+func newFCM(credentialsFile string) (*fcm, error) {
+	data, err := os.ReadFile(credentialsFile)
+	if err != nil {
+		return nil, err
+	}
+	var sa struct {
+		ProjectID   string `json:"project_id"`
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(data, &sa); err != nil {
+		return nil, fmt.Errorf("service account file: %w", err)
+	}
+	if sa.ProjectID == "" || sa.ClientEmail == "" || sa.PrivateKey == "" {
+		return nil, errors.New("service account file lacks project_id, client_email or private_key")
+	}
+	key, err := gojwt.ParseRSAPrivateKeyFromPEM([]byte(sa.PrivateKey))
+	if err != nil {
+		return nil, err
+	}
+	if sa.TokenURI == "" {
+		sa.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	return &fcm{projectID: sa.ProjectID, clientEmail: sa.ClientEmail, tokenURI: sa.TokenURI, key: key,
+		client: &http.Client{Timeout: 10 * time.Second}}, nil
+}
+
+func (f *fcm) Send(ctx context.Context, to string, m Message) error {
+	access, err := f.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+	data := map[string]string{"event": m.Event}
+	if m.TripID != "" {
+		data["trip_id"] = m.TripID
+	}
+	for k, v := range m.Data {
+		data[k] = v
+	}
+	body, err := json.Marshal(map[string]any{"message": map[string]any{
+		"token":        to,
+		"notification": map[string]string{"title": m.Title, "body": m.Body},
+		"data":         data,
+	}})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		"https://fcm.googleapis.com/v1/projects/"+url.PathEscape(f.projectID)+"/messages:send", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+access)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		f.mu.Lock()
+		f.token = "" // fetch a new access token on the retry
+		f.mu.Unlock()
+		return fmt.Errorf("fcm rejected the access token")
+	}
+	return checkResponse(resp)
+}
+
+// accessToken returns a cached OAuth access token, exchanging a signed
+// service-account assertion for a new one shortly before it expires.
+func (f *fcm) accessToken(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.token != "" && time.Until(f.expiry) > time.Minute {
+		return f.token, nil
+	}
+	now := time.Now().Unix()
+	// MapClaims keeps iat/exp whole seconds whatever jwt.TimePrecision is.
+	assertion, err := gojwt.NewWithClaims(gojwt.SigningMethodRS256, gojwt.MapClaims{
+		"iss": f.clientEmail, "scope": fcmScope, "aud": f.tokenURI, "iat": now, "exp": now + 3600,
+	}).SignedString(f.key)
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"}, "assertion": {assertion}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.tokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if err := checkResponse(resp); err != nil {
+		return "", fmt.Errorf("fcm token exchange: %w", err)
+	}
+	var tok struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return "", err
+	}
+	f.token, f.expiry = tok.AccessToken, time.Now().Add(time.Duration(tok.ExpiresIn)*time.Second)
+	return f.token, nil
+}
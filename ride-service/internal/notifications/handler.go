@@ -0,0 +1,49 @@
+package notifications
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+)
+
+// Handler exposes the caller's notification preferences.
+type Handler struct{ svc *Service }
+
+// NewHandler wires a handler to the notification service.
+func NewHandler(svc *Service) *Handler { return &Handler{svc: svc} }
+
+// Routes returns the routes mounted under /notifications.
+func (h *Handler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+	r.Get("/preferences", h.GetPreferences)
+	r.Put("/preferences", h.SetPreferences)
+	return r
+}
+
+func (h *Handler) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	prefs, err := h.svc.Preferences(r.Context(), jwt.GetClaims(r.Context()).UserID)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]any{"preferences": prefs})
+}
+
+func (h *Handler) SetPreferences(w http.ResponseWriter, r *http.Request) {
+	var req PreferencesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	prefs, err := h.svc.SetPreferences(r.Context(), jwt.GetClaims(r.Context()).UserID, req.Preferences)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]any{"preferences": prefs})
+}
@@ -0,0 +1,66 @@
+package notifications
+
+import "time"
+
+// Channels.
+const (
+	Push    = "push"
+	SMS     = "sms"
+	Email   = "email"
+	Webhook = "webhook"
+)
+
+// Events an account can be notified about.
+const (
+	EventSearching    = "trip.searching"  // rider: the trip was requested
+	EventRematching   = "trip.rematching" // rider: the driver dropped out, looking again
+	EventOffer        = "trip.offer"      // driver: a trip is offered to them
+	EventMatched      = "trip.matched"    // rider: a driver was matched
+	EventCompleted    = "trip.completed"  // rider and driver: receipt
+	EventSplitInvite  = "split.invited"   // rider: asked to split a co-rider's fare
+	EventNoShow       = "trip.no_show"    // rider: the driver gave up waiting, with the fee
+	EventNoDriver     = "trip.no_driver"  // rider: no driver was found and the trip was cancelled
+	EventCancelled    = "trip.cancelled"  // driver: the rider cancelled the trip they were heading to
+	EventFareAdjusted = "fare.adjusted"   // rider and driver: a disputed fare changed, with the revised receipt
+	EventCheckUpdated = "driver.check"    // driver: their background check started, passed or failed
+	EventDeviation    = "trip.deviation"  // rider: the driver left the planned route
+	// EventEmergency goes to a rider's emergency contacts, who have no
+	// account, so no preference can turn it off and it is not in Events.
+	EventEmergency = "trip.emergency"
+)
+
+// Events lists every event, for validating preferences.
+var Events = []string{EventSearching, EventRematching, EventOffer, EventMatched, EventCompleted, EventSplitInvite, EventNoShow,
+	EventNoDriver, EventCancelled, EventFareAdjusted, EventCheckUpdated, EventDeviation}
+
+// Preference is an account's setting for one channel. Channels without a
+// stored preference use DefaultEnabled.
+type Preference struct {
+	Channel string `json:"channel" validate:"required"` // push | sms | email | webhook
+	Enabled bool   `json:"enabled"`
+	// Address is the FCM registration token (push) or the https URL
+	// (webhook). SMS and email go to the account's phone and email.
+	Address string `json:"address,omitempty" validate:"maxLength=2000"`
+	// Events limits the channel to these events; empty means all.
+	Events    []string  `json:"events,omitempty" validate:"maxItems=10"`
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+}
+
+// DefaultEnabled says whether a channel is on before the account sets a
+// preference. Push also needs a registration token, webhooks a URL.
+var DefaultEnabled = map[string]bool{Push: true, SMS: false, Email: true, Webhook: false}
+
+// PreferencesRequest is the body for PUT /notifications/preferences. Only the
+// listed channels change.
+type PreferencesRequest struct {
+	Preferences []Preference `json:"preferences" validate:"required,maxItems=4"`
+}
+
+// Message is one notification, rendered for every channel.
+type Message struct {
+	Event  string            `json:"event"`
+	Title  string            `json:"title"`
+	Body   string            `json:"body"`
+	TripID string            `json:"trip_id,omitempty"`
+	Data   map[string]string `json:"data,omitempty"`
+}
@@ -0,0 +1,524 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/internal/backgroundcheck"
+	"ride-service/internal/drivers"
+	"ride-service/internal/emergency"
+	"ride-service/internal/events"
+	"ride-service/internal/invoices"
+	"ride-service/internal/payments"
+	"ride-service/internal/routemonitor"
+	"ride-service/internal/trips"
+	"ride-service/internal/users"
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/config"
+	"ride-service/pkg/eventbus"
+	"ride-service/pkg/logging"
+	"ride-service/pkg/money"
+	pkgwebhook "ride-service/pkg/webhook"
+)
+
+var logger = logging.For("notifications")
+
+// channelOrder is the order preferences are listed in.
+var channelOrder = []string{Push, SMS, Email, Webhook}
+
+// sendTimeout bounds a single delivery attempt.
+const sendTimeout = 30 * time.Second
+
+var ErrInvalid = apierror.Validation("invalid preference")
+
+// RiderLookup and DriverLookup find the email and phone SMS and email go to.
+type RiderLookup interface {
+	GetByID(ctx context.Context, id string) (*users.User, error)
+}
+
+type DriverLookup interface {
+	GetByID(ctx context.Context, id string) (*drivers.Driver, error)
+}
+
+// TripLookup finds the rider of an assigned trip.
+type TripLookup interface {
+	GetByID(ctx context.Context, id string) (*trips.Trip, error)
+}
+
+// InvoiceIssuer issues the tax invoice a trip's receipt is built from, and
+// revises it when the fare is adjusted.
+type InvoiceIssuer interface {
+	Issue(ctx context.Context, tripID string) (*invoices.Invoice, error)
+	Revise(ctx context.Context, tripID string) (*invoices.Invoice, error)
+}
+
+// FareSplitter settles what each rider of a trip pays, for split receipts.
+type FareSplitter interface {
+	Settle(ctx context.Context, tripID string) ([]payments.Charge, error)
+}
+
+// Service stores notification preferences and delivers trip notifications.
+type Service struct {
+	db       *pgxpool.Pool
+	channels Channels
+	cfg      config.Notifications
+	riders   RiderLookup
+	drivers  DriverLookup
+	trips    TripLookup
+	invoices InvoiceIssuer
+	splits   FareSplitter
+
+	wg       sync.WaitGroup
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewService creates a notification service delivering over channels.
+func NewService(db *pgxpool.Pool, channels Channels, cfg config.Notifications, riders RiderLookup, d DriverLookup, t TripLookup, inv InvoiceIssuer, splits FareSplitter) *Service {
+	return &Service{db: db, channels: channels, cfg: cfg, riders: riders, drivers: d, trips: t, invoices: inv, splits: splits, stop: make(chan struct{})}
+}
+
+// Preferences returns accountID's setting for every channel, filling in
+// DefaultEnabled for channels it has not set.
+func (s *Service) Preferences(ctx context.Context, accountID string) ([]Preference, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT channel,enabled,address,events,updated_at FROM notification_preferences WHERE user_id=$1`, accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	stored := map[string]Preference{}
+	for rows.Next() {
+		var p Preference
+		if err := rows.Scan(&p.Channel, &p.Enabled, &p.Address, &p.Events, &p.UpdatedAt); err != nil {
+			return nil, err
+		}
+		stored[p.Channel] = p
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	out := make([]Preference, 0, len(channelOrder))
+	for _, name := range channelOrder {
+		p, ok := stored[name]
+		if !ok {
+			p = Preference{Channel: name, Enabled: DefaultEnabled[name]}
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// SetPreferences replaces accountID's settings for the listed channels and
+// returns the settings for all of them.
+func (s *Service) SetPreferences(ctx context.Context, accountID string, prefs []Preference) ([]Preference, error) {
+	seen := map[string]bool{}
+	for i := range prefs {
+		p := &prefs[i]
+		p.Channel = strings.ToLower(strings.TrimSpace(p.Channel))
+		p.Address = strings.TrimSpace(p.Address)
+		if !slices.Contains(channelOrder, p.Channel) {
+			return nil, fmt.Errorf("%w: unknown channel %q", ErrInvalid, p.Channel)
+		}
+		if seen[p.Channel] {
+			return nil, fmt.Errorf("%w: channel %q listed twice", ErrInvalid, p.Channel)
+		}
+		seen[p.Channel] = true
+		for _, ev := range p.Events {
+			if !slices.Contains(Events, ev) {
+				return nil, fmt.Errorf("%w: unknown event %q", ErrInvalid, ev)
+			}
+		}
+		switch p.Channel {
+		case SMS, Email:
+			if p.Address != "" {
+				return nil, fmt.Errorf("%w: %s goes to the account's own %s; address must be empty",
+					ErrInvalid, p.Channel, map[string]string{SMS: "phone", Email: "email"}[p.Channel])
+			}
+		case Webhook:
+			if p.Address != "" {
+				if err := pkgwebhook.ValidURL(p.Address); err != nil {
+					return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+				}
+			} else if p.Enabled {
+				return nil, fmt.Errorf("%w: webhook needs an address", ErrInvalid)
+			}
+		}
+		if p.Events == nil {
+			p.Events = []string{}
+		}
+	}
+	for _, p := range prefs {
+		if _, err := s.db.Exec(ctx,
+			`INSERT INTO notification_preferences (user_id,channel,enabled,address,events) VALUES ($1,$2,$3,$4,$5)
+			 ON CONFLICT (user_id,channel) DO UPDATE
+			 SET enabled=EXCLUDED.enabled, address=EXCLUDED.address, events=EXCLUDED.events, updated_at=NOW()`,
+			accountID, p.Channel, p.Enabled, p.Address, p.Events); err != nil {
+			return nil, err
+		}
+	}
+	return s.Preferences(ctx, accountID)
+}
+
+// Start consumes the trip lifecycle topics. Delivery is best effort: handlers
+// never fail, so a notification outage cannot dead-letter (and on replay,
+// re-run) the matching events.
+func (s *Service) Start(ctx context.Context, bus eventbus.Bus) {
+	bus.Subscribe(ctx, eventbus.TopicRideRequested, "notifications-ride-requested", func(ctx context.Context, data []byte) error {
+		var ev events.RideRequestedEvent
+		if !decode(data, &ev) || ev.Retry > 0 {
+			return nil // the rider already knows we're looking
+		}
+		m := Message{Event: EventSearching, Title: "Finding your driver",
+			Body: "We're looking for a driver near your pickup.", TripID: ev.TripID}
+		if len(ev.ExcludeDrivers) > 0 {
+			m.Event, m.Title = EventRematching, "Finding another driver"
+			m.Body = "Your driver couldn't make it, so we're finding you another."
+		}
+		s.notifyRider(ctx, ev.RiderID, m)
+		return nil
+	})
+
+	bus.Subscribe(ctx, eventbus.TopicTripCancelled, "notifications-trip-cancelled", func(ctx context.Context, data []byte) error {
+		var ev events.TripCancelledEvent
+		if !decode(data, &ev) {
+			return nil
+		}
+		switch {
+		case ev.Reason == events.CancelNoDriver:
+			s.notifyRider(ctx, ev.RiderID, Message{Event: EventNoDriver, Title: "No driver found",
+				Body: "We couldn't find a driver for your trip, so it was cancelled. Please try again.", TripID: ev.TripID})
+		case ev.Reason == events.CancelByRider && ev.DriverID != "":
+			s.notifyDriver(ctx, ev.DriverID, Message{Event: EventCancelled, Title: "Trip cancelled",
+				Body: "The rider cancelled the trip. You're free for the next one.", TripID: ev.TripID})
+		}
+		return nil
+	})
+
+	bus.Subscribe(ctx, eventbus.TopicDriverAssigned, "notifications-driver-assigned", func(ctx context.Context, data []byte) error {
+		var ev events.DriverAssignedEvent
+		if !decode(data, &ev) {
+			return nil
+		}
+		s.notifyDriver(ctx, ev.DriverID, Message{Event: EventOffer, Title: "New trip",
+			Body: "A rider is waiting for you. Open the app to see the pickup.", TripID: ev.TripID})
+
+		t, err := s.trips.GetByID(ctx, ev.TripID)
+		if err != nil {
+			logger.Warn("trip lookup failed", "trip", ev.TripID, "err", err)
+			return nil
+		}
+		m := Message{Event: EventMatched, Title: "Driver on the way", Body: "Your driver is on the way.", TripID: ev.TripID}
+		if v := ev.Vehicle; v != nil {
+			car := strings.TrimSpace(v.Color + " " + v.Model)
+			if car == "" {
+				car = v.Type
+			}
+			m.Body = fmt.Sprintf("Your driver is on the way in a %s (%s).", car, v.Plate)
+			m.Data = map[string]string{"plate": v.Plate}
+		}
+		s.notifyRider(ctx, t.RiderID, m)
+		return nil
+	})
+
+	bus.Subscribe(ctx, eventbus.TopicTripCompleted, "notifications-trip-completed", func(ctx context.Context, data []byte) error {
+		var ev events.TripCompletedEvent
+		if !decode(data, &ev) {
+			return nil
+		}
+		amount := ev.FareAmount()
+		fare := amount.Format("")
+		mins := (ev.DurationSeconds + 59) / 60
+		receipt := map[string]string{"fare": amount.Decimal(), "currency": amount.Currency, "fare_minor": strconv.FormatInt(amount.Amount, 10)}
+		for _, l := range ev.Surcharges {
+			receipt["surcharge."+l.Name] = l.Amount.Decimal()
+		}
+		// Destination changes are listed at /trips/:id/modifications.
+		if ev.DestinationChanges > 0 {
+			receipt["destination_changes"] = strconv.Itoa(ev.DestinationChanges)
+		}
+		body := fmt.Sprintf("Thanks for riding. Fare %s for %d min.", fare, mins)
+		// Issuing is idempotent, so it does not matter whether the invoices
+		// consumer got here first. Without an invoice the receipt still goes
+		// out, just without its tax lines.
+		if inv, err := s.invoices.Issue(ctx, ev.TripID); err != nil {
+			logger.Warn("receipt without invoice", "trip", ev.TripID, "err", err)
+		} else {
+			receipt["invoice"] = inv.Number
+			receipt["net"] = inv.Net.Decimal()
+			var tax int64
+			for _, l := range inv.Taxes {
+				receipt["tax."+l.Name] = l.Amount.Decimal()
+				tax += l.Amount.Amount
+			}
+			if tax > 0 {
+				body = fmt.Sprintf("Thanks for riding. Fare %s (incl. %s tax) for %d min. Invoice %s.",
+					fare, money.New(tax, amount.Currency).Format(""), mins, inv.Number)
+			}
+		}
+		// A split fare gets every rider a receipt with their own share;
+		// settling is idempotent like issuing.
+		charges, err := s.splits.Settle(ctx, ev.TripID)
+		if err != nil {
+			logger.Warn("receipt without split", "trip", ev.TripID, "err", err)
+		}
+		if len(charges) > 1 {
+			for _, c := range charges {
+				data := maps.Clone(receipt)
+				data["share"], data["share_minor"] = c.Amount.Decimal(), strconv.FormatInt(c.Amount.Amount, 10)
+				data["split_ways"] = strconv.Itoa(c.SplitWays)
+				s.notifyRider(ctx, c.RiderID, Message{Event: EventCompleted, Title: "Your trip receipt",
+					Body:   fmt.Sprintf("%s Split %d ways: your share is %s.", body, c.SplitWays, c.Amount.Format("")),
+					TripID: ev.TripID, Data: data})
+			}
+		} else {
+			s.notifyRider(ctx, ev.RiderID, Message{Event: EventCompleted, Title: "Your trip receipt",
+				Body: body, TripID: ev.TripID, Data: receipt})
+		}
+		s.notifyDriver(ctx, ev.DriverID, Message{Event: EventCompleted, Title: "Trip completed",
+			Body: fmt.Sprintf("Trip finished: fare %s for %d min.", fare, mins), TripID: ev.TripID, Data: receipt})
+		return nil
+	})
+
+	bus.Subscribe(ctx, eventbus.TopicTripNoShow, "notifications-trip-no-show", func(ctx context.Context, data []byte) error {
+		var ev events.TripNoShowEvent
+		if decode(data, &ev) {
+			s.noShow(ctx, ev)
+		}
+		return nil
+	})
+
+	bus.Subscribe(ctx, eventbus.TopicFareAdjusted, "notifications-fare-adjusted", func(ctx context.Context, data []byte) error {
+		var ev events.FareAdjustedEvent
+		if decode(data, &ev) {
+			s.fareAdjusted(ctx, ev)
+		}
+		return nil
+	})
+}
+
+// fareAdjusted sends the rider the revised receipt of a disputed trip, and
+// tells the driver what the trip now earns.
+func (s *Service) fareAdjusted(ctx context.Context, ev events.FareAdjustedEvent) {
+	from, to := ev.OldFare(), ev.NewFare()
+	receipt := map[string]string{"fare": to.Decimal(), "currency": to.Currency, "fare_minor": strconv.FormatInt(to.Amount, 10),
+		"previous_fare": from.Decimal()}
+	// Revising is idempotent, so it does not matter whether the invoices
+	// consumer got here first.
+	if inv, err := s.invoices.Revise(ctx, ev.TripID); err != nil {
+		logger.Warn("revised receipt without invoice", "trip", ev.TripID, "err", err)
+	} else {
+		receipt["invoice"] = inv.Number
+		receipt["net"] = inv.Net.Decimal()
+		for _, l := range inv.Taxes {
+			receipt["tax."+l.Name] = l.Amount.Decimal()
+		}
+	}
+	body := fmt.Sprintf("We reviewed your fare dispute: the fare is now %s instead of %s.", to.Format(""), from.Format(""))
+	if diff := from.Amount - to.Amount; diff > 0 {
+		body += fmt.Sprintf(" %s is on its way back to you.", money.New(diff, to.Currency).Format(""))
+	} else {
+		body += fmt.Sprintf(" The remaining %s will be charged.", money.New(-diff, to.Currency).Format(""))
+	}
+	s.notifyRider(ctx, ev.RiderID, Message{Event: EventFareAdjusted, Title: "Your fare was adjusted",
+		Body: body, TripID: ev.TripID, Data: receipt})
+	s.notifyDriver(ctx, ev.DriverID, Message{Event: EventFareAdjusted, Title: "Trip fare adjusted",
+		Body:   fmt.Sprintf("After a rider dispute the fare of this trip is now %s instead of %s.", to.Format(""), from.Format("")),
+		TripID: ev.TripID, Data: receipt})
+}
+
+// noShow tells the rider their driver gave up waiting, and what it costs.
+func (s *Service) noShow(ctx context.Context, ev events.TripNoShowEvent) {
+	m := Message{Event: EventNoShow, Title: "You missed your ride",
+		Body: "Your driver waited at the pickup but couldn't find you, so the trip was cancelled.", TripID: ev.TripID}
+	if fee := ev.Fee(); fee.Amount > 0 {
+		m.Body = fmt.Sprintf("Your driver waited at the pickup but couldn't find you, so the trip was cancelled. A no-show fee of %s applies.", fee.Format(""))
+		m.Data = map[string]string{"fee": fee.Decimal(), "currency": fee.Currency, "fee_minor": strconv.FormatInt(fee.Amount, 10)}
+	}
+	s.notifyRider(ctx, ev.RiderID, m)
+}
+
+// SplitInvited tells a rider they were invited to split a trip's fare; it
+// is the payments.InviteFunc.
+func (s *Service) SplitInvited(ctx context.Context, riderID, tripID, requester string) {
+	s.notifyRider(ctx, riderID, Message{Event: EventSplitInvite, Title: "Split a fare?",
+		Body: fmt.Sprintf("%s invited you to split the fare of their trip.", requester), TripID: tripID})
+}
+
+// BackgroundCheckChanged tells a driver their background check's outcome; it
+// is a backgroundcheck.Listener.
+func (s *Service) BackgroundCheckChanged(ctx context.Context, driverID, status string) {
+	m := Message{Event: EventCheckUpdated, Data: map[string]string{"status": status}}
+	switch status {
+	case backgroundcheck.Pending:
+		m.Title, m.Body = "Background check started", "Your background check is under way. We'll let you know when it's done."
+	case backgroundcheck.Passed:
+		m.Title, m.Body = "Background check passed", "Your background check passed. You can go online and take trips."
+	case backgroundcheck.Failed:
+		m.Title, m.Body = "Background check not passed", "Your background check did not pass, so you cannot take trips. Contact support for details."
+	default:
+		return
+	}
+	s.notifyDriver(ctx, driverID, m)
+}
+
+// RouteDeviated tells a rider their driver has left the planned route; it is
+// a routemonitor.Listener.
+func (s *Service) RouteDeviated(ctx context.Context, d routemonitor.Deviation) {
+	s.notifyRider(ctx, d.RiderID, Message{Event: EventDeviation, Title: "Your trip has left its route", TripID: d.TripID,
+		Body: fmt.Sprintf("Your driver is %.1f km off the planned route. If you feel unsafe, use SOS in the app.", d.MaxKm),
+		Data: map[string]string{"deviation_id": d.ID}})
+}
+
+// EmergencyAlert tells a rider's emergency contact, by SMS and email,
+// that the rider may need help and how to follow their trip; it is an
+// emergency.NotifyFunc. Preferences do not apply: the contact has no account.
+func (s *Service) EmergencyAlert(_ context.Context, c emergency.Contact, n emergency.Notice) {
+	why := "sent an SOS"
+	if n.Reason == emergency.ReasonRouteDeviation {
+		why = "is on a trip that has left its planned route"
+	}
+	m := Message{Event: EventEmergency, Title: n.RiderName + " may need help", TripID: n.TripID,
+		Body: fmt.Sprintf("%s %s. Follow the trip live until %s: %s", n.RiderName, why,
+			n.ExpiresAt.UTC().Format("15:04 MST"), n.ShareURL),
+		Data: map[string]string{"reason": n.Reason, "share_url": n.ShareURL}}
+	for name, to := range map[string]string{SMS: c.Phone, Email: c.Email} {
+		ch, ok := s.channels[name]
+		if !ok || to == "" {
+			continue
+		}
+		s.wg.Add(1)
+		go s.deliver(name, ch, "contact:"+c.ID, to, m)
+	}
+}
+
+func decode(data []byte, into events.Event) bool {
+	env, err := events.Unwrap(data, into)
+	if err != nil {
+		if env != nil {
+			logger.Warn("skipping event", "event_id", env.EventID, "err", err)
+		} else {
+			logger.Warn("skipping undecodable event", "err", err)
+		}
+		return false
+	}
+	return true
+}
+
+func (s *Service) notifyRider(ctx context.Context, riderID string, m Message) {
+	u, err := s.riders.GetByID(ctx, riderID)
+	if err != nil {
+		logger.Warn("rider lookup failed", "rider", riderID, "err", err)
+		return
+	}
+	s.notify(ctx, riderID, u.Email, u.Phone, m)
+}
+
+func (s *Service) notifyDriver(ctx context.Context, driverID string, m Message) {
+	d, err := s.drivers.GetByID(ctx, driverID)
+	if err != nil {
+		logger.Warn("driver lookup failed", "driver", driverID, "err", err)
+		return
+	}
+	s.notify(ctx, driverID, d.Email, d.Phone, m)
+}
+
+// notify starts a delivery of m on every channel accountID has on for m.Event
+// and that the server is configured for.
+func (s *Service) notify(ctx context.Context, accountID, email, phone string, m Message) {
+	prefs, err := s.Preferences(ctx, accountID)
+	if err != nil {
+		logger.Error("preference lookup failed", "account", accountID, "err", err)
+		return
+	}
+	for _, p := range prefs {
+		if !p.Enabled || (len(p.Events) > 0 && !slices.Contains(p.Events, m.Event)) {
+			continue
+		}
+		ch, ok := s.channels[p.Channel]
+		if !ok {
+			continue
+		}
+		to := p.Address
+		switch p.Channel {
+		case SMS:
+			to = phone
+		case Email:
+			to = email
+		}
+		if to == "" {
+			continue
+		}
+		s.wg.Add(1)
+		go s.deliver(p.Channel, ch, accountID, to, m)
+	}
+}
+
+// deliver sends m, retrying failures with exponential backoff up to the
+// channel's attempt limit.
+func (s *Service) deliver(name string, ch Channel, accountID, to string, m Message) {
+	defer s.wg.Done()
+	retry := s.retry(name)
+	delay := retry.Backoff
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), sendTimeout)
+		err := ch.Send(ctx, to, m)
+		cancel()
+		if err == nil {
+			logger.Debug("notification sent", "channel", name, "account", accountID, "event", m.Event, "trip", m.TripID)
+			return
+		}
+		if isPermanent(err) || attempt >= retry.MaxAttempts {
+			logger.Warn("notification dropped", "channel", name, "account", accountID, "event", m.Event,
+				"trip", m.TripID, "attempts", attempt, "err", err)
+			return
+		}
+		select {
+		case <-time.After(delay):
+		case <-s.stop:
+			logger.Warn("notification dropped at shutdown", "channel", name, "account", accountID, "event", m.Event, "err", err)
+			return
+		}
+		delay *= 2
+	}
+}
+
+// retry returns the retry settings for a channel: the per-channel override,
+// with unset fields taken from the defaults.
+func (s *Service) retry(name string) config.NotifyRetry {
+	r := s.cfg.Retry
+	if o, ok := s.cfg.Channels[name]; ok {
+		if o.MaxAttempts > 0 {
+			r.MaxAttempts = o.MaxAttempts
+		}
+		if o.Backoff > 0 {
+			r.Backoff = o.Backoff
+		}
+	}
+	return r
+}
+
+// Wait stops pending retries and waits for in-flight sends, or for ctx to
+// expire. Call it after the Kafka consumers have stopped.
+func (s *Service) Wait(ctx context.Context) error {
+	s.stopOnce.Do(func() { close(s.stop) })
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("notifications: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,37 @@
+package openapi
+
+import (
+	"net/http"
+
+	"github.com/getkin/kin-openapi/openapi3"
+
+	"ride-service/pkg/apierror"
+)
+
+// swaggerUI loads Swagger UI from a CDN and points it at /openapi.json.
+const swaggerUI = `<!doctype html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>ride-service API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});</script>
+</body>
+</html>`
+
+// JSON serves doc, for GET /openapi.json.
+func JSON(doc *openapi3.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		apierror.WriteJSON(w, http.StatusOK, doc)
+	}
+}
+
+// UI serves Swagger UI, for GET /docs.
+func UI(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(swaggerUI))
+}
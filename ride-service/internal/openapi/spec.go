@@ -0,0 +1,404 @@
+// Package openapi builds the OpenAPI 3 description of the public HTTP API
+// from the request/response structs the handlers already use, serves it with
+// Swagger UI, and validates incoming requests against it.
+//
+// Field constraints are the `validate:"..."` struct tags that
+// validation.Struct enforces in the services; here they become schema
+// constraints (formats as patterns), so HTTP requests are rejected with the
+// same rules before reaching a handler.
+package openapi
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3gen"
+
+	"ride-service/internal/backgroundcheck"
+	"ride-service/internal/blocks"
+	"ride-service/internal/chat"
+	"ride-service/internal/contact"
+	"ride-service/internal/disputes"
+	"ride-service/internal/documents"
+	"ride-service/internal/drivers"
+	"ride-service/internal/emergency"
+	"ride-service/internal/favorites"
+	"ride-service/internal/invoices"
+	"ride-service/internal/lostfound"
+	"ride-service/internal/matching"
+	"ride-service/internal/modifications"
+	"ride-service/internal/notifications"
+	"ride-service/internal/payments"
+	"ride-service/internal/privacy"
+	"ride-service/internal/quotes"
+	"ride-service/internal/recordings"
+	"ride-service/internal/sessions"
+	"ride-service/internal/sharing"
+	"ride-service/internal/status"
+	"ride-service/internal/support"
+	"ride-service/internal/terms"
+	"ride-service/internal/tips"
+	"ride-service/internal/trips"
+	"ride-service/internal/twofactor"
+	"ride-service/internal/users"
+	"ride-service/internal/wallet"
+	"ride-service/pkg/validation"
+)
+
+// route describes one operation. body and response are zero values of the
+// Go types the handler decodes and encodes; nil means none / free-form.
+type route struct {
+	method, path, tag, summary string
+	auth                       bool
+	ifMatch                    bool // requires the resource version in If-Match
+	query                      []*openapi3.Parameter
+	body                       any
+	optionalBody               bool
+	bodyType                   string // set for non-JSON bodies
+	status                     int
+	response                   any
+}
+
+var routes = []route{
+	// Status
+	{method: "GET", path: "/status", tag: "status", summary: "Public operational status per city", status: 200, response: status.Report{}},
+
+	// Terms
+	{method: "GET", path: "/terms", tag: "terms", summary: "Terms of service and privacy policy versions in force and, signed in, the caller's acceptances", status: 200, response: terms.Status{}},
+	{method: "POST", path: "/terms/accept", tag: "terms", summary: "Accept the versions in force; needed before changing trips once they change", auth: true, body: terms.AcceptRequest{}, status: 200, response: terms.Status{}},
+
+	// Users
+	{method: "POST", path: "/users/register", tag: "users", summary: "Register a rider", body: users.RegisterRequest{}, status: 201, response: users.AuthResponse{}},
+	{method: "POST", path: "/users/login", tag: "users", summary: "Rider login", body: users.LoginRequest{}, status: 200, response: users.AuthResponse{}},
+	{method: "GET", path: "/users/{id}", tag: "users", summary: "Get rider profile", auth: true, status: 200, response: users.User{}},
+	{method: "PATCH", path: "/users/{id}", tag: "users", summary: "Update rider profile", auth: true, body: users.UpdateProfileRequest{}, status: 200, response: users.ProfileResponse{}},
+	{method: "POST", path: "/users/{id}/verify", tag: "users", summary: "Confirm an email or phone change", auth: true, body: users.VerifyRequest{}, status: 200, response: users.User{}},
+	{method: "DELETE", path: "/users/{id}", tag: "users", summary: "Deactivate a rider account", auth: true, status: 200},
+	{method: "GET", path: "/users/{id}/export", tag: "users", summary: "Download everything kept about a rider as JSON", auth: true, status: 200, response: privacy.Export{}},
+	{method: "POST", path: "/users/{id}/erasure", tag: "users", summary: "Request erasure of a rider's personal data after the grace period", auth: true, status: 202, response: privacy.Erasure{}},
+	{method: "GET", path: "/users/{id}/erasure", tag: "users", summary: "Get a rider's erasure request", auth: true, status: 200, response: privacy.Erasure{}},
+	{method: "DELETE", path: "/users/{id}/erasure", tag: "users", summary: "Cancel a pending erasure request", auth: true, status: 200},
+	{method: "GET", path: "/two-factor", tag: "auth", summary: "Whether the caller (driver or staff) has two-factor authentication", auth: true, status: 200, response: twofactor.Status{}},
+	{method: "POST", path: "/two-factor", tag: "auth", summary: "Start two-factor enrollment: a TOTP secret and otpauth:// URI", auth: true, status: 201, response: twofactor.Enrollment{}},
+	{method: "POST", path: "/two-factor/confirm", tag: "auth", summary: "Enable two-factor authentication with a first code; returns backup codes", auth: true, body: twofactor.CodeRequest{}, status: 200, response: twofactor.BackupCodes{}},
+	{method: "POST", path: "/two-factor/disable", tag: "auth", summary: "Turn two-factor authentication off with a code", auth: true, body: twofactor.CodeRequest{}, status: 200},
+	{method: "POST", path: "/two-factor/backup-codes", tag: "auth", summary: "Replace the backup codes", auth: true, body: twofactor.CodeRequest{}, status: 200, response: twofactor.BackupCodes{}},
+	{method: "GET", path: "/users/{id}/sessions", tag: "users", summary: "Signed-in devices: user agent, IP, issued and last seen", auth: true, status: 200, response: sessions.List{}},
+	{method: "DELETE", path: "/users/{id}/sessions/{sessionID}", tag: "users", summary: "Sign a device out", auth: true, status: 200},
+
+	// Drivers
+	{method: "POST", path: "/drivers/register", tag: "drivers", summary: "Register a driver", body: drivers.RegisterRequest{}, status: 201, response: drivers.AuthResponse{}},
+	{method: "POST", path: "/drivers/login", tag: "drivers", summary: "Driver login", body: drivers.LoginRequest{}, status: 200, response: drivers.AuthResponse{}},
+	{method: "GET", path: "/drivers/nearby", tag: "drivers", summary: "Drivers near a point", auth: true,
+		query: []*openapi3.Parameter{
+			number("lat", true, -90, 90),
+			number("lng", true, -180, 180),
+			number("radius", false, 0, 100),
+		}, status: 200},
+	{method: "GET", path: "/drivers", tag: "drivers", summary: "List and search drivers (admin, support)", auth: true,
+		query: []*openapi3.Parameter{
+			text("status", "available", "busy", "offline"),
+			text("vehicle_type"),
+			text("city"),
+			number("min_rating", false, 0, 5),
+			number("max_rating", false, 0, 5),
+			text("q"),
+			integer("limit", 1, 100),
+			integer("offset", 0, 1_000_000),
+		}, status: 200, response: drivers.DriverList{}},
+	{method: "GET", path: "/drivers/{id}", tag: "drivers", summary: "Get driver profile", auth: true, status: 200, response: drivers.Driver{}},
+	{method: "PATCH", path: "/drivers/{id}", tag: "drivers", summary: "Update driver profile", auth: true, body: drivers.UpdateProfileRequest{}, status: 200, response: drivers.ProfileResponse{}},
+	{method: "POST", path: "/drivers/{id}/verify", tag: "drivers", summary: "Confirm an email or phone change", auth: true, body: drivers.VerifyRequest{}, status: 200, response: drivers.Driver{}},
+	{method: "DELETE", path: "/drivers/{id}", tag: "drivers", summary: "Deactivate a driver account", auth: true, status: 200},
+	{method: "PATCH", path: "/drivers/{id}/location", tag: "drivers", summary: "Update live location", auth: true, body: drivers.LocationUpdate{}, status: 200},
+	{method: "POST", path: "/drivers/locations/batch", tag: "drivers", summary: "Ingest a fleet partner's location pings (X-Fleet-Secret)", body: []drivers.LocationPing{}, status: 200, response: drivers.LocationBatchResult{}},
+	{method: "PATCH", path: "/drivers/{id}/vehicle", tag: "drivers", summary: "Update the active vehicle", auth: true, body: drivers.VehicleUpdate{}, status: 200, response: drivers.Driver{}},
+	{method: "GET", path: "/drivers/{id}/vehicles", tag: "drivers", summary: "List the driver's vehicles", auth: true, status: 200},
+	{method: "POST", path: "/drivers/{id}/vehicles", tag: "drivers", summary: "Register another vehicle", auth: true, body: drivers.VehicleRequest{}, status: 201, response: drivers.Vehicle{}},
+	{method: "PATCH", path: "/drivers/{id}/vehicles/{vehicleID}", tag: "drivers", summary: "Update a vehicle", auth: true, body: drivers.VehicleUpdate{}, status: 200, response: drivers.Vehicle{}},
+	{method: "DELETE", path: "/drivers/{id}/vehicles/{vehicleID}", tag: "drivers", summary: "Remove a vehicle other than the active one", auth: true, status: 200},
+	{method: "POST", path: "/drivers/{id}/vehicles/{vehicleID}/activate", tag: "drivers", summary: "Select the vehicle to drive (while offline)", auth: true, status: 200, response: drivers.Driver{}},
+	{method: "PUT", path: "/drivers/{id}/vehicle/photo", tag: "drivers", summary: "Upload vehicle photo (JPEG/PNG/WebP, ≤5 MB)", auth: true, bodyType: "image/*", status: 200},
+	{method: "GET", path: "/drivers/{id}/vehicle/photo", tag: "drivers", summary: "Fetch vehicle photo", auth: true, status: 200},
+	{method: "POST", path: "/drivers/{id}/online", tag: "drivers", summary: "Go online (opens a session)", auth: true, status: 200, response: drivers.Session{}},
+	{method: "POST", path: "/drivers/{id}/offline", tag: "drivers", summary: "Go offline (closes the session)", auth: true, status: 200, response: drivers.Session{}},
+	{method: "GET", path: "/drivers/{id}/devices", tag: "drivers", summary: "Signed-in devices: user agent, IP, issued and last seen", auth: true, status: 200, response: sessions.List{}},
+	{method: "DELETE", path: "/drivers/{id}/devices/{sessionID}", tag: "drivers", summary: "Sign a device out", auth: true, status: 200},
+	{method: "GET", path: "/drivers/{id}/sessions", tag: "drivers", summary: "Online sessions and hours per day", auth: true,
+		query: []*openapi3.Parameter{text("from"), text("to")}, status: 200, response: drivers.SessionReport{}},
+	{method: "GET", path: "/drivers/{id}/preferences", tag: "drivers", summary: "Working hours, areas and go-home settings", auth: true, status: 200, response: drivers.Preferences{}},
+	{method: "PATCH", path: "/drivers/{id}/preferences", tag: "drivers", summary: "Update working hours, areas and go-home settings", auth: true, body: drivers.PreferencesUpdate{}, status: 200, response: drivers.Preferences{}},
+	{method: "GET", path: "/drivers/{id}/documents", tag: "drivers", summary: "Document verification status", auth: true, status: 200, response: documents.Verification{}},
+	{method: "POST", path: "/drivers/{id}/documents/{kind}", tag: "drivers", summary: "Upload license, registration or insurance (PDF/JPEG/PNG, ≤10 MB)", auth: true, bodyType: "application/octet-stream", status: 201, response: documents.Document{}},
+	{method: "GET", path: "/drivers/{id}/documents/{docID}/file", tag: "drivers", summary: "Download an uploaded document", auth: true, status: 200},
+	{method: "GET", path: "/drivers/{id}/background-check", tag: "drivers", summary: "Background check status and vendor reports", auth: true, status: 200, response: backgroundcheck.Check{}},
+	{method: "POST", path: "/drivers/{id}/background-check/callback", tag: "drivers", summary: "Report a background check status (check vendor, X-Ride-Signature)", body: backgroundcheck.CallbackRequest{}, status: 200, response: backgroundcheck.Check{}},
+	{method: "GET", path: "/drivers/{id}/current-trip", tag: "drivers", summary: "Trip in progress with the rider's name, next step and directions; 304 on If-None-Match of an unchanged trip", auth: true, status: 200, response: trips.CurrentTrip{}},
+	{method: "GET", path: "/drivers/{id}/queue", tag: "drivers", summary: "Place in the queue of the queue zone (e.g. airport) the driver is in", auth: true, status: 200, response: matching.QueuePosition{}},
+	{method: "GET", path: "/drivers/{id}/quests", tag: "drivers", summary: "Running incentive quests and progress", auth: true, status: 200},
+	{method: "GET", path: "/drivers/{id}/lost-items", tag: "drivers", summary: "Lost item reports on the driver's trips (open only unless status=all)", auth: true,
+		query: []*openapi3.Parameter{text("status")}, status: 200},
+	{method: "GET", path: "/drivers/{id}/tax-summary", tag: "drivers", summary: "Invoiced fares and tax for one month, per currency", auth: true,
+		query: []*openapi3.Parameter{text("month")}, status: 200, response: invoices.Summary{}},
+	{method: "GET", path: "/drivers/{id}/wallet", tag: "drivers", summary: "Wallet balance and entries, newest first", auth: true,
+		query: []*openapi3.Parameter{integer("limit", 1, 200), integer("offset", 0, 1_000_000)}, status: 200, response: wallet.Wallet{}},
+	{method: "POST", path: "/drivers/{id}/devices", tag: "drivers", summary: "Register a signing device", auth: true, body: drivers.DeviceRequest{}, status: 201, response: drivers.DeviceRegistration{}},
+	{method: "DELETE", path: "/drivers/{id}/devices/{deviceID}", tag: "drivers", summary: "Revoke a signing device", auth: true, status: 200},
+
+	// Fares
+	{method: "POST", path: "/fares/estimate", tag: "fares", summary: "Estimate a fare and get a quote to request the trip with before it expires", auth: true, body: quotes.EstimateRequest{}, status: 201, response: quotes.Quote{}},
+	{method: "GET", path: "/fares/quotes/{quoteID}", tag: "fares", summary: "A fare quote, with the trip that used it", auth: true, status: 200, response: quotes.Quote{}},
+
+	// Trips
+	{method: "POST", path: "/trips/request", tag: "trips", summary: "Request a ride", auth: true, body: trips.TripRequest{}, status: 201},
+	{method: "GET", path: "/trips/active", tag: "trips", summary: "The caller's trips in progress (rider: REQUESTED…STARTED, driver: assigned or started)", auth: true, status: 200},
+	{method: "GET", path: "/trips/{id}", tag: "trips", summary: "Get trip", auth: true, status: 200, response: trips.Trip{}},
+	{method: "PATCH", path: "/trips/{id}/assign", tag: "trips", summary: "Assign a driver manually", auth: true, ifMatch: true, body: trips.AssignRequest{}, status: 200, response: trips.Trip{}},
+	{method: "PATCH", path: "/trips/{id}/accept", tag: "trips", summary: "Accept the trip offer (assigned driver)", auth: true, ifMatch: true, status: 200, response: trips.Trip{}},
+	{method: "PATCH", path: "/trips/{id}/decline", tag: "trips", summary: "Decline the trip offer and re-match (assigned driver)", auth: true, ifMatch: true, status: 200, response: trips.Trip{}},
+	{method: "PATCH", path: "/trips/{id}/cancel", tag: "trips", summary: "Cancel before the trip starts, with a reason: the rider's trip ends, an assigned driver's is re-matched", auth: true, ifMatch: true, body: trips.CancelRequest{}, status: 200, response: trips.Trip{}},
+	{method: "PATCH", path: "/trips/{id}/arrive", tag: "trips", summary: "Report arriving at the pickup (assigned driver)", auth: true, ifMatch: true, status: 200, response: trips.Trip{}},
+	{method: "PATCH", path: "/trips/{id}/no-show", tag: "trips", summary: "Cancel after waiting for a rider who did not turn up, charging the no-show fee (assigned driver)", auth: true, ifMatch: true, status: 200, response: trips.Trip{}},
+	{method: "PATCH", path: "/trips/{id}/start", tag: "trips", summary: "Start trip", auth: true, ifMatch: true, status: 200, response: trips.Trip{}},
+	{method: "PATCH", path: "/trips/{id}/pause", tag: "trips", summary: "Pause a started trip; paused time is charged at the waiting rate", auth: true, ifMatch: true, status: 200, response: trips.Trip{}},
+	{method: "PATCH", path: "/trips/{id}/resume", tag: "trips", summary: "Resume a paused trip", auth: true, ifMatch: true, status: 200, response: trips.Trip{}},
+	{method: "PATCH", path: "/trips/{id}/end", tag: "trips", summary: "End trip and compute fare", auth: true, ifMatch: true, body: trips.EndRequest{}, optionalBody: true, status: 200, response: trips.Trip{}},
+	{method: "POST", path: "/trips/{id}/offline-completion", tag: "trips", summary: "Complete a trip recorded offline", auth: true, body: trips.OfflineCompletion{}, status: 200, response: trips.Trip{}},
+	{method: "GET", path: "/trips/{id}/messages", tag: "trips", summary: "Chat history, oldest first", auth: true,
+		query: []*openapi3.Parameter{text("since")}, status: 200},
+	{method: "POST", path: "/trips/{id}/messages", tag: "trips", summary: "Send a chat message to the other party", auth: true, body: chat.SendRequest{}, status: 201, response: chat.Message{}},
+	{method: "GET", path: "/trips/{id}/contact", tag: "trips", summary: "Masked contact token for calling the other party", auth: true, status: 200, response: contact.Contact{}},
+	{method: "POST", path: "/contact/resolve", tag: "contact", summary: "Resolve a contact token or PIN (telephony provider, X-Contact-Secret)", body: contact.ResolveRequest{}, status: 200, response: contact.Session{}},
+	{method: "GET", path: "/trips/{id}/split", tag: "trips", summary: "Co-riders splitting the fare and, once completed, each rider's charge", auth: true, status: 200, response: payments.Split{}},
+	{method: "POST", path: "/trips/{id}/split", tag: "trips", summary: "Invite co-riders by email to split the fare (rider)", auth: true, body: payments.InviteRequest{}, status: 200, response: payments.Split{}},
+	{method: "POST", path: "/trips/{id}/split/accept", tag: "trips", summary: "Accept an invite to split the fare", auth: true, status: 200, response: payments.Split{}},
+	{method: "POST", path: "/trips/{id}/split/decline", tag: "trips", summary: "Decline or leave a split; the requester pays that share", auth: true, status: 200, response: payments.Split{}},
+	{method: "GET", path: "/split-invites", tag: "trips", summary: "Open invites to split a fare", auth: true, status: 200},
+	{method: "GET", path: "/trips/{id}/tip", tag: "trips", summary: "The trip's tip", auth: true, status: 200, response: tips.Tip{}},
+	{method: "POST", path: "/trips/{id}/tip", tag: "trips", summary: "Tip the driver after a completed trip (rider); all of it goes to the driver", auth: true, body: tips.TipRequest{}, status: 201, response: tips.Tip{}},
+	{method: "GET", path: "/trips/{id}/invoice", tag: "trips", summary: "Tax invoice for a completed trip (rider)", auth: true, status: 200, response: invoices.Invoice{}},
+	{method: "GET", path: "/trips/{id}/dispute", tag: "trips", summary: "The trip's fare dispute and how it was resolved", auth: true, status: 200, response: disputes.Dispute{}},
+	{method: "POST", path: "/trips/{id}/dispute", tag: "trips", summary: "Dispute the fare of a completed trip (rider)", auth: true, body: disputes.DisputeRequest{}, status: 201, response: disputes.Dispute{}},
+	{method: "POST", path: "/trips/{id}/block", tag: "blocks", summary: "Never be matched again with the trip's driver (rider) or rider (driver)", auth: true, body: blocks.BlockRequest{}, optionalBody: true, status: 201, response: blocks.Block{}},
+	{method: "GET", path: "/blocks", tag: "blocks", summary: "Blocks the caller made", auth: true, status: 200, response: blocks.List{}},
+	{method: "DELETE", path: "/blocks/{id}", tag: "blocks", summary: "Lift a block the caller made", auth: true, status: 200},
+	{method: "POST", path: "/trips/{id}/favorite", tag: "favorites", summary: "Make the driver of a completed trip a favorite, offered the rider's trips first (rider)", auth: true, status: 201, response: favorites.Favorite{}},
+	{method: "GET", path: "/favorites", tag: "favorites", summary: "The caller's favorite drivers (rider)", auth: true, status: 200, response: favorites.List{}},
+	{method: "DELETE", path: "/favorites/{id}", tag: "favorites", summary: "Drop a favorite driver (rider)", auth: true, status: 200},
+	{method: "POST", path: "/trips/{id}/share", tag: "sharing", summary: "Create a link others can follow the trip with (rider)", auth: true, status: 201, response: sharing.Share{}},
+	{method: "DELETE", path: "/trips/{id}/share", tag: "sharing", summary: "Revoke the trip's share links (rider)", auth: true, status: 200},
+	{method: "GET", path: "/shared/{token}", tag: "sharing", summary: "A shared trip's progress, driver and vehicle", status: 200, response: sharing.View{}},
+	{method: "GET", path: "/emergency-contacts", tag: "emergency", summary: "The caller's emergency contacts (rider)", auth: true, status: 200, response: emergency.List{}},
+	{method: "POST", path: "/emergency-contacts", tag: "emergency", summary: "Add an emergency contact (rider)", auth: true, body: emergency.ContactRequest{}, status: 201, response: emergency.Contact{}},
+	{method: "DELETE", path: "/emergency-contacts/{id}", tag: "emergency", summary: "Remove an emergency contact (rider)", auth: true, status: 200},
+	{method: "POST", path: "/trips/{id}/sos", tag: "emergency", summary: "Alert the rider's emergency contacts with a link to follow the trip (rider)", auth: true, status: 202, response: emergency.Alert{}},
+	{method: "GET", path: "/trips/{id}/lost-item", tag: "trips", summary: "Lost item reports on the trip", auth: true, status: 200},
+	{method: "POST", path: "/trips/{id}/lost-item", tag: "trips", summary: "Report an item left in the car (rider, after completion)", auth: true, body: lostfound.ReportRequest{}, status: 201, response: lostfound.Item{}},
+	{method: "POST", path: "/trips/{id}/lost-item/{itemID}/found", tag: "trips", summary: "Driver found the item", auth: true, body: lostfound.AnswerRequest{}, optionalBody: true, status: 200, response: lostfound.Item{}},
+	{method: "POST", path: "/trips/{id}/lost-item/{itemID}/not-found", tag: "trips", summary: "Driver could not find the item", auth: true, body: lostfound.AnswerRequest{}, optionalBody: true, status: 200, response: lostfound.Item{}},
+	{method: "POST", path: "/trips/{id}/lost-item/{itemID}/returned", tag: "trips", summary: "Confirm the item was returned (rider or driver)", auth: true, status: 200, response: lostfound.Item{}},
+	{method: "GET", path: "/trips/{id}/modifications", tag: "trips", summary: "Route change history", auth: true, status: 200},
+	{method: "POST", path: "/trips/{id}/modifications", tag: "trips", summary: "Request a route change", auth: true, body: modifications.Request{}, status: 202, response: modifications.Modification{}},
+	{method: "POST", path: "/trips/{id}/modifications/{modID}/approve", tag: "trips", summary: "Approve a route change", auth: true, ifMatch: true, status: 200, response: modifications.Modification{}},
+	{method: "POST", path: "/trips/{id}/modifications/{modID}/reject", tag: "trips", summary: "Reject a route change", auth: true, status: 200, response: modifications.Modification{}},
+	{method: "PATCH", path: "/trips/{id}/destination", tag: "trips", summary: "Change the destination of a started trip", auth: true, body: modifications.DestinationRequest{}, status: 202, response: modifications.Modification{}},
+	{method: "GET", path: "/trips/{id}/recording/consent", tag: "recordings", summary: "Recording consent status", auth: true, status: 200, response: recordings.StatusResponse{}},
+	{method: "POST", path: "/trips/{id}/recording/consent", tag: "recordings", summary: "Consent to recording", auth: true, status: 200, response: recordings.Consent{}},
+	{method: "DELETE", path: "/trips/{id}/recording/consent", tag: "recordings", summary: "Revoke recording consent", auth: true, status: 200},
+	{method: "POST", path: "/trips/{id}/recording", tag: "recordings", summary: "Register recording metadata", auth: true, body: recordings.RegisterRequest{}, status: 201, response: recordings.Recording{}},
+
+	// Support tickets
+	{method: "GET", path: "/support/tickets", tag: "support", summary: "The caller's support tickets, newest first", auth: true, status: 200},
+	{method: "POST", path: "/support/tickets", tag: "support", summary: "Open a support ticket, optionally about one of the caller's trips", auth: true, body: support.TicketRequest{}, status: 201, response: support.Ticket{}},
+	{method: "GET", path: "/support/tickets/{ticketID}", tag: "support", summary: "A ticket with its messages and attachments", auth: true, status: 200, response: support.Ticket{}},
+	{method: "POST", path: "/support/tickets/{ticketID}/messages", tag: "support", summary: "Reply on a ticket; reopens a resolved one", auth: true, body: support.MessageRequest{}, status: 201, response: support.Message{}},
+	{method: "POST", path: "/support/tickets/{ticketID}/attachments", tag: "support", summary: "Attach a file (PDF/JPEG/PNG, ≤10 MB)", auth: true, bodyType: "application/octet-stream", status: 201, response: support.Attachment{}},
+	{method: "GET", path: "/support/tickets/{ticketID}/attachments/{attachmentID}", tag: "support", summary: "Download an attachment", auth: true, status: 200},
+
+	// Exports (queued by staff at /admin/exports)
+	{method: "GET", path: "/exports/{id}/download", tag: "exports", summary: "Download a finished export; the signed link needs no token",
+		query: []*openapi3.Parameter{text("expires"), text("sig")}, status: 200},
+
+	// Notifications
+	{method: "GET", path: "/notifications/preferences", tag: "notifications", summary: "Notification preferences per channel", auth: true, status: 200},
+	{method: "PUT", path: "/notifications/preferences", tag: "notifications", summary: "Change notification preferences", auth: true, body: notifications.PreferencesRequest{}, status: 200},
+
+	// WebSocket and SSE
+	{method: "GET", path: "/ws/trips/{id}", tag: "tracking", summary: "WebSocket handshake for live trip updates (location, route changes)",
+		query: []*openapi3.Parameter{text("since")}, status: 101},
+	{method: "GET", path: "/sse/trips/{id}", tag: "tracking", summary: "Live trip updates as Server-Sent Events, for clients that cannot hold a WebSocket",
+		query: []*openapi3.Parameter{text("since")}, status: 200},
+	{method: "GET", path: "/shared/{token}/ws", tag: "tracking", summary: "WebSocket of a shared trip's location updates, until the link expires",
+		query: []*openapi3.Parameter{text("since")}, status: 101},
+	{method: "GET", path: "/shared/{token}/sse", tag: "tracking", summary: "A shared trip's location updates as Server-Sent Events",
+		query: []*openapi3.Parameter{text("since")}, status: 200},
+}
+
+var pathParam = regexp.MustCompile(`\{(\w+)\}`)
+
+// Spec builds the OpenAPI document.
+func Spec() (*openapi3.T, error) {
+	doc := &openapi3.T{
+		OpenAPI: "3.0.3",
+		Info: &openapi3.Info{
+			Title:   "ride-service",
+			Version: "1.0",
+		},
+		Paths: openapi3.NewPaths(),
+		Components: &openapi3.Components{
+			SecuritySchemes: openapi3.SecuritySchemes{
+				"bearer": &openapi3.SecuritySchemeRef{Value: openapi3.NewJWTSecurityScheme()},
+			},
+		},
+	}
+	errSchema := openapi3.NewObjectSchema().
+		WithProperty("error", openapi3.NewStringSchema()).
+		WithProperty("code", openapi3.NewStringSchema()).
+		WithRequired([]string{"error", "code"})
+
+	for _, rt := range routes {
+		op := openapi3.NewOperation()
+		op.Tags = []string{rt.tag}
+		op.Summary = rt.summary
+		op.OperationID = operationID(rt)
+		if rt.auth {
+			op.Security = &openapi3.SecurityRequirements{{"bearer": []string{}}}
+		}
+
+		for _, m := range pathParam.FindAllStringSubmatch(rt.path, -1) {
+			op.AddParameter(openapi3.NewPathParameter(m[1]).WithSchema(openapi3.NewStringSchema()))
+		}
+		for _, q := range rt.query {
+			op.AddParameter(q)
+		}
+		if rt.ifMatch {
+			p := openapi3.NewHeaderParameter("If-Match").WithSchema(openapi3.NewStringSchema().WithPattern(`^(W/)?"?[1-9][0-9]*"?$`))
+			// Presence is checked by the handler so a missing header gets 428, not 400.
+			p.Description = "Required. Version from the ETag of the last read; 428 if missing, 409 if it has changed since"
+			op.AddParameter(p)
+		}
+
+		switch {
+		case rt.bodyType != "":
+			op.RequestBody = &openapi3.RequestBodyRef{Value: openapi3.NewRequestBody().WithRequired(true).
+				WithContent(openapi3.NewContentWithSchema(openapi3.NewStringSchema().WithFormat("binary"), []string{rt.bodyType}))}
+		case rt.body != nil:
+			schema, err := schemaFor(rt.body)
+			if err != nil {
+				return nil, fmt.Errorf("openapi: %s %s body: %w", rt.method, rt.path, err)
+			}
+			op.RequestBody = &openapi3.RequestBodyRef{Value: openapi3.NewRequestBody().
+				WithRequired(!rt.optionalBody).WithJSONSchemaRef(schema)}
+		}
+
+		ok := openapi3.NewResponse().WithDescription(rt.summary)
+		if rt.response != nil {
+			schema, err := schemaFor(rt.response)
+			if err != nil {
+				return nil, fmt.Errorf("openapi: %s %s response: %w", rt.method, rt.path, err)
+			}
+			ok.WithJSONSchemaRef(schema)
+		} else if rt.status != 101 {
+			ok.WithJSONSchema(openapi3.NewObjectSchema())
+		}
+		op.AddResponse(rt.status, ok)
+		op.AddResponse(0, openapi3.NewResponse().WithDescription("Error").WithJSONSchema(errSchema))
+
+		doc.AddOperation(rt.path, rt.method, op)
+	}
+	return doc, nil
+}
+
+func operationID(rt route) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(rt.method))
+	for _, part := range strings.Split(rt.path, "/") {
+		part = strings.Trim(part, "{}")
+		if part == "" {
+			continue
+		}
+		for _, w := range strings.Split(part, "-") {
+			b.WriteString(strings.ToUpper(w[:1]) + w[1:])
+		}
+	}
+	return b.String()
+}
+
+func number(name string, required bool, min, max float64) *openapi3.Parameter {
+	p := openapi3.NewQueryParameter(name).WithSchema(openapi3.NewFloat64Schema().WithMin(min).WithMax(max))
+	p.Required = required
+	return p
+}
+
+func integer(name string, min, max float64) *openapi3.Parameter {
+	return openapi3.NewQueryParameter(name).WithSchema(openapi3.NewIntegerSchema().WithMin(min).WithMax(max))
+}
+
+// text is an optional string query parameter, limited to enum when given.
+func text(name string, enum ...any) *openapi3.Parameter {
+	schema := openapi3.NewStringSchema().WithMaxLength(100)
+	if len(enum) > 0 {
+		schema.WithEnum(enum...)
+	}
+	return openapi3.NewQueryParameter(name).WithSchema(schema)
+}
+
+// schemaFor generates an inline schema for v, applying `openapi` tags.
+func schemaFor(v any) (*openapi3.SchemaRef, error) {
+	return openapi3gen.NewSchemaRefForValue(v, nil, openapi3gen.SchemaCustomizer(customize))
+}
+
+// customize applies `validate` tag constraints. It runs for every field and
+// then for the enclosing struct, where required fields are collected.
+func customize(_ string, t reflect.Type, tag reflect.StructTag, schema *openapi3.Schema) error {
+	if t.Kind() == reflect.Struct {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			rules, err := validation.ParseRules(f.Tag.Get("validate"))
+			if err != nil {
+				return err
+			}
+			if rules.Required {
+				schema.Required = append(schema.Required, jsonName(f))
+			}
+		}
+	}
+
+	rules, err := validation.ParseRules(tag.Get("validate"))
+	if err != nil {
+		return err
+	}
+	if rules.Min != nil {
+		schema.Min = rules.Min
+	}
+	if rules.Max != nil {
+		schema.Max = rules.Max
+	}
+	if rules.MinLength != nil {
+		schema.MinLength = uint64(*rules.MinLength)
+	}
+	if rules.MaxLength != nil {
+		l := uint64(*rules.MaxLength)
+		schema.MaxLength = &l
+	}
+	if rules.MaxItems != nil {
+		l := uint64(*rules.MaxItems)
+		schema.MaxItems = &l
+	}
+	if rules.Format != "" {
+		schema.Format = rules.Format
+		schema.Pattern = validation.Formats[rules.Format]
+	}
+	return nil
+}
+
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
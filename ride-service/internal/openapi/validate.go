@@ -0,0 +1,120 @@
+package openapi
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/legacy"
+
+	"ride-service/pkg/apierror"
+)
+
+// MaxJSONBody caps JSON request bodies read for validation.
+const MaxJSONBody = 1 << 20
+
+// Validate returns middleware that checks path/query parameters and JSON
+// bodies of documented routes against doc, answering 400 with every
+// violation. Undocumented routes (admin, health) pass through untouched.
+// Authentication stays with the jwt middleware.
+func Validate(doc *openapi3.T) (func(http.Handler) http.Handler, error) {
+	router, err := legacy.NewRouter(doc)
+	if err != nil {
+		return nil, err
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route, params, err := router.FindRoute(r)
+			if err != nil {
+				next.ServeHTTP(w, r) // not documented (or wrong method) — routing decides
+				return
+			}
+
+			in := &openapi3filter.RequestValidationInput{
+				Request:    r,
+				PathParams: params,
+				Route:      route,
+				Options: &openapi3filter.Options{
+					AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+					MultiError:         true,
+				},
+			}
+			if jsonBody(route) {
+				body, err := io.ReadAll(io.LimitReader(r.Body, MaxJSONBody+1))
+				if err != nil || len(body) > MaxJSONBody {
+					apierror.Write(w, apierror.New(http.StatusRequestEntityTooLarge, apierror.CodeTooLarge, "request body too large"))
+					return
+				}
+				r.Body = io.NopCloser(bytes.NewReader(body))
+
+				// Validate a copy declared as JSON: clients that omit the
+				// header still get their body checked, as handlers decode
+				// JSON regardless.
+				vr := r.Clone(r.Context())
+				vr.Header.Set("Content-Type", "application/json")
+				vr.Body = io.NopCloser(bytes.NewReader(body))
+				in.Request = vr
+			} else {
+				in.Options.ExcludeRequestBody = true // binary uploads are checked by the handler
+			}
+
+			if err := openapi3filter.ValidateRequest(r.Context(), in); err != nil {
+				var fields []apierror.FieldError
+				collect(err, "", &fields)
+				apierror.Write(w, apierror.InvalidFields(fields))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}, nil
+}
+
+func jsonBody(route *routers.Route) bool {
+	rb := route.Operation.RequestBody
+	return rb != nil && rb.Value != nil && rb.Value.Content.Get("application/json") != nil
+}
+
+// collect flattens a validation error into one entry per invalid field.
+// param names the parameter the errors below it concern, if any.
+func collect(err error, param string, out *[]apierror.FieldError) {
+	var schemaErr *openapi3.SchemaError
+	switch e := err.(type) {
+	case openapi3.MultiError:
+		for _, sub := range e {
+			collect(sub, param, out)
+		}
+		return
+	case *openapi3filter.RequestError:
+		if e.Parameter != nil {
+			param = e.Parameter.Name
+		}
+		if _, multi := e.Err.(openapi3.MultiError); multi || errors.As(e.Err, &schemaErr) {
+			collect(e.Err, param, out)
+			return
+		}
+		reason := e.Reason
+		if e.Parameter == nil && e.RequestBody != nil && e.Err != nil {
+			reason = "invalid body"
+		}
+		*out = append(*out, apierror.FieldError{Field: param, Reason: reason})
+		return
+	}
+	if !errors.As(err, &schemaErr) {
+		*out = append(*out, apierror.FieldError{Field: param, Reason: err.Error()})
+		return
+	}
+	field := strings.Join(schemaErr.JSONPointer(), ".")
+	if param != "" {
+		field = param
+	}
+	reason := schemaErr.Reason
+	if schemaErr.SchemaField == "pattern" && schemaErr.Schema.Format != "" {
+		reason = "must be a valid " + schemaErr.Schema.Format
+	}
+	*out = append(*out, apierror.FieldError{Field: field, Reason: reason})
+}
@@ -0,0 +1,16 @@
+package payments
+
+import (
+	"context"
+
+	"ride-service/pkg/money"
+)
+
+// Gateway is the payment provider integration that charges riders. key is
+// the charge's ID and stays the same across retries, so a provider that
+// supports idempotency keys never charges a rider twice for one share.
+// Refund pays amount back to the rider, for fares adjusted down.
+type Gateway interface {
+	Charge(ctx context.Context, key, riderID string, amount money.Money, description string) error
+	Refund(ctx context.Context, key, riderID string, amount money.Money, description string) error
+}
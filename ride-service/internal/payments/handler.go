@@ -0,0 +1,82 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+)
+
+// Handler exposes fare splitting to riders.
+type Handler struct{ svc *Service }
+
+// NewHandler wires a handler to the payment service.
+func NewHandler(svc *Service) *Handler { return &Handler{svc: svc} }
+
+// TripRoutes returns the routes mounted at /trips/{id}/split.
+func (h *Handler) TripRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+
+	r.Get("/", h.Get)
+	r.Post("/", h.Invite)
+	r.Post("/accept", h.respond(h.svc.Accept))
+	r.Post("/decline", h.respond(h.svc.Decline))
+
+	return r
+}
+
+// InviteRoutes returns the routes mounted at /split-invites.
+func (h *Handler) InviteRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+	r.Get("/", h.Invites)
+	return r
+}
+
+func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
+	sp, err := h.svc.Get(r.Context(), chi.URLParam(r, "id"), jwt.GetClaims(r.Context()))
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, sp)
+}
+
+func (h *Handler) Invite(w http.ResponseWriter, r *http.Request) {
+	var req InviteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	sp, err := h.svc.Invite(r.Context(), chi.URLParam(r, "id"), jwt.GetClaims(r.Context()).UserID, req)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, sp)
+}
+
+func (h *Handler) respond(fn func(ctx context.Context, tripID, userID string) (*Split, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sp, err := fn(r.Context(), chi.URLParam(r, "id"), jwt.GetClaims(r.Context()).UserID)
+		if err != nil {
+			apierror.Write(w, err)
+			return
+		}
+		apierror.WriteJSON(w, http.StatusOK, sp)
+	}
+}
+
+func (h *Handler) Invites(w http.ResponseWriter, r *http.Request) {
+	invites, err := h.svc.Invites(r.Context(), jwt.GetClaims(r.Context()).UserID)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]any{"invites": invites})
+}
@@ -0,0 +1,84 @@
+package payments
+
+import (
+	"time"
+
+	"ride-service/pkg/money"
+)
+
+// MaxCoRiders caps the riders a requester can invite to split one trip.
+const MaxCoRiders = 3
+
+// Participant statuses. invited → accepted | declined; an accepted co-rider
+// can still decline until the trip completes. Invites still open at
+// completion are declined then, and the requester pays that share.
+const (
+	StatusInvited  = "invited"
+	StatusAccepted = "accepted"
+	StatusDeclined = "declined"
+)
+
+// Charge statuses. A charge is due until the gateway takes it; without a
+// gateway it stays due for settlement elsewhere.
+const (
+	ChargeDue     = "due"
+	ChargeCharged = "charged"
+	ChargeFailed  = "failed"
+)
+
+// Charge kinds: a rider's share of the fare, a tip to the driver, the fee
+// for not turning up, or their share of a disputed fare's adjustment
+// (negative for a refund).
+const (
+	KindFare       = "fare"
+	KindTip        = "tip"
+	KindNoShow     = "no_show"
+	KindAdjustment = "adjustment"
+)
+
+// Participant is a co-rider invited to split a trip's fare.
+type Participant struct {
+	RiderID     string     `json:"rider_id"`
+	Name        string     `json:"name"`
+	Status      string     `json:"status"`
+	InvitedAt   time.Time  `json:"invited_at"`
+	RespondedAt *time.Time `json:"responded_at,omitempty"`
+}
+
+// Charge is what one rider pays for a completed trip: their share of the
+// fare, or a tip.
+type Charge struct {
+	ID        string      `json:"id"`
+	TripID    string      `json:"trip_id"`
+	RiderID   string      `json:"rider_id"`
+	Kind      string      `json:"kind"` // fare | tip | no_show | adjustment
+	Amount    money.Money `json:"amount"`
+	SplitWays int         `json:"split_ways"` // riders the fare was split between; 1 when not split, a tip or a fee
+	Status    string      `json:"status"`
+	Error     *string     `json:"error,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+	ChargedAt *time.Time  `json:"charged_at,omitempty"`
+}
+
+// Split is the response for GET /trips/{id}/split: the co-riders invited and,
+// once the trip completed, what each rider was charged.
+type Split struct {
+	TripID       string        `json:"trip_id"`
+	RequesterID  string        `json:"requester_id"`
+	Participants []Participant `json:"participants"`
+	Charges      []Charge      `json:"charges"`
+}
+
+// InviteRequest is the body for POST /trips/{id}/split: co-riders by the
+// email they signed up with.
+type InviteRequest struct {
+	Emails []string `json:"emails" validate:"required,maxItems=3"`
+}
+
+// Invite is a split the caller has been invited to, for GET /split-invites.
+type Invite struct {
+	TripID      string    `json:"trip_id"`
+	RequesterID string    `json:"requester_id"`
+	Requester   string    `json:"requester"` // the requester's name
+	InvitedAt   time.Time `json:"invited_at"`
+}
@@ -0,0 +1,564 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/internal/events"
+	"ride-service/internal/trips"
+	"ride-service/internal/trips/statemachine"
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/db"
+	"ride-service/pkg/eventbus"
+	"ride-service/pkg/jwt"
+	"ride-service/pkg/logging"
+	"ride-service/pkg/money"
+	"ride-service/pkg/pii"
+)
+
+var logger = logging.For("payments")
+
+var (
+	ErrTripNotFound   = apierror.NotFound("trip not found")
+	ErrNotParticipant = apierror.Forbidden("not a participant in this trip")
+	ErrForbidden      = apierror.Forbidden("only the trip's rider can invite co-riders")
+	ErrClosed         = apierror.Conflict("the split can only change before the trip ends")
+	ErrNoInvite       = apierror.NotFound("no open split invite for you on this trip")
+	ErrTooMany        = apierror.Conflict("too many co-riders on this trip")
+	ErrNotReady       = apierror.Conflict("trip has no charges until it completes")
+	ErrInvalid        = apierror.Validation("invalid split")
+)
+
+const (
+	participantColumns = `p.rider_id,u.name,p.status,p.invited_at,p.responded_at`
+	chargeColumns      = `id,trip_id,rider_id,kind,amount_minor,currency,split_ways,status,error,created_at,charged_at`
+)
+
+// InviteFunc is told about a new split invite, to notify the invited rider.
+type InviteFunc func(ctx context.Context, riderID, tripID, requester string)
+
+// Service splits trip fares between the requesting rider and the co-riders
+// they invite, and charges each rider their share when the trip completes.
+type Service struct {
+	db       *pgxpool.Pool
+	trips    Trips
+	cipher   *pii.Cipher // co-riders are found by the blind index of their email
+	gateway  Gateway     // nil: charges stay due
+	onInvite InviteFunc
+}
+
+// Trips reads and locks trips; trips.TripRepo implements it.
+type Trips interface {
+	GetByID(ctx context.Context, id string) (*trips.Trip, error)
+	Lock(ctx context.Context, tripID string) (*trips.Trip, error)
+}
+
+// NewService creates a payment service. gateway may be nil.
+func NewService(db *pgxpool.Pool, t Trips, cipher *pii.Cipher, gateway Gateway) *Service {
+	return &Service{db: db, trips: t, cipher: cipher, gateway: gateway}
+}
+
+// OnInvite sets the function told about new invites. Call it before serving.
+func (s *Service) OnInvite(fn InviteFunc) { s.onInvite = fn }
+
+// open reports whether the trip's status still allows the split to change.
+func open(status string) bool {
+	return status != statemachine.Completed && status != statemachine.Cancelled
+}
+
+// lockTrip returns the trip locked for the rest of tx, so invites, answers
+// and settling don't interleave.
+func (s *Service) lockTrip(ctx context.Context, tx pgx.Tx, tripID string) (*trips.Trip, error) {
+	t, err := s.trips.Lock(db.Within(ctx, tx), tripID)
+	if errors.Is(err, trips.ErrNotFound) {
+		return nil, ErrTripNotFound
+	}
+	return t, err
+}
+
+// Invite asks co-riders, by email, to split the fare of the caller's trip.
+// Riders already invited are left as they are; one who declined is asked
+// again.
+func (s *Service) Invite(ctx context.Context, tripID, userID string, req InviteRequest) (*Split, error) {
+	emails := make([]string, 0, len(req.Emails))
+	for _, e := range req.Emails {
+		e = strings.ToLower(strings.TrimSpace(e))
+		if e == "" {
+			return nil, fmt.Errorf("%w: emails must not be empty", ErrInvalid)
+		}
+		if !slices.Contains(emails, e) {
+			emails = append(emails, e)
+		}
+	}
+	if len(emails) == 0 {
+		return nil, fmt.Errorf("%w: at least one email is required", ErrInvalid)
+	}
+	if len(emails) > MaxCoRiders {
+		return nil, ErrTooMany
+	}
+
+	var requester string
+	var invited []string
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		t, err := s.lockTrip(ctx, tx, tripID)
+		if err != nil {
+			return err
+		}
+		riderID := t.RiderID
+		if userID != riderID {
+			return ErrForbidden
+		}
+		if !open(t.Status) {
+			return ErrClosed
+		}
+		if err := tx.QueryRow(ctx, `SELECT name FROM users WHERE id=$1`, riderID).Scan(&requester); err != nil {
+			return err
+		}
+		for _, email := range emails {
+			var id string
+			err := tx.QueryRow(ctx, `SELECT id FROM users WHERE (email_idx=$1 OR lower(email)=$2) AND deleted_at IS NULL`,
+				s.cipher.Index(pii.Email, email), email).Scan(&id)
+			if errors.Is(err, pgx.ErrNoRows) {
+				return fmt.Errorf("%w: no rider with email %s", ErrInvalid, email)
+			} else if err != nil {
+				return err
+			}
+			if id == riderID {
+				return fmt.Errorf("%w: you pay your own share already", ErrInvalid)
+			}
+			tag, err := tx.Exec(ctx,
+				`INSERT INTO split_participants (trip_id,rider_id) VALUES ($1,$2)
+				 ON CONFLICT (trip_id,rider_id) DO UPDATE SET status='invited', invited_at=NOW(), responded_at=NULL
+				 WHERE split_participants.status='declined'`, tripID, id)
+			if err != nil {
+				return err
+			}
+			if tag.RowsAffected() > 0 {
+				invited = append(invited, id)
+			}
+		}
+		var n int
+		if err := tx.QueryRow(ctx,
+			`SELECT COUNT(*) FROM split_participants WHERE trip_id=$1 AND status<>'declined'`, tripID).Scan(&n); err != nil {
+			return err
+		}
+		if n > MaxCoRiders {
+			return ErrTooMany
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if s.onInvite != nil {
+		for _, id := range invited {
+			s.onInvite(ctx, id, tripID, requester)
+		}
+	}
+	return s.split(ctx, tripID, userID)
+}
+
+// Accept joins the split the caller was invited to.
+func (s *Service) Accept(ctx context.Context, tripID, userID string) (*Split, error) {
+	return s.respond(ctx, tripID, userID, StatusAccepted, StatusInvited)
+}
+
+// Decline turns down an invite, or leaves a split already accepted; the
+// requester pays that share.
+func (s *Service) Decline(ctx context.Context, tripID, userID string) (*Split, error) {
+	return s.respond(ctx, tripID, userID, StatusDeclined, StatusInvited, StatusAccepted)
+}
+
+func (s *Service) respond(ctx context.Context, tripID, userID, to string, from ...string) (*Split, error) {
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		t, err := s.lockTrip(ctx, tx, tripID)
+		if err != nil {
+			return err
+		}
+		if !open(t.Status) {
+			return ErrClosed
+		}
+		tag, err := tx.Exec(ctx,
+			`UPDATE split_participants SET status=$3, responded_at=NOW()
+			 WHERE trip_id=$1 AND rider_id=$2 AND status=ANY($4)`, tripID, userID, to, from)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrNoInvite
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.split(ctx, tripID, userID)
+}
+
+// Get returns a trip's split to its rider, anyone invited to it, or staff.
+func (s *Service) Get(ctx context.Context, tripID string, claims *jwt.Claims) (*Split, error) {
+	if _, err := uuid.Parse(tripID); err != nil {
+		return nil, ErrTripNotFound
+	}
+	if claims.Role == "admin" || claims.Role == "support" {
+		return s.split(ctx, tripID, "")
+	}
+	return s.split(ctx, tripID, claims.UserID)
+}
+
+// split loads a trip's split. Unless userID is empty (staff), it must be the
+// requester's or a participant's.
+func (s *Service) split(ctx context.Context, tripID, userID string) (*Split, error) {
+	sp := &Split{TripID: tripID, Participants: []Participant{}}
+	t, err := s.trips.GetByID(ctx, tripID)
+	if errors.Is(err, trips.ErrNotFound) {
+		return nil, ErrTripNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	sp.RequesterID = t.RiderID
+	rows, err := s.db.Query(ctx,
+		`SELECT `+participantColumns+` FROM split_participants p JOIN users u ON u.id=p.rider_id
+		 WHERE p.trip_id=$1 ORDER BY p.invited_at, p.rider_id`, tripID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	member := userID == "" || userID == sp.RequesterID
+	for rows.Next() {
+		var p Participant
+		if err := rows.Scan(&p.RiderID, &p.Name, &p.Status, &p.InvitedAt, &p.RespondedAt); err != nil {
+			return nil, err
+		}
+		member = member || p.RiderID == userID
+		sp.Participants = append(sp.Participants, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if !member {
+		return nil, ErrNotParticipant
+	}
+	sp.Charges, err = s.charges(ctx, s.db, tripID, "")
+	if err != nil {
+		return nil, err
+	}
+	return sp, nil
+}
+
+// Invites lists the open invites of riderID on trips still under way,
+// newest first.
+func (s *Service) Invites(ctx context.Context, riderID string) ([]Invite, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT p.trip_id, t.rider_id, u.name, p.invited_at
+		 FROM split_participants p JOIN trips t ON t.id=p.trip_id JOIN users u ON u.id=t.rider_id
+		 WHERE p.rider_id=$1 AND p.status='invited' AND t.status NOT IN ($2,$3)
+		 ORDER BY p.invited_at DESC`, riderID, statemachine.Completed, statemachine.Cancelled)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	invites := []Invite{}
+	for rows.Next() {
+		var inv Invite
+		if err := rows.Scan(&inv.TripID, &inv.RequesterID, &inv.Requester, &inv.InvitedAt); err != nil {
+			return nil, err
+		}
+		invites = append(invites, inv)
+	}
+	return invites, rows.Err()
+}
+
+// Settle records what each rider of a completed trip owes, on first call:
+// the fare split evenly between the requester and the co-riders who
+// accepted, with any remainder in minor units on the requester. Invites
+// nobody answered are declined. Later calls return the same charges, so
+// the receipt and the charging consumer agree whichever runs first.
+func (s *Service) Settle(ctx context.Context, tripID string) ([]Charge, error) {
+	var charges []Charge
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		t, err := s.lockTrip(ctx, tx, tripID)
+		if err != nil {
+			return err
+		}
+		if charges, err = s.charges(ctx, tx, tripID, KindFare); err != nil || len(charges) > 0 {
+			return err
+		}
+		if t.Status != statemachine.Completed || t.Fare == nil {
+			return ErrNotReady
+		}
+		if _, err := tx.Exec(ctx,
+			`UPDATE split_participants SET status='declined', responded_at=NOW() WHERE trip_id=$1 AND status='invited'`,
+			tripID); err != nil {
+			return err
+		}
+		rows, err := tx.Query(ctx,
+			`SELECT rider_id FROM split_participants WHERE trip_id=$1 AND status='accepted' ORDER BY invited_at, rider_id`, tripID)
+		if err != nil {
+			return err
+		}
+		payers, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return err
+		}
+		payers = append([]string{t.RiderID}, payers...)
+
+		n := int64(len(payers))
+		share := t.Fare.Amount / n
+		for i, id := range payers {
+			amount := share
+			if i == 0 {
+				amount = t.Fare.Amount - share*(n-1)
+			}
+			c, err := scanCharge(tx.QueryRow(ctx,
+				`INSERT INTO rider_charges (id,trip_id,rider_id,amount_minor,currency,split_ways)
+				 VALUES ($1,$2,$3,$4,$5,$6) RETURNING `+chargeColumns,
+				uuid.New().String(), tripID, id, amount, t.Fare.Currency, n))
+			if err != nil {
+				return err
+			}
+			charges = append(charges, *c)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return charges, nil
+}
+
+// collect takes every charge not yet charged through the gateway. Charges
+// are independent: one rider's failure does not hold up the others, but
+// it is returned so the consumer retries.
+func (s *Service) collect(ctx context.Context, charges []Charge) error {
+	if s.gateway == nil {
+		return nil
+	}
+	var errs []error
+	for _, c := range charges {
+		if c.Status == ChargeCharged {
+			continue
+		}
+		desc := fmt.Sprintf("Trip %s", c.TripID)
+		if c.Kind == KindTip {
+			desc = fmt.Sprintf("Tip for trip %s", c.TripID)
+		} else if c.Kind == KindNoShow {
+			desc = fmt.Sprintf("No-show fee for trip %s", c.TripID)
+		} else if c.Kind == KindAdjustment {
+			desc = fmt.Sprintf("Fare adjustment for trip %s", c.TripID)
+		} else if c.SplitWays > 1 {
+			desc = fmt.Sprintf("Trip %s (your share of a fare split %d ways)", c.TripID, c.SplitWays)
+		}
+		pay := s.gateway.Charge
+		amount := c.Amount
+		if amount.Amount < 0 {
+			pay, amount.Amount = s.gateway.Refund, -amount.Amount
+		}
+		if err := pay(ctx, c.ID, c.RiderID, amount, desc); err != nil {
+			if _, uerr := s.db.Exec(ctx, `UPDATE rider_charges SET status='failed', error=$2 WHERE id=$1`, c.ID, err.Error()); uerr != nil {
+				logger.Error("recording failed charge", "charge", c.ID, "err", uerr)
+			}
+			errs = append(errs, fmt.Errorf("payments: charge %s: %w", c.ID, err))
+			continue
+		}
+		if _, err := s.db.Exec(ctx,
+			`UPDATE rider_charges SET status='charged', error=NULL, charged_at=NOW() WHERE id=$1`, c.ID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Start settles and charges trips as they complete, charges tips and
+// no-show fees as they come, and charges or refunds fare adjustments.
+// Every step is idempotent, so failures are returned for the consumer to
+// retry.
+func (s *Service) Start(ctx context.Context, bus eventbus.Bus) {
+	bus.Subscribe(ctx, eventbus.TopicTripCompleted, "payments-trip-completed", func(ctx context.Context, data []byte) error {
+		var ev events.TripCompletedEvent
+		env, err := events.Unwrap(data, &ev)
+		if errors.Is(err, events.ErrUnsupportedVersion) {
+			logger.Warn("skipping event", "event_id", env.EventID, "err", err)
+			return nil
+		} else if err != nil {
+			return err
+		}
+		charges, err := s.Settle(ctx, ev.TripID)
+		if errors.Is(err, ErrTripNotFound) || errors.Is(err, ErrNotReady) {
+			logger.Warn("nothing to charge for trip.completed", "trip", ev.TripID, "err", err)
+			return nil
+		} else if err != nil {
+			return err
+		}
+		return s.collect(ctx, charges)
+	})
+
+	bus.Subscribe(ctx, eventbus.TopicTipAdded, "payments-tip-added", func(ctx context.Context, data []byte) error {
+		var ev events.TipAddedEvent
+		env, err := events.Unwrap(data, &ev)
+		if errors.Is(err, events.ErrUnsupportedVersion) {
+			logger.Warn("skipping event", "event_id", env.EventID, "err", err)
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if _, err := uuid.Parse(ev.TripID); err != nil {
+			logger.Warn("skipping tip.added with bad trip id", "trip", ev.TripID)
+			return nil
+		}
+		return s.chargeOnce(ctx, ev.TripID, ev.RiderID, KindTip, ev.Amount())
+	})
+
+	bus.Subscribe(ctx, eventbus.TopicTripNoShow, "payments-trip-no-show", func(ctx context.Context, data []byte) error {
+		var ev events.TripNoShowEvent
+		env, err := events.Unwrap(data, &ev)
+		if errors.Is(err, events.ErrUnsupportedVersion) {
+			logger.Warn("skipping event", "event_id", env.EventID, "err", err)
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if _, err := uuid.Parse(ev.TripID); err != nil {
+			logger.Warn("skipping trip.no_show with bad trip id", "trip", ev.TripID)
+			return nil
+		}
+		if ev.FeeMinor <= 0 {
+			return nil
+		}
+		return s.chargeOnce(ctx, ev.TripID, ev.RiderID, KindNoShow, ev.Fee())
+	})
+
+	bus.Subscribe(ctx, eventbus.TopicFareAdjusted, "payments-fare-adjusted", func(ctx context.Context, data []byte) error {
+		var ev events.FareAdjustedEvent
+		env, err := events.Unwrap(data, &ev)
+		if errors.Is(err, events.ErrUnsupportedVersion) {
+			logger.Warn("skipping event", "event_id", env.EventID, "err", err)
+			return nil
+		} else if err != nil {
+			return err
+		}
+		charges, err := s.Adjust(ctx, ev.TripID)
+		if errors.Is(err, ErrTripNotFound) {
+			logger.Warn("nothing to adjust for fare.adjusted", "trip", ev.TripID)
+			return nil
+		} else if err != nil {
+			return err
+		}
+		return s.collect(ctx, charges)
+	})
+}
+
+// Adjust records what each rider of a trip whose fare changed after
+// settling owes or gets back, on first call: the difference between the
+// trip's fare and the fare charges, split like the fare was, with any
+// remainder on the requester. A trip not settled yet needs nothing; Settle
+// charges the new fare. Later calls return the same charges.
+func (s *Service) Adjust(ctx context.Context, tripID string) ([]Charge, error) {
+	var adjustments []Charge
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		t, err := s.lockTrip(ctx, tx, tripID)
+		if err != nil {
+			return err
+		}
+		if adjustments, err = s.charges(ctx, tx, tripID, KindAdjustment); err != nil || len(adjustments) > 0 {
+			return err
+		}
+		fares, err := s.charges(ctx, tx, tripID, KindFare)
+		if err != nil || len(fares) == 0 || t.Fare == nil {
+			return err
+		}
+		diff := t.Fare.Amount
+		for _, c := range fares {
+			diff -= c.Amount.Amount
+		}
+		if diff == 0 {
+			return nil
+		}
+		n := int64(len(fares))
+		share := diff / n
+		for i, f := range fares {
+			amount := share
+			if i == 0 {
+				amount = diff - share*(n-1)
+			}
+			if amount == 0 {
+				continue
+			}
+			c, err := scanCharge(tx.QueryRow(ctx,
+				`INSERT INTO rider_charges (id,trip_id,rider_id,kind,amount_minor,currency,split_ways)
+				 VALUES ($1,$2,$3,$4,$5,$6,$7) RETURNING `+chargeColumns,
+				uuid.New().String(), tripID, f.RiderID, KindAdjustment, amount, f.Amount.Currency, n))
+			if err != nil {
+				return err
+			}
+			adjustments = append(adjustments, *c)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return adjustments, nil
+}
+
+// chargeOnce records the rider's charge of kind on the trip, unless there
+// is one already, and collects it.
+func (s *Service) chargeOnce(ctx context.Context, tripID, riderID, kind string, amount money.Money) error {
+	if _, err := s.db.Exec(ctx,
+		`INSERT INTO rider_charges (id,trip_id,rider_id,kind,amount_minor,currency)
+		 VALUES ($1,$2,$3,$4,$5,$6) ON CONFLICT (trip_id,rider_id,kind) DO NOTHING`,
+		uuid.New().String(), tripID, riderID, kind, amount.Amount, amount.Currency); err != nil {
+		return err
+	}
+	charges, err := s.charges(ctx, s.db, tripID, kind)
+	if err != nil {
+		return err
+	}
+	return s.collect(ctx, charges)
+}
+
+// querier is satisfied by *pgxpool.Pool and pgx.Tx.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// charges lists a trip's charges of kind, or of every kind if it is empty;
+// fares before tips and the requester's first.
+func (s *Service) charges(ctx context.Context, q querier, tripID, kind string) ([]Charge, error) {
+	rows, err := q.Query(ctx,
+		`SELECT `+chargeColumns+` FROM rider_charges c
+		 WHERE trip_id=$1 AND ($2='' OR kind=$2)
+		 ORDER BY kind='fare' DESC, rider_id=(SELECT rider_id FROM trips WHERE id=c.trip_id) DESC, created_at, id`,
+		tripID, kind)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	charges := []Charge{}
+	for rows.Next() {
+		c, err := scanCharge(rows)
+		if err != nil {
+			return nil, err
+		}
+		charges = append(charges, *c)
+	}
+	return charges, rows.Err()
+}
+
+func scanCharge(row pgx.Row) (*Charge, error) {
+	var c Charge
+	var currency string
+	if err := row.Scan(&c.ID, &c.TripID, &c.RiderID, &c.Kind, &c.Amount.Amount, &currency, &c.SplitWays,
+		&c.Status, &c.Error, &c.CreatedAt, &c.ChargedAt); err != nil {
+		return nil, err
+	}
+	c.Amount.Currency = currency
+	return &c, nil
+}
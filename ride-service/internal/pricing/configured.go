@@ -0,0 +1,38 @@
+package pricing
+
+import (
+	"context"
+	"strings"
+
+	"ride-service/pkg/config"
+)
+
+// Configured quotes from the configured formulas and commission as they
+// are, for STORAGE=memory where there are no stored rules to seed. Its
+// quotes carry no rule versions, and the rules cannot be changed.
+type Configured struct {
+	pricing config.Pricing
+}
+
+// NewConfigured returns a Configured for cfg.
+func NewConfigured(cfg config.Pricing) *Configured { return &Configured{pricing: cfg} }
+
+// For quotes a trip like Service.For, from the configuration.
+func (c *Configured) For(_ context.Context, city, vehicleType string) (Quote, error) {
+	formula := c.pricing.Formula()
+	for name, cp := range c.pricing.Cities {
+		if strings.EqualFold(strings.TrimSpace(name), strings.TrimSpace(city)) {
+			formula = cp
+			break
+		}
+	}
+	rate, err := formula.Rate()
+	if err != nil {
+		return Quote{}, err
+	}
+	bp, err := config.BasisPoints(c.pricing.Commission)
+	if err != nil {
+		return Quote{}, err
+	}
+	return Quote{Rate: c.pricing.ForVehicle(rate, vehicleType), CommissionBP: bp}, nil
+}
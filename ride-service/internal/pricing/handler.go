@@ -0,0 +1,105 @@
+package pricing
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+)
+
+// Handler exposes the fare and commission rules to admins.
+type Handler struct{ svc *Service }
+
+// NewHandler wires a handler to the pricing service.
+func NewHandler(svc *Service) *Handler { return &Handler{svc: svc} }
+
+// AdminRoutes returns the routes mounted under /admin/pricing. {city} is a
+// driver city, or "default" for the rules of every other city.
+func (h *Handler) AdminRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth, jwt.RequireRole("admin"))
+
+	r.Get("/", h.Current)
+	r.Get("/fares/{city}", h.FareHistory)
+	r.Put("/fares/{city}", h.SetFare)
+	r.Delete("/fares/{city}", h.RemoveFare)
+	r.Get("/commissions/{city}", h.CommissionHistory)
+	r.Put("/commissions/{city}", h.SetCommission)
+	r.Delete("/commissions/{city}", h.RemoveCommission)
+
+	return r
+}
+
+func (h *Handler) Current(w http.ResponseWriter, r *http.Request) {
+	rules, err := h.svc.Current(r.Context())
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, rules)
+}
+
+func (h *Handler) FareHistory(w http.ResponseWriter, r *http.Request) {
+	rules, err := h.svc.FareHistory(r.Context(), chi.URLParam(r, "city"))
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]any{"versions": rules})
+}
+
+func (h *Handler) SetFare(w http.ResponseWriter, r *http.Request) {
+	var req FareRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	rule, err := h.svc.SetFare(r.Context(), chi.URLParam(r, "city"), jwt.GetClaims(r.Context()).UserID, req)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, rule)
+}
+
+func (h *Handler) RemoveFare(w http.ResponseWriter, r *http.Request) {
+	if err := h.svc.RemoveFare(r.Context(), chi.URLParam(r, "city")); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]string{"status": "removed"})
+}
+
+func (h *Handler) CommissionHistory(w http.ResponseWriter, r *http.Request) {
+	rules, err := h.svc.CommissionHistory(r.Context(), chi.URLParam(r, "city"))
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]any{"versions": rules})
+}
+
+func (h *Handler) SetCommission(w http.ResponseWriter, r *http.Request) {
+	var req CommissionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	rule, err := h.svc.SetCommission(r.Context(), chi.URLParam(r, "city"), jwt.GetClaims(r.Context()).UserID, req)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, rule)
+}
+
+func (h *Handler) RemoveCommission(w http.ResponseWriter, r *http.Request) {
+	if err := h.svc.RemoveCommission(r.Context(), chi.URLParam(r, "city")); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]string{"status": "removed"})
+}
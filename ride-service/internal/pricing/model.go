@@ -0,0 +1,82 @@
+package pricing
+
+import (
+	"time"
+
+	"ride-service/pkg/config"
+	"ride-service/pkg/money"
+)
+
+// DefaultCity names the default rules in paths; they are stored under the
+// empty city.
+const DefaultCity = "default"
+
+// FareRule is one version of a city's fare formula. Amounts are in the
+// rule's currency.
+type FareRule struct {
+	Version   int64       `json:"version"`
+	City      string      `json:"city"` // "" for the default
+	BaseFare  money.Money `json:"base_fare"`
+	PerKm     money.Money `json:"per_km"`
+	ChildSeat money.Money `json:"child_seat"` // per child seat
+	Luggage   money.Money `json:"luggage"`    // per started 100 litres
+	NoShowFee money.Money `json:"no_show_fee"`
+	Waiting   money.Money `json:"waiting"` // per started minute paused
+	// CreatedBy is the admin who made this version, or empty when it was
+	// seeded from configuration.
+	CreatedBy *string    `json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	RetiredAt *time.Time `json:"retired_at,omitempty"` // when a newer version replaced it, or it was removed
+}
+
+// Rate returns the formula of r.
+func (r FareRule) Rate() config.Rate {
+	return config.Rate{Base: r.BaseFare, PerKm: r.PerKm, ChildSeat: r.ChildSeat, Luggage: r.Luggage,
+		NoShowFee: r.NoShowFee, Waiting: r.Waiting}
+}
+
+// CommissionRule is one version of the share of a city's fares the
+// platform keeps.
+type CommissionRule struct {
+	Version   int64      `json:"version"`
+	City      string     `json:"city"` // "" for the default
+	Rate      string     `json:"rate"` // percent of the fare, e.g. "20" or "17.5"
+	CreatedBy *string    `json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	RetiredAt *time.Time `json:"retired_at,omitempty"`
+}
+
+// Rules are the rules in force: the default and every city override.
+type Rules struct {
+	Fares       []FareRule       `json:"fares"`
+	Commissions []CommissionRule `json:"commissions"`
+}
+
+// FareRequest is the body for PUT /admin/pricing/fares/{city}. Amounts are
+// decimals in the major unit of Currency; empty surcharges are free.
+type FareRequest struct {
+	Currency  string `json:"currency" validate:"required,maxLength=3"`
+	BaseFare  string `json:"base_fare" validate:"required,maxLength=20"`
+	PerKm     string `json:"per_km" validate:"required,maxLength=20"`
+	ChildSeat string `json:"child_seat" validate:"maxLength=20"`
+	Luggage   string `json:"luggage" validate:"maxLength=20"`
+	NoShowFee string `json:"no_show_fee" validate:"maxLength=20"`
+	Waiting   string `json:"waiting" validate:"maxLength=20"`
+}
+
+// CommissionRequest is the body for PUT /admin/pricing/commissions/{city}.
+type CommissionRequest struct {
+	Rate string `json:"rate" validate:"required,maxLength=6"` // percent, at most two decimals
+}
+
+// Quote is what a trip is priced with: the formula and commission in force
+// for its city, and their versions.
+type Quote struct {
+	Rate              config.Rate
+	PricingVersion    int64
+	CommissionBP      int64 // hundredths of a percent of the fare
+	CommissionVersion int64 // 0 when no commission rule applies
+}
+
+// Commission returns the platform's cut of fare.
+func (q Quote) Commission(fare money.Money) money.Money { return fare.MulRatio(q.CommissionBP, 10000) }
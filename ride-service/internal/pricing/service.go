@@ -0,0 +1,359 @@
+package pricing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/cache"
+	"ride-service/pkg/config"
+	"ride-service/pkg/db"
+	"ride-service/pkg/featureflags"
+	"ride-service/pkg/logging"
+	"ride-service/pkg/money"
+)
+
+var logger = logging.For("pricing")
+
+var (
+	ErrNotFound   = apierror.NotFound("no such rule")
+	ErrNoRules    = apierror.New(http.StatusServiceUnavailable, apierror.CodeUnavailable, "no fare rule is in force")
+	ErrDefault    = apierror.Conflict("the default rule can be replaced but not removed")
+	ErrConcurrent = apierror.Conflict("the rule was changed at the same time; reload and retry")
+	ErrInvalid    = apierror.Validation("invalid rule")
+)
+
+const (
+	fareColumns = `version,city,currency,base_fare_minor,per_km_minor,child_seat_minor,luggage_minor,no_show_fee_minor,
+		waiting_minor,created_by,created_at,retired_at`
+	commissionColumns = `version,city,rate_bp,created_by,created_at,retired_at`
+)
+
+// currentKey caches the rules in force, all in one entry, so any change
+// invalidates one key.
+const currentKey = "current"
+
+// Service keeps the fare and commission rules. Every change is a new
+// version; the rules in force are cached, and each change invalidates them.
+type Service struct {
+	db      *pgxpool.Pool
+	pricing config.Pricing // seeds the rules; its vehicle multipliers still apply
+	current *cache.Cache[Rules]
+
+	// Surge pricing v2; see UseSurge.
+	pressure Pressure
+	flags    *featureflags.Flags
+	surge    config.Surge
+}
+
+// NewService creates a pricing service caching the rules in force in store
+// as sized by cfg.
+func NewService(db *pgxpool.Pool, store cache.Store, pricing config.Pricing, cfg config.Cache) *Service {
+	return &Service{db: db, pricing: pricing, current: cache.New[Rules](store, "pricing:", 1, cfg.LocalTTL, cfg.TTL)}
+}
+
+// Seed writes the configured formulas and commission as the first version
+// of the rules, for tables that are still empty. Run it at startup; once
+// there are rules, configuration no longer changes them.
+func (s *Service) Seed(ctx context.Context) error {
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		var fares, commissions bool
+		if err := tx.QueryRow(ctx,
+			`SELECT EXISTS (SELECT 1 FROM pricing_rules), EXISTS (SELECT 1 FROM commission_rules)`).
+			Scan(&fares, &commissions); err != nil {
+			return err
+		}
+		if !fares {
+			formulas := map[string]config.CityPricing{"": s.pricing.Formula()}
+			for city, cp := range s.pricing.Cities {
+				formulas[strings.TrimSpace(city)] = cp
+			}
+			for city, cp := range formulas {
+				r, err := cp.Rate()
+				if err != nil {
+					return err
+				}
+				if _, err := tx.Exec(ctx,
+					`INSERT INTO pricing_rules (city,currency,base_fare_minor,per_km_minor,child_seat_minor,luggage_minor,
+					                            no_show_fee_minor,waiting_minor)
+					 VALUES ($1,$2,$3,$4,$5,$6,$7,$8) ON CONFLICT DO NOTHING`,
+					city, r.Base.Currency, r.Base.Amount, r.PerKm.Amount, r.ChildSeat.Amount, r.Luggage.Amount,
+					r.NoShowFee.Amount, r.Waiting.Amount); err != nil {
+					return err
+				}
+			}
+			logger.Info("seeded fare rules from configuration", "cities", len(formulas)-1)
+		}
+		if !commissions {
+			bp, err := config.BasisPoints(s.pricing.Commission)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec(ctx,
+				`INSERT INTO commission_rules (city,rate_bp) VALUES ('',$1) ON CONFLICT DO NOTHING`, bp); err != nil {
+				return err
+			}
+			logger.Info("seeded commission rule from configuration", "rate", s.pricing.Commission)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.current.Invalidate(ctx, currentKey)
+	return nil
+}
+
+// Current returns the rules in force.
+func (s *Service) Current(ctx context.Context) (*Rules, error) {
+	rules, err := s.current.Get(ctx, currentKey, func(ctx context.Context) (Rules, error) {
+		fares, err := s.fares(ctx, `WHERE retired_at IS NULL ORDER BY city`)
+		if err != nil {
+			return Rules{}, err
+		}
+		commissions, err := s.commissions(ctx, `WHERE retired_at IS NULL ORDER BY city`)
+		if err != nil {
+			return Rules{}, err
+		}
+		return Rules{Fares: fares, Commissions: commissions}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &rules, nil
+}
+
+// For quotes a trip whose driver is based in city and drives vehicleType:
+// the city's rules, or the default ones, with the distance fare scaled by
+// the vehicle's multiplier.
+func (s *Service) For(ctx context.Context, city, vehicleType string) (Quote, error) {
+	rules, err := s.Current(ctx)
+	if err != nil {
+		return Quote{}, err
+	}
+	var q Quote
+	fare, ok := match(rules.Fares, func(r FareRule) string { return r.City }, city)
+	if !ok {
+		return Quote{}, ErrNoRules
+	}
+	q.Rate, q.PricingVersion = s.pricing.ForVehicle(fare.Rate(), vehicleType), fare.Version
+	if c, ok := match(rules.Commissions, func(r CommissionRule) string { return r.City }, city); ok {
+		q.CommissionBP, _ = config.BasisPoints(c.Rate)
+		q.CommissionVersion = c.Version
+	}
+	return q, nil
+}
+
+// match returns the rule for city, falling back to the default.
+func match[R any](rules []R, cityOf func(R) string, city string) (R, bool) {
+	var def R
+	found := false
+	for _, r := range rules {
+		switch c := cityOf(r); {
+		case c != "" && strings.EqualFold(c, strings.TrimSpace(city)):
+			return r, true
+		case c == "":
+			def, found = r, true
+		}
+	}
+	return def, found
+}
+
+// Version returns the formula of fare rule version, scaled for vehicleType
+// like For, whether or not it is still in force.
+func (s *Service) Version(ctx context.Context, version int64, vehicleType string) (config.Rate, error) {
+	rules, err := s.fares(ctx, `WHERE version=$1`, version)
+	if err != nil {
+		return config.Rate{}, err
+	}
+	if len(rules) == 0 {
+		return config.Rate{}, ErrNotFound
+	}
+	return s.pricing.ForVehicle(rules[0].Rate(), vehicleType), nil
+}
+
+// FareHistory returns every version of city's fare rule, newest first.
+func (s *Service) FareHistory(ctx context.Context, city string) ([]FareRule, error) {
+	return s.fares(ctx, `WHERE LOWER(city)=LOWER($1) ORDER BY version DESC`, stored(city))
+}
+
+// CommissionHistory returns every version of city's commission rule,
+// newest first.
+func (s *Service) CommissionHistory(ctx context.Context, city string) ([]CommissionRule, error) {
+	return s.commissions(ctx, `WHERE LOWER(city)=LOWER($1) ORDER BY version DESC`, stored(city))
+}
+
+// SetFare makes req city's fare formula from now on, as a new version.
+// Trips already priced keep the version they were priced with.
+func (s *Service) SetFare(ctx context.Context, city, adminID string, req FareRequest) (*FareRule, error) {
+	r, err := config.CityPricing{Currency: strings.TrimSpace(req.Currency), BaseFare: req.BaseFare, PerKm: req.PerKm,
+		ChildSeat: req.ChildSeat, Luggage: req.Luggage, NoShowFee: req.NoShowFee, Waiting: req.Waiting}.Rate()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	city = stored(city)
+	var rule *FareRule
+	err = s.replace(ctx, "pricing_rules", city, func(tx pgx.Tx) error {
+		rules, err := scanFares(tx.Query(ctx,
+			`INSERT INTO pricing_rules (city,currency,base_fare_minor,per_km_minor,child_seat_minor,luggage_minor,
+			                            no_show_fee_minor,waiting_minor,created_by)
+			 VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9) RETURNING `+fareColumns,
+			city, r.Base.Currency, r.Base.Amount, r.PerKm.Amount, r.ChildSeat.Amount, r.Luggage.Amount,
+			r.NoShowFee.Amount, r.Waiting.Amount, adminID))
+		if err == nil {
+			rule = &rules[0]
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("fare rule changed", "city", city, "version", rule.Version, "by", adminID)
+	return rule, nil
+}
+
+// SetCommission makes rate city's commission from now on, as a new version.
+func (s *Service) SetCommission(ctx context.Context, city, adminID string, req CommissionRequest) (*CommissionRule, error) {
+	bp, err := config.BasisPoints(req.Rate)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	city = stored(city)
+	var rule *CommissionRule
+	err = s.replace(ctx, "commission_rules", city, func(tx pgx.Tx) error {
+		rules, err := scanCommissions(tx.Query(ctx,
+			`INSERT INTO commission_rules (city,rate_bp,created_by) VALUES ($1,$2,$3) RETURNING `+commissionColumns,
+			city, bp, adminID))
+		if err == nil {
+			rule = &rules[0]
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("commission rule changed", "city", city, "version", rule.Version, "by", adminID)
+	return rule, nil
+}
+
+// RemoveFare retires city's fare override; its trips fall back to the
+// default formula.
+func (s *Service) RemoveFare(ctx context.Context, city string) error {
+	return s.remove(ctx, "pricing_rules", stored(city))
+}
+
+// RemoveCommission retires city's commission override.
+func (s *Service) RemoveCommission(ctx context.Context, city string) error {
+	return s.remove(ctx, "commission_rules", stored(city))
+}
+
+// replace retires city's rule in table, if any, and runs insert for its new
+// version, then drops the cached rules.
+func (s *Service) replace(ctx context.Context, table, city string, insert func(tx pgx.Tx) error) error {
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx,
+			`UPDATE `+table+` SET retired_at=NOW() WHERE LOWER(city)=LOWER($1) AND retired_at IS NULL`, city); err != nil {
+			return err
+		}
+		return insert(tx)
+	})
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrConcurrent
+	}
+	if err != nil {
+		return err
+	}
+	s.current.Invalidate(ctx, currentKey)
+	return nil
+}
+
+func (s *Service) remove(ctx context.Context, table, city string) error {
+	if city == "" {
+		return ErrDefault
+	}
+	tag, err := s.db.Exec(ctx,
+		`UPDATE `+table+` SET retired_at=NOW() WHERE LOWER(city)=LOWER($1) AND retired_at IS NULL`, city)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	s.current.Invalidate(ctx, currentKey)
+	return nil
+}
+
+// stored maps a city in a path to how it is stored: DefaultCity is "".
+func stored(city string) string {
+	city = strings.TrimSpace(city)
+	if strings.EqualFold(city, DefaultCity) {
+		return ""
+	}
+	return city
+}
+
+func (s *Service) fares(ctx context.Context, where string, args ...any) ([]FareRule, error) {
+	return scanFares(s.db.Query(ctx, `SELECT `+fareColumns+` FROM pricing_rules `+where, args...))
+}
+
+func (s *Service) commissions(ctx context.Context, where string, args ...any) ([]CommissionRule, error) {
+	return scanCommissions(s.db.Query(ctx, `SELECT `+commissionColumns+` FROM commission_rules `+where, args...))
+}
+
+func scanFares(rows pgx.Rows, err error) ([]FareRule, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []FareRule{}
+	for rows.Next() {
+		var r FareRule
+		var currency string
+		var base, perKm, childSeat, luggage, noShow, waiting int64
+		if err := rows.Scan(&r.Version, &r.City, &currency, &base, &perKm, &childSeat, &luggage, &noShow, &waiting,
+			&r.CreatedBy, &r.CreatedAt, &r.RetiredAt); err != nil {
+			return nil, err
+		}
+		r.BaseFare, r.PerKm = money.New(base, currency), money.New(perKm, currency)
+		r.ChildSeat, r.Luggage = money.New(childSeat, currency), money.New(luggage, currency)
+		r.NoShowFee, r.Waiting = money.New(noShow, currency), money.New(waiting, currency)
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+func scanCommissions(rows pgx.Rows, err error) ([]CommissionRule, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []CommissionRule{}
+	for rows.Next() {
+		var r CommissionRule
+		var bp int64
+		if err := rows.Scan(&r.Version, &r.City, &bp, &r.CreatedBy, &r.CreatedAt, &r.RetiredAt); err != nil {
+			return nil, err
+		}
+		r.Rate = percent(bp)
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// percent formats basis points as a percentage: 1750 is "17.5".
+func percent(bp int64) string {
+	s := strconv.FormatInt(bp/100, 10)
+	if frac := bp % 100; frac != 0 {
+		s += strings.TrimRight(fmt.Sprintf(".%02d", frac), "0")
+	}
+	return s
+}
@@ -0,0 +1,50 @@
+package pricing
+
+import (
+	"context"
+
+	"ride-service/pkg/config"
+	"ride-service/pkg/featureflags"
+)
+
+// Pressure reports recent ride requests and online drivers in the geohash
+// cell of precision around a point; the heatmap implements it.
+type Pressure interface {
+	Pressure(ctx context.Context, lat, lng float64, precision int) (demand, supply int, err error)
+}
+
+// UseSurge turns on surge pricing v2 for the riders and cities the
+// pricing.surge_v2 flag covers, measured with p and shaped by cfg. Without
+// it quotes never surge.
+func (s *Service) UseSurge(p Pressure, flags *featureflags.Flags, cfg config.Surge) {
+	s.pressure, s.flags, s.surge = p, flags, cfg
+}
+
+// Surge returns the multiplier, in hundredths, a quote riderID asks for in
+// city with a pickup at lat, lng is scaled by: 100 unless surge v2 is on
+// for them. If demand cannot be read the quote does not surge.
+func (s *Service) Surge(ctx context.Context, riderID, city string, lat, lng float64) int64 {
+	if s.pressure == nil || !s.flags.Enabled(featureflags.PricingSurgeV2, featureflags.Subject{ID: riderID, City: city}) {
+		return 100
+	}
+	demand, supply, err := s.pressure.Pressure(ctx, lat, lng, s.surge.Precision)
+	if err != nil {
+		logger.Warn("surge demand lookup failed; quoting without surge", "err", err)
+		return 100
+	}
+	return surgePercent(demand, supply, s.surge.MinDemand, s.surge.MaxPercent())
+}
+
+// surgePercent is demand ÷ supply in hundredths, rounded down to a tenth
+// and kept between 1 and ceiling. A cell with fewer than minDemand requests
+// does not surge; one with requests but no drivers surges to the ceiling.
+func surgePercent(demand, supply, minDemand int, ceiling int64) int64 {
+	if demand < minDemand {
+		return 100
+	}
+	if supply == 0 {
+		return ceiling
+	}
+	pct := int64(demand) * 100 / int64(supply) / 10 * 10
+	return min(max(pct, 100), ceiling)
+}
@@ -0,0 +1,142 @@
+package privacy
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+)
+
+// Handler exposes data exports and erasure requests.
+type Handler struct{ svc *Service }
+
+// NewHandler wires a handler to the privacy service.
+func NewHandler(svc *Service) *Handler { return &Handler{svc: svc} }
+
+// ExportRoutes returns the routes mounted at /users/{id}/export.
+func (h *Handler) ExportRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+
+	r.Get("/", h.Export)
+
+	return r
+}
+
+// ErasureRoutes returns the routes mounted at /users/{id}/erasure.
+func (h *Handler) ErasureRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+
+	r.Post("/", h.Request)
+	r.Get("/", h.Status)
+	r.Delete("/", h.Cancel)
+
+	return r
+}
+
+// AdminRoutes returns the routes mounted under /admin/erasures.
+func (h *Handler) AdminRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth, jwt.RequireRole("admin", "support"))
+
+	r.Get("/", h.List)
+
+	return r
+}
+
+// allowed reports whether the caller may act on rider id: the rider
+// themselves or one of roles.
+func allowed(r *http.Request, id string, roles ...string) bool {
+	claims := jwt.GetClaims(r.Context())
+	if claims.UserID == id {
+		return true
+	}
+	for _, role := range roles {
+		if claims.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Export serves GET /users/{id}/export as a JSON attachment; support and
+// admins may export on a rider's behalf.
+func (h *Handler) Export(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !allowed(r, id, "admin", "support") {
+		apierror.Write(w, apierror.Forbidden("forbidden"))
+		return
+	}
+	e, err := h.svc.Export(r.Context(), id)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="export-%s.json"`, id))
+	apierror.WriteJSON(w, http.StatusOK, e)
+}
+
+func (h *Handler) Request(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !allowed(r, id, "admin") {
+		apierror.Write(w, apierror.Forbidden("forbidden"))
+		return
+	}
+	e, err := h.svc.Request(r.Context(), id, jwt.GetClaims(r.Context()).UserID)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusAccepted, e)
+}
+
+func (h *Handler) Status(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !allowed(r, id, "admin", "support") {
+		apierror.Write(w, apierror.Forbidden("forbidden"))
+		return
+	}
+	e, err := h.svc.Status(r.Context(), id)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, e)
+}
+
+func (h *Handler) Cancel(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !allowed(r, id, "admin") {
+		apierror.Write(w, apierror.Forbidden("forbidden"))
+		return
+	}
+	if err := h.svc.Cancel(r.Context(), id); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]string{"status": "cancelled"})
+}
+
+// List serves GET /admin/erasures?status=&limit=&offset=.
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := 50
+	if v, err := strconv.Atoi(q.Get("limit")); err == nil && v > 0 && v <= 200 {
+		limit = v
+	}
+	offset := 0
+	if v, err := strconv.Atoi(q.Get("offset")); err == nil && v > 0 {
+		offset = v
+	}
+	page, err := h.svc.List(r.Context(), q.Get("status"), limit, offset)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, page)
+}
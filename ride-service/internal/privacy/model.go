@@ -0,0 +1,40 @@
+package privacy
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Export is GET /users/{id}/export: everything kept about a rider, each
+// section the rows of one table as stored. Trips carry the rider's
+// location data, their pickups, drops and stops.
+type Export struct {
+	UserID      string                     `json:"user_id"`
+	GeneratedAt time.Time                  `json:"generated_at"`
+	Profile     json.RawMessage            `json:"profile"`
+	Sections    map[string]json.RawMessage `json:"sections"`
+}
+
+// Erasure statuses. pending → erased, or cancelled by deleting the request.
+const (
+	StatusPending = "pending"
+	StatusErased  = "erased"
+)
+
+// Erasure is a rider's request to erase their personal data.
+type Erasure struct {
+	UserID      string     `json:"user_id"`
+	Status      string     `json:"status"`
+	RequestedBy string     `json:"requested_by"`
+	RequestedAt time.Time  `json:"requested_at"`
+	EraseAfter  time.Time  `json:"erase_after"` // cancellable until then
+	ErasedAt    *time.Time `json:"erased_at,omitempty"`
+}
+
+// Page is a page of GET /admin/erasures, soonest due first.
+type Page struct {
+	Erasures []Erasure `json:"erasures"`
+	Total    int       `json:"total"`
+	Limit    int       `json:"limit"`
+	Offset   int       `json:"offset"`
+}
@@ -0,0 +1,383 @@
+package privacy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/internal/trips/statemachine"
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/blob"
+	"ride-service/pkg/config"
+	"ride-service/pkg/db"
+	"ride-service/pkg/jwt"
+	"ride-service/pkg/logging"
+	"ride-service/pkg/pii"
+)
+
+var logger = logging.For("privacy")
+
+var (
+	ErrNotFound        = apierror.NotFound("rider not found")
+	ErrNoErasure       = apierror.NotFound("no erasure requested")
+	ErrAlreadyPending  = apierror.Conflict("erasure already requested").WithCode("erasure_pending")
+	ErrAlreadyErased   = apierror.Conflict("account already erased").WithCode("erased")
+	ErrActiveTrip      = apierror.Conflict("finish or cancel the active trip first").WithCode("active_trip")
+	ErrNotCancellable  = apierror.Conflict("the account has already been erased")
+	errDeferredErasure = errors.New("rider has an active trip")
+)
+
+// erasedText replaces free text a rider wrote.
+const erasedText = "[erased]"
+
+// sections lists what an export holds besides the profile: for each table,
+// the rows that belong to the rider. Rows others wrote about the rider
+// (driver blocks, staff notes, fraud flags) stay out.
+var sections = []struct{ name, table, where string }{
+	{"trips", "trips", "rider_id=$1"},
+	{"split_participations", "split_participants", "rider_id=$1"},
+	{"charges", "rider_charges", "rider_id=$1"},
+	{"tips", "trip_tips", "rider_id=$1"},
+	{"invoices", "invoices", "rider_id=$1"},
+	{"disputes", "fare_disputes", "rider_id=$1"},
+	{"lost_items", "lost_items", "rider_id=$1"},
+	{"messages", "trip_messages", "sender_id=$1"},
+	{"modifications", "trip_modifications", "requested_by=$1"},
+	{"notification_preferences", "notification_preferences", "user_id=$1"},
+	{"blocks", "blocks", "rider_id=$1 AND blocked_by='rider'"},
+	{"favorite_drivers", "favorite_drivers", "rider_id=$1"},
+	{"emergency_alerts", "emergency_alerts", "rider_id=$1"},
+	{"terms_acceptances", "terms_acceptances", "account_id=$1"},
+	{"recording_consents", "recording_consents", "account_id=$1"},
+	{"fare_quotes", "fare_quotes", "rider_id=$1"},
+	{"support_tickets", "support_tickets", "requester_id=$1"},
+	{"support_ticket_messages", "support_ticket_messages",
+		"ticket_id IN (SELECT id FROM support_tickets WHERE requester_id=$1)"},
+	{"support_ticket_attachments", "support_ticket_attachments", "uploader_id=$1"},
+	{"erasure_requests", "erasure_requests", "user_id=$1"},
+}
+
+// Service exports a rider's data and erases it on request, once the grace
+// period has passed.
+type Service struct {
+	db       *pgxpool.Pool
+	cipher   *pii.Cipher // opens the profile's email and phone for export
+	blobs    blob.Store  // support ticket attachments, deleted on erasure
+	grace    time.Duration
+	onErased func(ctx context.Context, tripID string)
+}
+
+// NewService creates a privacy service with the grace period in cfg.
+func NewService(db *pgxpool.Pool, cipher *pii.Cipher, blobs blob.Store, cfg config.Privacy) *Service {
+	return &Service{db: db, cipher: cipher, blobs: blobs, grace: cfg.ErasureGrace}
+}
+
+// OnErased registers fn to run for each trip of a rider after their data
+// is erased, so cached copies of the trip can be dropped.
+func (s *Service) OnErased(fn func(ctx context.Context, tripID string)) { s.onErased = fn }
+
+// Export returns everything kept about userID.
+func (s *Service) Export(ctx context.Context, userID string) (*Export, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, ErrNotFound
+	}
+	e := &Export{UserID: userID, GeneratedAt: time.Now().UTC(), Sections: make(map[string]json.RawMessage, len(sections))}
+	var profile map[string]any
+	err := s.db.QueryRow(ctx,
+		`SELECT to_jsonb(u) - 'password_hash' - 'email_idx' - 'phone_idx' FROM users u WHERE id=$1`, userID).Scan(&profile)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range []string{pii.Email, pii.Phone} {
+		stored, _ := profile[field].(string)
+		if profile[field], err = s.cipher.Decrypt(field, stored); err != nil {
+			return nil, err
+		}
+	}
+	if e.Profile, err = json.Marshal(profile); err != nil {
+		return nil, err
+	}
+	for _, sec := range sections {
+		var rows json.RawMessage
+		q := fmt.Sprintf(`SELECT COALESCE(jsonb_agg(to_jsonb(x)), '[]'::jsonb) FROM %s x WHERE %s`, sec.table, sec.where)
+		if err := s.db.QueryRow(ctx, q, userID).Scan(&rows); err != nil {
+			return nil, fmt.Errorf("export %s: %w", sec.name, err)
+		}
+		e.Sections[sec.name] = rows
+	}
+	logger.Info("data exported", "user", userID)
+	return e, nil
+}
+
+// Request schedules userID's erasure after the grace period. The account
+// keeps working until then and the request can be cancelled.
+func (s *Service) Request(ctx context.Context, userID, by string) (*Erasure, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, ErrNotFound
+	}
+	var exists bool
+	if err := s.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id=$1)`, userID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+	if cur, err := s.Status(ctx, userID); err == nil {
+		if cur.Status == StatusErased {
+			return nil, ErrAlreadyErased
+		}
+		return nil, ErrAlreadyPending
+	} else if !errors.Is(err, ErrNoErasure) {
+		return nil, err
+	}
+	active, err := s.activeTrip(ctx, s.db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if active {
+		return nil, ErrActiveTrip
+	}
+	tag, err := s.db.Exec(ctx,
+		`INSERT INTO erasure_requests (user_id, requested_by, erase_after) VALUES ($1,$2,$3) ON CONFLICT DO NOTHING`,
+		userID, by, time.Now().Add(s.grace))
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, ErrAlreadyPending
+	}
+	logger.Info("erasure requested", "user", userID, "by", by, "grace", s.grace)
+	return s.Status(ctx, userID)
+}
+
+// Status returns userID's erasure request.
+func (s *Service) Status(ctx context.Context, userID string) (*Erasure, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, ErrNoErasure
+	}
+	e, err := scanErasure(s.db.QueryRow(ctx,
+		`SELECT user_id, requested_by, requested_at, erase_after, erased_at FROM erasure_requests WHERE user_id=$1`, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNoErasure
+	}
+	return e, err
+}
+
+// Cancel withdraws a pending erasure request.
+func (s *Service) Cancel(ctx context.Context, userID string) error {
+	e, err := s.Status(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if e.Status != StatusPending {
+		return ErrNotCancellable
+	}
+	tag, err := s.db.Exec(ctx, `DELETE FROM erasure_requests WHERE user_id=$1 AND erased_at IS NULL`, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotCancellable
+	}
+	logger.Info("erasure cancelled", "user", userID)
+	return nil
+}
+
+// List returns erasure requests, soonest due first, optionally only those
+// with the given status.
+func (s *Service) List(ctx context.Context, status string, limit, offset int) (*Page, error) {
+	switch status {
+	case "", StatusPending, StatusErased:
+	default:
+		return nil, apierror.Validation("status must be pending or erased")
+	}
+	where := `WHERE ($1='' OR ($1='pending' AND erased_at IS NULL) OR ($1='erased' AND erased_at IS NOT NULL))`
+	p := &Page{Erasures: []Erasure{}, Limit: limit, Offset: offset}
+	if err := s.db.QueryRow(ctx, `SELECT COUNT(*) FROM erasure_requests `+where, status).Scan(&p.Total); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(ctx,
+		`SELECT user_id, requested_by, requested_at, erase_after, erased_at FROM erasure_requests `+where+`
+		 ORDER BY erase_after LIMIT $2 OFFSET $3`, status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		e, err := scanErasure(rows)
+		if err != nil {
+			return nil, err
+		}
+		p.Erasures = append(p.Erasures, *e)
+	}
+	return p, rows.Err()
+}
+
+// StartEraser erases the riders whose grace period is over every interval
+// until ctx is cancelled. A rider on a trip is erased once it ends.
+func (s *Service) StartEraser(ctx context.Context, every time.Duration) {
+	go func() {
+		t := time.NewTicker(every)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				s.eraseDue(ctx)
+			}
+		}
+	}()
+}
+
+func (s *Service) eraseDue(ctx context.Context) {
+	rows, err := s.db.Query(ctx,
+		`SELECT user_id FROM erasure_requests WHERE erased_at IS NULL AND erase_after <= NOW() ORDER BY erase_after LIMIT 100`)
+	if err != nil {
+		logger.Error("list due erasures failed", "err", err)
+		return
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		logger.Error("list due erasures failed", "err", err)
+		return
+	}
+	for _, id := range ids {
+		if err := s.erase(ctx, id); err != nil && !errors.Is(err, errDeferredErasure) {
+			logger.Error("erasure failed", "user", id, "err", err)
+		}
+	}
+}
+
+// erase anonymizes userID in one transaction: the profile is overwritten and
+// the account deactivated, trip locations are coarsened to about a kilometre
+// and free text the rider wrote is blanked. Support ticket attachments are
+// deleted, their files once the transaction commits. Trips, charges and
+// invoices stay for accounting, tied to the anonymous account.
+func (s *Service) erase(ctx context.Context, userID string) error {
+	var (
+		erased bool
+		trips  []string
+		files  []string
+	)
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		var due bool
+		err := tx.QueryRow(ctx,
+			`SELECT TRUE FROM erasure_requests
+			 WHERE user_id=$1 AND erased_at IS NULL AND erase_after <= NOW() FOR UPDATE SKIP LOCKED`, userID).Scan(&due)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil // erased or cancelled meanwhile, or another instance has it
+		}
+		if err != nil {
+			return err
+		}
+		active, err := s.activeTrip(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+		if active {
+			return errDeferredErasure
+		}
+		if _, err := tx.Exec(ctx,
+			`UPDATE users SET name='Deleted rider', email='deleted+'||id||'@erased.invalid', phone='erased:'||id,
+			   email_idx=NULL, phone_idx=NULL, password_hash='', deleted_at=COALESCE(deleted_at, NOW())
+			 WHERE id=$1`, userID); err != nil {
+			return err
+		}
+		rows, err := tx.Query(ctx,
+			`UPDATE trips SET pickup_lat=ROUND(pickup_lat::numeric, 2), pickup_lng=ROUND(pickup_lng::numeric, 2),
+			   drop_lat=ROUND(drop_lat::numeric, 2), drop_lng=ROUND(drop_lng::numeric, 2), stops=NULL, cancel_note=NULL
+			 WHERE rider_id=$1 RETURNING id`, userID)
+		if err != nil {
+			return err
+		}
+		if trips, err = pgx.CollectRows(rows, pgx.RowTo[string]); err != nil {
+			return err
+		}
+		for _, q := range []string{
+			`UPDATE trip_modifications SET drop_lat=ROUND(drop_lat::numeric, 2), drop_lng=ROUND(drop_lng::numeric, 2), stops='[]',
+			        prev_drop_lat=ROUND(prev_drop_lat::numeric, 2), prev_drop_lng=ROUND(prev_drop_lng::numeric, 2)
+			 WHERE requested_by=$1`,
+			`UPDATE trip_messages SET body='` + erasedText + `' WHERE sender_id=$1`,
+			`UPDATE support_tickets SET subject='` + erasedText + `' WHERE requester_id=$1`,
+			`UPDATE support_ticket_messages SET body='` + erasedText + `' WHERE author_id=$1`,
+			`UPDATE lost_items SET description='` + erasedText + `' WHERE rider_id=$1`,
+			`UPDATE fare_disputes SET comment='' WHERE rider_id=$1`,
+			`UPDATE fare_quotes SET pickup_lat=ROUND(pickup_lat::numeric, 2), pickup_lng=ROUND(pickup_lng::numeric, 2),
+			   drop_lat=ROUND(drop_lat::numeric, 2), drop_lng=ROUND(drop_lng::numeric, 2) WHERE rider_id=$1`,
+			`UPDATE report_cancellations SET note=NULL WHERE trip_id IN (SELECT id FROM trips WHERE rider_id=$1)`,
+			`DELETE FROM notification_preferences WHERE user_id=$1`,
+			`DELETE FROM favorite_drivers WHERE rider_id=$1`,
+			`DELETE FROM emergency_contacts WHERE rider_id=$1`,
+			`UPDATE route_deviations SET points='[]' WHERE rider_id=$1`,
+			`UPDATE erasure_requests SET erased_at=NOW() WHERE user_id=$1`,
+		} {
+			if _, err := tx.Exec(ctx, q, userID); err != nil {
+				return err
+			}
+		}
+		rows, err = tx.Query(ctx, `DELETE FROM support_ticket_attachments WHERE uploader_id=$1 RETURNING blob_key`, userID)
+		if err != nil {
+			return err
+		}
+		if files, err = pgx.CollectRows(rows, pgx.RowTo[string]); err != nil {
+			return err
+		}
+		erased = true
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !erased {
+		return nil
+	}
+	if err := jwt.Revoke(ctx, userID); err != nil {
+		logger.Warn("token revocation failed", "user", userID, "err", err)
+	}
+	for _, key := range files {
+		if err := s.blobs.Delete(ctx, key); err != nil {
+			logger.Warn("attachment delete failed", "user", userID, "key", key, "err", err)
+		}
+	}
+	if s.onErased != nil {
+		for _, id := range trips {
+			s.onErased(ctx, id)
+		}
+	}
+	logger.Info("rider erased", "user", userID, "trips", len(trips))
+	return nil
+}
+
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func (s *Service) activeTrip(ctx context.Context, q querier, riderID string) (bool, error) {
+	var ok bool
+	err := q.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM trips WHERE rider_id=$1 AND status = ANY($2))`, riderID,
+		[]string{statemachine.Requested, statemachine.Matching, statemachine.DriverAssigned, statemachine.Started}).Scan(&ok)
+	return ok, err
+}
+
+func scanErasure(row pgx.Row) (*Erasure, error) {
+	var e Erasure
+	if err := row.Scan(&e.UserID, &e.RequestedBy, &e.RequestedAt, &e.EraseAfter, &e.ErasedAt); err != nil {
+		return nil, err
+	}
+	e.Status = StatusPending
+	if e.ErasedAt != nil {
+		e.Status = StatusErased
+	}
+	return &e, nil
+}
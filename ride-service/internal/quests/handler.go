@@ -0,0 +1,110 @@
+package quests
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+)
+
+// Handler exposes quest management to admins and quest progress to drivers.
+type Handler struct{ svc *Service }
+
+// NewHandler wires a handler to the quest service.
+func NewHandler(svc *Service) *Handler { return &Handler{svc: svc} }
+
+// AdminRoutes returns the routes mounted under /admin/quests.
+func (h *Handler) AdminRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth, jwt.RequireRole("admin"))
+
+	r.Get("/", h.List)
+	r.Post("/", h.Create)
+	r.Get("/{id}", h.Get)
+	r.Patch("/{id}", h.Update)
+	r.Delete("/{id}", h.Delete)
+
+	return r
+}
+
+// DriverRoutes returns the routes mounted at /drivers/{id}/quests.
+func (h *Handler) DriverRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+	r.Get("/", h.ForDriver)
+	return r
+}
+
+// List serves GET /admin/quests?all=true; without all, ended quests are left out.
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	qs, err := h.svc.List(r.Context(), r.URL.Query().Get("all") == "true")
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]any{"quests": qs})
+}
+
+func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
+	var req QuestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	q, err := h.svc.Create(r.Context(), jwt.GetClaims(r.Context()).UserID, req)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusCreated, q)
+}
+
+func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
+	q, err := h.svc.Get(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, q)
+}
+
+func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
+	var upd QuestUpdate
+	if err := json.NewDecoder(r.Body).Decode(&upd); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	q, err := h.svc.Update(r.Context(), chi.URLParam(r, "id"), upd)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, q)
+}
+
+func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
+	if err := h.svc.Delete(r.Context(), chi.URLParam(r, "id")); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// ForDriver serves GET /drivers/{id}/quests for the driver and staff.
+func (h *Handler) ForDriver(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	claims := jwt.GetClaims(r.Context())
+	if claims == nil || (claims.UserID != id && claims.Role != "admin" && claims.Role != "support") {
+		apierror.Write(w, apierror.Forbidden("forbidden"))
+		return
+	}
+	qs, err := h.svc.ForDriver(r.Context(), id)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]any{"quests": qs})
+}
@@ -0,0 +1,58 @@
+package quests
+
+import (
+	"time"
+
+	"ride-service/pkg/money"
+)
+
+// Quest is an incentive: complete TripsRequired trips between StartsAt and
+// EndsAt for Bonus, credited to the driver's wallet. Empty City and
+// VehicleType apply to every driver.
+type Quest struct {
+	ID            string      `json:"id"`
+	Name          string      `json:"name"`
+	Description   string      `json:"description,omitempty"`
+	City          string      `json:"city,omitempty"`
+	VehicleType   string      `json:"vehicle_type,omitempty"`
+	TripsRequired int         `json:"trips_required"`
+	Bonus         money.Money `json:"bonus"`
+	StartsAt      time.Time   `json:"starts_at"`
+	EndsAt        time.Time   `json:"ends_at"`
+	Active        bool        `json:"active"`
+	CreatedBy     string      `json:"created_by"`
+	CreatedAt     time.Time   `json:"created_at"`
+}
+
+// QuestRequest is the body for POST /admin/quests.
+type QuestRequest struct {
+	Name          string      `json:"name"`
+	Description   string      `json:"description"`
+	City          string      `json:"city"`
+	VehicleType   string      `json:"vehicle_type"`
+	TripsRequired int         `json:"trips_required"`
+	Bonus         money.Money `json:"bonus"`
+	StartsAt      time.Time   `json:"starts_at"`
+	EndsAt        time.Time   `json:"ends_at"`
+}
+
+// QuestUpdate is the body for PATCH /admin/quests/{id}. Omitted fields are
+// left alone.
+type QuestUpdate struct {
+	Name          *string      `json:"name"`
+	Description   *string      `json:"description"`
+	City          *string      `json:"city"`
+	VehicleType   *string      `json:"vehicle_type"`
+	TripsRequired *int         `json:"trips_required"`
+	Bonus         *money.Money `json:"bonus"`
+	StartsAt      *time.Time   `json:"starts_at"`
+	EndsAt        *time.Time   `json:"ends_at"`
+	Active        *bool        `json:"active"`
+}
+
+// DriverQuest is a quest as one driver sees it, with their progress.
+type DriverQuest struct {
+	Quest
+	Trips       int        `json:"trips"`                  // counted so far
+	CompletedAt *time.Time `json:"completed_at,omitempty"` // bonus credited
+}
@@ -0,0 +1,339 @@
+package quests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/internal/events"
+	"ride-service/internal/wallet"
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/db"
+	"ride-service/pkg/eventbus"
+	"ride-service/pkg/logging"
+	"ride-service/pkg/money"
+)
+
+var logger = logging.For("quests")
+
+var (
+	ErrNotFound       = apierror.NotFound("quest not found")
+	ErrDriverNotFound = apierror.NotFound("driver not found")
+	ErrInvalid        = apierror.Validation("invalid quest")
+)
+
+// Limits on what admins can configure.
+const (
+	maxTrips    = 1000
+	maxBonus    = 100000
+	maxDuration = 90 * 24 * time.Hour
+)
+
+// recentlyEnded is how long an ended quest still shows to drivers, so they
+// see how the weekend went.
+const recentlyEnded = 7 * 24 * time.Hour
+
+const questColumns = `id,name,description,city,vehicle_type,trips_required,bonus_minor,currency,starts_at,ends_at,active,created_by,created_at`
+
+// Service manages quests and tracks drivers' progress on them.
+type Service struct {
+	db *pgxpool.Pool
+}
+
+// NewService creates a quest service.
+func NewService(db *pgxpool.Pool) *Service {
+	return &Service{db: db}
+}
+
+// Create adds a quest.
+func (s *Service) Create(ctx context.Context, actorID string, req QuestRequest) (*Quest, error) {
+	q := Quest{
+		Name: req.Name, Description: req.Description, City: req.City, VehicleType: req.VehicleType,
+		TripsRequired: req.TripsRequired, Bonus: req.Bonus, StartsAt: req.StartsAt, EndsAt: req.EndsAt,
+	}
+	if err := check(&q); err != nil {
+		return nil, err
+	}
+	return scanQuest(s.db.QueryRow(ctx,
+		`INSERT INTO quests (id,name,description,city,vehicle_type,trips_required,bonus,bonus_minor,currency,starts_at,ends_at,created_by)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7::numeric,$8,$9,$10,$11,$12) RETURNING `+questColumns,
+		uuid.New().String(), q.Name, q.Description, q.City, q.VehicleType, q.TripsRequired,
+		q.Bonus.Decimal(), q.Bonus.Amount, q.Bonus.Currency, q.StartsAt, q.EndsAt, actorID))
+}
+
+// List returns quests, latest start first. Unless all is set, quests that
+// have ended are left out.
+func (s *Service) List(ctx context.Context, all bool) ([]Quest, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT `+questColumns+` FROM quests
+		 WHERE deleted_at IS NULL AND ($1 OR ends_at > NOW())
+		 ORDER BY starts_at DESC, created_at DESC`, all)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	qs := []Quest{}
+	for rows.Next() {
+		q, err := scanQuest(rows)
+		if err != nil {
+			return nil, err
+		}
+		qs = append(qs, *q)
+	}
+	return qs, rows.Err()
+}
+
+// Get returns one quest.
+func (s *Service) Get(ctx context.Context, id string) (*Quest, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+	q, err := scanQuest(s.db.QueryRow(ctx,
+		`SELECT `+questColumns+` FROM quests WHERE id=$1 AND deleted_at IS NULL`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return q, err
+}
+
+// Update changes the fields set in upd. Progress already made is kept;
+// lowering trips_required pays drivers already past it on their next trip.
+func (s *Service) Update(ctx context.Context, id string, upd QuestUpdate) (*Quest, error) {
+	q, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	setString(&q.Name, upd.Name)
+	setString(&q.Description, upd.Description)
+	setString(&q.City, upd.City)
+	setString(&q.VehicleType, upd.VehicleType)
+	if upd.TripsRequired != nil {
+		q.TripsRequired = *upd.TripsRequired
+	}
+	if upd.Bonus != nil {
+		q.Bonus = *upd.Bonus
+	}
+	if upd.StartsAt != nil {
+		q.StartsAt = *upd.StartsAt
+	}
+	if upd.EndsAt != nil {
+		q.EndsAt = *upd.EndsAt
+	}
+	if upd.Active != nil {
+		q.Active = *upd.Active
+	}
+	if err := check(q); err != nil {
+		return nil, err
+	}
+	q, err = scanQuest(s.db.QueryRow(ctx,
+		`UPDATE quests SET name=$2, description=$3, city=$4, vehicle_type=$5, trips_required=$6,
+		        bonus=$7::numeric, bonus_minor=$8, currency=$9, starts_at=$10, ends_at=$11, active=$12
+		 WHERE id=$1 AND deleted_at IS NULL RETURNING `+questColumns,
+		id, q.Name, q.Description, q.City, q.VehicleType, q.TripsRequired,
+		q.Bonus.Decimal(), q.Bonus.Amount, q.Bonus.Currency, q.StartsAt, q.EndsAt, q.Active))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return q, err
+}
+
+// Delete removes a quest. Bonuses already credited stay in the wallets.
+func (s *Service) Delete(ctx context.Context, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrNotFound
+	}
+	tag, err := s.db.Exec(ctx,
+		`UPDATE quests SET deleted_at=NOW(), active=FALSE WHERE id=$1 AND deleted_at IS NULL`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ForDriver returns the active quests that apply to the driver and have not
+// ended (or ended within the last week), soonest ending first, with the
+// driver's progress.
+func (s *Service) ForDriver(ctx context.Context, driverID string) ([]DriverQuest, error) {
+	if _, err := uuid.Parse(driverID); err != nil {
+		return nil, ErrDriverNotFound
+	}
+	var city, vehicleType string
+	err := s.db.QueryRow(ctx,
+		`SELECT COALESCE(d.city,''), COALESCE(v.type,'')
+		 FROM drivers d LEFT JOIN vehicles v ON v.id=d.active_vehicle_id WHERE d.id=$1`, driverID).Scan(&city, &vehicleType)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrDriverNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(ctx,
+		`SELECT q.id,q.name,q.description,q.city,q.vehicle_type,q.trips_required,q.bonus_minor,q.currency,q.starts_at,q.ends_at,
+		        q.active,q.created_by,q.created_at,COALESCE(p.trips,0),p.completed_at
+		 FROM quests q LEFT JOIN quest_progress p ON p.quest_id=q.id AND p.driver_id=$1
+		 WHERE q.deleted_at IS NULL AND q.active AND q.ends_at > $4
+		   AND (q.city='' OR lower(q.city)=lower($2)) AND (q.vehicle_type='' OR q.vehicle_type=$3)
+		 ORDER BY q.ends_at, q.starts_at`,
+		driverID, city, vehicleType, time.Now().Add(-recentlyEnded))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []DriverQuest{}
+	for rows.Next() {
+		var dq DriverQuest
+		q := &dq.Quest
+		if err := rows.Scan(&q.ID, &q.Name, &q.Description, &q.City, &q.VehicleType, &q.TripsRequired, &q.Bonus.Amount, &q.Bonus.Currency,
+			&q.StartsAt, &q.EndsAt, &q.Active, &q.CreatedBy, &q.CreatedAt, &dq.Trips, &dq.CompletedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, dq)
+	}
+	return out, rows.Err()
+}
+
+// Start consumes trip.completed and counts each trip towards the driver's
+// running quests, crediting the bonus when a quest is reached. Trips are
+// counted once per quest, so failures are returned for the consumer to retry.
+func (s *Service) Start(ctx context.Context, bus eventbus.Bus) {
+	bus.Subscribe(ctx, eventbus.TopicTripCompleted, "quests-trip-completed", func(ctx context.Context, data []byte) error {
+		var ev events.TripCompletedEvent
+		env, err := events.Unwrap(data, &ev)
+		if errors.Is(err, events.ErrUnsupportedVersion) {
+			logger.Warn("skipping event", "event_id", env.EventID, "err", err)
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if _, err := uuid.Parse(ev.TripID); err != nil {
+			logger.Warn("skipping trip.completed with bad trip id", "trip", ev.TripID)
+			return nil
+		}
+		if _, err := uuid.Parse(ev.DriverID); err != nil {
+			logger.Warn("skipping trip.completed with bad driver id", "driver", ev.DriverID)
+			return nil
+		}
+		at, err := time.Parse(time.RFC3339, ev.CompletedAt)
+		if err != nil {
+			at = env.OccurredAt
+		}
+		return s.countTrip(ctx, ev.TripID, ev.DriverID, at)
+	})
+}
+
+// countTrip adds a completed trip to the driver's progress on every quest
+// running at completedAt that applies to them.
+func (s *Service) countTrip(ctx context.Context, tripID, driverID string, completedAt time.Time) error {
+	return db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx,
+			`SELECT q.id,q.name,q.trips_required,q.bonus_minor,q.currency
+			 FROM quests q JOIN drivers d ON d.id=$1 LEFT JOIN vehicles v ON v.id=d.active_vehicle_id
+			 WHERE q.deleted_at IS NULL AND q.active AND $2 >= q.starts_at AND $2 < q.ends_at
+			   AND (q.city='' OR lower(q.city)=lower(COALESCE(d.city,'')))
+			   AND (q.vehicle_type='' OR q.vehicle_type=v.type)`,
+			driverID, completedAt)
+		if err != nil {
+			return err
+		}
+		var running []Quest
+		for rows.Next() {
+			var q Quest
+			if err := rows.Scan(&q.ID, &q.Name, &q.TripsRequired, &q.Bonus.Amount, &q.Bonus.Currency); err != nil {
+				rows.Close()
+				return err
+			}
+			running = append(running, q)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, q := range running {
+			tag, err := tx.Exec(ctx,
+				`INSERT INTO quest_trips (quest_id,trip_id) VALUES ($1,$2) ON CONFLICT DO NOTHING`, q.ID, tripID)
+			if err != nil {
+				return err
+			}
+			if tag.RowsAffected() == 0 {
+				continue // already counted
+			}
+			var trips int
+			var done *time.Time
+			if err := tx.QueryRow(ctx,
+				`INSERT INTO quest_progress (quest_id,driver_id,trips) VALUES ($1,$2,1)
+				 ON CONFLICT (quest_id,driver_id) DO UPDATE SET trips=quest_progress.trips+1, updated_at=NOW()
+				 RETURNING trips, completed_at`,
+				q.ID, driverID).Scan(&trips, &done); err != nil {
+				return err
+			}
+			if done != nil || trips < q.TripsRequired {
+				continue
+			}
+			if _, err := tx.Exec(ctx,
+				`UPDATE quest_progress SET completed_at=NOW() WHERE quest_id=$1 AND driver_id=$2`, q.ID, driverID); err != nil {
+				return err
+			}
+			if _, err := wallet.Credit(ctx, tx, driverID, q.Bonus, wallet.KindQuestBonus,
+				q.ID+":"+driverID, "Quest completed: "+q.Name); err != nil {
+				return err
+			}
+			logger.Info("quest completed", "quest", q.ID, "driver", driverID, "bonus", q.Bonus.String())
+		}
+		return nil
+	})
+}
+
+func scanQuest(row pgx.Row) (*Quest, error) {
+	var q Quest
+	if err := row.Scan(&q.ID, &q.Name, &q.Description, &q.City, &q.VehicleType, &q.TripsRequired, &q.Bonus.Amount, &q.Bonus.Currency,
+		&q.StartsAt, &q.EndsAt, &q.Active, &q.CreatedBy, &q.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
+
+// check trims and validates q in place.
+func check(q *Quest) error {
+	q.Name = strings.TrimSpace(q.Name)
+	q.Description = strings.TrimSpace(q.Description)
+	q.City = strings.TrimSpace(q.City)
+	q.VehicleType = strings.TrimSpace(q.VehicleType)
+	q.Bonus.Currency = strings.ToUpper(q.Bonus.Currency)
+	cur, known := money.Lookup(q.Bonus.Currency)
+	switch {
+	case q.Name == "" || len(q.Name) > 100:
+		return fmt.Errorf("%w: name is required (at most 100 characters)", ErrInvalid)
+	case len(q.Description) > 1000:
+		return fmt.Errorf("%w: description is at most 1000 characters", ErrInvalid)
+	case len(q.City) > 100 || len(q.VehicleType) > 50:
+		return fmt.Errorf("%w: city or vehicle_type too long", ErrInvalid)
+	case q.TripsRequired < 1 || q.TripsRequired > maxTrips:
+		return fmt.Errorf("%w: trips_required must be between 1 and %d", ErrInvalid, maxTrips)
+	case !known:
+		return fmt.Errorf("%w: bonus currency %q is not supported", ErrInvalid, q.Bonus.Currency)
+	case q.Bonus.Amount <= 0 || q.Bonus.Amount > maxBonus*cur.Unit():
+		return fmt.Errorf("%w: bonus must be positive and at most %d %s", ErrInvalid, maxBonus, cur.Code)
+	case q.StartsAt.IsZero() || q.EndsAt.IsZero():
+		return fmt.Errorf("%w: starts_at and ends_at are required", ErrInvalid)
+	case !q.EndsAt.After(q.StartsAt):
+		return fmt.Errorf("%w: ends_at must be after starts_at", ErrInvalid)
+	case q.EndsAt.Sub(q.StartsAt) > maxDuration:
+		return fmt.Errorf("%w: a quest runs at most %d days", ErrInvalid, int(maxDuration.Hours()/24))
+	}
+	return nil
+}
+
+func setString(dst *string, v *string) {
+	if v != nil {
+		*dst = *v
+	}
+}
@@ -0,0 +1,56 @@
+package quotes
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+)
+
+// Handler lets riders get fare estimates and read their quotes.
+type Handler struct{ svc *Service }
+
+// NewHandler wires a handler to the quote service.
+func NewHandler(svc *Service) *Handler { return &Handler{svc: svc} }
+
+// Routes returns the routes mounted at /fares.
+func (h *Handler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+
+	r.With(jwt.RequireRole("rider")).Post("/estimate", h.Estimate)
+	r.Get("/quotes/{quoteID}", h.Get) // the rider, or staff auditing a trip's price
+
+	return r
+}
+
+func (h *Handler) Estimate(w http.ResponseWriter, r *http.Request) {
+	var req EstimateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	q, err := h.svc.Estimate(r.Context(), jwt.GetClaims(r.Context()).UserID, req)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusCreated, q)
+}
+
+func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
+	q, err := h.svc.Get(r.Context(), chi.URLParam(r, "quoteID"))
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	claims := jwt.GetClaims(r.Context())
+	if q.RiderID != claims.UserID && claims.Role != "admin" && claims.Role != "support" {
+		apierror.Write(w, ErrNotFound)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, q)
+}
@@ -0,0 +1,67 @@
+package quotes
+
+import (
+	"time"
+
+	"ride-service/pkg/config"
+	"ride-service/pkg/money"
+)
+
+// Quote is a fare estimate a rider can request a trip with until ExpiresAt.
+// The trip is then priced at Rate, the formula in force when it was quoted,
+// for the distance actually driven: Estimate is what the straight-line route
+// would cost.
+type Quote struct {
+	ID            string      `json:"id"`
+	RiderID       string      `json:"rider_id"`
+	City          string      `json:"city,omitempty"` // empty: the default rule
+	VehicleType   string      `json:"vehicle_type,omitempty"`
+	PickupLat     float64     `json:"pickup_lat"`
+	PickupLng     float64     `json:"pickup_lng"`
+	DropLat       float64     `json:"drop_lat"`
+	DropLng       float64     `json:"drop_lng"`
+	ChildSeats    int         `json:"child_seats,omitempty"`
+	LuggageLitres int         `json:"luggage_litres,omitempty"`
+	DistanceKm    float64     `json:"distance_km"`
+	Estimate      money.Money `json:"estimate"`
+	// PricingVersion is the fare rule Rate comes from, scaled for
+	// VehicleType.
+	PricingVersion int64      `json:"pricing_version"`
+	Rate           QuotedRate `json:"rate"`
+	// Surge is the multiplier the base and distance fare of Rate include,
+	// omitted when none applied. The signature covers the scaled rate.
+	Surge     float64   `json:"surge,omitempty"`
+	Signature string    `json:"signature"` // hex HMAC-SHA256 of the price terms
+	ExpiresAt time.Time `json:"expires_at"`
+	TripID    *string   `json:"trip_id,omitempty"` // the trip requested with it
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// QuotedRate is the fare formula a quote locks in.
+type QuotedRate struct {
+	BaseFare  money.Money `json:"base_fare"`
+	PerKm     money.Money `json:"per_km"`
+	ChildSeat money.Money `json:"child_seat"`
+	Luggage   money.Money `json:"luggage"` // per started 100 litres
+	NoShowFee money.Money `json:"no_show_fee"`
+	Waiting   money.Money `json:"waiting"` // per started minute paused
+}
+
+// Config returns r as the formula trips are priced with.
+func (r QuotedRate) Config() config.Rate {
+	return config.Rate{Base: r.BaseFare, PerKm: r.PerKm, ChildSeat: r.ChildSeat, Luggage: r.Luggage,
+		NoShowFee: r.NoShowFee, Waiting: r.Waiting}
+}
+
+// EstimateRequest is the body for POST /fares/estimate. City picks the fare
+// rule; it defaults to the default rule.
+type EstimateRequest struct {
+	PickupLat     float64 `json:"pickupLat" validate:"required,min=-90,max=90"`
+	PickupLng     float64 `json:"pickupLng" validate:"required,min=-180,max=180"`
+	DropLat       float64 `json:"dropLat" validate:"required,min=-90,max=90"`
+	DropLng       float64 `json:"dropLng" validate:"required,min=-180,max=180"`
+	City          string  `json:"city" validate:"maxLength=100"`
+	VehicleType   string  `json:"vehicleType" validate:"maxLength=50"`
+	ChildSeats    int     `json:"childSeats" validate:"min=0,max=3"`
+	LuggageLitres int     `json:"luggageLitres" validate:"min=0,max=2000"`
+}
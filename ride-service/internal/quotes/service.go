@@ -0,0 +1,236 @@
+// Package quotes issues the fare quotes riders get with an estimate. A quote
+// locks in the fare formula for a few minutes: a trip requested with it is
+// priced at the quoted rate even if the fare rules change before it ends.
+package quotes
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/internal/pricing"
+	"ride-service/internal/trips"
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/config"
+	"ride-service/pkg/db"
+	"ride-service/pkg/logging"
+	"ride-service/pkg/money"
+	"ride-service/pkg/validation"
+)
+
+var logger = logging.For("quotes")
+
+var (
+	ErrNotFound   = apierror.NotFound("fare quote not found")
+	ErrExpired    = apierror.Conflict("the fare quote has expired; get a new estimate").WithCode("quote_expired")
+	ErrUsed       = apierror.Conflict("the fare quote was already used for another trip").WithCode("quote_used")
+	ErrMismatch   = apierror.Validation("the trip does not match the fare quote").WithCode("quote_mismatch")
+	ErrTampered   = apierror.Forbidden("invalid fare quote signature")
+	errNoSecret   = errors.New("quotes: a signing secret is required")
+	errNotClaimed = errors.New("quotes: quote is not used by the trip")
+)
+
+// maxDriftKm is how far a trip's pickup and drop may be from the quoted
+// ones: riders fine-tune the pin after the estimate.
+const maxDriftKm = 1.0
+
+const columns = `id,rider_id,city,vehicle_type,pickup_lat,pickup_lng,drop_lat,drop_lng,child_seats,luggage_litres,
+		distance_km,pricing_version,currency,base_fare_minor,per_km_minor,child_seat_minor,luggage_minor,
+		no_show_fee_minor,waiting_minor,estimate_minor,surge_pct,signature,expires_at,trip_id,created_at`
+
+// Pricer returns the fare formula in force for a city and vehicle type, and
+// the surge a rider's quote there is scaled by, in hundredths.
+type Pricer interface {
+	For(ctx context.Context, city, vehicleType string) (pricing.Quote, error)
+	Surge(ctx context.Context, riderID, city string, lat, lng float64) int64
+}
+
+// Service issues quotes and hands them to the trips requested with them.
+type Service struct {
+	db      *pgxpool.Pool
+	pricing Pricer
+	secret  []byte
+	ttl     time.Duration
+}
+
+// NewService creates a quote service signing quotes valid for cfg.TTL with
+// cfg.Secret.
+func NewService(db *pgxpool.Pool, pricing Pricer, cfg config.FareQuotes) (*Service, error) {
+	if cfg.Secret == "" {
+		return nil, errNoSecret
+	}
+	return &Service{db: db, pricing: pricing, secret: []byte(cfg.Secret), ttl: cfg.TTL}, nil
+}
+
+// Estimate prices the straight-line route of req at the rule in force and
+// issues riderID a quote for it. Under surge the quoted base and distance
+// fare are scaled up, and the trip is then priced at that rate.
+func (s *Service) Estimate(ctx context.Context, riderID string, req EstimateRequest) (*Quote, error) {
+	if err := validation.Struct(req); err != nil {
+		return nil, err
+	}
+	q := &Quote{
+		ID: uuid.NewString(), RiderID: riderID,
+		City: strings.TrimSpace(req.City), VehicleType: strings.ToLower(strings.TrimSpace(req.VehicleType)),
+		PickupLat: req.PickupLat, PickupLng: req.PickupLng, DropLat: req.DropLat, DropLng: req.DropLng,
+		ChildSeats: req.ChildSeats, LuggageLitres: req.LuggageLitres,
+	}
+	if strings.EqualFold(q.City, pricing.DefaultCity) {
+		q.City = ""
+	}
+	p, err := s.pricing.For(ctx, q.City, q.VehicleType)
+	if err != nil {
+		return nil, err
+	}
+	r := p.Rate
+	surge := s.pricing.Surge(ctx, riderID, q.City, q.PickupLat, q.PickupLng)
+	if surge > 100 {
+		r.Base, r.PerKm = r.Base.MulRatio(surge, 100), r.PerKm.MulRatio(surge, 100)
+		q.Surge = float64(surge) / 100
+	}
+	q.PricingVersion = p.PricingVersion
+	q.Rate = QuotedRate{BaseFare: r.Base, PerKm: r.PerKm, ChildSeat: r.ChildSeat, Luggage: r.Luggage,
+		NoShowFee: r.NoShowFee, Waiting: r.Waiting}
+	q.DistanceKm = km(q.PickupLat, q.PickupLng, q.DropLat, q.DropLng)
+	q.Estimate = r.Fare(q.DistanceKm)
+	q.Estimate.Amount += r.ChildSeat.Amount * int64(q.ChildSeats)
+	q.Estimate.Amount += r.Luggage.Amount * int64((q.LuggageLitres+99)/100) // per started 100 litres
+	q.ExpiresAt = time.Now().Add(s.ttl).Truncate(time.Microsecond)
+	q.Signature = s.sign(q)
+
+	err = s.db.QueryRow(ctx,
+		`INSERT INTO fare_quotes (id,rider_id,city,vehicle_type,pickup_lat,pickup_lng,drop_lat,drop_lng,child_seats,
+		                          luggage_litres,distance_km,pricing_version,currency,base_fare_minor,per_km_minor,
+		                          child_seat_minor,luggage_minor,no_show_fee_minor,waiting_minor,estimate_minor,
+		                          surge_pct,signature,expires_at)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21,$22,$23) RETURNING created_at`,
+		q.ID, q.RiderID, q.City, q.VehicleType, q.PickupLat, q.PickupLng, q.DropLat, q.DropLng, q.ChildSeats,
+		q.LuggageLitres, q.DistanceKm, q.PricingVersion, r.Base.Currency, r.Base.Amount, r.PerKm.Amount,
+		r.ChildSeat.Amount, r.Luggage.Amount, r.NoShowFee.Amount, r.Waiting.Amount, q.Estimate.Amount,
+		surge, q.Signature, q.ExpiresAt).
+		Scan(&q.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// Get returns quote id.
+func (s *Service) Get(ctx context.Context, id string) (*Quote, error) {
+	q, err := scanQuote(s.db.QueryRow(ctx, `SELECT `+columns+` FROM fare_quotes WHERE id=$1`, id))
+	if isNotFound(err) {
+		return nil, ErrNotFound
+	}
+	return q, err
+}
+
+// Claim uses quoteID for t, a trip its rider is requesting: the quote must
+// be theirs, unexpired, unused, for the same vehicle type and about the
+// same route. Release it if the trip is then not created.
+func (s *Service) Claim(ctx context.Context, quoteID string, t *trips.Trip) error {
+	return db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		q, err := scanQuote(tx.QueryRow(ctx, `SELECT `+columns+` FROM fare_quotes WHERE id=$1 FOR UPDATE`, quoteID))
+		if isNotFound(err) || err == nil && q.RiderID != t.RiderID {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		switch {
+		case q.TripID != nil:
+			return ErrUsed
+		case !time.Now().Before(q.ExpiresAt):
+			return ErrExpired
+		case !hmac.Equal([]byte(q.Signature), []byte(s.sign(q))):
+			logger.Error("fare quote signature mismatch", "quote", q.ID)
+			return ErrTampered
+		case q.VehicleType != t.VehicleType:
+			return fmt.Errorf("%w: quoted for vehicle type %q", ErrMismatch, q.VehicleType)
+		}
+		if km(q.PickupLat, q.PickupLng, t.PickupLat, t.PickupLng) > maxDriftKm || km(q.DropLat, q.DropLng, t.DropLat, t.DropLng) > maxDriftKm {
+			return fmt.Errorf("%w: pickup and drop must be within %g km of the quoted ones", ErrMismatch, maxDriftKm)
+		}
+		_, err = tx.Exec(ctx, `UPDATE fare_quotes SET trip_id=$1 WHERE id=$2`, t.ID, quoteID)
+		return err
+	})
+}
+
+// Release frees quoteID again after the trip it was claimed for could not
+// be created.
+func (s *Service) Release(ctx context.Context, quoteID, tripID string) {
+	if _, err := s.db.Exec(ctx, `UPDATE fare_quotes SET trip_id=NULL WHERE id=$1 AND trip_id=$2`, quoteID, tripID); err != nil {
+		logger.Warn("fare quote release failed", "quote", quoteID, "trip", tripID, "err", err)
+	}
+}
+
+// Rate returns the formula tripID was quoted at, the fare rule version it
+// comes from and the city it was quoted for ("" for the default rule). The
+// quote's signature is checked again, so a quote changed after it was
+// claimed prices nothing.
+func (s *Service) Rate(ctx context.Context, quoteID, tripID string) (config.Rate, int64, string, error) {
+	q, err := s.Get(ctx, quoteID)
+	if err != nil {
+		return config.Rate{}, 0, "", err
+	}
+	if q.TripID == nil || *q.TripID != tripID {
+		return config.Rate{}, 0, "", errNotClaimed
+	}
+	if !hmac.Equal([]byte(q.Signature), []byte(s.sign(q))) {
+		logger.Error("fare quote signature mismatch", "quote", q.ID, "trip", tripID)
+		return config.Rate{}, 0, "", ErrTampered
+	}
+	return q.Rate.Config(), q.PricingVersion, q.City, nil
+}
+
+// sign returns the hex HMAC-SHA256 of q's price terms: who it is for, what
+// it prices, at which rate, and until when. The route is left out so
+// erasing a rider's data can blur it.
+func (s *Service) sign(q *Quote) string {
+	r := q.Rate
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%s|%s|%s|%s|%d|%s|%d|%d|%d|%d|%d|%d|%d|%d",
+		q.ID, q.RiderID, q.City, q.VehicleType, q.PricingVersion, r.BaseFare.Currency,
+		r.BaseFare.Amount, r.PerKm.Amount, r.ChildSeat.Amount, r.Luggage.Amount, r.NoShowFee.Amount, r.Waiting.Amount,
+		q.Estimate.Amount, q.ExpiresAt.UnixMicro())
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// km is the straight-line distance between two points, measured like a
+// trip's route.
+func km(lat1, lng1, lat2, lng2 float64) float64 {
+	return trips.RouteKm(&trips.Trip{PickupLat: lat1, PickupLng: lng1, DropLat: lat2, DropLng: lng2})
+}
+
+func scanQuote(row pgx.Row) (*Quote, error) {
+	var q Quote
+	var currency string
+	var base, perKm, childSeat, luggage, noShow, waiting, estimate, surge int64
+	if err := row.Scan(&q.ID, &q.RiderID, &q.City, &q.VehicleType, &q.PickupLat, &q.PickupLng, &q.DropLat, &q.DropLng,
+		&q.ChildSeats, &q.LuggageLitres, &q.DistanceKm, &q.PricingVersion, &currency, &base, &perKm, &childSeat,
+		&luggage, &noShow, &waiting, &estimate, &surge, &q.Signature, &q.ExpiresAt, &q.TripID, &q.CreatedAt); err != nil {
+		return nil, err
+	}
+	q.Rate = QuotedRate{BaseFare: money.New(base, currency), PerKm: money.New(perKm, currency),
+		ChildSeat: money.New(childSeat, currency), Luggage: money.New(luggage, currency),
+		NoShowFee: money.New(noShow, currency), Waiting: money.New(waiting, currency)}
+	q.Estimate = money.New(estimate, currency)
+	if surge > 100 {
+		q.Surge = float64(surge) / 100
+	}
+	return &q, nil
+}
+
+func isNotFound(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.Is(err, pgx.ErrNoRows) || errors.As(err, &pgErr) && pgErr.Code == "22P02" // malformed uuid
+}
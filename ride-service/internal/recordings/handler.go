@@ -0,0 +1,102 @@
+package recordings
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+)
+
+// Handler exposes recording consent and registry endpoints.
+type Handler struct{ svc *Service }
+
+// NewHandler wires a handler to the recordings service.
+func NewHandler(svc *Service) *Handler { return &Handler{svc: svc} }
+
+// Routes returns the participant routes, mounted at /trips/{id}/recording.
+func (h *Handler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+
+	r.Get("/consent", h.Status)
+	r.Post("/consent", h.Consent)
+	r.Delete("/consent", h.Revoke)
+	r.Post("/", h.Register)
+
+	return r
+}
+
+// AdminRoutes returns the investigation routes, mounted at
+// /admin/trips/{id}/recordings.
+func (h *Handler) AdminRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+	r.Use(jwt.RequireRole("admin"))
+
+	r.Get("/", h.ListForIncident)
+
+	return r
+}
+
+func (h *Handler) Consent(w http.ResponseWriter, r *http.Request) {
+	claims := jwt.GetClaims(r.Context())
+	c, err := h.svc.Consent(r.Context(), chi.URLParam(r, "id"), claims.UserID)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, c)
+}
+
+func (h *Handler) Revoke(w http.ResponseWriter, r *http.Request) {
+	claims := jwt.GetClaims(r.Context())
+	if err := h.svc.Revoke(r.Context(), chi.URLParam(r, "id"), claims.UserID); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]string{"status": "consent_revoked"})
+}
+
+func (h *Handler) Status(w http.ResponseWriter, r *http.Request) {
+	claims := jwt.GetClaims(r.Context())
+	st, err := h.svc.Status(r.Context(), chi.URLParam(r, "id"), claims.UserID)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, st)
+}
+
+func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
+	claims := jwt.GetClaims(r.Context())
+	var req RegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	rec, err := h.svc.Register(r.Context(), chi.URLParam(r, "id"), claims.UserID, req)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusCreated, rec)
+}
+
+// ListForIncident requires ?incident_id= so every lookup is tied to an investigation.
+func (h *Handler) ListForIncident(w http.ResponseWriter, r *http.Request) {
+	incidentID := r.URL.Query().Get("incident_id")
+	if incidentID == "" {
+		apierror.Write(w, apierror.Validation("incident_id is required"))
+		return
+	}
+	claims := jwt.GetClaims(r.Context())
+	recs, err := h.svc.ListForIncident(r.Context(), chi.URLParam(r, "id"), claims.UserID, incidentID)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]any{"recordings": recs})
+}
@@ -0,0 +1,51 @@
+package recordings
+
+import "time"
+
+// Parties that can consent to recording.
+const (
+	PartyRider  = "rider"
+	PartyDriver = "driver"
+)
+
+// Consent is one party's opt-in to on-device audio recording for a trip.
+type Consent struct {
+	TripID      string     `json:"trip_id"`
+	Party       string     `json:"party"`
+	AccountID   string     `json:"account_id"`
+	ConsentedAt time.Time  `json:"consented_at"`
+	RevokedAt   *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Recording is the registry entry for an audio file kept on a device.
+// The audio itself never reaches the server.
+type Recording struct {
+	ID        string    `json:"id"`
+	TripID    string    `json:"trip_id"`
+	Party     string    `json:"party"`
+	AccountID string    `json:"account_id"`
+	DeviceID  string    `json:"device_id"`
+	StartedAt time.Time `json:"started_at"`
+	EndedAt   time.Time `json:"ended_at"`
+	SizeBytes int64     `json:"size_bytes"`
+	SHA256    string    `json:"sha256"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RegisterRequest is the body for POST /trips/:id/recording.
+type RegisterRequest struct {
+	DeviceID  string    `json:"device_id" validate:"required,maxLength=100"`
+	StartedAt time.Time `json:"started_at" validate:"required"`
+	EndedAt   time.Time `json:"ended_at" validate:"required"`
+	SizeBytes int64     `json:"size_bytes" validate:"required,min=1"`
+	SHA256    string    `json:"sha256" validate:"required,format=sha256"`
+}
+
+// StatusResponse is returned by GET /trips/:id/recording/consent. Rider and
+// Driver are each party's latest consent; History holds every consent given
+// on the trip, oldest first.
+type StatusResponse struct {
+	Rider   *Consent  `json:"rider,omitempty"`
+	Driver  *Consent  `json:"driver,omitempty"`
+	History []Consent `json:"history"`
+}
@@ -0,0 +1,202 @@
+package recordings
+
+import (
+	"context"
+	"errors"
+	"regexp"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/internal/trips"
+	"ride-service/internal/trips/statemachine"
+	"ride-service/pkg/apierror"
+)
+
+var (
+	ErrTripNotFound   = apierror.NotFound("trip not found")
+	ErrNotParticipant = apierror.Forbidden("not a participant in this trip")
+	ErrTripClosed     = apierror.Conflict("trip is no longer active")
+	ErrNoConsent      = apierror.Conflict("recording consent not active for this party")
+	ErrInvalid        = apierror.Validation("invalid recording metadata")
+)
+
+var sha256Hex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// TripReader returns trips; trips.TripRepo implements it.
+type TripReader interface {
+	GetByID(ctx context.Context, id string) (*trips.Trip, error)
+}
+
+// Service manages recording consent and the recording metadata registry.
+type Service struct {
+	db    *pgxpool.Pool
+	trips TripReader
+}
+
+// NewService creates a recordings service.
+func NewService(db *pgxpool.Pool, t TripReader) *Service {
+	return &Service{db: db, trips: t}
+}
+
+// party resolves which side of the trip accountID is on and the trip status.
+func (s *Service) party(ctx context.Context, tripID, accountID string) (string, string, error) {
+	t, err := s.trips.GetByID(ctx, tripID)
+	if errors.Is(err, trips.ErrNotFound) {
+		return "", "", ErrTripNotFound
+	} else if err != nil {
+		return "", "", err
+	}
+	switch {
+	case t.RiderID == accountID:
+		return PartyRider, t.Status, nil
+	case t.DriverID != nil && *t.DriverID == accountID:
+		return PartyDriver, t.Status, nil
+	}
+	return "", "", ErrNotParticipant
+}
+
+// Consent records the caller's opt-in for the trip. Consenting while already
+// consented returns the open consent; re-consenting after a revocation opens
+// a new one and keeps the earlier interval.
+func (s *Service) Consent(ctx context.Context, tripID, accountID string) (*Consent, error) {
+	party, status, err := s.party(ctx, tripID, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if statemachine.Terminal(status) {
+		return nil, ErrTripClosed
+	}
+	c := Consent{TripID: tripID, Party: party, AccountID: accountID}
+	err = s.db.QueryRow(ctx,
+		`INSERT INTO recording_consents (trip_id,party,account_id) VALUES ($1,$2,$3)
+		 ON CONFLICT (trip_id,party) WHERE revoked_at IS NULL DO UPDATE
+		   SET account_id=EXCLUDED.account_id
+		 RETURNING consented_at`,
+		tripID, party, accountID).Scan(&c.ConsentedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Revoke withdraws the caller's consent. Recordings registered before the
+// revocation stay in the registry.
+func (s *Service) Revoke(ctx context.Context, tripID, accountID string) error {
+	party, _, err := s.party(ctx, tripID, accountID)
+	if err != nil {
+		return err
+	}
+	tag, err := s.db.Exec(ctx,
+		`UPDATE recording_consents SET revoked_at=NOW()
+		 WHERE trip_id=$1 AND party=$2 AND revoked_at IS NULL`, tripID, party)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNoConsent
+	}
+	return nil
+}
+
+// Status returns both parties' latest consent for a trip, and every consent
+// either has given, oldest first.
+func (s *Service) Status(ctx context.Context, tripID, accountID string) (*StatusResponse, error) {
+	if _, _, err := s.party(ctx, tripID, accountID); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(ctx,
+		`SELECT trip_id,party,account_id,consented_at,revoked_at
+		 FROM recording_consents WHERE trip_id=$1 ORDER BY consented_at, id`, tripID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	resp := StatusResponse{History: []Consent{}}
+	for rows.Next() {
+		var c Consent
+		if err := rows.Scan(&c.TripID, &c.Party, &c.AccountID, &c.ConsentedAt, &c.RevokedAt); err != nil {
+			return nil, err
+		}
+		resp.History = append(resp.History, c)
+		if c.Party == PartyRider {
+			resp.Rider = &c
+		} else {
+			resp.Driver = &c
+		}
+	}
+	return &resp, rows.Err()
+}
+
+// Register adds a recording's metadata. One of the caller's consents must
+// cover the whole recorded interval: a recording across a revocation and a
+// later re-consent is refused.
+func (s *Service) Register(ctx context.Context, tripID, accountID string, req RegisterRequest) (*Recording, error) {
+	if req.DeviceID == "" || req.SizeBytes <= 0 || !sha256Hex.MatchString(req.SHA256) ||
+		req.StartedAt.IsZero() || !req.EndedAt.After(req.StartedAt) {
+		return nil, ErrInvalid
+	}
+	party, _, err := s.party(ctx, tripID, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	var covered bool
+	err = s.db.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM recording_consents
+		  WHERE trip_id=$1 AND party=$2 AND consented_at <= $3
+		    AND (revoked_at IS NULL OR revoked_at >= $4))`,
+		tripID, party, req.StartedAt, req.EndedAt).Scan(&covered)
+	if err != nil {
+		return nil, err
+	}
+	if !covered {
+		return nil, ErrNoConsent
+	}
+
+	rec := Recording{
+		ID: uuid.New().String(), TripID: tripID, Party: party, AccountID: accountID,
+		DeviceID: req.DeviceID, StartedAt: req.StartedAt, EndedAt: req.EndedAt,
+		SizeBytes: req.SizeBytes, SHA256: req.SHA256,
+	}
+	err = s.db.QueryRow(ctx,
+		`INSERT INTO trip_recordings (id,trip_id,party,account_id,device_id,started_at,ended_at,size_bytes,sha256)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9) RETURNING created_at`,
+		rec.ID, tripID, party, accountID, rec.DeviceID, rec.StartedAt, rec.EndedAt, rec.SizeBytes, rec.SHA256).
+		Scan(&rec.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// ListForIncident returns a trip's recordings to an admin investigating
+// incidentID. The lookup is written to recording_access_log first, so there
+// is no access without a trail.
+func (s *Service) ListForIncident(ctx context.Context, tripID, adminID, incidentID string) ([]Recording, error) {
+	if _, err := s.db.Exec(ctx,
+		`INSERT INTO recording_access_log (trip_id,admin_id,incident_id) VALUES ($1,$2,$3)`,
+		tripID, adminID, incidentID); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(ctx,
+		`SELECT id,trip_id,party,account_id,device_id,started_at,ended_at,size_bytes,sha256,created_at
+		 FROM trip_recordings WHERE trip_id=$1 ORDER BY started_at`, tripID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Recording{}
+	for rows.Next() {
+		var r Recording
+		if err := rows.Scan(&r.ID, &r.TripID, &r.Party, &r.AccountID, &r.DeviceID,
+			&r.StartedAt, &r.EndedAt, &r.SizeBytes, &r.SHA256, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
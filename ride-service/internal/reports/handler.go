@@ -0,0 +1,80 @@
+package reports
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+)
+
+// Handler exposes the reports to admins.
+type Handler struct{ svc *Service }
+
+// NewHandler wires a handler to the reports service.
+func NewHandler(svc *Service) *Handler { return &Handler{svc: svc} }
+
+// AdminRoutes returns the routes mounted under /admin/reports.
+func (h *Handler) AdminRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth, jwt.RequireRole("admin"))
+	r.Get("/daily", h.Daily)
+	r.Get("/cancellations", h.Cancellations)
+	return r
+}
+
+// Daily serves GET /admin/reports/daily?from=&to=&city=.
+func (h *Handler) Daily(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := dateRange(w, r)
+	if !ok {
+		return
+	}
+	report, err := h.svc.Daily(r.Context(), from, to, r.URL.Query().Get("city"))
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, report)
+}
+
+// Cancellations serves GET /admin/reports/cancellations?from=&to=&city=&actor=&top=.
+// top is how many reasons each group lists (default 5).
+func (h *Handler) Cancellations(w http.ResponseWriter, r *http.Request) {
+	from, to, ok := dateRange(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	top := 5
+	if v, err := strconv.Atoi(q.Get("top")); err == nil && v > 0 && v <= 50 {
+		top = v
+	}
+	report, err := h.svc.Cancellations(r.Context(), from, to, q.Get("city"), q.Get("actor"), top)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, report)
+}
+
+// dateRange reads from and to, YYYY-MM-DD (UTC), defaulting to the last
+// seven days. It writes the error and returns false if either is malformed.
+func dateRange(w http.ResponseWriter, r *http.Request) (from, to time.Time, ok bool) {
+	q := r.URL.Query()
+	to = time.Now().UTC().Truncate(24 * time.Hour)
+	from = to.AddDate(0, 0, -6)
+	for name, dst := range map[string]*time.Time{"from": &from, "to": &to} {
+		if raw := q.Get(name); raw != "" {
+			d, err := time.Parse(DateLayout, raw)
+			if err != nil {
+				apierror.Write(w, apierror.Validation(name+" must be a YYYY-MM-DD date"))
+				return from, to, false
+			}
+			*dst = d
+		}
+	}
+	return from, to, true
+}
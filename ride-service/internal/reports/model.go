@@ -0,0 +1,80 @@
+package reports
+
+import "ride-service/pkg/money"
+
+// DateLayout is the format of days in requests and responses.
+const DateLayout = "2006-01-02"
+
+// UnknownCity collects trips whose driver has no city.
+const UnknownCity = "unknown"
+
+// Stats are the figures for one city (or all cities) on one day. Averages and
+// the completion rate are zero when there is nothing to average.
+type Stats struct {
+	City           string `json:"city,omitempty"`
+	TripsMatched   int    `json:"trips_matched"`
+	TripsCompleted int    `json:"trips_completed"`
+	// Revenue and AverageFare have one entry per currency the trips were
+	// priced in.
+	Revenue                []money.Money `json:"revenue"`
+	AverageFare            []money.Money `json:"average_fare"`
+	AverageWaitSeconds     float64       `json:"average_wait_seconds"` // request to pickup
+	AverageDurationSeconds float64       `json:"average_duration_seconds"`
+	// CompletionRate is completed ÷ matched trips.
+	CompletionRate float64 `json:"completion_rate"`
+
+	waitTotal, durationTotal float64
+	waitSamples              int
+	byCurrency               map[string]*tally
+}
+
+// tally is the revenue and completed trips in one currency.
+type tally struct {
+	revenue int64 // minor units
+	trips   int
+}
+
+// Day is one day of the report.
+type Day struct {
+	Date   string  `json:"date"`
+	Cities []Stats `json:"cities"`
+	Total  Stats   `json:"total"`
+}
+
+// ReasonCount is how many cancellations gave one reason. Share is their part
+// of the enclosing group's cancellations.
+type ReasonCount struct {
+	Actor         string  `json:"actor"`
+	Reason        string  `json:"reason"`
+	Cancellations int     `json:"cancellations"`
+	Share         float64 `json:"share"`
+}
+
+// CancellationGroup is the cancellations by one actor or in one city, with
+// the reasons given most.
+type CancellationGroup struct {
+	Actor         string        `json:"actor,omitempty"`
+	City          string        `json:"city,omitempty"`
+	Cancellations int           `json:"cancellations"`
+	Reasons       []ReasonCount `json:"reasons"`
+}
+
+// CancellationReport is the response for GET /admin/reports/cancellations.
+// Groups and reasons come most cancellations first.
+type CancellationReport struct {
+	From          string              `json:"from"`
+	To            string              `json:"to"`
+	Cancellations int                 `json:"cancellations"`
+	Reasons       []ReasonCount       `json:"reasons"`
+	ByActor       []CancellationGroup `json:"by_actor"`
+	ByCity        []CancellationGroup `json:"by_city"`
+}
+
+// Report is the response for GET /admin/reports/daily. Days without trips are
+// left out.
+type Report struct {
+	From  string `json:"from"`
+	To    string `json:"to"`
+	Days  []Day  `json:"days"`
+	Total Stats  `json:"total"` // the whole range
+}
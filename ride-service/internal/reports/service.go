@@ -0,0 +1,417 @@
+package reports
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/internal/events"
+	"ride-service/internal/trips"
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/eventbus"
+	"ride-service/pkg/logging"
+	"ride-service/pkg/money"
+)
+
+var logger = logging.For("reports")
+
+var ErrInvalid = apierror.Validation("invalid report range")
+
+// maxDays caps the range of one report.
+const maxDays = 366
+
+// Actors are who may cancel a trip, as recorded by the trips service.
+var Actors = []string{trips.ActorRider, trips.ActorDriver, trips.ActorSystem}
+
+// Service keeps the daily rollups and reads reports from them.
+type Service struct {
+	db *pgxpool.Pool
+}
+
+// NewService creates a reports service.
+func NewService(db *pgxpool.Pool) *Service {
+	return &Service{db: db}
+}
+
+// Start consumes driver.assigned (for the matched count), trip.completed
+// and fare.adjusted into daily_trip_stats, and trip.cancelled into
+// report_cancellations. Each trip is counted once per kind, so handler
+// failures are returned for the consumer to retry and dead-letter, and a
+// replay is harmless.
+func (s *Service) Start(ctx context.Context, bus eventbus.Bus) {
+	bus.Subscribe(ctx, eventbus.TopicDriverAssigned, "reports-driver-assigned", func(ctx context.Context, data []byte) error {
+		var ev events.DriverAssignedEvent
+		env, err := events.Unwrap(data, &ev)
+		if errors.Is(err, events.ErrUnsupportedVersion) {
+			logger.Warn("skipping event", "event_id", env.EventID, "err", err)
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !validIDs(ev.TripID, ev.DriverID) {
+			logger.Warn("skipping driver.assigned with bad ids", "trip", ev.TripID, "driver", ev.DriverID)
+			return nil
+		}
+		day := env.OccurredAt
+		if day.IsZero() {
+			day = time.Now()
+		}
+		_, err = s.db.Exec(ctx,
+			`WITH fresh AS (
+			   INSERT INTO report_trip_events (trip_id,kind) VALUES ($1,'matched') ON CONFLICT DO NOTHING RETURNING trip_id)
+			 INSERT INTO daily_trip_stats (day,city,trips_matched)
+			 SELECT $2::date, COALESCE(NULLIF(d.city,''),$4), 1
+			 FROM fresh LEFT JOIN drivers d ON d.id=$3
+			 ON CONFLICT (day,city) DO UPDATE
+			 SET trips_matched=daily_trip_stats.trips_matched+1, updated_at=NOW()`,
+			ev.TripID, day.UTC().Format(DateLayout), ev.DriverID, UnknownCity)
+		return err
+	})
+
+	bus.Subscribe(ctx, eventbus.TopicTripCompleted, "reports-trip-completed", func(ctx context.Context, data []byte) error {
+		var ev events.TripCompletedEvent
+		env, err := events.Unwrap(data, &ev)
+		if errors.Is(err, events.ErrUnsupportedVersion) {
+			logger.Warn("skipping event", "event_id", env.EventID, "err", err)
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !validIDs(ev.TripID) {
+			logger.Warn("skipping trip.completed with bad id", "trip", ev.TripID)
+			return nil
+		}
+		day, err := time.Parse(time.RFC3339, ev.CompletedAt)
+		if err != nil {
+			day = env.OccurredAt
+		}
+		fare := ev.FareAmount()
+		// Wait time and city come from the trip row: the event carries neither.
+		// A city keeps one currency per day; revenue is summed in the first
+		// one seen, so change a city's currency at midnight UTC.
+		// Manually assigned trips never pass through driver.assigned, so they
+		// count as matched here.
+		_, err = s.db.Exec(ctx,
+			`WITH fresh AS (
+			   INSERT INTO report_trip_events (trip_id,kind) VALUES ($1,'completed') ON CONFLICT DO NOTHING RETURNING trip_id),
+			 matched AS (
+			   INSERT INTO report_trip_events (trip_id,kind) SELECT trip_id,'matched' FROM fresh ON CONFLICT DO NOTHING RETURNING trip_id),
+			 t AS (
+			   SELECT COALESCE(NULLIF(d.city,''),$5) AS city,
+			          GREATEST(EXTRACT(EPOCH FROM tr.started_at-tr.requested_at),0)::bigint AS wait
+			   FROM fresh LEFT JOIN trips tr ON tr.id=fresh.trip_id LEFT JOIN drivers d ON d.id=tr.driver_id)
+			 INSERT INTO daily_trip_stats (day,city,trips_matched,trips_completed,revenue,revenue_minor,currency,total_wait_seconds,wait_samples,total_duration_seconds)
+			 SELECT $2::date, city, (SELECT COUNT(*) FROM matched), 1, $6::numeric, $3, $7, COALESCE(wait,0), CASE WHEN wait IS NULL THEN 0 ELSE 1 END, $4 FROM t
+			 ON CONFLICT (day,city) DO UPDATE
+			 SET trips_matched=daily_trip_stats.trips_matched+EXCLUDED.trips_matched,
+			     trips_completed=daily_trip_stats.trips_completed+1,
+			     revenue=daily_trip_stats.revenue+EXCLUDED.revenue,
+			     revenue_minor=daily_trip_stats.revenue_minor+EXCLUDED.revenue_minor,
+			     currency=COALESCE(daily_trip_stats.currency,EXCLUDED.currency),
+			     total_wait_seconds=daily_trip_stats.total_wait_seconds+EXCLUDED.total_wait_seconds,
+			     wait_samples=daily_trip_stats.wait_samples+EXCLUDED.wait_samples,
+			     total_duration_seconds=daily_trip_stats.total_duration_seconds+EXCLUDED.total_duration_seconds,
+			     updated_at=NOW()`,
+			ev.TripID, day.UTC().Format(DateLayout), fare.Amount, ev.DurationSeconds, UnknownCity, fare.Decimal(), fare.Currency)
+		return err
+	})
+
+	bus.Subscribe(ctx, eventbus.TopicFareAdjusted, "reports-fare-adjusted", func(ctx context.Context, data []byte) error {
+		var ev events.FareAdjustedEvent
+		env, err := events.Unwrap(data, &ev)
+		if errors.Is(err, events.ErrUnsupportedVersion) {
+			logger.Warn("skipping event", "event_id", env.EventID, "err", err)
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if !validIDs(ev.TripID) {
+			logger.Warn("skipping fare.adjusted with bad id", "trip", ev.TripID)
+			return nil
+		}
+		// The difference goes to the day and city the trip's revenue was
+		// counted under, so wait for trip.completed to be counted first.
+		var counted bool
+		if err := s.db.QueryRow(ctx,
+			`SELECT EXISTS (SELECT 1 FROM report_trip_events WHERE trip_id=$1 AND kind='completed')`,
+			ev.TripID).Scan(&counted); err != nil {
+			return err
+		}
+		if !counted {
+			return fmt.Errorf("reports: trip %s adjusted before its completion was counted", ev.TripID)
+		}
+		diff := money.New(ev.NewFareMinor-ev.OldFareMinor, ev.Currency)
+		_, err = s.db.Exec(ctx,
+			`WITH fresh AS (
+			   INSERT INTO report_trip_events (trip_id,kind) VALUES ($1,'adjusted') ON CONFLICT DO NOTHING RETURNING trip_id)
+			 UPDATE daily_trip_stats s
+			 SET revenue=s.revenue+$3::numeric, revenue_minor=s.revenue_minor+$2, updated_at=NOW()
+			 FROM fresh JOIN trips tr ON tr.id=fresh.trip_id LEFT JOIN drivers d ON d.id=tr.driver_id
+			 WHERE s.day=(tr.completed_at AT TIME ZONE 'UTC')::date AND s.city=COALESCE(NULLIF(d.city,''),$4)`,
+			ev.TripID, diff.Amount, diff.Decimal(), UnknownCity)
+		return err
+	})
+
+	bus.Subscribe(ctx, eventbus.TopicTripCancelled, "reports-trip-cancelled", func(ctx context.Context, data []byte) error {
+		var ev events.TripCancelledEvent
+		env, err := events.Unwrap(data, &ev)
+		if errors.Is(err, events.ErrUnsupportedVersion) {
+			logger.Warn("skipping event", "event_id", env.EventID, "err", err)
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if ev.CancelReason == "" { // a declined offer or superseded match
+			return nil
+		}
+		if !validIDs(ev.TripID) || ev.DriverID != "" && !validIDs(ev.DriverID) {
+			logger.Warn("skipping trip.cancelled with bad ids", "trip", ev.TripID, "driver", ev.DriverID)
+			return nil
+		}
+		day, err := time.Parse(time.RFC3339, ev.CancelledAt)
+		if err != nil {
+			day = env.OccurredAt
+		}
+		// Trips have no city of their own: a cancellation goes to the city
+		// of the driver, or of the last driver offered the trip.
+		_, err = s.db.Exec(ctx,
+			`INSERT INTO report_cancellations (event_id,trip_id,day,city,actor,reason,note)
+			 SELECT $1, $2, $3::date, COALESCE(NULLIF(d.city,''),$8), $4, $5, NULLIF($6,'')
+			 FROM (SELECT COALESCE(NULLIF($7,'')::uuid,
+			                       (SELECT driver_id FROM driver_offers WHERE trip_id=$2 ORDER BY offered_at DESC LIMIT 1)) AS id) o
+			 LEFT JOIN drivers d ON d.id=o.id
+			 ON CONFLICT (event_id) DO NOTHING`,
+			env.EventID, ev.TripID, day.UTC().Format(DateLayout), ev.Actor, ev.CancelReason, ev.CancelNote,
+			ev.DriverID, UnknownCity)
+		return err
+	})
+}
+
+func validIDs(ids ...string) bool {
+	for _, id := range ids {
+		if _, err := uuid.Parse(id); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Daily returns the report for the days from..to (inclusive, UTC), optionally
+// for one city.
+func (s *Service) Daily(ctx context.Context, from, to time.Time, city string) (*Report, error) {
+	if err := checkRange(from, to); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(ctx,
+		`SELECT day,city,trips_matched,trips_completed,revenue_minor,COALESCE(currency,''),total_wait_seconds,wait_samples,total_duration_seconds
+		 FROM daily_trip_stats
+		 WHERE day BETWEEN $1::date AND $2::date AND ($3='' OR lower(city)=lower($3))
+		 ORDER BY day, city`,
+		from.Format(DateLayout), to.Format(DateLayout), city)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	r := &Report{From: from.Format(DateLayout), To: to.Format(DateLayout), Days: []Day{}}
+	var day *Day
+	for rows.Next() {
+		var d time.Time
+		var st Stats
+		var revenue, wait, duration int64
+		var currency string
+		if err := rows.Scan(&d, &st.City, &st.TripsMatched, &st.TripsCompleted, &revenue, &currency,
+			&wait, &st.waitSamples, &duration); err != nil {
+			return nil, err
+		}
+		if currency != "" {
+			st.byCurrency = map[string]*tally{currency: {revenue: revenue, trips: st.TripsCompleted}}
+		}
+		st.waitTotal, st.durationTotal = float64(wait), float64(duration)
+		if date := d.Format(DateLayout); day == nil || day.Date != date {
+			r.Days = append(r.Days, Day{Date: date, Cities: []Stats{}})
+			day = &r.Days[len(r.Days)-1]
+		}
+		day.Total.add(st)
+		r.Total.add(st)
+		st.finish()
+		day.Cities = append(day.Cities, st)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range r.Days {
+		r.Days[i].Total.finish()
+	}
+	r.Total.finish()
+	return r, nil
+}
+
+// Cancellations returns the cancellations of the days from..to (inclusive,
+// UTC), optionally for one city or actor, with the top reasons overall, per
+// actor and per city.
+func (s *Service) Cancellations(ctx context.Context, from, to time.Time, city, actor string, top int) (*CancellationReport, error) {
+	if err := checkRange(from, to); err != nil {
+		return nil, err
+	}
+	if actor != "" && !slices.Contains(Actors, actor) {
+		return nil, fmt.Errorf("%w: actor must be rider, driver or system", ErrInvalid)
+	}
+	rows, err := s.db.Query(ctx,
+		`SELECT city, actor, reason, COUNT(*) FROM report_cancellations
+		 WHERE day BETWEEN $1::date AND $2::date AND ($3='' OR lower(city)=lower($3)) AND ($4='' OR actor=$4)
+		 GROUP BY city, actor, reason`,
+		from.Format(DateLayout), to.Format(DateLayout), city, actor)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	all := &tallies{}
+	actors, cities := map[string]*tallies{}, map[string]*tallies{}
+	for rows.Next() {
+		var c ReasonCount
+		var city string
+		if err := rows.Scan(&city, &c.Actor, &c.Reason, &c.Cancellations); err != nil {
+			return nil, err
+		}
+		for _, t := range []*tallies{all, group(actors, c.Actor), group(cities, city)} {
+			t.add(c)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	r := &CancellationReport{From: from.Format(DateLayout), To: to.Format(DateLayout),
+		Cancellations: all.total, Reasons: all.top(top)}
+	r.ByActor = groups(actors, top, func(g *CancellationGroup, key string) { g.Actor = key })
+	r.ByCity = groups(cities, top, func(g *CancellationGroup, key string) { g.City = key })
+	return r, nil
+}
+
+// tallies counts the cancellations of one group by actor and reason.
+type tallies struct {
+	total   int
+	reasons map[[2]string]int
+}
+
+func (t *tallies) add(c ReasonCount) {
+	if t.reasons == nil {
+		t.reasons = map[[2]string]int{}
+	}
+	t.reasons[[2]string{c.Actor, c.Reason}] += c.Cancellations
+	t.total += c.Cancellations
+}
+
+// top returns the n reasons given most.
+func (t *tallies) top(n int) []ReasonCount {
+	out := make([]ReasonCount, 0, len(t.reasons))
+	for k, count := range t.reasons {
+		out = append(out, ReasonCount{Actor: k[0], Reason: k[1], Cancellations: count,
+			Share: round2(float64(count) / float64(t.total))})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Cancellations != out[j].Cancellations {
+			return out[i].Cancellations > out[j].Cancellations
+		}
+		if out[i].Actor != out[j].Actor {
+			return out[i].Actor < out[j].Actor
+		}
+		return out[i].Reason < out[j].Reason
+	})
+	if len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+func group(m map[string]*tallies, key string) *tallies {
+	if m[key] == nil {
+		m[key] = &tallies{}
+	}
+	return m[key]
+}
+
+// groups turns m into groups, most cancellations first, labelled by label.
+func groups(m map[string]*tallies, top int, label func(*CancellationGroup, string)) []CancellationGroup {
+	out := make([]CancellationGroup, 0, len(m))
+	for key, t := range m {
+		g := CancellationGroup{Cancellations: t.total, Reasons: t.top(top)}
+		label(&g, key)
+		out = append(out, g)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Cancellations != out[j].Cancellations {
+			return out[i].Cancellations > out[j].Cancellations
+		}
+		return out[i].Actor+out[i].City < out[j].Actor+out[j].City
+	})
+	return out
+}
+
+// checkRange rejects a report range that is backwards or too long.
+func checkRange(from, to time.Time) error {
+	if to.Before(from) {
+		return fmt.Errorf("%w: from is after to", ErrInvalid)
+	}
+	if to.Sub(from) >= maxDays*24*time.Hour {
+		return fmt.Errorf("%w: at most %d days", ErrInvalid, maxDays)
+	}
+	return nil
+}
+
+// add accumulates o's counts and totals into st.
+func (st *Stats) add(o Stats) {
+	st.TripsMatched += o.TripsMatched
+	st.TripsCompleted += o.TripsCompleted
+	for c, t := range o.byCurrency {
+		if st.byCurrency == nil {
+			st.byCurrency = map[string]*tally{}
+		}
+		if st.byCurrency[c] == nil {
+			st.byCurrency[c] = &tally{}
+		}
+		st.byCurrency[c].revenue += t.revenue
+		st.byCurrency[c].trips += t.trips
+	}
+	st.waitTotal += o.waitTotal
+	st.waitSamples += o.waitSamples
+	st.durationTotal += o.durationTotal
+}
+
+// finish computes the averages and rate from the totals.
+func (st *Stats) finish() {
+	st.Revenue, st.AverageFare = []money.Money{}, []money.Money{}
+	currencies := make([]string, 0, len(st.byCurrency))
+	for c := range st.byCurrency {
+		currencies = append(currencies, c)
+	}
+	sort.Strings(currencies)
+	for _, c := range currencies {
+		t := st.byCurrency[c]
+		total := money.New(t.revenue, c)
+		st.Revenue = append(st.Revenue, total)
+		if t.trips > 0 {
+			st.AverageFare = append(st.AverageFare, total.MulRatio(1, int64(t.trips)))
+		}
+	}
+	if st.TripsCompleted > 0 {
+		st.AverageDurationSeconds = round2(st.durationTotal / float64(st.TripsCompleted))
+	}
+	if st.waitSamples > 0 {
+		st.AverageWaitSeconds = round2(st.waitTotal / float64(st.waitSamples))
+	}
+	if st.TripsMatched > 0 {
+		st.CompletionRate = round2(float64(st.TripsCompleted) / float64(st.TripsMatched))
+	}
+}
+
+func round2(v float64) float64 { return math.Round(v*100) / 100 }
@@ -0,0 +1,35 @@
+package routemonitor
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+)
+
+// Handler lets staff review the deviations recorded on a trip.
+type Handler struct{ svc *Service }
+
+// NewHandler wires a handler to the route monitor.
+func NewHandler(svc *Service) *Handler { return &Handler{svc: svc} }
+
+// AdminRoutes returns the routes mounted at /admin/trips/{id}/deviations.
+func (h *Handler) AdminRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth, jwt.RequireRole("admin", "support"))
+
+	r.Get("/", h.Trip)
+
+	return r
+}
+
+func (h *Handler) Trip(w http.ResponseWriter, r *http.Request) {
+	l, err := h.svc.Trip(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, l)
+}
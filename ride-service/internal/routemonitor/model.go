@@ -0,0 +1,29 @@
+package routemonitor
+
+import "time"
+
+// Point is one driver ping.
+type Point struct {
+	Lat float64   `json:"lat"`
+	Lng float64   `json:"lng"`
+	TS  time.Time `json:"ts"`
+}
+
+// Deviation is a stretch of a started trip the driver spent off its planned
+// route: pickup → approved stops → drop, widened by the corridor.
+type Deviation struct {
+	ID         string     `json:"id"`
+	TripID     string     `json:"trip_id"`
+	DriverID   string     `json:"driver_id"`
+	RiderID    string     `json:"rider_id"`
+	StartedAt  time.Time  `json:"started_at"`         // first ping off the route
+	DetectedAt time.Time  `json:"detected_at"`        // when it had lasted long enough to alert
+	EndedAt    *time.Time `json:"ended_at,omitempty"` // back on the route, or the trip ended; nil while ongoing
+	MaxKm      float64    `json:"max_km"`             // furthest from the route
+	Points     []Point    `json:"points"`             // the off-route trace, oldest first
+}
+
+// List is the body of GET /admin/trips/{id}/deviations.
+type List struct {
+	Deviations []Deviation `json:"deviations"`
+}
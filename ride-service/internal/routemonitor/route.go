@@ -0,0 +1,45 @@
+package routemonitor
+
+import (
+	"math"
+
+	"ride-service/internal/events"
+)
+
+const earthKm = 6371.0
+
+// offRouteKm is how far p is from the nearest leg of route, a polyline of
+// straight legs. Legs are short enough to flatten around p.
+func offRouteKm(p Point, route []events.LatLng) float64 {
+	if len(route) == 1 {
+		x, y := project(p, route[0])
+		return math.Hypot(x, y)
+	}
+	best := math.Inf(1)
+	for i := 1; i < len(route); i++ {
+		ax, ay := project(p, route[i-1])
+		bx, by := project(p, route[i])
+		best = min(best, toSegmentKm(ax, ay, bx, by))
+	}
+	return best
+}
+
+// project returns q in kilometres east and north of p.
+func project(p Point, q events.LatLng) (x, y float64) {
+	rad := math.Pi / 180
+	x = (q.Lng - p.Lng) * rad * math.Cos(p.Lat*rad) * earthKm
+	y = (q.Lat - p.Lat) * rad * earthKm
+	return x, y
+}
+
+// toSegmentKm is the distance from the origin to the segment a–b.
+func toSegmentKm(ax, ay, bx, by float64) float64 {
+	dx, dy := bx-ax, by-ay
+	t := 0.0
+	if l := dx*dx + dy*dy; l > 0 {
+		t = min(max(-(ax*dx+ay*dy)/l, 0), 1)
+	}
+	return math.Hypot(ax+t*dx, ay+t*dy)
+}
+
+func round2(v float64) float64 { return math.Round(v*100) / 100 }
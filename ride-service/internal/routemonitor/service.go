@@ -0,0 +1,312 @@
+// Package routemonitor watches drivers on a started trip and tells when one
+// leaves the planned route for long enough to worry about: the stretch is
+// recorded, the trip queued for review and listeners (the rider's
+// notifications, their emergency contacts) told.
+package routemonitor
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/internal/events"
+	"ride-service/internal/trips"
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/config"
+	"ride-service/pkg/logging"
+)
+
+var logger = logging.For("routemonitor")
+
+var ErrTripNotFound = apierror.NotFound("trip not found")
+
+// maxPings caps the pings kept per driver between checks; older ones are
+// dropped first.
+const maxPings = 200
+
+// Reviewer queues a trip whose driver left the route for staff to review.
+// Queuing the same trip again must do nothing.
+type Reviewer interface {
+	FlagDeviation(ctx context.Context, tripID, driverID, riderID, deviationID string, maxKm float64, startedAt time.Time) error
+}
+
+// Listener is told about a deviation once, when it is detected. Listeners
+// handle their own errors.
+type Listener func(ctx context.Context, d Deviation)
+
+// track is where a driver stands against their trip's route.
+type track struct {
+	tripID   string
+	off      *Deviation // the stretch off the route so far; nil while on it
+	recorded bool       // off is stored and was alerted
+	dirty    bool       // off has points not stored yet
+}
+
+// Service buffers the location pings of online drivers and, every
+// Interval, checks those of drivers on a started trip against its route.
+// Each instance checks the pings it received, so with several instances a
+// deviation is seen by the one most of the driver's pings reach.
+type Service struct {
+	db        *pgxpool.Pool
+	review    Reviewer
+	cfg       config.RouteMonitor
+	listeners []Listener
+
+	mu    sync.Mutex
+	pings map[string][]Point // by driver, since the last check
+
+	tracks map[string]*track // by driver; only the check loop uses it
+}
+
+// NewService creates a route monitor. Start it to begin checking.
+func NewService(db *pgxpool.Pool, review Reviewer, cfg config.RouteMonitor) *Service {
+	return &Service{db: db, review: review, cfg: cfg, pings: map[string][]Point{}, tracks: map[string]*track{}}
+}
+
+// OnDeviation adds listeners told about each deviation detected. Call it
+// before Start.
+func (s *Service) OnDeviation(fns ...Listener) { s.listeners = append(s.listeners, fns...) }
+
+// DriverMoved buffers an online driver's location update for the next
+// check.
+func (s *Service) DriverMoved(_ context.Context, driverID string, lat, lng float64) {
+	if s.cfg.Interval <= 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := append(s.pings[driverID], Point{Lat: lat, Lng: lng, TS: time.Now().UTC()})
+	if len(p) > maxPings {
+		p = p[len(p)-maxPings:]
+	}
+	s.pings[driverID] = p
+}
+
+// DriverLeft drops the driver's unchecked pings. A deviation in progress
+// stays open until they are back on the route or the trip ends.
+func (s *Service) DriverLeft(_ context.Context, driverID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pings, driverID)
+}
+
+// Start checks the buffered pings every Interval until ctx is done.
+func (s *Service) Start(ctx context.Context) {
+	if s.cfg.Interval <= 0 {
+		return
+	}
+	go func() {
+		t := time.NewTicker(s.cfg.Interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				if err := s.check(ctx); err != nil && ctx.Err() == nil {
+					logger.Error("route check failed", "err", err)
+				}
+			}
+		}
+	}()
+	logger.Info("route monitor started", "interval", s.cfg.Interval, "corridor_km", s.cfg.CorridorKm, "after", s.cfg.DeviationAfter)
+}
+
+// check follows every driver with new pings or a track along their started
+// trip. A driver whose trip ended, or who moved on to another, closes the
+// old trip's deviation.
+func (s *Service) check(ctx context.Context) error {
+	s.mu.Lock()
+	pings := s.pings
+	s.pings = map[string][]Point{}
+	s.mu.Unlock()
+
+	driverIDs := make([]string, 0, len(pings)+len(s.tracks))
+	for id := range pings {
+		driverIDs = append(driverIDs, id)
+	}
+	for id := range s.tracks {
+		if _, ok := pings[id]; !ok {
+			driverIDs = append(driverIDs, id)
+		}
+	}
+	if len(driverIDs) == 0 {
+		return nil
+	}
+	active, err := s.started(ctx, driverIDs)
+	if err != nil {
+		s.requeue(pings)
+		return err
+	}
+	now := time.Now().UTC()
+	for _, driverID := range driverIDs {
+		t, tr := active[driverID], s.tracks[driverID]
+		if tr != nil && (t == nil || tr.tripID != t.ID) {
+			s.rejoin(ctx, tr, now)
+			delete(s.tracks, driverID)
+			tr = nil
+		}
+		if t == nil {
+			continue
+		}
+		if tr == nil {
+			tr = &track{tripID: t.ID}
+			s.tracks[driverID] = tr
+		}
+		s.follow(ctx, t, tr, pings[driverID])
+	}
+	return nil
+}
+
+// requeue puts pings a failed check took back in front of newer ones.
+func (s *Service) requeue(pings map[string][]Point) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, p := range pings {
+		p = append(p, s.pings[id]...)
+		if len(p) > maxPings {
+			p = p[len(p)-maxPings:]
+		}
+		s.pings[id] = p
+	}
+}
+
+// follow checks a driver's new pings against t's route: pickup, approved
+// stops, drop. Pings from before the trip started are ignored.
+func (s *Service) follow(ctx context.Context, t *trips.Trip, tr *track, pings []Point) {
+	route := make([]events.LatLng, 0, len(t.Stops)+2)
+	route = append(route, events.LatLng{Lat: t.PickupLat, Lng: t.PickupLng})
+	route = append(route, t.Stops...)
+	route = append(route, events.LatLng{Lat: t.DropLat, Lng: t.DropLng})
+	for _, p := range pings {
+		if t.StartedAt != nil && p.TS.Before(*t.StartedAt) {
+			continue
+		}
+		km := offRouteKm(p, route)
+		if km <= s.cfg.CorridorKm {
+			if tr.off != nil {
+				s.rejoin(ctx, tr, p.TS)
+			}
+			continue
+		}
+		if tr.off == nil {
+			tr.off = &Deviation{TripID: t.ID, DriverID: *t.DriverID, RiderID: t.RiderID, StartedAt: p.TS}
+		}
+		tr.off.Points = append(tr.off.Points, p)
+		tr.off.MaxKm = max(tr.off.MaxKm, round2(km))
+		tr.dirty = true
+		if !tr.recorded && p.TS.Sub(tr.off.StartedAt) >= s.cfg.DeviationAfter {
+			s.raise(ctx, tr, p.TS)
+		}
+	}
+	if tr.recorded && tr.dirty {
+		if err := s.save(ctx, tr.off); err == nil {
+			tr.dirty = false
+		}
+	}
+}
+
+// raise records the deviation tr is in, queues the trip for review and
+// tells the listeners. A failed write is tried again on the next ping off
+// the route.
+func (s *Service) raise(ctx context.Context, tr *track, at time.Time) {
+	d := tr.off
+	d.ID, d.DetectedAt = uuid.NewString(), at
+	points, err := json.Marshal(d.Points)
+	if err != nil {
+		logger.Error("deviation encode failed", "trip", d.TripID, "err", err)
+		return
+	}
+	if _, err := s.db.Exec(ctx,
+		`INSERT INTO route_deviations (id,trip_id,driver_id,rider_id,started_at,detected_at,max_km,points)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7,$8)`,
+		d.ID, d.TripID, d.DriverID, d.RiderID, d.StartedAt, d.DetectedAt, d.MaxKm, points); err != nil {
+		logger.Error("deviation write failed", "trip", d.TripID, "err", err)
+		return
+	}
+	tr.recorded, tr.dirty = true, false
+	logger.Warn("driver left the planned route", "trip", d.TripID, "driver", d.DriverID, "deviation", d.ID,
+		"max_km", d.MaxKm, "since", d.StartedAt)
+	if err := s.review.FlagDeviation(ctx, d.TripID, d.DriverID, d.RiderID, d.ID, d.MaxKm, d.StartedAt); err != nil {
+		logger.Error("deviation flag failed", "trip", d.TripID, "err", err)
+	}
+	for _, fn := range s.listeners {
+		fn(ctx, *d)
+	}
+}
+
+// rejoin closes the deviation tr is in at at, the driver being back on the
+// route or the trip over. One too short to be recorded is forgotten.
+func (s *Service) rejoin(ctx context.Context, tr *track, at time.Time) {
+	if tr.off != nil && tr.recorded {
+		tr.off.EndedAt = &at
+		if err := s.save(ctx, tr.off); err == nil {
+			logger.Info("driver back on the planned route", "trip", tr.off.TripID, "deviation", tr.off.ID,
+				"off_for", at.Sub(tr.off.StartedAt).Round(time.Second))
+		}
+	}
+	tr.off, tr.recorded, tr.dirty = nil, false, false
+}
+
+// save writes a recorded deviation's trace and end.
+func (s *Service) save(ctx context.Context, d *Deviation) error {
+	points, err := json.Marshal(d.Points)
+	if err == nil {
+		_, err = s.db.Exec(ctx, `UPDATE route_deviations SET max_km=$2, points=$3, ended_at=$4 WHERE id=$1`,
+			d.ID, d.MaxKm, points, d.EndedAt)
+	}
+	if err != nil {
+		logger.Warn("deviation update failed", "trip", d.TripID, "deviation", d.ID, "err", err)
+	}
+	return err
+}
+
+// started returns the started trips of the given drivers by driver.
+func (s *Service) started(ctx context.Context, driverIDs []string) (map[string]*trips.Trip, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT id,rider_id,driver_id,pickup_lat,pickup_lng,drop_lat,drop_lng,COALESCE(stops,'[]'::jsonb),started_at
+		 FROM trips WHERE status=$1 AND driver_id = ANY($2)`,
+		trips.StatusStarted, driverIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]*trips.Trip{}
+	for rows.Next() {
+		var t trips.Trip
+		if err := rows.Scan(&t.ID, &t.RiderID, &t.DriverID, &t.PickupLat, &t.PickupLng, &t.DropLat, &t.DropLng,
+			&t.Stops, &t.StartedAt); err != nil {
+			return nil, err
+		}
+		out[*t.DriverID] = &t
+	}
+	return out, rows.Err()
+}
+
+// Trip returns the deviations recorded on trip tripID, oldest first.
+func (s *Service) Trip(ctx context.Context, tripID string) (*List, error) {
+	if _, err := uuid.Parse(tripID); err != nil {
+		return nil, ErrTripNotFound
+	}
+	rows, err := s.db.Query(ctx,
+		`SELECT id,trip_id,driver_id,rider_id,started_at,detected_at,ended_at,max_km,points
+		 FROM route_deviations WHERE trip_id=$1 ORDER BY started_at`, tripID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	l := &List{Deviations: []Deviation{}}
+	for rows.Next() {
+		var d Deviation
+		if err := rows.Scan(&d.ID, &d.TripID, &d.DriverID, &d.RiderID, &d.StartedAt, &d.DetectedAt, &d.EndedAt,
+			&d.MaxKm, &d.Points); err != nil {
+			return nil, err
+		}
+		l.Deviations = append(l.Deviations, d)
+	}
+	return l, rows.Err()
+}
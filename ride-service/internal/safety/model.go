@@ -0,0 +1,18 @@
+package safety
+
+import "ride-service/internal/drivers"
+
+// Ranked is one driver in GET /admin/safety.
+type Ranked struct {
+	DriverID string `json:"driver_id"`
+	Name     string `json:"name"`
+	drivers.Safety
+}
+
+// Page is a page of GET /admin/safety, lowest score first.
+type Page struct {
+	Drivers []Ranked `json:"drivers"`
+	Total   int      `json:"total"`
+	Limit   int      `json:"limit"`
+	Offset  int      `json:"offset"`
+}
@@ -0,0 +1,276 @@
+// Package safety scores how drivers drive. Speeds come from the distance and
+// time between successive location pings; speeding and harsh acceleration
+// and braking are counted per driver and day and turned into a 0–100 score
+// over a rolling window.
+package safety
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/internal/drivers"
+	"ride-service/pkg/config"
+	"ride-service/pkg/logging"
+)
+
+var logger = logging.For("safety")
+
+// Points off a driver's 100 per episode per 100 km driven.
+const (
+	speedingPoints = 5
+	harshPoints    = 2
+)
+
+const (
+	// Pings closer than minGap are too noisy to give a speed; pings further
+	// apart than maxGap give none, as the driver may have stopped between.
+	minGap = 2 * time.Second
+	maxGap = 30 * time.Second
+	// maxKmh is a GPS glitch, not driving; the fraud teleport rule sees to
+	// jumps.
+	maxKmh = 250.0
+	// dayLayout keys the pending counts by UTC date.
+	dayLayout = "2006-01-02"
+)
+
+// scoreSQL is score over a driver's summed days, for ranking in SQL.
+var scoreSQL = fmt.Sprintf(
+	`GREATEST(0, 100 - 100 * (%d*SUM(s.speeding) + %d*(SUM(s.harsh_accel)+SUM(s.harsh_braking))) / NULLIF(SUM(s.km), 0))`,
+	speedingPoints, harshPoints)
+
+// ping is a driver's last location and how they were driving arriving at it.
+type ping struct {
+	lat, lng float64
+	at       time.Time
+	kmh      float64
+	hasSpeed bool
+	speeding bool // in a speeding episode, already counted
+	accel    bool // in a harsh acceleration episode, already counted
+	braking  bool // likewise for braking
+}
+
+// dayKey identifies one driver's counts for one day.
+type dayKey struct {
+	driverID string
+	day      string
+}
+
+// tally is what a driver drove on a day since the last flush.
+type tally struct {
+	km                       float64
+	speeding, accel, braking int
+}
+
+// Service follows online drivers' location updates and keeps their safety
+// counts. The last ping of each driver is held in memory, so an instance
+// only compares the pings it receives itself; counts are buffered and
+// written every FlushInterval.
+type Service struct {
+	db  *pgxpool.Pool
+	cfg config.Safety
+
+	mu      sync.Mutex
+	last    map[string]ping
+	pending map[dayKey]*tally
+}
+
+// NewService creates a safety service. Start it to begin flushing.
+func NewService(db *pgxpool.Pool, cfg config.Safety) *Service {
+	return &Service{db: db, cfg: cfg, last: map[string]ping{}, pending: map[dayKey]*tally{}}
+}
+
+// DriverMoved measures the speed since the driver's previous ping and
+// counts the start of each speeding, harsh acceleration or harsh braking
+// episode.
+func (s *Service) DriverMoved(_ context.Context, driverID string, lat, lng float64) {
+	now := time.Now().UTC()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev, ok := s.last[driverID]
+	cur := ping{lat: lat, lng: lng, at: now}
+	if ok {
+		dt := now.Sub(prev.at)
+		if dt < minGap {
+			return // measured from prev at the next ping
+		}
+		km := haversineKm(prev.lat, prev.lng, lat, lng)
+		if kmh := km / dt.Hours(); dt <= maxGap && kmh <= maxKmh {
+			t := s.tally(driverID, now)
+			t.km += km
+			cur.kmh, cur.hasSpeed = kmh, true
+			cur.speeding = kmh > s.cfg.SpeedLimitKmh
+			if cur.speeding && !prev.speeding {
+				t.speeding++
+			}
+			if prev.hasSpeed {
+				a := (kmh - prev.kmh) / 3.6 / dt.Seconds() // m/s²
+				cur.accel, cur.braking = a > s.cfg.HarshAccel, -a > s.cfg.HarshBraking
+				if cur.accel && !prev.accel {
+					t.accel++
+				}
+				if cur.braking && !prev.braking {
+					t.braking++
+				}
+			}
+		}
+	}
+	s.last[driverID] = cur
+}
+
+// DriverLeft forgets the driver's last ping, so coming back online
+// elsewhere is not a drive.
+func (s *Service) DriverLeft(_ context.Context, driverID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.last, driverID)
+}
+
+// tally returns the driver's pending counts for now's day. Call it with
+// s.mu held.
+func (s *Service) tally(driverID string, now time.Time) *tally {
+	k := dayKey{driverID: driverID, day: now.Format(dayLayout)}
+	t, ok := s.pending[k]
+	if !ok {
+		t = &tally{}
+		s.pending[k] = t
+	}
+	return t
+}
+
+// Start flushes the pending counts every FlushInterval until ctx is done.
+func (s *Service) Start(ctx context.Context) {
+	go func() {
+		t := time.NewTicker(s.cfg.FlushInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				s.Flush(ctx)
+			}
+		}
+	}()
+}
+
+// Flush adds the pending counts to driver_safety_days. Counts that fail to
+// write are kept for the next flush.
+func (s *Service) Flush(ctx context.Context) {
+	s.mu.Lock()
+	pending := s.pending
+	s.pending = map[dayKey]*tally{}
+	s.mu.Unlock()
+
+	for k, t := range pending {
+		_, err := s.db.Exec(ctx,
+			`INSERT INTO driver_safety_days (driver_id,day,km,speeding,harsh_accel,harsh_braking)
+			 VALUES ($1,$2::date,$3,$4,$5,$6)
+			 ON CONFLICT (driver_id,day) DO UPDATE SET km=driver_safety_days.km+$3,
+			     speeding=driver_safety_days.speeding+$4, harsh_accel=driver_safety_days.harsh_accel+$5,
+			     harsh_braking=driver_safety_days.harsh_braking+$6`,
+			k.driverID, k.day, t.km, t.speeding, t.accel, t.braking)
+		if err != nil {
+			logger.Warn("safety counts write failed", "driver", k.driverID, "day", k.day, "err", err)
+			s.requeue(k, t)
+		}
+	}
+}
+
+// requeue adds counts that failed to write to those gathered since.
+func (s *Service) requeue(k dayKey, t *tally) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cur, ok := s.pending[k]; ok {
+		cur.km += t.km
+		cur.speeding += t.speeding
+		cur.accel += t.accel
+		cur.braking += t.braking
+		return
+	}
+	s.pending[k] = t
+}
+
+// Safety returns the safety of each of driverIDs that has driven in the
+// window; it is a drivers.SafetySource.
+func (s *Service) Safety(ctx context.Context, driverIDs []string) (map[string]drivers.Safety, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT s.driver_id::text, SUM(s.km), SUM(s.speeding), SUM(s.harsh_accel), SUM(s.harsh_braking)
+		 FROM driver_safety_days s WHERE s.driver_id = ANY($1::uuid[]) AND s.day >= $2::date GROUP BY s.driver_id`,
+		driverIDs, s.since())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]drivers.Safety{}
+	for rows.Next() {
+		var id string
+		var sf drivers.Safety
+		if err := rows.Scan(&id, &sf.Km, &sf.Speeding, &sf.HarshAccel, &sf.HarshBraking); err != nil {
+			return nil, err
+		}
+		out[id] = s.scored(sf)
+	}
+	return out, rows.Err()
+}
+
+// Ranking returns one page of the drivers with a score, lowest first.
+func (s *Service) Ranking(ctx context.Context, limit, offset int) (*Page, error) {
+	p := &Page{Drivers: []Ranked{}, Limit: limit, Offset: offset}
+	if err := s.db.QueryRow(ctx,
+		`SELECT COUNT(*) FROM (SELECT 1 FROM driver_safety_days s WHERE s.day >= $1::date
+		 GROUP BY s.driver_id HAVING SUM(s.km) >= $2) scored`,
+		s.since(), s.cfg.MinKm).Scan(&p.Total); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(ctx,
+		`SELECT s.driver_id::text, d.name, SUM(s.km), SUM(s.speeding), SUM(s.harsh_accel), SUM(s.harsh_braking)
+		 FROM driver_safety_days s JOIN drivers d ON d.id = s.driver_id
+		 WHERE s.day >= $1::date GROUP BY s.driver_id, d.name HAVING SUM(s.km) >= $2
+		 ORDER BY `+scoreSQL+`, s.driver_id LIMIT $3 OFFSET $4`,
+		s.since(), s.cfg.MinKm, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r Ranked
+		if err := rows.Scan(&r.DriverID, &r.Name, &r.Km, &r.Speeding, &r.HarshAccel, &r.HarshBraking); err != nil {
+			return nil, err
+		}
+		r.Safety = s.scored(r.Safety)
+		p.Drivers = append(p.Drivers, r)
+	}
+	return p, rows.Err()
+}
+
+// since is the first day in the window.
+func (s *Service) since() string {
+	return time.Now().UTC().Add(-s.cfg.Window).Format(dayLayout)
+}
+
+// scored rounds sf's distance and, once it covers MinKm, fills in the score.
+func (s *Service) scored(sf drivers.Safety) drivers.Safety {
+	sf.WindowDays = int(s.cfg.Window.Hours() / 24)
+	if sf.Km >= s.cfg.MinKm && sf.Km > 0 {
+		points := float64(speedingPoints*sf.Speeding+harshPoints*(sf.HarshAccel+sf.HarshBraking)) / sf.Km * 100
+		score := math.Round(max(0, 100-points)*10) / 10
+		sf.Score = &score
+	}
+	sf.Km = math.Round(sf.Km*10) / 10
+	return sf
+}
+
+func haversineKm(lat1, lng1, lat2, lng2 float64) float64 {
+	const R = 6371.0
+	dLat := (lat2 - lat1) * math.Pi / 180
+	dLng := (lng2 - lng1) * math.Pi / 180
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*
+			math.Sin(dLng/2)*math.Sin(dLng/2)
+	return R * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
@@ -0,0 +1,80 @@
+package sessions
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+)
+
+var ErrNotFound = apierror.NotFound("session not found")
+
+// Handler lists and ends the sessions of the tokens issued to an account.
+// Sessions themselves are recorded by jwt.Generate.
+type Handler struct{}
+
+// NewHandler creates a session handler.
+func NewHandler() *Handler { return &Handler{} }
+
+// Routes returns the routes mounted at /users/{id}/sessions and, since a
+// driver's sessions there are their online shifts, /drivers/{id}/devices.
+func (h *Handler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+
+	r.Get("/", h.List)
+	r.Delete("/{sessionID}", h.End)
+
+	return r
+}
+
+// allowed reports whether the caller may act on account id: the account
+// itself or one of roles.
+func allowed(r *http.Request, id string, roles ...string) bool {
+	claims := jwt.GetClaims(r.Context())
+	if claims.UserID == id {
+		return true
+	}
+	for _, role := range roles {
+		if claims.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !allowed(r, id, "admin", "support") {
+		apierror.Write(w, apierror.Forbidden("forbidden"))
+		return
+	}
+	list, err := jwt.Sessions(r.Context(), id, jwt.GetClaims(r.Context()).ID)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, List{Sessions: list})
+}
+
+// End serves DELETE .../sessions/{sessionID}: the session's token stops
+// working at once. Ending the current session signs the caller out.
+func (h *Handler) End(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if !allowed(r, id, "admin") {
+		apierror.Write(w, apierror.Forbidden("forbidden"))
+		return
+	}
+	ok, err := jwt.EndSession(r.Context(), id, chi.URLParam(r, "sessionID"))
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	if !ok {
+		apierror.Write(w, ErrNotFound)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]string{"status": "ended"})
+}
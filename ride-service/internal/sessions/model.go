@@ -0,0 +1,9 @@
+package sessions
+
+import "ride-service/pkg/jwt"
+
+// List is an account's signed-in devices for GET /users/{id}/sessions,
+// newest first.
+type List struct {
+	Sessions []jwt.Session `json:"sessions"`
+}
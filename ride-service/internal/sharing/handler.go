@@ -0,0 +1,100 @@
+package sharing
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+)
+
+// Streamer serves a trip's live location stream to a share link's viewer
+// until the link expires, and drops a trip's viewers when its links are
+// revoked; the tracking hub implements it.
+type Streamer interface {
+	HandleSharedWS(w http.ResponseWriter, r *http.Request, tripID string, until time.Time)
+	HandleSharedSSE(w http.ResponseWriter, r *http.Request, tripID string, until time.Time)
+	CloseViewers(tripID string)
+}
+
+// Handler exposes trip share links.
+type Handler struct {
+	svc    *Service
+	stream Streamer
+}
+
+// NewHandler wires a handler to the sharing service and the stream its
+// links follow.
+func NewHandler(svc *Service, stream Streamer) *Handler { return &Handler{svc: svc, stream: stream} }
+
+// TripRoutes returns the rider's routes mounted at /trips/{id}/share.
+func (h *Handler) TripRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth, jwt.RequireRole("rider"))
+
+	r.Post("/", h.Create)
+	r.Delete("/", h.Revoke)
+
+	return r
+}
+
+// Routes returns the public routes mounted at /shared: the token is the
+// only credential.
+func (h *Handler) Routes() chi.Router {
+	r := chi.NewRouter()
+
+	r.Get("/{token}", h.View)
+	r.Get("/{token}/ws", h.WS)
+	r.Get("/{token}/sse", h.SSE)
+
+	return r
+}
+
+func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
+	sh, err := h.svc.Create(r.Context(), chi.URLParam(r, "id"), jwt.GetClaims(r.Context()).UserID)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusCreated, sh)
+}
+
+func (h *Handler) Revoke(w http.ResponseWriter, r *http.Request) {
+	tripID := chi.URLParam(r, "id")
+	if err := h.svc.Revoke(r.Context(), tripID, jwt.GetClaims(r.Context()).UserID); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	h.stream.CloseViewers(tripID)
+	apierror.WriteJSON(w, http.StatusOK, map[string]string{"status": "revoked"})
+}
+
+func (h *Handler) View(w http.ResponseWriter, r *http.Request) {
+	v, err := h.svc.View(r.Context(), chi.URLParam(r, "token"))
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	apierror.WriteJSON(w, http.StatusOK, v)
+}
+
+func (h *Handler) WS(w http.ResponseWriter, r *http.Request) {
+	tripID, until, err := h.svc.Resolve(r.Context(), chi.URLParam(r, "token"))
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	h.stream.HandleSharedWS(w, r, tripID, until)
+}
+
+func (h *Handler) SSE(w http.ResponseWriter, r *http.Request) {
+	tripID, until, err := h.svc.Resolve(r.Context(), chi.URLParam(r, "token"))
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	h.stream.HandleSharedSSE(w, r, tripID, until)
+}
@@ -0,0 +1,39 @@
+package sharing
+
+import (
+	"time"
+
+	"ride-service/internal/events"
+)
+
+// Share is a link a rider created so others can follow their trip. Token
+// and URL are only returned when it is created.
+type Share struct {
+	ID        string    `json:"id"`
+	TripID    string    `json:"trip_id"`
+	Token     string    `json:"token,omitempty"`
+	URL       string    `json:"url,omitempty"` // the summary; its /ws and /sse stream the trip's locations
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// View is what a share link shows: how far the trip has got, where it is
+// going and who is driving. The pickup and the rider are left out.
+type View struct {
+	Status      string              `json:"status"`
+	Drop        events.LatLng       `json:"drop"`
+	Stops       []events.LatLng     `json:"stops,omitempty"`
+	Driver      *Driver             `json:"driver,omitempty"` // once assigned
+	Vehicle     *events.VehicleCard `json:"vehicle,omitempty"`
+	RequestedAt *time.Time          `json:"requested_at,omitempty"`
+	StartedAt   *time.Time          `json:"started_at,omitempty"`
+	CompletedAt *time.Time          `json:"completed_at,omitempty"`
+	CancelledAt *time.Time          `json:"cancelled_at,omitempty"`
+	ExpiresAt   time.Time           `json:"expires_at"` // of the link
+}
+
+// Driver is the driver as a share link shows them: first name and rating.
+type Driver struct {
+	Name   string  `json:"name"`
+	Rating float64 `json:"rating"`
+}
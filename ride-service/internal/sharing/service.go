@@ -0,0 +1,188 @@
+// Package sharing lets riders share a link to their trip with friends and
+// family. The link needs no account: it shows the trip's progress, driver
+// and vehicle, and streams the driver's location until it expires.
+package sharing
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/internal/events"
+	"ride-service/internal/trips"
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/config"
+	"ride-service/pkg/logging"
+)
+
+var logger = logging.For("sharing")
+
+var (
+	ErrTripNotFound = apierror.NotFound("trip not found")
+	ErrNotFound     = apierror.NotFound("unknown or expired share link")
+	ErrNotRider     = apierror.Forbidden("only the trip's rider can share it")
+	ErrTripOver     = apierror.Conflict("the trip has already ended").WithCode("trip_over")
+)
+
+// shareable are the statuses a trip can be shared in: until it ends.
+var shareable = []string{trips.StatusRequested, trips.StatusMatching, trips.StatusDriverAssigned, trips.StatusStarted}
+
+// VehicleLookup returns the card of a driver's vehicle; the drivers service
+// implements it.
+type VehicleLookup interface {
+	VehicleCard(ctx context.Context, driverID string) (*events.VehicleCard, error)
+}
+
+// TripReader returns trips; trips.TripRepo implements it.
+type TripReader interface {
+	GetByID(ctx context.Context, id string) (*trips.Trip, error)
+}
+
+// Service issues and resolves trip share links.
+type Service struct {
+	db       *pgxpool.Pool
+	trips    TripReader
+	vehicles VehicleLookup
+	ttl      time.Duration
+	baseURL  string
+}
+
+// NewService creates a sharing service whose links last cfg.ShareTTL and
+// start with cfg.ShareBaseURL.
+func NewService(db *pgxpool.Pool, t TripReader, vehicles VehicleLookup, cfg config.Trips) *Service {
+	return &Service{db: db, trips: t, vehicles: vehicles, ttl: cfg.ShareTTL, baseURL: strings.TrimSuffix(cfg.ShareBaseURL, "/")}
+}
+
+// trip returns tripID, reporting a missing one as ErrTripNotFound.
+func (s *Service) trip(ctx context.Context, tripID string) (*trips.Trip, error) {
+	t, err := s.trips.GetByID(ctx, tripID)
+	if errors.Is(err, trips.ErrNotFound) {
+		return nil, ErrTripNotFound
+	}
+	return t, err
+}
+
+// Create issues riderID a link to their trip tripID, which must not have
+// ended yet.
+func (s *Service) Create(ctx context.Context, tripID, riderID string) (*Share, error) {
+	t, err := s.trip(ctx, tripID)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case t.RiderID != riderID:
+		return nil, ErrNotRider
+	case !slices.Contains(shareable, t.Status):
+		return nil, ErrTripOver
+	}
+
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	sh := &Share{ID: uuid.NewString(), TripID: tripID, Token: hex.EncodeToString(b)}
+	sh.URL = s.baseURL + "/shared/" + sh.Token
+	err = s.db.QueryRow(ctx,
+		`INSERT INTO trip_shares (id,trip_id,rider_id,token_hash,expires_at) VALUES ($1,$2,$3,$4,$5)
+		 RETURNING expires_at, created_at`,
+		sh.ID, tripID, riderID, hash(sh.Token), time.Now().Add(s.ttl)).
+		Scan(&sh.ExpiresAt, &sh.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("trip shared", "trip", tripID, "share", sh.ID)
+	return sh, nil
+}
+
+// Revoke ends every link to riderID's trip tripID before it expires.
+func (s *Service) Revoke(ctx context.Context, tripID, riderID string) error {
+	t, err := s.trip(ctx, tripID)
+	if err != nil {
+		return err
+	}
+	if t.RiderID != riderID {
+		return ErrNotRider
+	}
+	_, err = s.db.Exec(ctx,
+		`UPDATE trip_shares SET revoked_at=NOW() WHERE trip_id=$1 AND revoked_at IS NULL AND expires_at > NOW()`, tripID)
+	return err
+}
+
+// Resolve returns the trip a live link's token is for and when the link
+// expires.
+func (s *Service) Resolve(ctx context.Context, token string) (tripID string, expiresAt time.Time, err error) {
+	err = s.db.QueryRow(ctx,
+		`SELECT trip_id, expires_at FROM trip_shares
+		 WHERE token_hash=$1 AND revoked_at IS NULL AND expires_at > NOW()`, hash(token)).
+		Scan(&tripID, &expiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = ErrNotFound
+	}
+	return
+}
+
+// View returns what the link with token shows.
+func (s *Service) View(ctx context.Context, token string) (*View, error) {
+	tripID, expiresAt, err := s.Resolve(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	t, err := s.trips.GetByID(ctx, tripID)
+	if err != nil {
+		return nil, err
+	}
+	v := &View{
+		Status:      t.Status,
+		Drop:        events.LatLng{Lat: t.DropLat, Lng: t.DropLng},
+		Stops:       t.Stops,
+		RequestedAt: t.RequestedAt,
+		StartedAt:   t.StartedAt,
+		CompletedAt: t.CompletedAt,
+		CancelledAt: t.CancelledAt,
+		ExpiresAt:   expiresAt,
+	}
+	if t.DriverID == nil {
+		return v, nil
+	}
+	var name string
+	var rating *float64
+	err = s.db.QueryRow(ctx, `SELECT name, rating FROM drivers WHERE id=$1`, *t.DriverID).Scan(&name, &rating)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return v, nil
+	} else if err != nil {
+		return nil, err
+	}
+	v.Driver = &Driver{Name: firstName(name)}
+	if rating != nil {
+		v.Driver.Rating = *rating
+	}
+	if card, err := s.vehicles.VehicleCard(ctx, *t.DriverID); err == nil {
+		v.Vehicle = card
+	} else {
+		logger.Warn("vehicle card lookup failed", "driver", *t.DriverID, "err", err)
+	}
+	return v, nil
+}
+
+func hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// firstName is the first word of name, all a stranger needs to spot the
+// driver.
+func firstName(name string) string {
+	if f := strings.Fields(name); len(f) > 0 {
+		return f[0]
+	}
+	return ""
+}
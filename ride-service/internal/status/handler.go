@@ -0,0 +1,71 @@
+package status
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+)
+
+// Handler exposes the public status report and the admin incident endpoints.
+type Handler struct{ svc *Service }
+
+// NewHandler wires a handler to the status service.
+func NewHandler(svc *Service) *Handler { return &Handler{svc: svc} }
+
+// AdminRoutes returns the incident management routes, mounted at
+// /admin/status/incidents.
+func (h *Handler) AdminRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+	r.Use(jwt.RequireRole("admin"))
+
+	r.Get("/", h.List)
+	r.Post("/", h.Create)
+	r.Post("/{id}/resolve", h.Resolve)
+
+	return r
+}
+
+// Status serves GET /status. It is unauthenticated and cacheable.
+func (h *Handler) Status(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=10")
+	apierror.WriteJSON(w, http.StatusOK, h.svc.Report(r.Context()))
+}
+
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	incidents, err := h.svc.List(r.Context(), r.URL.Query().Get("all") == "true")
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]any{"incidents": incidents})
+}
+
+func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
+	var req IncidentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	claims := jwt.GetClaims(r.Context())
+	inc, err := h.svc.Create(r.Context(), claims.UserID, req)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusCreated, inc)
+}
+
+func (h *Handler) Resolve(w http.ResponseWriter, r *http.Request) {
+	claims := jwt.GetClaims(r.Context())
+	inc, err := h.svc.Resolve(r.Context(), chi.URLParam(r, "id"), claims.UserID)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, inc)
+}
@@ -0,0 +1,63 @@
+package status
+
+import "time"
+
+// Health levels, from best to worst. Incident severities use the same scale
+// plus SeverityInfo, which shows a banner without affecting health.
+const (
+	Operational = "operational"
+	Degraded    = "degraded"
+	Outage      = "outage"
+
+	SeverityInfo = "info"
+)
+
+// Incident is an admin-managed banner. An empty City applies everywhere.
+type Incident struct {
+	ID         string     `json:"id"`
+	City       string     `json:"city,omitempty"`
+	Message    string     `json:"message"`
+	Severity   string     `json:"severity"`
+	CreatedBy  string     `json:"created_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+}
+
+// IncidentRequest is the body for POST /admin/status/incidents.
+type IncidentRequest struct {
+	City     string `json:"city"`
+	Message  string `json:"message"`
+	Severity string `json:"severity"`
+}
+
+// Banner is the public view of an active incident.
+type Banner struct {
+	Message  string    `json:"message"`
+	Severity string    `json:"severity"`
+	Since    time.Time `json:"since"`
+}
+
+// Component is the coarse health of one backing service. Error details are
+// logged, never exposed.
+type Component struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+// City is the health and banners for one city.
+type City struct {
+	Name    string   `json:"name"`
+	Status  string   `json:"status"`
+	Banners []Banner `json:"banners"`
+}
+
+// Report is the response for GET /status.
+type Report struct {
+	Status        string      `json:"status"`
+	StartedAt     time.Time   `json:"started_at"`
+	UptimeSeconds int64       `json:"uptime_seconds"`
+	Components    []Component `json:"components"`
+	Banners       []Banner    `json:"banners"` // incidents not tied to a city
+	Cities        []City      `json:"cities"`
+	CheckedAt     time.Time   `json:"checked_at"`
+}
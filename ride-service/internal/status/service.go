@@ -0,0 +1,254 @@
+package status
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/logging"
+)
+
+var logger = logging.For("status")
+
+var (
+	ErrNotFound = apierror.NotFound("incident not found or already resolved")
+	ErrInvalid  = apierror.Validation("invalid incident")
+)
+
+// cacheTTL bounds how often an unauthenticated caller can make the service
+// ping its dependencies.
+const cacheTTL = 10 * time.Second
+
+// pingTimeout caps each component check so a hung dependency reports as
+// degraded instead of stalling the endpoint.
+const pingTimeout = 2 * time.Second
+
+// Pinger is a backing service whose reachability is reported on /status.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Check names one component to report.
+type Check struct {
+	Name   string
+	Pinger Pinger
+}
+
+// Service assembles the public status report and manages incident banners.
+type Service struct {
+	db      *pgxpool.Pool
+	checks  []Check
+	cities  []string
+	started time.Time
+
+	mu       sync.Mutex
+	cached   *Report
+	cachedAt time.Time
+}
+
+// NewService creates a status service. cities are always listed on /status;
+// any other city with an active incident is listed too.
+func NewService(db *pgxpool.Pool, cities []string, checks ...Check) *Service {
+	return &Service{db: db, checks: checks, cities: cities, started: time.Now()}
+}
+
+// Report returns the current status, computed at most once per cacheTTL.
+func (s *Service) Report(ctx context.Context) *Report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cached != nil && time.Since(s.cachedAt) < cacheTTL {
+		r := *s.cached
+		r.UptimeSeconds = int64(time.Since(s.started).Seconds())
+		return &r
+	}
+
+	now := time.Now()
+	r := &Report{
+		Status:        Operational,
+		StartedAt:     s.started,
+		UptimeSeconds: int64(now.Sub(s.started).Seconds()),
+		Components:    make([]Component, 0, len(s.checks)),
+		Banners:       []Banner{},
+		Cities:        []City{},
+		CheckedAt:     now,
+	}
+	for _, c := range s.checks {
+		pctx, cancel := context.WithTimeout(ctx, pingTimeout)
+		err := c.Pinger.Ping(pctx)
+		cancel()
+		st := Operational
+		if err != nil {
+			st = Degraded
+			logger.Warn("component unhealthy", "component", c.Name, "err", err)
+		}
+		r.Components = append(r.Components, Component{Name: c.Name, Status: st})
+		r.Status = worst(r.Status, st)
+	}
+
+	incidents, err := s.active(ctx)
+	if err != nil {
+		logger.Error("load incidents failed", "err", err)
+	}
+	byCity := map[string]*City{}
+	for _, name := range s.cities {
+		byCity[strings.ToLower(name)] = &City{Name: name, Status: r.Status, Banners: []Banner{}}
+	}
+	global := r.Status
+	for _, inc := range incidents {
+		b := Banner{Message: inc.Message, Severity: inc.Severity, Since: inc.CreatedAt}
+		if inc.City == "" {
+			r.Banners = append(r.Banners, b)
+			global = worst(global, inc.Severity)
+			continue
+		}
+		key := strings.ToLower(inc.City)
+		c, ok := byCity[key]
+		if !ok {
+			c = &City{Name: inc.City, Status: r.Status, Banners: []Banner{}}
+			byCity[key] = c
+		}
+		c.Banners = append(c.Banners, b)
+		c.Status = worst(c.Status, inc.Severity)
+	}
+	r.Status = global
+	for _, c := range byCity {
+		c.Status = worst(c.Status, global)
+		r.Cities = append(r.Cities, *c)
+		r.Status = worst(r.Status, c.Status)
+	}
+	sort.Slice(r.Cities, func(i, j int) bool { return r.Cities[i].Name < r.Cities[j].Name })
+
+	s.cached, s.cachedAt = r, now
+	return r
+}
+
+// invalidate drops the cached report so banner changes show immediately.
+func (s *Service) invalidate() {
+	s.mu.Lock()
+	s.cached = nil
+	s.mu.Unlock()
+}
+
+// Create opens an incident banner.
+func (s *Service) Create(ctx context.Context, adminID string, req IncidentRequest) (*Incident, error) {
+	req.Message = strings.TrimSpace(req.Message)
+	req.City = strings.TrimSpace(req.City)
+	if req.Severity == "" {
+		req.Severity = SeverityInfo
+	}
+	switch {
+	case req.Message == "":
+		return nil, fmt.Errorf("%w: message is required", ErrInvalid)
+	case len(req.Message) > 500:
+		return nil, fmt.Errorf("%w: message exceeds 500 characters", ErrInvalid)
+	case len(req.City) > 100:
+		return nil, fmt.Errorf("%w: city exceeds 100 characters", ErrInvalid)
+	}
+	switch req.Severity {
+	case SeverityInfo, Degraded, Outage:
+	default:
+		return nil, fmt.Errorf("%w: severity must be info, degraded or outage", ErrInvalid)
+	}
+
+	inc := &Incident{
+		ID:        uuid.New().String(),
+		City:      req.City,
+		Message:   req.Message,
+		Severity:  req.Severity,
+		CreatedBy: adminID,
+	}
+	var city *string
+	if inc.City != "" {
+		city = &inc.City
+	}
+	err := s.db.QueryRow(ctx,
+		`INSERT INTO status_incidents (id,city,message,severity,created_by)
+		 VALUES ($1,$2,$3,$4,$5) RETURNING created_at`,
+		inc.ID, city, inc.Message, inc.Severity, adminID).Scan(&inc.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	s.invalidate()
+	logger.Info("incident opened", "incident", inc.ID, "city", inc.City, "severity", inc.Severity, "admin", adminID)
+	return inc, nil
+}
+
+// Resolve closes an active incident, removing its banner.
+func (s *Service) Resolve(ctx context.Context, id, adminID string) (*Incident, error) {
+	inc, err := scanIncident(s.db.QueryRow(ctx,
+		`UPDATE status_incidents SET resolved_at=NOW()
+		 WHERE id=$1 AND resolved_at IS NULL
+		 RETURNING `+columns, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.invalidate()
+	logger.Info("incident resolved", "incident", id, "admin", adminID)
+	return inc, nil
+}
+
+// List returns incidents newest first; resolved ones only when all is set.
+func (s *Service) List(ctx context.Context, all bool) ([]Incident, error) {
+	if !all {
+		return s.active(ctx)
+	}
+	return s.query(ctx, `SELECT `+columns+` FROM status_incidents ORDER BY created_at DESC LIMIT 200`)
+}
+
+func (s *Service) active(ctx context.Context) ([]Incident, error) {
+	return s.query(ctx, `SELECT `+columns+` FROM status_incidents WHERE resolved_at IS NULL ORDER BY created_at DESC`)
+}
+
+// ---- helpers ----
+
+const columns = `id,COALESCE(city,''),message,severity,created_by,created_at,resolved_at`
+
+func (s *Service) query(ctx context.Context, sql string) ([]Incident, error) {
+	rows, err := s.db.Query(ctx, sql)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Incident{}
+	for rows.Next() {
+		inc, err := scanIncident(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *inc)
+	}
+	return out, rows.Err()
+}
+
+func scanIncident(row pgx.Row) (*Incident, error) {
+	var inc Incident
+	if err := row.Scan(&inc.ID, &inc.City, &inc.Message, &inc.Severity,
+		&inc.CreatedBy, &inc.CreatedAt, &inc.ResolvedAt); err != nil {
+		return nil, err
+	}
+	return &inc, nil
+}
+
+var rank = map[string]int{Operational: 0, SeverityInfo: 0, Degraded: 1, Outage: 2}
+
+// worst returns the more severe of two health levels. Info incidents never
+// raise the level.
+func worst(a, b string) string {
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,243 @@
+package support
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+)
+
+// Handler exposes trip notes, support tickets and staff search.
+type Handler struct{ svc *Service }
+
+// NewHandler wires a handler to the support service.
+func NewHandler(svc *Service) *Handler { return &Handler{svc: svc} }
+
+// NoteRoutes returns the trip note routes, mounted at /admin/trips/{id}/notes.
+func (h *Handler) NoteRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+	r.Use(jwt.RequireRole("admin", "support"))
+
+	r.Get("/", h.ListNotes)
+	r.Post("/", h.AddNote)
+
+	return r
+}
+
+// SearchRoutes returns the search route, mounted at /admin/search.
+func (h *Handler) SearchRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+	r.Use(jwt.RequireRole("admin", "support"))
+
+	r.Get("/", h.Search)
+
+	return r
+}
+
+// TicketRoutes returns the routes mounted at /support/tickets, where riders
+// and drivers raise and follow their own tickets.
+func (h *Handler) TicketRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+	r.Use(jwt.RequireRole("rider", "driver"))
+
+	r.Get("/", h.MyTickets)
+	r.Post("/", h.OpenTicket)
+	h.ticketRoutes(r)
+
+	return r
+}
+
+// AdminTicketRoutes returns the agents' routes, mounted at
+// /admin/support/tickets.
+func (h *Handler) AdminTicketRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+	r.Use(jwt.RequireRole("admin", "support"))
+
+	r.Get("/", h.ListTickets)
+	r.Patch("/{ticketID}", h.UpdateTicket)
+	h.ticketRoutes(r)
+
+	return r
+}
+
+// ticketRoutes are the routes on one ticket both sides share.
+func (h *Handler) ticketRoutes(r chi.Router) {
+	r.Get("/{ticketID}", h.Ticket)
+	r.Post("/{ticketID}/messages", h.Reply)
+	r.Post("/{ticketID}/attachments", h.Attach)
+	r.Get("/{ticketID}/attachments/{attachmentID}", h.Attachment)
+}
+
+func (h *Handler) OpenTicket(w http.ResponseWriter, r *http.Request) {
+	var req TicketRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	claims := jwt.GetClaims(r.Context())
+	t, err := h.svc.OpenTicket(r.Context(), claims.UserID, claims.Role, req)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusCreated, t)
+}
+
+func (h *Handler) MyTickets(w http.ResponseWriter, r *http.Request) {
+	tickets, err := h.svc.Tickets(r.Context(), jwt.GetClaims(r.Context()).UserID)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]any{"tickets": tickets})
+}
+
+func (h *Handler) Ticket(w http.ResponseWriter, r *http.Request) {
+	claims := jwt.GetClaims(r.Context())
+	t, err := h.svc.Ticket(r.Context(), chi.URLParam(r, "ticketID"), claims.UserID, claims.Role)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, t)
+}
+
+func (h *Handler) Reply(w http.ResponseWriter, r *http.Request) {
+	var req MessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	claims := jwt.GetClaims(r.Context())
+	m, err := h.svc.Reply(r.Context(), chi.URLParam(r, "ticketID"), claims.UserID, claims.Role, req)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusCreated, m)
+}
+
+// Attach accepts the raw file (PDF, JPEG or PNG) as the request body.
+func (h *Handler) Attach(w http.ResponseWriter, r *http.Request) {
+	claims := jwt.GetClaims(r.Context())
+	body := http.MaxBytesReader(w, r.Body, MaxAttachmentBytes)
+	a, err := h.svc.Attach(r.Context(), chi.URLParam(r, "ticketID"), claims.UserID, claims.Role, body)
+	if err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			apierror.Write(w, apierror.New(http.StatusRequestEntityTooLarge, apierror.CodeTooLarge, "attachment too large"))
+			return
+		}
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusCreated, a)
+}
+
+func (h *Handler) Attachment(w http.ResponseWriter, r *http.Request) {
+	claims := jwt.GetClaims(r.Context())
+	rc, a, err := h.svc.OpenAttachment(r.Context(), chi.URLParam(r, "ticketID"), chi.URLParam(r, "attachmentID"),
+		claims.UserID, claims.Role)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	defer rc.Close()
+	w.Header().Set("Content-Type", mime.TypeByExtension(path.Ext(a.BlobKey)))
+	w.Header().Set("Cache-Control", "private, no-store")
+	if _, err := io.Copy(w, rc); err != nil {
+		logger.Warn("attachment stream failed", "attachment", a.ID, "err", err)
+	}
+}
+
+// ListTickets serves GET /admin/support/tickets?status=&assignee_id=&breached=&limit=&offset=.
+func (h *Handler) ListTickets(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	f := TicketFilter{Status: q.Get("status"), AssigneeID: q.Get("assignee_id"), Breached: q.Get("breached") == "true"}
+	limit := 50
+	if v, err := strconv.Atoi(q.Get("limit")); err == nil && v > 0 && v <= 200 {
+		limit = v
+	}
+	offset := 0
+	if v, err := strconv.Atoi(q.Get("offset")); err == nil && v > 0 {
+		offset = v
+	}
+	page, err := h.svc.ListTickets(r.Context(), f, limit, offset)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, page)
+}
+
+func (h *Handler) UpdateTicket(w http.ResponseWriter, r *http.Request) {
+	var u TicketUpdate
+	if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	claims := jwt.GetClaims(r.Context())
+	t, err := h.svc.UpdateTicket(r.Context(), chi.URLParam(r, "ticketID"), claims.UserID, claims.Role, u)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, t)
+}
+
+func (h *Handler) AddNote(w http.ResponseWriter, r *http.Request) {
+	var req NoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	claims := jwt.GetClaims(r.Context())
+	n, err := h.svc.AddNote(r.Context(), chi.URLParam(r, "id"), claims.UserID, claims.Role, req)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusCreated, n)
+}
+
+func (h *Handler) ListNotes(w http.ResponseWriter, r *http.Request) {
+	claims := jwt.GetClaims(r.Context())
+	notes, err := h.svc.ListNotes(r.Context(), chi.URLParam(r, "id"), claims.Role)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]any{"notes": notes})
+}
+
+// Search serves GET /admin/search?q=&limit=&offset=.
+func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := 20
+	if v, err := strconv.Atoi(q.Get("limit")); err == nil && v > 0 && v <= 100 {
+		limit = v
+	}
+	offset := 0
+	if v, err := strconv.Atoi(q.Get("offset")); err == nil && v > 0 {
+		offset = v
+	}
+	claims := jwt.GetClaims(r.Context())
+	results, err := h.svc.Search(r.Context(), q.Get("q"), claims.Role, limit, offset)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]any{"results": results})
+}
@@ -0,0 +1,141 @@
+package support
+
+import "time"
+
+// Note visibility. Support agents see support notes; admins see both.
+const (
+	VisibilitySupport = "support"
+	VisibilityAdmin   = "admin"
+)
+
+// Result kinds returned by search: trip notes and ticket messages.
+const (
+	KindTripNote      = "trip_note"
+	KindTicketMessage = "ticket_message"
+)
+
+// Ticket statuses. A ticket is open while it waits on staff and pending
+// while it waits on the requester, whose reply opens it again (a resolved
+// one too). Staff resolve and close tickets; closed ones take no messages.
+const (
+	TicketOpen     = "open"
+	TicketPending  = "pending"
+	TicketResolved = "resolved"
+	TicketClosed   = "closed"
+)
+
+// TicketStatuses lists every ticket status.
+var TicketStatuses = []string{TicketOpen, TicketPending, TicketResolved, TicketClosed}
+
+// Note is an internal annotation on a trip, written by staff.
+type Note struct {
+	ID         string    `json:"id"`
+	TripID     string    `json:"trip_id"`
+	AuthorID   string    `json:"author_id"`
+	Visibility string    `json:"visibility"`
+	Body       string    `json:"body"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// NoteRequest is the body for POST /admin/trips/:id/notes.
+type NoteRequest struct {
+	Body       string `json:"body"`
+	Visibility string `json:"visibility"` // defaults to support
+}
+
+// Ticket is a rider's or driver's support request. Messages and
+// Attachments are only filled for a single ticket, and SLA only for staff.
+type Ticket struct {
+	ID              string       `json:"id"`
+	RequesterID     string       `json:"requester_id"`
+	RequesterRole   string       `json:"requester_role"` // rider | driver
+	TripID          *string      `json:"trip_id,omitempty"`
+	Subject         string       `json:"subject"`
+	Status          string       `json:"status"`
+	AssigneeID      *string      `json:"assignee_id,omitempty"`
+	FirstResponseAt *time.Time   `json:"first_response_at,omitempty"`
+	ResolvedAt      *time.Time   `json:"resolved_at,omitempty"`
+	CreatedAt       time.Time    `json:"created_at"`
+	UpdatedAt       time.Time    `json:"updated_at"`
+	SLA             *SLA         `json:"sla,omitempty"`
+	Messages        []Message    `json:"messages,omitempty"`
+	Attachments     []Attachment `json:"attachments,omitempty"`
+}
+
+// SLA is how a ticket stands against the service levels. A target is
+// breached once its due time passed without a staff answer or a
+// resolution, or if it came late.
+type SLA struct {
+	FirstResponseDue      time.Time `json:"first_response_due"`
+	ResolutionDue         time.Time `json:"resolution_due"`
+	FirstResponseBreached bool      `json:"first_response_breached"`
+	ResolutionBreached    bool      `json:"resolution_breached"`
+	// NextDue is the earliest due time still outstanding, unset once the
+	// ticket is answered and resolved.
+	NextDue *time.Time `json:"next_due,omitempty"`
+}
+
+// Message is one entry in a ticket's thread.
+type Message struct {
+	ID         string    `json:"id"`
+	AuthorID   string    `json:"author_id"`
+	AuthorRole string    `json:"author_role"` // rider | driver | admin | support
+	Body       string    `json:"body"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Attachment is a file added to a ticket.
+type Attachment struct {
+	ID          string    `json:"id"`
+	UploaderID  string    `json:"uploader_id"`
+	ContentType string    `json:"content_type"`
+	SizeBytes   int64     `json:"size_bytes"`
+	CreatedAt   time.Time `json:"created_at"`
+	BlobKey     string    `json:"-"`
+}
+
+// TicketRequest is the body for POST /support/tickets.
+type TicketRequest struct {
+	Subject string `json:"subject" validate:"required,maxLength=200"`
+	Body    string `json:"body" validate:"required,maxLength=5000"`
+	TripID  string `json:"trip_id" validate:"format=uuid"` // optional; the requester must have been on the trip
+}
+
+// MessageRequest is the body for posting to a ticket's thread.
+type MessageRequest struct {
+	Body string `json:"body" validate:"required,maxLength=5000"`
+}
+
+// TicketUpdate is the body for PATCH /admin/support/tickets/:id. Absent
+// fields are left as they are; an empty assignee_id unassigns.
+type TicketUpdate struct {
+	Status     *string `json:"status"`
+	AssigneeID *string `json:"assignee_id" validate:"format=uuid"`
+}
+
+// TicketFilter narrows GET /admin/support/tickets. Empty fields match
+// everything.
+type TicketFilter struct {
+	Status     string
+	AssigneeID string
+	Breached   bool // only tickets past a due time still outstanding
+}
+
+// TicketPage is a page of GET /admin/support/tickets, most urgent first.
+type TicketPage struct {
+	Tickets []Ticket `json:"tickets"`
+	Total   int      `json:"total"`
+	Limit   int      `json:"limit"`
+	Offset  int      `json:"offset"`
+}
+
+// Result is one search hit. Snippet highlights matched terms with <b>…</b>.
+type Result struct {
+	Kind      string    `json:"kind"`
+	ID        string    `json:"id"`
+	TripID    string    `json:"trip_id,omitempty"`
+	TicketID  string    `json:"ticket_id,omitempty"`
+	Snippet   string    `json:"snippet"`
+	Rank      float32   `json:"rank"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,159 @@
+package support
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/internal/trips"
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/blob"
+	"ride-service/pkg/config"
+	"ride-service/pkg/logging"
+)
+
+var logger = logging.For("support")
+
+var (
+	ErrTripNotFound = apierror.NotFound("trip not found")
+	ErrForbidden    = apierror.Forbidden("not allowed for this role")
+	ErrInvalid      = apierror.Validation("invalid request")
+)
+
+// MaxNoteLength caps a note body.
+const MaxNoteLength = 5000
+
+// TripReader returns trips; trips.TripRepo implements it.
+type TripReader interface {
+	GetByID(ctx context.Context, id string) (*trips.Trip, error)
+}
+
+// Service stores trip notes and support tickets, and searches
+// staff-visible text.
+type Service struct {
+	db    *pgxpool.Pool
+	trips TripReader
+	blobs blob.Store // ticket attachments
+	sla   config.Support
+}
+
+// NewService creates a support service. New tickets are due by sla.
+func NewService(db *pgxpool.Pool, t TripReader, blobs blob.Store, sla config.Support) *Service {
+	return &Service{db: db, trips: t, blobs: blobs, sla: sla}
+}
+
+// visible returns the note visibilities role may read.
+func visible(role string) []string {
+	if role == "admin" {
+		return []string{VisibilitySupport, VisibilityAdmin}
+	}
+	return []string{VisibilitySupport}
+}
+
+func allowed(role, visibility string) bool {
+	for _, v := range visible(role) {
+		if v == visibility {
+			return true
+		}
+	}
+	return false
+}
+
+// AddNote annotates a trip. Support agents can only write support-visible notes.
+func (s *Service) AddNote(ctx context.Context, tripID, authorID, role string, req NoteRequest) (*Note, error) {
+	req.Body = strings.TrimSpace(req.Body)
+	if req.Visibility == "" {
+		req.Visibility = VisibilitySupport
+	}
+	switch {
+	case req.Body == "":
+		return nil, fmt.Errorf("%w: body is required", ErrInvalid)
+	case len(req.Body) > MaxNoteLength:
+		return nil, fmt.Errorf("%w: body exceeds %d characters", ErrInvalid, MaxNoteLength)
+	case req.Visibility != VisibilitySupport && req.Visibility != VisibilityAdmin:
+		return nil, fmt.Errorf("%w: visibility must be support or admin", ErrInvalid)
+	case !allowed(role, req.Visibility):
+		return nil, ErrForbidden
+	}
+
+	n := &Note{ID: uuid.New().String(), TripID: tripID, AuthorID: authorID, Visibility: req.Visibility, Body: req.Body}
+	err := s.db.QueryRow(ctx,
+		`INSERT INTO trip_notes (id,trip_id,author_id,visibility,body) VALUES ($1,$2,$3,$4,$5)
+		 RETURNING created_at`,
+		n.ID, tripID, authorID, n.Visibility, n.Body).Scan(&n.CreatedAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && (pgErr.Code == "23503" || pgErr.Code == "22P02") { // FK violation / malformed uuid
+		return nil, ErrTripNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// ListNotes returns a trip's notes visible to role, oldest first.
+func (s *Service) ListNotes(ctx context.Context, tripID, role string) ([]Note, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT id,trip_id,author_id,visibility,body,created_at FROM trip_notes
+		 WHERE trip_id=$1 AND visibility = ANY($2) ORDER BY created_at`,
+		tripID, visible(role))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Note{}
+	for rows.Next() {
+		var n Note
+		if err := rows.Scan(&n.ID, &n.TripID, &n.AuthorID, &n.Visibility, &n.Body, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+	}
+	return out, rows.Err()
+}
+
+// Search runs a web-style query ("quoted phrases", -exclusions, or) over the
+// text role may read, trip notes and ticket messages, best matches first.
+func (s *Service) Search(ctx context.Context, query, role string, limit, offset int) ([]Result, error) {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return nil, fmt.Errorf("%w: q is required", ErrInvalid)
+	}
+
+	rows, err := s.db.Query(ctx,
+		`SELECT $1::text, n.id, n.trip_id::text, '',
+		        ts_headline('english', n.body, q, 'StartSel=<b>,StopSel=</b>,MaxFragments=2'),
+		        ts_rank(n.search, q), n.created_at
+		 FROM trip_notes n, websearch_to_tsquery('english', $2) q
+		 WHERE n.search @@ q AND n.visibility = ANY($3)
+		 UNION ALL
+		 SELECT $6::text, m.id, COALESCE(t.trip_id::text,''), m.ticket_id::text,
+		        ts_headline('english', m.body, q, 'StartSel=<b>,StopSel=</b>,MaxFragments=2'),
+		        ts_rank(m.search, q), m.created_at
+		 FROM support_ticket_messages m JOIN support_tickets t ON t.id = m.ticket_id,
+		      websearch_to_tsquery('english', $2) q
+		 WHERE m.search @@ q
+		 ORDER BY 6 DESC, 7 DESC
+		 LIMIT $4 OFFSET $5`,
+		KindTripNote, query, visible(role), limit, offset, KindTicketMessage)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Result{}
+	for rows.Next() {
+		var r Result
+		if err := rows.Scan(&r.Kind, &r.ID, &r.TripID, &r.TicketID, &r.Snippet, &r.Rank, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
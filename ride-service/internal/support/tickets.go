@@ -0,0 +1,429 @@
+package support
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+
+	"ride-service/internal/trips"
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/db"
+	"ride-service/pkg/validation"
+)
+
+var (
+	ErrTicketNotFound = apierror.NotFound("ticket not found")
+	ErrNoAttachment   = apierror.NotFound("attachment not found")
+	ErrNotParticipant = apierror.Forbidden("not a participant in this trip")
+	ErrTicketClosed   = apierror.Conflict("ticket is closed")
+	ErrUnsupported    = apierror.New(http.StatusUnsupportedMediaType, apierror.CodeUnsupportedMediaType, "attachment must be pdf, jpeg or png")
+	ErrTooManyFiles   = apierror.Conflict("ticket has too many attachments")
+)
+
+// MaxAttachmentBytes caps a single attachment.
+const MaxAttachmentBytes = 10 << 20
+
+// maxAttachments caps the files on one ticket.
+const maxAttachments = 20
+
+var attachmentExt = map[string]string{
+	"application/pdf": ".pdf",
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+}
+
+const ticketColumns = `id,requester_id,requester_role,trip_id,subject,status,assignee_id,first_response_at,resolved_at,
+		        created_at,updated_at,first_response_due,resolution_due`
+
+// isStaff reports whether role answers tickets.
+func isStaff(role string) bool { return role == "admin" || role == "support" }
+
+// OpenTicket files a ticket for a rider or driver, with req.Body as its
+// first message. A linked trip must be one the requester was on.
+func (s *Service) OpenTicket(ctx context.Context, userID, role string, req TicketRequest) (*Ticket, error) {
+	if role != "rider" && role != "driver" {
+		return nil, ErrForbidden
+	}
+	req.Subject, req.Body = strings.TrimSpace(req.Subject), strings.TrimSpace(req.Body)
+	if err := validation.Struct(req); err != nil {
+		return nil, err
+	}
+	if req.TripID != "" {
+		t, err := s.trips.GetByID(ctx, req.TripID)
+		if errors.Is(err, trips.ErrNotFound) {
+			return nil, ErrTripNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		if t.RiderID != userID && (t.DriverID == nil || *t.DriverID != userID) {
+			return nil, ErrNotParticipant
+		}
+	}
+
+	now := time.Now()
+	var t *Ticket
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		var err error
+		t, err = scanTicket(tx.QueryRow(ctx,
+			`INSERT INTO support_tickets (id,requester_id,requester_role,trip_id,subject,status,first_response_due,resolution_due)
+			 VALUES ($1,$2,$3,NULLIF($4,'')::uuid,$5,$6,$7,$8) RETURNING `+ticketColumns,
+			uuid.NewString(), userID, role, req.TripID, req.Subject, TicketOpen,
+			now.Add(s.sla.FirstResponse), now.Add(s.sla.Resolution)), false)
+		if err != nil {
+			return err
+		}
+		m, err := addMessage(ctx, tx, t.ID, userID, role, req.Body)
+		if err != nil {
+			return err
+		}
+		t.Messages = []Message{*m}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("ticket opened", "ticket", t.ID, "requester", userID, "trip", req.TripID)
+	return t, nil
+}
+
+// Tickets returns the requester's tickets, newest first.
+func (s *Service) Tickets(ctx context.Context, userID string) ([]Ticket, error) {
+	return s.queryTickets(ctx, false,
+		`SELECT `+ticketColumns+` FROM support_tickets WHERE requester_id=$1 ORDER BY created_at DESC`, userID)
+}
+
+// Ticket returns one ticket with its thread and attachments, to its
+// requester or to staff.
+func (s *Service) Ticket(ctx context.Context, id, userID, role string) (*Ticket, error) {
+	t, err := s.ticket(ctx, id, userID, role)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(ctx,
+		`SELECT id,author_id,author_role,body,created_at FROM support_ticket_messages
+		 WHERE ticket_id=$1 ORDER BY created_at, id`, id)
+	if err != nil {
+		return nil, err
+	}
+	t.Messages, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (Message, error) {
+		var m Message
+		err := row.Scan(&m.ID, &m.AuthorID, &m.AuthorRole, &m.Body, &m.CreatedAt)
+		return m, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if t.Attachments, err = s.attachments(ctx, id); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Reply adds a message to a ticket's thread. The requester's reply opens it
+// again for staff; a staff reply counts as the first response if it is one,
+// and leaves an open ticket pending on the requester.
+func (s *Service) Reply(ctx context.Context, id, userID, role string, req MessageRequest) (*Message, error) {
+	req.Body = strings.TrimSpace(req.Body)
+	var m *Message
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		t, err := s.lockTicket(ctx, tx, id, userID, role)
+		if err != nil {
+			return err
+		}
+		if t.Status == TicketClosed {
+			return ErrTicketClosed
+		}
+		if m, err = addMessage(ctx, tx, id, userID, role, req.Body); err != nil {
+			return err
+		}
+		if isStaff(role) {
+			_, err = tx.Exec(ctx,
+				`UPDATE support_tickets SET first_response_at=COALESCE(first_response_at,NOW()),
+				        status=CASE WHEN status=$2 THEN $3 ELSE status END, updated_at=NOW()
+				 WHERE id=$1`, id, TicketOpen, TicketPending)
+		} else {
+			_, err = tx.Exec(ctx,
+				`UPDATE support_tickets SET status=$2, resolved_at=NULL, updated_at=NOW() WHERE id=$1`, id, TicketOpen)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Attach stores a file on a ticket. Its type is sniffed from the content.
+func (s *Service) Attach(ctx context.Context, id, userID, role string, r io.Reader) (*Attachment, error) {
+	t, err := s.ticket(ctx, id, userID, role)
+	if err != nil {
+		return nil, err
+	}
+	if t.Status == TicketClosed {
+		return nil, ErrTicketClosed
+	}
+	var n int
+	if err := s.db.QueryRow(ctx, `SELECT COUNT(*) FROM support_ticket_attachments WHERE ticket_id=$1`, id).Scan(&n); err != nil {
+		return nil, err
+	}
+	if n >= maxAttachments {
+		return nil, ErrTooManyFiles
+	}
+
+	head := make([]byte, 512)
+	read, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, ErrUnsupported
+	}
+	contentType := http.DetectContentType(head[:read])
+	ext, ok := attachmentExt[contentType]
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	a := &Attachment{ID: uuid.NewString(), UploaderID: userID, ContentType: contentType}
+	a.BlobKey = "support/" + id + "/" + a.ID + ext
+	counted := &countingReader{r: io.MultiReader(bytes.NewReader(head[:read]), r)}
+	if err := s.blobs.Put(ctx, a.BlobKey, counted); err != nil {
+		return nil, err
+	}
+	a.SizeBytes = counted.n
+	err = s.db.QueryRow(ctx,
+		`INSERT INTO support_ticket_attachments (id,ticket_id,uploader_id,blob_key,content_type,size_bytes)
+		 VALUES ($1,$2,$3,$4,$5,$6) RETURNING created_at`,
+		a.ID, id, userID, a.BlobKey, a.ContentType, a.SizeBytes).Scan(&a.CreatedAt)
+	if err != nil {
+		_ = s.blobs.Delete(ctx, a.BlobKey)
+		return nil, err
+	}
+	return a, nil
+}
+
+// OpenAttachment returns an attachment's file. The caller must close the
+// reader.
+func (s *Service) OpenAttachment(ctx context.Context, id, attachmentID, userID, role string) (io.ReadCloser, *Attachment, error) {
+	if _, err := s.ticket(ctx, id, userID, role); err != nil {
+		return nil, nil, err
+	}
+	if _, err := uuid.Parse(attachmentID); err != nil {
+		return nil, nil, ErrNoAttachment
+	}
+	var a Attachment
+	err := s.db.QueryRow(ctx,
+		`SELECT id,uploader_id,content_type,size_bytes,created_at,blob_key FROM support_ticket_attachments
+		 WHERE id=$1 AND ticket_id=$2`, attachmentID, id).
+		Scan(&a.ID, &a.UploaderID, &a.ContentType, &a.SizeBytes, &a.CreatedAt, &a.BlobKey)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil, ErrNoAttachment
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	rc, err := s.blobs.Get(ctx, a.BlobKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return rc, &a, nil
+}
+
+// UpdateTicket changes a ticket's status or assignee, for staff. Resolving
+// or closing it records when; opening it again clears that.
+func (s *Service) UpdateTicket(ctx context.Context, id, userID, role string, u TicketUpdate) (*Ticket, error) {
+	if err := validation.Struct(u); err != nil {
+		return nil, err
+	}
+	if u.Status != nil && !slices.Contains(TicketStatuses, *u.Status) {
+		return nil, fmt.Errorf("%w: status must be one of %s", ErrInvalid, strings.Join(TicketStatuses, ", "))
+	}
+	var t *Ticket
+	err := db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		before, err := s.lockTicket(ctx, tx, id, userID, role)
+		if err != nil {
+			return err
+		}
+		status, assignee := before.Status, before.AssigneeID
+		if u.Status != nil {
+			status = *u.Status
+		}
+		if u.AssigneeID != nil {
+			assignee = u.AssigneeID
+			if *assignee == "" {
+				assignee = nil
+			}
+		}
+		t, err = scanTicket(tx.QueryRow(ctx,
+			`UPDATE support_tickets SET status=$2, assignee_id=$3, updated_at=NOW(),
+			        resolved_at=CASE WHEN $2 IN ($4,$5) THEN COALESCE(resolved_at,NOW()) END
+			 WHERE id=$1 RETURNING `+ticketColumns,
+			id, status, assignee, TicketResolved, TicketClosed), true)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// ListTickets returns tickets for staff, most urgent first: those with the
+// earliest outstanding due time, then the rest by age.
+func (s *Service) ListTickets(ctx context.Context, f TicketFilter, limit, offset int) (*TicketPage, error) {
+	if f.Status != "" && !slices.Contains(TicketStatuses, f.Status) {
+		return nil, fmt.Errorf("%w: unknown status %q", ErrInvalid, f.Status)
+	}
+	if f.AssigneeID != "" {
+		if _, err := uuid.Parse(f.AssigneeID); err != nil {
+			return nil, fmt.Errorf("%w: assignee_id must be a UUID", ErrInvalid)
+		}
+	}
+	where := `($1='' OR status=$1) AND ($2='' OR assignee_id::text=$2) AND (NOT $3 OR ` + nextDue + ` < NOW())`
+	args := []any{f.Status, f.AssigneeID, f.Breached}
+	p := &TicketPage{Limit: limit, Offset: offset}
+	if err := s.db.QueryRow(ctx, `SELECT COUNT(*) FROM support_tickets WHERE `+where, args...).Scan(&p.Total); err != nil {
+		return nil, err
+	}
+	tickets, err := s.queryTickets(ctx, true,
+		`SELECT `+ticketColumns+` FROM support_tickets WHERE `+where+`
+		 ORDER BY `+nextDue+` NULLS LAST, created_at, id LIMIT $4 OFFSET $5`,
+		append(args, limit, offset)...)
+	if err != nil {
+		return nil, err
+	}
+	p.Tickets = tickets
+	return p, nil
+}
+
+// nextDue is the earliest due time a ticket has yet to meet, or NULL.
+const nextDue = `LEAST(CASE WHEN first_response_at IS NULL THEN first_response_due END,
+		        CASE WHEN resolved_at IS NULL THEN resolution_due END)`
+
+// ticket loads a ticket for its requester or staff; others get
+// ErrTicketNotFound, so ticket IDs reveal nothing.
+func (s *Service) ticket(ctx context.Context, id, userID, role string) (*Ticket, error) {
+	return s.loadTicket(ctx, s.db, `SELECT `+ticketColumns+` FROM support_tickets WHERE id=$1`, id, userID, role)
+}
+
+// lockTicket is ticket inside tx, holding the row until it ends.
+func (s *Service) lockTicket(ctx context.Context, tx pgx.Tx, id, userID, role string) (*Ticket, error) {
+	return s.loadTicket(ctx, tx, `SELECT `+ticketColumns+` FROM support_tickets WHERE id=$1 FOR UPDATE`, id, userID, role)
+}
+
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func (s *Service) loadTicket(ctx context.Context, q querier, sql, id, userID, role string) (*Ticket, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrTicketNotFound
+	}
+	t, err := scanTicket(q.QueryRow(ctx, sql, id), isStaff(role))
+	if errors.Is(err, pgx.ErrNoRows) || err == nil && !isStaff(role) && t.RequesterID != userID {
+		return nil, ErrTicketNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (s *Service) queryTickets(ctx context.Context, staff bool, sql string, args ...any) ([]Ticket, error) {
+	rows, err := s.db.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Ticket{}
+	for rows.Next() {
+		t, err := scanTicket(rows, staff)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *t)
+	}
+	return out, rows.Err()
+}
+
+func (s *Service) attachments(ctx context.Context, id string) ([]Attachment, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT id,uploader_id,content_type,size_bytes,created_at,blob_key FROM support_ticket_attachments
+		 WHERE ticket_id=$1 ORDER BY created_at, id`, id)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (Attachment, error) {
+		var a Attachment
+		err := row.Scan(&a.ID, &a.UploaderID, &a.ContentType, &a.SizeBytes, &a.CreatedAt, &a.BlobKey)
+		return a, err
+	})
+}
+
+func addMessage(ctx context.Context, tx pgx.Tx, ticketID, authorID, role, body string) (*Message, error) {
+	if body == "" {
+		return nil, fmt.Errorf("%w: body is required", ErrInvalid)
+	}
+	if len(body) > MaxNoteLength {
+		return nil, fmt.Errorf("%w: body exceeds %d characters", ErrInvalid, MaxNoteLength)
+	}
+	m := &Message{ID: uuid.NewString(), AuthorID: authorID, AuthorRole: role, Body: body}
+	err := tx.QueryRow(ctx,
+		`INSERT INTO support_ticket_messages (id,ticket_id,author_id,author_role,body) VALUES ($1,$2,$3,$4,$5)
+		 RETURNING created_at`, m.ID, ticketID, authorID, role, body).Scan(&m.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// scanTicket reads ticketColumns, filling in the SLA for staff.
+func scanTicket(row pgx.Row, staff bool) (*Ticket, error) {
+	var t Ticket
+	var firstDue, resolveDue time.Time
+	err := row.Scan(&t.ID, &t.RequesterID, &t.RequesterRole, &t.TripID, &t.Subject, &t.Status, &t.AssigneeID,
+		&t.FirstResponseAt, &t.ResolvedAt, &t.CreatedAt, &t.UpdatedAt, &firstDue, &resolveDue)
+	if err != nil {
+		return nil, err
+	}
+	if staff {
+		t.SLA = slaAt(time.Now(), firstDue, resolveDue, t.FirstResponseAt, t.ResolvedAt)
+	}
+	return &t, nil
+}
+
+// slaAt is the SLA of a ticket at now.
+func slaAt(now, firstDue, resolveDue time.Time, firstResponse, resolved *time.Time) *SLA {
+	sla := &SLA{FirstResponseDue: firstDue, ResolutionDue: resolveDue}
+	sla.FirstResponseBreached = breached(now, firstDue, firstResponse)
+	sla.ResolutionBreached = breached(now, resolveDue, resolved)
+	if firstResponse == nil {
+		sla.NextDue = &sla.FirstResponseDue
+	} else if resolved == nil {
+		sla.NextDue = &sla.ResolutionDue
+	}
+	return sla
+}
+
+func breached(now, due time.Time, met *time.Time) bool {
+	if met == nil {
+		return now.After(due)
+	}
+	return met.After(due)
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
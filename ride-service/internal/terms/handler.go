@@ -0,0 +1,53 @@
+package terms
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+)
+
+// Handler exposes the terms versions and acceptances.
+type Handler struct{ svc *Service }
+
+// NewHandler wires a handler to the terms service.
+func NewHandler(svc *Service) *Handler { return &Handler{svc: svc} }
+
+// Routes returns the routes mounted at /terms.
+func (h *Handler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Get("/", h.Status)
+	r.With(jwt.RequireAuth).Post("/accept", h.Accept)
+	return r
+}
+
+// Status serves GET /terms; a signed-in caller also sees their acceptances.
+func (h *Handler) Status(w http.ResponseWriter, r *http.Request) {
+	var accountID string
+	if claims := jwt.GetClaims(r.Context()); claims != nil {
+		accountID = claims.UserID
+	}
+	st, err := h.svc.Status(r.Context(), accountID)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, st)
+}
+
+func (h *Handler) Accept(w http.ResponseWriter, r *http.Request) {
+	var req AcceptRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	st, err := h.svc.Accept(r.Context(), jwt.GetClaims(r.Context()).UserID, req)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, st)
+}
@@ -0,0 +1,33 @@
+package terms
+
+import "time"
+
+// Documents an account accepts.
+const (
+	Terms   = "terms"   // terms of service
+	Privacy = "privacy" // privacy policy
+)
+
+// Acceptance is one version of a document an account accepted.
+type Acceptance struct {
+	Document   string    `json:"document"` // terms | privacy
+	Version    string    `json:"version"`
+	AcceptedAt time.Time `json:"accepted_at"`
+}
+
+// Status is GET /terms: the current versions and, for a signed-in caller,
+// what they accepted and whether it is up to date.
+type Status struct {
+	TermsVersion   string       `json:"terms_version,omitempty"`
+	PrivacyVersion string       `json:"privacy_version,omitempty"`
+	Accepted       []Acceptance `json:"accepted,omitempty"` // newest first
+	Current        *bool        `json:"current,omitempty"`  // nil without a caller
+}
+
+// AcceptRequest is the body for POST /terms/accept and the optional fields
+// of a registration: the versions the account accepts, which must be the
+// current ones.
+type AcceptRequest struct {
+	TermsVersion   string `json:"terms_version" validate:"maxLength=20"`
+	PrivacyVersion string `json:"privacy_version" validate:"maxLength=20"`
+}
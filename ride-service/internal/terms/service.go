@@ -0,0 +1,150 @@
+package terms
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/config"
+	"ride-service/pkg/jwt"
+	"ride-service/pkg/logging"
+)
+
+var logger = logging.For("terms")
+
+var (
+	ErrInvalid = apierror.Validation("invalid acceptance")
+	// ErrNotAccepted stops a rider or driver who has not accepted the
+	// current versions from changing trips.
+	ErrNotAccepted = apierror.New(http.StatusPreconditionRequired, "terms_not_accepted",
+		"accept the current terms of service and privacy policy first (POST /terms/accept)")
+)
+
+// Service records which versions of the terms of service and the privacy
+// policy each account accepted, and holds back accounts whose acceptance is
+// out of date.
+type Service struct {
+	db  *pgxpool.Pool
+	cfg config.Terms
+}
+
+// NewService creates a terms service enforcing the versions in cfg.
+func NewService(db *pgxpool.Pool, cfg config.Terms) *Service {
+	return &Service{db: db, cfg: cfg}
+}
+
+// Check reports whether termsVersion and privacyVersion are the versions in
+// force, as an acceptance must name them.
+func (s *Service) Check(termsVersion, privacyVersion string) error {
+	if termsVersion != s.cfg.TermsVersion {
+		return fmt.Errorf("%w: terms_version must be the current version %q", ErrInvalid, s.cfg.TermsVersion)
+	}
+	if privacyVersion != s.cfg.PrivacyVersion {
+		return fmt.Errorf("%w: privacy_version must be the current version %q", ErrInvalid, s.cfg.PrivacyVersion)
+	}
+	return nil
+}
+
+// Record stores an acceptance Check allowed. Accepting a version again
+// keeps the first acceptance.
+func (s *Service) Record(ctx context.Context, accountID, termsVersion, privacyVersion string) error {
+	for doc, v := range map[string]string{Terms: termsVersion, Privacy: privacyVersion} {
+		if v == "" {
+			continue
+		}
+		if _, err := s.db.Exec(ctx,
+			`INSERT INTO terms_acceptances (account_id,document,version) VALUES ($1,$2,$3) ON CONFLICT DO NOTHING`,
+			accountID, doc, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Accept records that accountID accepted the current versions.
+func (s *Service) Accept(ctx context.Context, accountID string, req AcceptRequest) (*Status, error) {
+	if err := s.Check(req.TermsVersion, req.PrivacyVersion); err != nil {
+		return nil, err
+	}
+	if err := s.Record(ctx, accountID, req.TermsVersion, req.PrivacyVersion); err != nil {
+		return nil, err
+	}
+	logger.Info("terms accepted", "account", accountID, "terms", req.TermsVersion, "privacy", req.PrivacyVersion)
+	return s.Status(ctx, accountID)
+}
+
+// Status returns the versions in force and, unless accountID is empty,
+// what the account accepted.
+func (s *Service) Status(ctx context.Context, accountID string) (*Status, error) {
+	st := &Status{TermsVersion: s.cfg.TermsVersion, PrivacyVersion: s.cfg.PrivacyVersion}
+	if accountID == "" {
+		return st, nil
+	}
+	rows, err := s.db.Query(ctx,
+		`SELECT document, version, accepted_at FROM terms_acceptances WHERE account_id=$1
+		 ORDER BY accepted_at DESC, document`, accountID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var terms, privacy bool
+	for rows.Next() {
+		var a Acceptance
+		if err := rows.Scan(&a.Document, &a.Version, &a.AcceptedAt); err != nil {
+			return nil, err
+		}
+		terms = terms || a.Document == Terms && a.Version == s.cfg.TermsVersion
+		privacy = privacy || a.Document == Privacy && a.Version == s.cfg.PrivacyVersion
+		st.Accepted = append(st.Accepted, a)
+	}
+	current := (terms || s.cfg.TermsVersion == "") && (privacy || s.cfg.PrivacyVersion == "")
+	st.Current = &current
+	return st, rows.Err()
+}
+
+// Current reports whether accountID accepted the versions in force.
+func (s *Service) Current(ctx context.Context, accountID string) (bool, error) {
+	want := 0
+	for _, v := range []string{s.cfg.TermsVersion, s.cfg.PrivacyVersion} {
+		if v != "" {
+			want++
+		}
+	}
+	if want == 0 {
+		return true, nil
+	}
+	var n int
+	err := s.db.QueryRow(ctx,
+		`SELECT COUNT(*) FROM terms_acceptances
+		 WHERE account_id=$1 AND ((document=$2 AND version=$3) OR (document=$4 AND version=$5))`,
+		accountID, Terms, s.cfg.TermsVersion, Privacy, s.cfg.PrivacyVersion).Scan(&n)
+	return n >= want, err
+}
+
+// Require answers 428 with code terms_not_accepted to a signed-in rider or
+// driver whose acceptance is out of date, on every request that is not a
+// read. Staff and anonymous requests pass; the routes behind it still
+// authenticate. Mount it in front of routes that change trips.
+func (s *Service) Require(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := jwt.GetClaims(r.Context())
+		if claims == nil || claims.Role == "admin" || claims.Role == "support" ||
+			r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ok, err := s.Current(r.Context(), claims.UserID)
+		if err != nil {
+			apierror.Write(w, err)
+			return
+		}
+		if !ok {
+			apierror.Write(w, ErrNotAccepted)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,51 @@
+package tips
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+)
+
+// Handler exposes tipping to riders and drivers.
+type Handler struct{ svc *Service }
+
+// NewHandler wires a handler to the tip service.
+func NewHandler(svc *Service) *Handler { return &Handler{svc: svc} }
+
+// Routes returns the routes mounted at /trips/{id}/tip.
+func (h *Handler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+
+	r.Get("/", h.Get)
+	r.Post("/", h.Add)
+
+	return r
+}
+
+func (h *Handler) Add(w http.ResponseWriter, r *http.Request) {
+	var req TipRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	tip, err := h.svc.Add(r.Context(), chi.URLParam(r, "id"), jwt.GetClaims(r.Context()).UserID, req)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusCreated, tip)
+}
+
+func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
+	tip, err := h.svc.Get(r.Context(), chi.URLParam(r, "id"), jwt.GetClaims(r.Context()))
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, tip)
+}
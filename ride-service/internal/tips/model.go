@@ -0,0 +1,23 @@
+package tips
+
+import (
+	"time"
+
+	"ride-service/pkg/money"
+)
+
+// Tip is a rider's tip to the driver of a completed trip. It is credited to
+// the driver's wallet in full.
+type Tip struct {
+	TripID    string      `json:"trip_id"`
+	RiderID   string      `json:"rider_id"`
+	DriverID  string      `json:"driver_id"`
+	Amount    money.Money `json:"amount"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// TipRequest is the body for POST /trips/{id}/tip: a decimal in the major
+// unit of the trip's currency.
+type TipRequest struct {
+	Amount string `json:"amount" validate:"required,maxLength=20"`
+}
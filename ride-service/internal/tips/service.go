@@ -0,0 +1,162 @@
+package tips
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/internal/events"
+	"ride-service/internal/trips"
+	"ride-service/internal/trips/statemachine"
+	"ride-service/internal/wallet"
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/db"
+	"ride-service/pkg/eventbus"
+	"ride-service/pkg/jwt"
+	"ride-service/pkg/logging"
+	"ride-service/pkg/money"
+)
+
+var logger = logging.For("tips")
+
+var (
+	ErrTripNotFound   = apierror.NotFound("trip not found")
+	ErrNotFound       = apierror.NotFound("trip has no tip")
+	ErrNotParticipant = apierror.Forbidden("not a participant in this trip")
+	ErrForbidden      = apierror.Forbidden("only the trip's rider can tip")
+	ErrClosed         = apierror.Conflict("tips are only accepted on a completed trip within the tipping window")
+	ErrAlreadyTipped  = apierror.Conflict("trip already has a tip")
+	ErrInvalid        = apierror.Validation("invalid tip")
+)
+
+const columns = `trip_id,rider_id,driver_id,amount_minor,currency,created_at`
+
+// TripReader returns trips; trips.TripRepo implements it.
+type TripReader interface {
+	GetByID(ctx context.Context, id string) (*trips.Trip, error)
+}
+
+// Service takes riders' tips and credits them to drivers with no commission.
+type Service struct {
+	db     *pgxpool.Pool
+	trips  TripReader
+	bus    eventbus.Bus
+	window time.Duration
+}
+
+// NewService creates a tip service. Riders can tip up to window after
+// their trip completed.
+func NewService(db *pgxpool.Pool, t TripReader, bus eventbus.Bus, window time.Duration) *Service {
+	return &Service{db: db, trips: t, bus: bus, window: window}
+}
+
+// trip returns tripID, reporting a missing one as ErrTripNotFound.
+func (s *Service) trip(ctx context.Context, tripID string) (*trips.Trip, error) {
+	t, err := s.trips.GetByID(ctx, tripID)
+	if errors.Is(err, trips.ErrNotFound) {
+		return nil, ErrTripNotFound
+	}
+	return t, err
+}
+
+// Add tips the driver of the rider's completed trip. A trip takes one tip,
+// in the fare's currency and at most the fare. The tip and the wallet
+// credit are written together.
+func (s *Service) Add(ctx context.Context, tripID, userID string, req TipRequest) (*Tip, error) {
+	t, err := s.trip(ctx, tripID)
+	if err != nil {
+		return nil, err
+	}
+	if userID != t.RiderID {
+		if t.DriverID != nil && userID == *t.DriverID {
+			return nil, ErrForbidden
+		}
+		return nil, ErrNotParticipant
+	}
+	if t.Status != statemachine.Completed || t.DriverID == nil || t.Fare == nil ||
+		t.CompletedAt == nil || time.Since(*t.CompletedAt) > s.window {
+		return nil, ErrClosed
+	}
+	amount, err := money.Parse(req.Amount, t.Fare.Currency)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if amount.Amount <= 0 {
+		return nil, fmt.Errorf("%w: amount must be positive", ErrInvalid)
+	}
+	if amount.Amount > t.Fare.Amount {
+		return nil, fmt.Errorf("%w: a tip is at most the fare (%s)", ErrInvalid, t.Fare.Decimal())
+	}
+	riderID, driverID := t.RiderID, t.DriverID
+
+	var tip *Tip
+	err = db.WithTx(ctx, s.db, func(tx pgx.Tx) error {
+		var err error
+		tip, err = scanTip(tx.QueryRow(ctx,
+			`INSERT INTO trip_tips (trip_id,rider_id,driver_id,amount_minor,currency) VALUES ($1,$2,$3,$4,$5)
+			 ON CONFLICT (trip_id) DO NOTHING RETURNING `+columns,
+			tripID, riderID, *driverID, amount.Amount, amount.Currency))
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrAlreadyTipped
+		} else if err != nil {
+			return err
+		}
+		_, err = wallet.Credit(ctx, tx, *driverID, amount, wallet.KindTip, tripID, "Tip from your rider")
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.publishAdded(tip)
+	return tip, nil
+}
+
+// publishAdded asynchronously publishes tip.added for t.
+func (s *Service) publishAdded(t *Tip) {
+	ev := events.TipAddedEvent{
+		TripID:      t.TripID,
+		DriverID:    t.DriverID,
+		RiderID:     t.RiderID,
+		AmountMinor: t.Amount.Amount,
+		Currency:    t.Amount.Currency,
+		AddedAt:     t.CreatedAt.Format(time.RFC3339),
+	}
+	go func() {
+		env, err := events.Wrap(ev)
+		if err == nil {
+			err = s.bus.Publish(context.Background(), eventbus.TopicTipAdded, ev.TripID, env)
+		}
+		if err != nil {
+			logger.Error("publish tip.added failed", "trip", ev.TripID, "err", err)
+		}
+	}()
+}
+
+// Get returns a trip's tip to its rider, its driver or staff.
+func (s *Service) Get(ctx context.Context, tripID string, claims *jwt.Claims) (*Tip, error) {
+	t, err := s.trip(ctx, tripID)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Role != "admin" && claims.Role != "support" &&
+		claims.UserID != t.RiderID && (t.DriverID == nil || claims.UserID != *t.DriverID) {
+		return nil, ErrNotParticipant
+	}
+	tip, err := scanTip(s.db.QueryRow(ctx, `SELECT `+columns+` FROM trip_tips WHERE trip_id=$1`, tripID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return tip, err
+}
+
+func scanTip(row pgx.Row) (*Tip, error) {
+	var t Tip
+	if err := row.Scan(&t.TripID, &t.RiderID, &t.DriverID, &t.Amount.Amount, &t.Amount.Currency, &t.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
@@ -0,0 +1,414 @@
+package tracking
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/internal/trips"
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/config"
+	"ride-service/pkg/jwt"
+	"ride-service/pkg/logging"
+	rredis "ride-service/pkg/redis"
+)
+
+var logger = logging.For("ws")
+
+// subscriber is one client following a trip: a WebSocket or an SSE stream.
+// Its lock is held around every write, since neither allows concurrent
+// writers.
+type subscriber interface {
+	sync.Locker
+	// sendLocked writes one encoded JSON message; id is its history cursor,
+	// empty when it has none.
+	sendLocked(id string, data []byte) error
+	ping() error
+	// closeGoingAway tells the client the server is shutting down.
+	closeGoingAway() error
+	// close ends the connection, which makes its handler return.
+	close()
+}
+
+// follower is the subscriber of a client on /ws/trips/:id or
+// /sse/trips/:id, signed in as userID ("" if not). Location updates reach
+// every follower; the trip's other messages (chat, route changes, lost item
+// reports) only its rider, its driver and staff, decided message by message
+// so a driver who leaves the trip stops getting them.
+type follower struct {
+	subscriber
+	userID string
+	staff  bool
+}
+
+// newFollower wraps sub for the client claims belong to, nil if anonymous.
+func newFollower(sub subscriber, claims *jwt.Claims) *follower {
+	f := &follower{subscriber: sub}
+	if claims != nil {
+		f.userID = claims.UserID
+		f.staff = claims.Role == "admin" || claims.Role == "support"
+	}
+	return f
+}
+
+// unwrap returns the connection under sub's follower or viewer.
+func unwrap(sub subscriber) subscriber {
+	switch s := sub.(type) {
+	case *follower:
+		return s.subscriber
+	case *viewer:
+		return s.subscriber
+	}
+	return sub
+}
+
+// TripReader returns trips; trips.TripRepo implements it.
+type TripReader interface {
+	GetByID(ctx context.Context, id string) (*trips.Trip, error)
+}
+
+// send is sendLocked taking the subscriber's lock.
+func send(s subscriber, id string, data []byte) error {
+	s.Lock()
+	defer s.Unlock()
+	return s.sendLocked(id, data)
+}
+
+// Stats describes the hub's connections since startup.
+type Stats struct {
+	Open      int   `json:"open"`      // connections now, WebSocket and SSE
+	Streams   int   `json:"streams"`   // of which SSE streams
+	Trips     int   `json:"trips"`     // trips with at least one open connection
+	Connected int64 `json:"connected"` // connections accepted
+	// Reaped connections were dropped by the server: PongTimeouts went
+	// silent for longer than the pong timeout, WriteFailures failed or
+	// timed out a write (a message or a ping).
+	Reaped        int64 `json:"reaped"`
+	PongTimeouts  int64 `json:"pong_timeouts"`
+	WriteFailures int64 `json:"write_failures"`
+}
+
+// Hub manages the WebSocket and SSE connections of each trip.
+type Hub struct {
+	mu       sync.RWMutex
+	conns    map[string][]subscriber
+	draining bool
+	active   sync.WaitGroup // one per running HandleWS or HandleSSE
+	inbound  []Inbound
+	cfg      config.WebSocket
+	redis    *rredis.Client // trip message history
+	trips    TripReader     // who may read a trip's messages
+
+	connected, pongTimeouts, writeFailures atomic.Int64
+}
+
+// NewHub creates a tracking hub. Clients are pinged and reaped as cfg says;
+// each trip's recent messages are kept in Redis for replay.
+func NewHub(cfg config.WebSocket, r *rredis.Client, t TripReader) *Hub {
+	return &Hub{conns: make(map[string][]subscriber), cfg: cfg, redis: r, trips: t}
+}
+
+// privy returns whether a subscriber of tripID may get the trip's messages
+// other than location updates: a follower who is its rider, its driver or
+// staff. If the trip cannot be read, only staff may.
+func (h *Hub) privy(ctx context.Context, tripID string) func(subscriber) bool {
+	t, err := h.trips.GetByID(ctx, tripID)
+	if err != nil {
+		logger.Warn("trip lookup failed", "trip", tripID, "err", err)
+	}
+	return func(sub subscriber) bool {
+		f, ok := sub.(*follower)
+		switch {
+		case !ok:
+			return false
+		case f.staff:
+			return true
+		case err != nil || f.userID == "":
+			return false
+		}
+		return f.userID == t.RiderID || t.DriverID != nil && *t.DriverID == f.userID
+	}
+}
+
+// HandleInbound sets the handlers for client messages, which are otherwise
+// ignored. Each message goes to every handler, which ignores the types that
+// are not its own. Call it before serving.
+func (h *Hub) HandleInbound(fns ...Inbound) { h.inbound = fns }
+
+// AdminRoutes returns the routes mounted under /admin/ws.
+func (h *Hub) AdminRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth, jwt.RequireRole("admin"))
+	r.Get("/stats", h.ServeStats)
+	return r
+}
+
+// ServeStats serves GET /admin/ws/stats: this instance's connections.
+func (h *Hub) ServeStats(w http.ResponseWriter, _ *http.Request) {
+	apierror.WriteJSON(w, http.StatusOK, h.Stats())
+}
+
+// Stats reports on this instance's connections.
+func (h *Hub) Stats() Stats {
+	h.mu.RLock()
+	st := Stats{Trips: len(h.conns)}
+	for _, conns := range h.conns {
+		st.Open += len(conns)
+		for _, c := range conns {
+			if _, ok := unwrap(c).(*sseConn); ok {
+				st.Streams++
+			}
+		}
+	}
+	h.mu.RUnlock()
+	st.Connected = h.connected.Load()
+	st.PongTimeouts = h.pongTimeouts.Load()
+	st.WriteFailures = h.writeFailures.Load()
+	st.Reaped = st.PongTimeouts + st.WriteFailures
+	return st
+}
+
+// enter registers a handler about to serve a connection. It reports false,
+// having answered 503, while the hub drains; otherwise the caller must call
+// h.active.Done when it returns.
+func (h *Hub) enter(w http.ResponseWriter) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.draining {
+		apierror.Write(w, apierror.New(http.StatusServiceUnavailable, apierror.CodeUnavailable, "server shutting down"))
+		return false
+	}
+	h.active.Add(1)
+	return true
+}
+
+// subscribe replays the trip's history after since to sub and adds it to
+// the trip. Broadcasts to sub wait until the history is replayed, so they
+// follow it; one sent while the history was read can arrive twice, with the
+// same cursor. Once the hub drains, sub is told so and closed instead, and
+// subscribe reports false: the caller must return.
+func (h *Hub) subscribe(ctx context.Context, tripID, since string, sub subscriber) bool {
+	sub.Lock()
+	h.mu.Lock()
+	if h.draining {
+		// Shutdown has taken its snapshot of h.conns without sub.
+		h.mu.Unlock()
+		sub.Unlock()
+		if err := sub.closeGoingAway(); err != nil {
+			logger.Debug("close frame failed", "err", err)
+		}
+		sub.close()
+		return false
+	}
+	h.conns[tripID] = append(h.conns[tripID], sub)
+	h.mu.Unlock()
+	h.connected.Add(1)
+	err := h.replay(ctx, tripID, since, sub)
+	sub.Unlock()
+	if err != nil {
+		h.reap(tripID, sub, err)
+	}
+	return true
+}
+
+// replay writes the trip's history after since to sub, whose lock the
+// caller holds, leaving out what sub may not read (see follower). Only a
+// failed write is returned: without the history the client still gets new
+// messages.
+func (h *Hub) replay(ctx context.Context, tripID, since string, sub subscriber) error {
+	if h.cfg.History == 0 {
+		return nil
+	}
+	msgs, err := h.redis.TripMessages(ctx, tripID, since)
+	if err != nil {
+		logger.Warn("history read failed", "trip", tripID, "err", err)
+		return nil
+	}
+	var privy func(subscriber) bool
+	for _, m := range msgs {
+		if !isLocation(m.Data) {
+			if privy == nil {
+				privy = h.privy(ctx, tripID)
+			}
+			if !privy(sub) {
+				continue
+			}
+		}
+		if err := sub.sendLocked(m.ID, withCursor(m.Data, m.ID)); err != nil {
+			return err
+		}
+	}
+	if len(msgs) > 0 {
+		logger.Debug("history replayed", "trip", tripID, "since", since, "messages", len(msgs))
+	}
+	return nil
+}
+
+// keepAlive pings sub every ping interval until stop is closed, reaping it
+// when a ping cannot be written.
+func (h *Hub) keepAlive(tripID string, sub subscriber, stop <-chan struct{}) {
+	t := time.NewTicker(h.cfg.PingInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			if err := sub.ping(); err != nil {
+				h.reap(tripID, sub, err)
+				return
+			}
+		}
+	}
+}
+
+// reap drops a connection whose write failed. Closing it ends its handler,
+// which finishes the clean-up.
+func (h *Hub) reap(tripID string, sub subscriber, err error) {
+	if !h.removeConn(tripID, sub) {
+		return // already gone
+	}
+	h.writeFailures.Add(1)
+	logger.Warn("reaping unresponsive client", "trip", tripID, "err", err)
+	sub.close()
+}
+
+// BroadcastLocation pushes a driver location update to all subscribers of a trip.
+// Safe for concurrent calls — each subscriber serialises its own writes.
+func (h *Hub) BroadcastLocation(tripID string, lat, lng float64) {
+	h.Notify(tripID, map[string]any{
+		"trip_id": tripID,
+		"lat":     lat,
+		"lng":     lng,
+		"ts":      time.Now().Unix(),
+	})
+}
+
+// Notify sends msg as JSON to the subscribers of a trip — rider and driver
+// apps alike, over WebSocket or SSE — and keeps it in the trip's history.
+// Location updates go to every subscriber, anything else only to those
+// privy to the trip. The message carries its history ID as "cursor". A
+// subscriber that cannot take it within the write timeout is dropped.
+func (h *Hub) Notify(tripID string, msg any) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		logger.Error("encode message failed", "trip", tripID, "err", err)
+		return
+	}
+	var id string
+	if h.cfg.History > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), h.cfg.WriteTimeout)
+		id, err = h.redis.AppendTripMessage(ctx, tripID, data, int64(h.cfg.History), h.cfg.HistoryTTL)
+		cancel()
+		if err != nil {
+			logger.Warn("history write failed", "trip", tripID, "err", err) // sent without a cursor
+		} else {
+			data = withCursor(data, id)
+		}
+	}
+
+	h.mu.RLock()
+	conns := slices.Clone(h.conns[tripID])
+	h.mu.RUnlock()
+	if len(conns) == 0 {
+		return
+	}
+
+	privy := func(subscriber) bool { return true }
+	if !isLocation(data) {
+		ctx, cancel := context.WithTimeout(context.Background(), h.cfg.WriteTimeout)
+		privy = h.privy(ctx, tripID)
+		cancel()
+	}
+	for _, c := range conns {
+		if !privy(c) {
+			continue
+		}
+		if err := send(c, id, data); err != nil {
+			h.reap(tripID, c, err)
+		}
+	}
+}
+
+// withCursor adds "cursor": id to the JSON object data.
+func withCursor(data []byte, id string) []byte {
+	body, ok := bytes.CutPrefix(data, []byte("{"))
+	if !ok {
+		return data
+	}
+	out := append([]byte(`{"cursor":`), strconv.Quote(id)...)
+	if !bytes.HasPrefix(body, []byte("}")) {
+		out = append(out, ',')
+	}
+	return append(out, body...)
+}
+
+// validCursor reports whether s looks like a history ID: <ms>-<seq>.
+func validCursor(s string) bool {
+	ms, seq, ok := strings.Cut(s, "-")
+	_, err1 := strconv.ParseUint(ms, 10, 64)
+	_, err2 := strconv.ParseUint(seq, 10, 64)
+	return ok && err1 == nil && err2 == nil
+}
+
+// Shutdown stops accepting new connections, tells every connected client
+// the server is going away and waits for their handlers to return (or ctx
+// to expire).
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	h.draining = true
+	var all []subscriber
+	for _, conns := range h.conns {
+		all = append(all, conns...)
+	}
+	h.mu.Unlock()
+
+	for _, c := range all {
+		if err := c.closeGoingAway(); err != nil {
+			logger.Debug("close frame failed", "err", err)
+		}
+		// Closing the connection makes its handler return.
+		c.close()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		h.active.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		logger.Info("drained connections", "count", len(all))
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("ws: connections did not drain: %w", ctx.Err())
+	}
+}
+
+// removeConn unsubscribes sub from the trip, reporting whether it was
+// still subscribed.
+func (h *Hub) removeConn(tripID string, sub subscriber) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	conns := h.conns[tripID]
+	i := slices.Index(conns, sub)
+	if i < 0 {
+		return false
+	}
+	h.conns[tripID] = slices.Delete(conns, i, i+1)
+	if len(h.conns[tripID]) == 0 {
+		delete(h.conns, tripID)
+	}
+	return true
+}
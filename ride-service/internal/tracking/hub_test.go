@@ -0,0 +1,152 @@
+package tracking
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"ride-service/pkg/config"
+)
+
+// fakeConn records what the hub does to it.
+type fakeConn struct {
+	sync.Mutex
+	sent      [][]byte
+	goingAway bool
+	closed    chan struct{}
+	once      sync.Once
+}
+
+func newFakeConn() *fakeConn { return &fakeConn{closed: make(chan struct{})} }
+
+func (c *fakeConn) sendLocked(_ string, data []byte) error {
+	c.sent = append(c.sent, data)
+	return nil
+}
+
+func (c *fakeConn) ping() error { return nil }
+
+func (c *fakeConn) closeGoingAway() error {
+	c.Lock()
+	defer c.Unlock()
+	c.goingAway = true
+	return nil
+}
+
+func (c *fakeConn) close() { c.once.Do(func() { close(c.closed) }) }
+
+func (c *fakeConn) isClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func newTestHub() *Hub {
+	return NewHub(config.WebSocket{WriteTimeout: time.Second}, nil, nil)
+}
+
+// handler stands in for HandleWS: it enters, subscribes when told to and
+// returns once its connection is closed.
+func handler(h *Hub, conn *fakeConn, subscribe <-chan struct{}) (entered <-chan bool, done <-chan struct{}) {
+	in, out := make(chan bool, 1), make(chan struct{})
+	go func() {
+		defer close(out)
+		if !h.enter(httptest.NewRecorder()) {
+			in <- false
+			return
+		}
+		defer h.active.Done()
+		in <- true
+		<-subscribe
+		if !h.subscribe(context.Background(), "trip-1", "", conn) {
+			return
+		}
+		<-conn.closed
+		h.removeConn("trip-1", conn)
+	}()
+	return in, out
+}
+
+func TestShutdownDrainsSubscribedConnections(t *testing.T) {
+	h := newTestHub()
+	conn := newFakeConn()
+	now := make(chan struct{})
+	close(now)
+	entered, done := handler(h, conn, now)
+	if !<-entered {
+		t.Fatal("refused before shutdown")
+	}
+	for h.Stats().Open == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := h.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if !conn.goingAway || !conn.isClosed() {
+		t.Errorf("connection going away %v, closed %v; want both", conn.goingAway, conn.isClosed())
+	}
+}
+
+func TestShutdownClosesConnectionsNotYetSubscribed(t *testing.T) {
+	h := newTestHub()
+	conn := newFakeConn()
+	subscribe := make(chan struct{})
+	entered, done := handler(h, conn, subscribe)
+	if !<-entered {
+		t.Fatal("refused before shutdown")
+	}
+
+	// The handler is past enter but not yet subscribed, as while a
+	// WebSocket upgrade is under way: Shutdown must wait for it.
+	drained := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		drained <- h.Shutdown(ctx)
+	}()
+	for {
+		h.mu.RLock()
+		draining := h.draining
+		h.mu.RUnlock()
+		if draining {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case err := <-drained:
+		t.Fatalf("Shutdown returned %v with a handler still running", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(subscribe)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("handler kept its connection open during shutdown")
+	}
+	if err := <-drained; err != nil {
+		t.Fatal(err)
+	}
+	if !conn.goingAway || !conn.isClosed() {
+		t.Errorf("connection going away %v, closed %v; want both", conn.goingAway, conn.isClosed())
+	}
+	if st := h.Stats(); st.Open != 0 {
+		t.Errorf("%d connections left open", st.Open)
+	}
+
+	// Later connections are turned away.
+	late, _ := handler(h, newFakeConn(), subscribe)
+	if <-late {
+		t.Error("accepted a connection while draining")
+	}
+}
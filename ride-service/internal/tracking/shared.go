@@ -0,0 +1,65 @@
+package tracking
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// viewer is the subscriber of someone following a trip through a share
+// link. It only gets the trip's location updates: chat, route changes and
+// the like stay between rider and driver.
+type viewer struct{ subscriber }
+
+func (v *viewer) sendLocked(id string, data []byte) error {
+	if !isLocation(data) {
+		return nil
+	}
+	return v.subscriber.sendLocked(id, data)
+}
+
+// isLocation reports whether data is a location update, the only message
+// without a type.
+func isLocation(data []byte) bool {
+	var m struct {
+		Type string `json:"type"`
+	}
+	return json.Unmarshal(data, &m) == nil && m.Type == ""
+}
+
+// HandleSharedWS serves a share link's WebSocket on tripID: the trip's
+// location updates, history first as on /ws/trips/:id, until the link
+// expires at until. What the viewer sends is ignored.
+func (h *Hub) HandleSharedWS(w http.ResponseWriter, r *http.Request, tripID string, until time.Time) {
+	h.serveWS(w, r, tripID, until)
+}
+
+// HandleSharedSSE is HandleSharedWS as Server-Sent Events.
+func (h *Hub) HandleSharedSSE(w http.ResponseWriter, r *http.Request, tripID string, until time.Time) {
+	h.serveSSE(w, r, tripID, until)
+}
+
+// closeAt drops sub from tripID when its link expires at until, which ends
+// its handler. Stop the timer once the handler returns.
+func (h *Hub) closeAt(tripID string, sub subscriber, until time.Time) *time.Timer {
+	return time.AfterFunc(time.Until(until), func() {
+		if h.removeConn(tripID, sub) {
+			logger.Info("share link expired", "trip", tripID)
+			sub.close()
+		}
+	})
+}
+
+// CloseViewers drops every share link viewer of tripID, whose links were
+// revoked. The rider's and driver's connections stay.
+func (h *Hub) CloseViewers(tripID string) {
+	h.mu.RLock()
+	conns := slices.Clone(h.conns[tripID])
+	h.mu.RUnlock()
+	for _, c := range conns {
+		if _, ok := c.(*viewer); ok && h.removeConn(tripID, c) {
+			c.close()
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package tracking
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+)
+
+// sseConn is a Server-Sent Events stream: the same messages as a trip's
+// WebSocket, one event each, for clients and proxies that cannot hold a
+// WebSocket. It is one-way; pings are comment lines.
+type sseConn struct {
+	sync.Mutex
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	timeout time.Duration // per write
+	done    chan struct{}
+	once    sync.Once
+	ended   bool // the handler returned; w must not be touched
+}
+
+// sendLocked writes data as one event with id as its ID, so a reconnecting
+// EventSource resumes after it by itself.
+func (c *sseConn) sendLocked(id string, data []byte) error {
+	var b []byte
+	if id != "" {
+		b = append(append(append(b, "id: "...), id...), '\n')
+	}
+	b = append(append(append(b, "data: "...), data...), "\n\n"...)
+	return c.write(b)
+}
+
+func (c *sseConn) ping() error {
+	c.Lock()
+	defer c.Unlock()
+	return c.write([]byte(": ping\n\n"))
+}
+
+// closeGoingAway asks the client to reconnect, elsewhere, after a second.
+func (c *sseConn) closeGoingAway() error {
+	c.Lock()
+	defer c.Unlock()
+	return c.write([]byte("retry: 1000\n\n"))
+}
+
+func (c *sseConn) close() { c.once.Do(func() { close(c.done) }) }
+
+// write sends b and flushes it within the write timeout; the caller holds
+// the lock.
+func (c *sseConn) write(b []byte) error {
+	if c.ended {
+		return net.ErrClosed
+	}
+	if err := c.rc.SetWriteDeadline(time.Now().Add(c.timeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+	if _, err := c.w.Write(b); err != nil {
+		return err
+	}
+	return c.rc.Flush()
+}
+
+// SSERoutes returns a chi.Router for the /sse mount point.
+func (h *Hub) SSERoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Get("/trips/{id}", h.HandleSSE)
+	return r
+}
+
+// HandleSSE streams a trip's messages as Server-Sent Events: first its
+// recent ones after ?since=<cursor> (or the Last-Event-ID an EventSource
+// sends when it reconnects), then live ones until the client goes away.
+func (h *Hub) HandleSSE(w http.ResponseWriter, r *http.Request) {
+	h.serveSSE(w, r, chi.URLParam(r, "id"), time.Time{})
+}
+
+// serveSSE streams tripID's messages. A non-zero until makes it a share
+// link viewer's stream, ended then (see viewer).
+func (h *Hub) serveSSE(w http.ResponseWriter, r *http.Request, tripID string, until time.Time) {
+	since := r.URL.Query().Get("since")
+	if since == "" {
+		since = r.Header.Get("Last-Event-ID")
+	}
+	if since != "" && !validCursor(since) {
+		apierror.Write(w, apierror.Validation("since: not a message cursor"))
+		return
+	}
+
+	if !h.enter(w) {
+		return
+	}
+	defer h.active.Done()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // nginx: pass events through as they come
+	w.WriteHeader(http.StatusOK)
+	conn := &sseConn{w: w, rc: http.NewResponseController(w), timeout: h.cfg.WriteTimeout, done: make(chan struct{})}
+	conn.Lock()
+	err := conn.write([]byte(": connected\n\n")) // sends the headers
+	conn.Unlock()
+	if err != nil {
+		logger.Warn("stream start failed", "trip", tripID, "err", err)
+		return
+	}
+
+	var sub subscriber = newFollower(conn, jwt.GetClaims(r.Context()))
+	if !until.IsZero() {
+		sub = &viewer{subscriber: conn}
+		defer h.closeAt(tripID, sub, until).Stop()
+	}
+	if !h.subscribe(r.Context(), tripID, since, sub) {
+		conn.Lock()
+		conn.ended = true
+		conn.Unlock()
+		return
+	}
+	logger.Info("stream opened", "trip", tripID)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go h.keepAlive(tripID, sub, stop)
+
+	// Block until the client goes away or the hub drops the stream
+	select {
+	case <-r.Context().Done():
+	case <-conn.done:
+	}
+
+	h.removeConn(tripID, sub)
+	conn.Lock()
+	conn.ended = true // a broadcast already under way must not write to w
+	conn.Unlock()
+	logger.Info("stream closed", "trip", tripID)
+}
@@ -1,13 +1,18 @@
 package tracking
 
 import (
-	"log"
+	"context"
+	"errors"
+	"net"
 	"net/http"
 	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/gorilla/websocket"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
 )
 
 var upgrader = websocket.Upgrader{
@@ -17,33 +22,49 @@ var upgrader = websocket.Upgrader{
 // safeConn wraps a websocket.Conn with a write mutex.
 // gorilla/websocket allows one concurrent writer; this enforces that.
 type safeConn struct {
-	mu sync.Mutex
-	ws *websocket.Conn
+	sync.Mutex
+	ws      *websocket.Conn
+	timeout time.Duration // per write
 }
 
 func (c *safeConn) writeJSON(v any) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	c.Lock()
+	defer c.Unlock()
+	c.ws.SetWriteDeadline(time.Now().Add(c.timeout))
 	return c.ws.WriteJSON(v)
 }
 
-func (c *safeConn) readMessage() (int, []byte, error) {
-	return c.ws.ReadMessage()
+// sendLocked writes data as a text message; the cursor is already in it.
+func (c *safeConn) sendLocked(_ string, data []byte) error {
+	c.ws.SetWriteDeadline(time.Now().Add(c.timeout))
+	return c.ws.WriteMessage(websocket.TextMessage, data)
 }
 
-func (c *safeConn) close() { c.ws.Close() }
+func (c *safeConn) ping() error {
+	c.Lock()
+	defer c.Unlock()
+	return c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(c.timeout))
+}
 
-// Hub manages WebSocket connections per trip.
-type Hub struct {
-	mu    sync.RWMutex
-	conns map[string][]*safeConn
+func (c *safeConn) readMessage() (int, []byte, error) {
+	return c.ws.ReadMessage()
 }
 
-// NewHub creates a tracking hub.
-func NewHub() *Hub {
-	return &Hub{conns: make(map[string][]*safeConn)}
+// closeGoingAway sends a close frame telling the client the server is shutting down.
+func (c *safeConn) closeGoingAway() error {
+	c.Lock()
+	defer c.Unlock()
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	return c.ws.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
 }
 
+func (c *safeConn) close() { c.ws.Close() }
+
+// Inbound handles a message a client sent on its trip's socket. claims are
+// those of the upgrade request, nil if it carried no valid token. A non-nil
+// result is sent back to that client only.
+type Inbound func(ctx context.Context, tripID string, claims *jwt.Claims, msg []byte) any
+
 // Routes returns a chi.Router for the /ws mount point.
 func (h *Hub) Routes() chi.Router {
 	r := chi.NewRouter()
@@ -51,68 +72,79 @@ func (h *Hub) Routes() chi.Router {
 	return r
 }
 
-// HandleWS upgrades the connection and subscribes it to a trip.
+// HandleWS upgrades the connection, replays the trip's recent messages
+// (those after ?since=<cursor>, if given) and subscribes it to the trip.
 func (h *Hub) HandleWS(w http.ResponseWriter, r *http.Request) {
-	tripID := chi.URLParam(r, "id")
+	h.serveWS(w, r, chi.URLParam(r, "id"), time.Time{})
+}
+
+// serveWS serves a WebSocket on tripID. A non-zero until makes it a share
+// link viewer's, closed then (see viewer).
+func (h *Hub) serveWS(w http.ResponseWriter, r *http.Request, tripID string, until time.Time) {
+	since := r.URL.Query().Get("since")
+	if since != "" && !validCursor(since) {
+		apierror.Write(w, apierror.Validation("since: not a message cursor"))
+		return
+	}
+
+	if !h.enter(w) {
+		return
+	}
+	defer h.active.Done()
+
 	ws, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("[ws] upgrade error: %v", err)
+		logger.Warn("upgrade failed", "err", err)
 		return
 	}
 
-	conn := &safeConn{ws: ws}
-
-	h.mu.Lock()
-	h.conns[tripID] = append(h.conns[tripID], conn)
-	h.mu.Unlock()
+	claims := jwt.GetClaims(r.Context())
+	conn := &safeConn{ws: ws, timeout: h.cfg.WriteTimeout}
+	var sub subscriber = newFollower(conn, claims)
+	shared := !until.IsZero()
+	if shared {
+		sub = &viewer{subscriber: conn}
+		defer h.closeAt(tripID, sub, until).Stop()
+	}
+	if !h.subscribe(r.Context(), tripID, since, sub) {
+		return
+	}
+	logger.Info("client connected", "trip", tripID)
 
-	log.Printf("[ws] client connected to trip %s", tripID)
+	// Anything from the client, pongs included, proves it is alive and
+	// pushes the read deadline back.
+	alive := func() { ws.SetReadDeadline(time.Now().Add(h.cfg.PongTimeout)) }
+	alive()
+	ws.SetPongHandler(func(string) error { alive(); return nil })
+	stop := make(chan struct{})
+	defer close(stop)
+	go h.keepAlive(tripID, sub, stop)
 
 	// Block until the client disconnects
 	for {
-		if _, _, err := conn.readMessage(); err != nil {
+		_, msg, err := conn.readMessage()
+		var ne net.Error
+		if errors.As(err, &ne) && ne.Timeout() {
+			h.pongTimeouts.Add(1)
+			logger.Warn("reaping silent client", "trip", tripID, "pong_timeout", h.cfg.PongTimeout)
+			break
+		} else if err != nil {
 			break
 		}
-	}
-
-	h.removeConn(tripID, conn)
-	conn.close()
-	log.Printf("[ws] client disconnected from trip %s", tripID)
-}
-
-// BroadcastLocation pushes a driver location update to all subscribers of a trip.
-// Safe for concurrent calls — each safeConn serialises its own writes.
-func (h *Hub) BroadcastLocation(tripID string, lat, lng float64) {
-	h.mu.RLock()
-	conns := h.conns[tripID]
-	h.mu.RUnlock()
-
-	msg := map[string]any{
-		"trip_id": tripID,
-		"lat":     lat,
-		"lng":     lng,
-		"ts":      time.Now().Unix(),
-	}
-
-	for _, c := range conns {
-		if err := c.writeJSON(msg); err != nil {
-			log.Printf("[ws] write error: %v", err)
+		alive()
+		if shared {
+			continue // viewers only watch
 		}
-	}
-}
-
-func (h *Hub) removeConn(tripID string, conn *safeConn) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-
-	conns := h.conns[tripID]
-	for i, c := range conns {
-		if c == conn {
-			h.conns[tripID] = append(conns[:i], conns[i+1:]...)
-			break
+		for _, fn := range h.inbound {
+			if reply := fn(r.Context(), tripID, claims, msg); reply != nil {
+				if err := conn.writeJSON(reply); err != nil {
+					h.reap(tripID, sub, err)
+				}
+			}
 		}
 	}
-	if len(h.conns[tripID]) == 0 {
-		delete(h.conns, tripID)
-	}
+
+	h.removeConn(tripID, sub)
+	conn.close()
+	logger.Info("client disconnected", "trip", tripID)
 }
@@ -0,0 +1,110 @@
+package trips
+
+import (
+	"context"
+	"time"
+
+	"ride-service/internal/trips/statemachine"
+	"ride-service/pkg/cache"
+	"ride-service/pkg/config"
+	"ride-service/pkg/db"
+	"ride-service/pkg/money"
+)
+
+// CachedRepo is a TripRepo that serves GetByID through a two-tier cache and
+// invalidates the trip on every write.
+type CachedRepo struct {
+	TripRepo
+	trips *cache.Cache[Trip]
+}
+
+// Cached wraps repo in a cache backed by store.
+func Cached(repo TripRepo, store cache.Store, cfg config.Cache) *CachedRepo {
+	return &CachedRepo{TripRepo: repo, trips: cache.New[Trip](store, "trip:", cfg.LocalSize, cfg.LocalTTL, cfg.TTL)}
+}
+
+// Invalidate drops the cached trip. Writes made through the repo do this
+// themselves; call it after writing to trips elsewhere, and after committing
+// a transaction a repo write joined (db.Within), which invalidated before
+// its change was visible.
+func (r *CachedRepo) Invalidate(ctx context.Context, id string) { r.trips.Invalidate(ctx, id) }
+
+func (r *CachedRepo) GetByID(ctx context.Context, id string) (*Trip, error) {
+	t, err := r.trips.Get(ctx, id, func(ctx context.Context) (Trip, error) {
+		// Fill from the primary so replica lag is never cached.
+		t, err := r.TripRepo.GetByID(db.RequirePrimary(ctx), id)
+		if err != nil {
+			return Trip{}, err
+		}
+		return *t, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func (r *CachedRepo) Create(ctx context.Context, t *Trip) error {
+	defer r.Invalidate(ctx, t.ID)
+	return r.TripRepo.Create(ctx, t)
+}
+
+func (r *CachedRepo) Assign(ctx context.Context, tripID, driverID string, version int) error {
+	defer r.Invalidate(ctx, tripID)
+	return r.TripRepo.Assign(ctx, tripID, driverID, version)
+}
+
+func (r *CachedRepo) Respond(ctx context.Context, tripID, driverID string, version int, from, to string) error {
+	defer r.Invalidate(ctx, tripID)
+	return r.TripRepo.Respond(ctx, tripID, driverID, version, from, to)
+}
+
+func (r *CachedRepo) Start(ctx context.Context, tripID string, at time.Time, version int) error {
+	defer r.Invalidate(ctx, tripID)
+	return r.TripRepo.Start(ctx, tripID, at, version)
+}
+
+func (r *CachedRepo) Complete(ctx context.Context, tripID string, ev statemachine.Event, actor string, version int, fn func(t *Trip) (Completion, error)) (*Trip, error) {
+	defer r.Invalidate(ctx, tripID)
+	return r.TripRepo.Complete(ctx, tripID, ev, actor, version, fn)
+}
+
+func (r *CachedRepo) Arrive(ctx context.Context, tripID, driverID string, version int, check func(t *Trip) error) error {
+	defer r.Invalidate(ctx, tripID)
+	return r.TripRepo.Arrive(ctx, tripID, driverID, version, check)
+}
+
+func (r *CachedRepo) Pause(ctx context.Context, tripID, actor string, at time.Time, version int) error {
+	defer r.Invalidate(ctx, tripID)
+	return r.TripRepo.Pause(ctx, tripID, actor, at, version)
+}
+
+func (r *CachedRepo) Resume(ctx context.Context, tripID, actor string, at time.Time, version int) error {
+	defer r.Invalidate(ctx, tripID)
+	return r.TripRepo.Resume(ctx, tripID, actor, at, version)
+}
+
+func (r *CachedRepo) Expire(ctx context.Context, tripID string, version int) (*Trip, error) {
+	defer r.Invalidate(ctx, tripID)
+	return r.TripRepo.Expire(ctx, tripID, version)
+}
+
+func (r *CachedRepo) Cancel(ctx context.Context, tripID, riderID string, version int, c Cancellation) (*Trip, error) {
+	defer r.Invalidate(ctx, tripID)
+	return r.TripRepo.Cancel(ctx, tripID, riderID, version, c)
+}
+
+func (r *CachedRepo) ChangeRoute(ctx context.Context, tripID, driverID string, version int, fn func(t *Trip) (RouteChange, error)) (*Trip, error) {
+	defer r.Invalidate(ctx, tripID)
+	return r.TripRepo.ChangeRoute(ctx, tripID, driverID, version, fn)
+}
+
+func (r *CachedRepo) AdjustFare(ctx context.Context, tripID string, version int, fn func(t *Trip) (money.Money, error)) (*Trip, error) {
+	defer r.Invalidate(ctx, tripID)
+	return r.TripRepo.AdjustFare(ctx, tripID, version, fn)
+}
+
+func (r *CachedRepo) NoShow(ctx context.Context, tripID, driverID string, version int, fn func(t *Trip) (fee money.Money, pricingVersion int64, err error)) (*Trip, error) {
+	defer r.Invalidate(ctx, tripID)
+	return r.TripRepo.NoShow(ctx, tripID, driverID, version, fn)
+}
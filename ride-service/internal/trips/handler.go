@@ -1,19 +1,33 @@
 package trips
 
 import (
+	"context"
+	"encoding/csv"
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
+	"ride-service/internal/events"
+	"ride-service/pkg/apierror"
 	"ride-service/pkg/jwt"
+	"ride-service/pkg/validation"
 )
 
 // Handler exposes trip HTTP endpoints.
-type Handler struct{ svc *Service }
+type Handler struct {
+	svc    *Service
+	search *Search
+}
 
-// NewHandler wires a handler to the trip service.
-func NewHandler(svc *Service) *Handler { return &Handler{svc: svc} }
+// NewHandler wires a handler to the trip service and the admin search.
+// Without a search, as in STORAGE=memory, GET /admin/trips is not served.
+func NewHandler(svc *Service, search *Search) *Handler { return &Handler{svc: svc, search: search} }
 
 // Routes returns a chi.Router with all trip routes.
 func (h *Handler) Routes() chi.Router {
@@ -21,30 +35,60 @@ func (h *Handler) Routes() chi.Router {
 	r.Use(jwt.RequireAuth) // all trip endpoints need auth
 
 	r.Post("/request", h.Request)
+	r.Get("/active", h.ListMine)
 	r.Get("/{id}", h.GetByID)
 	r.Patch("/{id}/assign", h.Assign)
+	r.Patch("/{id}/accept", h.Accept)
+	r.Patch("/{id}/decline", h.Decline)
+	r.Patch("/{id}/cancel", h.Cancel)
+	r.Patch("/{id}/arrive", h.Arrive)
+	r.Patch("/{id}/no-show", h.NoShow)
 	r.Patch("/{id}/start", h.Start)
+	r.Patch("/{id}/pause", h.Pause)
+	r.Patch("/{id}/resume", h.Resume)
 	r.Patch("/{id}/end", h.End)
+	r.Post("/{id}/offline-completion", h.CompleteOffline)
 
 	return r
 }
 
+// AdminRoutes returns a chi.Router with the ops-only trip routes.
+func (h *Handler) AdminRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+
+	if h.search != nil {
+		r.With(jwt.RequireRole("admin", "support")).Get("/", h.Search)
+	}
+	r.With(jwt.RequireRole("admin")).Get("/active", h.ListActive)
+
+	return r
+}
+
+// DriverRoutes returns the routes mounted at /drivers/{id}/current-trip.
+func (h *Handler) DriverRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+	r.Get("/", h.CurrentTrip)
+	return r
+}
+
 func (h *Handler) Request(w http.ResponseWriter, r *http.Request) {
 	claims := jwt.GetClaims(r.Context())
 
 	var req TripRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid body"})
+		apierror.Write(w, apierror.Validation("invalid body"))
 		return
 	}
 
 	trip, err := h.svc.Request(r.Context(), claims.UserID, req)
 	if err != nil {
-		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		apierror.Write(w, err)
 		return
 	}
 
-	writeJSON(w, http.StatusCreated, map[string]any{
+	apierror.WriteJSON(w, http.StatusCreated, map[string]any{
 		"trip_id": trip.ID,
 		"status":  trip.Status,
 	})
@@ -53,51 +97,387 @@ func (h *Handler) Request(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) GetByID(w http.ResponseWriter, r *http.Request) {
 	t, err := h.svc.GetByID(r.Context(), chi.URLParam(r, "id"))
 	if err != nil {
-		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		apierror.Write(w, err)
 		return
 	}
-	writeJSON(w, http.StatusOK, t)
+	writeTrip(w, t)
+}
+
+// ListMine returns the caller's trips in progress.
+func (h *Handler) ListMine(w http.ResponseWriter, r *http.Request) {
+	claims := jwt.GetClaims(r.Context())
+	trips, err := h.svc.ListActive(r.Context(), claims.UserID, claims.Role == "driver")
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]any{"trips": trips})
 }
 
 func (h *Handler) Assign(w http.ResponseWriter, r *http.Request) {
+	version, ok := IfMatch(w, r)
+	if !ok {
+		return
+	}
 	var req AssignRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid body"})
+		apierror.Write(w, apierror.Validation("invalid body"))
 		return
 	}
 
-	t, err := h.svc.AssignDriver(r.Context(), chi.URLParam(r, "id"), req.DriverID)
+	t, err := h.svc.AssignDriver(r.Context(), chi.URLParam(r, "id"), req.DriverID, version)
 	if err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		apierror.Write(w, err)
 		return
 	}
-	writeJSON(w, http.StatusOK, t)
+	writeTrip(w, t)
+}
+
+// Accept and Decline are the assigned driver's answers to an offer.
+func (h *Handler) Accept(w http.ResponseWriter, r *http.Request) {
+	h.respond(w, r, h.svc.Accept)
+}
+
+func (h *Handler) Decline(w http.ResponseWriter, r *http.Request) {
+	h.respond(w, r, h.svc.Decline)
+}
+
+// Cancel withdraws the assigned driver from a trip they accepted, or, for
+// its rider, cancels the trip. Either gives a reason.
+func (h *Handler) Cancel(w http.ResponseWriter, r *http.Request) {
+	version, ok := IfMatch(w, r)
+	if !ok {
+		return
+	}
+	var req CancelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	claims := jwt.GetClaims(r.Context())
+	cancel := h.svc.Cancel
+	if claims.Role != "driver" {
+		cancel = h.svc.RiderCancel
+	}
+	t, err := cancel(r.Context(), chi.URLParam(r, "id"), claims.UserID, version, req)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	writeTrip(w, t)
+}
+
+// Arrive and NoShow are the assigned driver's reports from the pickup.
+func (h *Handler) Arrive(w http.ResponseWriter, r *http.Request) {
+	h.respond(w, r, h.svc.Arrive)
+}
+
+func (h *Handler) NoShow(w http.ResponseWriter, r *http.Request) {
+	h.respond(w, r, h.svc.NoShow)
+}
+
+func (h *Handler) respond(w http.ResponseWriter, r *http.Request, fn func(ctx context.Context, tripID, userID string, version int) (*Trip, error)) {
+	version, ok := IfMatch(w, r)
+	if !ok {
+		return
+	}
+	claims := jwt.GetClaims(r.Context())
+	t, err := fn(r.Context(), chi.URLParam(r, "id"), claims.UserID, version)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	writeTrip(w, t)
 }
 
 func (h *Handler) Start(w http.ResponseWriter, r *http.Request) {
-	t, err := h.svc.Start(r.Context(), chi.URLParam(r, "id"))
+	h.apply(w, r, h.svc.Start)
+}
+
+// Pause and Resume stop and restart a STARTED trip for an errand, at the
+// request of its rider or driver.
+func (h *Handler) Pause(w http.ResponseWriter, r *http.Request) {
+	h.respond(w, r, h.svc.Pause)
+}
+
+func (h *Handler) Resume(w http.ResponseWriter, r *http.Request) {
+	h.respond(w, r, h.svc.Resume)
+}
+
+func (h *Handler) apply(w http.ResponseWriter, r *http.Request, fn func(ctx context.Context, tripID string, version int) (*Trip, error)) {
+	version, ok := IfMatch(w, r)
+	if !ok {
+		return
+	}
+	t, err := fn(r.Context(), chi.URLParam(r, "id"), version)
 	if err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		apierror.Write(w, err)
 		return
 	}
-	writeJSON(w, http.StatusOK, t)
+	writeTrip(w, t)
 }
 
 func (h *Handler) End(w http.ResponseWriter, r *http.Request) {
+	version, ok := IfMatch(w, r)
+	if !ok {
+		return
+	}
 	var req EndRequest
 	// body is optional
 	json.NewDecoder(r.Body).Decode(&req)
 
-	t, err := h.svc.End(r.Context(), chi.URLParam(r, "id"), req.DistanceKm)
+	t, err := h.svc.End(r.Context(), chi.URLParam(r, "id"), version, req.DistanceKm)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	writeTrip(w, t)
+}
+
+// CompleteOffline accepts a device-signed completion for a trip the assigned
+// driver finished without connectivity.
+func (h *Handler) CompleteOffline(w http.ResponseWriter, r *http.Request) {
+	claims := jwt.GetClaims(r.Context())
+
+	var req OfflineCompletion
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+
+	t, err := h.svc.CompleteOffline(r.Context(), chi.URLParam(r, "id"), claims.UserID, req)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	writeTrip(w, t)
+}
+
+// ListActive serves the ops map: ?bbox=minLng,minLat,maxLng,maxLat.
+func (h *Handler) ListActive(w http.ResponseWriter, r *http.Request) {
+	box, ok := parseBBox(r.URL.Query().Get("bbox"))
+	if !ok {
+		apierror.Write(w, apierror.Validation("bbox must be minLng,minLat,maxLng,maxLat"))
+		return
+	}
+	trips, err := h.svc.ListActiveInBox(r.Context(), box)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]any{"trips": trips})
+}
+
+// maxExportRows caps one CSV export; narrow the filters or page with the
+// cursor for more.
+const maxExportRows = 100000
+
+// Search serves GET /admin/trips. Filters: status (comma-separated), from
+// and to (YYYY-MM-DD, UTC, to inclusive), fare_min and fare_max (minor
+// units), currency, city, rider_email, driver_email, q, and near=lat,lng
+// with within_km. Pages are newest first: limit (default 50, max 200) and
+// cursor, the next_cursor of the previous page. format=csv streams every
+// match after the cursor instead, up to maxExportRows.
+func (h *Handler) Search(w http.ResponseWriter, r *http.Request) {
+	f, err := ParseSearch(r.URL.Query())
 	if err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		apierror.Write(w, err)
+		return
+	}
+	if r.URL.Query().Get("format") == "csv" {
+		h.export(w, r, f)
+		return
+	}
+	page, err := h.search.Find(r.Context(), f)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, page)
+}
+
+// export writes the trips matching f as CSV. Once rows are written an
+// error can only cut the file short, so it is logged.
+func (h *Handler) export(w http.ResponseWriter, r *http.Request, f SearchFilter) {
+	if _, _, err := h.search.where(f); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="trips.csv"`)
+	out := csv.NewWriter(w)
+	_ = out.Write(csvHeader)
+	rows := 0
+	err := h.search.Each(r.Context(), f, maxExportRows, func(t SearchResult) error {
+		rows++
+		return out.Write(csvRow(t))
+	})
+	out.Flush()
+	if err == nil {
+		err = out.Error()
+	}
+	if err != nil {
+		logger.Error("trip export failed", "rows", rows, "err", err)
+	}
+}
+
+var csvHeader = []string{"id", "status", "created_at", "completed_at", "cancelled_at", "city", "rider_id", "rider_name",
+	"driver_id", "driver_name", "vehicle_type", "pickup_lat", "pickup_lng", "drop_lat", "drop_lng", "fare_minor",
+	"currency", "cancel_reason", "pickup_km"}
+
+func csvRow(t SearchResult) []string {
+	at := func(v *time.Time) string {
+		if v == nil {
+			return ""
+		}
+		return v.UTC().Format(time.RFC3339)
+	}
+	coord := func(v float64) string { return strconv.FormatFloat(v, 'f', 6, 64) }
+	var driverID, fare, currency, km string
+	if t.DriverID != nil {
+		driverID = *t.DriverID
+	}
+	if t.Fare != nil {
+		fare, currency = strconv.FormatInt(t.Fare.Amount, 10), t.Fare.Currency
+	}
+	if t.PickupKm != nil {
+		km = strconv.FormatFloat(*t.PickupKm, 'f', 3, 64)
+	}
+	return []string{t.ID, t.Status, at(&t.CreatedAt), at(t.CompletedAt), at(t.CancelledAt), t.City, t.RiderID,
+		t.RiderName, driverID, t.DriverName, t.VehicleType, coord(t.PickupLat), coord(t.PickupLng), coord(t.DropLat),
+		coord(t.DropLng), fare, currency, t.CancelReason, km}
+}
+
+// ParseSearch reads the filters of GET /admin/trips from its query. The
+// export jobs take the same parameters.
+func ParseSearch(q url.Values) (SearchFilter, error) {
+	f := SearchFilter{Limit: 50, Cursor: q.Get("cursor"), Currency: strings.TrimSpace(q.Get("currency")),
+		City: strings.TrimSpace(q.Get("city")), RiderEmail: strings.TrimSpace(q.Get("rider_email")),
+		DriverEmail: strings.TrimSpace(q.Get("driver_email")), Query: strings.TrimSpace(q.Get("q"))}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > 200 {
+			return f, apierror.Validation("limit must be between 1 and 200")
+		}
+		f.Limit = n
+	}
+	if v := q.Get("status"); v != "" {
+		for _, s := range strings.Split(v, ",") {
+			s = strings.ToUpper(strings.TrimSpace(s))
+			if !ValidStatus(s) {
+				return f, apierror.Validation("unknown status " + strconv.Quote(s))
+			}
+			f.Statuses = append(f.Statuses, s)
+		}
+	}
+	for name, dst := range map[string]*time.Time{"from": &f.From, "to": &f.To} {
+		if raw := q.Get(name); raw != "" {
+			d, err := time.Parse(time.DateOnly, raw)
+			if err != nil {
+				return f, apierror.Validation(name + " must be a YYYY-MM-DD date")
+			}
+			*dst = d
+		}
+	}
+	if !f.To.IsZero() {
+		f.To = f.To.AddDate(0, 0, 1) // to is inclusive
+	}
+	for name, dst := range map[string]**int64{"fare_min": &f.FareMin, "fare_max": &f.FareMax} {
+		if raw := q.Get(name); raw != "" {
+			n, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil || n < 0 {
+				return f, apierror.Validation(name + " must be a non-negative amount in minor units")
+			}
+			*dst = &n
+		}
+	}
+	if raw := q.Get("near"); raw != "" {
+		lat, lng, ok := strings.Cut(raw, ",")
+		p := events.LatLng{}
+		var err1, err2 error
+		p.Lat, err1 = strconv.ParseFloat(strings.TrimSpace(lat), 64)
+		p.Lng, err2 = strconv.ParseFloat(strings.TrimSpace(lng), 64)
+		if !ok || err1 != nil || err2 != nil || !validation.ValidateCoordinates(p.Lat, p.Lng) {
+			return f, apierror.Validation("near must be lat,lng")
+		}
+		km, err := strconv.ParseFloat(q.Get("within_km"), 64)
+		if err != nil || km <= 0 || km > MaxSearchKm {
+			return f, apierror.Validation(fmt.Sprintf("within_km must be more than 0 and at most %d with near", MaxSearchKm))
+		}
+		f.Near, f.WithinKm = &p, km
+	}
+	return f, nil
+}
+
+func parseBBox(raw string) (BoundingBox, bool) {
+	parts := strings.Split(raw, ",")
+	if len(parts) != 4 {
+		return BoundingBox{}, false
+	}
+	var v [4]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return BoundingBox{}, false
+		}
+		v[i] = f
+	}
+	box := BoundingBox{MinLng: v[0], MinLat: v[1], MaxLng: v[2], MaxLat: v[3]}
+	if !validation.ValidateCoordinates(box.MinLat, box.MinLng) ||
+		!validation.ValidateCoordinates(box.MaxLat, box.MaxLng) ||
+		box.MinLat >= box.MaxLat || box.MinLng >= box.MaxLng {
+		return BoundingBox{}, false
+	}
+	return box, true
+}
+
+// IfMatch reads the trip version the client last saw from If-Match (the
+// ETag of GET /trips/:id). A missing or malformed header is answered here.
+func IfMatch(w http.ResponseWriter, r *http.Request) (int, bool) {
+	raw := r.Header.Get("If-Match")
+	if raw == "" {
+		apierror.Write(w, apierror.New(http.StatusPreconditionRequired, apierror.CodePreconditionRequired, "If-Match header with the trip version is required"))
+		return 0, false
+	}
+	v, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(raw, "W/"), `"`))
+	if err != nil || v < 1 {
+		apierror.Write(w, apierror.Validation("If-Match must be a trip version, e.g. \"3\""))
+		return 0, false
+	}
+	return v, true
+}
+
+// CurrentTrip serves a driver's trip in progress to apps that poll for it.
+// Its ETag is the trip's version, and the queued trip's, so a poll sending it
+// as If-None-Match gets 304 until either changes.
+func (h *Handler) CurrentTrip(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	claims := jwt.GetClaims(r.Context())
+	if claims == nil || (claims.UserID != id && claims.Role != "admin" && claims.Role != "support") {
+		apierror.Write(w, apierror.Forbidden("forbidden"))
+		return
+	}
+	c, err := h.svc.CurrentTrip(r.Context(), id)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	tag := strconv.Itoa(c.Version)
+	if c.Queued != nil {
+		tag += "+" + c.Queued.ID + "." + strconv.Itoa(c.Queued.Version)
+	}
+	etag := strconv.Quote(tag)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if inm := r.Header.Get("If-None-Match"); inm == etag || inm == "W/"+etag {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
-	writeJSON(w, http.StatusOK, t)
+	apierror.WriteJSON(w, http.StatusOK, c)
 }
 
-func writeJSON(w http.ResponseWriter, status int, v any) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(v)
+// writeTrip sends t with its version as the ETag.
+func writeTrip(w http.ResponseWriter, t *Trip) {
+	w.Header().Set("ETag", strconv.Quote(strconv.Itoa(t.Version)))
+	apierror.WriteJSON(w, http.StatusOK, t)
 }
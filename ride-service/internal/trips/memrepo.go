@@ -0,0 +1,402 @@
+package trips
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"ride-service/internal/events"
+	"ride-service/internal/trips/statemachine"
+	"ride-service/pkg/money"
+)
+
+// MemoryRepo is an in-memory TripRepo for tests and local experiments.
+type MemoryRepo struct {
+	mu     sync.Mutex
+	trips  map[string]Trip
+	offers []memOffer
+}
+
+type memOffer struct{ tripID, driverID, status string }
+
+// NewMemoryRepo returns an empty MemoryRepo.
+func NewMemoryRepo() *MemoryRepo { return &MemoryRepo{trips: map[string]Trip{}} }
+
+func (m *MemoryRepo) Create(_ context.Context, t *Trip) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, o := range m.trips {
+		if o.RiderID == t.RiderID && activeForRider(o.Status) {
+			return ErrActiveTrip
+		}
+	}
+	t.CreatedAt, t.Version = time.Now(), 1
+	m.trips[t.ID] = clone(*t)
+	return nil
+}
+
+func (m *MemoryRepo) GetByID(_ context.Context, id string) (*Trip, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.trips[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	t = clone(t)
+	return &t, nil
+}
+
+func (m *MemoryRepo) Assign(_ context.Context, tripID, driverID string, version int) error {
+	_, err := m.transition(tripID, version, statemachine.Assign, driverID, func(t *Trip) error {
+		if m.driverHas(driverID, StatusDriverAssigned) {
+			return ErrDriverBusy
+		}
+		t.DriverID = &driverID
+		m.offers = append(m.offers, memOffer{tripID: tripID, driverID: driverID, status: OfferPending})
+		return nil
+	})
+	return err
+}
+
+func (m *MemoryRepo) Respond(_ context.Context, tripID, driverID string, version int, from, to string) error {
+	_, err := m.transition(tripID, version, offerEvents[to], driverID, func(t *Trip) error {
+		o := m.offer(tripID, driverID, from)
+		if o == nil {
+			return ErrOfferState
+		}
+		o.status = to
+		return nil
+	})
+	return err
+}
+
+func (m *MemoryRepo) Released(_ context.Context, tripID string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []string
+	for _, o := range m.offers {
+		if o.tripID == tripID && (o.status == OfferDeclined || o.status == OfferCancelled) {
+			out = append(out, o.driverID)
+		}
+	}
+	return out, nil
+}
+
+func (m *MemoryRepo) Start(_ context.Context, tripID string, at time.Time, version int) error {
+	_, err := m.transition(tripID, version, statemachine.Start, "", func(t *Trip) error {
+		if t.DriverID != nil && m.driverHas(*t.DriverID, StatusStarted) {
+			return ErrDriverBusy
+		}
+		t.StartedAt = &at
+		m.acceptPending(tripID)
+		return nil
+	})
+	return err
+}
+
+func (m *MemoryRepo) Complete(_ context.Context, tripID string, ev statemachine.Event, actor string, version int, fn func(t *Trip) (Completion, error)) (*Trip, error) {
+	return m.transition(tripID, version, ev, actor, func(t *Trip) error {
+		c, err := fn(t)
+		if err != nil {
+			return err
+		}
+		if t.StartedAt == nil {
+			t.StartedAt = c.StartedAt
+		}
+		fare, ended, commission := c.Fare, c.EndedAt, c.Commission
+		t.Fare, t.CompletedAt, t.Commission = &fare, &ended, &commission
+		if c.PricingVersion != 0 {
+			t.PricingVersion = &c.PricingVersion
+		}
+		if c.CommissionVersion != 0 {
+			t.CommissionVersion = &c.CommissionVersion
+		}
+		t.PausedAt, t.PausedSeconds = nil, c.PausedSeconds
+		m.acceptPending(tripID)
+		return nil
+	})
+}
+
+func (m *MemoryRepo) Arrive(_ context.Context, tripID, driverID string, version int, check func(t *Trip) error) error {
+	_, err := m.transition(tripID, version, statemachine.Arrive, driverID, func(t *Trip) error {
+		if err := check(t); err != nil {
+			return err
+		}
+		m.acceptPending(tripID)
+		return nil
+	})
+	return err
+}
+
+func (m *MemoryRepo) NoShow(_ context.Context, tripID, driverID string, version int, fn func(t *Trip) (fee money.Money, pricingVersion int64, err error)) (*Trip, error) {
+	return m.transition(tripID, version, statemachine.NoShow, driverID, func(t *Trip) error {
+		fee, pricingVersion, err := fn(t)
+		if err != nil {
+			return err
+		}
+		t.NoShowFee = &fee
+		t.Cancellation = &Cancellation{By: ActorDriver, Reason: ReasonRiderNoShow}
+		if pricingVersion != 0 {
+			t.PricingVersion = &pricingVersion
+		}
+		m.acceptPending(tripID)
+		return nil
+	})
+}
+
+func (m *MemoryRepo) Pause(_ context.Context, tripID, actor string, at time.Time, version int) error {
+	_, err := m.transition(tripID, version, statemachine.Pause, actor, func(t *Trip) error {
+		if t.PausedAt != nil {
+			return ErrPaused
+		}
+		t.PausedAt = &at
+		return nil
+	})
+	return err
+}
+
+func (m *MemoryRepo) Resume(_ context.Context, tripID, actor string, at time.Time, version int) error {
+	_, err := m.transition(tripID, version, statemachine.Resume, actor, func(t *Trip) error {
+		if t.PausedAt == nil {
+			return ErrNotPaused
+		}
+		t.PausedAt, t.PausedSeconds = nil, int64(t.PausedFor(at).Seconds())
+		return nil
+	})
+	return err
+}
+
+func (m *MemoryRepo) Expire(_ context.Context, tripID string, version int) (*Trip, error) {
+	return m.transition(tripID, version, statemachine.Expire, "", func(t *Trip) error {
+		t.Cancellation = &Cancellation{By: ActorSystem, Reason: ReasonNoDriver}
+		return nil
+	})
+}
+
+func (m *MemoryRepo) Cancel(_ context.Context, tripID, riderID string, version int, c Cancellation) (*Trip, error) {
+	return m.transition(tripID, version, statemachine.Cancel, riderID, func(t *Trip) error {
+		if t.RiderID != riderID {
+			return ErrNotRider
+		}
+		t.Cancellation = &c
+		return nil
+	})
+}
+
+func (m *MemoryRepo) ListUnmatched(_ context.Context, before time.Time, limit int) ([]Trip, error) {
+	return m.oldest(func(t Trip) *time.Time {
+		if t.Status != StatusRequested && t.Status != StatusMatching {
+			return nil
+		}
+		return &t.CreatedAt
+	}, before, limit), nil
+}
+
+func (m *MemoryRepo) ListStartedBefore(_ context.Context, before time.Time, limit int) ([]Trip, error) {
+	return m.oldest(func(t Trip) *time.Time {
+		if t.Status != StatusStarted {
+			return nil
+		}
+		return t.StartedAt
+	}, before, limit), nil
+}
+
+// oldest returns up to limit trips whose time, as at returns it, is before
+// before, oldest first. Trips at returns nil for are skipped.
+func (m *MemoryRepo) oldest(at func(Trip) *time.Time, before time.Time, limit int) []Trip {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := []Trip{}
+	for _, t := range m.trips {
+		if ts := at(t); ts != nil && ts.Before(before) {
+			out = append(out, clone(t))
+		}
+	}
+	slices.SortFunc(out, func(a, b Trip) int { return at(a).Compare(*at(b)) })
+	if len(out) > limit {
+		out = out[:limit]
+	}
+	return out
+}
+
+func (m *MemoryRepo) ListActiveByDrivers(_ context.Context, driverIDs []string) ([]Trip, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	want := make(map[string]bool, len(driverIDs))
+	for _, id := range driverIDs {
+		want[id] = true
+	}
+	out := []Trip{}
+	for _, t := range m.trips {
+		if t.DriverID != nil && want[*t.DriverID] &&
+			(t.Status == StatusDriverAssigned || t.Status == StatusStarted) {
+			out = append(out, clone(t))
+		}
+	}
+	slices.SortStableFunc(out, func(a, b Trip) int {
+		switch {
+		case a.Status == b.Status:
+			return 0
+		case a.Status == StatusStarted:
+			return -1
+		}
+		return 1
+	})
+	return out, nil
+}
+
+// driverHas reports whether driverID has a trip in status. Call with mu held.
+func (m *MemoryRepo) driverHas(driverID, status string) bool {
+	for _, o := range m.trips {
+		if o.DriverID != nil && *o.DriverID == driverID && o.Status == status {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *MemoryRepo) ListActiveByRider(_ context.Context, riderID string) ([]Trip, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := []Trip{}
+	for _, t := range m.trips {
+		if t.RiderID == riderID && activeForRider(t.Status) {
+			out = append(out, clone(t))
+		}
+	}
+	return out, nil
+}
+
+func (m *MemoryRepo) OpenOffer(_ context.Context, tripID, driverID string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, status := range []string{OfferPending, OfferAccepted} {
+		if m.offer(tripID, driverID, status) != nil {
+			return status, nil
+		}
+	}
+	return "", nil
+}
+
+func (m *MemoryRepo) ChangeRoute(_ context.Context, tripID, driverID string, version int, fn func(t *Trip) (RouteChange, error)) (*Trip, error) {
+	return m.transition(tripID, version, statemachine.Modify, driverID, func(t *Trip) error {
+		c, err := fn(t)
+		if err != nil {
+			return err
+		}
+		if c.Drop != nil {
+			t.DropLat, t.DropLng = c.Drop.Lat, c.Drop.Lng
+			t.DestinationChanges++
+		}
+		t.Stops = append(t.Stops, c.Stops...)
+		return nil
+	})
+}
+
+// AdjustFare keeps the commission at the share of the old fare it was; the
+// memory repo has no commission rules to look the rate up in.
+func (m *MemoryRepo) AdjustFare(_ context.Context, tripID string, version int, fn func(t *Trip) (money.Money, error)) (*Trip, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.trips[tripID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if version != AnyVersion && t.Version != version {
+		return nil, ErrVersionConflict
+	}
+	if t.Status != StatusCompleted {
+		return nil, fmt.Errorf("%w: cannot adjust the fare of a %s trip (needs %s)", ErrStateChanged, t.Status, StatusCompleted)
+	}
+	t = clone(t)
+	fare, err := fn(&t)
+	if err != nil {
+		return nil, err
+	}
+	if t.Commission != nil && t.Fare != nil && t.Fare.Amount != 0 {
+		c := money.New(int64(math.Round(float64(t.Commission.Amount)*float64(fare.Amount)/float64(t.Fare.Amount))), fare.Currency)
+		t.Commission = &c
+	}
+	t.Fare = &fare
+	t.Version++
+	m.trips[tripID] = t
+	t = clone(t)
+	return &t, nil
+}
+
+// Lock is GetByID: the memory repo has no transactions to lock in.
+func (m *MemoryRepo) Lock(ctx context.Context, tripID string) (*Trip, error) {
+	return m.GetByID(ctx, tripID)
+}
+
+func activeForRider(status string) bool {
+	switch status {
+	case StatusRequested, StatusMatching, StatusDriverAssigned, StatusStarted:
+		return true
+	}
+	return false
+}
+
+// offer returns the driver's offer on tripID in status, or nil.
+func (m *MemoryRepo) offer(tripID, driverID, status string) *memOffer {
+	for i := range m.offers {
+		if o := &m.offers[i]; o.tripID == tripID && o.driverID == driverID && o.status == status {
+			return o
+		}
+	}
+	return nil
+}
+
+func (m *MemoryRepo) acceptPending(tripID string) {
+	for i := range m.offers {
+		if o := &m.offers[i]; o.tripID == tripID && o.status == OfferPending {
+			o.status = OfferAccepted
+		}
+	}
+}
+
+// transition applies ev and fn if the trip is at version and the state
+// machine allows it, like pgRepo.transition. An error from fn leaves the trip
+// unchanged.
+func (m *MemoryRepo) transition(tripID string, version int, ev statemachine.Event, actor string, fn func(*Trip) error) (*Trip, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t, ok := m.trips[tripID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if version != AnyVersion && t.Version != version {
+		return nil, ErrVersionConflict
+	}
+	tr, err := statemachine.Check(ev, t.Status, t.parties(), actor)
+	if err != nil {
+		return nil, err
+	}
+	t = clone(t)
+	if err := fn(&t); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, st := range tr.Stamps {
+		if f := stampField(&t, st); *f == nil {
+			*f = &now
+		}
+	}
+	if tr.ClearDriver {
+		t.DriverID = nil
+	}
+	t.Status = tr.After(t.Status)
+	t.Version++
+	m.trips[tripID] = t
+	t = clone(t)
+	return &t, nil
+}
+
+// clone copies the stops so callers cannot mutate stored trips.
+func clone(t Trip) Trip {
+	t.Stops = append([]events.LatLng{}, t.Stops...)
+	return t
+}
@@ -0,0 +1,274 @@
+package trips
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"ride-service/internal/events"
+	"ride-service/internal/trips/statemachine"
+	"ride-service/pkg/money"
+)
+
+const testDriver = "driver-1"
+
+// startedTrip stores a trip its driver has started and returns it.
+func startedTrip(t *testing.T, repo *MemoryRepo) *Trip {
+	t.Helper()
+	ctx := context.Background()
+	trip := &Trip{ID: "trip-1", RiderID: "rider-1", Status: StatusRequested, DropLat: 12.97, DropLng: 77.59}
+	if err := repo.Create(ctx, trip); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Assign(ctx, trip.ID, testDriver, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Start(ctx, trip.ID, time.Now(), 2); err != nil {
+		t.Fatal(err)
+	}
+	got, err := repo.GetByID(ctx, trip.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+// completedTrip stores a completed trip with a fare of 100.00 INR of which
+// 20.00 is commission, and returns it.
+func completedTrip(t *testing.T, repo *MemoryRepo) *Trip {
+	t.Helper()
+	trip := startedTrip(t, repo)
+	done, err := repo.Complete(context.Background(), trip.ID, statemachine.Complete, "", trip.Version,
+		func(*Trip) (Completion, error) {
+			return Completion{Fare: money.New(10000, "INR"), Commission: money.New(2000, "INR"), EndedAt: time.Now()}, nil
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return done
+}
+
+func TestChangeRoute(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo()
+	trip := startedTrip(t, repo)
+
+	drop := &events.LatLng{Lat: 13.01, Lng: 77.65}
+	stop := events.LatLng{Lat: 12.99, Lng: 77.61}
+	var seen Trip
+	got, err := repo.ChangeRoute(ctx, trip.ID, testDriver, trip.Version, func(t *Trip) (RouteChange, error) {
+		seen = *t
+		return RouteChange{Drop: drop, Stops: []events.LatLng{stop}}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen.DropLat != trip.DropLat || seen.DropLng != trip.DropLng {
+		t.Errorf("fn saw drop %v,%v, want the old one", seen.DropLat, seen.DropLng)
+	}
+	if got.DropLat != drop.Lat || got.DropLng != drop.Lng || len(got.Stops) != 1 || got.Stops[0] != stop {
+		t.Errorf("route = %v,%v via %v", got.DropLat, got.DropLng, got.Stops)
+	}
+	if got.DestinationChanges != 1 || got.Version != trip.Version+1 || got.Status != StatusStarted {
+		t.Errorf("destination changes %d, version %d, status %s", got.DestinationChanges, got.Version, got.Status)
+	}
+
+	// Stops alone are not a new destination.
+	got, err = repo.ChangeRoute(ctx, trip.ID, testDriver, got.Version, func(*Trip) (RouteChange, error) {
+		return RouteChange{Stops: []events.LatLng{stop}}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.DestinationChanges != 1 || len(got.Stops) != 2 {
+		t.Errorf("after stops only: destination changes %d, stops %v", got.DestinationChanges, got.Stops)
+	}
+}
+
+func TestChangeRouteRefused(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo()
+	trip := startedTrip(t, repo)
+	change := func(*Trip) (RouteChange, error) {
+		return RouteChange{Drop: &events.LatLng{Lat: 1, Lng: 1}}, nil
+	}
+	errAbort := errors.New("abort")
+
+	tests := []struct {
+		name     string
+		tripID   string
+		driverID string
+		version  int
+		fn       func(*Trip) (RouteChange, error)
+		want     error
+	}{
+		{"stale version", trip.ID, testDriver, trip.Version - 1, change, ErrVersionConflict},
+		{"other driver", trip.ID, "driver-2", trip.Version, change, statemachine.ErrNotAssignedDriver},
+		{"fn fails", trip.ID, testDriver, trip.Version, func(*Trip) (RouteChange, error) { return RouteChange{}, errAbort }, errAbort},
+		{"unknown trip", "no-such-trip", testDriver, AnyVersion, change, ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := repo.ChangeRoute(ctx, tt.tripID, tt.driverID, tt.version, tt.fn); !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			got, _ := repo.GetByID(ctx, trip.ID)
+			if got.Version != trip.Version || got.DropLat != trip.DropLat || got.DestinationChanges != 0 {
+				t.Errorf("trip changed: version %d, drop lat %v", got.Version, got.DropLat)
+			}
+		})
+	}
+
+	repo = NewMemoryRepo()
+	done := completedTrip(t, repo)
+	if _, err := repo.ChangeRoute(ctx, done.ID, testDriver, done.Version, change); !errors.Is(err, ErrStateChanged) {
+		t.Errorf("completed trip: err = %v, want ErrStateChanged", err)
+	}
+}
+
+func TestAdjustFare(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo()
+	trip := completedTrip(t, repo)
+
+	var seen money.Money
+	got, err := repo.AdjustFare(ctx, trip.ID, AnyVersion, func(t *Trip) (money.Money, error) {
+		seen = *t.Fare
+		return money.New(8000, "INR"), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen.Amount != 10000 {
+		t.Errorf("fn saw fare %d, want the old 10000", seen.Amount)
+	}
+	if got.Fare.Amount != 8000 || got.Commission.Amount != 1600 || got.Version != trip.Version+1 {
+		t.Errorf("fare %d, commission %d, version %d; want 8000, 1600, %d",
+			got.Fare.Amount, got.Commission.Amount, got.Version, trip.Version+1)
+	}
+
+	if _, err := repo.AdjustFare(ctx, trip.ID, trip.Version, func(*Trip) (money.Money, error) {
+		return money.New(5000, "INR"), nil
+	}); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("stale version: err = %v, want ErrVersionConflict", err)
+	}
+	errAbort := errors.New("abort")
+	if _, err := repo.AdjustFare(ctx, trip.ID, got.Version, func(*Trip) (money.Money, error) {
+		return money.Money{}, errAbort
+	}); !errors.Is(err, errAbort) {
+		t.Errorf("fn fails: err = %v, want it returned", err)
+	}
+	if after, _ := repo.GetByID(ctx, trip.ID); after.Fare.Amount != 8000 || after.Version != got.Version {
+		t.Errorf("refused adjustments changed the trip: fare %d, version %d", after.Fare.Amount, after.Version)
+	}
+}
+
+func TestAdjustFareNeedsCompletedTrip(t *testing.T) {
+	repo := NewMemoryRepo()
+	trip := startedTrip(t, repo)
+	_, err := repo.AdjustFare(context.Background(), trip.ID, AnyVersion, func(*Trip) (money.Money, error) {
+		t.Error("fn called for a started trip")
+		return money.New(1, "INR"), nil
+	})
+	if !errors.Is(err, ErrStateChanged) {
+		t.Errorf("err = %v, want ErrStateChanged", err)
+	}
+}
+
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo()
+	trip := startedTrip(t, repo)
+	got, err := repo.Lock(ctx, trip.ID)
+	if err != nil || got.ID != trip.ID || got.Version != trip.Version {
+		t.Errorf("Lock = %+v, %v", got, err)
+	}
+	if _, err := repo.Lock(ctx, "no-such-trip"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("unknown trip: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestConcurrentTransitionsOnOneVersion(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo()
+	trip := &Trip{ID: "trip-1", RiderID: "rider-1", Status: StatusRequested}
+	if err := repo.Create(ctx, trip); err != nil {
+		t.Fatal(err)
+	}
+
+	// Drivers race to be assigned the trip at the version they read: one
+	// wins, the rest see a conflict rather than overwriting it.
+	const racers = 8
+	errs := make([]error, racers)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = repo.Assign(ctx, trip.ID, fmt.Sprintf("driver-%d", i), 1)
+		}(i)
+	}
+	wg.Wait()
+
+	var winner string
+	for i, err := range errs {
+		switch {
+		case err == nil && winner != "":
+			t.Fatalf("driver-%d and %s were both assigned", i, winner)
+		case err == nil:
+			winner = fmt.Sprintf("driver-%d", i)
+		case !errors.Is(err, ErrVersionConflict):
+			t.Fatalf("driver-%d: err = %v, want ErrVersionConflict", i, err)
+		}
+	}
+	got, _ := repo.GetByID(ctx, trip.ID)
+	if winner == "" || got.DriverID == nil || *got.DriverID != winner || got.Version != 2 {
+		t.Fatalf("trip has driver %v at version %d, want %s at 2", got.DriverID, got.Version, winner)
+	}
+}
+
+func TestTransitionsCheckVersionBeforeState(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo()
+	trip := startedTrip(t, repo)
+
+	tests := []struct {
+		name    string
+		version int
+		want    error
+	}{
+		{"stale version", trip.Version - 1, ErrVersionConflict},
+		{"future version", trip.Version + 1, ErrVersionConflict},
+		{"current version, wrong state", trip.Version, statemachine.ErrInvalidTransition},
+		{"any version, wrong state", AnyVersion, statemachine.ErrInvalidTransition},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A started trip cannot be started again.
+			if err := repo.Start(ctx, trip.ID, time.Now(), tt.version); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+	if got, _ := repo.GetByID(ctx, trip.ID); got.Version != trip.Version {
+		t.Errorf("refused transitions moved the version to %d", got.Version)
+	}
+}
+
+func TestPauseIsForTheTripsParties(t *testing.T) {
+	ctx := context.Background()
+	repo := NewMemoryRepo()
+	trip := startedTrip(t, repo)
+	if err := repo.Pause(ctx, trip.ID, "rider-2", time.Now(), AnyVersion); !errors.Is(err, statemachine.ErrNotParticipant) {
+		t.Fatalf("stranger: err = %v, want ErrNotParticipant", err)
+	}
+	if err := repo.Pause(ctx, trip.ID, trip.RiderID, time.Now(), AnyVersion); err != nil {
+		t.Fatalf("rider: %v", err)
+	}
+	if err := repo.Resume(ctx, trip.ID, testDriver, time.Now(), AnyVersion); err != nil {
+		t.Fatalf("driver: %v", err)
+	}
+}
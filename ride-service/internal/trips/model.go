@@ -1,49 +1,258 @@
 package trips
 
-import "time"
+import (
+	"fmt"
+	"time"
 
-// TripStatus enumerates the lifecycle states.
+	"ride-service/internal/events"
+	"ride-service/internal/trips/statemachine"
+	"ride-service/pkg/money"
+)
+
+// TripStatus enumerates the lifecycle states; statemachine defines the
+// transitions between them.
+const (
+	StatusRequested      = statemachine.Requested
+	StatusMatching       = statemachine.Matching
+	StatusDriverAssigned = statemachine.DriverAssigned
+	StatusStarted        = statemachine.Started
+	StatusCompleted      = statemachine.Completed
+	StatusCancelled      = statemachine.Cancelled
+)
+
+// Offer states. Every assignment offers the trip to the driver; declining or
+// cancelling after accepting sends the trip back to matching.
+const (
+	OfferPending   = "pending"
+	OfferAccepted  = "accepted"
+	OfferDeclined  = "declined"
+	OfferCancelled = "cancelled"
+)
+
+// Who cancelled a trip.
+const (
+	ActorRider  = "rider"
+	ActorDriver = "driver"
+	ActorSystem = "system"
+)
+
+// Cancellation reasons. Riders and drivers pick one of their own when they
+// cancel, with a note for ReasonOther; the service records the rest.
 const (
-	StatusRequested      = "REQUESTED"
-	StatusMatching       = "MATCHING"
-	StatusDriverAssigned = "DRIVER_ASSIGNED"
-	StatusStarted        = "STARTED"
-	StatusCompleted      = "COMPLETED"
-	StatusCancelled      = "CANCELLED"
+	ReasonChangedPlans     = "changed_plans"
+	ReasonWaitTooLong      = "wait_too_long"
+	ReasonDriverNotMoving  = "driver_not_moving"
+	ReasonWrongPickup      = "wrong_pickup"
+	ReasonFoundOtherRide   = "found_other_ride"
+	ReasonDriverAsked      = "driver_asked" // the driver asked the rider to cancel
+	ReasonRiderUnreachable = "rider_unreachable"
+	ReasonPickupTooFar     = "pickup_too_far"
+	ReasonVehicleIssue     = "vehicle_issue"
+	ReasonUnsafePickup     = "unsafe_pickup"
+	ReasonRiderAsked       = "rider_asked" // the rider asked the driver to cancel
+	ReasonOther            = "other"
+
+	ReasonRiderNoShow = "rider_no_show" // a driver's no-show report
+	ReasonNoDriver    = "no_driver"     // the watchdog gave up matching
 )
 
+// RiderReasons and DriverReasons are the reasons each side may give.
+var (
+	RiderReasons  = []string{ReasonChangedPlans, ReasonWaitTooLong, ReasonDriverNotMoving, ReasonWrongPickup, ReasonFoundOtherRide, ReasonDriverAsked, ReasonOther}
+	DriverReasons = []string{ReasonRiderUnreachable, ReasonPickupTooFar, ReasonVehicleIssue, ReasonUnsafePickup, ReasonRiderAsked, ReasonOther}
+)
+
+// Cancellation is who cancelled a trip and why.
+type Cancellation struct {
+	By     string `json:"by"` // rider | driver | system
+	Reason string `json:"reason"`
+	Note   string `json:"note,omitempty"`
+}
+
 // Trip represents a ride in the system.
 type Trip struct {
-	ID          string     `json:"id"`
-	RiderID     string     `json:"rider_id"`
-	DriverID    *string    `json:"driver_id,omitempty"`
-	PickupLat   float64    `json:"pickup_lat"`
-	PickupLng   float64    `json:"pickup_lng"`
-	DropLat     float64    `json:"drop_lat"`
-	DropLng     float64    `json:"drop_lng"`
-	Fare        *float64   `json:"fare,omitempty"`
-	Status      string     `json:"status"`
-	RequestedAt *time.Time `json:"requested_at,omitempty"`
-	StartedAt   *time.Time `json:"started_at,omitempty"`
-	CompletedAt *time.Time `json:"completed_at,omitempty"`
-	CreatedAt   time.Time  `json:"created_at"`
+	ID          string          `json:"id"`
+	RiderID     string          `json:"rider_id"`
+	DriverID    *string         `json:"driver_id,omitempty"`
+	PickupLat   float64         `json:"pickup_lat"`
+	PickupLng   float64         `json:"pickup_lng"`
+	DropLat     float64         `json:"drop_lat"`
+	DropLng     float64         `json:"drop_lng"`
+	Stops       []events.LatLng `json:"stops,omitempty"` // approved mid-trip stops, in order
+	VehicleType string          `json:"vehicle_type,omitempty"`
+	// Seats, Accessibility, ChildSeats and LuggageLitres are what the rider
+	// asked the vehicle to offer.
+	Seats         int          `json:"seats,omitempty"`
+	Accessibility []string     `json:"accessibility,omitempty"`
+	ChildSeats    int          `json:"child_seats,omitempty"`
+	LuggageLitres int          `json:"luggage_litres,omitempty"`
+	WomenOnly     bool         `json:"women_only,omitempty"` // matched with women drivers only
+	Fare          *money.Money `json:"fare,omitempty"`       // in minor units: {"amount":35600,"currency":"INR"}
+	// Surcharges are the extras included in Fare, once the trip completed.
+	Surcharges  []events.Surcharge `json:"surcharges,omitempty"`
+	Status      string             `json:"status"`
+	RequestedAt *time.Time         `json:"requested_at,omitempty"`
+	StartedAt   *time.Time         `json:"started_at,omitempty"`
+	CompletedAt *time.Time         `json:"completed_at,omitempty"`
+	// ArrivedAt is when the driver reported reaching the pickup point.
+	ArrivedAt    *time.Time    `json:"arrived_at,omitempty"`
+	CancelledAt  *time.Time    `json:"cancelled_at,omitempty"`
+	Cancellation *Cancellation `json:"cancellation,omitempty"` // set on CANCELLED trips
+	// NoShowFee is what the rider is charged when the driver gave up
+	// waiting for them.
+	NoShowFee *money.Money `json:"no_show_fee,omitempty"`
+	// PricingVersion and CommissionVersion are the versions of the fare and
+	// commission rules the trip was priced with, and Commission the
+	// platform's cut of Fare; the driver earns the rest.
+	PricingVersion    *int64       `json:"pricing_version,omitempty"`
+	CommissionVersion *int64       `json:"commission_version,omitempty"`
+	Commission        *money.Money `json:"commission,omitempty"`
+	// QuoteID is the fare quote the trip was requested with; it is priced at
+	// the quoted rate.
+	QuoteID *string `json:"quote_id,omitempty"`
+	// DestinationChanges counts the new drops the driver approved mid-trip;
+	// GET /trips/:id/modifications has their history.
+	DestinationChanges int `json:"destination_changes,omitempty"`
+	// PausedAt is when the current pause of a STARTED trip began, and
+	// PausedSeconds how long its earlier pauses lasted. Paused time is
+	// charged at the waiting rate.
+	PausedAt      *time.Time `json:"paused_at,omitempty"`
+	PausedSeconds int64      `json:"paused_seconds,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	// Version increases on every state change. Writers send the version they
+	// read (If-Match on HTTP) and get a conflict if it has moved on.
+	Version int `json:"version"`
+
+	// Vehicle is filled in once a driver is assigned so the rider can spot the car.
+	Vehicle *events.VehicleCard `json:"vehicle,omitempty"`
+}
+
+// PausedFor returns how long t has been paused in all, counting a pause
+// still going on up to at.
+func (t *Trip) PausedFor(at time.Time) time.Duration {
+	d := time.Duration(t.PausedSeconds) * time.Second
+	if t.PausedAt != nil && at.After(*t.PausedAt) {
+		d += at.Sub(*t.PausedAt).Truncate(time.Second)
+	}
+	return d
+}
+
+// parties returns t's rider and driver for the state machine's guards.
+func (t *Trip) parties() statemachine.Parties {
+	return statemachine.Parties{RiderID: t.RiderID, DriverID: t.DriverID}
 }
 
 // TripRequest is the body for POST /trips/request.
 type TripRequest struct {
-	PickupLat float64 `json:"pickupLat"`
-	PickupLng float64 `json:"pickupLng"`
-	DropLat   float64 `json:"dropLat"`
-	DropLng   float64 `json:"dropLng"`
+	PickupLat float64 `json:"pickupLat" validate:"required,min=-90,max=90"`
+	PickupLng float64 `json:"pickupLng" validate:"required,min=-180,max=180"`
+	DropLat   float64 `json:"dropLat" validate:"required,min=-90,max=90"`
+	DropLng   float64 `json:"dropLng" validate:"required,min=-180,max=180"`
+	// VehicleType asks for a vehicle type (e.g. sedan); matching prefers,
+	// but does not require, drivers with it.
+	VehicleType string `json:"vehicleType" validate:"maxLength=50"`
+	// Seats and Accessibility are required: only drivers whose active
+	// vehicle has that many seats and every feature listed are matched.
+	Seats         int      `json:"seats" validate:"min=0,max=8"`        // 0 for any
+	Accessibility []string `json:"accessibility" validate:"maxItems=4"` // wheelchair, assistance, service_animal, hearing_support
+	// ChildSeats and LuggageLitres are required the same way, and priced
+	// as surcharges on top of the distance fare.
+	ChildSeats    int `json:"childSeats" validate:"min=0,max=3"`
+	LuggageLitres int `json:"luggageLitres" validate:"min=0,max=2000"`
+	// QuoteID is a fare quote from POST /fares/estimate to price the trip
+	// with; optional.
+	QuoteID string `json:"quoteId" validate:"format=uuid"`
+	// WomenOnly asks for a woman driver. Only riders whose profile says
+	// female can ask, and only in the cities configured for it.
+	WomenOnly bool `json:"womenOnly"`
 }
 
 // AssignRequest is the body for PATCH /trips/:id/assign.
 type AssignRequest struct {
-	DriverID string `json:"driverId"`
+	DriverID string `json:"driverId" validate:"required,format=uuid"`
+}
+
+// CancelRequest is the body for PATCH /trips/:id/cancel. Reason is one of
+// RiderReasons or DriverReasons, depending on who cancels.
+type CancelRequest struct {
+	Reason string `json:"reason" validate:"required"`
+	Note   string `json:"note" validate:"maxLength=500"` // required with reason "other"
 }
 
 // EndRequest is the optional body for PATCH /trips/:id/end.
 type EndRequest struct {
-	DistanceKm      *float64 `json:"distanceKm,omitempty"`
-	DurationSeconds *int64   `json:"durationSeconds,omitempty"`
+	DistanceKm      *float64 `json:"distanceKm,omitempty" validate:"min=0"`
+	DurationSeconds *int64   `json:"durationSeconds,omitempty" validate:"min=0"`
+}
+
+// ActiveTrip is an in-flight trip enriched with its driver's live position,
+// as returned by GET /admin/trips/active.
+type ActiveTrip struct {
+	Trip
+	DriverLat float64 `json:"driver_lat"`
+	DriverLng float64 `json:"driver_lng"`
+}
+
+// Next steps of a driver's trip in progress, as CurrentTrip reports them.
+const (
+	NextRespond       = "respond"         // accept or decline the offer
+	NextDriveToPickup = "drive_to_pickup" // then report arriving
+	NextWaitForRider  = "wait_for_rider"  // then start, or report a no-show from NoShowAt
+	NextDriveToDrop   = "drive_to_drop"   // through the stops, then end
+	NextResume        = "resume"          // the trip is paused
+)
+
+// CurrentTrip is a driver's trip in progress as GET
+// /drivers/:id/current-trip returns it, for driver apps that poll instead
+// of holding a socket.
+type CurrentTrip struct {
+	Trip
+	Offer     string `json:"offer"` // pending or accepted
+	RiderName string `json:"rider_name"`
+	Next      string `json:"next"`
+	// NoShowAt is when the driver, waiting at the pickup, may report a
+	// no-show.
+	NoShowAt   *time.Time `json:"no_show_at,omitempty"`
+	Navigation Navigation `json:"navigation"`
+	// Queued is the trip the driver was assigned while finishing this one,
+	// to drive to once it ends.
+	Queued *QueuedTrip `json:"queued,omitempty"`
+}
+
+// QueuedTrip is a driver's next trip and their offer on it, which they
+// answer like any other.
+type QueuedTrip struct {
+	Trip
+	Offer string `json:"offer"` // pending or accepted
+}
+
+// Navigation tells the driver where to head for their next step.
+type Navigation struct {
+	Destination events.LatLng   `json:"destination"`         // the pickup, then the drop
+	Waypoints   []events.LatLng `json:"waypoints,omitempty"` // approved stops on the way to the drop
+	// MapsURL opens turn-by-turn directions in Google Maps.
+	MapsURL string `json:"maps_url"`
+}
+
+// BoundingBox is a map viewport in degrees.
+type BoundingBox struct {
+	MinLat, MinLng, MaxLat, MaxLng float64
+}
+
+// OfflineCompletion is the body for POST /trips/:id/offline-completion: a
+// completion the driver app recorded without connectivity, signed with the
+// device's key.
+type OfflineCompletion struct {
+	DeviceID   string    `json:"device_id" validate:"required,format=uuid"`
+	StartedAt  time.Time `json:"started_at" validate:"required"`
+	EndedAt    time.Time `json:"ended_at" validate:"required"`
+	DistanceKm float64   `json:"distance_km" validate:"required,min=0"`            // odometer distance
+	Signature  string    `json:"signature" validate:"required,format=hmac-sha256"` // hex HMAC-SHA256 of SigningString
+}
+
+// SigningString is the canonical message the device signs:
+// tripID|deviceID|startedUnix|endedUnix|distanceKm(3dp).
+func (c OfflineCompletion) SigningString(tripID string) string {
+	return fmt.Sprintf("%s|%s|%d|%d|%.3f",
+		tripID, c.DeviceID, c.StartedAt.Unix(), c.EndedAt.Unix(), c.DistanceKm)
 }
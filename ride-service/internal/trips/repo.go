@@ -0,0 +1,617 @@
+package trips
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/internal/events"
+	"ride-service/internal/trips/statemachine"
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/db"
+	"ride-service/pkg/money"
+)
+
+var (
+	// ErrStateChanged is wrapped by the errors TripRepo transitions return
+	// when the trip's status does not allow them.
+	ErrStateChanged = statemachine.ErrInvalidTransition
+	// ErrVersionConflict is returned when the trip's version no longer
+	// matches the one the caller read.
+	ErrVersionConflict = apierror.Conflict("trip was modified concurrently; reload it and retry").WithCode("version_conflict")
+	// ErrOfferState is returned when the driver's offer is not in the state
+	// the response needs, e.g. declining an offer already accepted.
+	ErrOfferState = apierror.Conflict("offer is not awaiting this response")
+	// ErrActiveTrip is returned by Create when the rider already has a trip
+	// between REQUESTED and STARTED.
+	ErrActiveTrip = apierror.Conflict("rider already has an active trip").WithCode("active_trip")
+	// ErrDriverBusy is returned by Assign when the driver is already
+	// assigned another trip, and by Start while they are still driving one.
+	ErrDriverBusy = apierror.Conflict("driver is already on an active trip").WithCode("driver_busy")
+	// ErrNotAtPickup is returned when the driver's last recorded location is
+	// not at the trip's pickup point.
+	ErrNotAtPickup = apierror.Conflict("driver is not at the pickup point").WithCode("not_at_pickup")
+	// ErrWaitNotOver is returned for a no-show before the driver has waited
+	// at the pickup for long enough.
+	ErrWaitNotOver = apierror.Conflict("the driver has not waited at the pickup long enough").WithCode("wait_not_over")
+	// ErrPaused and ErrNotPaused are returned for pausing a paused trip and
+	// resuming one that is not.
+	ErrPaused    = apierror.Conflict("trip is already paused").WithCode("already_paused")
+	ErrNotPaused = apierror.Conflict("trip is not paused").WithCode("not_paused")
+	// ErrNotRider is returned by Cancel for anyone but the trip's rider.
+	ErrNotRider = apierror.Forbidden("not the rider of this trip")
+)
+
+// AnyVersion skips the version check. Only writers that cannot know the
+// current version use it (signed offline completions, events published
+// before versions existed).
+const AnyVersion = 0
+
+// Completion is what TripRepo.Complete records on a finished trip.
+type Completion struct {
+	Fare       money.Money // including Surcharges
+	Surcharges []events.Surcharge
+	DistanceKm float64
+	StartedAt  *time.Time // only fills a missing start time
+	EndedAt    time.Time
+	Source     string // CompletionOnline | CompletionOfflineSigned
+	// PausedSeconds is all the time the trip was paused; a pause still
+	// going on ends with the trip.
+	PausedSeconds int64
+	// The rule versions Fare was priced with (0 for none), and the
+	// platform's cut of it.
+	PricingVersion    int64
+	CommissionVersion int64
+	Commission        money.Money
+}
+
+// RouteChange is what TripRepo.ChangeRoute applies: a new drop, unless
+// nil, and stops appended to the trip's.
+type RouteChange struct {
+	Drop  *events.LatLng
+	Stops []events.LatLng
+}
+
+// TripRepo persists trips. State transitions lock the trip for their
+// duration, are checked against the state machine and the version the
+// caller last read, and bump the version. They report ErrNotFound,
+// ErrVersionConflict, ErrStateChanged or a failed guard (e.g.
+// ErrNotAssignedDriver).
+type TripRepo interface {
+	// Create records a new trip, or reports ErrActiveTrip.
+	Create(ctx context.Context, t *Trip) error
+	GetByID(ctx context.Context, id string) (*Trip, error)
+	// Assign moves a REQUESTED or MATCHING trip to DRIVER_ASSIGNED and
+	// records a pending offer to the driver. It reports ErrDriverBusy if the
+	// driver has another DRIVER_ASSIGNED trip; one still driving a STARTED
+	// trip can be assigned the next (chained dispatch).
+	Assign(ctx context.Context, tripID, driverID string, version int) error
+	// Respond moves the assigned driver's offer on a DRIVER_ASSIGNED trip
+	// from one offer state to another. Declining or cancelling also returns
+	// the trip to REQUESTED without a driver. It reports ErrNotAssignedDriver
+	// or ErrOfferState.
+	Respond(ctx context.Context, tripID, driverID string, version int, from, to string) error
+	// Released returns the drivers who declined or cancelled tripID.
+	Released(ctx context.Context, tripID string) ([]string, error)
+	// Start moves a DRIVER_ASSIGNED trip to STARTED, accepting a pending
+	// offer. It reports ErrDriverBusy while the driver's previous trip is
+	// still STARTED.
+	Start(ctx context.Context, tripID string, at time.Time, version int) error
+	// Complete applies ev (statemachine.Complete or CompleteOffline) for
+	// actor, passes the locked trip to fn, and records the returned
+	// Completion, moving the trip to COMPLETED. fn validates and prices the
+	// trip from the locked row; its error aborts the completion. The
+	// completed trip is returned.
+	Complete(ctx context.Context, tripID string, ev statemachine.Event, actor string, version int, fn func(t *Trip) (Completion, error)) (*Trip, error)
+	// Arrive records that the assigned driver of a DRIVER_ASSIGNED trip
+	// reached the pickup, accepting a pending offer. check vets the locked
+	// trip first; its error aborts the arrival.
+	Arrive(ctx context.Context, tripID, driverID string, version int, check func(t *Trip) error) error
+	// NoShow cancels a DRIVER_ASSIGNED trip whose rider did not turn up,
+	// recording the fee fn returns for the locked trip and the version of
+	// the fare rule it comes from; its error aborts the cancellation. The
+	// cancelled trip is returned.
+	NoShow(ctx context.Context, tripID, driverID string, version int, fn func(t *Trip) (fee money.Money, pricingVersion int64, err error)) (*Trip, error)
+	// Pause marks a STARTED trip as paused from at on behalf of its rider
+	// or driver, or reports ErrPaused.
+	Pause(ctx context.Context, tripID, actor string, at time.Time, version int) error
+	// Resume ends the pause of a STARTED trip at at on behalf of its rider
+	// or driver, adding it to the trip's paused time, or reports
+	// ErrNotPaused.
+	Resume(ctx context.Context, tripID, actor string, at time.Time, version int) error
+	// Expire cancels a REQUESTED or MATCHING trip no driver was found for,
+	// returning the cancelled trip.
+	Expire(ctx context.Context, tripID string, version int) (*Trip, error)
+	// Cancel cancels riderID's trip before it starts, recording c. It
+	// reports ErrNotRider for anyone else. The cancelled trip is returned.
+	Cancel(ctx context.Context, tripID, riderID string, version int, c Cancellation) (*Trip, error)
+	// ListUnmatched returns up to limit REQUESTED and MATCHING trips created
+	// before before, oldest first.
+	ListUnmatched(ctx context.Context, before time.Time, limit int) ([]Trip, error)
+	// ListStartedBefore returns up to limit STARTED trips that started
+	// before before, oldest first.
+	ListStartedBefore(ctx context.Context, before time.Time, limit int) ([]Trip, error)
+	// ListActiveByDrivers returns DRIVER_ASSIGNED / STARTED trips of
+	// driverIDs, STARTED ones first.
+	ListActiveByDrivers(ctx context.Context, driverIDs []string) ([]Trip, error)
+	// ListActiveByRider returns riderID's trips from REQUESTED to STARTED;
+	// Create keeps that to at most one.
+	ListActiveByRider(ctx context.Context, riderID string) ([]Trip, error)
+	// OpenOffer returns the state of driverID's pending or accepted offer
+	// on tripID, or "" if they have none.
+	OpenOffer(ctx context.Context, tripID, driverID string) (string, error)
+	// ChangeRoute applies the route change fn returns for the locked trip
+	// (statemachine.Modify, by its assigned driver); its error aborts the
+	// change. A new drop counts towards DestinationChanges. The changed
+	// trip is returned.
+	ChangeRoute(ctx context.Context, tripID, driverID string, version int, fn func(t *Trip) (RouteChange, error)) (*Trip, error)
+	// AdjustFare sets the fare of a COMPLETED trip to what fn returns for
+	// the locked trip, and its commission at the rate it was priced with;
+	// fn's error aborts the adjustment. Any other status is reported as
+	// ErrStateChanged. The adjusted trip is returned.
+	AdjustFare(ctx context.Context, tripID string, version int, fn func(t *Trip) (money.Money, error)) (*Trip, error)
+	// Lock returns the trip, locked until the transaction ctx carries
+	// (db.Within) ends, so the caller's writes that depend on it cannot
+	// interleave with changes to it.
+	Lock(ctx context.Context, tripID string) (*Trip, error)
+}
+
+type pgRepo struct {
+	db    *pgxpool.Pool
+	reads *db.Router // GetByID and the ListActive reads may use a replica
+}
+
+// NewPostgresRepo returns a TripRepo backed by the trips table.
+func NewPostgresRepo(router *db.Router) TripRepo {
+	return &pgRepo{db: router.Primary(), reads: router}
+}
+
+const columns = `id,rider_id,driver_id,pickup_lat,pickup_lng,drop_lat,drop_lng,
+		        COALESCE(stops,'[]'::jsonb),COALESCE(vehicle_type,''),fare_minor,currency,status,requested_at,started_at,completed_at,
+		        created_at,version,COALESCE(seats,0),COALESCE(accessibility,'{}'),
+		        COALESCE(child_seats,0),COALESCE(luggage_litres,0),COALESCE(surcharges,'[]'::jsonb),
+		        arrived_at,cancelled_at,no_show_fee_minor,paused_at,paused_seconds,
+		        pricing_version,commission_version,commission_minor,
+		        cancelled_by,cancel_reason,COALESCE(cancel_note,''),quote_id,women_only,destination_changes`
+
+func (r *pgRepo) Create(ctx context.Context, t *Trip) error {
+	err := r.db.QueryRow(ctx,
+		`INSERT INTO trips (id,rider_id,pickup_lat,pickup_lng,drop_lat,drop_lng,vehicle_type,seats,accessibility,
+		                    child_seats,luggage_litres,status,requested_at,quote_id,women_only)
+		 VALUES ($1,$2,$3,$4,$5,$6,NULLIF($7,''),NULLIF($8,0),$9,NULLIF($10,0),NULLIF($11,0),$12,$13,$14,$15) RETURNING created_at`,
+		t.ID, t.RiderID, t.PickupLat, t.PickupLng, t.DropLat, t.DropLng, t.VehicleType, t.Seats, t.Accessibility,
+		t.ChildSeats, t.LuggageLitres, t.Status, t.RequestedAt, t.QuoteID, t.WomenOnly).
+		Scan(&t.CreatedAt)
+	if violates(err, "idx_trips_rider_active") {
+		return ErrActiveTrip
+	}
+	return err
+}
+
+// violates reports whether err is a unique violation of index.
+func violates(err error, index string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == index
+}
+
+func (r *pgRepo) GetByID(ctx context.Context, id string) (*Trip, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+	t, err := scanTrip(r.reads.Reader(ctx).QueryRow(ctx, `SELECT `+columns+` FROM trips WHERE id=$1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return t, err
+}
+
+func (r *pgRepo) Assign(ctx context.Context, tripID, driverID string, version int) error {
+	_, err := r.transition(ctx, tripID, version, statemachine.Assign, driverID, func(tx pgx.Tx, _ *Trip) error {
+		if _, err := tx.Exec(ctx, `UPDATE trips SET driver_id=$1 WHERE id=$2`, driverID, tripID); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx,
+			`INSERT INTO driver_offers (id,trip_id,driver_id,status) VALUES ($1,$2,$3,$4)`,
+			uuid.New().String(), tripID, driverID, OfferPending)
+		return err
+	})
+	if violates(err, "idx_trips_driver_assigned") {
+		return ErrDriverBusy
+	}
+	return err
+}
+
+func (r *pgRepo) Respond(ctx context.Context, tripID, driverID string, version int, from, to string) error {
+	_, err := r.transition(ctx, tripID, version, offerEvents[to], driverID, func(tx pgx.Tx, _ *Trip) error {
+		var cancelledAt *time.Time
+		if to == OfferCancelled {
+			now := time.Now()
+			cancelledAt = &now
+		}
+		tag, err := tx.Exec(ctx,
+			`UPDATE driver_offers SET status=$1, responded_at=COALESCE(responded_at,NOW()), cancelled_at=$2
+			 WHERE trip_id=$3 AND driver_id=$4 AND status=$5`,
+			to, cancelledAt, tripID, driverID, from)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrOfferState
+		}
+		return nil
+	})
+	return err
+}
+
+func (r *pgRepo) Released(ctx context.Context, tripID string) ([]string, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT DISTINCT driver_id::text FROM driver_offers WHERE trip_id=$1 AND status IN ($2,$3)`,
+		tripID, OfferDeclined, OfferCancelled)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, rows.Err()
+}
+
+func (r *pgRepo) Start(ctx context.Context, tripID string, at time.Time, version int) error {
+	_, err := r.transition(ctx, tripID, version, statemachine.Start, "", func(tx pgx.Tx, t *Trip) error {
+		t.StartedAt = &at
+		return acceptPending(ctx, tx, tripID)
+	})
+	if violates(err, "idx_trips_driver_started") {
+		return ErrDriverBusy
+	}
+	return err
+}
+
+func (r *pgRepo) Complete(ctx context.Context, tripID string, ev statemachine.Event, actor string, version int, fn func(t *Trip) (Completion, error)) (*Trip, error) {
+	return r.transition(ctx, tripID, version, ev, actor, func(tx pgx.Tx, t *Trip) error {
+		c, err := fn(t)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx,
+			`UPDATE trips SET fare=$1::numeric, fare_minor=$2, currency=$3, completion_source=$4, distance_km=$5, surcharges=$6,
+			                  paused_seconds=$7, paused_at=NULL,
+			                  pricing_version=NULLIF($8,0), commission_version=NULLIF($9,0), commission_minor=$10
+			 WHERE id=$11`,
+			c.Fare.Decimal(), c.Fare.Amount, c.Fare.Currency, c.Source, c.DistanceKm, c.Surcharges, c.PausedSeconds,
+			c.PricingVersion, c.CommissionVersion, c.Commission.Amount, tripID)
+		if err != nil {
+			return err
+		}
+		if t.StartedAt == nil {
+			t.StartedAt = c.StartedAt
+		}
+		t.CompletedAt = &c.EndedAt
+		return acceptPending(ctx, tx, tripID)
+	})
+}
+
+func (r *pgRepo) Arrive(ctx context.Context, tripID, driverID string, version int, check func(t *Trip) error) error {
+	_, err := r.transition(ctx, tripID, version, statemachine.Arrive, driverID, func(tx pgx.Tx, t *Trip) error {
+		if err := check(t); err != nil {
+			return err
+		}
+		return acceptPending(ctx, tx, tripID)
+	})
+	return err
+}
+
+func (r *pgRepo) NoShow(ctx context.Context, tripID, driverID string, version int, fn func(t *Trip) (fee money.Money, pricingVersion int64, err error)) (*Trip, error) {
+	return r.transition(ctx, tripID, version, statemachine.NoShow, driverID, func(tx pgx.Tx, t *Trip) error {
+		fee, pricingVersion, err := fn(t)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx,
+			`UPDATE trips SET no_show_fee_minor=$1, currency=$2, pricing_version=NULLIF($3,0),
+			        cancelled_by=$5, cancel_reason=$6 WHERE id=$4`,
+			fee.Amount, fee.Currency, pricingVersion, tripID, ActorDriver, ReasonRiderNoShow); err != nil {
+			return err
+		}
+		return acceptPending(ctx, tx, tripID)
+	})
+}
+
+func (r *pgRepo) Pause(ctx context.Context, tripID, actor string, at time.Time, version int) error {
+	_, err := r.transition(ctx, tripID, version, statemachine.Pause, actor, func(tx pgx.Tx, t *Trip) error {
+		if t.PausedAt != nil {
+			return ErrPaused
+		}
+		_, err := tx.Exec(ctx, `UPDATE trips SET paused_at=$1 WHERE id=$2`, at, tripID)
+		return err
+	})
+	return err
+}
+
+func (r *pgRepo) Resume(ctx context.Context, tripID, actor string, at time.Time, version int) error {
+	_, err := r.transition(ctx, tripID, version, statemachine.Resume, actor, func(tx pgx.Tx, t *Trip) error {
+		if t.PausedAt == nil {
+			return ErrNotPaused
+		}
+		_, err := tx.Exec(ctx, `UPDATE trips SET paused_at=NULL, paused_seconds=$1 WHERE id=$2`,
+			int64(t.PausedFor(at).Seconds()), tripID)
+		return err
+	})
+	return err
+}
+
+func (r *pgRepo) Expire(ctx context.Context, tripID string, version int) (*Trip, error) {
+	return r.transition(ctx, tripID, version, statemachine.Expire, "", func(tx pgx.Tx, _ *Trip) error {
+		return recordCancellation(ctx, tx, tripID, Cancellation{By: ActorSystem, Reason: ReasonNoDriver})
+	})
+}
+
+func (r *pgRepo) Cancel(ctx context.Context, tripID, riderID string, version int, c Cancellation) (*Trip, error) {
+	return r.transition(ctx, tripID, version, statemachine.Cancel, riderID, func(tx pgx.Tx, t *Trip) error {
+		if t.RiderID != riderID {
+			return ErrNotRider
+		}
+		return recordCancellation(ctx, tx, tripID, c)
+	})
+}
+
+func (r *pgRepo) ListUnmatched(ctx context.Context, before time.Time, limit int) ([]Trip, error) {
+	return r.list(ctx,
+		`SELECT `+columns+` FROM trips WHERE status IN ($1,$2) AND created_at < $3 ORDER BY created_at LIMIT $4`,
+		StatusRequested, StatusMatching, before, limit)
+}
+
+func (r *pgRepo) ListStartedBefore(ctx context.Context, before time.Time, limit int) ([]Trip, error) {
+	return r.list(ctx,
+		`SELECT `+columns+` FROM trips WHERE status=$1 AND started_at < $2 ORDER BY started_at LIMIT $3`,
+		StatusStarted, before, limit)
+}
+
+func (r *pgRepo) ListActiveByDrivers(ctx context.Context, driverIDs []string) ([]Trip, error) {
+	return r.list(ctx,
+		`SELECT `+columns+` FROM trips WHERE driver_id = ANY($1::uuid[]) AND status IN ($2,$3) ORDER BY status=$3 DESC`,
+		driverIDs, StatusDriverAssigned, StatusStarted)
+}
+
+func (r *pgRepo) ListActiveByRider(ctx context.Context, riderID string) ([]Trip, error) {
+	return r.list(ctx,
+		`SELECT `+columns+` FROM trips WHERE rider_id=$1 AND status IN ($2,$3,$4,$5) ORDER BY created_at`,
+		riderID, StatusRequested, StatusMatching, StatusDriverAssigned, StatusStarted)
+}
+
+func (r *pgRepo) OpenOffer(ctx context.Context, tripID, driverID string) (string, error) {
+	var status string
+	err := r.reads.Reader(ctx).QueryRow(ctx,
+		`SELECT status FROM driver_offers WHERE trip_id=$1 AND driver_id=$2 AND status IN ($3,$4)
+		 ORDER BY offered_at DESC LIMIT 1`,
+		tripID, driverID, OfferPending, OfferAccepted).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	return status, err
+}
+
+func (r *pgRepo) ChangeRoute(ctx context.Context, tripID, driverID string, version int, fn func(t *Trip) (RouteChange, error)) (*Trip, error) {
+	return r.transition(ctx, tripID, version, statemachine.Modify, driverID, func(tx pgx.Tx, t *Trip) error {
+		c, err := fn(t)
+		if err != nil {
+			return err
+		}
+		var dropLat, dropLng *float64
+		changes := 0
+		if c.Drop != nil {
+			dropLat, dropLng, changes = &c.Drop.Lat, &c.Drop.Lng, 1
+		}
+		stops := c.Stops
+		if stops == nil {
+			stops = []events.LatLng{}
+		}
+		_, err = tx.Exec(ctx,
+			`UPDATE trips SET drop_lat=COALESCE($1,drop_lat), drop_lng=COALESCE($2,drop_lng),
+			        stops=COALESCE(stops,'[]'::jsonb) || $3::jsonb, destination_changes=destination_changes+$4
+			 WHERE id=$5`,
+			dropLat, dropLng, stops, changes, tripID)
+		return err
+	})
+}
+
+func (r *pgRepo) AdjustFare(ctx context.Context, tripID string, version int, fn func(t *Trip) (money.Money, error)) (*Trip, error) {
+	var done *Trip
+	err := db.WithTx(ctx, r.db, func(tx pgx.Tx) error {
+		t, err := lock(ctx, tx, tripID, version)
+		if err != nil {
+			return err
+		}
+		if t.Status != StatusCompleted {
+			return fmt.Errorf("%w: cannot adjust the fare of a %s trip (needs %s)", ErrStateChanged, t.Status, StatusCompleted)
+		}
+		fare, err := fn(t)
+		if err != nil {
+			return err
+		}
+		// The commission follows the fare at the rate the trip was priced with.
+		done, err = scanTrip(tx.QueryRow(ctx,
+			`UPDATE trips SET fare=$2::numeric, fare_minor=$3, version=version+1,
+			                  commission_minor=(SELECT ROUND($3::numeric * rate_bp / 10000) FROM commission_rules
+			                                    WHERE version=trips.commission_version)
+			 WHERE id=$1 RETURNING `+columns,
+			tripID, fare.Decimal(), fare.Amount))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return done, nil
+}
+
+func (r *pgRepo) Lock(ctx context.Context, tripID string) (*Trip, error) {
+	var t *Trip
+	err := db.WithTx(ctx, r.db, func(tx pgx.Tx) error {
+		var err error
+		t, err = lock(ctx, tx, tripID, AnyVersion)
+		return err
+	})
+	return t, err
+}
+
+func (r *pgRepo) list(ctx context.Context, query string, args ...any) ([]Trip, error) {
+	rows, err := r.reads.Reader(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := []Trip{}
+	for rows.Next() {
+		t, err := scanTrip(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *t)
+	}
+	return out, rows.Err()
+}
+
+// transition locks the trip, checks its version and asks the state machine
+// whether actor may apply ev. It then runs update, which makes the event's
+// own changes and may set the times the transition stamps (now otherwise),
+// and records the new status, stamps and driver. The updated trip is
+// returned.
+func (r *pgRepo) transition(ctx context.Context, tripID string, version int, ev statemachine.Event, actor string, update func(pgx.Tx, *Trip) error) (*Trip, error) {
+	var done *Trip
+	err := db.WithTx(ctx, r.db, func(tx pgx.Tx) error {
+		t, err := lock(ctx, tx, tripID, version)
+		if err != nil {
+			return err
+		}
+		tr, err := statemachine.Check(ev, t.Status, t.parties(), actor)
+		if err != nil {
+			return err
+		}
+		if err := update(tx, t); err != nil {
+			return err
+		}
+
+		set, args := []string{"status=$2", "version=version+1"}, []any{tripID, tr.After(t.Status)}
+		now := time.Now()
+		for _, st := range tr.Stamps {
+			at := *stampField(t, st)
+			if at == nil {
+				at = &now
+			}
+			args = append(args, *at)
+			set = append(set, fmt.Sprintf("%s=COALESCE(%s,$%d)", st, st, len(args)))
+		}
+		if tr.ClearDriver {
+			set = append(set, "driver_id=NULL")
+		}
+		done, err = scanTrip(tx.QueryRow(ctx,
+			`UPDATE trips SET `+strings.Join(set, ", ")+` WHERE id=$1 RETURNING `+columns, args...))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return done, nil
+}
+
+// lock reads the trip FOR UPDATE and checks its version.
+func lock(ctx context.Context, tx pgx.Tx, tripID string, version int) (*Trip, error) {
+	if _, err := uuid.Parse(tripID); err != nil {
+		return nil, ErrNotFound
+	}
+	t, err := scanTrip(tx.QueryRow(ctx, `SELECT `+columns+` FROM trips WHERE id=$1 FOR UPDATE`, tripID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if version != AnyVersion && t.Version != version {
+		return nil, ErrVersionConflict
+	}
+	return t, nil
+}
+
+// offerEvents maps an offer response to the trip event it causes.
+var offerEvents = map[string]statemachine.Event{
+	OfferAccepted:  statemachine.Accept,
+	OfferDeclined:  statemachine.Decline,
+	OfferCancelled: statemachine.Withdraw,
+}
+
+// stampField returns the field of t that st records.
+func stampField(t *Trip, st statemachine.Stamp) **time.Time {
+	switch st {
+	case statemachine.StartedAt:
+		return &t.StartedAt
+	case statemachine.ArrivedAt:
+		return &t.ArrivedAt
+	case statemachine.CancelledAt:
+		return &t.CancelledAt
+	}
+	return &t.CompletedAt
+}
+
+// recordCancellation stores who is cancelling tripID and why.
+func recordCancellation(ctx context.Context, tx pgx.Tx, tripID string, c Cancellation) error {
+	_, err := tx.Exec(ctx,
+		`UPDATE trips SET cancelled_by=$1, cancel_reason=$2, cancel_note=NULLIF($3,'') WHERE id=$4`,
+		c.By, c.Reason, c.Note, tripID)
+	return err
+}
+
+// acceptPending counts a driver who starts or completes a trip without
+// answering its offer as having accepted it.
+func acceptPending(ctx context.Context, tx pgx.Tx, tripID string) error {
+	_, err := tx.Exec(ctx,
+		`UPDATE driver_offers SET status=$1, responded_at=NOW() WHERE trip_id=$2 AND status=$3`,
+		OfferAccepted, tripID, OfferPending)
+	return err
+}
+
+func scanTrip(row pgx.Row) (*Trip, error) {
+	var t Trip
+	var fare, noShowFee, commission *int64
+	var currency, cancelledBy, cancelReason *string
+	var cancelNote string
+	if err := row.Scan(&t.ID, &t.RiderID, &t.DriverID,
+		&t.PickupLat, &t.PickupLng, &t.DropLat, &t.DropLng,
+		&t.Stops, &t.VehicleType, &fare, &currency, &t.Status, &t.RequestedAt, &t.StartedAt, &t.CompletedAt, &t.CreatedAt, &t.Version,
+		&t.Seats, &t.Accessibility, &t.ChildSeats, &t.LuggageLitres, &t.Surcharges,
+		&t.ArrivedAt, &t.CancelledAt, &noShowFee, &t.PausedAt, &t.PausedSeconds,
+		&t.PricingVersion, &t.CommissionVersion, &commission,
+		&cancelledBy, &cancelReason, &cancelNote, &t.QuoteID, &t.WomenOnly, &t.DestinationChanges); err != nil {
+		return nil, err
+	}
+	if cancelledBy != nil && cancelReason != nil {
+		t.Cancellation = &Cancellation{By: *cancelledBy, Reason: *cancelReason, Note: cancelNote}
+	}
+	if fare != nil && currency != nil {
+		m := money.New(*fare, *currency)
+		t.Fare = &m
+	}
+	if noShowFee != nil && currency != nil {
+		m := money.New(*noShowFee, *currency)
+		t.NoShowFee = &m
+	}
+	if commission != nil && currency != nil {
+		m := money.New(*commission, *currency)
+		t.Commission = &m
+	}
+	return &t, nil
+}
@@ -0,0 +1,287 @@
+package trips
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"ride-service/internal/events"
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/db"
+	"ride-service/pkg/money"
+	"ride-service/pkg/pii"
+)
+
+// ErrBadCursor is returned for a search cursor this service did not issue.
+var ErrBadCursor = apierror.Validation("invalid cursor").WithCode("invalid_cursor")
+
+// MaxSearchKm caps the radius of a search around a point.
+const MaxSearchKm = 100
+
+// SearchParams are the filters ParseSearch reads; limit and cursor page
+// the results.
+var SearchParams = []string{"status", "from", "to", "fare_min", "fare_max", "currency", "city", "rider_email",
+	"driver_email", "q", "near", "within_km"}
+
+// SearchFilter narrows GET /admin/trips. Zero fields do not filter; Near
+// filters only with WithinKm > 0.
+type SearchFilter struct {
+	Statuses    []string
+	From, To    time.Time // created at or after From, before To
+	FareMin     *int64    // minor units
+	FareMax     *int64
+	Currency    string
+	City        string // the driver's city, case-insensitive
+	RiderEmail  string
+	DriverEmail string
+	Query       string // words in the rider's or driver's name or the cancellation note
+	Near        *events.LatLng
+	WithinKm    float64
+	Cursor      string // next_cursor of the previous page
+	Limit       int
+}
+
+// SearchResult is one trip in a search, with the names and city support
+// asks about first.
+type SearchResult struct {
+	ID          string       `json:"id"`
+	Status      string       `json:"status"`
+	RiderID     string       `json:"rider_id"`
+	RiderName   string       `json:"rider_name"`
+	DriverID    *string      `json:"driver_id,omitempty"`
+	DriverName  string       `json:"driver_name,omitempty"`
+	City        string       `json:"city,omitempty"`
+	VehicleType string       `json:"vehicle_type,omitempty"`
+	PickupLat   float64      `json:"pickup_lat"`
+	PickupLng   float64      `json:"pickup_lng"`
+	DropLat     float64      `json:"drop_lat"`
+	DropLng     float64      `json:"drop_lng"`
+	Fare        *money.Money `json:"fare,omitempty"`
+	// PickupKm is how far the pickup is from the searched point.
+	PickupKm     *float64   `json:"pickup_km,omitempty"`
+	CancelReason string     `json:"cancel_reason,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+	CancelledAt  *time.Time `json:"cancelled_at,omitempty"`
+}
+
+// SearchPage is one page of a search, newest first. NextCursor is empty
+// on the last page.
+type SearchPage struct {
+	Trips      []SearchResult `json:"trips"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// Search finds trips for the admin search. It reads from a replica when
+// one is fresh and matches emails by their blind index, as they are stored
+// encrypted.
+type Search struct {
+	reads  *db.Router
+	cipher *pii.Cipher
+}
+
+// NewSearch creates the trip search.
+func NewSearch(reads *db.Router, cipher *pii.Cipher) *Search {
+	return &Search{reads: reads, cipher: cipher}
+}
+
+// Find returns the page of trips matching f after f.Cursor, up to f.Limit.
+func (s *Search) Find(ctx context.Context, f SearchFilter) (*SearchPage, error) {
+	page := &SearchPage{Trips: []SearchResult{}}
+	var last SearchResult
+	err := s.Each(ctx, f, f.Limit+1, func(r SearchResult) error {
+		if len(page.Trips) == f.Limit {
+			page.NextCursor = encodeCursor(last)
+			return nil
+		}
+		page.Trips = append(page.Trips, r)
+		last = r
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// eachPage is how many trips Each reads per query.
+const eachPage = 1000
+
+// Each calls fn with up to limit trips matching f after f.Cursor, newest
+// first, stopping at fn's first error. The exports stream through it. It
+// reads eachPage trips per query, paging by cursor, and calls fn between
+// queries, so neither a long export nor a slow fn runs into the query
+// timeouts.
+func (s *Search) Each(ctx context.Context, f SearchFilter, limit int, fn func(SearchResult) error) error {
+	for limit > 0 {
+		page, err := s.page(ctx, f, min(limit, eachPage))
+		if err != nil {
+			return err
+		}
+		for _, r := range page {
+			if err := fn(r); err != nil {
+				return err
+			}
+		}
+		if len(page) < min(limit, eachPage) {
+			return nil
+		}
+		limit -= len(page)
+		f.Cursor = encodeCursor(page[len(page)-1])
+	}
+	return nil
+}
+
+// page returns up to limit trips matching f after f.Cursor, newest first,
+// in one query.
+func (s *Search) page(ctx context.Context, f SearchFilter, limit int) ([]SearchResult, error) {
+	where, args, err := s.where(f)
+	if err != nil {
+		return nil, err
+	}
+	distance := "NULL::float8"
+	if f.Near != nil && f.WithinKm > 0 {
+		distance = pickupKm(f.Near)
+	}
+	args = append(args, limit)
+	rows, err := s.reads.Reader(ctx).Query(ctx,
+		`SELECT t.id,t.status,t.rider_id,COALESCE(u.name,''),t.driver_id,COALESCE(d.name,''),COALESCE(d.city,''),
+		        COALESCE(t.vehicle_type,''),t.pickup_lat,t.pickup_lng,t.drop_lat,t.drop_lng,t.fare_minor,t.currency,
+		        `+distance+`,COALESCE(t.cancel_reason,''),t.created_at,t.completed_at,t.cancelled_at
+		 FROM trips t LEFT JOIN users u ON u.id=t.rider_id LEFT JOIN drivers d ON d.id=t.driver_id
+		 WHERE `+where+`
+		 ORDER BY t.created_at DESC, t.id DESC LIMIT $`+strconv.Itoa(len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := make([]SearchResult, 0, limit)
+	for rows.Next() {
+		var r SearchResult
+		var fare *int64
+		var currency *string
+		if err := rows.Scan(&r.ID, &r.Status, &r.RiderID, &r.RiderName, &r.DriverID, &r.DriverName, &r.City,
+			&r.VehicleType, &r.PickupLat, &r.PickupLng, &r.DropLat, &r.DropLng, &fare, &currency,
+			&r.PickupKm, &r.CancelReason, &r.CreatedAt, &r.CompletedAt, &r.CancelledAt); err != nil {
+			return nil, err
+		}
+		if fare != nil && currency != nil {
+			m := money.New(*fare, *currency)
+			r.Fare = &m
+		}
+		if r.PickupKm != nil {
+			km := math.Round(*r.PickupKm*1000) / 1000
+			r.PickupKm = &km
+		}
+		out = append(out, r)
+	}
+	return out, rows.Err()
+}
+
+// where builds the WHERE clause for f and its arguments.
+func (s *Search) where(f SearchFilter) (string, []any, error) {
+	conds := []string{"TRUE"}
+	var args []any
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+	if len(f.Statuses) > 0 {
+		conds = append(conds, "t.status = ANY("+arg(f.Statuses)+")")
+	}
+	if !f.From.IsZero() {
+		conds = append(conds, "t.created_at >= "+arg(f.From))
+	}
+	if !f.To.IsZero() {
+		conds = append(conds, "t.created_at < "+arg(f.To))
+	}
+	if f.FareMin != nil {
+		conds = append(conds, "t.fare_minor >= "+arg(*f.FareMin))
+	}
+	if f.FareMax != nil {
+		conds = append(conds, "t.fare_minor <= "+arg(*f.FareMax))
+	}
+	if f.Currency != "" {
+		conds = append(conds, "t.currency = "+arg(strings.ToUpper(f.Currency)))
+	}
+	if f.City != "" {
+		conds = append(conds, "lower(d.city) = "+arg(strings.ToLower(f.City)))
+	}
+	if f.RiderEmail != "" {
+		email := strings.ToLower(f.RiderEmail)
+		conds = append(conds, "(u.email_idx = "+arg(s.cipher.Index(pii.Email, email))+" OR lower(u.email) = "+arg(email)+")")
+	}
+	if f.DriverEmail != "" {
+		email := strings.ToLower(f.DriverEmail)
+		conds = append(conds, "(d.email_idx = "+arg(s.cipher.Index(pii.Email, email))+" OR lower(d.email) = "+arg(email)+")")
+	}
+	if f.Query != "" {
+		conds = append(conds, `to_tsvector('simple', concat_ws(' ', u.name, d.name, t.cancel_note))
+		                        @@ websearch_to_tsquery('simple', `+arg(f.Query)+")")
+	}
+	if p := f.Near; p != nil && f.WithinKm > 0 {
+		// The box lets the pickup index narrow the rows first.
+		dLat := f.WithinKm / 111.0
+		dLng := dLat / math.Max(math.Cos(p.Lat*math.Pi/180), 0.01)
+		conds = append(conds,
+			"t.pickup_lat BETWEEN "+arg(p.Lat-dLat)+" AND "+arg(p.Lat+dLat),
+			"t.pickup_lng BETWEEN "+arg(p.Lng-dLng)+" AND "+arg(p.Lng+dLng),
+			pickupKm(p)+" <= "+arg(f.WithinKm))
+	}
+	if f.Cursor != "" {
+		at, id, err := decodeCursor(f.Cursor)
+		if err != nil {
+			return "", nil, err
+		}
+		conds = append(conds, "(t.created_at, t.id) < ("+arg(at)+", "+arg(id)+"::uuid)")
+	}
+	return strings.Join(conds, " AND "), args, nil
+}
+
+// pickupKm is the SQL for the haversine distance from p to a trip's pickup.
+// The point is formatted in, not bound, so the select list and the filter
+// can share it.
+func pickupKm(p *events.LatLng) string {
+	return fmt.Sprintf(`(12742 * asin(sqrt(power(sin(radians(t.pickup_lat - %[1]f) / 2), 2) +
+		cos(radians(%[1]f)) * cos(radians(t.pickup_lat)) * power(sin(radians(t.pickup_lng - %[2]f) / 2), 2))))`,
+		p.Lat, p.Lng)
+}
+
+// encodeCursor returns the cursor of the page after r: its creation time
+// and id, the search's sort key.
+func encodeCursor(r SearchResult) string {
+	raw := r.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + r.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", ErrBadCursor
+	}
+	at, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return time.Time{}, "", ErrBadCursor
+	}
+	t, err := time.Parse(time.RFC3339Nano, at)
+	if err != nil {
+		return time.Time{}, "", ErrBadCursor
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return time.Time{}, "", ErrBadCursor
+	}
+	return t, id, nil
+}
+
+// ValidStatus reports whether status is a trip status.
+func ValidStatus(status string) bool {
+	return slices.Contains([]string{StatusRequested, StatusMatching, StatusDriverAssigned, StatusStarted,
+		StatusCompleted, StatusCancelled}, status)
+}
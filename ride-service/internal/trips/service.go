@@ -2,193 +2,1038 @@ package trips
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
-	"log"
+	"fmt"
 	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v5/pgxpool"
 
+	"ride-service/internal/audit"
 	"ride-service/internal/events"
-	"ride-service/pkg/kafka"
+	"ride-service/internal/pricing"
+	"ride-service/internal/trips/statemachine"
+	"ride-service/internal/users"
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/config"
+	"ride-service/pkg/eventbus"
+	"ride-service/pkg/geo"
+	"ride-service/pkg/logging"
+	"ride-service/pkg/money"
 	rredis "ride-service/pkg/redis"
+	"ride-service/pkg/validation"
+)
+
+var logger = logging.For("trips")
+
+// DriverLookup resolves driver-owned data the trip service needs: the vehicle
+// card for an assigned driver, the signing keys of their devices, whether
+// they may be assigned at all, what their trips are priced by, and their
+// gender for women-only trips.
+type DriverLookup interface {
+	VehicleCard(ctx context.Context, driverID string) (*events.VehicleCard, error)
+	DeviceKey(ctx context.Context, driverID, deviceID string) ([]byte, error)
+	CheckVerified(ctx context.Context, driverID string) error
+	City(ctx context.Context, driverID string) (string, error)
+	VehicleType(ctx context.Context, driverID string) (string, error)
+	Gender(ctx context.Context, driverID string) (string, error)
+}
+
+// AvailabilityFunc reports whether a driver nearby can take the requested
+// trip; the matcher provides it.
+type AvailabilityFunc func(ctx context.Context, ev events.RideRequestedEvent) (bool, error)
+
+// Pricer quotes the fare and commission rules in force for a trip whose
+// driver is based in city and drives vehicleType.
+type Pricer interface {
+	For(ctx context.Context, city, vehicleType string) (pricing.Quote, error)
+}
+
+// Quoter holds the fare quotes riders request trips with. Claim uses a
+// quote for t before it is created, or reports why it cannot; Release undoes
+// a claim for a trip that was not created. Rate returns the formula a
+// claimed quote locked in, the fare rule version it comes from and the city
+// it was quoted for, "" for the default rule.
+type Quoter interface {
+	Claim(ctx context.Context, quoteID string, t *Trip) error
+	Release(ctx context.Context, quoteID, tripID string)
+	Rate(ctx context.Context, quoteID, tripID string) (config.Rate, int64, string, error)
+}
+
+// RiderLookup tells whether a rider's account may request trips, and who
+// they are for their driver.
+type RiderLookup interface {
+	Active(ctx context.Context, riderID string) (bool, error)
+	GetByID(ctx context.Context, id string) (*users.User, error)
+}
+
+// Completion sources recorded in trips.completion_source.
+const (
+	CompletionOnline        = "online"
+	CompletionOfflineSigned = "offline_signed"
+)
+
+var (
+	ErrNotFound          = apierror.NotFound("trip not found")
+	ErrNotAssignedDriver = statemachine.ErrNotAssignedDriver
+	ErrInvalidSignature  = apierror.Forbidden("invalid completion signature")
+	ErrImplausible       = apierror.New(http.StatusUnprocessableEntity, apierror.CodeUnprocessable, "implausible offline completion")
+	ErrRiderInactive     = apierror.Forbidden("rider account is deactivated")
+	ErrNoCurrentTrip     = apierror.NotFound("driver has no trip in progress").WithCode("no_current_trip")
+	ErrInvalidRequest    = apierror.Validation("invalid trip request")
+	// ErrNoAccessibleVehicle is returned for a request with accessibility
+	// needs no nearby driver's vehicle meets.
+	ErrNoAccessibleVehicle = apierror.Conflict("no vehicle with the requested accessibility features is available nearby")
+	// Women-only trips: not offered at the pickup, asked for by a rider
+	// whose profile does not say female, no woman driver nearby, or a
+	// manual assignment of a driver who is not a woman.
+	ErrWomenOnlyUnavailable = apierror.Validation("women-only rides are not offered at this pickup").WithCode("women_only_unavailable")
+	ErrWomenOnlyRider       = apierror.Forbidden("women-only rides are for riders whose profile says female").WithCode("women_only_riders")
+	ErrNoWomanDriver        = apierror.Conflict("no woman driver is available nearby")
+	ErrWomenOnlyDriver      = apierror.Conflict("the trip asks for a woman driver").WithCode("women_only")
 )
 
 // Service contains trip business logic.
 type Service struct {
-	db    *pgxpool.Pool
-	kafka *kafka.Client
-	redis *rredis.Client
+	repo      TripRepo
+	bus       eventbus.Bus
+	redis     *rredis.Client
+	locations geo.Index
+	drivers   DriverLookup
+	riders    RiderLookup
+	audit     *audit.Service
+	pricing   Pricer
+	limits    config.Trips
+
+	available AvailabilityFunc // nil: requests are not checked
+	quotes    Quoter           // nil: requests with a quote are refused
 }
 
-// NewService creates a trip service.
-func NewService(db *pgxpool.Pool, k *kafka.Client, r *rredis.Client) *Service {
-	return &Service{db: db, kafka: k, redis: r}
+// NewService creates a trip service. Manual assignments go to auditLog; the
+// ops map reads driver positions from locations.
+func NewService(repo TripRepo, bus eventbus.Bus, r *rredis.Client, locations geo.Index, d DriverLookup, riders RiderLookup, auditLog *audit.Service, pricing Pricer, limits config.Trips) *Service {
+	return &Service{repo: repo, bus: bus, redis: r, locations: locations, drivers: d, riders: riders, audit: auditLog, pricing: pricing, limits: limits}
 }
 
-// Request creates a new trip and publishes ride.requested.
-func (s *Service) Request(ctx context.Context, riderID string, req TripRequest) (*Trip, error) {
-	id := uuid.New().String()
-	now := time.Now()
+// CheckAvailability sets the function that tells whether a request with
+// accessibility needs can be served. Call it before serving.
+func (s *Service) CheckAvailability(fn AvailabilityFunc) { s.available = fn }
 
-	_, err := s.db.Exec(ctx,
-		`INSERT INTO trips (id,rider_id,pickup_lat,pickup_lng,drop_lat,drop_lng,status,requested_at)
-		 VALUES ($1,$2,$3,$4,$5,$6,$7,$8)`,
-		id, riderID, req.PickupLat, req.PickupLng, req.DropLat, req.DropLng, StatusRequested, now)
-	if err != nil {
+// UseQuotes sets where the fare quotes trips are requested with are kept.
+// Call it before serving.
+func (s *Service) UseQuotes(q Quoter) { s.quotes = q }
+
+// Request creates a new trip, to be priced at the rate of req.QuoteID if
+// given, and publishes ride.requested.
+func (s *Service) Request(ctx context.Context, riderID string, req TripRequest) (*Trip, error) {
+	if ok, err := s.riders.Active(ctx, riderID); err != nil {
+		return nil, err
+	} else if !ok {
+		return nil, ErrRiderInactive
+	}
+	if err := validation.Struct(req); err != nil {
 		return nil, err
 	}
+	var features []string
+	for _, f := range req.Accessibility {
+		f = strings.ToLower(strings.TrimSpace(f))
+		if !slices.Contains(events.AccessibilityFeatures, f) {
+			return nil, fmt.Errorf("%w: unknown accessibility feature %q (use %s)", ErrInvalidRequest, f,
+				strings.Join(events.AccessibilityFeatures, ", "))
+		}
+		if !slices.Contains(features, f) {
+			features = append(features, f)
+		}
+	}
+	if req.WomenOnly {
+		if err := s.checkWomenOnly(ctx, riderID, req); err != nil {
+			return nil, err
+		}
+	}
+	// Create enforces this too; checking first keeps a rider who is already
+	// riding from being told no accessible vehicle is nearby.
+	if active, err := s.repo.ListActiveByRider(ctx, riderID); err != nil {
+		return nil, err
+	} else if len(active) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrActiveTrip, active[0].ID)
+	}
+	id := uuid.New().String()
+	now := time.Now()
 
 	trip := &Trip{
 		ID: id, RiderID: riderID,
 		PickupLat: req.PickupLat, PickupLng: req.PickupLng,
 		DropLat: req.DropLat, DropLng: req.DropLng,
-		Status: StatusRequested, RequestedAt: &now, CreatedAt: now,
+		VehicleType: strings.ToLower(strings.TrimSpace(req.VehicleType)),
+		Seats:       req.Seats, Accessibility: features,
+		ChildSeats: req.ChildSeats, LuggageLitres: req.LuggageLitres, WomenOnly: req.WomenOnly,
+		Status: StatusRequested, RequestedAt: &now, Version: 1,
+	}
+	if (len(features) > 0 || trip.WomenOnly) && s.available != nil {
+		// Tell the rider now rather than leave the trip waiting for a match
+		// that cannot come. If the check itself fails, let matching try.
+		ok, err := s.available(ctx, requestedEvent(trip, nil))
+		switch {
+		case err != nil:
+			logger.Warn("availability check failed", "rider", riderID, "err", err)
+		case !ok && trip.WomenOnly:
+			return nil, ErrNoWomanDriver
+		case !ok:
+			return nil, fmt.Errorf("%w: %s", ErrNoAccessibleVehicle, strings.Join(features, ", "))
+		}
 	}
+	if req.QuoteID != "" {
+		if s.quotes == nil {
+			return nil, fmt.Errorf("%w: fare quotes are not available", ErrInvalidRequest)
+		}
+		if err := s.quotes.Claim(ctx, req.QuoteID, trip); err != nil {
+			return nil, err
+		}
+		trip.QuoteID = &req.QuoteID
+	}
+	if err := s.repo.Create(ctx, trip); err != nil {
+		if trip.QuoteID != nil {
+			s.quotes.Release(ctx, *trip.QuoteID, trip.ID)
+		}
+		return nil, err
+	}
+
+	s.publishRequested(trip, nil)
+	return trip, nil
+}
+
+// checkWomenOnly tells whether riderID may ask for a women-only trip from
+// req's pickup: women-only cities must cover it and the rider's profile
+// must say female.
+func (s *Service) checkWomenOnly(ctx context.Context, riderID string, req TripRequest) error {
+	if !slices.ContainsFunc(s.limits.WomenOnlyCities, func(c config.WomenOnlyCity) bool {
+		return haversineKm(c.Lat, c.Lng, req.PickupLat, req.PickupLng) <= c.AreaKm
+	}) {
+		return ErrWomenOnlyUnavailable
+	}
+	rider, err := s.riders.GetByID(ctx, riderID)
+	if err != nil {
+		return err
+	}
+	if rider.Gender != events.GenderFemale {
+		return ErrWomenOnlyRider
+	}
+	return nil
+}
+
+// publishRequested asynchronously publishes ride.requested for t at its
+// current version, keeping the drivers in exclude out of the match.
+func (s *Service) publishRequested(t *Trip, exclude []string) {
+	s.publishRequestedEvent(requestedEvent(t, exclude))
+}
 
-	// Async Kafka publish
+// publishRequestedEvent asynchronously publishes ev to ride.requested.
+func (s *Service) publishRequestedEvent(ev events.RideRequestedEvent) {
 	go func() {
-		ev := events.RideRequestedEvent{
-			TripID:      id,
-			RiderID:     riderID,
-			Pickup:      events.LatLng{Lat: req.PickupLat, Lng: req.PickupLng},
-			Drop:        events.LatLng{Lat: req.DropLat, Lng: req.DropLng},
-			RequestedAt: now.Format(time.RFC3339),
-		}
-		if err := s.kafka.Publish(context.Background(), kafka.TopicRideRequested, id, ev); err != nil {
-			log.Printf("[trips] failed to publish ride.requested: %v", err)
+		env, err := events.Wrap(ev)
+		if err == nil {
+			err = s.bus.Publish(context.Background(), eventbus.TopicRideRequested, ev.TripID, env)
+		}
+		if err != nil {
+			logger.Error("publish ride.requested failed", "trip", ev.TripID, "err", err)
 		} else {
-			log.Printf("[trips] published ride.requested for trip %s", id)
+			logger.Info("published ride.requested", "trip", ev.TripID)
 		}
 	}()
+}
 
-	return trip, nil
+// requestedEvent is the ride.requested event for t.
+func requestedEvent(t *Trip, exclude []string) events.RideRequestedEvent {
+	ev := events.RideRequestedEvent{
+		TripID:         t.ID,
+		RiderID:        t.RiderID,
+		Pickup:         events.LatLng{Lat: t.PickupLat, Lng: t.PickupLng},
+		Drop:           events.LatLng{Lat: t.DropLat, Lng: t.DropLng},
+		TripVersion:    t.Version,
+		VehicleType:    t.VehicleType,
+		Seats:          t.Seats,
+		Accessibility:  t.Accessibility,
+		ChildSeats:     t.ChildSeats,
+		LuggageLitres:  t.LuggageLitres,
+		WomenOnly:      t.WomenOnly,
+		ExcludeDrivers: exclude,
+	}
+	if t.RequestedAt != nil {
+		ev.RequestedAt = t.RequestedAt.Format(time.RFC3339)
+	}
+	return ev
 }
 
-// GetByID fetches a trip by primary key.
+// GetByID fetches a trip by primary key. Only a missing trip is
+// ErrNotFound; database failures are returned as they are.
 func (s *Service) GetByID(ctx context.Context, id string) (*Trip, error) {
-	var t Trip
-	err := s.db.QueryRow(ctx,
-		`SELECT id,rider_id,driver_id,pickup_lat,pickup_lng,drop_lat,drop_lng,
-		        fare,status,requested_at,started_at,completed_at,created_at
-		 FROM trips WHERE id=$1`, id).
-		Scan(&t.ID, &t.RiderID, &t.DriverID,
-			&t.PickupLat, &t.PickupLng, &t.DropLat, &t.DropLng,
-			&t.Fare, &t.Status, &t.RequestedAt, &t.StartedAt, &t.CompletedAt, &t.CreatedAt)
+	t, err := s.repo.GetByID(ctx, id)
 	if err != nil {
-		return nil, errors.New("trip not found")
+		return nil, err
 	}
-	return &t, nil
+	s.addVehicle(ctx, t)
+	return t, nil
 }
 
-// AssignDriver sets the driver on a trip (manual / matching callback).
-func (s *Service) AssignDriver(ctx context.Context, tripID, driverID string) (*Trip, error) {
-	tag, err := s.db.Exec(ctx,
-		`UPDATE trips SET driver_id=$1, status=$2
-		 WHERE id=$3 AND status IN ($4,$5)`,
-		driverID, StatusDriverAssigned, tripID, StatusRequested, StatusMatching)
+// addVehicle fills in the card of t's driver's vehicle, if it has a driver.
+func (s *Service) addVehicle(ctx context.Context, t *Trip) {
+	if t.DriverID == nil {
+		return
+	}
+	if card, err := s.drivers.VehicleCard(ctx, *t.DriverID); err == nil {
+		t.Vehicle = card
+	} else {
+		logger.Warn("vehicle card lookup failed", "driver", *t.DriverID, "err", err)
+	}
+}
+
+// AssignDriver sets the driver on a trip (manual / matching callback) if the
+// trip is still at version.
+func (s *Service) AssignDriver(ctx context.Context, tripID, driverID string, version int) (*Trip, error) {
+	if err := s.drivers.CheckVerified(ctx, driverID); err != nil {
+		return nil, err
+	}
+	// Unlike matching, which may line up a trip after the one the driver is
+	// driving, a manual assignment needs them free.
+	if active, err := s.repo.ListActiveByDrivers(ctx, []string{driverID}); err != nil {
+		return nil, err
+	} else if len(active) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrDriverBusy, active[0].ID)
+	}
+	before, err := s.repo.GetByID(ctx, tripID)
+	if err != nil {
+		return nil, err
+	}
+	if before.WomenOnly {
+		if gender, err := s.drivers.Gender(ctx, driverID); err != nil {
+			return nil, err
+		} else if gender != events.GenderFemale {
+			return nil, ErrWomenOnlyDriver
+		}
+	}
+	if err := s.repo.Assign(ctx, tripID, driverID, version); err != nil {
+		return nil, err
+	}
+	t, err := s.GetByID(ctx, tripID)
 	if err != nil {
 		return nil, err
 	}
-	if tag.RowsAffected() == 0 {
-		return nil, errors.New("trip not found or invalid state for assignment")
+	s.audit.Record(ctx, audit.TripAssign, audit.TargetTrip, tripID, before, t)
+	return t, nil
+}
+
+// Accept records that the assigned driver takes the trip offered to them.
+func (s *Service) Accept(ctx context.Context, tripID, driverID string, version int) (*Trip, error) {
+	if err := s.repo.Respond(ctx, tripID, driverID, version, OfferPending, OfferAccepted); err != nil {
+		return nil, err
 	}
+	logger.Info("offer accepted", "trip", tripID, "driver", driverID)
 	return s.GetByID(ctx, tripID)
 }
 
-// Start transitions a trip to STARTED.
-func (s *Service) Start(ctx context.Context, tripID string) (*Trip, error) {
-	now := time.Now()
-	tag, err := s.db.Exec(ctx,
-		`UPDATE trips SET status=$1, started_at=$2
-		 WHERE id=$3 AND status=$4`,
-		StatusStarted, now, tripID, StatusDriverAssigned)
+// Decline turns down the offer. The trip goes back to matching, which will
+// not offer it to this driver again.
+func (s *Service) Decline(ctx context.Context, tripID, driverID string, version int) (*Trip, error) {
+	return s.release(ctx, tripID, driverID, version, OfferPending, OfferDeclined, nil)
+}
+
+// Cancel withdraws the driver from a trip they accepted but have not started,
+// for one of DriverReasons. Like Decline it re-matches the trip, but counts
+// towards the driver's cancellation rate instead.
+func (s *Service) Cancel(ctx context.Context, tripID, driverID string, version int, req CancelRequest) (*Trip, error) {
+	c, err := cancellation(ActorDriver, DriverReasons, req)
 	if err != nil {
 		return nil, err
 	}
-	if tag.RowsAffected() == 0 {
-		return nil, errors.New("trip not found or not in DRIVER_ASSIGNED state")
+	return s.release(ctx, tripID, driverID, version, OfferAccepted, OfferCancelled, c)
+}
+
+// RiderCancel cancels the rider's trip before it starts, for one of
+// RiderReasons. A driver already on the way is freed for other trips.
+func (s *Service) RiderCancel(ctx context.Context, tripID, riderID string, version int, req CancelRequest) (*Trip, error) {
+	c, err := cancellation(ActorRider, RiderReasons, req)
+	if err != nil {
+		return nil, err
+	}
+	trip, err := s.repo.Cancel(ctx, tripID, riderID, version, *c)
+	if err != nil {
+		return nil, err
 	}
+	logger.Info("rider cancelled trip", "trip", tripID, "reason", c.Reason)
+	ev := events.TripCancelledEvent{TripID: tripID, RiderID: riderID, Reason: events.CancelByRider}
+	if trip.DriverID != nil {
+		ev.DriverID = *trip.DriverID
+		s.unreserve(ctx, ev.DriverID, tripID)
+	}
+	s.publishCancelled(withCancellation(ev, c))
 	return s.GetByID(ctx, tripID)
 }
 
-// End completes a trip, computes fare, and publishes trip.completed.
-func (s *Service) End(ctx context.Context, tripID string, distKm *float64) (*Trip, error) {
+// cancellation checks req against the reasons actor may give.
+func cancellation(actor string, reasons []string, req CancelRequest) (*Cancellation, error) {
+	if err := validation.Struct(req); err != nil {
+		return nil, err
+	}
+	if !slices.Contains(reasons, req.Reason) {
+		return nil, fmt.Errorf("%w: reason must be one of %s", ErrInvalidRequest, strings.Join(reasons, ", "))
+	}
+	c := &Cancellation{By: actor, Reason: req.Reason, Note: strings.TrimSpace(req.Note)}
+	if c.Reason == ReasonOther && c.Note == "" {
+		return nil, fmt.Errorf("%w: a note is required with reason %q", ErrInvalidRequest, ReasonOther)
+	}
+	return c, nil
+}
+
+// withCancellation adds who cancelled and why to ev.
+func withCancellation(ev events.TripCancelledEvent, c *Cancellation) events.TripCancelledEvent {
+	if c != nil {
+		ev.Actor, ev.CancelReason, ev.CancelNote = c.By, c.Reason, c.Note
+	}
+	return ev
+}
+
+func (s *Service) release(ctx context.Context, tripID, driverID string, version int, from, to string, c *Cancellation) (*Trip, error) {
+	if err := s.repo.Respond(ctx, tripID, driverID, version, from, to); err != nil {
+		return nil, err
+	}
+	logger.Info("driver released trip", "trip", tripID, "driver", driverID, "offer", to)
+	s.unreserve(ctx, driverID, tripID)
 	trip, err := s.GetByID(ctx, tripID)
 	if err != nil {
 		return nil, err
 	}
-	if trip.Status != StatusStarted {
-		return nil, errors.New("trip not in STARTED state")
+	s.emit(ctx, offerEvents[to], trip)
+	reason := events.CancelDeclined
+	if to == OfferCancelled {
+		reason = events.CancelWithdrawn
 	}
+	s.publishCancelled(withCancellation(
+		events.TripCancelledEvent{TripID: tripID, DriverID: driverID, RiderID: trip.RiderID, Reason: reason}, c))
+	return trip, nil
+}
 
-	// Compute distance
-	km := 0.0
-	if distKm != nil && *distKm > 0 {
-		km = *distKm
-	} else {
-		km = haversineKm(trip.PickupLat, trip.PickupLng, trip.DropLat, trip.DropLng)
+// unreserve frees the driver's matching reservation for the trip. If it
+// fails, the reservation still lapses after Matching.ReservationTTL.
+func (s *Service) unreserve(ctx context.Context, driverID, tripID string) {
+	if err := s.redis.ReleaseDriver(ctx, driverID, tripID); err != nil {
+		logger.Warn("driver reservation release failed", "trip", tripID, "driver", driverID, "err", err)
 	}
+}
 
-	// Simple fare: base ₹50 + ₹12/km
-	fare := 50.0 + km*12.0
-	now := time.Now()
+// Arrive records that the assigned driver reached the pickup, which starts
+// the wait before they may report a no-show. Their last recorded location
+// must be at the pickup.
+func (s *Service) Arrive(ctx context.Context, tripID, driverID string, version int) (*Trip, error) {
+	err := s.repo.Arrive(ctx, tripID, driverID, version, func(t *Trip) error {
+		return s.atPickup(ctx, driverID, t)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetByID(ctx, tripID)
+}
 
-	_, err = s.db.Exec(ctx,
-		`UPDATE trips SET status=$1, fare=$2, completed_at=$3 WHERE id=$4`,
-		StatusCompleted, fare, now, tripID)
+// NoShow cancels a trip whose rider did not turn up, once the assigned
+// driver has waited at the pickup for limits.NoShowWait and is still there.
+// The rider is charged the no-show fee of the driver's city, the driver is
+// free for other trips, and trip.no_show is published.
+func (s *Service) NoShow(ctx context.Context, tripID, driverID string, version int) (*Trip, error) {
+	trip, err := s.repo.NoShow(ctx, tripID, driverID, version, func(t *Trip) (money.Money, int64, error) {
+		if t.ArrivedAt == nil {
+			return money.Money{}, 0, fmt.Errorf("%w: report arriving at the pickup first", ErrWaitNotOver)
+		}
+		if left := s.limits.NoShowWait - time.Since(*t.ArrivedAt); left > 0 {
+			return money.Money{}, 0, fmt.Errorf("%w: wait %s more", ErrWaitNotOver, left.Round(time.Second))
+		}
+		if err := s.atPickup(ctx, driverID, t); err != nil {
+			return money.Money{}, 0, err
+		}
+		city, err := s.drivers.City(ctx, driverID)
+		if err != nil {
+			return money.Money{}, 0, err
+		}
+		// The fee is not scaled by vehicle type.
+		q, err := s.pricing.For(ctx, city, "")
+		if err != nil {
+			return money.Money{}, 0, err
+		}
+		return q.Rate.NoShowFee, q.PricingVersion, nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	logger.Info("rider no-show", "trip", tripID, "driver", driverID, "fee", trip.NoShowFee.Decimal())
+	s.unreserve(ctx, driverID, tripID)
+	s.emit(ctx, statemachine.NoShow, trip)
+	s.publishCancelled(withCancellation(
+		events.TripCancelledEvent{TripID: tripID, DriverID: driverID, RiderID: trip.RiderID, Reason: events.CancelNoShow},
+		trip.Cancellation))
+	return s.GetByID(ctx, tripID)
+}
 
-	// Publish trip.completed
-	driverID := ""
-	if trip.DriverID != nil {
-		driverID = *trip.DriverID
+// atPickup checks that the driver's last recorded location is within
+// limits.PickupRadiusM of t's pickup.
+func (s *Service) atPickup(ctx context.Context, driverID string, t *Trip) error {
+	r := s.limits.PickupRadiusM
+	dLat := r / 111_320
+	dLng := dLat / math.Max(math.Cos(t.PickupLat*math.Pi/180), 0.01)
+	near, err := s.locations.GetDriversInBox(ctx, t.PickupLat-dLat, t.PickupLng-dLng, t.PickupLat+dLat, t.PickupLng+dLng)
+	if err != nil {
+		return err
+	}
+	for _, p := range near {
+		if p.DriverID == driverID && haversineKm(p.Lat, p.Lng, t.PickupLat, t.PickupLng)*1000 <= r {
+			return nil
+		}
+	}
+	return ErrNotAtPickup
+}
+
+// Start transitions a trip at version to STARTED.
+func (s *Service) Start(ctx context.Context, tripID string, version int) (*Trip, error) {
+	if err := s.repo.Start(ctx, tripID, time.Now(), version); err != nil {
+		return nil, err
+	}
+	return s.GetByID(ctx, tripID)
+}
+
+// Pause pauses a STARTED trip at version for its rider or driver userID,
+// e.g. while the rider runs an errand. Paused time is charged at the
+// waiting rate once the trip completes.
+func (s *Service) Pause(ctx context.Context, tripID, userID string, version int) (*Trip, error) {
+	if err := s.repo.Pause(ctx, tripID, userID, time.Now(), version); err != nil {
+		return nil, err
+	}
+	return s.GetByID(ctx, tripID)
+}
+
+// Resume ends the pause of a trip at version for its rider or driver
+// userID.
+func (s *Service) Resume(ctx context.Context, tripID, userID string, version int) (*Trip, error) {
+	if err := s.repo.Resume(ctx, tripID, userID, time.Now(), version); err != nil {
+		return nil, err
 	}
-	var durSec int64
-	if trip.StartedAt != nil {
-		durSec = int64(now.Sub(*trip.StartedAt).Seconds())
+	return s.GetByID(ctx, tripID)
+}
+
+// End completes a trip at version, computes fare, and publishes trip.completed.
+func (s *Service) End(ctx context.Context, tripID string, version int, distKm *float64) (*Trip, error) {
+	return s.complete(ctx, tripID, statemachine.Complete, "", version, func(trip *Trip) (Completion, error) {
+		// Compute distance
+		km := 0.0
+		if distKm != nil && *distKm > 0 {
+			km = *distKm
+		} else {
+			km = RouteKm(trip)
+		}
+		return Completion{DistanceKm: km, EndedAt: time.Now(), Source: CompletionOnline}, nil
+	})
+}
+
+// CompleteOffline completes a trip from a payload the driver app recorded
+// while offline. The payload must be signed with a registered, unrevoked key
+// of the submitting driver's device and pass basic plausibility checks before
+// the fare is computed from its odometer distance.
+func (s *Service) CompleteOffline(ctx context.Context, tripID, driverID string, c OfflineCompletion) (*Trip, error) {
+	key, err := s.drivers.DeviceKey(ctx, driverID, c.DeviceID)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	sig, err := hex.DecodeString(c.Signature)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(c.SigningString(tripID)))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return nil, ErrInvalidSignature
 	}
 
+	// The device signed what it saw offline and cannot know the current
+	// version; the signature and state checks stand in for it.
+	return s.complete(ctx, tripID, statemachine.CompleteOffline, driverID, AnyVersion, func(trip *Trip) (Completion, error) {
+		if err := s.checkPlausible(trip, c, time.Now()); err != nil {
+			logger.Warn("rejected offline completion", "trip", tripID, "driver", driverID, "err", err)
+			return Completion{}, err
+		}
+		started := c.StartedAt
+		return Completion{DistanceKm: c.DistanceKm, StartedAt: &started, EndedAt: c.EndedAt, Source: CompletionOfflineSigned}, nil
+	})
+}
+
+// checkPlausible rejects signed payloads that a valid key alone should not be
+// enough to get paid for: trips ending in the future or long ago, distances
+// shorter than the straight-line route through any approved stops, or impossible
+// speeds.
+func (s *Service) checkPlausible(trip *Trip, c OfflineCompletion, now time.Time) error {
+	switch {
+	case !c.EndedAt.After(c.StartedAt):
+		return fmt.Errorf("%w: ended_at must be after started_at", ErrImplausible)
+	case c.StartedAt.Before(trip.CreatedAt.Add(-s.limits.OfflineClockSkew)):
+		return fmt.Errorf("%w: started before the trip was requested", ErrImplausible)
+	case c.EndedAt.After(now.Add(s.limits.OfflineClockSkew)):
+		return fmt.Errorf("%w: ended_at is in the future", ErrImplausible)
+	case now.Sub(c.EndedAt) > s.limits.OfflineMaxDelay:
+		return fmt.Errorf("%w: submitted more than %s after the trip ended", ErrImplausible, s.limits.OfflineMaxDelay)
+	}
+	// Allow 10% slack for GPS error on the straight-line lower bound.
+	if straight := RouteKm(trip); c.DistanceKm < 0.9*straight {
+		return fmt.Errorf("%w: distance %.2fkm shorter than pickup-drop %.2fkm", ErrImplausible, c.DistanceKm, straight)
+	}
+	if kmh := c.DistanceKm / c.EndedAt.Sub(c.StartedAt).Hours(); kmh > s.limits.OfflineMaxSpeedKmh {
+		return fmt.Errorf("%w: average speed %.0fkm/h", ErrImplausible, kmh)
+	}
+	return nil
+}
+
+// complete moves a trip to COMPLETED, prices it, and publishes
+// trip.completed. check runs against the locked trip, so the state it
+// validates and the route it prices cannot change before the update.
+func (s *Service) complete(ctx context.Context, tripID string, ev statemachine.Event, actor string, version int, check func(*Trip) (Completion, error)) (*Trip, error) {
+	trip, err := s.repo.Complete(ctx, tripID, ev, actor, version, func(t *Trip) (Completion, error) {
+		c, err := check(t)
+		if err != nil {
+			return c, err
+		}
+		// Simple fare: base + per-km rate, plus surcharges for the extras
+		// the rider asked for and the time spent paused. The platform keeps
+		// the commission in force for the city.
+		q, err := s.rules(ctx, t)
+		if err != nil {
+			return c, err
+		}
+		paused := t.PausedFor(c.EndedAt)
+		c.PausedSeconds = int64(paused.Seconds())
+		c.Fare = q.Rate.Fare(c.DistanceKm)
+		c.Surcharges = surcharges(q.Rate, t, paused)
+		for _, l := range c.Surcharges {
+			c.Fare.Amount += l.Amount.Amount
+		}
+		c.PricingVersion, c.CommissionVersion = q.PricingVersion, q.CommissionVersion
+		c.Commission = q.Commission(c.Fare)
+		return c, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.emit(ctx, ev, trip)
+	return s.GetByID(ctx, trip.ID)
+}
+
+// rules returns the fare and commission rules t is priced with: those in
+// force for its driver's city, scaled for the type of vehicle they drive. A
+// trip requested with a fare quote keeps the quoted formula, even if the
+// rules changed since; the commission is still today's. The city comes from
+// the rider's estimate, so a quote for another city than the driver's, or
+// in another currency, is not honored: the trip is priced at the rules in
+// force.
+func (s *Service) rules(ctx context.Context, t *Trip) (pricing.Quote, error) {
+	city, vehicleType := "", ""
+	if t.DriverID != nil {
+		var err error
+		if city, err = s.drivers.City(ctx, *t.DriverID); err != nil {
+			return pricing.Quote{}, err
+		}
+		if vehicleType, err = s.drivers.VehicleType(ctx, *t.DriverID); err != nil {
+			return pricing.Quote{}, err
+		}
+	}
+	q, err := s.pricing.For(ctx, city, vehicleType)
+	if err != nil {
+		return q, err
+	}
+	if t.QuoteID != nil && s.quotes != nil {
+		rate, version, quoted, err := s.quotes.Rate(ctx, *t.QuoteID, t.ID)
+		if err != nil {
+			return q, err
+		}
+		switch {
+		case !strings.EqualFold(strings.TrimSpace(quoted), strings.TrimSpace(city)):
+			logger.Warn("fare quote is for another city", "trip", t.ID, "quote", *t.QuoteID, "quoted", quoted, "city", city)
+		case rate.Base.Currency != q.Rate.Base.Currency:
+			logger.Warn("fare quote is in another currency", "trip", t.ID, "quote", *t.QuoteID,
+				"quoted", rate.Base.Currency, "currency", q.Rate.Base.Currency)
+		default:
+			q.Rate, q.PricingVersion = rate, version
+		}
+	}
+	return q, nil
+}
+
+// EstimateFare re-estimates the fare of trip tripID for a route change: the
+// straight-line fare of its route as it is, and with the drop moved to drop
+// (if not nil) and stops appended. Both include the surcharges for extras
+// but not waiting, which is only known at the end.
+func (s *Service) EstimateFare(ctx context.Context, tripID string, drop *events.LatLng, stops []events.LatLng) (before, after money.Money, err error) {
+	t, err := s.repo.GetByID(ctx, tripID)
+	if err != nil {
+		return before, after, err
+	}
+	q, err := s.rules(ctx, t)
+	if err != nil {
+		return before, after, err
+	}
+	changed := *t
+	if drop != nil {
+		changed.DropLat, changed.DropLng = drop.Lat, drop.Lng
+	}
+	changed.Stops = append(slices.Clip(t.Stops), stops...)
+	return estimate(q.Rate, t), estimate(q.Rate, &changed), nil
+}
+
+// estimate is the fare of t's straight-line route at rate, with its extras.
+func estimate(rate config.Rate, t *Trip) money.Money {
+	fare := rate.Fare(RouteKm(t))
+	for _, l := range surcharges(rate, t, 0) {
+		fare.Amount += l.Amount.Amount
+	}
+	return fare
+}
+
+// surcharges prices the extras t asked for, and the time it was paused, at
+// rate. Free extras get no line.
+func surcharges(rate config.Rate, t *Trip, paused time.Duration) []events.Surcharge {
+	var out []events.Surcharge
+	if t.ChildSeats > 0 && rate.ChildSeat.Amount > 0 {
+		out = append(out, events.Surcharge{Name: events.SurchargeChildSeat, Units: t.ChildSeats,
+			Amount: money.New(rate.ChildSeat.Amount*int64(t.ChildSeats), rate.ChildSeat.Currency)})
+	}
+	// Luggage is charged per started 100 litres.
+	if units := (t.LuggageLitres + 99) / 100; units > 0 && rate.Luggage.Amount > 0 {
+		out = append(out, events.Surcharge{Name: events.SurchargeLuggage, Units: units,
+			Amount: money.New(rate.Luggage.Amount*int64(units), rate.Luggage.Currency)})
+	}
+	// Waiting is charged per started minute paused.
+	if mins := int((paused + time.Minute - 1) / time.Minute); mins > 0 && rate.Waiting.Amount > 0 {
+		out = append(out, events.Surcharge{Name: events.SurchargeWaiting, Units: mins,
+			Amount: money.New(rate.Waiting.Amount*int64(mins), rate.Waiting.Currency)})
+	}
+	return out
+}
+
+// emit publishes the event the state machine declares for ev, if any, for
+// the trip as it is after the transition.
+func (s *Service) emit(ctx context.Context, ev statemachine.Event, t *Trip) {
+	tr, _ := statemachine.Lookup(ev)
+	switch tr.Emit {
+	case eventbus.TopicRideRequested:
+		excluded, err := s.repo.Released(ctx, t.ID)
+		if err != nil {
+			// Still re-match; at worst the trip is offered to a driver who passed on it.
+			logger.Warn("released drivers lookup failed", "trip", t.ID, "err", err)
+		}
+		s.publishRequested(t, excluded)
+	case eventbus.TopicTripCompleted:
+		s.publishCompleted(t)
+	case eventbus.TopicTripNoShow:
+		s.publishNoShow(t)
+	case eventbus.TopicTripCancelled: // only Expire, so no driver was found
+		s.publishCancelled(withCancellation(
+			events.TripCancelledEvent{TripID: t.ID, RiderID: t.RiderID, Reason: events.CancelNoDriver}, t.Cancellation))
+	}
+}
+
+// publishNoShow asynchronously publishes trip.no_show for t.
+func (s *Service) publishNoShow(t *Trip) {
+	ev := events.TripNoShowEvent{TripID: t.ID, RiderID: t.RiderID, NoShowAt: t.CancelledAt.Format(time.RFC3339)}
+	if t.DriverID != nil {
+		ev.DriverID = *t.DriverID
+	}
+	if t.ArrivedAt != nil {
+		ev.ArrivedAt = t.ArrivedAt.Format(time.RFC3339)
+	}
+	if t.NoShowFee != nil {
+		ev.FeeMinor, ev.Currency = t.NoShowFee.Amount, t.NoShowFee.Currency
+	}
 	go func() {
-		ev := events.TripCompletedEvent{
-			TripID:          tripID,
-			DriverID:        driverID,
-			RiderID:         trip.RiderID,
-			Fare:            fare,
-			CompletedAt:     now.Format(time.RFC3339),
-			DurationSeconds: durSec,
+		env, err := events.Wrap(ev)
+		if err == nil {
+			err = s.bus.Publish(context.Background(), eventbus.TopicTripNoShow, ev.TripID, env)
 		}
-		if err := s.kafka.Publish(context.Background(), kafka.TopicTripCompleted, tripID, ev); err != nil {
-			log.Printf("[trips] failed to publish trip.completed: %v", err)
+		if err != nil {
+			logger.Error("publish trip.no_show failed", "trip", ev.TripID, "err", err)
 		}
 	}()
+}
 
-	return s.GetByID(ctx, tripID)
+// publishCancelled asynchronously publishes ev to trip.cancelled, stamped
+// now.
+func (s *Service) publishCancelled(ev events.TripCancelledEvent) {
+	ev.CancelledAt = time.Now().UTC().Format(time.RFC3339)
+	go func() {
+		env, err := events.Wrap(ev)
+		if err == nil {
+			err = s.bus.Publish(context.Background(), eventbus.TopicTripCancelled, ev.TripID, env)
+		}
+		if err != nil {
+			logger.Error("publish trip.cancelled failed", "trip", ev.TripID, "err", err)
+		}
+	}()
+}
+
+// publishCompleted asynchronously publishes trip.completed for t.
+func (s *Service) publishCompleted(t *Trip) {
+	ev := events.TripCompletedEvent{
+		TripID:             t.ID,
+		RiderID:            t.RiderID,
+		Fare:               t.Fare.Major(),
+		FareMinor:          t.Fare.Amount,
+		Currency:           t.Fare.Currency,
+		CompletedAt:        t.CompletedAt.Format(time.RFC3339),
+		Surcharges:         t.Surcharges,
+		DestinationChanges: t.DestinationChanges,
+	}
+	if t.DriverID != nil {
+		ev.DriverID = *t.DriverID
+	}
+	if t.StartedAt != nil {
+		ev.DurationSeconds = int64(t.CompletedAt.Sub(*t.StartedAt).Seconds())
+	}
+	go func() {
+		env, err := events.Wrap(ev)
+		if err == nil {
+			err = s.bus.Publish(context.Background(), eventbus.TopicTripCompleted, ev.TripID, env)
+		}
+		if err != nil {
+			logger.Error("publish trip.completed failed", "trip", ev.TripID, "err", err)
+		}
+	}()
+}
+
+// ListActive returns the caller's trips in progress, so apps can pick them
+// up again after a restart: a rider's trip from REQUESTED to STARTED, or a
+// driver's DRIVER_ASSIGNED and STARTED trips.
+func (s *Service) ListActive(ctx context.Context, userID string, driver bool) ([]Trip, error) {
+	var trips []Trip
+	var err error
+	if driver {
+		trips, err = s.repo.ListActiveByDrivers(ctx, []string{userID})
+	} else {
+		trips, err = s.repo.ListActiveByRider(ctx, userID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i := range trips {
+		s.addVehicle(ctx, &trips[i])
+	}
+	return trips, nil
+}
+
+// CurrentTrip returns the driver's DRIVER_ASSIGNED or STARTED trip with
+// their offer, the rider's name and what to do next, or ErrNoCurrentTrip.
+func (s *Service) CurrentTrip(ctx context.Context, driverID string) (*CurrentTrip, error) {
+	trips, err := s.repo.ListActiveByDrivers(ctx, []string{driverID})
+	if err != nil {
+		return nil, err
+	}
+	if len(trips) == 0 {
+		return nil, ErrNoCurrentTrip
+	}
+	// Assign keeps it to one trip, or a STARTED one (listed first) and the
+	// next.
+	c := &CurrentTrip{Trip: trips[0]}
+	s.addVehicle(ctx, &c.Trip)
+	if c.Offer, err = s.repo.OpenOffer(ctx, c.ID, driverID); err != nil {
+		return nil, err
+	}
+	if len(trips) > 1 {
+		c.Queued = &QueuedTrip{Trip: trips[1]}
+		if c.Queued.Offer, err = s.repo.OpenOffer(ctx, c.Queued.ID, driverID); err != nil {
+			return nil, err
+		}
+	}
+	if rider, err := s.riders.GetByID(ctx, c.RiderID); err == nil {
+		c.RiderName = rider.Name
+	} else {
+		logger.Warn("rider lookup failed", "trip", c.ID, "rider", c.RiderID, "err", err)
+	}
+
+	pickup := events.LatLng{Lat: c.PickupLat, Lng: c.PickupLng}
+	switch {
+	case c.Status == StatusStarted && c.PausedAt != nil:
+		c.Next = NextResume
+		c.Navigation = navigation(events.LatLng{Lat: c.DropLat, Lng: c.DropLng}, c.Stops)
+	case c.Status == StatusStarted:
+		c.Next = NextDriveToDrop
+		c.Navigation = navigation(events.LatLng{Lat: c.DropLat, Lng: c.DropLng}, c.Stops)
+	case c.Offer == OfferPending:
+		c.Next = NextRespond
+		c.Navigation = navigation(pickup, nil)
+	case c.ArrivedAt != nil:
+		c.Next = NextWaitForRider
+		at := c.ArrivedAt.Add(s.limits.NoShowWait)
+		c.NoShowAt = &at
+		c.Navigation = navigation(pickup, nil)
+	default:
+		c.Next = NextDriveToPickup
+		c.Navigation = navigation(pickup, nil)
+	}
+	return c, nil
+}
+
+// navigation builds directions to dest through waypoints.
+func navigation(dest events.LatLng, waypoints []events.LatLng) Navigation {
+	q := url.Values{"api": {"1"}, "travelmode": {"driving"}, "destination": {latLng(dest)}}
+	if len(waypoints) > 0 {
+		stops := make([]string, len(waypoints))
+		for i, w := range waypoints {
+			stops[i] = latLng(w)
+		}
+		q.Set("waypoints", strings.Join(stops, "|"))
+	}
+	return Navigation{Destination: dest, Waypoints: waypoints, MapsURL: "https://www.google.com/maps/dir/?" + q.Encode()}
+}
+
+func latLng(p events.LatLng) string { return fmt.Sprintf("%.6f,%.6f", p.Lat, p.Lng) }
+
+// OnTrip reports whether the driver has a DRIVER_ASSIGNED or STARTED trip.
+func (s *Service) OnTrip(ctx context.Context, driverID string) (bool, error) {
+	trips, err := s.repo.ListActiveByDrivers(ctx, []string{driverID})
+	return len(trips) > 0, err
+}
+
+// Finishing returns the drivers who could take a trip from pickup next:
+// their STARTED trip, not paused, drops within dropKm of it, their last
+// position is within reachKm of that drop, and no next trip is assigned to
+// them yet. Distances are straight lines; stops still ahead are ignored.
+func (s *Service) Finishing(ctx context.Context, pickup events.LatLng, dropKm, reachKm float64) ([]events.FinishingDriver, error) {
+	// Such a driver is within dropKm + reachKm of the pickup.
+	dLat := (dropKm + reachKm) / 111.0
+	dLng := dLat / math.Max(math.Cos(pickup.Lat*math.Pi/180), 0.01)
+	positions, err := s.locations.GetDriversInBox(ctx, pickup.Lat-dLat, pickup.Lng-dLng, pickup.Lat+dLat, pickup.Lng+dLng)
+	if err != nil || len(positions) == 0 {
+		return nil, err
+	}
+	driverIDs := make([]string, len(positions))
+	byDriver := make(map[string]geo.Position, len(positions))
+	for i, p := range positions {
+		driverIDs[i] = p.DriverID
+		byDriver[p.DriverID] = p
+	}
+	trips, err := s.repo.ListActiveByDrivers(ctx, driverIDs)
+	if err != nil {
+		return nil, err
+	}
+	assigned := map[string]bool{}
+	for _, t := range trips {
+		if t.Status == StatusDriverAssigned {
+			assigned[*t.DriverID] = true
+		}
+	}
+	var out []events.FinishingDriver
+	for _, t := range trips {
+		if t.Status != StatusStarted || t.PausedAt != nil || assigned[*t.DriverID] {
+			continue
+		}
+		p := byDriver[*t.DriverID]
+		f := events.FinishingDriver{DriverID: *t.DriverID, TripID: t.ID,
+			RemainingKm: haversineKm(p.Lat, p.Lng, t.DropLat, t.DropLng),
+			ToPickupKm:  haversineKm(t.DropLat, t.DropLng, pickup.Lat, pickup.Lng)}
+		if f.ToPickupKm <= dropKm && f.RemainingKm <= reachKm {
+			out = append(out, f)
+		}
+	}
+	return out, nil
+}
+
+// ListActiveInBox returns DRIVER_ASSIGNED / STARTED trips whose driver's last
+// known position lies inside box. Positions come from Redis in one pipeline of
+// GEOSEARCHes, one per geo shard the box overlaps, trip state from a single
+// indexed query, so it is cheap enough for the ops map to poll every few seconds.
+func (s *Service) ListActiveInBox(ctx context.Context, box BoundingBox) ([]ActiveTrip, error) {
+	positions, err := s.locations.GetDriversInBox(ctx, box.MinLat, box.MinLng, box.MaxLat, box.MaxLng)
+	if err != nil {
+		return nil, err
+	}
+	if len(positions) == 0 {
+		return []ActiveTrip{}, nil
+	}
+
+	driverIDs := make([]string, len(positions))
+	byDriver := make(map[string]geo.Position, len(positions))
+	for i, p := range positions {
+		driverIDs[i] = p.DriverID
+		byDriver[p.DriverID] = p
+	}
+
+	trips, err := s.repo.ListActiveByDrivers(ctx, driverIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]ActiveTrip, 0, len(trips))
+	for _, t := range trips {
+		p := byDriver[*t.DriverID]
+		out = append(out, ActiveTrip{Trip: t, DriverLat: p.Lat, DriverLng: p.Lng})
+	}
+	return out, nil
 }
 
 // StartDriverAssignedConsumer listens for driver.assigned events from the matching service.
 func (s *Service) StartDriverAssignedConsumer(ctx context.Context) {
-	s.kafka.Subscribe(ctx, kafka.TopicDriverAssigned, "trip-driver-assigned", func(data []byte) error {
+	s.bus.Subscribe(ctx, eventbus.TopicDriverAssigned, "trip-driver-assigned", func(ctx context.Context, data []byte) error {
 		var ev events.DriverAssignedEvent
-		if err := json.Unmarshal(data, &ev); err != nil {
+		if env, err := events.Unwrap(data, &ev); errors.Is(err, events.ErrUnsupportedVersion) {
+			logger.Warn("skipping event", "event_id", env.EventID, "err", err)
+			return nil
+		} else if err != nil {
 			return err
 		}
-		log.Printf("[trips] received driver.assigned: trip=%s driver=%s", ev.TripID, ev.DriverID)
+		logger.Info("driver.assigned received", "trip", ev.TripID, "driver", ev.DriverID)
 
-		_, err := s.db.Exec(ctx,
-			`UPDATE trips SET driver_id=$1, status=$2
-			 WHERE id=$3 AND status IN ($4,$5)`,
-			ev.DriverID, StatusDriverAssigned, ev.TripID, StatusRequested, StatusMatching)
+		// The match was made against the version in ride.requested. If the
+		// trip changed since (e.g. an admin assigned it manually), the match
+		// is stale and dropped rather than overwriting that change.
+		err := s.repo.Assign(ctx, ev.TripID, ev.DriverID, ev.TripVersion)
+		if errors.Is(err, ErrNotFound) || errors.Is(err, ErrVersionConflict) || errors.Is(err, ErrStateChanged) {
+			if t, err := s.repo.GetByID(ctx, ev.TripID); err == nil && t.DriverID != nil && *t.DriverID == ev.DriverID {
+				return nil // redelivered: the assignment is already recorded
+			}
+			logger.Warn("dropping stale driver assignment", "trip", ev.TripID, "driver", ev.DriverID, "err", err)
+			s.unreserve(ctx, ev.DriverID, ev.TripID)
+			s.publishCancelled(events.TripCancelledEvent{TripID: ev.TripID, DriverID: ev.DriverID, Reason: events.CancelSuperseded})
+			return nil
+		}
+		if errors.Is(err, ErrDriverBusy) {
+			// The driver took another trip since being matched: match again
+			// without them.
+			logger.Warn("matched driver is busy, re-matching", "trip", ev.TripID, "driver", ev.DriverID)
+			s.unreserve(ctx, ev.DriverID, ev.TripID)
+			t, err := s.repo.GetByID(ctx, ev.TripID)
+			if err != nil {
+				return err
+			}
+			excluded, err := s.repo.Released(ctx, t.ID)
+			if err != nil {
+				logger.Warn("released drivers lookup failed", "trip", t.ID, "err", err)
+			}
+			s.publishRequested(t, append(excluded, ev.DriverID))
+			return nil
+		}
 		return err
 	})
 }
 
 // ---- helpers ----
 
+// RouteKm is the straight-line length of pickup → approved stops → drop.
+func RouteKm(t *Trip) float64 {
+	km, lat, lng := 0.0, t.PickupLat, t.PickupLng
+	for _, p := range t.Stops {
+		km += haversineKm(lat, lng, p.Lat, p.Lng)
+		lat, lng = p.Lat, p.Lng
+	}
+	return km + haversineKm(lat, lng, t.DropLat, t.DropLng)
+}
+
 func haversineKm(lat1, lng1, lat2, lng2 float64) float64 {
 	const R = 6371.0
 	dLat := (lat2 - lat1) * math.Pi / 180
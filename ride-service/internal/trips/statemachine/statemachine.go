@@ -0,0 +1,181 @@
+// Package statemachine declares the trip lifecycle: which events may move a
+// trip from which status to which, the guards they must pass, and the side
+// effects (timestamps, published events) that come with them. Every write
+// that changes a trip's status checks it here instead of carrying its own
+// list of allowed statuses.
+package statemachine
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/eventbus"
+)
+
+// Trip statuses.
+const (
+	Requested      = "REQUESTED"
+	Matching       = "MATCHING"
+	DriverAssigned = "DRIVER_ASSIGNED"
+	Started        = "STARTED"
+	Completed      = "COMPLETED"
+	Cancelled      = "CANCELLED"
+)
+
+// Event is something that happens to a trip.
+type Event string
+
+const (
+	Assign          Event = "assign"           // a driver is matched or assigned manually
+	Accept          Event = "accept"           // the assigned driver accepts the offer
+	Decline         Event = "decline"          // the assigned driver declines the offer
+	Withdraw        Event = "withdraw"         // the driver cancels an accepted, unstarted trip
+	Cancel          Event = "cancel"           // the rider calls off a trip that has not started
+	Start           Event = "start"            // the ride begins
+	Complete        Event = "complete"         // the ride ends online
+	CompleteOffline Event = "complete_offline" // a signed offline completion arrives
+	Modify          Event = "modify"           // the assigned driver approves a route change
+	Arrive          Event = "arrive"           // the assigned driver reaches the pickup point
+	NoShow          Event = "no_show"          // the driver gives up waiting for the rider
+	Pause           Event = "pause"            // the ride stops while the rider runs an errand
+	Resume          Event = "resume"           // the ride goes on after a pause
+	Expire          Event = "expire"           // no driver was found in time
+)
+
+// Stamp is a trip timestamp column a transition records.
+type Stamp string
+
+const (
+	StartedAt   Stamp = "started_at"
+	CompletedAt Stamp = "completed_at"
+	ArrivedAt   Stamp = "arrived_at"
+	CancelledAt Stamp = "cancelled_at"
+)
+
+// Parties are the people on a trip, for guards to vet the actor against.
+type Parties struct {
+	RiderID  string
+	DriverID *string // nil until a driver is assigned
+}
+
+// Guard vets the actor of a transition against the trip's parties.
+type Guard func(p Parties, actor string) error
+
+var (
+	// ErrInvalidTransition is wrapped by the errors Check returns when the
+	// trip's status does not allow the event.
+	ErrInvalidTransition = apierror.Validation("transition not allowed").WithCode("invalid_transition")
+	ErrNotAssignedDriver = apierror.Forbidden("not the assigned driver for this trip")
+	ErrNotParticipant    = apierror.Forbidden("not the rider or driver of this trip")
+)
+
+// AssignedDriver lets only the trip's assigned driver through.
+func AssignedDriver(p Parties, actor string) error {
+	if p.DriverID == nil || *p.DriverID != actor {
+		return ErrNotAssignedDriver
+	}
+	return nil
+}
+
+// Participant lets the trip's rider and its assigned driver through.
+func Participant(p Parties, actor string) error {
+	if actor == "" || (actor != p.RiderID && AssignedDriver(p, actor) != nil) {
+		return ErrNotParticipant
+	}
+	return nil
+}
+
+// Transition is one row of the lifecycle table.
+type Transition struct {
+	Event Event
+	From  []string
+	// To is the status afterwards; empty leaves the status as it is.
+	To     string
+	Guards []Guard
+	// Stamps are set when the transition happens, unless already set.
+	Stamps []Stamp
+	// ClearDriver unassigns the driver.
+	ClearDriver bool
+	// Emit is the Kafka topic announcing the change, if any.
+	Emit string
+}
+
+var table = []Transition{
+	{Event: Assign, From: []string{Requested, Matching}, To: DriverAssigned},
+	{Event: Accept, From: []string{DriverAssigned}, Guards: []Guard{AssignedDriver}},
+	{Event: Decline, From: []string{DriverAssigned}, To: Requested, Guards: []Guard{AssignedDriver},
+		ClearDriver: true, Emit: eventbus.TopicRideRequested},
+	{Event: Withdraw, From: []string{DriverAssigned}, To: Requested, Guards: []Guard{AssignedDriver},
+		ClearDriver: true, Emit: eventbus.TopicRideRequested},
+	{Event: Cancel, From: []string{Requested, Matching, DriverAssigned}, To: Cancelled, Stamps: []Stamp{CancelledAt}},
+	{Event: Start, From: []string{DriverAssigned}, To: Started, Stamps: []Stamp{StartedAt}},
+	{Event: Complete, From: []string{Started}, To: Completed,
+		Stamps: []Stamp{StartedAt, CompletedAt}, Emit: eventbus.TopicTripCompleted},
+	{Event: CompleteOffline, From: []string{DriverAssigned, Started}, To: Completed, Guards: []Guard{AssignedDriver},
+		Stamps: []Stamp{StartedAt, CompletedAt}, Emit: eventbus.TopicTripCompleted},
+	{Event: Modify, From: []string{DriverAssigned, Started}, Guards: []Guard{AssignedDriver}},
+	{Event: Arrive, From: []string{DriverAssigned}, Guards: []Guard{AssignedDriver}, Stamps: []Stamp{ArrivedAt}},
+	{Event: NoShow, From: []string{DriverAssigned}, To: Cancelled, Guards: []Guard{AssignedDriver},
+		Stamps: []Stamp{CancelledAt}, Emit: eventbus.TopicTripNoShow},
+	{Event: Pause, From: []string{Started}, Guards: []Guard{Participant}},
+	{Event: Resume, From: []string{Started}, Guards: []Guard{Participant}},
+	{Event: Expire, From: []string{Requested, Matching}, To: Cancelled,
+		Stamps: []Stamp{CancelledAt}, Emit: eventbus.TopicTripCancelled},
+}
+
+// Lookup returns the transition for ev.
+func Lookup(ev Event) (Transition, bool) {
+	for _, t := range table {
+		if t.Event == ev {
+			return t, true
+		}
+	}
+	return Transition{}, false
+}
+
+// Check returns the transition ev makes from status, after running its
+// guards for actor against the trip's parties. A status the event cannot
+// leave from is reported as ErrInvalidTransition; guard failures are
+// returned as is.
+func Check(ev Event, status string, p Parties, actor string) (Transition, error) {
+	t, ok := Lookup(ev)
+	if !ok {
+		return Transition{}, fmt.Errorf("%w: unknown event %q", ErrInvalidTransition, ev)
+	}
+	if !slices.Contains(t.From, status) {
+		return Transition{}, fmt.Errorf("%w: cannot %s a %s trip (needs %s)",
+			ErrInvalidTransition, ev, status, strings.Join(t.From, " or "))
+	}
+	for _, g := range t.Guards {
+		if err := g(p, actor); err != nil {
+			return Transition{}, err
+		}
+	}
+	return t, nil
+}
+
+// Allows reports whether ev may happen to a trip in status, ignoring guards.
+func Allows(ev Event, status string) bool {
+	t, ok := Lookup(ev)
+	return ok && slices.Contains(t.From, status)
+}
+
+// Terminal reports whether no event can move a trip out of status.
+func Terminal(status string) bool {
+	for _, t := range table {
+		if slices.Contains(t.From, status) {
+			return false
+		}
+	}
+	return true
+}
+
+// After returns the status a trip in status has after t.
+func (t Transition) After(status string) string {
+	if t.To == "" {
+		return status
+	}
+	return t.To
+}
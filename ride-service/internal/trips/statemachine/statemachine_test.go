@@ -0,0 +1,141 @@
+package statemachine
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+var statuses = []string{Requested, Matching, DriverAssigned, Started, Completed, Cancelled}
+
+func TestCheckFrom(t *testing.T) {
+	// Every event against every status: only these pairs are allowed, with
+	// the status they lead to.
+	allowed := map[Event]map[string]string{
+		Assign:          {Requested: DriverAssigned, Matching: DriverAssigned},
+		Accept:          {DriverAssigned: DriverAssigned},
+		Decline:         {DriverAssigned: Requested},
+		Withdraw:        {DriverAssigned: Requested},
+		Cancel:          {Requested: Cancelled, Matching: Cancelled, DriverAssigned: Cancelled},
+		Start:           {DriverAssigned: Started},
+		Complete:        {Started: Completed},
+		CompleteOffline: {DriverAssigned: Completed, Started: Completed},
+		Modify:          {DriverAssigned: DriverAssigned, Started: Started},
+		Arrive:          {DriverAssigned: DriverAssigned},
+		NoShow:          {DriverAssigned: Cancelled},
+		Pause:           {Started: Started},
+		Resume:          {Started: Started},
+		Expire:          {Requested: Cancelled, Matching: Cancelled},
+	}
+	driver := "driver-1"
+	p := Parties{RiderID: "rider-1", DriverID: &driver}
+
+	for ev, from := range allowed {
+		for _, status := range statuses {
+			tr, err := Check(ev, status, p, driver)
+			want, ok := from[status]
+			switch {
+			case ok && err != nil:
+				t.Errorf("%s from %s: %v", ev, status, err)
+			case ok && tr.After(status) != want:
+				t.Errorf("%s from %s leads to %s, want %s", ev, status, tr.After(status), want)
+			case !ok && !errors.Is(err, ErrInvalidTransition):
+				t.Errorf("%s from %s: err = %v, want ErrInvalidTransition", ev, status, err)
+			}
+			if Allows(ev, status) != ok {
+				t.Errorf("Allows(%s, %s) = %v, want %v", ev, status, !ok, ok)
+			}
+		}
+	}
+	for _, tr := range table {
+		if _, ok := allowed[tr.Event]; !ok {
+			t.Errorf("event %s is not covered", tr.Event)
+		}
+	}
+
+	if _, err := Check("teleport", Started, p, driver); !errors.Is(err, ErrInvalidTransition) {
+		t.Errorf("unknown event: err = %v, want ErrInvalidTransition", err)
+	}
+}
+
+func TestGuards(t *testing.T) {
+	driver := "driver-1"
+	assigned := Parties{RiderID: "rider-1", DriverID: &driver}
+	unassigned := Parties{RiderID: "rider-1"}
+
+	tests := []struct {
+		name  string
+		ev    Event
+		p     Parties
+		actor string
+		want  error
+	}{
+		{"driver accepts", Accept, assigned, "driver-1", nil},
+		{"other driver accepts", Accept, assigned, "driver-2", ErrNotAssignedDriver},
+		{"rider accepts", Accept, assigned, "rider-1", ErrNotAssignedDriver},
+		{"no driver to accept", Accept, unassigned, "driver-1", ErrNotAssignedDriver},
+		{"anonymous accepts", Accept, assigned, "", ErrNotAssignedDriver},
+		{"driver modifies", Modify, assigned, "driver-1", nil},
+		{"other driver modifies", Modify, assigned, "driver-2", ErrNotAssignedDriver},
+		{"driver reports no-show", NoShow, assigned, "driver-1", nil},
+		{"rider reports no-show", NoShow, assigned, "rider-1", ErrNotAssignedDriver},
+		{"rider pauses", Pause, assigned, "rider-1", nil},
+		{"driver pauses", Pause, assigned, "driver-1", nil},
+		{"stranger pauses", Pause, assigned, "rider-2", ErrNotParticipant},
+		{"other driver pauses", Pause, assigned, "driver-2", ErrNotParticipant},
+		{"anonymous pauses", Pause, unassigned, "", ErrNotParticipant},
+		{"rider resumes", Resume, assigned, "rider-1", nil},
+		{"stranger resumes", Resume, assigned, "rider-2", ErrNotParticipant},
+		{"anyone assigns", Assign, unassigned, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, ok := Lookup(tt.ev)
+			if !ok {
+				t.Fatalf("no transition for %s", tt.ev)
+			}
+			if _, err := Check(tt.ev, tr.From[0], tt.p, tt.actor); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTerminal(t *testing.T) {
+	for _, status := range statuses {
+		want := status == Completed || status == Cancelled
+		if got := Terminal(status); got != want {
+			t.Errorf("Terminal(%s) = %v, want %v", status, got, want)
+		}
+	}
+}
+
+func TestAfter(t *testing.T) {
+	tests := []struct {
+		tr     Transition
+		status string
+		want   string
+	}{
+		{Transition{To: Started}, DriverAssigned, Started},
+		{Transition{}, Started, Started},
+		{Transition{}, DriverAssigned, DriverAssigned},
+	}
+	for _, tt := range tests {
+		if got := tt.tr.After(tt.status); got != tt.want {
+			t.Errorf("%+v.After(%s) = %s, want %s", tt.tr, tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestStampsAndDriverClearing(t *testing.T) {
+	for _, ev := range []Event{Decline, Withdraw} {
+		if tr, _ := Lookup(ev); !tr.ClearDriver {
+			t.Errorf("%s keeps the driver", ev)
+		}
+	}
+	for ev, stamp := range map[Event]Stamp{Start: StartedAt, Complete: CompletedAt, Arrive: ArrivedAt, Cancel: CancelledAt, Expire: CancelledAt} {
+		if tr, _ := Lookup(ev); !slices.Contains(tr.Stamps, stamp) {
+			t.Errorf("%s does not stamp %s", ev, stamp)
+		}
+	}
+}
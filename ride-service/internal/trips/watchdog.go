@@ -0,0 +1,109 @@
+package trips
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"ride-service/internal/trips/statemachine"
+)
+
+// watchdogBatch caps the trips of each kind one watchdog run handles; the
+// rest wait for the next run.
+const watchdogBatch = 100
+
+// Reviewer queues a trip STARTED for implausibly long for staff to review.
+// Queuing the same trip again must do nothing.
+type Reviewer interface {
+	FlagLongTrip(ctx context.Context, tripID, driverID, riderID string, startedAt time.Time, limit time.Duration) error
+}
+
+// StartWatchdog looks for stuck trips every limits.WatchdogInterval. A trip
+// still without a driver limits.MatchRetryAfter after it was requested is
+// matched again, and cancelled with trip.cancelled once it has waited
+// limits.MatchTimeout; a trip STARTED for longer than limits.MaxDuration
+// goes to review, unless review is nil.
+func (s *Service) StartWatchdog(ctx context.Context, review Reviewer) {
+	if s.limits.WatchdogInterval <= 0 {
+		return
+	}
+	go func() {
+		t := time.NewTicker(s.limits.WatchdogInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				if err := s.watch(ctx, review); err != nil && ctx.Err() == nil {
+					logger.Error("trip watchdog failed", "err", err)
+				}
+			}
+		}
+	}()
+}
+
+func (s *Service) watch(ctx context.Context, review Reviewer) error {
+	now := time.Now()
+	unmatched, err := s.repo.ListUnmatched(ctx, now.Add(-s.limits.MatchRetryAfter), watchdogBatch)
+	if err != nil {
+		return err
+	}
+	for i := range unmatched {
+		t := &unmatched[i]
+		waited := now.Sub(t.CreatedAt)
+		if waited < s.limits.MatchTimeout {
+			s.rematch(ctx, t, waited)
+			continue
+		}
+		if err := s.expire(ctx, t, waited); err != nil {
+			return err
+		}
+	}
+
+	if review == nil {
+		return nil
+	}
+	long, err := s.repo.ListStartedBefore(ctx, now.Add(-s.limits.MaxDuration), watchdogBatch)
+	if err != nil {
+		return err
+	}
+	for _, t := range long {
+		var driverID string
+		if t.DriverID != nil {
+			driverID = *t.DriverID
+		}
+		if err := review.FlagLongTrip(ctx, t.ID, driverID, t.RiderID, *t.StartedAt, s.limits.MaxDuration); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rematch publishes ride.requested again for a trip that has waited for a
+// driver, marked as a retry so it is not counted as a new request.
+func (s *Service) rematch(ctx context.Context, t *Trip, waited time.Duration) {
+	excluded, err := s.repo.Released(ctx, t.ID)
+	if err != nil {
+		logger.Warn("released drivers lookup failed", "trip", t.ID, "err", err)
+	}
+	ev := requestedEvent(t, excluded)
+	ev.Retry = int(waited / s.limits.MatchRetryAfter)
+	logger.Info("re-matching waiting trip", "trip", t.ID, "waited", waited.Round(time.Second), "retry", ev.Retry)
+	s.publishRequestedEvent(ev)
+}
+
+// expire cancels a trip that has waited limits.MatchTimeout for a driver.
+// One matched or otherwise changed meanwhile is left alone.
+func (s *Service) expire(ctx context.Context, t *Trip, waited time.Duration) error {
+	cancelled, err := s.repo.Expire(ctx, t.ID, t.Version)
+	if errors.Is(err, ErrVersionConflict) || errors.Is(err, ErrStateChanged) || errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	logger.Warn("no driver found, trip cancelled", "trip", t.ID, "rider", t.RiderID, "waited", waited.Round(time.Second))
+	s.emit(ctx, statemachine.Expire, cancelled)
+	return nil
+}
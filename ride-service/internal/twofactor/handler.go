@@ -0,0 +1,133 @@
+package twofactor
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+)
+
+// Handler exposes 2FA enrollment to drivers and staff, and resets to
+// support.
+type Handler struct{ svc *Service }
+
+// NewHandler wires a handler to the two-factor service.
+func NewHandler(svc *Service) *Handler { return &Handler{svc: svc} }
+
+// Routes returns the routes mounted at /two-factor: the caller's own 2FA.
+func (h *Handler) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth, jwt.RequireRole("driver", "admin", "support"))
+
+	r.Get("/", h.Status)
+	r.Post("/", h.Enroll)
+	r.Post("/confirm", h.Confirm)
+	r.Post("/disable", h.Disable)
+	r.Post("/backup-codes", h.RenewBackupCodes)
+
+	return r
+}
+
+// AdminRoutes returns the routes mounted under /admin/two-factor.
+func (h *Handler) AdminRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth, jwt.RequireRole("admin", "support"))
+
+	r.Get("/{id}", h.AccountStatus)
+	r.Delete("/{id}", h.Reset)
+
+	return r
+}
+
+func (h *Handler) Status(w http.ResponseWriter, r *http.Request) {
+	st, err := h.svc.Status(r.Context(), jwt.GetClaims(r.Context()).UserID)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, st)
+}
+
+func (h *Handler) Enroll(w http.ResponseWriter, r *http.Request) {
+	claims := jwt.GetClaims(r.Context())
+	accountType, err := AccountType(claims.Role)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	e, err := h.svc.Enroll(r.Context(), claims.UserID, accountType, claims.Email)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusCreated, e)
+}
+
+func (h *Handler) Confirm(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeCode(w, r)
+	if !ok {
+		return
+	}
+	codes, err := h.svc.Confirm(r.Context(), jwt.GetClaims(r.Context()).UserID, req.Code)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, codes)
+}
+
+func (h *Handler) Disable(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeCode(w, r)
+	if !ok {
+		return
+	}
+	if err := h.svc.Disable(r.Context(), jwt.GetClaims(r.Context()).UserID, req.Code); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]string{"status": "disabled"})
+}
+
+func (h *Handler) RenewBackupCodes(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeCode(w, r)
+	if !ok {
+		return
+	}
+	codes, err := h.svc.RenewBackupCodes(r.Context(), jwt.GetClaims(r.Context()).UserID, req.Code)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, codes)
+}
+
+func (h *Handler) AccountStatus(w http.ResponseWriter, r *http.Request) {
+	st, err := h.svc.Status(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, st)
+}
+
+// Reset serves DELETE /admin/two-factor/{id}, for an account that lost its
+// authenticator and backup codes.
+func (h *Handler) Reset(w http.ResponseWriter, r *http.Request) {
+	if err := h.svc.Reset(r.Context(), chi.URLParam(r, "id"), jwt.GetClaims(r.Context()).Role); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]string{"status": "reset"})
+}
+
+func decodeCode(w http.ResponseWriter, r *http.Request) (CodeRequest, bool) {
+	var req CodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		apierror.Write(w, apierror.Validation("invalid body: code is required"))
+		return req, false
+	}
+	return req, true
+}
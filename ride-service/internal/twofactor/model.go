@@ -0,0 +1,42 @@
+package twofactor
+
+import "time"
+
+// Issuer names the service in authenticator apps.
+const Issuer = "RideService"
+
+// BackupCodeCount is how many backup codes an account gets at a time.
+const BackupCodeCount = 10
+
+// Account types that can enroll: drivers, and staff (admin and support
+// users). Riders cannot.
+const (
+	AccountDriver = "driver"
+	AccountUser   = "user"
+)
+
+// Enrollment is returned by POST /two-factor: the secret to add to an
+// authenticator app, as text and as an otpauth:// URI to show as a QR code.
+type Enrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// CodeRequest carries a code from the authenticator app or a backup code.
+type CodeRequest struct {
+	Code string `json:"code" validate:"required"`
+}
+
+// BackupCodes are shown once, when 2FA is enabled or the codes are renewed.
+type BackupCodes struct {
+	Codes []string `json:"backup_codes"`
+}
+
+// Status is GET /two-factor and GET /admin/two-factor/{id}.
+type Status struct {
+	AccountID         string     `json:"account_id"`
+	Enabled           bool       `json:"enabled"`
+	EnabledAt         *time.Time `json:"enabled_at,omitempty"`
+	BackupCodesLeft   int        `json:"backup_codes_left"`
+	PendingEnrollment bool       `json:"pending_enrollment,omitempty"`
+}
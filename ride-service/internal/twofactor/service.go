@@ -0,0 +1,360 @@
+package twofactor
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/internal/audit"
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/logging"
+	"ride-service/pkg/pii"
+	"ride-service/pkg/totp"
+)
+
+var logger = logging.For("twofactor")
+
+var (
+	ErrNotOffered     = apierror.Forbidden("two-factor authentication is for drivers and staff")
+	ErrAlreadyEnabled = apierror.Conflict("two-factor authentication is already enabled").WithCode("two_factor_enabled")
+	ErrNotEnabled     = apierror.NotFound("two-factor authentication is not enabled")
+	ErrNoEnrollment   = apierror.NotFound("no two-factor enrollment to confirm")
+	ErrWrongCode      = apierror.Validation("wrong two-factor code")
+	ErrStaffOnly      = apierror.Forbidden("only an admin can reset a staff account's two-factor authentication")
+
+	// Returned by Check, at login.
+	ErrRequired    = apierror.Unauthorized("two-factor code required").WithCode("two_factor_required")
+	ErrInvalidCode = apierror.Unauthorized("invalid two-factor code").WithCode("invalid_two_factor_code")
+)
+
+// secretField binds sealed secrets to their column, as pii does for emails.
+const secretField = "totp"
+
+// backupAlphabet leaves out characters easily misread: 0/o, 1/l/i.
+const backupAlphabet = "23456789abcdefghjkmnpqrstuvwxyz"
+
+// Audit actions.
+const (
+	actionEnable  = "auth.two_factor_enable"
+	actionDisable = "auth.two_factor_disable"
+	actionReset   = "auth.two_factor_reset"
+)
+
+// Service enrolls drivers and staff in TOTP two-factor authentication and
+// checks their codes at login. Accounts keep a handful of one-time backup
+// codes for a lost phone; past those, support resets 2FA after checking
+// who they are.
+type Service struct {
+	db     *pgxpool.Pool
+	cipher *pii.Cipher
+	audit  *audit.Service
+}
+
+// NewService creates a two-factor service. Secrets are sealed with cipher;
+// enabling, disabling and resets go to auditLog.
+func NewService(db *pgxpool.Pool, cipher *pii.Cipher, auditLog *audit.Service) *Service {
+	return &Service{db: db, cipher: cipher, audit: auditLog}
+}
+
+// AccountType returns the account type a caller with role enrolls as, or
+// ErrNotOffered for riders.
+func AccountType(role string) (string, error) {
+	switch role {
+	case "driver":
+		return AccountDriver, nil
+	case "admin", "support":
+		return AccountUser, nil
+	}
+	return "", ErrNotOffered
+}
+
+// Enroll starts enrollment with a new secret, replacing one not yet
+// confirmed. 2FA is enabled once Confirm gets a code from it.
+func (s *Service) Enroll(ctx context.Context, accountID, accountType, label string) (*Enrollment, error) {
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := s.cipher.Encrypt(secretField, secret)
+	if err != nil {
+		return nil, err
+	}
+	tag, err := s.db.Exec(ctx,
+		`INSERT INTO two_factor (account_id, account_type, secret) VALUES ($1,$2,$3)
+		 ON CONFLICT (account_id) DO UPDATE SET secret=EXCLUDED.secret, last_step=0, created_at=NOW()
+		 WHERE two_factor.enabled_at IS NULL`,
+		accountID, accountType, sealed)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, ErrAlreadyEnabled
+	}
+	return &Enrollment{Secret: secret, URI: totp.URI(Issuer, label, secret)}, nil
+}
+
+// Confirm enables 2FA with a code from the pending enrollment's secret and
+// returns the account's first backup codes.
+func (s *Service) Confirm(ctx context.Context, accountID, code string) (*BackupCodes, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var sealed, accountType string
+	var enabled *time.Time
+	err = tx.QueryRow(ctx, `SELECT secret, account_type, enabled_at FROM two_factor WHERE account_id=$1 FOR UPDATE`, accountID).
+		Scan(&sealed, &accountType, &enabled)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNoEnrollment
+	} else if err != nil {
+		return nil, err
+	}
+	if enabled != nil {
+		return nil, ErrAlreadyEnabled
+	}
+	secret, err := s.cipher.Decrypt(secretField, sealed)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := totp.Validate(secret, strings.TrimSpace(code), time.Now(), 0)
+	if !ok {
+		return nil, ErrWrongCode
+	}
+	if _, err := tx.Exec(ctx, `UPDATE two_factor SET enabled_at=NOW(), last_step=$2 WHERE account_id=$1`, accountID, step); err != nil {
+		return nil, err
+	}
+	codes, err := replaceBackupCodes(ctx, tx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, actionEnable, target(accountType), accountID, nil, nil)
+	return codes, nil
+}
+
+// Status reports whether accountID has 2FA enabled.
+func (s *Service) Status(ctx context.Context, accountID string) (*Status, error) {
+	st := &Status{AccountID: accountID}
+	if _, err := uuid.Parse(accountID); err != nil {
+		return st, nil
+	}
+	err := s.db.QueryRow(ctx,
+		`SELECT enabled_at,
+		        (SELECT COUNT(*) FROM two_factor_backup_codes b WHERE b.account_id=t.account_id AND b.used_at IS NULL)
+		   FROM two_factor t WHERE account_id=$1`, accountID).Scan(&st.EnabledAt, &st.BackupCodesLeft)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return st, nil
+	} else if err != nil {
+		return nil, err
+	}
+	st.Enabled = st.EnabledAt != nil
+	st.PendingEnrollment = !st.Enabled
+	return st, nil
+}
+
+// Disable turns 2FA off for accountID, given a current code or a backup
+// code.
+func (s *Service) Disable(ctx context.Context, accountID, code string) error {
+	if err := s.verify(ctx, accountID, code, ErrWrongCode); err != nil {
+		return err
+	}
+	var accountType string
+	err := s.db.QueryRow(ctx, `DELETE FROM two_factor WHERE account_id=$1 RETURNING account_type`, accountID).Scan(&accountType)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotEnabled
+	} else if err != nil {
+		return err
+	}
+	s.audit.Record(ctx, actionDisable, target(accountType), accountID, nil, nil)
+	return nil
+}
+
+// RenewBackupCodes replaces accountID's backup codes, given a current code
+// or one of the old backup codes.
+func (s *Service) RenewBackupCodes(ctx context.Context, accountID, code string) (*BackupCodes, error) {
+	if err := s.verify(ctx, accountID, code, ErrWrongCode); err != nil {
+		return nil, err
+	}
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+	codes, err := replaceBackupCodes(ctx, tx, accountID)
+	if err != nil {
+		return nil, err
+	}
+	return codes, tx.Commit(ctx)
+}
+
+// Reset turns 2FA off for an account that lost both its authenticator and
+// its backup codes, once support has checked who they are. The account
+// then logs in with its password alone and can enroll again. Support may
+// reset drivers only; a staff account needs an admin.
+func (s *Service) Reset(ctx context.Context, accountID, callerRole string) error {
+	if _, err := uuid.Parse(accountID); err != nil {
+		return ErrNotEnabled
+	}
+	var accountType string
+	err := s.db.QueryRow(ctx, `SELECT account_type FROM two_factor WHERE account_id=$1`, accountID).Scan(&accountType)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotEnabled
+	} else if err != nil {
+		return err
+	}
+	if accountType == AccountUser && callerRole != "admin" {
+		return ErrStaffOnly
+	}
+	if _, err := s.db.Exec(ctx, `DELETE FROM two_factor WHERE account_id=$1`, accountID); err != nil {
+		return err
+	}
+	s.audit.Record(ctx, actionReset, target(accountType), accountID, nil, nil)
+	logger.Info("two-factor reset", "account", accountID)
+	return nil
+}
+
+// Check is the second step of a login for accountID: nil if the account
+// has no 2FA or code is valid, ErrRequired if code is missing and
+// ErrInvalidCode if it is wrong or already used.
+func (s *Service) Check(ctx context.Context, accountID, code string) error {
+	var enabled bool
+	err := s.db.QueryRow(ctx, `SELECT enabled_at IS NOT NULL FROM two_factor WHERE account_id=$1`, accountID).Scan(&enabled)
+	if errors.Is(err, pgx.ErrNoRows) || err == nil && !enabled {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if strings.TrimSpace(code) == "" {
+		return ErrRequired
+	}
+	return s.verify(ctx, accountID, code, ErrInvalidCode)
+}
+
+// verify accepts a TOTP code not used before or an unused backup code for
+// accountID, using it up; otherwise it returns wrong.
+func (s *Service) verify(ctx context.Context, accountID, code string, wrong error) error {
+	if _, err := uuid.Parse(accountID); err != nil {
+		return ErrNotEnabled
+	}
+	var sealed string
+	var lastStep int64
+	err := s.db.QueryRow(ctx,
+		`SELECT secret, last_step FROM two_factor WHERE account_id=$1 AND enabled_at IS NOT NULL`, accountID).Scan(&sealed, &lastStep)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotEnabled
+	} else if err != nil {
+		return err
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		secret, err := s.cipher.Decrypt(secretField, sealed)
+		if err != nil {
+			return err
+		}
+		step, ok := totp.Validate(secret, code, time.Now(), lastStep)
+		if !ok {
+			return wrong
+		}
+		// Only one login can use a step: a replayed code loses the race.
+		tag, err := s.db.Exec(ctx, `UPDATE two_factor SET last_step=$2 WHERE account_id=$1 AND last_step < $2`, accountID, step)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return wrong
+		}
+		if !strings.HasPrefix(sealed, s.cipher.CurrentPrefix()) {
+			s.reseal(ctx, accountID, secret)
+		}
+		return nil
+	}
+
+	tag, err := s.db.Exec(ctx,
+		`UPDATE two_factor_backup_codes SET used_at=NOW() WHERE account_id=$1 AND code_hash=$2 AND used_at IS NULL`,
+		accountID, hashBackupCode(code))
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return wrong
+	}
+	logger.Info("backup code used", "account", accountID)
+	return nil
+}
+
+// reseal stores secret again under the current PII key, as the rekeyer does
+// for emails and phone numbers, so old keys can be retired.
+func (s *Service) reseal(ctx context.Context, accountID, secret string) {
+	sealed, err := s.cipher.Encrypt(secretField, secret)
+	if err == nil {
+		_, err = s.db.Exec(ctx, `UPDATE two_factor SET secret=$2 WHERE account_id=$1`, accountID, sealed)
+	}
+	if err != nil {
+		logger.Warn("resealing two-factor secret failed", "account", accountID, "err", err)
+	}
+}
+
+func replaceBackupCodes(ctx context.Context, tx pgx.Tx, accountID string) (*BackupCodes, error) {
+	if _, err := tx.Exec(ctx, `DELETE FROM two_factor_backup_codes WHERE account_id=$1`, accountID); err != nil {
+		return nil, err
+	}
+	out := &BackupCodes{Codes: make([]string, BackupCodeCount)}
+	for i := range out.Codes {
+		code, err := newBackupCode()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec(ctx,
+			`INSERT INTO two_factor_backup_codes (account_id, code_hash) VALUES ($1,$2)`,
+			accountID, hashBackupCode(code)); err != nil {
+			return nil, err
+		}
+		out.Codes[i] = code
+	}
+	return out, nil
+}
+
+// newBackupCode returns ten random characters as xxxxx-xxxxx.
+func newBackupCode() (string, error) {
+	var b strings.Builder
+	for i := 0; i < 10; i++ {
+		if i == 5 {
+			b.WriteByte('-')
+		}
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(backupAlphabet))))
+		if err != nil {
+			return "", err
+		}
+		b.WriteByte(backupAlphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+// hashBackupCode hashes code as typed, ignoring case, spaces and dashes.
+func hashBackupCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// target is the audit target type of an account type.
+func target(accountType string) string {
+	if accountType == AccountDriver {
+		return audit.TargetDriver
+	}
+	return audit.TargetUser
+}
@@ -2,11 +2,16 @@ package users
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 
+	"ride-service/pkg/apierror"
 	"ride-service/pkg/jwt"
+	"ride-service/pkg/validation"
+	"ride-service/pkg/verification"
 )
 
 // Handler exposes user HTTP endpoints.
@@ -27,51 +32,145 @@ func (h *Handler) Routes() chi.Router {
 	r.Group(func(r chi.Router) {
 		r.Use(jwt.RequireAuth)
 		r.Get("/{id}", h.GetProfile)
+		r.Patch("/{id}", h.UpdateProfile)
+		r.Post("/{id}/verify", h.VerifyChange)
+		r.Delete("/{id}", h.Delete)
 	})
 
 	return r
 }
 
+// AdminRoutes returns the routes mounted under /admin/users.
+func (h *Handler) AdminRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth, jwt.RequireRole("admin"))
+	r.Post("/{id}/restore", h.Restore)
+	return r
+}
+
 func (h *Handler) Register(w http.ResponseWriter, r *http.Request) {
 	var req RegisterRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid body"})
+		apierror.Write(w, apierror.Validation("invalid body"))
 		return
 	}
+	if req.Country == "" {
+		req.Country = validation.DefaultCountry
+	}
+	phone, err := validation.NormalizePhone(req.Phone, req.Country)
+	if err != nil {
+		apierror.Write(w, apierror.Validation(err.Error()))
+		return
+	}
+	req.Phone, req.Country = phone, strings.ToUpper(req.Country)
+
 	resp, err := h.svc.Register(r.Context(), req)
 	if err != nil {
-		writeJSON(w, http.StatusConflict, map[string]string{"error": err.Error()})
+		apierror.Write(w, err)
 		return
 	}
-	writeJSON(w, http.StatusCreated, resp)
+	apierror.WriteJSON(w, http.StatusCreated, resp)
 }
 
 func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 	var req LoginRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid body"})
+		apierror.Write(w, apierror.Validation("invalid body"))
 		return
 	}
 	resp, err := h.svc.Login(r.Context(), req)
 	if err != nil {
-		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": err.Error()})
+		apierror.Write(w, err)
 		return
 	}
-	writeJSON(w, http.StatusOK, resp)
+	apierror.WriteJSON(w, http.StatusOK, resp)
 }
 
 func (h *Handler) GetProfile(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
 	u, err := h.svc.GetByID(r.Context(), id)
 	if err != nil {
-		writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, u)
+}
+
+func (h *Handler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if jwt.GetClaims(r.Context()).UserID != id {
+		apierror.Write(w, apierror.Forbidden("forbidden"))
+		return
+	}
+	var req UpdateProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	if req.Password != nil && req.CurrentPassword == "" {
+		apierror.Write(w, apierror.Validation("current_password is required to change the password"))
+		return
+	}
+	resp, err := h.svc.UpdateProfile(r.Context(), id, req)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, resp)
+}
+
+func (h *Handler) VerifyChange(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if jwt.GetClaims(r.Context()).UserID != id {
+		apierror.Write(w, apierror.Forbidden("forbidden"))
+		return
+	}
+	var req VerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	if req.Field != verification.Email && req.Field != verification.Phone {
+		apierror.Write(w, apierror.Validation("field must be email or phone"))
+		return
+	}
+	u, err := h.svc.VerifyChange(r.Context(), id, req)
+	if err != nil {
+		apierror.Write(w, err)
 		return
 	}
-	writeJSON(w, http.StatusOK, u)
+	apierror.WriteJSON(w, http.StatusOK, u)
 }
 
-func writeJSON(w http.ResponseWriter, status int, v any) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(v)
+// Delete deactivates the caller's own account; admins may deactivate any.
+func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	claims := jwt.GetClaims(r.Context())
+	if claims.UserID != id && claims.Role != "admin" {
+		apierror.Write(w, apierror.Forbidden("forbidden"))
+		return
+	}
+	err := h.svc.Delete(r.Context(), id)
+	if errors.Is(err, ErrNotFound) {
+		apierror.Write(w, apierror.NotFound("user not found or already deactivated"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]string{"status": "deactivated"})
+}
+
+func (h *Handler) Restore(w http.ResponseWriter, r *http.Request) {
+	u, err := h.svc.Restore(r.Context(), chi.URLParam(r, "id"))
+	if errors.Is(err, ErrNotFound) {
+		apierror.Write(w, apierror.NotFound("user not found, not deactivated or erased"))
+		return
+	}
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, u)
 }
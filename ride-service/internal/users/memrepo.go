@@ -0,0 +1,131 @@
+package users
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryRepo is an in-memory UserRepo for tests and local experiments.
+type MemoryRepo struct {
+	mu    sync.Mutex
+	users map[string]User
+}
+
+// NewMemoryRepo returns an empty MemoryRepo.
+func NewMemoryRepo() *MemoryRepo { return &MemoryRepo{users: map[string]User{}} }
+
+func (m *MemoryRepo) EmailTaken(_ context.Context, email string) (bool, error) {
+	_, ok := m.find(func(u User) bool { return u.Email == email })
+	return ok, nil
+}
+
+func (m *MemoryRepo) PhoneTaken(_ context.Context, phone string) (bool, error) {
+	_, ok := m.find(func(u User) bool { return u.Phone == phone })
+	return ok, nil
+}
+
+func (m *MemoryRepo) Create(_ context.Context, u *User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u.CreatedAt = time.Now()
+	m.users[u.ID] = *u
+	return nil
+}
+
+func (m *MemoryRepo) GetByEmail(_ context.Context, email string) (*User, error) {
+	u, ok := m.find(func(u User) bool { return u.Email == email && u.DeletedAt == nil })
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &u, nil
+}
+
+func (m *MemoryRepo) GetByID(_ context.Context, id string) (*User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	u.PasswordHash = ""
+	return &u, nil
+}
+
+func (m *MemoryRepo) SoftDelete(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[id]
+	if !ok || u.DeletedAt != nil {
+		return ErrNotFound
+	}
+	now := time.Now()
+	u.DeletedAt = &now
+	m.users[id] = u
+	return nil
+}
+
+func (m *MemoryRepo) Restore(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[id]
+	if !ok || u.DeletedAt == nil {
+		return ErrNotFound
+	}
+	u.DeletedAt = nil
+	m.users[id] = u
+	return nil
+}
+
+func (m *MemoryRepo) PasswordHash(_ context.Context, id string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[id]
+	if !ok || u.DeletedAt != nil {
+		return "", ErrNotFound
+	}
+	return u.PasswordHash, nil
+}
+
+func (m *MemoryRepo) UpdateProfile(_ context.Context, id string, p Profile) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	u, ok := m.users[id]
+	if !ok || u.DeletedAt != nil {
+		return ErrNotFound
+	}
+	for oid, o := range m.users {
+		switch {
+		case oid == id:
+		case p.Email != nil && o.Email == *p.Email:
+			return ErrEmailTaken
+		case p.Phone != nil && o.Phone == *p.Phone:
+			return ErrPhoneTaken
+		}
+	}
+	set(&u.Name, p.Name)
+	set(&u.Email, p.Email)
+	set(&u.Phone, p.Phone)
+	set(&u.Country, p.Country)
+	set(&u.PasswordHash, p.PasswordHash)
+	set(&u.Gender, p.Gender)
+	m.users[id] = u
+	return nil
+}
+
+func set(dst *string, v *string) {
+	if v != nil {
+		*dst = *v
+	}
+}
+
+func (m *MemoryRepo) find(match func(User) bool) (User, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, u := range m.users {
+		if match(u) {
+			return u, true
+		}
+	}
+	return User{}, false
+}
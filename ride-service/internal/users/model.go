@@ -4,27 +4,44 @@ import "time"
 
 // User represents a rider account.
 type User struct {
-	ID           string    `json:"id"`
-	Name         string    `json:"name"`
-	Email        string    `json:"email"`
-	Phone        string    `json:"phone"`
-	PasswordHash string    `json:"-"`
-	Rating       float64   `json:"rating"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID           string     `json:"id"`
+	Name         string     `json:"name"`
+	Email        string     `json:"email"`
+	Phone        string     `json:"phone"`            // E.164
+	Country      string     `json:"country"`          // ISO 3166-1 alpha-2
+	Gender       string     `json:"gender,omitempty"` // optional; see events.Genders
+	PasswordHash string     `json:"-"`
+	Rating       float64    `json:"rating"`
+	Role         string     `json:"role"` // rider | admin
+	CreatedAt    time.Time  `json:"created_at"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"` // set while the account is deactivated
 }
 
 // RegisterRequest is the body for POST /users/register.
 type RegisterRequest struct {
-	Name     string `json:"name"`
-	Email    string `json:"email"`
-	Phone    string `json:"phone"`
-	Password string `json:"password"`
+	Name     string `json:"name" validate:"required,minLength=2,maxLength=200"`
+	Email    string `json:"email" validate:"required,format=email,maxLength=200"`
+	Phone    string `json:"phone" validate:"required,maxLength=30"`
+	Country  string `json:"country" validate:"minLength=2,maxLength=2"` // ISO 3166-1 alpha-2, defaults to IN
+	Password string `json:"password" validate:"required,minLength=6,maxLength=100"`
+	Gender   string `json:"gender" validate:"maxLength=20"` // optional: female, male or nonbinary
+	// The versions of the terms of service and privacy policy accepted (see
+	// GET /terms). When given they must be the current ones; without them
+	// the account accepts before its first trip.
+	TermsVersion   string `json:"terms_version" validate:"maxLength=20"`
+	PrivacyVersion string `json:"privacy_version" validate:"maxLength=20"`
+	// The token from the CAPTCHA widget, required unless the server runs
+	// with CHALLENGE_PROVIDER=off.
+	ChallengeToken string `json:"challenge_token,omitempty" validate:"maxLength=4096"`
 }
 
 // LoginRequest is the body for POST /users/login.
 type LoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required,format=email"`
+	Password string `json:"password" validate:"required"`
+	// OTP is the authenticator or backup code of an account with
+	// two-factor authentication.
+	OTP string `json:"otp,omitempty"`
 }
 
 // AuthResponse is returned on register / login.
@@ -32,3 +49,36 @@ type AuthResponse struct {
 	Token string `json:"token"`
 	User  *User  `json:"user,omitempty"`
 }
+
+// UpdateProfileRequest is the body for PATCH /users/{id}. Omitted fields are
+// left unchanged. Email and phone changes wait for a verification code sent
+// to the new address; a new password needs the current one.
+type UpdateProfileRequest struct {
+	Name            *string `json:"name,omitempty" validate:"minLength=2,maxLength=200"`
+	Email           *string `json:"email,omitempty" validate:"format=email,maxLength=200"`
+	Phone           *string `json:"phone,omitempty" validate:"maxLength=30"`
+	Country         *string `json:"country,omitempty" validate:"minLength=2,maxLength=2"` // for phone; defaults to the account's
+	Password        *string `json:"password,omitempty" validate:"minLength=6,maxLength=100"`
+	Gender          *string `json:"gender,omitempty" validate:"maxLength=20"` // "" clears it
+	CurrentPassword string  `json:"current_password,omitempty"`
+}
+
+// ProfileResponse is returned by PATCH /users/{id}.
+type ProfileResponse struct {
+	User *User `json:"user"`
+	// Pending lists the fields ("email", "phone") awaiting a code.
+	Pending []string `json:"pending_verification,omitempty"`
+	// Token replaces the tokens revoked by a password change.
+	Token string `json:"token,omitempty"`
+}
+
+// VerifyRequest is the body for POST /users/{id}/verify.
+type VerifyRequest struct {
+	Field string `json:"field" validate:"required"` // email | phone
+	Code  string `json:"code" validate:"required,minLength=6,maxLength=6"`
+}
+
+// Profile holds account columns to change; nil fields are left as they are.
+type Profile struct {
+	Name, Email, Phone, Country, PasswordHash, Gender *string
+}
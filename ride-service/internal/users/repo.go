@@ -0,0 +1,188 @@
+package users
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/db"
+	"ride-service/pkg/pii"
+)
+
+// ErrNotFound is returned when no user matches.
+var ErrNotFound = apierror.NotFound("user not found")
+
+// ErrDeleted is returned when acting on a deactivated account.
+var ErrDeleted = apierror.NotFound("account is deactivated")
+
+var (
+	ErrEmailTaken    = apierror.Conflict("email already exists")
+	ErrPhoneTaken    = apierror.Conflict("phone already exists")
+	ErrWrongPassword = apierror.Forbidden("current password is incorrect")
+)
+
+// UserRepo persists rider accounts.
+type UserRepo interface {
+	EmailTaken(ctx context.Context, email string) (bool, error)
+	PhoneTaken(ctx context.Context, phone string) (bool, error)
+	Create(ctx context.Context, u *User) error
+	// GetByEmail includes PasswordHash and skips deactivated accounts;
+	// GetByID leaves the hash empty and returns deactivated accounts too.
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	GetByID(ctx context.Context, id string) (*User, error)
+	// SoftDelete sets deleted_at and Restore clears it; both return
+	// ErrNotFound unless the account exists in the opposite state. An
+	// erased account cannot be restored.
+	SoftDelete(ctx context.Context, id string) error
+	Restore(ctx context.Context, id string) error
+	// PasswordHash returns the hash of an active account.
+	PasswordHash(ctx context.Context, id string) (string, error)
+	// UpdateProfile writes p to an active account, returning ErrNotFound if
+	// there is none and ErrEmailTaken/ErrPhoneTaken on a uniqueness clash.
+	UpdateProfile(ctx context.Context, id string, p Profile) error
+}
+
+// pgRepo keeps email and phone encrypted; lookups go through their blind
+// indexes, or the plaintext of rows the rekeyer has not reached yet.
+type pgRepo struct {
+	db     *pgxpool.Pool
+	reads  *db.Router // GetByID may use a replica
+	cipher *pii.Cipher
+}
+
+// NewPostgresRepo returns a UserRepo backed by the users table.
+func NewPostgresRepo(router *db.Router, cipher *pii.Cipher) UserRepo {
+	return &pgRepo{db: router.Primary(), reads: router, cipher: cipher}
+}
+
+func (r *pgRepo) EmailTaken(ctx context.Context, email string) (bool, error) {
+	var exists bool
+	err := r.db.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE email_idx=$1 OR email=$2)",
+		r.cipher.Index(pii.Email, email), email).Scan(&exists)
+	return exists, err
+}
+
+func (r *pgRepo) PhoneTaken(ctx context.Context, phone string) (bool, error) {
+	var exists bool
+	err := r.db.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE phone_idx=$1 OR phone=$2)",
+		r.cipher.Index(pii.Phone, phone), phone).Scan(&exists)
+	return exists, err
+}
+
+func (r *pgRepo) Create(ctx context.Context, u *User) error {
+	email, emailIdx, err := r.cipher.Seal(pii.Email, u.Email)
+	if err != nil {
+		return err
+	}
+	phone, phoneIdx, err := r.cipher.Seal(pii.Phone, u.Phone)
+	if err != nil {
+		return err
+	}
+	return r.db.QueryRow(ctx,
+		`INSERT INTO users (id,name,email,phone,email_idx,phone_idx,country,password_hash,rating,role,gender)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11) RETURNING created_at`,
+		u.ID, u.Name, email, phone, emailIdx, phoneIdx, u.Country, u.PasswordHash, u.Rating, u.Role, u.Gender).Scan(&u.CreatedAt)
+}
+
+func (r *pgRepo) GetByEmail(ctx context.Context, email string) (*User, error) {
+	var u User
+	err := r.db.QueryRow(ctx,
+		`SELECT id,name,email,phone,country,gender,password_hash,rating,role,created_at FROM users
+		 WHERE (email_idx=$1 OR email=$2) AND deleted_at IS NULL`, r.cipher.Index(pii.Email, email), email).
+		Scan(&u.ID, &u.Name, &u.Email, &u.Phone, &u.Country, &u.Gender, &u.PasswordHash, &u.Rating, &u.Role, &u.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, r.open(&u)
+}
+
+// open decrypts the email and phone scanned into u.
+func (r *pgRepo) open(u *User) (err error) {
+	if u.Email, err = r.cipher.Decrypt(pii.Email, u.Email); err != nil {
+		return err
+	}
+	u.Phone, err = r.cipher.Decrypt(pii.Phone, u.Phone)
+	return err
+}
+
+func (r *pgRepo) GetByID(ctx context.Context, id string) (*User, error) {
+	var u User
+	err := r.reads.Reader(ctx).QueryRow(ctx,
+		`SELECT id,name,email,phone,country,gender,rating,role,created_at,deleted_at FROM users WHERE id=$1`, id).
+		Scan(&u.ID, &u.Name, &u.Email, &u.Phone, &u.Country, &u.Gender, &u.Rating, &u.Role, &u.CreatedAt, &u.DeletedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, r.open(&u)
+}
+
+func (r *pgRepo) SoftDelete(ctx context.Context, id string) error {
+	return r.setDeleted(ctx, `UPDATE users SET deleted_at=NOW() WHERE id=$1 AND deleted_at IS NULL`, id)
+}
+
+func (r *pgRepo) Restore(ctx context.Context, id string) error {
+	return r.setDeleted(ctx, `UPDATE users SET deleted_at=NULL WHERE id=$1 AND deleted_at IS NOT NULL
+		AND NOT EXISTS (SELECT 1 FROM erasure_requests WHERE user_id=$1 AND erased_at IS NOT NULL)`, id)
+}
+
+func (r *pgRepo) setDeleted(ctx context.Context, query, id string) error {
+	tag, err := r.db.Exec(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *pgRepo) PasswordHash(ctx context.Context, id string) (string, error) {
+	var hash string
+	err := r.db.QueryRow(ctx, `SELECT password_hash FROM users WHERE id=$1 AND deleted_at IS NULL`, id).Scan(&hash)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	return hash, err
+}
+
+func (r *pgRepo) UpdateProfile(ctx context.Context, id string, p Profile) error {
+	email, emailIdx, err := r.cipher.SealOptional(pii.Email, p.Email)
+	if err != nil {
+		return err
+	}
+	phone, phoneIdx, err := r.cipher.SealOptional(pii.Phone, p.Phone)
+	if err != nil {
+		return err
+	}
+	tag, err := r.db.Exec(ctx,
+		`UPDATE users SET name=COALESCE($1,name), email=COALESCE($2,email), phone=COALESCE($3,phone),
+		                  email_idx=COALESCE($4,email_idx), phone_idx=COALESCE($5,phone_idx),
+		                  country=COALESCE($6,country), password_hash=COALESCE($7,password_hash),
+		                  gender=COALESCE($9,gender)
+		 WHERE id=$8 AND deleted_at IS NULL`,
+		p.Name, email, phone, emailIdx, phoneIdx, p.Country, p.PasswordHash, id, p.Gender)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" { // unique violation
+		if pgErr.ConstraintName == "users_phone_idx_key" {
+			return ErrPhoneTaken
+		}
+		return ErrEmailTaken
+	}
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
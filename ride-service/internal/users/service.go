@@ -3,34 +3,125 @@ package users
 import (
 	"context"
 	"errors"
+	"slices"
+	"strings"
 
 	"github.com/google/uuid"
-	"github.com/jackc/pgx/v5/pgxpool"
 	"golang.org/x/crypto/bcrypt"
 
+	"ride-service/internal/audit"
+	"ride-service/internal/events"
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/challenge"
 	"ride-service/pkg/jwt"
+	"ride-service/pkg/lockout"
+	"ride-service/pkg/logging"
+	"ride-service/pkg/validation"
+	"ride-service/pkg/verification"
 )
 
+var logger = logging.For("users")
+
+// ErrInvalidCredentials is returned by Login for an unknown email or a wrong
+// password alike.
+var ErrInvalidCredentials = apierror.Unauthorized("invalid credentials")
+
+// ErrInvalidGender is returned for a gender outside events.Genders.
+var ErrInvalidGender = apierror.Validation("gender must be one of " + strings.Join(events.Genders, ", ") + ", or empty")
+
 // Service contains user business logic.
 type Service struct {
-	db *pgxpool.Pool
+	repo      UserRepo
+	codes     *verification.Codes
+	audit     *audit.Service
+	terms     TermsRecorder
+	guard     *lockout.Guard
+	twoFactor SecondFactor
+	challenge challenge.Verifier
+}
+
+// NewService creates a user service backed by the given repository. codes
+// confirms email and phone changes; deactivations and restores go to
+// auditLog.
+func NewService(repo UserRepo, codes *verification.Codes, auditLog *audit.Service) *Service {
+	return &Service{repo: repo, codes: codes, audit: auditLog}
+}
+
+// TermsRecorder checks and records the terms versions accepted at
+// registration.
+type TermsRecorder interface {
+	Check(termsVersion, privacyVersion string) error
+	Record(ctx context.Context, accountID, termsVersion, privacyVersion string) error
+}
+
+// RecordTerms sets where registrations' terms acceptances go; without it
+// they are ignored. Call it before serving.
+func (s *Service) RecordTerms(t TermsRecorder) { s.terms = t }
+
+// GuardLogins sets the guard failed logins are counted by; without it
+// logins are never delayed or locked. Call it before serving.
+func (s *Service) GuardLogins(g *lockout.Guard) { s.guard = g }
+
+// SecondFactor checks the two-factor code given at login. It returns nil for
+// accounts without two-factor authentication.
+type SecondFactor interface {
+	Check(ctx context.Context, accountID, code string) error
+}
+
+// RequireSecondFactor makes logins of accounts with two-factor
+// authentication (staff, here) also need its code. Call it before serving.
+func (s *Service) RequireSecondFactor(sf SecondFactor) { s.twoFactor = sf }
+
+// RequireChallenge makes registration need a solved CAPTCHA, checked by v.
+// Call it before serving.
+func (s *Service) RequireChallenge(v challenge.Verifier) { s.challenge = v }
+
+// checkTerms rejects terms versions given at registration that are not the
+// current ones.
+func (s *Service) checkTerms(termsVersion, privacyVersion string) error {
+	if s.terms == nil || termsVersion == "" && privacyVersion == "" {
+		return nil
+	}
+	return s.terms.Check(termsVersion, privacyVersion)
 }
 
-// NewService creates a user service backed by the given pool.
-func NewService(db *pgxpool.Pool) *Service {
-	return &Service{db: db}
+// recordTerms stores the acceptance of a new account. The account exists by
+// then, so a failure is logged and it is asked to accept again later.
+func (s *Service) recordTerms(ctx context.Context, accountID, termsVersion, privacyVersion string) {
+	if s.terms == nil || termsVersion == "" && privacyVersion == "" {
+		return
+	}
+	if err := s.terms.Record(ctx, accountID, termsVersion, privacyVersion); err != nil {
+		logger.Error("record terms acceptance failed", "account", accountID, "err", err)
+	}
 }
 
 // Register creates a new rider account and returns a JWT.
 func (s *Service) Register(ctx context.Context, req RegisterRequest) (*AuthResponse, error) {
-	var exists bool
-	_ = s.db.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE email=$1)", req.Email).Scan(&exists)
+	if s.challenge != nil {
+		if err := s.challenge.Verify(ctx, req.ChallengeToken, jwt.ClientIP(ctx)); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.checkTerms(req.TermsVersion, req.PrivacyVersion); err != nil {
+		return nil, err
+	}
+	gender, err := normalizeGender(req.Gender)
+	if err != nil {
+		return nil, err
+	}
+	exists, err := s.repo.EmailTaken(ctx, req.Email)
+	if err != nil {
+		return nil, err
+	}
 	if exists {
-		return nil, errors.New("email already exists")
+		return nil, ErrEmailTaken
+	}
+	if exists, err = s.repo.PhoneTaken(ctx, req.Phone); err != nil {
+		return nil, err
 	}
-	_ = s.db.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM users WHERE phone=$1)", req.Phone).Scan(&exists)
 	if exists {
-		return nil, errors.New("phone already exists")
+		return nil, ErrPhoneTaken
 	}
 
 	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
@@ -38,54 +129,275 @@ func (s *Service) Register(ctx context.Context, req RegisterRequest) (*AuthRespo
 		return nil, err
 	}
 
-	id := uuid.New().String()
-	_, err = s.db.Exec(ctx,
-		`INSERT INTO users (id,name,email,phone,password_hash,rating) VALUES ($1,$2,$3,$4,$5,5.0)`,
-		id, req.Name, req.Email, req.Phone, string(hash))
-	if err != nil {
+	u := &User{
+		ID: uuid.New().String(), Name: req.Name, Email: req.Email, Phone: req.Phone, Country: req.Country,
+		Gender: gender, PasswordHash: string(hash), Rating: 5.0, Role: "rider",
+	}
+	if err := s.repo.Create(ctx, u); err != nil {
 		return nil, err
 	}
+	s.recordTerms(ctx, u.ID, req.TermsVersion, req.PrivacyVersion)
 
-	token, err := jwt.Generate(id, req.Email, "rider")
+	token, err := jwt.Generate(ctx, u.ID, u.Email, u.Role)
 	if err != nil {
 		return nil, err
 	}
-
-	return &AuthResponse{
-		Token: token,
-		User:  &User{ID: id, Name: req.Name, Email: req.Email, Phone: req.Phone, Rating: 5.0},
-	}, nil
+	return &AuthResponse{Token: token, User: u}, nil
 }
 
-// Login authenticates a user and returns a JWT.
+// Login authenticates a user and returns a JWT. Failed attempts are counted
+// by the login guard, which refuses further ones for a while once there are
+// too many.
 func (s *Service) Login(ctx context.Context, req LoginRequest) (*AuthResponse, error) {
-	var u User
-	var hash string
-	err := s.db.QueryRow(ctx,
-		`SELECT id,name,email,phone,password_hash,rating,created_at FROM users WHERE email=$1`,
-		req.Email).Scan(&u.ID, &u.Name, &u.Email, &u.Phone, &hash, &u.Rating, &u.CreatedAt)
+	account, ip := "rider:"+req.Email, jwt.ClientIP(ctx)
+	if err := s.guard.Check(ctx, account, ip); err != nil {
+		return nil, err
+	}
+	u, err := s.repo.GetByEmail(ctx, req.Email)
+	if errors.Is(err, ErrNotFound) {
+		s.loginFailed(ctx, account, ip, "")
+		return nil, ErrInvalidCredentials
+	}
 	if err != nil {
-		return nil, errors.New("invalid credentials")
+		return nil, err
 	}
-	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(req.Password)) != nil {
-		return nil, errors.New("invalid credentials")
+	if bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(req.Password)) != nil {
+		s.loginFailed(ctx, account, ip, u.ID)
+		return nil, ErrInvalidCredentials
 	}
+	if s.twoFactor != nil {
+		if err := s.twoFactor.Check(ctx, u.ID, req.OTP); err != nil {
+			if req.OTP != "" {
+				s.loginFailed(ctx, account, ip, u.ID)
+			}
+			return nil, err
+		}
+	}
+	s.guard.Succeeded(ctx, account)
 
-	token, err := jwt.Generate(u.ID, u.Email, "rider")
+	token, err := jwt.Generate(ctx, u.ID, u.Email, u.Role)
 	if err != nil {
 		return nil, err
 	}
-	return &AuthResponse{Token: token, User: &u}, nil
+	return &AuthResponse{Token: token, User: u}, nil
+}
+
+// loginFailed counts a failed login and records any lockout it caused.
+// userID is empty when no account has the email tried.
+func (s *Service) loginFailed(ctx context.Context, account, ip, userID string) {
+	out := s.guard.Failed(ctx, account, ip)
+	if out.AccountLocked {
+		target := audit.TargetUser
+		if userID == "" {
+			target = ""
+		}
+		s.audit.Record(ctx, audit.LoginLockout, target, userID, nil, out)
+	}
+	if out.IPLocked {
+		s.audit.Record(ctx, audit.LoginIPLockout, audit.TargetIP, ip, nil, out)
+	}
 }
 
 // GetByID fetches a single user by primary key.
 func (s *Service) GetByID(ctx context.Context, id string) (*User, error) {
-	var u User
-	err := s.db.QueryRow(ctx,
-		`SELECT id,name,email,phone,rating,created_at FROM users WHERE id=$1`, id).
-		Scan(&u.ID, &u.Name, &u.Email, &u.Phone, &u.Rating, &u.CreatedAt)
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+	u, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// Delete deactivates the account: it can no longer log in, its tokens stop
+// working and it cannot request trips. Its trips and receipts are kept.
+func (s *Service) Delete(ctx context.Context, id string) error {
+	before, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.SoftDelete(ctx, id); err != nil {
+		return err
+	}
+	if err := jwt.Revoke(ctx, id); err != nil {
+		// The account is deactivated; tokens still expire within jwt.TokenTTL.
+		logger.Error("token revocation failed", "user", id, "err", err)
+	}
+	logger.Info("user deactivated", "user", id)
+	after, _ := s.repo.GetByID(ctx, id)
+	s.audit.Record(ctx, audit.UserDeactivate, audit.TargetUser, id, before, after)
+	return nil
+}
+
+// Restore reactivates a deactivated account.
+func (s *Service) Restore(ctx context.Context, id string) (*User, error) {
+	before, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.Restore(ctx, id); err != nil {
+		return nil, err
+	}
+	if err := jwt.Unrevoke(ctx, id); err != nil {
+		logger.Warn("token revocation clear failed", "user", id, "err", err)
+	}
+	logger.Info("user restored", "user", id)
+	u, err := s.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	s.audit.Record(ctx, audit.UserRestore, audit.TargetUser, id, before, u)
+	return u, nil
+}
+
+// Active reports whether the rider's account exists and is not deactivated.
+func (s *Service) Active(ctx context.Context, id string) (bool, error) {
+	u, err := s.repo.GetByID(ctx, id)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return u.DeletedAt == nil, nil
+}
+
+// UpdateProfile changes the name and password at once and sends codes for a
+// new email or phone, which VerifyChange applies. A password change needs the
+// current password and revokes every token issued so far; the response
+// carries a fresh one.
+func (s *Service) UpdateProfile(ctx context.Context, id string, req UpdateProfileRequest) (*ProfileResponse, error) {
+	u, err := s.repo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if u.DeletedAt != nil {
+		return nil, ErrDeleted
+	}
+
+	p := Profile{Name: req.Name}
+	if req.Gender != nil {
+		gender, err := normalizeGender(*req.Gender)
+		if err != nil {
+			return nil, err
+		}
+		p.Gender = &gender
+	}
+	if req.Password != nil {
+		hash, err := s.repo.PasswordHash(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(req.CurrentPassword)) != nil {
+			return nil, ErrWrongPassword
+		}
+		newHash, err := bcrypt.GenerateFromPassword([]byte(*req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return nil, err
+		}
+		h := string(newHash)
+		p.PasswordHash = &h
+	}
+
+	resp := &ProfileResponse{}
+	account := "user:" + id
+	if req.Email != nil && *req.Email != u.Email {
+		if taken, err := s.repo.EmailTaken(ctx, *req.Email); err != nil {
+			return nil, err
+		} else if taken {
+			return nil, ErrEmailTaken
+		}
+		if err := s.codes.Start(ctx, account, verification.Email, *req.Email, *req.Email); err != nil {
+			return nil, err
+		}
+		resp.Pending = append(resp.Pending, verification.Email)
+	}
+	if req.Phone != nil {
+		country := u.Country
+		if req.Country != nil {
+			country = strings.ToUpper(*req.Country)
+		}
+		phone, err := validation.NormalizePhone(*req.Phone, country)
+		if err != nil {
+			return nil, err
+		}
+		if phone != u.Phone || country != u.Country {
+			if taken, err := s.repo.PhoneTaken(ctx, phone); err != nil {
+				return nil, err
+			} else if taken && phone != u.Phone {
+				return nil, ErrPhoneTaken
+			}
+			if err := s.codes.Start(ctx, account, verification.Phone, phone, country+":"+phone); err != nil {
+				return nil, err
+			}
+			resp.Pending = append(resp.Pending, verification.Phone)
+		}
+	}
+
+	if p.Name != nil || p.Gender != nil || p.PasswordHash != nil {
+		if err := s.repo.UpdateProfile(ctx, id, p); err != nil {
+			return nil, err
+		}
+	}
+	if p.PasswordHash != nil {
+		if err := jwt.Revoke(ctx, id); err != nil {
+			// The password is changed; old tokens still expire within jwt.TokenTTL.
+			logger.Error("token revocation failed", "user", id, "err", err)
+		}
+		if resp.Token, err = jwt.Generate(ctx, u.ID, u.Email, u.Role); err != nil {
+			return nil, err
+		}
+		logger.Info("password changed", "user", id)
+	}
+	if resp.User, err = s.GetByID(ctx, id); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// VerifyChange applies the pending email or phone change the code was sent
+// for, after checking again that nobody took the address in the meantime.
+func (s *Service) VerifyChange(ctx context.Context, id string, req VerifyRequest) (*User, error) {
+	value, err := s.codes.Confirm(ctx, "user:"+id, req.Field, req.Code)
+	if err != nil {
+		return nil, err
+	}
+	u, err := s.repo.GetByID(ctx, id)
 	if err != nil {
-		return nil, errors.New("user not found")
+		return nil, err
+	}
+	var p Profile
+	switch req.Field {
+	case verification.Email:
+		if taken, err := s.repo.EmailTaken(ctx, value); err != nil {
+			return nil, err
+		} else if taken {
+			return nil, ErrEmailTaken
+		}
+		p.Email = &value
+	case verification.Phone:
+		country, phone, _ := strings.Cut(value, ":")
+		if taken, err := s.repo.PhoneTaken(ctx, phone); err != nil {
+			return nil, err
+		} else if taken && phone != u.Phone {
+			return nil, ErrPhoneTaken
+		}
+		p.Phone, p.Country = &phone, &country
+	}
+	if err := s.repo.UpdateProfile(ctx, id, p); err != nil {
+		return nil, err
+	}
+	logger.Info("contact changed", "user", id, "field", req.Field)
+	return s.GetByID(ctx, id)
+}
+
+// normalizeGender lower-cases g and checks it is one of events.Genders;
+// empty means not given.
+func normalizeGender(g string) (string, error) {
+	g = strings.ToLower(strings.TrimSpace(g))
+	if g != "" && !slices.Contains(events.Genders, g) {
+		return "", ErrInvalidGender
 	}
-	return &u, nil
+	return g, nil
 }
@@ -0,0 +1,36 @@
+package wallet
+
+import (
+	"time"
+
+	"ride-service/pkg/money"
+)
+
+// Entry kinds.
+const (
+	KindQuestBonus = "quest_bonus"
+	KindTip        = "tip"
+)
+
+// Entry is one credit (or, negative, debit) on a driver's wallet.
+type Entry struct {
+	ID          string      `json:"id"`
+	DriverID    string      `json:"driver_id"`
+	Amount      money.Money `json:"amount"`
+	Kind        string      `json:"kind"`
+	Reference   string      `json:"reference"`
+	Description string      `json:"description,omitempty"`
+	CreatedAt   time.Time   `json:"created_at"`
+}
+
+// Wallet is the response for GET /drivers/{id}/wallet: the balance, one
+// entry per currency the driver was paid in, and one page of entries,
+// newest first.
+type Wallet struct {
+	DriverID string        `json:"driver_id"`
+	Balances []money.Money `json:"balances"`
+	Entries  []Entry       `json:"entries"`
+	Total    int           `json:"total"`
+	Limit    int           `json:"limit"`
+	Offset   int           `json:"offset"`
+}
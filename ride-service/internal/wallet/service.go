@@ -0,0 +1,90 @@
+package wallet
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/db"
+	"ride-service/pkg/money"
+)
+
+var ErrNotFound = apierror.NotFound("driver not found")
+
+// Service reads and writes the driver wallet ledger.
+type Service struct {
+	db *pgxpool.Pool
+}
+
+// NewService creates a wallet service.
+func NewService(db *pgxpool.Pool) *Service {
+	return &Service{db: db}
+}
+
+// Credit adds amount to the driver's wallet through q, which may be a
+// transaction. An entry with the same kind and reference is only written
+// once; credited reports whether this call wrote it.
+func Credit(ctx context.Context, q db.Execer, driverID string, amount money.Money, kind, reference, description string) (credited bool, err error) {
+	tag, err := q.Exec(ctx,
+		`INSERT INTO driver_wallet_entries (id,driver_id,amount,amount_minor,currency,kind,reference,description)
+		 VALUES ($1,$2,$3::numeric,$4,$5,$6,$7,$8) ON CONFLICT (kind,reference) DO NOTHING`,
+		uuid.New().String(), driverID, amount.Decimal(), amount.Amount, amount.Currency, kind, reference, description)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// Wallet returns the driver's balance and one page of entries.
+func (s *Service) Wallet(ctx context.Context, driverID string, limit, offset int) (*Wallet, error) {
+	if _, err := uuid.Parse(driverID); err != nil {
+		return nil, ErrNotFound
+	}
+	w := &Wallet{DriverID: driverID, Balances: []money.Money{}, Entries: []Entry{}, Limit: limit, Offset: offset}
+	var exists bool
+	if err := s.db.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM drivers WHERE id=$1),
+		        (SELECT COUNT(*) FROM driver_wallet_entries WHERE driver_id=$1)`,
+		driverID).Scan(&exists, &w.Total); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+	balances, err := s.db.Query(ctx,
+		`SELECT SUM(amount_minor)::bigint, currency FROM driver_wallet_entries
+		 WHERE driver_id=$1 GROUP BY currency ORDER BY currency`, driverID)
+	if err != nil {
+		return nil, err
+	}
+	defer balances.Close()
+	for balances.Next() {
+		var b money.Money
+		if err := balances.Scan(&b.Amount, &b.Currency); err != nil {
+			return nil, err
+		}
+		w.Balances = append(w.Balances, b)
+	}
+	if err := balances.Err(); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(ctx,
+		`SELECT id,driver_id,amount_minor,currency,kind,reference,description,created_at
+		 FROM driver_wallet_entries WHERE driver_id=$1
+		 ORDER BY created_at DESC, id LIMIT $2 OFFSET $3`,
+		driverID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var e Entry
+		if err := rows.Scan(&e.ID, &e.DriverID, &e.Amount.Amount, &e.Amount.Currency, &e.Kind, &e.Reference, &e.Description, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		w.Entries = append(w.Entries, e)
+	}
+	return w, rows.Err()
+}
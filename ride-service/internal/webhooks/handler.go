@@ -0,0 +1,125 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+)
+
+// Handler exposes subscription management and the delivery log to admins.
+type Handler struct{ svc *Service }
+
+// NewHandler wires a handler to the webhook service.
+func NewHandler(svc *Service) *Handler { return &Handler{svc: svc} }
+
+// AdminRoutes returns the routes mounted under /admin/webhooks.
+func (h *Handler) AdminRoutes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth, jwt.RequireRole("admin"))
+
+	r.Get("/", h.List)
+	r.Post("/", h.Create)
+	r.Get("/{id}", h.Get)
+	r.Patch("/{id}", h.Update)
+	r.Delete("/{id}", h.Delete)
+	r.Post("/{id}/rotate-secret", h.RotateSecret)
+	r.Get("/{id}/deliveries", h.Deliveries)
+	r.Post("/{id}/deliveries/{deliveryID}/redeliver", h.Redeliver)
+
+	return r
+}
+
+func (h *Handler) List(w http.ResponseWriter, r *http.Request) {
+	subs, err := h.svc.List(r.Context())
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]any{"subscriptions": subs})
+}
+
+func (h *Handler) Create(w http.ResponseWriter, r *http.Request) {
+	var req SubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	sub, err := h.svc.Create(r.Context(), jwt.GetClaims(r.Context()).UserID, req)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusCreated, sub)
+}
+
+func (h *Handler) Get(w http.ResponseWriter, r *http.Request) {
+	sub, err := h.svc.Get(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, sub)
+}
+
+func (h *Handler) Update(w http.ResponseWriter, r *http.Request) {
+	var upd SubscriptionUpdate
+	if err := json.NewDecoder(r.Body).Decode(&upd); err != nil {
+		apierror.Write(w, apierror.Validation("invalid body"))
+		return
+	}
+	sub, err := h.svc.Update(r.Context(), chi.URLParam(r, "id"), upd)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, sub)
+}
+
+func (h *Handler) Delete(w http.ResponseWriter, r *http.Request) {
+	if err := h.svc.Delete(r.Context(), chi.URLParam(r, "id")); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+func (h *Handler) RotateSecret(w http.ResponseWriter, r *http.Request) {
+	sub, err := h.svc.RotateSecret(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, sub)
+}
+
+// Deliveries serves GET /admin/webhooks/{id}/deliveries?status=&limit=&offset=.
+func (h *Handler) Deliveries(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	limit := 50
+	if v, err := strconv.Atoi(q.Get("limit")); err == nil && v > 0 && v <= 200 {
+		limit = v
+	}
+	offset := 0
+	if v, err := strconv.Atoi(q.Get("offset")); err == nil && v > 0 {
+		offset = v
+	}
+	page, err := h.svc.Deliveries(r.Context(), chi.URLParam(r, "id"), q.Get("status"), limit, offset)
+	if err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusOK, page)
+}
+
+func (h *Handler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	if err := h.svc.Redeliver(r.Context(), chi.URLParam(r, "id"), chi.URLParam(r, "deliveryID")); err != nil {
+		apierror.Write(w, err)
+		return
+	}
+	apierror.WriteJSON(w, http.StatusAccepted, map[string]string{"status": StatusPending})
+}
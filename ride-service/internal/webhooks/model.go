@@ -0,0 +1,74 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"time"
+
+	"ride-service/pkg/eventbus"
+)
+
+// Events partners can subscribe to. They are the Kafka topics, and the body
+// of each delivery is the event's envelope as published.
+var Events = []string{eventbus.TopicRideRequested, eventbus.TopicDriverAssigned, eventbus.TopicTripCompleted, eventbus.TopicTipAdded,
+	eventbus.TopicTripNoShow, eventbus.TopicFareAdjusted}
+
+// Delivery statuses.
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed" // gave up after the last attempt
+)
+
+// Subscription is a partner's webhook.
+type Subscription struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	// Secret is only returned on creation and rotation.
+	Secret string `json:"secret,omitempty"`
+}
+
+// SubscriptionRequest is the body for POST /admin/webhooks. The secret is
+// generated, never supplied, so it does not end up in the audit log.
+type SubscriptionRequest struct {
+	Name   string   `json:"name"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+// SubscriptionUpdate is the body for PATCH /admin/webhooks/{id}. Omitted
+// fields are left alone.
+type SubscriptionUpdate struct {
+	Name   *string  `json:"name"`
+	URL    *string  `json:"url"`
+	Events []string `json:"events"`
+	Active *bool    `json:"active"`
+}
+
+// Delivery is one event sent (or being sent) to one subscription.
+type Delivery struct {
+	ID             string          `json:"id"`
+	SubscriptionID string          `json:"subscription_id"`
+	Event          string          `json:"event"`
+	EventID        string          `json:"event_id"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	ResponseCode   *int            `json:"response_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"` // while pending
+	CreatedAt      time.Time       `json:"created_at"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+}
+
+// DeliveryPage is a page of GET /admin/webhooks/{id}/deliveries, newest first.
+type DeliveryPage struct {
+	Deliveries []Delivery `json:"deliveries"`
+	Total      int        `json:"total"`
+	Limit      int        `json:"limit"`
+	Offset     int        `json:"offset"`
+}
@@ -0,0 +1,479 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/internal/events"
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/config"
+	"ride-service/pkg/eventbus"
+	"ride-service/pkg/logging"
+	"ride-service/pkg/webhook"
+)
+
+var logger = logging.For("webhooks")
+
+var (
+	ErrNotFound = apierror.NotFound("webhook subscription not found")
+	ErrInvalid  = apierror.Validation("invalid webhook subscription")
+)
+
+// batchSize caps the deliveries one worker tick claims.
+const batchSize = 20
+
+const subColumns = `id,name,url,events,active,created_by,created_at`
+
+// Service manages partner subscriptions and delivers events to them.
+//
+// Events are written to webhook_deliveries as they are consumed and sent by a
+// worker, so retries survive restarts and every attempt can be inspected.
+type Service struct {
+	db     *pgxpool.Pool
+	client *http.Client
+	cfg    config.Webhooks
+}
+
+// NewService creates a webhook service.
+func NewService(db *pgxpool.Pool, cfg config.Webhooks) *Service {
+	return &Service{db: db, client: webhook.NewClient(cfg.Timeout), cfg: cfg}
+}
+
+// Create registers a subscription and returns it with its new secret.
+func (s *Service) Create(ctx context.Context, actorID string, req SubscriptionRequest) (*Subscription, error) {
+	name, err := checkName(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	url := strings.TrimSpace(req.URL)
+	if err := webhook.ValidURL(url); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	evs, err := checkEvents(req.Events)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+	sub, err := scanSubscription(s.db.QueryRow(ctx,
+		`INSERT INTO webhook_subscriptions (id,name,url,secret,events,created_by) VALUES ($1,$2,$3,$4,$5,$6)
+		 RETURNING `+subColumns,
+		uuid.New().String(), name, url, secret, evs, actorID))
+	if err != nil {
+		return nil, err
+	}
+	sub.Secret = secret
+	return sub, nil
+}
+
+// List returns every subscription, oldest first.
+func (s *Service) List(ctx context.Context) ([]Subscription, error) {
+	rows, err := s.db.Query(ctx,
+		`SELECT `+subColumns+` FROM webhook_subscriptions WHERE deleted_at IS NULL ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	subs := []Subscription{}
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, *sub)
+	}
+	return subs, rows.Err()
+}
+
+// Get returns one subscription.
+func (s *Service) Get(ctx context.Context, id string) (*Subscription, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+	sub, err := scanSubscription(s.db.QueryRow(ctx,
+		`SELECT `+subColumns+` FROM webhook_subscriptions WHERE id=$1 AND deleted_at IS NULL`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return sub, err
+}
+
+// Update changes the fields set in upd. Pausing (active=false) holds pending
+// deliveries until the subscription is resumed.
+func (s *Service) Update(ctx context.Context, id string, upd SubscriptionUpdate) (*Subscription, error) {
+	sub, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if upd.Name != nil {
+		if sub.Name, err = checkName(*upd.Name); err != nil {
+			return nil, err
+		}
+	}
+	if upd.URL != nil {
+		sub.URL = strings.TrimSpace(*upd.URL)
+		if err := webhook.ValidURL(sub.URL); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+	}
+	if upd.Events != nil {
+		if sub.Events, err = checkEvents(upd.Events); err != nil {
+			return nil, err
+		}
+	}
+	if upd.Active != nil {
+		sub.Active = *upd.Active
+	}
+	sub, err = scanSubscription(s.db.QueryRow(ctx,
+		`UPDATE webhook_subscriptions SET name=$2, url=$3, events=$4, active=$5
+		 WHERE id=$1 AND deleted_at IS NULL RETURNING `+subColumns,
+		id, sub.Name, sub.URL, sub.Events, sub.Active))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return sub, err
+}
+
+// RotateSecret replaces the signing secret and returns the new one. The old
+// secret stops working at once.
+func (s *Service) RotateSecret(ctx context.Context, id string) (*Subscription, error) {
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, ErrNotFound
+	}
+	secret, err := newSecret()
+	if err != nil {
+		return nil, err
+	}
+	sub, err := scanSubscription(s.db.QueryRow(ctx,
+		`UPDATE webhook_subscriptions SET secret=$2 WHERE id=$1 AND deleted_at IS NULL RETURNING `+subColumns, id, secret))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	sub.Secret = secret
+	return sub, nil
+}
+
+// Delete removes a subscription and fails its pending deliveries. Its
+// delivery log is kept.
+func (s *Service) Delete(ctx context.Context, id string) error {
+	if _, err := uuid.Parse(id); err != nil {
+		return ErrNotFound
+	}
+	tag, err := s.db.Exec(ctx,
+		`UPDATE webhook_subscriptions SET deleted_at=NOW(), active=FALSE WHERE id=$1 AND deleted_at IS NULL`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	_, err = s.db.Exec(ctx,
+		`UPDATE webhook_deliveries SET status=$2, last_error='subscription deleted'
+		 WHERE subscription_id=$1 AND status=$3`, id, StatusFailed, StatusPending)
+	return err
+}
+
+// Deliveries returns one page of a subscription's delivery log, newest first,
+// optionally only those with status.
+func (s *Service) Deliveries(ctx context.Context, id, status string, limit, offset int) (*DeliveryPage, error) {
+	if _, err := s.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	switch status {
+	case "", StatusPending, StatusSucceeded, StatusFailed:
+	default:
+		return nil, fmt.Errorf("%w: status must be pending, succeeded or failed", ErrInvalid)
+	}
+	page := &DeliveryPage{Deliveries: []Delivery{}, Limit: limit, Offset: offset}
+	if err := s.db.QueryRow(ctx,
+		`SELECT COUNT(*) FROM webhook_deliveries WHERE subscription_id=$1 AND ($2='' OR status=$2)`,
+		id, status).Scan(&page.Total); err != nil {
+		return nil, err
+	}
+	rows, err := s.db.Query(ctx,
+		`SELECT id,subscription_id,event,event_id,payload,status,attempts,response_code,last_error,next_attempt_at,created_at,delivered_at
+		 FROM webhook_deliveries WHERE subscription_id=$1 AND ($2='' OR status=$2)
+		 ORDER BY created_at DESC, id LIMIT $3 OFFSET $4`,
+		id, status, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var d Delivery
+		var payload []byte
+		var next time.Time
+		if err := rows.Scan(&d.ID, &d.SubscriptionID, &d.Event, &d.EventID, &payload, &d.Status, &d.Attempts,
+			&d.ResponseCode, &d.LastError, &next, &d.CreatedAt, &d.DeliveredAt); err != nil {
+			return nil, err
+		}
+		d.Payload = payload
+		if d.Status == StatusPending {
+			d.NextAttemptAt = &next
+		}
+		page.Deliveries = append(page.Deliveries, d)
+	}
+	return page, rows.Err()
+}
+
+// Redeliver queues a delivery again with a fresh set of attempts, e.g. after
+// the partner fixed their endpoint.
+func (s *Service) Redeliver(ctx context.Context, id, deliveryID string) error {
+	if _, err := s.Get(ctx, id); err != nil {
+		return err
+	}
+	if _, err := uuid.Parse(deliveryID); err != nil {
+		return ErrNotFound
+	}
+	tag, err := s.db.Exec(ctx,
+		`UPDATE webhook_deliveries SET status=$3, attempts=0, next_attempt_at=NOW(), last_error=''
+		 WHERE d.id=$2 AND d.subscription_id=$1`,
+		id, deliveryID, StatusPending)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Start consumes the subscribable topics and queues a delivery for every
+// active subscription to each event. Queueing is best effort: a failure is
+// logged rather than returned, since dead-lettering would have the replay
+// re-run matching for every consumer of the topic.
+func (s *Service) Start(ctx context.Context, bus eventbus.Bus) {
+	for _, topic := range Events {
+		topic := topic
+		bus.Subscribe(ctx, topic, "webhooks-"+topic, func(ctx context.Context, data []byte) error {
+			if err := s.enqueue(ctx, topic, data); err != nil {
+				logger.Error("queue webhook deliveries failed", "event", topic, "err", err)
+			}
+			return nil
+		})
+	}
+}
+
+func (s *Service) enqueue(ctx context.Context, topic string, data []byte) error {
+	var env events.Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return err
+	}
+	if env.Type == "" && env.Payload == nil {
+		// Published before envelopes: wrap it so partners always get one, with
+		// an ID derived from the payload so redelivery is still deduplicated.
+		sum := sha256.Sum256(data)
+		env = events.Envelope{EventID: hex.EncodeToString(sum[:16]), Type: topic, Version: 1, Payload: data}
+		var err error
+		if data, err = json.Marshal(env); err != nil {
+			return err
+		}
+	}
+	rows, err := s.db.Query(ctx,
+		`SELECT id FROM webhook_subscriptions WHERE active AND deleted_at IS NULL AND $1 = ANY(events)`, topic)
+	if err != nil {
+		return err
+	}
+	ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+	for _, sub := range ids {
+		if _, err := s.db.Exec(ctx,
+			`INSERT INTO webhook_deliveries (id,subscription_id,event,event_id,payload) VALUES ($1,$2,$3,$4,$5)
+			 ON CONFLICT (subscription_id,event_id) DO NOTHING`,
+			uuid.New().String(), sub, topic, env.EventID, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartWorker sends due deliveries every interval until ctx is cancelled.
+// Several instances can run at once: each claims its own rows.
+func (s *Service) StartWorker(ctx context.Context, every time.Duration) {
+	go func() {
+		t := time.NewTicker(every)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				if err := s.deliverDue(ctx); err != nil && ctx.Err() == nil {
+					logger.Error("webhook delivery run failed", "err", err)
+				}
+			}
+		}
+	}()
+}
+
+type claimed struct {
+	id, event, url string
+	secret         []byte
+	payload        []byte
+	attempts       int
+}
+
+// deliverDue claims a batch of due deliveries and sends them. Claiming pushes
+// next_attempt_at past the request timeout, so a crashed worker's rows become
+// due again instead of staying stuck.
+func (s *Service) deliverDue(ctx context.Context) error {
+	rows, err := s.db.Query(ctx,
+		`WITH due AS (
+		   SELECT d.id FROM webhook_deliveries d JOIN webhook_subscriptions s ON s.id=d.subscription_id
+		   WHERE d.status=$1 AND d.next_attempt_at<=NOW() AND s.active AND s.deleted_at IS NULL
+		   ORDER BY d.next_attempt_at LIMIT $2 FOR UPDATE OF d SKIP LOCKED)
+		 UPDATE webhook_deliveries d SET next_attempt_at=$3
+		 FROM due, webhook_subscriptions s
+		 WHERE d.id=due.id AND s.id=d.subscription_id
+		 RETURNING d.id, d.event, d.payload, d.attempts, s.url, s.secret`,
+		StatusPending, batchSize, time.Now().Add(2*s.cfg.Timeout+time.Minute))
+	if err != nil {
+		return err
+	}
+	var batch []claimed
+	for rows.Next() {
+		var c claimed
+		var secret string
+		if err := rows.Scan(&c.id, &c.event, &c.payload, &c.attempts, &c.url, &secret); err != nil {
+			rows.Close()
+			return err
+		}
+		c.secret = []byte(secret)
+		batch = append(batch, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	for _, c := range batch {
+		wg.Add(1)
+		go func(c claimed) {
+			defer wg.Done()
+			s.deliver(context.WithoutCancel(ctx), c)
+		}(c)
+	}
+	wg.Wait()
+	return nil
+}
+
+// deliver makes one attempt and records its outcome.
+func (s *Service) deliver(ctx context.Context, c claimed) {
+	code, err := s.post(ctx, c)
+	attempts := c.attempts + 1
+	if err == nil {
+		_, err = s.db.Exec(ctx,
+			`UPDATE webhook_deliveries SET status=$2, attempts=$3, response_code=$4, last_error='', delivered_at=NOW()
+			 WHERE id=$1`, c.id, StatusSucceeded, attempts, code)
+		if err != nil {
+			logger.Error("record webhook delivery failed", "delivery", c.id, "err", err)
+		}
+		return
+	}
+
+	status, next := StatusPending, time.Now().Add(s.cfg.Backoff<<min(attempts-1, 16))
+	if attempts >= s.cfg.MaxAttempts || errors.Is(err, webhook.ErrNotPublic) || errors.Is(err, webhook.ErrBadURL) {
+		status = StatusFailed
+		logger.Warn("webhook delivery failed", "delivery", c.id, "event", c.event, "attempts", attempts, "err", err)
+	}
+	var respCode *int
+	if code != 0 {
+		respCode = &code
+	}
+	if _, dbErr := s.db.Exec(ctx,
+		`UPDATE webhook_deliveries SET status=$2, attempts=$3, response_code=$4, last_error=$5, next_attempt_at=$6
+		 WHERE id=$1`, c.id, status, attempts, respCode, err.Error(), next); dbErr != nil {
+		logger.Error("record webhook delivery failed", "delivery", c.id, "err", dbErr)
+	}
+}
+
+// post sends the payload, returning the response code (0 without a response)
+// and an error for anything but a 2xx.
+func (s *Service) post(ctx context.Context, c claimed) (int, error) {
+	if err := webhook.ValidURL(c.url); err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(c.payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhook.SignatureHeader, webhook.Sign(c.secret, c.payload))
+	req.Header.Set("X-Ride-Event", c.event)
+	req.Header.Set("X-Ride-Delivery", c.id)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		return resp.StatusCode, fmt.Errorf("HTTP %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+	return resp.StatusCode, nil
+}
+
+func scanSubscription(row pgx.Row) (*Subscription, error) {
+	var sub Subscription
+	if err := row.Scan(&sub.ID, &sub.Name, &sub.URL, &sub.Events, &sub.Active, &sub.CreatedBy, &sub.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+func checkName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 {
+		return "", fmt.Errorf("%w: name is required (at most 100 characters)", ErrInvalid)
+	}
+	return name, nil
+}
+
+// checkEvents validates and deduplicates subscribed events.
+func checkEvents(evs []string) ([]string, error) {
+	var out []string
+	for _, ev := range evs {
+		if !slices.Contains(Events, ev) {
+			return nil, fmt.Errorf("%w: unknown event %q (want one of %s)", ErrInvalid, ev, strings.Join(Events, ", "))
+		}
+		if !slices.Contains(out, ev) {
+			out = append(out, ev)
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("%w: subscribe to at least one event", ErrInvalid)
+	}
+	return out, nil
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
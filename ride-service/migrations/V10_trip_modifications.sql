@@ -0,0 +1,24 @@
+-- Extra stops approved mid-trip, in visiting order: [{"lat":..,"lng":..}, ...]
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS stops JSONB;
+
+-- Rider-initiated route changes awaiting (or past) driver approval.
+CREATE TABLE IF NOT EXISTS trip_modifications (
+    id           UUID PRIMARY KEY,
+    trip_id      UUID        NOT NULL REFERENCES trips(id),
+    requested_by UUID        NOT NULL,
+    drop_lat     DOUBLE PRECISION,          -- new destination, NULL = unchanged
+    drop_lng     DOUBLE PRECISION,
+    stops        JSONB       NOT NULL DEFAULT '[]',
+    status       VARCHAR(10) NOT NULL DEFAULT 'PENDING', -- PENDING | APPROVED | REJECTED | EXPIRED
+    expires_at   TIMESTAMPTZ NOT NULL,
+    decided_at   TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_trip_modifications_trip_id ON trip_modifications(trip_id);
+
+-- At most one open request per trip; also serves the expiry sweep.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_trip_modifications_pending
+    ON trip_modifications(trip_id) WHERE status = 'PENDING';
+CREATE INDEX IF NOT EXISTS idx_trip_modifications_expiry
+    ON trip_modifications(expires_at) WHERE status = 'PENDING';
@@ -0,0 +1,13 @@
+-- Admin-managed banners for the public status page. NULL city means all cities.
+CREATE TABLE IF NOT EXISTS status_incidents (
+    id          UUID PRIMARY KEY,
+    city        VARCHAR(100),
+    message     VARCHAR(500) NOT NULL,
+    severity    VARCHAR(10)  NOT NULL,  -- info | degraded | outage
+    created_by  UUID         NOT NULL,
+    created_at  TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    resolved_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_status_incidents_active
+    ON status_incidents(created_at) WHERE resolved_at IS NULL;
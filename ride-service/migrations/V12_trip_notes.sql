@@ -0,0 +1,13 @@
+-- Staff annotations on trips, full-text indexed for /admin/search.
+CREATE TABLE IF NOT EXISTS trip_notes (
+    id          UUID PRIMARY KEY,
+    trip_id     UUID         NOT NULL REFERENCES trips(id),
+    author_id   UUID         NOT NULL,
+    visibility  VARCHAR(10)  NOT NULL DEFAULT 'support',  -- support | admin
+    body        TEXT         NOT NULL,
+    created_at  TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    search      TSVECTOR GENERATED ALWAYS AS (to_tsvector('english', body)) STORED
+);
+
+CREATE INDEX IF NOT EXISTS idx_trip_notes_trip_id ON trip_notes(trip_id);
+CREATE INDEX IF NOT EXISTS idx_trip_notes_search  ON trip_notes USING GIN (search);
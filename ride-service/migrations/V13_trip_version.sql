@@ -0,0 +1,3 @@
+-- Optimistic concurrency: every trip state change bumps version, and writers
+-- must present the version they read.
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
@@ -0,0 +1,9 @@
+-- City and indexes backing GET /drivers (admin console / support tooling).
+ALTER TABLE drivers ADD COLUMN IF NOT EXISTS city VARCHAR(100);
+
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS idx_drivers_city         ON drivers(lower(city));
+CREATE INDEX IF NOT EXISTS idx_drivers_vehicle_type ON drivers(vehicle_type);
+CREATE INDEX IF NOT EXISTS idx_drivers_name_trgm    ON drivers USING GIN (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS idx_drivers_plate_trgm   ON drivers USING GIN (license_plate gin_trgm_ops);
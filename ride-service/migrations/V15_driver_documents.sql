@@ -0,0 +1,22 @@
+-- Driver documents and the verification they unlock.
+CREATE TABLE IF NOT EXISTS driver_documents (
+    id            UUID PRIMARY KEY,
+    driver_id     UUID         NOT NULL REFERENCES drivers(id),
+    kind          VARCHAR(20)  NOT NULL,                     -- license | registration | insurance
+    status        VARCHAR(20)  NOT NULL DEFAULT 'pending',   -- pending | approved | rejected | superseded
+    blob_key      VARCHAR(255) NOT NULL,
+    content_type  VARCHAR(50)  NOT NULL,
+    size_bytes    BIGINT       NOT NULL,
+    reject_reason TEXT,
+    reviewed_by   UUID,
+    uploaded_at   TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    reviewed_at   TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_driver_documents_driver  ON driver_documents(driver_id, kind);
+CREATE INDEX IF NOT EXISTS idx_driver_documents_pending ON driver_documents(uploaded_at) WHERE status = 'pending';
+
+ALTER TABLE drivers ADD COLUMN IF NOT EXISTS verified_at TIMESTAMPTZ;
+
+-- Drivers onboarded before document review existed keep driving.
+UPDATE drivers SET verified_at = created_at WHERE verified_at IS NULL;
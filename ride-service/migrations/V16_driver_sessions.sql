@@ -0,0 +1,13 @@
+-- Online sessions: one row per go-online … go-offline span.
+CREATE TABLE IF NOT EXISTS driver_sessions (
+    id               UUID PRIMARY KEY,
+    driver_id        UUID         NOT NULL REFERENCES drivers(id),
+    started_at       TIMESTAMPTZ  NOT NULL,
+    continuous_since TIMESTAMPTZ  NOT NULL,  -- start of the run of sessions without a full break
+    ended_at         TIMESTAMPTZ,
+    end_reason       VARCHAR(20)             -- driver | max_continuous
+);
+
+-- At most one open session per driver.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_driver_sessions_open    ON driver_sessions(driver_id) WHERE ended_at IS NULL;
+CREATE INDEX        IF NOT EXISTS idx_driver_sessions_started ON driver_sessions(driver_id, started_at);
@@ -0,0 +1,14 @@
+-- Offers: one row per assignment of a trip to a driver, and how the driver
+-- answered it. Drivers' acceptance and cancellation rates are computed from it.
+CREATE TABLE IF NOT EXISTS driver_offers (
+    id           UUID PRIMARY KEY,
+    trip_id      UUID         NOT NULL REFERENCES trips(id),
+    driver_id    UUID         NOT NULL REFERENCES drivers(id),
+    status       VARCHAR(20)  NOT NULL DEFAULT 'pending',  -- pending | accepted | declined | cancelled
+    offered_at   TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    responded_at TIMESTAMPTZ,
+    cancelled_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_driver_offers_driver ON driver_offers(driver_id, offered_at);
+CREATE INDEX IF NOT EXISTS idx_driver_offers_trip   ON driver_offers(trip_id);
@@ -0,0 +1,7 @@
+-- Riders may ask for a vehicle type; the matcher scores drivers on it.
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS vehicle_type VARCHAR(50);
+
+-- Finds a driver's last completed trip, for the matcher's idle-time score.
+CREATE INDEX IF NOT EXISTS idx_trips_completed_driver
+    ON trips(driver_id, completed_at)
+    WHERE status = 'COMPLETED';
@@ -0,0 +1,3 @@
+-- Deactivated accounts keep their row (and their trips) until restored.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE drivers ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
@@ -0,0 +1,27 @@
+-- Append-only record of sensitive changes for compliance reviews.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id           UUID PRIMARY KEY,
+    actor_id     VARCHAR(64)  NOT NULL,  -- user id, or 'system'
+    actor_role   VARCHAR(20)  NOT NULL DEFAULT '',
+    action       VARCHAR(100) NOT NULL,  -- e.g. user.deactivate, trip.assign, admin:POST /admin/...
+    target_type  VARCHAR(20)  NOT NULL DEFAULT '',
+    target_id    VARCHAR(100) NOT NULL DEFAULT '',
+    before       JSONB,
+    after        JSONB,
+    created_at   TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_created ON audit_log(created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_actor   ON audit_log(actor_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_log_target  ON audit_log(target_type, target_id, created_at);
+
+-- Rows can only be added.
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log;
+CREATE TRIGGER audit_log_append_only BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
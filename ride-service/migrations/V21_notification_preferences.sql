@@ -0,0 +1,11 @@
+-- Per-account notification settings, one row per channel the account has
+-- changed. Accounts are riders or drivers, so there is no foreign key.
+CREATE TABLE IF NOT EXISTS notification_preferences (
+    user_id     UUID         NOT NULL,
+    channel     VARCHAR(20)  NOT NULL,             -- push | sms | email | webhook
+    enabled     BOOLEAN      NOT NULL,
+    address     TEXT         NOT NULL DEFAULT '',  -- FCM token or webhook URL; empty uses the account email/phone
+    events      TEXT[]       NOT NULL DEFAULT '{}', -- empty: every event
+    updated_at  TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, channel)
+);
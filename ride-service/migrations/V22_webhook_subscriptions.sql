@@ -0,0 +1,31 @@
+-- Partner webhook subscriptions and their delivery log.
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id          UUID PRIMARY KEY,
+    name        VARCHAR(100) NOT NULL,           -- partner, for operators
+    url         TEXT         NOT NULL,
+    secret      TEXT         NOT NULL,           -- HMAC key, shown to the partner once
+    events      TEXT[]       NOT NULL,           -- Kafka topics, e.g. trip.completed
+    active      BOOLEAN      NOT NULL DEFAULT TRUE,
+    created_by  VARCHAR(64)  NOT NULL,
+    created_at  TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    deleted_at  TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id               UUID PRIMARY KEY,
+    subscription_id  UUID         NOT NULL REFERENCES webhook_subscriptions(id),
+    event            VARCHAR(50)  NOT NULL,
+    event_id         VARCHAR(64)  NOT NULL,
+    payload          JSONB        NOT NULL,      -- the event envelope, sent as the body
+    status           VARCHAR(20)  NOT NULL DEFAULT 'pending', -- pending | succeeded | failed
+    attempts         INT          NOT NULL DEFAULT 0,
+    response_code    INT,                        -- of the last attempt
+    last_error       TEXT         NOT NULL DEFAULT '',
+    next_attempt_at  TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    created_at       TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    delivered_at     TIMESTAMPTZ,
+    UNIQUE (subscription_id, event_id)           -- Kafka redelivery does not duplicate
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_sub ON webhook_deliveries(subscription_id, created_at);
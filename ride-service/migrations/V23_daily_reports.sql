@@ -0,0 +1,21 @@
+-- Daily rollups for GET /admin/reports/daily, kept up to date from Kafka.
+-- Trips are attributed to the city of their driver.
+CREATE TABLE IF NOT EXISTS daily_trip_stats (
+    day                     DATE          NOT NULL,  -- UTC
+    city                    VARCHAR(100)  NOT NULL,  -- 'unknown' for drivers without a city
+    trips_matched           INT           NOT NULL DEFAULT 0,  -- first match per trip, by match day
+    trips_completed         INT           NOT NULL DEFAULT 0,  -- by completion day
+    revenue                 NUMERIC(14,2) NOT NULL DEFAULT 0,
+    total_wait_seconds      BIGINT        NOT NULL DEFAULT 0,  -- requested → started, completed trips
+    wait_samples            INT           NOT NULL DEFAULT 0,
+    total_duration_seconds  BIGINT        NOT NULL DEFAULT 0,
+    updated_at              TIMESTAMPTZ   NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (day, city)
+);
+
+-- Trips already counted, so redelivered and replayed events are not counted twice.
+CREATE TABLE IF NOT EXISTS report_trip_events (
+    trip_id  UUID         NOT NULL,
+    kind     VARCHAR(20)  NOT NULL,  -- matched | completed
+    PRIMARY KEY (trip_id, kind)
+);
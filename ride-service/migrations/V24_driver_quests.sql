@@ -0,0 +1,52 @@
+-- Driver wallet ledger. The balance is the sum of a driver's entries; each
+-- (kind, reference) is credited at most once.
+CREATE TABLE IF NOT EXISTS driver_wallet_entries (
+    id           UUID PRIMARY KEY,
+    driver_id    UUID          NOT NULL REFERENCES drivers(id),
+    amount       DECIMAL(12,2) NOT NULL,
+    kind         VARCHAR(30)   NOT NULL,           -- quest_bonus
+    reference    VARCHAR(100)  NOT NULL,           -- what was paid for, e.g. <quest id>:<driver id>
+    description  TEXT          NOT NULL DEFAULT '',
+    created_at   TIMESTAMPTZ   NOT NULL DEFAULT NOW(),
+    UNIQUE (kind, reference)
+);
+
+CREATE INDEX IF NOT EXISTS idx_wallet_entries_driver ON driver_wallet_entries(driver_id, created_at DESC);
+
+-- Incentive quests: complete trips_required trips between starts_at and
+-- ends_at for a bonus. Empty city / vehicle_type apply to every driver.
+CREATE TABLE IF NOT EXISTS quests (
+    id              UUID PRIMARY KEY,
+    name            VARCHAR(100)  NOT NULL,
+    description     TEXT          NOT NULL DEFAULT '',
+    city            VARCHAR(100)  NOT NULL DEFAULT '',
+    vehicle_type    VARCHAR(50)   NOT NULL DEFAULT '',
+    trips_required  INT           NOT NULL,
+    bonus           DECIMAL(12,2) NOT NULL,
+    starts_at       TIMESTAMPTZ   NOT NULL,
+    ends_at         TIMESTAMPTZ   NOT NULL,
+    active          BOOLEAN       NOT NULL DEFAULT TRUE,
+    created_by      VARCHAR(64)   NOT NULL,
+    created_at      TIMESTAMPTZ   NOT NULL DEFAULT NOW(),
+    deleted_at      TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_quests_window ON quests(ends_at) WHERE deleted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS quest_progress (
+    quest_id      UUID         NOT NULL REFERENCES quests(id),
+    driver_id     UUID         NOT NULL REFERENCES drivers(id),
+    trips         INT          NOT NULL DEFAULT 0,
+    completed_at  TIMESTAMPTZ,                     -- set when the bonus is credited
+    updated_at    TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (quest_id, driver_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_quest_progress_driver ON quest_progress(driver_id);
+
+-- Trips already counted towards a quest, so redelivered events count once.
+CREATE TABLE IF NOT EXISTS quest_trips (
+    quest_id  UUID  NOT NULL REFERENCES quests(id),
+    trip_id   UUID  NOT NULL,
+    PRIMARY KEY (quest_id, trip_id)
+);
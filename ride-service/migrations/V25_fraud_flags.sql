@@ -0,0 +1,21 @@
+-- Fraud rule hits awaiting review. dedupe_key makes each finding one row:
+-- per trip for trip rules, per account (or pair) and UTC day otherwise.
+CREATE TABLE IF NOT EXISTS fraud_flags (
+    id            UUID PRIMARY KEY,
+    rule          VARCHAR(30)  NOT NULL,           -- teleport | collusion | cancellations | fare
+    subject_type  VARCHAR(10)  NOT NULL,           -- trip | driver | rider
+    subject_id    UUID         NOT NULL,
+    trip_id       UUID,
+    driver_id     UUID,
+    rider_id      UUID,
+    details       JSONB        NOT NULL DEFAULT '{}',
+    dedupe_key    VARCHAR(200) NOT NULL UNIQUE,
+    status        VARCHAR(20)  NOT NULL DEFAULT 'open', -- open | confirmed | dismissed
+    reviewed_by   VARCHAR(64),
+    review_note   TEXT,
+    created_at    TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    reviewed_at   TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_fraud_flags_queue   ON fraud_flags(status, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_fraud_flags_subject ON fraud_flags(subject_type, subject_id);
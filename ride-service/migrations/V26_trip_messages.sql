@@ -0,0 +1,13 @@
+-- Rider-driver chat on a trip. Messages are deleted after
+-- TRIP_CHAT_RETENTION.
+CREATE TABLE IF NOT EXISTS trip_messages (
+    id           UUID PRIMARY KEY,
+    trip_id      UUID         NOT NULL REFERENCES trips(id),
+    sender_id    UUID         NOT NULL,
+    sender_role  VARCHAR(10)  NOT NULL,            -- rider | driver
+    body         TEXT         NOT NULL,
+    sent_at      TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_trip_messages_trip ON trip_messages(trip_id, sent_at);
+CREATE INDEX IF NOT EXISTS idx_trip_messages_sent ON trip_messages(sent_at);
@@ -0,0 +1,17 @@
+-- Items riders report left in the car after a trip, and the driver's answer.
+CREATE TABLE IF NOT EXISTS lost_items (
+    id           UUID PRIMARY KEY,
+    trip_id      UUID         NOT NULL REFERENCES trips(id),
+    rider_id     UUID         NOT NULL,
+    driver_id    UUID         NOT NULL,
+    description  TEXT         NOT NULL,
+    status       VARCHAR(20)  NOT NULL DEFAULT 'reported', -- reported | found | not_found | returned
+    driver_note  TEXT,
+    reported_at  TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    found_at     TIMESTAMPTZ,
+    closed_at    TIMESTAMPTZ                               -- set on not_found or returned
+);
+
+CREATE INDEX IF NOT EXISTS idx_lost_items_trip   ON lost_items(trip_id);
+CREATE INDEX IF NOT EXISTS idx_lost_items_driver ON lost_items(driver_id, status);
+CREATE INDEX IF NOT EXISTS idx_lost_items_status ON lost_items(status, reported_at DESC);
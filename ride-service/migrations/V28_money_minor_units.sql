@@ -0,0 +1,27 @@
+-- Amounts move to integer minor units with their currency (pkg/money).
+-- The DECIMAL columns are still written for readers on the previous release
+-- and are dropped in a later one. Everything priced before this was in rupees.
+-- migrate:no-transaction
+ALTER TABLE trips                 ADD COLUMN IF NOT EXISTS fare_minor    BIGINT;
+ALTER TABLE trips                 ADD COLUMN IF NOT EXISTS currency      VARCHAR(3);
+ALTER TABLE driver_wallet_entries ADD COLUMN IF NOT EXISTS amount_minor  BIGINT;
+ALTER TABLE driver_wallet_entries ADD COLUMN IF NOT EXISTS currency      VARCHAR(3);
+ALTER TABLE quests                ADD COLUMN IF NOT EXISTS bonus_minor   BIGINT;
+ALTER TABLE quests                ADD COLUMN IF NOT EXISTS currency      VARCHAR(3);
+ALTER TABLE daily_trip_stats      ADD COLUMN IF NOT EXISTS revenue_minor BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE daily_trip_stats      ADD COLUMN IF NOT EXISTS currency      VARCHAR(3);  -- NULL until a trip completes
+
+-- migrate:backfill batch=5000 pause=50ms
+UPDATE trips SET fare_minor = ROUND(fare * 100)::bigint, currency = 'INR'
+WHERE id IN (SELECT id FROM trips WHERE fare IS NOT NULL AND fare_minor IS NULL LIMIT $1);
+
+-- migrate:backfill batch=5000 pause=50ms
+UPDATE driver_wallet_entries SET amount_minor = ROUND(amount * 100)::bigint, currency = 'INR'
+WHERE id IN (SELECT id FROM driver_wallet_entries WHERE amount_minor IS NULL LIMIT $1);
+
+-- migrate:backfill batch=5000 pause=50ms
+UPDATE quests SET bonus_minor = ROUND(bonus * 100)::bigint, currency = 'INR'
+WHERE id IN (SELECT id FROM quests WHERE bonus_minor IS NULL LIMIT $1);
+
+UPDATE daily_trip_stats SET revenue_minor = ROUND(revenue * 100)::bigint, currency = 'INR'
+WHERE trips_completed > 0 AND currency IS NULL;
@@ -0,0 +1,23 @@
+-- Tax invoices for completed trips, numbered per tax jurisdiction.
+CREATE TABLE IF NOT EXISTS invoice_series (
+    jurisdiction VARCHAR(50) PRIMARY KEY,
+    last_number  BIGINT      NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS invoices (
+    id           UUID PRIMARY KEY,
+    trip_id      UUID         NOT NULL UNIQUE REFERENCES trips(id),
+    rider_id     UUID         NOT NULL,
+    driver_id    UUID         NOT NULL,
+    jurisdiction VARCHAR(50)  NOT NULL,
+    seq          BIGINT       NOT NULL,
+    number       VARCHAR(80)  NOT NULL UNIQUE,
+    currency     VARCHAR(3)   NOT NULL,
+    total_minor  BIGINT       NOT NULL,                 -- fare, tax included
+    net_minor    BIGINT       NOT NULL,
+    taxes        JSONB        NOT NULL DEFAULT '[]',    -- [{name, rate, amount}]
+    issued_at    TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    UNIQUE (jurisdiction, seq)
+);
+
+CREATE INDEX IF NOT EXISTS idx_invoices_driver ON invoices(driver_id, issued_at);
@@ -0,0 +1,25 @@
+-- Co-riders invited to split a trip's fare, and what each rider is charged.
+CREATE TABLE IF NOT EXISTS split_participants (
+    trip_id      UUID         NOT NULL REFERENCES trips(id),
+    rider_id     UUID         NOT NULL REFERENCES users(id),
+    status       VARCHAR(20)  NOT NULL DEFAULT 'invited', -- invited | accepted | declined
+    invited_at   TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    responded_at TIMESTAMPTZ,
+    PRIMARY KEY (trip_id, rider_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_split_participants_rider ON split_participants(rider_id, status);
+
+CREATE TABLE IF NOT EXISTS rider_charges (
+    id           UUID PRIMARY KEY,
+    trip_id      UUID         NOT NULL REFERENCES trips(id),
+    rider_id     UUID         NOT NULL,
+    amount_minor BIGINT       NOT NULL,
+    currency     VARCHAR(3)   NOT NULL,
+    split_ways   INT          NOT NULL DEFAULT 1,
+    status       VARCHAR(20)  NOT NULL DEFAULT 'due',     -- due | charged | failed
+    error        TEXT,                                    -- the gateway's last error
+    created_at   TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    charged_at   TIMESTAMPTZ,
+    UNIQUE (trip_id, rider_id)
+);
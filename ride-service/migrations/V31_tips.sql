@@ -0,0 +1,15 @@
+-- Riders' tips to drivers after a trip, one per trip. The driver's share
+-- (all of it) is a wallet entry of kind 'tip'.
+CREATE TABLE IF NOT EXISTS trip_tips (
+    trip_id      UUID PRIMARY KEY REFERENCES trips(id),
+    rider_id     UUID         NOT NULL,
+    driver_id    UUID         NOT NULL,
+    amount_minor BIGINT       NOT NULL CHECK (amount_minor > 0),
+    currency     VARCHAR(3)   NOT NULL,
+    created_at   TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+-- A rider is charged for a tip separately from their share of the fare.
+ALTER TABLE rider_charges ADD COLUMN IF NOT EXISTS kind VARCHAR(20) NOT NULL DEFAULT 'fare'; -- fare | tip
+ALTER TABLE rider_charges DROP CONSTRAINT IF EXISTS rider_charges_trip_id_rider_id_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_rider_charges_kind ON rider_charges(trip_id, rider_id, kind);
@@ -0,0 +1,13 @@
+-- Drivers' preferred working hours and areas, and when they wind down:
+-- near a shift's end or on request, the matcher only offers trips that drop
+-- off inside the home area.
+CREATE TABLE IF NOT EXISTS driver_preferences (
+    driver_id         UUID PRIMARY KEY REFERENCES drivers(id),
+    time_zone         VARCHAR(64)  NOT NULL DEFAULT 'UTC',
+    shifts            JSONB        NOT NULL DEFAULT '[]',
+    areas             JSONB        NOT NULL DEFAULT '[]',
+    home              JSONB,
+    wind_down_minutes INT          NOT NULL DEFAULT 0,
+    go_home           BOOLEAN      NOT NULL DEFAULT false,
+    updated_at        TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,45 @@
+-- Vehicles move out of drivers into their own table: a driver registers any
+-- number of them and picks the active one before going online. Matching and
+-- pricing use the active vehicle.
+CREATE TABLE IF NOT EXISTS vehicles (
+    id            UUID PRIMARY KEY,
+    driver_id     UUID         NOT NULL REFERENCES drivers(id),
+    type          VARCHAR(50)  NOT NULL DEFAULT 'sedan',
+    capacity      INT          NOT NULL DEFAULT 4 CHECK (capacity > 0),
+    plate         VARCHAR(20)  NOT NULL DEFAULT '',
+    year          INT,
+    model         VARCHAR(100) NOT NULL DEFAULT '',
+    color         VARCHAR(50)  NOT NULL DEFAULT '',
+    accessibility TEXT[]       NOT NULL DEFAULT '{}', -- wheelchair, child_seat, ...
+    photo_key     VARCHAR(255),
+    created_at    TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_vehicles_driver     ON vehicles(driver_id);
+CREATE INDEX IF NOT EXISTS idx_vehicles_type       ON vehicles(type);
+CREATE INDEX IF NOT EXISTS idx_vehicles_plate_trgm ON vehicles USING GIN (plate gin_trgm_ops);
+
+ALTER TABLE drivers ADD COLUMN IF NOT EXISTS active_vehicle_id UUID REFERENCES vehicles(id);
+
+-- Every existing driver keeps the vehicle they registered, as the active one.
+INSERT INTO vehicles (id, driver_id, type, plate, model, color, photo_key, created_at)
+SELECT gen_random_uuid(), id, COALESCE(vehicle_type, 'sedan'), COALESCE(license_plate, ''),
+       COALESCE(vehicle_model, ''), COALESCE(vehicle_color, ''), vehicle_photo_key, created_at
+FROM drivers WHERE active_vehicle_id IS NULL;
+
+UPDATE drivers d SET active_vehicle_id = v.id FROM vehicles v
+WHERE v.driver_id = d.id AND d.active_vehicle_id IS NULL;
+
+DROP INDEX IF EXISTS idx_drivers_vehicle_type;
+DROP INDEX IF EXISTS idx_drivers_plate_trgm;
+ALTER TABLE drivers
+    DROP COLUMN IF EXISTS vehicle_type,
+    DROP COLUMN IF EXISTS license_plate,
+    DROP COLUMN IF EXISTS vehicle_model,
+    DROP COLUMN IF EXISTS vehicle_color,
+    DROP COLUMN IF EXISTS vehicle_photo_key;
+
+-- What a trip needs from the vehicle: seats for the riders and any
+-- accessibility features.
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS seats         INT;
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS accessibility TEXT[];
@@ -0,0 +1,14 @@
+-- Child seats and luggage: what a vehicle carries, what a trip asks for, and
+-- the surcharges the fare included for them.
+ALTER TABLE vehicles ADD COLUMN IF NOT EXISTS child_seats    INT NOT NULL DEFAULT 0 CHECK (child_seats >= 0);
+ALTER TABLE vehicles ADD COLUMN IF NOT EXISTS luggage_litres INT NOT NULL DEFAULT 0 CHECK (luggage_litres >= 0);
+
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS child_seats    INT;
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS luggage_litres INT;
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS surcharges     JSONB;
+
+-- child_seat was an accessibility feature; it is a count now.
+UPDATE vehicles SET child_seats = GREATEST(child_seats, 1), accessibility = array_remove(accessibility, 'child_seat')
+WHERE 'child_seat' = ANY(accessibility);
+UPDATE trips SET child_seats = 1, accessibility = array_remove(accessibility, 'child_seat')
+WHERE 'child_seat' = ANY(accessibility);
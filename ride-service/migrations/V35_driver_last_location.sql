@@ -0,0 +1,17 @@
+-- Drivers' last known position in PostgreSQL, for GEO_BACKEND=postgis:
+-- nearby search and the ops map query it instead of Redis. in_pool marks
+-- the drivers matching may pick. Only created where the PostGIS extension
+-- is available, so databases without it still migrate; the postgis backend
+-- refuses to start without the column.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM pg_available_extensions WHERE name = 'postgis') THEN
+        CREATE EXTENSION IF NOT EXISTS postgis;
+        EXECUTE 'ALTER TABLE drivers ADD COLUMN IF NOT EXISTS last_location geography(Point, 4326)';
+        EXECUTE 'ALTER TABLE drivers ADD COLUMN IF NOT EXISTS last_location_at TIMESTAMPTZ';
+        EXECUTE 'ALTER TABLE drivers ADD COLUMN IF NOT EXISTS in_pool BOOLEAN NOT NULL DEFAULT FALSE';
+        EXECUTE 'CREATE INDEX IF NOT EXISTS idx_drivers_last_location ON drivers USING GIST (last_location)';
+        EXECUTE 'CREATE INDEX IF NOT EXISTS idx_drivers_pool_location ON drivers USING GIST (last_location) WHERE in_pool';
+    END IF;
+END
+$$;
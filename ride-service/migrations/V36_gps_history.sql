@@ -0,0 +1,24 @@
+-- Raw driver GPS history lives in the blob store as gzipped batches; this
+-- indexes them so a trip's pings can be found without listing the store.
+CREATE TABLE IF NOT EXISTS gps_batches (
+    id         BIGSERIAL PRIMARY KEY,
+    driver_id  UUID         NOT NULL,
+    day        DATE         NOT NULL,  -- UTC; the blob key is partitioned by it
+    blob_key   VARCHAR(200) NOT NULL UNIQUE,
+    first_at   TIMESTAMPTZ  NOT NULL,
+    last_at    TIMESTAMPTZ  NOT NULL,
+    points     INT          NOT NULL,
+    created_at TIMESTAMPTZ  DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_gps_batches_driver ON gps_batches(driver_id, first_at);
+
+-- Every export is tied to an incident and recorded.
+CREATE TABLE IF NOT EXISTS gps_export_log (
+    id          BIGSERIAL PRIMARY KEY,
+    trip_id     UUID         NOT NULL,
+    admin_id    UUID         NOT NULL,
+    incident_id VARCHAR(100) NOT NULL,
+    points      INT          NOT NULL,
+    exported_at TIMESTAMPTZ  DEFAULT NOW()
+);
@@ -0,0 +1,16 @@
+-- A rider has at most one trip in progress. Riders who already have several
+-- keep the furthest along (then the newest); the rest are cancelled so the
+-- index below can be built.
+WITH ranked AS (
+    SELECT id, row_number() OVER (
+               PARTITION BY rider_id
+               ORDER BY status = 'STARTED' DESC, status = 'DRIVER_ASSIGNED' DESC, created_at DESC) AS n
+    FROM trips
+    WHERE status IN ('REQUESTED', 'MATCHING', 'DRIVER_ASSIGNED', 'STARTED')
+)
+UPDATE trips SET status = 'CANCELLED', version = version + 1
+FROM ranked WHERE trips.id = ranked.id AND ranked.n > 1;
+
+-- Also serves GET /trips/active for riders.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_trips_rider_active
+    ON trips(rider_id) WHERE status IN ('REQUESTED', 'MATCHING', 'DRIVER_ASSIGNED', 'STARTED');
@@ -0,0 +1,22 @@
+-- A driver is on at most one trip at a time. Drivers already holding several
+-- keep the furthest along (then the newest); their other DRIVER_ASSIGNED
+-- trips go back to REQUESTED without a driver, and those offers are
+-- withdrawn, so matching can place them again. A driver with two STARTED
+-- trips needs one resolved by hand before the index below can be built.
+WITH ranked AS (
+    SELECT id, row_number() OVER (
+               PARTITION BY driver_id
+               ORDER BY status = 'STARTED' DESC, created_at DESC) AS n
+    FROM trips
+    WHERE driver_id IS NOT NULL AND status IN ('DRIVER_ASSIGNED', 'STARTED')
+), released AS (
+    UPDATE trips SET status = 'REQUESTED', driver_id = NULL, version = version + 1
+    FROM ranked
+    WHERE trips.id = ranked.id AND ranked.n > 1 AND trips.status = 'DRIVER_ASSIGNED'
+    RETURNING trips.id
+)
+UPDATE driver_offers SET status = 'cancelled', cancelled_at = NOW()
+WHERE trip_id IN (SELECT id FROM released) AND status IN ('pending', 'accepted');
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_trips_driver_active
+    ON trips(driver_id) WHERE status IN ('DRIVER_ASSIGNED', 'STARTED');
@@ -0,0 +1,8 @@
+-- Rider no-shows: the driver reports arriving at the pickup, and after
+-- waiting long enough may cancel the trip, charging the rider a fee (in the
+-- trip's currency).
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS arrived_at        TIMESTAMPTZ;
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS cancelled_at      TIMESTAMPTZ;
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS no_show_fee_minor BIGINT;
+
+-- rider_charges.kind: fare | tip | no_show
@@ -0,0 +1,5 @@
+-- Pausing a started trip while the rider runs an errand: paused_at is when
+-- the current pause began, paused_seconds how long the earlier ones lasted.
+-- Paused time is charged as a "waiting" surcharge when the trip completes.
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS paused_at      TIMESTAMPTZ;
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS paused_seconds BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,27 @@
+-- Riders' disputes of a completed trip's fare, one per trip. Staff resolve
+-- them by adjusting the fare (the trip's fare changes, and the difference is
+-- charged or refunded as an 'adjustment' rider charge) or rejecting them.
+CREATE TABLE IF NOT EXISTS fare_disputes (
+    id                  UUID PRIMARY KEY,
+    trip_id             UUID         NOT NULL UNIQUE REFERENCES trips(id),
+    rider_id            UUID         NOT NULL REFERENCES users(id),
+    driver_id           UUID         NOT NULL,
+    reason              VARCHAR(30)  NOT NULL,
+    comment             TEXT         NOT NULL DEFAULT '',
+    status              VARCHAR(20)  NOT NULL DEFAULT 'open', -- open | adjusted | rejected
+    fare_minor          BIGINT       NOT NULL,                -- when the dispute was filed
+    adjusted_fare_minor BIGINT,
+    currency            VARCHAR(3)   NOT NULL,
+    resolution          TEXT,                                 -- staff note to the rider
+    resolved_by         UUID,
+    created_at          TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    resolved_at         TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_fare_disputes_status ON fare_disputes(status, created_at);
+
+-- An adjusted fare revises the trip's invoice under the same number.
+ALTER TABLE invoices ADD COLUMN IF NOT EXISTS revised_at TIMESTAMPTZ;
+
+-- rider_charges.kind: fare | tip | no_show | adjustment (negative for a refund)
+-- report_trip_events.kind: matched | completed | adjusted
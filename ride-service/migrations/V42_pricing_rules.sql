@@ -0,0 +1,41 @@
+-- Fare formulas and commission move out of configuration into versioned
+-- rules that admins edit at runtime. A change inserts a new version and
+-- retires the one it replaces, so old versions never change and a trip can
+-- always be traced to the rules it was priced with. city '' is the default;
+-- other cities, matched case-insensitively, override it. The service seeds
+-- both tables from its configuration when they are empty.
+CREATE TABLE IF NOT EXISTS pricing_rules (
+    version           BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    city              VARCHAR(100) NOT NULL DEFAULT '',
+    currency          VARCHAR(3)   NOT NULL,
+    base_fare_minor   BIGINT       NOT NULL CHECK (base_fare_minor >= 0),
+    per_km_minor      BIGINT       NOT NULL CHECK (per_km_minor >= 0),
+    child_seat_minor  BIGINT       NOT NULL DEFAULT 0 CHECK (child_seat_minor >= 0),
+    luggage_minor     BIGINT       NOT NULL DEFAULT 0 CHECK (luggage_minor >= 0),
+    no_show_fee_minor BIGINT       NOT NULL DEFAULT 0 CHECK (no_show_fee_minor >= 0),
+    waiting_minor     BIGINT       NOT NULL DEFAULT 0 CHECK (waiting_minor >= 0),
+    created_by        UUID,                                   -- NULL when seeded
+    created_at        TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    retired_at        TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_pricing_rules_current ON pricing_rules(LOWER(city)) WHERE retired_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_pricing_rules_city ON pricing_rules(LOWER(city), version);
+
+CREATE TABLE IF NOT EXISTS commission_rules (
+    version    BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    city       VARCHAR(100) NOT NULL DEFAULT '',
+    rate_bp    INT          NOT NULL CHECK (rate_bp BETWEEN 0 AND 10000), -- hundredths of a percent of the fare
+    created_by UUID,
+    created_at TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    retired_at TIMESTAMPTZ
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_commission_rules_current ON commission_rules(LOWER(city)) WHERE retired_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_commission_rules_city ON commission_rules(LOWER(city), version);
+
+-- The rule versions a trip was priced with, and the platform's cut of its
+-- fare. Trips priced before the rules existed have none.
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS pricing_version    BIGINT REFERENCES pricing_rules(version);
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS commission_version BIGINT REFERENCES commission_rules(version);
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS commission_minor   BIGINT;
@@ -0,0 +1,14 @@
+-- Riders and drivers blocking each other after a trip together. A pair with
+-- a block either way is never matched; blocked_by says which side asked.
+CREATE TABLE IF NOT EXISTS blocks (
+    id         UUID PRIMARY KEY,
+    rider_id   UUID         NOT NULL REFERENCES users(id),
+    driver_id  UUID         NOT NULL REFERENCES drivers(id),
+    blocked_by VARCHAR(10)  NOT NULL, -- rider | driver
+    trip_id    UUID         NOT NULL REFERENCES trips(id),
+    reason     TEXT         NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    UNIQUE (rider_id, driver_id, blocked_by)
+);
+
+CREATE INDEX IF NOT EXISTS idx_blocks_driver ON blocks(driver_id);
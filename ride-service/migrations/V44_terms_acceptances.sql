@@ -0,0 +1,9 @@
+-- Which versions of the terms of service and the privacy policy each rider
+-- and driver accepted, one row per acceptance, kept as the consent record.
+CREATE TABLE IF NOT EXISTS terms_acceptances (
+    account_id  UUID        NOT NULL,  -- users.id or drivers.id
+    document    VARCHAR(10) NOT NULL,  -- terms | privacy
+    version     VARCHAR(20) NOT NULL,
+    accepted_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (account_id, document, version)
+);
@@ -0,0 +1,13 @@
+-- Riders' requests to erase their personal data. Each runs once erase_after
+-- has passed, unless cancelled first: the account is deactivated and its
+-- personal fields are anonymized, while trips, charges and invoices are kept
+-- for accounting.
+CREATE TABLE IF NOT EXISTS erasure_requests (
+    user_id      UUID PRIMARY KEY REFERENCES users(id),
+    requested_by UUID        NOT NULL,              -- the rider or an admin
+    requested_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    erase_after  TIMESTAMPTZ NOT NULL,
+    erased_at    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_erasure_requests_due ON erasure_requests(erase_after) WHERE erased_at IS NULL;
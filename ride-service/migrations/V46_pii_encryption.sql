@@ -0,0 +1,24 @@
+-- Emails and phone numbers are stored encrypted (pkg/pii) in their existing
+-- columns, which grow to hold the ciphertext. Ciphertexts differ each time a
+-- value is sealed, so uniqueness moves to the blind-index columns. Existing
+-- rows stay readable as plaintext until the service's rekeyer seals them and
+-- fills in their indexes; the plain indexes on email and phone serve lookups
+-- of those rows until then.
+ALTER TABLE users   ALTER COLUMN email TYPE TEXT, ALTER COLUMN phone TYPE TEXT;
+ALTER TABLE drivers ALTER COLUMN email TYPE TEXT, ALTER COLUMN phone TYPE TEXT;
+
+ALTER TABLE users   ADD COLUMN IF NOT EXISTS email_idx VARCHAR(64);
+ALTER TABLE users   ADD COLUMN IF NOT EXISTS phone_idx VARCHAR(64);
+ALTER TABLE drivers ADD COLUMN IF NOT EXISTS email_idx VARCHAR(64);
+ALTER TABLE drivers ADD COLUMN IF NOT EXISTS phone_idx VARCHAR(64);
+
+ALTER TABLE users   DROP CONSTRAINT IF EXISTS users_email_key;
+ALTER TABLE users   DROP CONSTRAINT IF EXISTS users_phone_key;
+ALTER TABLE drivers DROP CONSTRAINT IF EXISTS drivers_email_key;
+ALTER TABLE drivers DROP CONSTRAINT IF EXISTS drivers_phone_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_idx_key   ON users(email_idx);
+CREATE UNIQUE INDEX IF NOT EXISTS users_phone_idx_key   ON users(phone_idx);
+CREATE UNIQUE INDEX IF NOT EXISTS drivers_email_idx_key ON drivers(email_idx);
+CREATE UNIQUE INDEX IF NOT EXISTS drivers_phone_idx_key ON drivers(phone_idx);
+CREATE INDEX IF NOT EXISTS idx_drivers_phone ON drivers(phone);
@@ -0,0 +1,20 @@
+-- TOTP two-factor authentication for drivers and staff. A row is created at
+-- enrollment and enabled once the account confirms a code; the secret is
+-- sealed like emails and phone numbers (pkg/pii). last_step is the time step
+-- of the last code accepted, so each code works once.
+CREATE TABLE IF NOT EXISTS two_factor (
+    account_id   UUID        PRIMARY KEY,  -- drivers.id, or users.id of staff
+    account_type VARCHAR(10) NOT NULL,     -- driver | user
+    secret       TEXT        NOT NULL,
+    last_step    BIGINT      NOT NULL DEFAULT 0,
+    enabled_at   TIMESTAMPTZ,              -- NULL until the first code is confirmed
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- One-time backup codes, kept as SHA-256 hashes.
+CREATE TABLE IF NOT EXISTS two_factor_backup_codes (
+    account_id UUID        NOT NULL REFERENCES two_factor(account_id) ON DELETE CASCADE,
+    code_hash  VARCHAR(64) NOT NULL,
+    used_at    TIMESTAMPTZ,
+    PRIMARY KEY (account_id, code_hash)
+);
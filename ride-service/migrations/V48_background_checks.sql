@@ -0,0 +1,25 @@
+-- Driver background checks run by an external vendor, which reports each
+-- change of a check to POST /drivers/:id/background-check/callback.
+-- drivers.background_check is the latest status (not_started | pending |
+-- passed | failed) and background_check_at when the vendor reached it.
+ALTER TABLE drivers ADD COLUMN IF NOT EXISTS background_check    VARCHAR(20) NOT NULL DEFAULT 'not_started';
+ALTER TABLE drivers ADD COLUMN IF NOT EXISTS background_check_at TIMESTAMPTZ;
+
+-- Drivers onboarded before background checks existed keep driving.
+UPDATE drivers SET background_check = 'passed' WHERE background_check = 'not_started' AND background_check_at IS NULL;
+
+-- Every callback received, for the driver's history and so a repeated
+-- callback is recorded once.
+CREATE TABLE IF NOT EXISTS background_check_reports (
+    id          UUID         PRIMARY KEY,
+    driver_id   UUID         NOT NULL REFERENCES drivers(id),
+    vendor      VARCHAR(50)  NOT NULL,
+    reference   VARCHAR(200) NOT NULL,  -- the vendor's ID for the check
+    status      VARCHAR(20)  NOT NULL,
+    reason      TEXT,
+    occurred_at TIMESTAMPTZ  NOT NULL,
+    received_at TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    UNIQUE (vendor, reference, status)
+);
+
+CREATE INDEX IF NOT EXISTS idx_background_check_reports_driver ON background_check_reports (driver_id, occurred_at DESC);
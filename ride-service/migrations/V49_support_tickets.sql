@@ -0,0 +1,47 @@
+-- Support tickets raised by riders and drivers, optionally about a trip,
+-- answered by staff. The SLA due times are fixed when a ticket is opened.
+CREATE TABLE IF NOT EXISTS support_tickets (
+    id                 UUID         PRIMARY KEY,
+    requester_id       UUID         NOT NULL,              -- users.id or drivers.id
+    requester_role     VARCHAR(10)  NOT NULL,              -- rider | driver
+    trip_id            UUID         REFERENCES trips(id),
+    subject            VARCHAR(200) NOT NULL,
+    status             VARCHAR(10)  NOT NULL,              -- open | pending | resolved | closed
+    assignee_id        UUID,                               -- the staff user working on it
+    first_response_due TIMESTAMPTZ  NOT NULL,
+    resolution_due     TIMESTAMPTZ  NOT NULL,
+    first_response_at  TIMESTAMPTZ,
+    resolved_at        TIMESTAMPTZ,
+    created_at         TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    updated_at         TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_support_tickets_requester ON support_tickets (requester_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_support_tickets_status    ON support_tickets (status, created_at);
+
+-- The ticket's thread, full-text indexed for /admin/search like trip notes.
+CREATE TABLE IF NOT EXISTS support_ticket_messages (
+    id          UUID        PRIMARY KEY,
+    ticket_id   UUID        NOT NULL REFERENCES support_tickets(id),
+    author_id   UUID        NOT NULL,
+    author_role VARCHAR(10) NOT NULL,  -- rider | driver | admin | support
+    body        TEXT        NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    search      TSVECTOR GENERATED ALWAYS AS (to_tsvector('english', body)) STORED
+);
+
+CREATE INDEX IF NOT EXISTS idx_support_ticket_messages_ticket ON support_ticket_messages (ticket_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_support_ticket_messages_search ON support_ticket_messages USING GIN (search);
+
+-- Files attached to a ticket; the content is in the blob store.
+CREATE TABLE IF NOT EXISTS support_ticket_attachments (
+    id           UUID         PRIMARY KEY,
+    ticket_id    UUID         NOT NULL REFERENCES support_tickets(id),
+    uploader_id  UUID         NOT NULL,
+    blob_key     VARCHAR(300) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size_bytes   BIGINT       NOT NULL,
+    created_at   TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_support_ticket_attachments_ticket ON support_ticket_attachments (ticket_id, created_at);
@@ -0,0 +1,2 @@
+-- Riders are the default; ops staff are promoted to 'admin' out of band.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'rider';
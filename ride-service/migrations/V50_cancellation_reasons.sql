@@ -0,0 +1,26 @@
+-- Who cancelled a trip and why (PATCH /trips/:id/cancel, no-shows, no driver
+-- found). Set on CANCELLED trips only: a driver withdrawing sends the trip
+-- back to matching, so their reason lives in report_cancellations alone.
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS cancelled_by  VARCHAR(10);  -- rider | driver | system
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS cancel_reason VARCHAR(30);
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS cancel_note   TEXT;
+
+-- Trips cancelled before reasons were kept were no-shows (they keep their
+-- driver) or found no driver.
+UPDATE trips SET cancelled_by  = CASE WHEN driver_id IS NULL THEN 'system' ELSE 'driver' END,
+                 cancel_reason = CASE WHEN driver_id IS NULL THEN 'no_driver' ELSE 'rider_no_show' END
+WHERE status = 'CANCELLED' AND cancelled_by IS NULL;
+
+-- Every cancellation for GET /admin/reports/cancellations, kept up to date
+-- from trip.cancelled. Keyed by event so redelivered events count once.
+CREATE TABLE IF NOT EXISTS report_cancellations (
+    event_id    VARCHAR(64)   PRIMARY KEY,
+    trip_id     UUID          NOT NULL,
+    day         DATE          NOT NULL,  -- UTC
+    city        VARCHAR(100)  NOT NULL,  -- of the driver, or the last one offered the trip; 'unknown' without
+    actor       VARCHAR(10)   NOT NULL,  -- rider | driver | system
+    reason      VARCHAR(30)   NOT NULL,
+    note        TEXT,
+    created_at  TIMESTAMPTZ   NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_report_cancellations_day ON report_cancellations (day, city);
@@ -0,0 +1,34 @@
+-- Fare quotes issued by POST /fares/estimate. A trip requested with an
+-- unexpired quote is priced at the quoted rate, whatever the fare rules are
+-- by the time it completes. signature is an HMAC over the price terms, so a
+-- quote changed in the database is refused.
+CREATE TABLE IF NOT EXISTS fare_quotes (
+    id                 UUID          PRIMARY KEY,
+    rider_id           UUID          NOT NULL REFERENCES users(id),
+    city               VARCHAR(100)  NOT NULL DEFAULT '',  -- '' priced with the default rule
+    vehicle_type       VARCHAR(50)   NOT NULL DEFAULT '',
+    pickup_lat         DOUBLE PRECISION NOT NULL,
+    pickup_lng         DOUBLE PRECISION NOT NULL,
+    drop_lat           DOUBLE PRECISION NOT NULL,
+    drop_lng           DOUBLE PRECISION NOT NULL,
+    child_seats        INT           NOT NULL DEFAULT 0,
+    luggage_litres     INT           NOT NULL DEFAULT 0,
+    distance_km        DOUBLE PRECISION NOT NULL,
+    pricing_version    BIGINT        NOT NULL,
+    currency           VARCHAR(3)    NOT NULL,
+    base_fare_minor    BIGINT        NOT NULL,
+    per_km_minor       BIGINT        NOT NULL,
+    child_seat_minor   BIGINT        NOT NULL,
+    luggage_minor      BIGINT        NOT NULL,
+    no_show_fee_minor  BIGINT        NOT NULL,
+    waiting_minor      BIGINT        NOT NULL,
+    estimate_minor     BIGINT        NOT NULL,
+    signature          VARCHAR(64)   NOT NULL,
+    expires_at         TIMESTAMPTZ   NOT NULL,
+    trip_id            UUID          UNIQUE,  -- the trip that used it; a quote is used once
+    created_at         TIMESTAMPTZ   NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_fare_quotes_rider ON fare_quotes (rider_id, created_at DESC);
+
+-- The quote a trip was requested with, for audit.
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS quote_id UUID REFERENCES fare_quotes(id);
@@ -0,0 +1,10 @@
+-- Chained dispatch: a driver finishing a trip near a new pickup can be
+-- assigned it before dropping off, so a driver may now hold one STARTED trip
+-- and one DRIVER_ASSIGNED trip, the one they drive to next. Each status is
+-- still one per driver, and the next trip cannot start before the current
+-- one ends.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_trips_driver_assigned
+    ON trips(driver_id) WHERE status = 'DRIVER_ASSIGNED';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_trips_driver_started
+    ON trips(driver_id) WHERE status = 'STARTED';
+DROP INDEX IF EXISTS idx_trips_driver_active;
@@ -0,0 +1,13 @@
+-- Drivers a rider marked as a favorite after a completed trip with them. A
+-- favorite in the matching pool near the pickup gets the rider's requests
+-- first.
+CREATE TABLE IF NOT EXISTS favorite_drivers (
+    id         UUID PRIMARY KEY,
+    rider_id   UUID        NOT NULL REFERENCES users(id),
+    driver_id  UUID        NOT NULL REFERENCES drivers(id),
+    trip_id    UUID        NOT NULL REFERENCES trips(id),  -- the trip they were favorited from
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (rider_id, driver_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_favorite_drivers_driver ON favorite_drivers(driver_id);
@@ -0,0 +1,5 @@
+-- Optional gender on rider and driver profiles ('' when not stated), and
+-- trips asking for a women-only match: a woman driver for a woman rider.
+ALTER TABLE users   ADD COLUMN IF NOT EXISTS gender VARCHAR(20) NOT NULL DEFAULT '';
+ALTER TABLE drivers ADD COLUMN IF NOT EXISTS gender VARCHAR(20) NOT NULL DEFAULT '';
+ALTER TABLE trips   ADD COLUMN IF NOT EXISTS women_only BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,9 @@
+-- Mid-trip destination changes: each modification keeps the destination it
+-- replaced and the fare re-estimated for it, for receipts and disputes, and
+-- trips count the changes their driver approved.
+ALTER TABLE trip_modifications ADD COLUMN IF NOT EXISTS prev_drop_lat DOUBLE PRECISION; -- set on approval
+ALTER TABLE trip_modifications ADD COLUMN IF NOT EXISTS prev_drop_lng DOUBLE PRECISION;
+ALTER TABLE trip_modifications ADD COLUMN IF NOT EXISTS currency VARCHAR(3);
+ALTER TABLE trip_modifications ADD COLUMN IF NOT EXISTS fare_before_minor BIGINT;   -- the route as it was
+ALTER TABLE trip_modifications ADD COLUMN IF NOT EXISTS fare_estimate_minor BIGINT; -- the route as changed
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS destination_changes INT NOT NULL DEFAULT 0;
@@ -0,0 +1,13 @@
+-- Links riders share so friends and family can follow a trip without an
+-- account. Only the SHA-256 of each token is kept.
+CREATE TABLE IF NOT EXISTS trip_shares (
+    id         UUID PRIMARY KEY,
+    trip_id    UUID        NOT NULL REFERENCES trips(id),
+    rider_id   UUID        NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_trip_shares_trip_id ON trip_shares(trip_id);
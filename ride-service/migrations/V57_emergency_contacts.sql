@@ -0,0 +1,29 @@
+-- Riders' emergency contacts, told when the rider sends an SOS or their trip
+-- leaves its route. Email and phone are sealed like an account's (pkg/pii);
+-- either may be empty.
+CREATE TABLE IF NOT EXISTS emergency_contacts (
+    id         UUID PRIMARY KEY,
+    rider_id   UUID         NOT NULL REFERENCES users(id),
+    name       VARCHAR(100) NOT NULL,
+    email      TEXT         NOT NULL DEFAULT '',
+    phone      TEXT         NOT NULL DEFAULT '',
+    email_idx  VARCHAR(64),
+    phone_idx  VARCHAR(64),
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_emergency_contacts_rider_id ON emergency_contacts(rider_id);
+
+-- Alerts sent to a rider's contacts about a trip, with the share link they
+-- got.
+CREATE TABLE IF NOT EXISTS emergency_alerts (
+    id         UUID PRIMARY KEY,
+    trip_id    UUID        NOT NULL REFERENCES trips(id),
+    rider_id   UUID        NOT NULL,
+    reason     VARCHAR(20) NOT NULL, -- sos | route_deviation
+    share_id   UUID REFERENCES trip_shares(id),
+    notified   INT         NOT NULL DEFAULT 0, -- contacts told
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_emergency_alerts_trip_id ON emergency_alerts(trip_id, created_at);
@@ -0,0 +1,17 @@
+-- Stretches of a started trip the driver spent off the planned route, kept
+-- for review. points is the off-route trace, [{lat,lng,ts}] oldest first;
+-- ended_at stays NULL while the driver is still off it.
+CREATE TABLE IF NOT EXISTS route_deviations (
+    id          UUID PRIMARY KEY,
+    trip_id     UUID             NOT NULL REFERENCES trips(id),
+    driver_id   UUID             NOT NULL,
+    rider_id    UUID             NOT NULL,
+    started_at  TIMESTAMPTZ      NOT NULL, -- first ping off the route
+    detected_at TIMESTAMPTZ      NOT NULL,
+    ended_at    TIMESTAMPTZ,
+    max_km      DOUBLE PRECISION NOT NULL, -- furthest from the route
+    points      JSONB            NOT NULL DEFAULT '[]',
+    created_at  TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_route_deviations_trip_id ON route_deviations(trip_id, started_at);
@@ -0,0 +1,14 @@
+-- Drivers' driving per UTC day, from the speed between location pings: the
+-- distance covered and the speeding and harsh acceleration and braking
+-- episodes counted. The safety score sums the days in its window.
+CREATE TABLE IF NOT EXISTS driver_safety_days (
+    driver_id     UUID             NOT NULL REFERENCES drivers(id),
+    day           DATE             NOT NULL,
+    km            DOUBLE PRECISION NOT NULL DEFAULT 0,
+    speeding      INT              NOT NULL DEFAULT 0,
+    harsh_accel   INT              NOT NULL DEFAULT 0,
+    harsh_braking INT              NOT NULL DEFAULT 0,
+    PRIMARY KEY (driver_id, day)
+);
+
+CREATE INDEX IF NOT EXISTS idx_driver_safety_days_day ON driver_safety_days(day);
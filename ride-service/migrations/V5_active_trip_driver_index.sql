@@ -0,0 +1,4 @@
+-- Speeds up the ops map lookup of in-flight trips by driver.
+CREATE INDEX IF NOT EXISTS idx_trips_active_driver
+    ON trips(driver_id)
+    WHERE status IN ('DRIVER_ASSIGNED', 'STARTED');
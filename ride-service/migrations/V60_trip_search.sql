@@ -0,0 +1,4 @@
+-- GET /admin/trips pages newest first by (created_at, id) and narrows
+-- "pickup near a point" searches to a lat/lng box before measuring.
+CREATE INDEX IF NOT EXISTS idx_trips_created ON trips(created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS idx_trips_pickup  ON trips(pickup_lat, pickup_lng);
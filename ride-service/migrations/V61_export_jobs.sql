@@ -0,0 +1,25 @@
+-- Bulk exports staff queue at /admin/exports. A worker claims a queued job
+-- (or a running one whose lease ran out: its worker died) and writes the file
+-- to the blob store under blob_key. The file is deleted after the retention
+-- period and the job marked expired.
+CREATE TABLE IF NOT EXISTS export_jobs (
+    id           UUID         PRIMARY KEY,
+    requested_by UUID         NOT NULL,
+    dataset      VARCHAR(30)  NOT NULL,
+    format       VARCHAR(10)  NOT NULL,
+    filters      JSONB        NOT NULL DEFAULT '{}',
+    status       VARCHAR(10)  NOT NULL DEFAULT 'queued', -- queued | running | done | failed | expired
+    attempts     INT          NOT NULL DEFAULT 0,
+    lease_until  TIMESTAMPTZ,
+    row_count    BIGINT       NOT NULL DEFAULT 0,
+    size_bytes   BIGINT       NOT NULL DEFAULT 0,
+    truncated    BOOLEAN      NOT NULL DEFAULT FALSE, -- more rows matched than the export limit
+    blob_key     TEXT,
+    error        TEXT         NOT NULL DEFAULT '',
+    created_at   TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    started_at   TIMESTAMPTZ,
+    finished_at  TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_export_jobs_pending ON export_jobs(created_at) WHERE status IN ('queued', 'running');
+CREATE INDEX IF NOT EXISTS idx_export_jobs_done    ON export_jobs(finished_at) WHERE status = 'done';
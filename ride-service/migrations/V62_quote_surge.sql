@@ -0,0 +1,3 @@
+-- The surge multiplier a fare quote was scaled by, in hundredths: 100 when
+-- none applied. The quoted rate already includes it; this records why.
+ALTER TABLE fare_quotes ADD COLUMN IF NOT EXISTS surge_pct INT NOT NULL DEFAULT 100;
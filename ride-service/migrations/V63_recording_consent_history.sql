@@ -0,0 +1,8 @@
+-- Each opt-in is its own row, closed by revoked_at, so re-consenting after a
+-- revocation keeps the earlier interval instead of overwriting it. A party
+-- has at most one open consent per trip.
+ALTER TABLE recording_consents DROP CONSTRAINT IF EXISTS recording_consents_pkey;
+ALTER TABLE recording_consents ADD COLUMN IF NOT EXISTS id BIGSERIAL PRIMARY KEY;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_recording_consents_open
+    ON recording_consents(trip_id, party) WHERE revoked_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_recording_consents_trip ON recording_consents(trip_id, party, consented_at);
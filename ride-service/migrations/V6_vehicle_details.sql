@@ -0,0 +1,3 @@
+ALTER TABLE drivers ADD COLUMN IF NOT EXISTS vehicle_model     VARCHAR(100);
+ALTER TABLE drivers ADD COLUMN IF NOT EXISTS vehicle_color     VARCHAR(50);
+ALTER TABLE drivers ADD COLUMN IF NOT EXISTS vehicle_photo_key VARCHAR(255);
@@ -0,0 +1,33 @@
+-- Audio stays on the device; the server only keeps consent and metadata.
+CREATE TABLE IF NOT EXISTS recording_consents (
+    trip_id      UUID        NOT NULL REFERENCES trips(id),
+    party        VARCHAR(10) NOT NULL,  -- rider | driver
+    account_id   UUID        NOT NULL,
+    consented_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    revoked_at   TIMESTAMPTZ,
+    PRIMARY KEY (trip_id, party)
+);
+
+CREATE TABLE IF NOT EXISTS trip_recordings (
+    id               UUID PRIMARY KEY,
+    trip_id          UUID        NOT NULL REFERENCES trips(id),
+    party            VARCHAR(10) NOT NULL,
+    account_id       UUID        NOT NULL,
+    device_id        VARCHAR(100) NOT NULL,
+    started_at       TIMESTAMPTZ NOT NULL,
+    ended_at         TIMESTAMPTZ NOT NULL,
+    size_bytes       BIGINT      NOT NULL,
+    sha256           CHAR(64)    NOT NULL,
+    created_at       TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_trip_recordings_trip_id ON trip_recordings(trip_id);
+
+-- Every admin lookup is tied to an incident and recorded.
+CREATE TABLE IF NOT EXISTS recording_access_log (
+    id          BIGSERIAL PRIMARY KEY,
+    trip_id     UUID         NOT NULL,
+    admin_id    UUID         NOT NULL,
+    incident_id VARCHAR(100) NOT NULL,
+    accessed_at TIMESTAMPTZ  DEFAULT NOW()
+);
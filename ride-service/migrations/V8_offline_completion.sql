@@ -0,0 +1,15 @@
+-- Per-device HMAC keys used to sign trip completions made while offline.
+CREATE TABLE IF NOT EXISTS driver_devices (
+    id         UUID PRIMARY KEY,
+    driver_id  UUID        NOT NULL REFERENCES drivers(id),
+    secret     BYTEA       NOT NULL,
+    label      VARCHAR(100),
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    revoked_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_driver_devices_driver_id ON driver_devices(driver_id);
+
+-- online | offline_signed
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS completion_source VARCHAR(20);
+ALTER TABLE trips ADD COLUMN IF NOT EXISTS distance_km       DOUBLE PRECISION;
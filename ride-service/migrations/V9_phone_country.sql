@@ -0,0 +1,33 @@
+-- Account country drives phone validation; existing accounts are Indian.
+ALTER TABLE users   ADD COLUMN IF NOT EXISTS country CHAR(2) NOT NULL DEFAULT 'IN';
+ALTER TABLE drivers ADD COLUMN IF NOT EXISTS country CHAR(2) NOT NULL DEFAULT 'IN';
+
+-- Rewrite Indian numbers stored in national or formatted form (09876543210,
+-- 98765 43210, +91-98765-43210) to E.164. When several rows share a canonical
+-- number, or it is already taken, only the oldest row is rewritten; the rest
+-- keep their stored form for manual review.
+UPDATE users u SET phone = c.canon
+FROM (
+    SELECT DISTINCT ON (canon) id, canon
+    FROM (
+        SELECT id, created_at, '+91' || right(regexp_replace(phone, '\D', '', 'g'), 10) AS canon
+        FROM users
+        WHERE regexp_replace(phone, '\D', '', 'g') ~ '^(91|0)?[6-9][0-9]{9}$'
+    ) n
+    ORDER BY canon, created_at
+) c
+WHERE u.id = c.id AND u.phone <> c.canon
+  AND NOT EXISTS (SELECT 1 FROM users x WHERE x.phone = c.canon);
+
+UPDATE drivers d SET phone = c.canon
+FROM (
+    SELECT DISTINCT ON (canon) id, canon
+    FROM (
+        SELECT id, created_at, '+91' || right(regexp_replace(phone, '\D', '', 'g'), 10) AS canon
+        FROM drivers
+        WHERE regexp_replace(phone, '\D', '', 'g') ~ '^(91|0)?[6-9][0-9]{9}$'
+    ) n
+    ORDER BY canon, created_at
+) c
+WHERE d.id = c.id AND d.phone <> c.canon
+  AND NOT EXISTS (SELECT 1 FROM drivers x WHERE x.phone = c.canon);
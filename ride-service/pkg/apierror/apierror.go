@@ -0,0 +1,153 @@
+// Package apierror is how the HTTP API reports failures. Services return
+// typed errors built here, usually as package-level sentinels wrapped with
+// detail, and handlers answer every failure with Write:
+//
+//	{"error": "trip not found", "code": "not_found"}
+//
+// The status and code come from the first *Error in the chain and the
+// message from the whole chain. Errors that carry no *Error are unexpected:
+// they are logged and answered with a bare 500, so database and driver
+// messages never reach clients.
+package apierror
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Codes clients can match on. Each constructor uses the code of its kind;
+// WithCode gives an error a more specific one.
+const (
+	CodeValidation           = "validation_failed"
+	CodeUnauthorized         = "unauthorized"
+	CodeForbidden            = "forbidden"
+	CodeNotFound             = "not_found"
+	CodeConflict             = "conflict"
+	CodeTooLarge             = "too_large"
+	CodeUnsupportedMediaType = "unsupported_media_type"
+	CodeUnprocessable        = "unprocessable"
+	CodePreconditionRequired = "precondition_required"
+	CodeRateLimited          = "rate_limited"
+	CodeUnavailable          = "unavailable"
+	CodeInternal             = "internal"
+)
+
+// Error is an error with the HTTP status and code it is reported with.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	Fields  []FieldError // every invalid field, for validation errors
+	Err     error        // cause, logged but never sent
+	// RetryAfter, when set, is sent as the Retry-After header in seconds.
+	RetryAfter time.Duration
+}
+
+// FieldError is one invalid field of a request. Field is its JSON path,
+// e.g. stops.1.lat, or a parameter name; it is empty when the request as a
+// whole is at fault.
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+func (e *Error) Error() string { return e.Message }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// WithCode returns a copy of e reported with code.
+func (e *Error) WithCode(code string) *Error {
+	c := *e
+	c.Code = code
+	return &c
+}
+
+// New returns an error reported with status and code.
+func New(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// Validation is a 400: the request is malformed or a value is out of range.
+func Validation(message string) *Error {
+	return New(http.StatusBadRequest, CodeValidation, message)
+}
+
+// InvalidFields is a 400 listing every invalid field. Its message joins
+// them, so clients that only read "error" still see all of them.
+func InvalidFields(fields []FieldError) *Error {
+	msgs := make([]string, len(fields))
+	for i, f := range fields {
+		msgs[i] = f.Reason
+		if f.Field != "" {
+			msgs[i] = f.Field + ": " + f.Reason
+		}
+	}
+	e := Validation(strings.Join(msgs, "; "))
+	e.Fields = fields
+	return e
+}
+
+// Unauthorized is a 401: the caller is not authenticated.
+func Unauthorized(message string) *Error {
+	return New(http.StatusUnauthorized, CodeUnauthorized, message)
+}
+
+// Forbidden is a 403: the caller may not do this.
+func Forbidden(message string) *Error {
+	return New(http.StatusForbidden, CodeForbidden, message)
+}
+
+// NotFound is a 404.
+func NotFound(message string) *Error {
+	return New(http.StatusNotFound, CodeNotFound, message)
+}
+
+// Conflict is a 409: the request is valid but the resource's current state
+// does not allow it.
+func Conflict(message string) *Error {
+	return New(http.StatusConflict, CodeConflict, message)
+}
+
+// Internal is a 500 for err. Clients see only "internal error".
+func Internal(err error) *Error {
+	return &Error{Status: http.StatusInternalServerError, Code: CodeInternal, Message: "internal error", Err: err}
+}
+
+// Body is the JSON body of every error response.
+type Body struct {
+	Error  string       `json:"error"`
+	Code   string       `json:"code"`
+	Fields []FieldError `json:"fields,omitempty"`
+}
+
+// Write answers err. A 5xx *Error, or an error without one, is logged and
+// answered with its own message only, never the text of what caused it.
+func Write(w http.ResponseWriter, err error) {
+	var e *Error
+	if !errors.As(err, &e) {
+		e = Internal(err)
+	}
+	msg := err.Error()
+	if e.Status >= http.StatusInternalServerError {
+		if e.Err != nil || e != err {
+			log.Printf("apierror: %d %s: %v", e.Status, e.Code, err)
+		}
+		msg = e.Message
+	}
+	if e.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int((e.RetryAfter+time.Second-1)/time.Second)))
+	}
+	WriteJSON(w, e.Status, Body{Error: msg, Code: e.Code, Fields: e.Fields})
+}
+
+// WriteJSON answers with status and v encoded as JSON.
+func WriteJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,190 @@
+// Package cache is a two-tier read-through cache for hot reads: a small
+// in-process LRU with a short TTL in front of a shared Redis tier. Writers
+// invalidate a key after every change; other instances' local copies are
+// stale for at most the local TTL.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"ride-service/pkg/logging"
+)
+
+var logger = logging.For("cache")
+
+// Store is the shared tier; the Redis client implements it.
+type Store interface {
+	GetCached(ctx context.Context, key string) ([]byte, bool, error)
+	SetCached(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	DeleteCached(ctx context.Context, keys ...string) error
+}
+
+// Cache holds JSON-encoded values of T under a key prefix. Values are
+// decoded on every hit, so callers can change what they get back.
+type Cache[T any] struct {
+	store    Store // nil: local tier only
+	prefix   string
+	size     int
+	localTTL time.Duration
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	items   map[string]*list.Element
+	lru     *list.List // front is the most recently used
+	flights map[string]*flight
+}
+
+type entry struct {
+	key     string
+	data    []byte
+	expires time.Time
+}
+
+// flight tracks the reads of a key that missed the local tier. An
+// invalidation during them bumps gen, so none of them caches what it read.
+type flight struct {
+	reads, gen int
+}
+
+// New creates a cache. Values stay up to localTTL in the local tier of at
+// most size entries, and up to ttl in store. A zero ttl disables caching:
+// Get always loads.
+func New[T any](store Store, prefix string, size int, localTTL, ttl time.Duration) *Cache[T] {
+	return &Cache[T]{
+		store: store, prefix: prefix, size: size, localTTL: localTTL, ttl: ttl,
+		items: map[string]*list.Element{}, lru: list.New(), flights: map[string]*flight{},
+	}
+}
+
+// Get returns the value for key, from the local tier, then the store, then
+// load. A loaded value is cached in both tiers; load errors are not cached.
+// If the store fails, Get falls back to load.
+func (c *Cache[T]) Get(ctx context.Context, key string, load func(context.Context) (T, error)) (T, error) {
+	var v T
+	if c.ttl <= 0 {
+		return load(ctx)
+	}
+	if data, ok := c.local(key); ok && json.Unmarshal(data, &v) == nil {
+		return v, nil
+	}
+	gen := c.begin(key)
+	if c.store != nil {
+		data, ok, err := c.store.GetCached(ctx, c.prefix+key)
+		if err != nil {
+			logger.Warn("cache read failed", "key", c.prefix+key, "err", err)
+		} else if ok && json.Unmarshal(data, &v) == nil {
+			c.finish(key, gen, data)
+			return v, nil
+		}
+	}
+
+	v, err := load(ctx)
+	if err != nil {
+		c.finish(key, gen, nil)
+		return v, err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		c.finish(key, gen, nil)
+		return v, nil
+	}
+	if !c.finish(key, gen, data) {
+		// Invalidated while loading: what was loaded may predate the write.
+		return v, nil
+	}
+	if c.store != nil {
+		if err := c.store.SetCached(ctx, c.prefix+key, data, c.ttl); err != nil {
+			logger.Warn("cache write failed", "key", c.prefix+key, "err", err)
+		}
+	}
+	return v, nil
+}
+
+// Invalidate drops key from both tiers. Call it after every write to the
+// value behind key.
+func (c *Cache[T]) Invalidate(ctx context.Context, key string) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	if el, ok := c.items[key]; ok {
+		c.lru.Remove(el)
+		delete(c.items, key)
+	}
+	if f, ok := c.flights[key]; ok {
+		f.gen++
+	}
+	c.mu.Unlock()
+	if c.store != nil {
+		if err := c.store.DeleteCached(ctx, c.prefix+key); err != nil {
+			logger.Warn("cache invalidation failed", "key", c.prefix+key, "err", err)
+		}
+	}
+}
+
+// local returns key's unexpired data from the local tier.
+func (c *Cache[T]) local(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*entry)
+	if time.Now().After(e.expires) {
+		c.lru.Remove(el)
+		delete(c.items, key)
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return e.data, true
+}
+
+// begin registers a read of key past the local tier; pass what it returns
+// to finish.
+func (c *Cache[T]) begin(key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f, ok := c.flights[key]
+	if !ok {
+		f = &flight{}
+		c.flights[key] = f
+	}
+	f.reads++
+	return f.gen
+}
+
+// finish ends a read of key begun at gen. It stores data, if any, in the
+// local tier, evicting the least recently used entry when full, and reports
+// whether key was left alone since: if not, data may be stale and is dropped.
+func (c *Cache[T]) finish(key string, gen int, data []byte) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f := c.flights[key]
+	if f.reads--; f.reads == 0 {
+		delete(c.flights, key)
+	}
+	if f.gen != gen || data == nil {
+		return false
+	}
+	if c.size <= 0 || c.localTTL <= 0 {
+		return true
+	}
+	e := &entry{key: key, data: data, expires: time.Now().Add(c.localTTL)}
+	if el, ok := c.items[key]; ok {
+		el.Value = e
+		c.lru.MoveToFront(el)
+		return true
+	}
+	c.items[key] = c.lru.PushFront(e)
+	for c.lru.Len() > c.size {
+		last := c.lru.Back()
+		c.lru.Remove(last)
+		delete(c.items, last.Value.(*entry).key)
+	}
+	return true
+}
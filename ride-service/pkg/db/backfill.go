@@ -0,0 +1,48 @@
+package db
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Execer is satisfied by *pgxpool.Pool, *pgxpool.Conn and *pgx.Conn.
+type Execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+// Backfill runs query repeatedly with the batch size as $1 until a run
+// affects no rows, and returns the total affected. Each run commits on its
+// own, so rows are locked for one batch at a time rather than the whole
+// table. The query must make progress, e.g.
+//
+//	UPDATE trips SET x = ... WHERE id IN
+//	    (SELECT id FROM trips WHERE x IS NULL LIMIT $1)
+//
+// pause is slept between batches to leave room for regular traffic.
+func Backfill(ctx context.Context, db Execer, query string, batch int, pause time.Duration) (int64, error) {
+	var total int64
+	for {
+		tag, err := db.Exec(ctx, query, batch)
+		if err != nil {
+			return total, err
+		}
+		n := tag.RowsAffected()
+		if n == 0 {
+			return total, nil
+		}
+		total += n
+		if total%int64(batch*10) < n {
+			log.Printf("backfill: %d rows so far", total)
+		}
+		if pause > 0 {
+			select {
+			case <-ctx.Done():
+				return total, ctx.Err()
+			case <-time.After(pause):
+			}
+		}
+	}
+}
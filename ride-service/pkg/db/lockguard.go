@@ -0,0 +1,104 @@
+package db
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// blockingModes are the relation lock modes that stall ordinary reads or
+// writes of a table while held.
+var blockingModes = []string{"ShareLock", "ShareRowExclusiveLock", "ExclusiveLock", "AccessExclusiveLock"}
+
+// lockGuard polls pg_locks for the migration's backend and warns once per
+// table when a blocking lock is held longer than the threshold.
+type lockGuard struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu      sync.Mutex
+	longest time.Duration
+}
+
+func watchLocks(ctx context.Context, pool *pgxpool.Pool, file string, pid uint32, warnAfter time.Duration) *lockGuard {
+	ctx, cancel := context.WithCancel(ctx)
+	g := &lockGuard{cancel: cancel, done: make(chan struct{})}
+	go g.run(ctx, pool, file, pid, warnAfter)
+	return g
+}
+
+// stop ends polling and returns the longest blocking lock observed.
+func (g *lockGuard) stop() time.Duration {
+	g.cancel()
+	<-g.done
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.longest
+}
+
+func (g *lockGuard) run(ctx context.Context, pool *pgxpool.Pool, file string, pid uint32, warnAfter time.Duration) {
+	defer close(g.done)
+
+	every := 200 * time.Millisecond
+	if warnAfter > 0 && warnAfter/4 < every {
+		every = warnAfter / 4
+	}
+	t := time.NewTicker(every)
+	defer t.Stop()
+
+	since := map[string]time.Time{} // table -> first seen holding a blocking lock
+	warned := map[string]bool{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		rows, err := pool.Query(ctx,
+			`SELECT DISTINCT l.relation::regclass::text
+			 FROM pg_locks l
+			 WHERE l.pid=$1 AND l.granted AND l.locktype='relation' AND l.mode = ANY($2)`,
+			pid, blockingModes)
+		if err != nil {
+			continue // ctx cancelled or transient; the next tick retries
+		}
+		now := time.Now()
+		held := map[string]bool{}
+		for rows.Next() {
+			var table string
+			if rows.Scan(&table) == nil {
+				held[table] = true
+			}
+		}
+		rows.Close()
+
+		for table := range since {
+			if !held[table] {
+				delete(since, table)
+			}
+		}
+		for table := range held {
+			first, ok := since[table]
+			if !ok {
+				since[table] = now
+				continue
+			}
+			d := now.Sub(first)
+			g.mu.Lock()
+			if d > g.longest {
+				g.longest = d
+			}
+			g.mu.Unlock()
+			if warnAfter > 0 && d > warnAfter && !warned[table] {
+				warned[table] = true
+				log.Printf("WARNING: migration %s has held a blocking lock on %s for %s (threshold %s); "+
+					"consider CONCURRENTLY, NOT VALID constraints or a batched backfill",
+					file, table, d.Round(time.Millisecond), warnAfter)
+			}
+		}
+	}
+}
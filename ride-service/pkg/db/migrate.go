@@ -0,0 +1,299 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Migration files are plain SQL named V<N>_name.sql and applied in numeric
+// order. By default a file runs in one transaction together with its
+// schema_migrations row, so it applies completely or not at all.
+//
+// Directives are SQL comments:
+//
+//	-- migrate:no-transaction
+//	    Anywhere in the file. Statements run one at a time outside a
+//	    transaction, as CREATE INDEX CONCURRENTLY requires. Such files must be
+//	    safe to re-run after a partial failure (IF NOT EXISTS, and drop any
+//	    INVALID index a failed concurrent build left behind).
+//
+//	-- migrate:backfill batch=1000 pause=100ms
+//	    Before a statement in a no-transaction file. The statement takes the
+//	    batch size as $1 and is repeated, each batch committing on its own,
+//	    until it affects no rows. See Backfill.
+var (
+	noTxDirective     = regexp.MustCompile(`(?m)^\s*--\s*migrate:no-transaction\s*$`)
+	backfillDirective = regexp.MustCompile(`(?m)^\s*--\s*migrate:backfill\b(.*)$`)
+	concurrently      = regexp.MustCompile(`(?i)\bCONCURRENTLY\b`)
+)
+
+// MigrateOptions tunes RunMigrations.
+type MigrateOptions struct {
+	// LockTimeout bounds how long a statement waits for a table lock, so a
+	// migration queued behind a long transaction fails instead of stalling
+	// every query queued behind it. Zero disables.
+	LockTimeout time.Duration
+	// LockWarnAfter flags a migration that holds a table-blocking lock for
+	// longer than this. Zero disables the guard.
+	LockWarnAfter time.Duration
+}
+
+// RunMigrations reads SQL files from the embedded FS and applies them in order.
+func (d *DB) RunMigrations(ctx context.Context, migrationFS fs.FS, opts MigrateOptions) error {
+	// Migrations and backfills may take minutes; LockTimeout bounds them.
+	ctx = WithoutQueryTimeout(ctx)
+	_, err := d.Pool.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    VARCHAR(255) PRIMARY KEY,
+			applied_at TIMESTAMPTZ  DEFAULT NOW()
+		);
+		ALTER TABLE schema_migrations ADD COLUMN IF NOT EXISTS max_lock_ms BIGINT;
+	`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	entries, err := fs.ReadDir(migrationFS, ".")
+	if err != nil {
+		return fmt.Errorf("read migrations dir: %w", err)
+	}
+
+	var sqlFiles []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".sql") {
+			sqlFiles = append(sqlFiles, e.Name())
+		}
+	}
+	// Order by the numeric version so V10 runs after V9, not after V1.
+	sort.Slice(sqlFiles, func(i, j int) bool {
+		vi, vj := migrationVersion(sqlFiles[i]), migrationVersion(sqlFiles[j])
+		if vi != vj {
+			return vi < vj
+		}
+		return sqlFiles[i] < sqlFiles[j]
+	})
+
+	for _, file := range sqlFiles {
+		var count int
+		_ = d.Pool.QueryRow(ctx, "SELECT COUNT(*) FROM schema_migrations WHERE version=$1", file).Scan(&count)
+		if count > 0 {
+			log.Printf("Migration %s — already applied", file)
+			continue
+		}
+
+		content, err := fs.ReadFile(migrationFS, file)
+		if err != nil {
+			return fmt.Errorf("read %s: %w", file, err)
+		}
+		if err := d.applyMigration(ctx, file, string(content), opts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyMigration runs one file on a dedicated connection so the lock guard
+// can watch that backend.
+func (d *DB) applyMigration(ctx context.Context, file, sql string, opts MigrateOptions) error {
+	noTx := noTxDirective.MatchString(sql)
+	if !noTx && concurrently.MatchString(sql) {
+		return fmt.Errorf("%s: CONCURRENTLY cannot run in a transaction; add -- migrate:no-transaction", file)
+	}
+
+	conn, err := d.Pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: acquire connection: %w", file, err)
+	}
+	defer conn.Release()
+
+	if opts.LockTimeout > 0 {
+		if _, err := conn.Exec(ctx, fmt.Sprintf("SET lock_timeout = %d", opts.LockTimeout.Milliseconds())); err != nil {
+			return fmt.Errorf("%s: set lock_timeout: %w", file, err)
+		}
+		defer conn.Exec(context.Background(), "RESET lock_timeout")
+	}
+	if _, err := conn.Exec(ctx, "SET statement_timeout = 0"); err != nil {
+		return fmt.Errorf("%s: set statement_timeout: %w", file, err)
+	}
+	defer conn.Exec(context.Background(), "RESET statement_timeout")
+
+	var pid uint32
+	if err := conn.QueryRow(ctx, "SELECT pg_backend_pid()").Scan(&pid); err != nil {
+		return fmt.Errorf("%s: backend pid: %w", file, err)
+	}
+	guard := watchLocks(ctx, d.Pool, file, pid, opts.LockWarnAfter)
+
+	start := time.Now()
+	if noTx {
+		err = runStatements(ctx, conn, file, sql)
+	} else {
+		err = pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, sql); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", file)
+			return err
+		})
+	}
+	held := guard.stop()
+	if err != nil {
+		return fmt.Errorf("exec %s: %w", file, err)
+	}
+
+	if noTx {
+		_, err = conn.Exec(ctx, "INSERT INTO schema_migrations (version, max_lock_ms) VALUES ($1,$2)", file, held.Milliseconds())
+	} else {
+		_, err = conn.Exec(ctx, "UPDATE schema_migrations SET max_lock_ms=$2 WHERE version=$1", file, held.Milliseconds())
+	}
+	if err != nil {
+		return fmt.Errorf("record %s: %w", file, err)
+	}
+	log.Printf("Applied migration: %s (%s, longest table lock %s)", file,
+		time.Since(start).Round(time.Millisecond), held.Round(time.Millisecond))
+	return nil
+}
+
+// runStatements executes a no-transaction file statement by statement.
+func runStatements(ctx context.Context, conn *pgxpool.Conn, file, sql string) error {
+	for i, stmt := range splitStatements(sql) {
+		if m := backfillDirective.FindStringSubmatch(stmt); m != nil {
+			batch, pause, err := parseBackfill(m[1])
+			if err != nil {
+				return fmt.Errorf("statement %d: %w", i+1, err)
+			}
+			n, err := Backfill(ctx, conn, stmt, batch, pause)
+			if err != nil {
+				return fmt.Errorf("statement %d: %w", i+1, err)
+			}
+			log.Printf("Migration %s — backfilled %d rows", file, n)
+			continue
+		}
+		if _, err := conn.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("statement %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func parseBackfill(args string) (batch int, pause time.Duration, err error) {
+	batch = 1000
+	for _, f := range strings.Fields(args) {
+		key, val, _ := strings.Cut(f, "=")
+		switch key {
+		case "batch":
+			batch, err = strconv.Atoi(val)
+		case "pause":
+			pause, err = time.ParseDuration(val)
+		default:
+			err = fmt.Errorf("unknown backfill option %q", f)
+		}
+		if err != nil {
+			return 0, 0, fmt.Errorf("migrate:backfill: %w", err)
+		}
+	}
+	if batch < 1 {
+		return 0, 0, errors.New("migrate:backfill: batch must be positive")
+	}
+	return batch, pause, nil
+}
+
+// migrationVersion parses N from a "V<N>_name.sql" file name; files that do
+// not follow the pattern sort first.
+func migrationVersion(file string) int {
+	digits := strings.TrimPrefix(file, "V")
+	if i := strings.IndexByte(digits, '_'); i >= 0 {
+		digits = digits[:i]
+	}
+	n, err := strconv.Atoi(digits)
+	if err != nil {
+		return -1
+	}
+	return n
+}
+
+// splitStatements splits SQL on top-level semicolons, leaving those inside
+// quotes, dollar-quoted bodies and comments alone. Each statement keeps its
+// leading comments (where directives live); comment-only pieces are dropped.
+func splitStatements(sql string) []string {
+	var out []string
+	start, i := 0, 0
+	code := false // statement has something besides comments and whitespace
+	flush := func(end int) {
+		if code {
+			out = append(out, strings.TrimSpace(sql[start:end]))
+		}
+		start, code = end+1, false
+	}
+	for i < len(sql) {
+		c := sql[i]
+		switch {
+		case c == '-' && strings.HasPrefix(sql[i:], "--"):
+			if n := strings.IndexByte(sql[i:], '\n'); n >= 0 {
+				i += n
+			} else {
+				i = len(sql)
+			}
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			if n := strings.Index(sql[i+2:], "*/"); n >= 0 {
+				i += n + 3
+			} else {
+				i = len(sql)
+			}
+		case c == '\'' || c == '"':
+			code = true
+			for i++; i < len(sql); i++ {
+				if sql[i] == c {
+					if i+1 < len(sql) && sql[i+1] == c { // doubled quote escape
+						i++
+						continue
+					}
+					break
+				}
+			}
+		case c == '$':
+			code = true
+			if tag := dollarTag(sql[i:]); tag != "" {
+				if n := strings.Index(sql[i+len(tag):], tag); n >= 0 {
+					i += len(tag) + n + len(tag) - 1
+				} else {
+					i = len(sql)
+				}
+			}
+		case c == ';':
+			flush(i)
+		default:
+			if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+				code = true
+			}
+		}
+		i++
+	}
+	flush(len(sql))
+	return out
+}
+
+// dollarTag returns the opening $tag$ at the start of s, or "" if s does not
+// start a dollar-quoted string (e.g. a $1 parameter).
+func dollarTag(s string) string {
+	for j := 1; j < len(s); j++ {
+		switch c := s[j]; {
+		case c == '$':
+			return s[:j+1]
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || j > 1 && c >= '0' && c <= '9':
+		default:
+			return ""
+		}
+	}
+	return ""
+}
@@ -3,12 +3,11 @@ package db
 import (
 	"context"
 	"fmt"
-	"io/fs"
 	"log"
-	"sort"
-	"strings"
+	"strconv"
 	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -17,70 +16,70 @@ type DB struct {
 	Pool *pgxpool.Pool
 }
 
+// Options tunes Connect.
+type Options struct {
+	Attempts int             // connection retries at startup
+	Tracer   pgx.QueryTracer // optional; sees every Query/QueryRow/Exec
+	Pool     PoolOptions
+}
+
+// PoolOptions sizes the pool and bounds how long queries may run. Zero
+// values keep pgxpool's defaults and impose no timeout.
+type PoolOptions struct {
+	MaxConns        int32
+	MinConns        int32
+	MaxConnIdleTime time.Duration
+	MaxConnLifetime time.Duration
+	// StatementTimeout is the server-side statement_timeout of every
+	// connection: PostgreSQL cancels statements that run longer.
+	StatementTimeout time.Duration
+	// QueryTimeout is a client-side deadline on each query, which also
+	// covers network stalls and reading the rows. See WithoutQueryTimeout.
+	QueryTimeout time.Duration
+}
+
 // Connect opens a connection pool with retry logic.
-func Connect(ctx context.Context, dsn string) (*DB, error) {
+func Connect(ctx context.Context, dsn string, opts Options) (*DB, error) {
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: parse dsn: %w", err)
+	}
+	if opts.Tracer != nil {
+		cfg.ConnConfig.Tracer = opts.Tracer
+	}
+	if p := opts.Pool; p.QueryTimeout > 0 {
+		cfg.ConnConfig.Tracer = queryTimeout{timeout: p.QueryTimeout, next: opts.Tracer}
+	}
+	if p := opts.Pool; p.MaxConns > 0 {
+		cfg.MaxConns = p.MaxConns
+	}
+	if p := opts.Pool; p.MinConns > 0 {
+		cfg.MinConns = p.MinConns
+	}
+	if p := opts.Pool; p.MaxConnIdleTime > 0 {
+		cfg.MaxConnIdleTime = p.MaxConnIdleTime
+	}
+	if p := opts.Pool; p.MaxConnLifetime > 0 {
+		cfg.MaxConnLifetime = p.MaxConnLifetime
+	}
+	if p := opts.Pool; p.StatementTimeout > 0 {
+		cfg.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(p.StatementTimeout.Milliseconds(), 10)
+	}
+
 	var pool *pgxpool.Pool
-	var err error
-	for i := 0; i < 30; i++ {
-		pool, err = pgxpool.New(ctx, dsn)
+	attempts := opts.Attempts
+	for i := 0; i < attempts; i++ {
+		pool, err = pgxpool.NewWithConfig(ctx, cfg)
 		if err == nil {
 			if pingErr := pool.Ping(ctx); pingErr == nil {
 				log.Println("Connected to PostgreSQL")
 				return &DB{Pool: pool}, nil
 			}
 		}
-		log.Printf("Waiting for PostgreSQL... (%d/30)", i+1)
+		log.Printf("Waiting for PostgreSQL... (%d/%d)", i+1, attempts)
 		time.Sleep(2 * time.Second)
 	}
-	return nil, fmt.Errorf("postgres: failed after 30 attempts: %w", err)
-}
-
-// RunMigrations reads SQL files from the embedded FS and applies them in order.
-func (d *DB) RunMigrations(ctx context.Context, migrationFS fs.FS) error {
-	_, err := d.Pool.Exec(ctx, `
-		CREATE TABLE IF NOT EXISTS schema_migrations (
-			version    VARCHAR(255) PRIMARY KEY,
-			applied_at TIMESTAMPTZ  DEFAULT NOW()
-		)
-	`)
-	if err != nil {
-		return fmt.Errorf("create schema_migrations: %w", err)
-	}
-
-	entries, err := fs.ReadDir(migrationFS, ".")
-	if err != nil {
-		return fmt.Errorf("read migrations dir: %w", err)
-	}
-
-	var sqlFiles []string
-	for _, e := range entries {
-		if !e.IsDir() && strings.HasSuffix(e.Name(), ".sql") {
-			sqlFiles = append(sqlFiles, e.Name())
-		}
-	}
-	sort.Strings(sqlFiles)
-
-	for _, file := range sqlFiles {
-		var count int
-		_ = d.Pool.QueryRow(ctx, "SELECT COUNT(*) FROM schema_migrations WHERE version=$1", file).Scan(&count)
-		if count > 0 {
-			log.Printf("Migration %s — already applied", file)
-			continue
-		}
-
-		content, err := fs.ReadFile(migrationFS, file)
-		if err != nil {
-			return fmt.Errorf("read %s: %w", file, err)
-		}
-		if _, err = d.Pool.Exec(ctx, string(content)); err != nil {
-			return fmt.Errorf("exec %s: %w", file, err)
-		}
-		if _, err = d.Pool.Exec(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", file); err != nil {
-			return fmt.Errorf("record %s: %w", file, err)
-		}
-		log.Printf("Applied migration: %s", file)
-	}
-	return nil
+	return nil, fmt.Errorf("postgres: failed after %d attempts: %w", attempts, err)
 }
 
 // Close shuts down the pool.
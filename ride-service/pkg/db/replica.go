@@ -0,0 +1,261 @@
+package db
+
+import (
+	"context"
+	"crypto/sha256"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ReplicaOptions tunes a Router.
+type ReplicaOptions struct {
+	MaxLag        time.Duration // replicas further behind than this are skipped
+	StickFor      time.Duration // how long a caller's reads stay on the primary after a write
+	CheckInterval time.Duration // how often replica lag is measured
+}
+
+// Router sends reads that tolerate slightly stale data to read-only replicas
+// and everything else to the primary. Only contexts marked with
+// AllowReplica are routed to a replica, and only to one whose measured lag
+// is within MaxLag; otherwise, or when no replica is configured or fresh,
+// reads fall back to the primary. Writes always use Primary.
+type Router struct {
+	primary  *pgxpool.Pool
+	replicas []*replica
+	opts     ReplicaOptions
+	next     atomic.Uint32 // round-robin over fresh replicas
+
+	mu      sync.Mutex
+	writers map[[16]byte]time.Time // caller → when their reads may leave the primary
+
+	marks []walMark // the primary's recent WAL positions, oldest first; used by check only
+}
+
+// walMark is where the primary's WAL was at a lag check.
+type walMark struct {
+	at  time.Time
+	lsn int64
+}
+
+type replica struct {
+	name  string
+	pool  *pgxpool.Pool
+	fresh atomic.Bool // reachable and within MaxLag at the last check
+}
+
+// NewRouter returns a Router with no replicas: every read uses primary
+// until AddReplica is called.
+func NewRouter(primary *pgxpool.Pool, opts ReplicaOptions) *Router {
+	if opts.CheckInterval <= 0 {
+		opts.CheckInterval = time.Second
+	}
+	return &Router{primary: primary, opts: opts, writers: map[[16]byte]time.Time{}}
+}
+
+// AddReplica adds a read-only replica. It takes reads once its first lag
+// check passes. Call it before Start.
+func (r *Router) AddReplica(name string, pool *pgxpool.Pool) {
+	r.replicas = append(r.replicas, &replica{name: name, pool: pool})
+}
+
+// Primary returns the primary pool, for writes and reads that must see them.
+func (r *Router) Primary() *pgxpool.Pool { return r.primary }
+
+// Reader returns the pool a read in ctx should use: a fresh replica if ctx
+// allows one, the primary otherwise.
+func (r *Router) Reader(ctx context.Context) *pgxpool.Pool {
+	if len(r.replicas) == 0 || !replicaAllowed(ctx) {
+		return r.primary
+	}
+	start := r.next.Add(1)
+	for i := range r.replicas {
+		rep := r.replicas[(int(start)+i)%len(r.replicas)]
+		if rep.fresh.Load() {
+			return rep.pool
+		}
+	}
+	return r.primary
+}
+
+// Start measures replica lag every CheckInterval until ctx is cancelled.
+func (r *Router) Start(ctx context.Context) {
+	if len(r.replicas) == 0 {
+		return
+	}
+	r.check(ctx)
+	go func() {
+		t := time.NewTicker(r.opts.CheckInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				r.check(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Lag is measured against the primary rather than against what a replica
+// has received: a replica whose WAL receiver has stopped has replayed all it
+// received and would look current forever. Each check records the
+// primary's WAL position, and a replica is as far behind as the oldest
+// recorded position it has not replayed yet. One that has replayed the
+// latest is current, however long ago the last write was.
+const (
+	primaryLSNQuery = `SELECT (pg_current_wal_lsn() - '0/0')::int8`
+	replicaLSNQuery = `
+	SELECT pg_is_in_recovery(),
+	       COALESCE((pg_last_wal_replay_lsn() - '0/0')::int8, 0),
+	       COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)::float8`
+)
+
+func (r *Router) check(ctx context.Context) {
+	now := time.Now()
+	cctx, cancel := context.WithTimeout(ctx, r.opts.CheckInterval)
+	var lsn int64
+	err := r.primary.QueryRow(cctx, primaryLSNQuery).Scan(&lsn)
+	cancel()
+	if err != nil {
+		// Replicas are measured against the positions recorded so far, so
+		// their lag keeps growing while they stay behind them.
+		log.Printf("db: reading the primary's WAL position: %v", err)
+	} else {
+		r.mark(walMark{at: now, lsn: lsn})
+	}
+
+	for _, rep := range r.replicas {
+		cctx, cancel := context.WithTimeout(ctx, r.opts.CheckInterval)
+		var recovering bool
+		var replayed int64
+		var sinceReplay float64
+		err := rep.pool.QueryRow(cctx, replicaLSNQuery).Scan(&recovering, &replayed, &sinceReplay)
+		cancel()
+		var lag time.Duration
+		if err == nil && recovering {
+			lag = r.lag(now, replayed, time.Duration(sinceReplay*float64(time.Second)))
+		}
+		fresh := err == nil && lag <= r.opts.MaxLag
+		if was := rep.fresh.Swap(fresh); was != fresh {
+			switch {
+			case fresh:
+				log.Printf("db: replica %s back in rotation (lag %s)", rep.name, lag)
+			case err != nil:
+				log.Printf("db: replica %s out of rotation: %v", rep.name, err)
+			default:
+				log.Printf("db: replica %s out of rotation: lag %s exceeds %s", rep.name, lag, r.opts.MaxLag)
+			}
+		}
+	}
+}
+
+// mark records m, keeping the positions of the last MaxLag and a little
+// more: a replica behind all of them is out of rotation anyway.
+func (r *Router) mark(m walMark) {
+	keep := r.opts.MaxLag + 2*r.opts.CheckInterval
+	i := 0
+	for i < len(r.marks)-1 && m.at.Sub(r.marks[i].at) > keep {
+		i++
+	}
+	r.marks = append(r.marks[i:], m)
+}
+
+// lag returns how long ago the primary was at a position a replica that
+// has replayed up to replayed has not reached, or zero if it has reached
+// the latest. Behind every recorded position, e.g. at startup, it is at
+// least as far behind as its last replayed transaction is old.
+func (r *Router) lag(now time.Time, replayed int64, sinceReplay time.Duration) time.Duration {
+	if len(r.marks) == 0 {
+		return sinceReplay
+	}
+	if replayed >= r.marks[len(r.marks)-1].lsn {
+		return 0
+	}
+	for i, m := range r.marks {
+		if replayed < m.lsn {
+			lag := now.Sub(m.at)
+			if i == 0 {
+				lag = max(lag, sinceReplay)
+			}
+			return lag
+		}
+	}
+	return 0
+}
+
+type replicaKey struct{}
+
+// AllowReplica marks reads made with ctx as tolerating replica lag.
+func AllowReplica(ctx context.Context) context.Context {
+	return context.WithValue(ctx, replicaKey{}, true)
+}
+
+// RequirePrimary undoes AllowReplica, for a read whose result is written
+// back or cached.
+func RequirePrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, replicaKey{}, false)
+}
+
+func replicaAllowed(ctx context.Context) bool {
+	ok, _ := ctx.Value(replicaKey{}).(bool)
+	return ok
+}
+
+// Middleware lets GET and HEAD requests read from replicas, except from a
+// caller who wrote within StickFor, so clients read their own writes.
+// Callers are told apart by their Authorization header, or their address
+// without one. Other methods, background work and consumers always use the
+// primary.
+func (r *Router) Middleware(next http.Handler) http.Handler {
+	if len(r.replicas) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		caller := callerKey(req)
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			next.ServeHTTP(w, req)
+			r.wrote(caller, time.Now())
+			return
+		}
+		r.mu.Lock()
+		until, sticky := r.writers[caller]
+		r.mu.Unlock()
+		if sticky && time.Now().Before(until) {
+			next.ServeHTTP(w, req)
+			return
+		}
+		next.ServeHTTP(w, req.WithContext(AllowReplica(req.Context())))
+	})
+}
+
+func callerKey(req *http.Request) [16]byte {
+	id := req.Header.Get("Authorization")
+	if id == "" {
+		id = req.RemoteAddr
+	}
+	sum := sha256.Sum256([]byte(id))
+	var k [16]byte
+	copy(k[:], sum[:])
+	return k
+}
+
+// wrote keeps caller's reads on the primary for StickFor, dropping callers
+// whose window has passed.
+func (r *Router) wrote(caller [16]byte, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.writers) >= 10000 {
+		for k, until := range r.writers {
+			if now.After(until) {
+				delete(r.writers, k)
+			}
+		}
+	}
+	r.writers[caller] = now.Add(r.opts.StickFor)
+}
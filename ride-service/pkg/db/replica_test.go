@@ -0,0 +1,52 @@
+package db
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReplicaLag(t *testing.T) {
+	r := NewRouter(nil, ReplicaOptions{MaxLag: 5 * time.Second, CheckInterval: time.Second})
+	start := time.Now()
+	at := func(s int) time.Time { return start.Add(time.Duration(s) * time.Second) }
+
+	// Before the primary's position is known, the replay age is all there is.
+	if got := r.lag(at(0), 100, 3*time.Second); got != 3*time.Second {
+		t.Errorf("no marks: lag %s, want 3s", got)
+	}
+
+	// The primary is idle at 100: a replica there is current, however old
+	// its last transaction.
+	r.mark(walMark{at: at(0), lsn: 100})
+	r.mark(walMark{at: at(1), lsn: 100})
+	if got := r.lag(at(1), 100, time.Hour); got != 0 {
+		t.Errorf("idle primary: lag %s, want 0", got)
+	}
+
+	// Writes resume and the replica's receiver has stopped at 100: it falls
+	// further behind with every check instead of looking current.
+	for s := 2; s <= 9; s++ {
+		r.mark(walMark{at: at(s), lsn: int64(100 + s)})
+	}
+	if got := r.lag(at(9), 100, 0); got != 7*time.Second {
+		t.Errorf("stopped receiver: lag %s, want 7s", got)
+	}
+	if got := r.lag(at(9), 105, 0); got != 3*time.Second {
+		t.Errorf("partly caught up: lag %s, want 3s", got)
+	}
+	if got := r.lag(at(9), 109, 0); got != 0 {
+		t.Errorf("caught up: lag %s, want 0", got)
+	}
+
+	// Old marks are dropped, but a replica behind all that are kept is
+	// still at least MaxLag behind.
+	if len(r.marks) >= 10 {
+		t.Errorf("%d marks kept", len(r.marks))
+	}
+	for s := 10; s <= 30; s++ {
+		r.mark(walMark{at: at(s), lsn: int64(100 + s)})
+	}
+	if got := r.lag(at(30), 100, 0); got <= r.opts.MaxLag {
+		t.Errorf("far behind: lag %s, want over %s", got, r.opts.MaxLag)
+	}
+}
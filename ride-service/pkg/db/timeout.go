@@ -0,0 +1,49 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// queryTimeout gives every Query, QueryRow and Exec a deadline, so a slow
+// query fails instead of holding its connection while callers queue for the
+// pool. The deadline covers reading a query's rows; it ends when they are
+// closed.
+type queryTimeout struct {
+	timeout time.Duration
+	next    pgx.QueryTracer // optional; runs inside the deadline
+}
+
+type cancelKey struct{}
+
+type noTimeoutKey struct{}
+
+// WithoutQueryTimeout exempts queries made with ctx from the per-query
+// deadline, for migrations and other work expected to run long. The server's
+// statement_timeout still applies unless the session resets it.
+func WithoutQueryTimeout(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noTimeoutKey{}, true)
+}
+
+func (t queryTimeout) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if exempt, _ := ctx.Value(noTimeoutKey{}).(bool); !exempt {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+		ctx = context.WithValue(ctx, cancelKey{}, cancel)
+	}
+	if t.next != nil {
+		ctx = t.next.TraceQueryStart(ctx, conn, data)
+	}
+	return ctx
+}
+
+func (t queryTimeout) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	if t.next != nil {
+		t.next.TraceQueryEnd(ctx, conn, data)
+	}
+	if cancel, ok := ctx.Value(cancelKey{}).(context.CancelFunc); ok {
+		cancel()
+	}
+}
@@ -0,0 +1,41 @@
+package db
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type txKey struct{}
+
+// Within returns ctx carrying tx, so that WithTx called with it runs in tx
+// rather than in a transaction of its own: a repository's write then
+// commits or rolls back with the caller's other writes.
+func Within(ctx context.Context, tx pgx.Tx) context.Context {
+	return context.WithValue(ctx, txKey{}, tx)
+}
+
+// WithTx runs fn in a transaction on pool. It commits when fn returns nil and
+// rolls back on error or panic, so callers never leak an open transaction.
+// When ctx carries a transaction (see Within), fn runs in that one instead
+// and its owner commits or rolls back.
+//
+// Multi-step state changes should lock the rows they read with
+// SELECT ... FOR UPDATE inside fn; concurrent writers then wait instead of
+// acting on a stale read.
+func WithTx(ctx context.Context, pool *pgxpool.Pool, fn func(tx pgx.Tx) error) error {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return fn(tx)
+	}
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx) // no-op after a successful Commit
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
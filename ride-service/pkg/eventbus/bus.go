@@ -0,0 +1,77 @@
+// Package eventbus carries events between the service's producers and
+// consumers. Kafka (pkg/kafka) is the default Bus; NATS JetStream suits
+// smaller deployments, and Memory keeps everything in one process for tests
+// and local development.
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"ride-service/pkg/logging"
+)
+
+var logger = logging.For("eventbus")
+
+// Backends selectable with EVENT_BUS.
+const (
+	BackendKafka  = "kafka"
+	BackendNATS   = "nats"
+	BackendMemory = "memory"
+)
+
+// Well-known topic names.
+const (
+	TopicRideRequested  = "ride.requested"
+	TopicDriverAssigned = "driver.assigned"
+	TopicTripCompleted  = "trip.completed"
+	TopicTipAdded       = "tip.added"
+	TopicTripNoShow     = "trip.no_show"
+	TopicFareAdjusted   = "fare.adjusted"
+	TopicTripCancelled  = "trip.cancelled"
+)
+
+// DLQTopic returns the dead-letter topic for topic.
+func DLQTopic(topic string) string { return topic + ".dlq" }
+
+// Handler processes one message. ctx outlives shutdown of the subscription so
+// a message that is already being handled can finish cleanly.
+type Handler = func(ctx context.Context, data []byte) error
+
+// Bus publishes messages to topics and delivers them to subscriptions.
+//
+// Every subscription with the same group shares one stream of the topic's
+// messages: each message is handled once per group, after it succeeded or
+// was moved to the topic's dead-letter queue. Cancelling the context passed
+// to Subscribe stops the subscription once its current message is done.
+type Bus interface {
+	Publish(ctx context.Context, topic, key string, value any) error
+	// PublishRaw sends pre-serialised bytes unchanged.
+	PublishRaw(ctx context.Context, topic, key string, value []byte) error
+	Subscribe(ctx context.Context, topic, groupID string, handler Handler)
+	// EnsureTopics creates the topics where the backend needs that up front.
+	EnsureTopics(ctx context.Context, topics ...string) error
+	// Ping checks that the backend is reachable.
+	Ping(ctx context.Context) error
+	// Tail returns up to limit of the most recent records of topic per
+	// partition, committing nothing.
+	Tail(ctx context.Context, topic string, limit int) ([]Record, error)
+	// ReadAt fetches the record at partition and offset of topic.
+	ReadAt(ctx context.Context, topic string, partition int, offset int64) (*Record, error)
+	// Wait blocks until every subscription has finished its in-flight
+	// messages, or until ctx expires. Cancel the subscriptions first.
+	Wait(ctx context.Context) error
+}
+
+// Record is a message read back from a topic by partition and offset.
+type Record struct {
+	Partition int       `json:"partition"`
+	Offset    int64     `json:"offset"`
+	Key       string    `json:"key"`
+	Value     []byte    `json:"-"`
+	Time      time.Time `json:"time"`
+}
+
+// ErrNoRecord is returned by ReadAt when the offset is outside the partition.
+var ErrNoRecord = errors.New("eventbus: no record at offset")
@@ -0,0 +1,137 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"ride-service/pkg/faults"
+)
+
+// Retry says how often a failing handler is retried before its message is
+// dead-lettered.
+type Retry struct {
+	MaxRetries int
+	Backoff    time.Duration // first retry delay; doubles on each attempt
+}
+
+// Message is one delivery to a subscription.
+type Message struct {
+	Topic     string
+	Partition int
+	Offset    int64
+	Key       []byte
+	Value     []byte
+}
+
+// DeadLetter is the payload written to a dead-letter topic.
+type DeadLetter struct {
+	Topic     string          `json:"topic"`
+	GroupID   string          `json:"group_id"`
+	Partition int             `json:"partition"`
+	Offset    int64           `json:"offset"`
+	Key       string          `json:"key"`
+	Payload   json.RawMessage `json:"payload"`
+	Encoding  string          `json:"encoding"` // "json", or "string" when the original was not valid JSON
+	Error     string          `json:"error"`
+	Attempts  int             `json:"attempts"`
+	FailedAt  time.Time       `json:"failed_at"`
+}
+
+func newDeadLetter(msg Message, groupID string, err error, attempts int) DeadLetter {
+	dl := DeadLetter{
+		Topic:     msg.Topic,
+		GroupID:   groupID,
+		Partition: msg.Partition,
+		Offset:    msg.Offset,
+		Key:       string(msg.Key),
+		Payload:   msg.Value,
+		Encoding:  "json",
+		Error:     err.Error(),
+		Attempts:  attempts,
+		FailedAt:  time.Now().UTC(),
+	}
+	if !json.Valid(msg.Value) {
+		dl.Payload, _ = json.Marshal(string(msg.Value))
+		dl.Encoding = "string"
+	}
+	return dl
+}
+
+// OriginalValue returns the bytes of the message as first published.
+func (d DeadLetter) OriginalValue() ([]byte, error) {
+	if d.Encoding != "string" {
+		return d.Payload, nil
+	}
+	var s string
+	if err := json.Unmarshal(d.Payload, &s); err != nil {
+		return nil, err
+	}
+	return []byte(s), nil
+}
+
+// Dead-letter publishes that fail are retried, and only they: the handler
+// has had its attempts. The delay starts at the handler's backoff (or
+// dlqFirstBackoff without one) and doubles up to dlqMaxBackoff.
+const (
+	dlqFirstBackoff = 100 * time.Millisecond
+	dlqMaxBackoff   = 30 * time.Second
+)
+
+// Deliver runs handler with retries and dead-letters the message through bus
+// once they are exhausted, retrying the dead-letter publish until it goes
+// through. It returns false only if ctx was cancelled first; the message
+// must not be acknowledged then.
+func Deliver(ctx, handlerCtx context.Context, bus Bus, r Retry, groupID string, msg Message, handler Handler) bool {
+	backoff := r.Backoff
+	var err error
+	for attempt := 0; attempt <= r.MaxRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(backoff):
+				backoff *= 2
+			case <-ctx.Done():
+				return false
+			}
+		}
+		// An injected fault counts as a handler failure, exercising the
+		// retry and dead-letter path.
+		if err = faults.Inject(handlerCtx, faults.TargetKafka); err == nil {
+			if err = handler(handlerCtx, msg.Value); err == nil {
+				return true
+			}
+		}
+		logger.Warn("handler failed", "topic", msg.Topic, "partition", msg.Partition, "offset", msg.Offset,
+			"attempt", attempt+1, "max_attempts", r.MaxRetries+1, "err", err)
+	}
+
+	if !deadLetter(ctx, handlerCtx, bus, r.Backoff, newDeadLetter(msg, groupID, err, r.MaxRetries+1)) {
+		return false
+	}
+	logger.Warn("message dead-lettered", "topic", msg.Topic, "partition", msg.Partition,
+		"offset", msg.Offset, "dlq", DLQTopic(msg.Topic))
+	return true
+}
+
+// deadLetter publishes dl to its topic's dead-letter queue, backing off
+// between failed attempts. It returns false if ctx is cancelled first.
+func deadLetter(ctx, handlerCtx context.Context, bus Bus, backoff time.Duration, dl DeadLetter) bool {
+	if backoff <= 0 {
+		backoff = dlqFirstBackoff
+	}
+	for attempt := 1; ; attempt++ {
+		err := bus.Publish(handlerCtx, DLQTopic(dl.Topic), dl.Key, dl)
+		if err == nil {
+			return true
+		}
+		// Losing the message silently is worse than holding up its partition.
+		logger.Error("dead-letter publish failed", "topic", dl.Topic, "partition", dl.Partition,
+			"offset", dl.Offset, "attempt", attempt, "retry_in", backoff, "err", err)
+		select {
+		case <-time.After(backoff):
+			backoff = min(2*backoff, dlqMaxBackoff)
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package eventbus_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ride-service/pkg/eventbus"
+	"ride-service/pkg/kafka"
+)
+
+// flakyDLQ fails its first failures publishes, then stores them in memory.
+type flakyDLQ struct {
+	*kafka.Memory
+	failures  int
+	published atomic.Int32
+}
+
+func (b *flakyDLQ) Publish(ctx context.Context, topic, key string, value any) error {
+	if int(b.published.Add(1)) <= b.failures {
+		return errors.New("bus down")
+	}
+	return b.Memory.Publish(ctx, topic, key, value)
+}
+
+func TestDeliverRetriesOnlyTheDeadLetterPublish(t *testing.T) {
+	for _, maxRetries := range []int{0, 2} {
+		ctx := context.Background()
+		bus := &flakyDLQ{Memory: kafka.NewMemory(eventbus.Retry{}), failures: 3}
+		var calls int
+		handler := func(context.Context, []byte) error { calls++; return errors.New("bad message") }
+		msg := eventbus.Message{Topic: "trip.completed", Offset: 7, Key: []byte("trip-1"), Value: []byte(`{}`)}
+
+		if !eventbus.Deliver(ctx, ctx, bus, eventbus.Retry{MaxRetries: maxRetries, Backoff: time.Millisecond}, "g", msg, handler) {
+			t.Fatalf("max retries %d: Deliver = false", maxRetries)
+		}
+		if calls != maxRetries+1 {
+			t.Errorf("max retries %d: handler ran %d times, want %d", maxRetries, calls, maxRetries+1)
+		}
+		if got := bus.published.Load(); got != 4 {
+			t.Errorf("max retries %d: %d dead-letter publishes, want 4", maxRetries, got)
+		}
+		recs, err := bus.Tail(ctx, eventbus.DLQTopic(msg.Topic), 10)
+		if err != nil || len(recs) != 1 {
+			t.Fatalf("max retries %d: dead-letter queue holds %d (%v), want 1", maxRetries, len(recs), err)
+		}
+	}
+}
+
+func TestDeliverStopsRetryingTheDeadLetterOnShutdown(t *testing.T) {
+	bus := &flakyDLQ{Memory: kafka.NewMemory(eventbus.Retry{}), failures: 1 << 30}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	var calls int
+	handler := func(context.Context, []byte) error { calls++; return errors.New("bad message") }
+
+	if eventbus.Deliver(ctx, context.Background(), bus, eventbus.Retry{}, "g", eventbus.Message{Topic: "t", Value: []byte(`{}`)}, handler) {
+		t.Fatal("Deliver = true without a dead letter")
+	}
+	if calls != 1 {
+		t.Errorf("handler ran %d times, want 1", calls)
+	}
+	// Backing off from dlqFirstBackoff: a handful of attempts, not a spin.
+	if got := bus.published.Load(); got > 5 {
+		t.Errorf("%d dead-letter publishes in 50ms", got)
+	}
+}
@@ -0,0 +1,307 @@
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"ride-service/pkg/faults"
+)
+
+// NATSOptions configures a NATS JetStream bus.
+type NATSOptions struct {
+	URL             string // nats://[user:pass@]host:port, or tls:// to require TLS
+	Stream          string // JetStream stream holding every topic
+	ConnectAttempts int
+	Retry           Retry
+}
+
+const (
+	// natsAckWait is how long JetStream waits for an ack before redelivering.
+	// Messages still being handled are kept alive with progress acks.
+	natsAckWait = 30 * time.Second
+	// natsPullWait is how long one pull request waits for a message.
+	natsPullWait = 5 * time.Second
+	// natsAPITimeout bounds every other JetStream API request.
+	natsAPITimeout = 5 * time.Second
+)
+
+// NATS is a Bus on NATS JetStream. Every topic is a subject of one stream,
+// <stream>.<topic>, and every group is a durable pull consumer filtered to
+// its topic that lets one message be in flight at a time, so a topic is
+// handled in publish order, like a single Kafka partition. A record's offset
+// is its stream sequence and its partition is always 0.
+type NATS struct {
+	nc     *nats.Conn
+	js     jetstream.JetStream
+	stream string
+	retry  Retry
+	wg     sync.WaitGroup // one per running subscriber goroutine
+}
+
+// DialNATS connects to the server, retrying like the Kafka client does. Once
+// connected, the client reconnects by itself for as long as it runs.
+func DialNATS(ctx context.Context, opts NATSOptions) (*NATS, error) {
+	var err error
+	for attempt := 1; attempt <= max(opts.ConnectAttempts, 1); attempt++ {
+		var nc *nats.Conn
+		nc, err = nats.Connect(opts.URL,
+			nats.Name("ride-service"),
+			nats.MaxReconnects(-1),
+			nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+				logger.Warn("nats disconnected", "err", err)
+			}),
+			nats.ReconnectHandler(func(nc *nats.Conn) {
+				logger.Info("nats reconnected", "server", nc.ConnectedUrlRedacted())
+			}))
+		if err == nil {
+			js, jsErr := jetstream.New(nc)
+			if jsErr == nil {
+				return &NATS{nc: nc, js: js, stream: opts.Stream, retry: opts.Retry}, nil
+			}
+			nc.Close()
+			err = jsErr
+		}
+		logger.Warn("nats not ready, retrying in 3s", "attempt", attempt, "of", opts.ConnectAttempts, "err", err)
+		select {
+		case <-time.After(3 * time.Second):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return nil, fmt.Errorf("eventbus: could not connect to nats after %d attempts: %w", opts.ConnectAttempts, err)
+}
+
+// Close drains the connection: what was published is flushed first.
+func (n *NATS) Close() error { return n.nc.Drain() }
+
+func (n *NATS) subject(topic string) string { return n.stream + "." + topic }
+
+// durable names group's consumer of topic; consumer names may not hold dots.
+func (n *NATS) durable(topic, groupID string) string {
+	return strings.NewReplacer(".", "_", "*", "_", ">", "_").Replace(groupID + "__" + topic)
+}
+
+// EnsureTopics creates the stream; every topic lives in it, so the topics
+// themselves need nothing. A stream already configured by an operator is
+// left as it is.
+func (n *NATS) EnsureTopics(ctx context.Context, topics ...string) error {
+	ctx, cancel := context.WithTimeout(ctx, natsAPITimeout)
+	defer cancel()
+	_, err := n.js.Stream(ctx, n.stream)
+	if !errors.Is(err, jetstream.ErrStreamNotFound) {
+		return err
+	}
+	_, err = n.js.CreateStream(ctx, jetstream.StreamConfig{
+		Name:      n.stream,
+		Subjects:  []string{n.stream + ".>"},
+		Retention: jetstream.LimitsPolicy,
+		Storage:   jetstream.FileStorage,
+	})
+	if errors.Is(err, jetstream.ErrStreamNameAlreadyInUse) {
+		return nil // another instance created it meanwhile
+	}
+	if err == nil {
+		logger.Info("nats stream ensured", "stream", n.stream)
+	}
+	return err
+}
+
+// Ping round-trips to the server.
+func (n *NATS) Ping(ctx context.Context) error {
+	return n.nc.FlushWithContext(ctx)
+}
+
+func (n *NATS) Publish(ctx context.Context, topic, key string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return n.PublishRaw(ctx, topic, key, data)
+}
+
+// PublishRaw waits for JetStream to acknowledge that the message is stored.
+// The key travels in the Ride-Key header.
+func (n *NATS) PublishRaw(ctx context.Context, topic, key string, value []byte) error {
+	if err := faults.Inject(ctx, faults.TargetKafka); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, natsAPITimeout)
+	defer cancel()
+	msg := nats.NewMsg(n.subject(topic))
+	msg.Header.Set("Ride-Key", key)
+	msg.Data = value
+	_, err := n.js.PublishMsg(ctx, msg)
+	return err
+}
+
+// Subscribe creates or reuses groupID's durable consumer of topic and pulls
+// from it in the background. A message is acked once handled: the handler
+// succeeded or it was dead-lettered. One cancelled mid-retry, on shutdown,
+// is nacked so another instance gets it straight away.
+func (n *NATS) Subscribe(ctx context.Context, topic, groupID string, handler Handler) {
+	handlerCtx := context.WithoutCancel(ctx)
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		var cons jetstream.Consumer
+		for ctx.Err() == nil {
+			var err error
+			if cons, err = n.consumer(ctx, topic, groupID); err == nil {
+				break
+			}
+			logger.Error("nats consumer create failed", "topic", topic, "group", groupID, "err", err)
+			sleep(ctx, time.Second)
+		}
+		for ctx.Err() == nil {
+			batch, err := cons.Fetch(1, jetstream.FetchMaxWait(natsPullWait))
+			if err != nil {
+				logger.Error("nats pull failed", "topic", topic, "group", groupID, "err", err)
+				sleep(ctx, time.Second)
+				continue
+			}
+			for msg := range batch.Messages() {
+				n.deliver(ctx, handlerCtx, topic, groupID, msg, handler)
+			}
+			if err := batch.Error(); err != nil && !errors.Is(err, nats.ErrTimeout) && ctx.Err() == nil {
+				logger.Error("nats pull failed", "topic", topic, "group", groupID, "err", err)
+				sleep(ctx, time.Second)
+			}
+		}
+		logger.Info("consumer stopped", "group", groupID, "topic", topic)
+	}()
+	logger.Info("consumer started", "group", groupID, "topic", topic, "bus", BackendNATS, "stream", n.stream)
+}
+
+// consumer creates or updates groupID's durable consumer of topic.
+func (n *NATS) consumer(ctx context.Context, topic, groupID string) (jetstream.Consumer, error) {
+	ctx, cancel := context.WithTimeout(ctx, natsAPITimeout)
+	defer cancel()
+	return n.js.CreateOrUpdateConsumer(ctx, n.stream, jetstream.ConsumerConfig{
+		Durable:       n.durable(topic, groupID),
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		DeliverPolicy: jetstream.DeliverAllPolicy,
+		FilterSubject: n.subject(topic),
+		AckWait:       natsAckWait,
+		MaxAckPending: 1,
+	})
+}
+
+// deliver handles msg with Deliver, reporting progress to JetStream until it
+// is done, then acks or nacks it.
+func (n *NATS) deliver(ctx, handlerCtx context.Context, topic, groupID string, msg jetstream.Msg, handler Handler) {
+	done := make(chan struct{})
+	go func() {
+		t := time.NewTicker(natsAckWait / 3)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if err := msg.InProgress(); err != nil {
+					logger.Warn("nats progress ack failed", "topic", topic, "err", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var seq int64
+	if meta, err := msg.Metadata(); err == nil {
+		seq = int64(meta.Sequence.Stream)
+	}
+	m := Message{Topic: topic, Offset: seq, Key: []byte(msg.Headers().Get("Ride-Key")), Value: msg.Data()}
+	ok := Deliver(ctx, handlerCtx, n, n.retry, groupID, m, handler)
+	close(done)
+
+	ack := msg.Ack
+	if !ok {
+		ack = msg.Nak
+	}
+	if err := ack(); err != nil {
+		// JetStream redelivers it once natsAckWait has passed.
+		logger.Error("nats ack failed", "topic", topic, "offset", seq, "err", err)
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-time.After(d):
+	case <-ctx.Done():
+	}
+}
+
+// get fetches one stored message. With next set it returns the first message
+// of topic at or after seq instead of the one at seq.
+func (n *NATS) get(ctx context.Context, topic string, seq int64, next bool) (*Record, error) {
+	ctx, cancel := context.WithTimeout(ctx, natsAPITimeout)
+	defer cancel()
+	stream, err := n.js.Stream(ctx, n.stream)
+	if err != nil {
+		return nil, err
+	}
+	var opts []jetstream.GetMsgOpt
+	if next {
+		opts = append(opts, jetstream.WithGetMsgSubject(n.subject(topic)))
+	}
+	m, err := stream.GetMsg(ctx, uint64(seq), opts...)
+	if errors.Is(err, jetstream.ErrMsgNotFound) {
+		return nil, ErrNoRecord
+	}
+	if err != nil {
+		return nil, err
+	}
+	if m.Subject != n.subject(topic) {
+		return nil, ErrNoRecord
+	}
+	return &Record{Offset: int64(m.Sequence), Key: m.Header.Get("Ride-Key"), Value: m.Data, Time: m.Time}, nil
+}
+
+// Tail walks topic from its first stored message, keeping the last limit. It
+// costs a request per message of the topic, so it suits small topics such as
+// dead-letter queues.
+func (n *NATS) Tail(ctx context.Context, topic string, limit int) ([]Record, error) {
+	var out []Record
+	for seq := int64(1); ; {
+		rec, err := n.get(ctx, topic, seq, true)
+		if errors.Is(err, ErrNoRecord) {
+			return out, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, *rec)
+		if len(out) > limit {
+			out = out[1:]
+		}
+		seq = rec.Offset + 1
+	}
+}
+
+func (n *NATS) ReadAt(ctx context.Context, topic string, partition int, offset int64) (*Record, error) {
+	if partition != 0 || offset < 1 {
+		return nil, ErrNoRecord
+	}
+	return n.get(ctx, topic, offset, false)
+}
+
+func (n *NATS) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		n.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("eventbus: consumers did not drain: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,127 @@
+package faults
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+	"ride-service/pkg/logging"
+)
+
+// Targets that accept injected faults.
+const (
+	TargetRedis = "redis"
+	TargetKafka = "kafka"
+	TargetDB    = "db"
+)
+
+// ErrInjected is returned by Inject when a fault fires.
+var ErrInjected = errors.New("injected fault")
+
+// Rule describes the faults applied to one target. Percentages are 0–100.
+type Rule struct {
+	ErrorPercent   float64 `json:"error_percent"`
+	LatencyMs      int     `json:"latency_ms"`
+	LatencyPercent float64 `json:"latency_percent"`
+}
+
+var (
+	mu      sync.RWMutex
+	enabled bool
+	rules   = map[string]Rule{}
+	logger  = logging.For("faults")
+)
+
+// Enable turns fault injection on. Call it only in non-production
+// environments; until it is called Inject is a no-op.
+func Enable() {
+	mu.Lock()
+	enabled = true
+	mu.Unlock()
+	logger.Warn("fault injection enabled")
+}
+
+// Inject applies target's rule: it may sleep, and it may return ErrInjected.
+// Latency respects ctx cancellation.
+func Inject(ctx context.Context, target string) error {
+	mu.RLock()
+	rule, ok := rules[target]
+	on := enabled
+	mu.RUnlock()
+	if !on || !ok {
+		return nil
+	}
+
+	if rule.LatencyMs > 0 && rand.Float64()*100 < rule.LatencyPercent {
+		select {
+		case <-time.After(time.Duration(rule.LatencyMs) * time.Millisecond):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if rand.Float64()*100 < rule.ErrorPercent {
+		return fmt.Errorf("%s: %w", target, ErrInjected)
+	}
+	return nil
+}
+
+func validTarget(t string) bool {
+	return t == TargetRedis || t == TargetKafka || t == TargetDB
+}
+
+// ---- Admin HTTP API ----
+
+// Routes returns a chi.Router for the /admin/faults mount point.
+func Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+	r.Use(jwt.RequireRole("admin"))
+
+	r.Get("/", func(w http.ResponseWriter, _ *http.Request) {
+		mu.RLock()
+		defer mu.RUnlock()
+		apierror.WriteJSON(w, http.StatusOK, map[string]any{"rules": rules})
+	})
+	r.Put("/{target}", func(w http.ResponseWriter, r *http.Request) {
+		target := chi.URLParam(r, "target")
+		if !validTarget(target) {
+			apierror.Write(w, apierror.NotFound("target must be redis, kafka or db"))
+			return
+		}
+		var rule Rule
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			apierror.Write(w, apierror.Validation("invalid body"))
+			return
+		}
+		if rule.ErrorPercent < 0 || rule.ErrorPercent > 100 ||
+			rule.LatencyPercent < 0 || rule.LatencyPercent > 100 || rule.LatencyMs < 0 {
+			apierror.Write(w, apierror.Validation("percentages must be 0-100 and latency non-negative"))
+			return
+		}
+		mu.Lock()
+		rules[target] = rule
+		mu.Unlock()
+		logger.Warn("fault rule set", "target", target, "error_percent", rule.ErrorPercent,
+			"latency_ms", rule.LatencyMs, "latency_percent", rule.LatencyPercent)
+		apierror.WriteJSON(w, http.StatusOK, rule)
+	})
+	r.Delete("/{target}", func(w http.ResponseWriter, r *http.Request) {
+		target := chi.URLParam(r, "target")
+		mu.Lock()
+		delete(rules, target)
+		mu.Unlock()
+		logger.Info("fault rule cleared", "target", target)
+		apierror.WriteJSON(w, http.StatusOK, map[string]string{"status": "cleared"})
+	})
+
+	return r
+}
@@ -0,0 +1,56 @@
+package faults
+
+import (
+	"context"
+	"net"
+
+	"github.com/jackc/pgx/v5"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// RedisHook injects TargetRedis faults into every command and pipeline.
+type RedisHook struct{}
+
+func (RedisHook) DialHook(next goredis.DialHook) goredis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (RedisHook) ProcessHook(next goredis.ProcessHook) goredis.ProcessHook {
+	return func(ctx context.Context, cmd goredis.Cmder) error {
+		if err := Inject(ctx, TargetRedis); err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (RedisHook) ProcessPipelineHook(next goredis.ProcessPipelineHook) goredis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []goredis.Cmder) error {
+		if err := Inject(ctx, TargetRedis); err != nil {
+			for _, cmd := range cmds {
+				cmd.SetErr(err)
+			}
+			return err
+		}
+		return next(ctx, cmds)
+	}
+}
+
+// DBTracer injects TargetDB faults into pgx Query, QueryRow and Exec calls.
+// pgx tracers cannot return errors, so a fault is delivered by handing back
+// an already-cancelled context, which pgx rejects before touching the wire.
+type DBTracer struct{}
+
+func (DBTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, _ pgx.TraceQueryStartData) context.Context {
+	if err := Inject(ctx, TargetDB); err != nil {
+		cctx, cancel := context.WithCancelCause(ctx)
+		cancel(err)
+		return cctx
+	}
+	return ctx
+}
+
+func (DBTracer) TraceQueryEnd(context.Context, *pgx.Conn, pgx.TraceQueryEndData) {}
@@ -0,0 +1,270 @@
+// Package featureflags rolls risky changes out gradually. A flag is on for a
+// subject — a rider, a driver or a staff user, and the city they are in —
+// when it is enabled and either lists the subject, or covers their city (or
+// every city) and their stable bucket falls inside its rollout percentage.
+// Raising the percentage only ever adds subjects, and each flag buckets
+// subjects independently.
+//
+// Flags are stored in Redis and every instance evaluates its own copy,
+// reloaded every few seconds, so checking a flag costs no round trip and an
+// unreachable Redis keeps the last flags loaded. Flags the code knows about
+// have a default that applies until an admin sets them.
+package featureflags
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/logging"
+)
+
+var logger = logging.For("featureflags")
+
+// Flags wired into the service.
+const (
+	// MatchingScoreV2 scores match candidates with the v2 algorithm, for
+	// the rider requesting and the radius city of the pickup.
+	MatchingScoreV2 = "matching.score_v2"
+	// PricingSurgeV2 scales fare quotes by local demand, for the rider
+	// asking and the quote's city.
+	PricingSurgeV2 = "pricing.surge_v2"
+	// ExportsAPI lets staff queue bulk exports at POST /admin/exports; turn
+	// it off to stop new exports without a deploy.
+	ExportsAPI = "api.exports"
+)
+
+// Defaults are the flags the code knows about, as they apply until set.
+var Defaults = []Flag{
+	{Key: MatchingScoreV2, Description: "Score match candidates with the v2 algorithm"},
+	{Key: PricingSurgeV2, Description: "Scale fare quotes by demand around the pickup"},
+	{Key: ExportsAPI, Description: "Allow new bulk exports", Enabled: true, Percent: 100},
+}
+
+var (
+	ErrNotFound    = apierror.NotFound("no such feature flag")
+	ErrInvalid     = apierror.Validation("invalid feature flag")
+	ErrUnavailable = apierror.NotFound("this feature is not available").WithCode("feature_unavailable")
+)
+
+var keyPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+// Flag is a feature flag. Percent is 0–100, of the subjects in its cities.
+type Flag struct {
+	Key         string  `json:"key"`
+	Description string  `json:"description,omitempty"`
+	Enabled     bool    `json:"enabled"`
+	Percent     float64 `json:"percent"`
+	// Subjects are user and driver IDs the flag is on for whatever their
+	// city and bucket.
+	Subjects []string `json:"subjects,omitempty"`
+	// Cities limit the rollout; empty covers every city.
+	Cities    []string   `json:"cities,omitempty"`
+	UpdatedBy string     `json:"updated_by,omitempty"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+	// Default is set when no admin has set the flag.
+	Default bool `json:"default,omitempty"`
+}
+
+// Subject is who and where a flag is checked for. Either may be empty: a
+// subject without an ID is only in a rollout at 100%, one without a city
+// only in flags that cover every city.
+type Subject struct {
+	ID   string
+	City string
+}
+
+// On reports whether fl is on for s.
+func (fl Flag) On(s Subject) bool {
+	if !fl.Enabled {
+		return false
+	}
+	if s.ID != "" && slices.Contains(fl.Subjects, s.ID) {
+		return true
+	}
+	if len(fl.Cities) > 0 && !slices.ContainsFunc(fl.Cities, func(c string) bool { return strings.EqualFold(c, s.City) }) {
+		return false
+	}
+	if fl.Percent >= 100 {
+		return true
+	}
+	if s.ID == "" || fl.Percent <= 0 {
+		return false
+	}
+	return bucket(fl.Key, s.ID) < fl.Percent
+}
+
+// bucket places id in [0, 100) for flag key, in steps of 0.01.
+func bucket(key, id string) float64 {
+	h := fnv.New64a()
+	h.Write([]byte(key + ":" + id))
+	return float64(h.Sum64()%10000) / 100
+}
+
+func (fl Flag) check() error {
+	if !keyPattern.MatchString(fl.Key) {
+		return fmt.Errorf("%w: keys are 1-64 lowercase letters, digits, dots, dashes and underscores", ErrInvalid)
+	}
+	if fl.Percent < 0 || fl.Percent > 100 {
+		return fmt.Errorf("%w: percent must be 0-100", ErrInvalid)
+	}
+	if len(fl.Description) > 200 || len(fl.Subjects) > 1000 || len(fl.Cities) > 100 {
+		return fmt.Errorf("%w: at most 200 characters of description, 1000 subjects and 100 cities", ErrInvalid)
+	}
+	return nil
+}
+
+// Store keeps flags as JSON by key; the Redis client implements it.
+type Store interface {
+	FeatureFlags(ctx context.Context) (map[string]string, error)
+	SetFeatureFlag(ctx context.Context, key, value string) error
+	DeleteFeatureFlag(ctx context.Context, key string) (bool, error)
+}
+
+// Flags evaluates feature flags. A nil Flags evaluates the defaults.
+type Flags struct {
+	store Store
+
+	mu    sync.RWMutex
+	flags map[string]Flag // as stored; defaults are not copied in
+}
+
+// New returns Flags kept in store. Call Start to load them.
+func New(store Store) *Flags {
+	return &Flags{store: store, flags: map[string]Flag{}}
+}
+
+// Start loads the stored flags and reloads them every interval until ctx
+// is done.
+func (f *Flags) Start(ctx context.Context, every time.Duration) {
+	if err := f.Refresh(ctx); err != nil {
+		logger.Warn("feature flags not loaded; using defaults until the next refresh", "err", err)
+	}
+	go func() {
+		t := time.NewTicker(every)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				if err := f.Refresh(ctx); err != nil {
+					logger.Warn("feature flag refresh failed; keeping the last ones", "err", err)
+				}
+			}
+		}
+	}()
+}
+
+// Refresh reloads the stored flags. A flag that no longer decodes is
+// dropped with a warning rather than failing the rest.
+func (f *Flags) Refresh(ctx context.Context) error {
+	stored, err := f.store.FeatureFlags(ctx)
+	if err != nil {
+		return err
+	}
+	flags := make(map[string]Flag, len(stored))
+	for key, v := range stored {
+		var fl Flag
+		if err := json.Unmarshal([]byte(v), &fl); err != nil {
+			logger.Warn("skipping undecodable feature flag", "key", key, "err", err)
+			continue
+		}
+		fl.Key = key
+		flags[key] = fl
+	}
+	f.mu.Lock()
+	f.flags = flags
+	f.mu.Unlock()
+	return nil
+}
+
+// Enabled reports whether flag key is on for s. Unknown flags are off.
+func (f *Flags) Enabled(key string, s Subject) bool {
+	fl, ok := f.Get(key)
+	return ok && fl.On(s)
+}
+
+// Get returns flag key as it applies: as set, or its default.
+func (f *Flags) Get(key string) (Flag, bool) {
+	if f != nil {
+		f.mu.RLock()
+		fl, ok := f.flags[key]
+		f.mu.RUnlock()
+		if ok {
+			return fl, true
+		}
+	}
+	for _, d := range Defaults {
+		if d.Key == key {
+			d.Default = true
+			return d, true
+		}
+	}
+	return Flag{}, false
+}
+
+// List returns every flag that applies, set or default, by key.
+func (f *Flags) List() []Flag {
+	f.mu.RLock()
+	out := make([]Flag, 0, len(f.flags)+len(Defaults))
+	for _, fl := range f.flags {
+		out = append(out, fl)
+	}
+	f.mu.RUnlock()
+	for _, d := range Defaults {
+		if !slices.ContainsFunc(out, func(fl Flag) bool { return fl.Key == d.Key }) {
+			d.Default = true
+			out = append(out, d)
+		}
+	}
+	slices.SortFunc(out, func(a, b Flag) int { return strings.Compare(a.Key, b.Key) })
+	return out
+}
+
+// Set stores fl on behalf of by. It applies here at once and on the other
+// instances at their next refresh.
+func (f *Flags) Set(ctx context.Context, fl Flag, by string) (Flag, error) {
+	if err := fl.check(); err != nil {
+		return Flag{}, err
+	}
+	now := time.Now().UTC()
+	fl.UpdatedBy, fl.UpdatedAt, fl.Default = by, &now, false
+	data, err := json.Marshal(fl)
+	if err != nil {
+		return Flag{}, err
+	}
+	if err := f.store.SetFeatureFlag(ctx, fl.Key, string(data)); err != nil {
+		return Flag{}, err
+	}
+	f.mu.Lock()
+	f.flags[fl.Key] = fl
+	f.mu.Unlock()
+	logger.Info("feature flag set", "key", fl.Key, "enabled", fl.Enabled, "percent", fl.Percent,
+		"subjects", len(fl.Subjects), "cities", fl.Cities, "by", by)
+	return fl, nil
+}
+
+// Delete removes the flag set under key, so a known flag goes back to its
+// default.
+func (f *Flags) Delete(ctx context.Context, key, by string) error {
+	found, err := f.store.DeleteFeatureFlag(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrNotFound
+	}
+	f.mu.Lock()
+	delete(f.flags, key)
+	f.mu.Unlock()
+	logger.Info("feature flag cleared", "key", key, "by", by)
+	return nil
+}
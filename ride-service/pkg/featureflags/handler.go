@@ -0,0 +1,98 @@
+package featureflags
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+)
+
+// Update is the body of PUT /admin/feature-flags/{key}. It replaces the
+// whole flag.
+type Update struct {
+	Description string   `json:"description"`
+	Enabled     bool     `json:"enabled"`
+	Percent     float64  `json:"percent"`
+	Subjects    []string `json:"subjects"`
+	Cities      []string `json:"cities"`
+}
+
+// Routes returns a chi.Router for the /admin/feature-flags mount point.
+func (f *Flags) Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+	r.Use(jwt.RequireRole("admin"))
+
+	r.Get("/", func(w http.ResponseWriter, _ *http.Request) {
+		apierror.WriteJSON(w, http.StatusOK, map[string]any{"flags": f.List()})
+	})
+	r.Get("/{key}", func(w http.ResponseWriter, r *http.Request) {
+		fl, ok := f.Get(chi.URLParam(r, "key"))
+		if !ok {
+			apierror.Write(w, ErrNotFound)
+			return
+		}
+		apierror.WriteJSON(w, http.StatusOK, fl)
+	})
+	// GET /{key}/check?subject=&city= tells whether the flag is on for a
+	// user or driver, to answer "why do I (not) see it".
+	r.Get("/{key}/check", func(w http.ResponseWriter, r *http.Request) {
+		fl, ok := f.Get(chi.URLParam(r, "key"))
+		if !ok {
+			apierror.Write(w, ErrNotFound)
+			return
+		}
+		s := Subject{ID: r.URL.Query().Get("subject"), City: r.URL.Query().Get("city")}
+		apierror.WriteJSON(w, http.StatusOK, map[string]any{"key": fl.Key, "subject": s.ID, "city": s.City, "on": fl.On(s)})
+	})
+	r.Put("/{key}", func(w http.ResponseWriter, r *http.Request) {
+		var u Update
+		if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+			apierror.Write(w, apierror.Validation("invalid body"))
+			return
+		}
+		fl, err := f.Set(r.Context(), Flag{Key: chi.URLParam(r, "key"), Description: u.Description, Enabled: u.Enabled,
+			Percent: u.Percent, Subjects: u.Subjects, Cities: u.Cities}, jwt.GetClaims(r.Context()).UserID)
+		if err != nil {
+			apierror.Write(w, err)
+			return
+		}
+		apierror.WriteJSON(w, http.StatusOK, fl)
+	})
+	r.Delete("/{key}", func(w http.ResponseWriter, r *http.Request) {
+		key := chi.URLParam(r, "key")
+		if err := f.Delete(r.Context(), key, jwt.GetClaims(r.Context()).UserID); err != nil {
+			apierror.Write(w, err)
+			return
+		}
+		fl, ok := f.Get(key)
+		if !ok {
+			apierror.WriteJSON(w, http.StatusOK, map[string]string{"status": "cleared"})
+			return
+		}
+		apierror.WriteJSON(w, http.StatusOK, fl)
+	})
+
+	return r
+}
+
+// Require answers 404 feature_unavailable to callers flag key is off for,
+// checked for the authenticated user; put it after jwt.RequireAuth.
+func (f *Flags) Require(key string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var s Subject
+			if c := jwt.GetClaims(r.Context()); c != nil {
+				s.ID = c.UserID
+			}
+			if !f.Enabled(key, s) {
+				apierror.Write(w, ErrUnavailable)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
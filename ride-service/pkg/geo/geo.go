@@ -0,0 +1,47 @@
+// Package geo defines the index of driver locations that nearby search,
+// matching and the ops map query. The Redis client implements it; PostGIS is
+// the alternative for deployments that want positions in PostgreSQL, and
+// Memory for single-instance runs without either.
+package geo
+
+import "context"
+
+// Backends selectable with GEO_BACKEND.
+const (
+	BackendRedis   = "redis"
+	BackendPostGIS = "postgis"
+	BackendMemory  = "memory"
+)
+
+// Position is a driver's last reported coordinate.
+type Position struct {
+	DriverID string
+	Lat      float64
+	Lng      float64
+}
+
+// Nearby is a matchable driver and their distance from the search point.
+type Nearby struct {
+	DriverID   string
+	DistanceKm float64
+}
+
+// Index stores driver positions. Drivers who report a location join the
+// matchable pool until removed from it; their last position is kept either
+// way.
+type Index interface {
+	SetDriverLocation(ctx context.Context, driverID string, lat, lng float64) error
+	SetDriverLocations(ctx context.Context, positions []Position) error
+	// SetDriverPositions stores positions without pooling the drivers,
+	// taking them out of the pool if they are in it.
+	SetDriverPositions(ctx context.Context, positions []Position) error
+	// RemoveDriverLocation takes the driver out of the matchable pool.
+	RemoveDriverLocation(ctx context.Context, driverID string) error
+	// SearchNearbyDrivers returns up to count drivers in the pool within
+	// radiusKm of lat, lng, nearest first; a count of 0 returns all of them.
+	SearchNearbyDrivers(ctx context.Context, lat, lng, radiusKm float64, count int) ([]Nearby, error)
+	GetNearbyDrivers(ctx context.Context, lat, lng, radiusKm float64, count int) ([]string, error)
+	// GetDriversInBox returns the last known positions inside the box,
+	// pooled or not.
+	GetDriversInBox(ctx context.Context, minLat, minLng, maxLat, maxLng float64) ([]Position, error)
+}
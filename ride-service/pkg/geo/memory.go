@@ -0,0 +1,108 @@
+package geo
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+)
+
+// Memory keeps positions in process memory, for single-instance runs without
+// Redis or PostGIS. Searches scan every driver, which is fine for the
+// hundreds a test or local setup has.
+type Memory struct {
+	mu      sync.RWMutex
+	drivers map[string]memoryDriver
+}
+
+type memoryDriver struct {
+	lat, lng float64
+	pool     bool
+}
+
+// NewMemory returns an empty in-memory Index.
+func NewMemory() *Memory {
+	return &Memory{drivers: map[string]memoryDriver{}}
+}
+
+func (m *Memory) SetDriverLocation(ctx context.Context, driverID string, lat, lng float64) error {
+	return m.SetDriverLocations(ctx, []Position{{DriverID: driverID, Lat: lat, Lng: lng}})
+}
+
+func (m *Memory) SetDriverLocations(_ context.Context, positions []Position) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range positions {
+		m.drivers[p.DriverID] = memoryDriver{lat: p.Lat, lng: p.Lng, pool: true}
+	}
+	return nil
+}
+
+func (m *Memory) SetDriverPositions(_ context.Context, positions []Position) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, p := range positions {
+		m.drivers[p.DriverID] = memoryDriver{lat: p.Lat, lng: p.Lng}
+	}
+	return nil
+}
+
+func (m *Memory) RemoveDriverLocation(_ context.Context, driverID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if d, ok := m.drivers[driverID]; ok {
+		d.pool = false
+		m.drivers[driverID] = d
+	}
+	return nil
+}
+
+func (m *Memory) SearchNearbyDrivers(_ context.Context, lat, lng, radiusKm float64, count int) ([]Nearby, error) {
+	m.mu.RLock()
+	out := []Nearby{}
+	for id, d := range m.drivers {
+		if !d.pool {
+			continue
+		}
+		if km := haversineKm(lat, lng, d.lat, d.lng); km <= radiusKm {
+			out = append(out, Nearby{DriverID: id, DistanceKm: km})
+		}
+	}
+	m.mu.RUnlock()
+	sort.Slice(out, func(i, j int) bool { return out[i].DistanceKm < out[j].DistanceKm })
+	if count > 0 && len(out) > count {
+		out = out[:count]
+	}
+	return out, nil
+}
+
+func (m *Memory) GetNearbyDrivers(ctx context.Context, lat, lng, radiusKm float64, count int) ([]string, error) {
+	nearby, _ := m.SearchNearbyDrivers(ctx, lat, lng, radiusKm, count)
+	ids := make([]string, len(nearby))
+	for i, n := range nearby {
+		ids[i] = n.DriverID
+	}
+	return ids, nil
+}
+
+func (m *Memory) GetDriversInBox(_ context.Context, minLat, minLng, maxLat, maxLng float64) ([]Position, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := []Position{}
+	for id, d := range m.drivers {
+		if d.lat >= minLat && d.lat <= maxLat && d.lng >= minLng && d.lng <= maxLng {
+			out = append(out, Position{DriverID: id, Lat: d.lat, Lng: d.lng})
+		}
+	}
+	return out, nil
+}
+
+// haversineKm is the great-circle distance between two points.
+func haversineKm(lat1, lng1, lat2, lng2 float64) float64 {
+	const R = 6371.0
+	dLat := (lat2 - lat1) * math.Pi / 180
+	dLng := (lng2 - lng1) * math.Pi / 180
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*math.Pi/180)*math.Cos(lat2*math.Pi/180)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return R * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
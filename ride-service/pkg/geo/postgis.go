@@ -0,0 +1,138 @@
+package geo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrNoPostGIS is returned by PostGIS.Check when the database lacks the
+// PostGIS extension or the drivers.last_location column.
+var ErrNoPostGIS = errors.New("geo: drivers.last_location is missing; install PostGIS and re-run migration V35_driver_last_location.sql")
+
+// PostGIS keeps positions in drivers.last_location, a geography column with
+// a GiST index; drivers.in_pool marks the matchable pool.
+type PostGIS struct {
+	pool *pgxpool.Pool
+}
+
+// NewPostGIS returns an Index backed by the drivers table.
+func NewPostGIS(pool *pgxpool.Pool) *PostGIS {
+	return &PostGIS{pool: pool}
+}
+
+// Check confirms the schema the index needs is in place.
+func (p *PostGIS) Check(ctx context.Context) error {
+	var ok bool
+	err := p.pool.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM information_schema.columns
+		               WHERE table_name = 'drivers' AND column_name = 'last_location')`).Scan(&ok)
+	if err != nil {
+		return fmt.Errorf("geo: %w", err)
+	}
+	if !ok {
+		return ErrNoPostGIS
+	}
+	return nil
+}
+
+func (p *PostGIS) SetDriverLocation(ctx context.Context, driverID string, lat, lng float64) error {
+	return p.SetDriverLocations(ctx, []Position{{DriverID: driverID, Lat: lat, Lng: lng}})
+}
+
+// SetDriverLocations stores all positions in one statement.
+func (p *PostGIS) SetDriverLocations(ctx context.Context, positions []Position) error {
+	return p.store(ctx, positions, true)
+}
+
+func (p *PostGIS) SetDriverPositions(ctx context.Context, positions []Position) error {
+	return p.store(ctx, positions, false)
+}
+
+// store writes positions and sets in_pool to pool.
+func (p *PostGIS) store(ctx context.Context, positions []Position, pool bool) error {
+	if len(positions) == 0 {
+		return nil
+	}
+	ids := make([]string, len(positions))
+	lats := make([]float64, len(positions))
+	lngs := make([]float64, len(positions))
+	for i, pos := range positions {
+		ids[i], lats[i], lngs[i] = pos.DriverID, pos.Lat, pos.Lng
+	}
+	_, err := p.pool.Exec(ctx, `
+		UPDATE drivers d
+		SET last_location    = ST_SetSRID(ST_MakePoint(v.lng, v.lat), 4326)::geography,
+		    last_location_at = NOW(),
+		    in_pool          = $4
+		FROM (SELECT DISTINCT ON (id) id, lat, lng
+		      FROM unnest($1::uuid[], $2::float8[], $3::float8[]) WITH ORDINALITY AS u(id, lat, lng, n)
+		      ORDER BY id, n DESC) v
+		WHERE d.id = v.id`, ids, lats, lngs, pool)
+	return err
+}
+
+func (p *PostGIS) RemoveDriverLocation(ctx context.Context, driverID string) error {
+	_, err := p.pool.Exec(ctx, `UPDATE drivers SET in_pool = FALSE WHERE id = $1 AND in_pool`, driverID)
+	return err
+}
+
+func (p *PostGIS) SearchNearbyDrivers(ctx context.Context, lat, lng, radiusKm float64, count int) ([]Nearby, error) {
+	rows, err := p.pool.Query(ctx, `
+		WITH here AS (SELECT ST_SetSRID(ST_MakePoint($2, $1), 4326)::geography AS g)
+		SELECT d.id::text, ST_Distance(d.last_location, here.g) / 1000
+		FROM drivers d, here
+		WHERE d.in_pool AND ST_DWithin(d.last_location, here.g, $3 * 1000)
+		ORDER BY d.last_location <-> here.g
+		LIMIT NULLIF($4, 0)`, lat, lng, radiusKm, count)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Nearby{}
+	for rows.Next() {
+		var n Nearby
+		if err := rows.Scan(&n.DriverID, &n.DistanceKm); err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+	}
+	return out, rows.Err()
+}
+
+func (p *PostGIS) GetNearbyDrivers(ctx context.Context, lat, lng, radiusKm float64, count int) ([]string, error) {
+	nearby, err := p.SearchNearbyDrivers(ctx, lat, lng, radiusKm, count)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(nearby))
+	for i, n := range nearby {
+		ids[i] = n.DriverID
+	}
+	return ids, nil
+}
+
+func (p *PostGIS) GetDriversInBox(ctx context.Context, minLat, minLng, maxLat, maxLng float64) ([]Position, error) {
+	// && narrows by the index; the exact bounds are checked on the point.
+	rows, err := p.pool.Query(ctx, `
+		SELECT id::text, ST_Y(last_location::geometry), ST_X(last_location::geometry)
+		FROM drivers
+		WHERE last_location && ST_MakeEnvelope($2, $1, $4, $3, 4326)::geography
+		  AND ST_Y(last_location::geometry) BETWEEN $1 AND $3
+		  AND ST_X(last_location::geometry) BETWEEN $2 AND $4`, minLat, minLng, maxLat, maxLng)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []Position{}
+	for rows.Next() {
+		var pos Position
+		if err := rows.Scan(&pos.DriverID, &pos.Lat, &pos.Lng); err != nil {
+			return nil, err
+		}
+		out = append(out, pos)
+	}
+	return out, rows.Err()
+}
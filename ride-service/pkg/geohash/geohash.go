@@ -0,0 +1,117 @@
+// Package geohash encodes coordinates as geohash cells: base32 strings whose
+// prefixes are the enclosing, coarser cells.
+package geohash
+
+import (
+	"math"
+	"strings"
+)
+
+const alphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// MaxPrecision is the longest hash Encode produces.
+const MaxPrecision = 12
+
+// Encode returns the cell of the given length (1..MaxPrecision) containing
+// lat, lng.
+func Encode(lat, lng float64, precision int) string {
+	precision = max(1, min(precision, MaxPrecision))
+	latLo, latHi, lngLo, lngHi := -90.0, 90.0, -180.0, 180.0
+	var sb strings.Builder
+	even, bit, idx := true, 0, 0
+	for sb.Len() < precision {
+		if even {
+			mid := (lngLo + lngHi) / 2
+			if lng >= mid {
+				idx = idx<<1 | 1
+				lngLo = mid
+			} else {
+				idx <<= 1
+				lngHi = mid
+			}
+		} else {
+			mid := (latLo + latHi) / 2
+			if lat >= mid {
+				idx = idx<<1 | 1
+				latLo = mid
+			} else {
+				idx <<= 1
+				latHi = mid
+			}
+		}
+		even = !even
+		if bit++; bit == 5 {
+			sb.WriteByte(alphabet[idx])
+			bit, idx = 0, 0
+		}
+	}
+	return sb.String()
+}
+
+// Center returns the middle of the cell hash, and false if hash is not a
+// valid geohash.
+func Center(hash string) (lat, lng float64, ok bool) {
+	latLo, lngLo, latHi, lngHi, ok := Bounds(hash)
+	return (latLo + latHi) / 2, (lngLo + lngHi) / 2, ok
+}
+
+// Bounds returns the corners of the cell hash, and false if hash is not a
+// valid geohash.
+func Bounds(hash string) (minLat, minLng, maxLat, maxLng float64, ok bool) {
+	latLo, latHi, lngLo, lngHi := -90.0, 90.0, -180.0, 180.0
+	even := true
+	for i := 0; i < len(hash); i++ {
+		idx := strings.IndexByte(alphabet, hash[i])
+		if idx < 0 {
+			return 0, 0, 0, 0, false
+		}
+		for b := 4; b >= 0; b-- {
+			on := idx>>b&1 == 1
+			if even {
+				if mid := (lngLo + lngHi) / 2; on {
+					lngLo = mid
+				} else {
+					lngHi = mid
+				}
+			} else {
+				if mid := (latLo + latHi) / 2; on {
+					latLo = mid
+				} else {
+					latHi = mid
+				}
+			}
+			even = !even
+		}
+	}
+	return latLo, lngLo, latHi, lngHi, hash != ""
+}
+
+// CellSize returns the height and width in degrees of cells of the given
+// precision.
+func CellSize(precision int) (latDeg, lngDeg float64) {
+	precision = max(1, min(precision, MaxPrecision))
+	latBits := 5 * precision / 2
+	lngBits := 5*precision - latBits
+	return 180 / math.Exp2(float64(latBits)), 360 / math.Exp2(float64(lngBits))
+}
+
+// Cells returns the cells of the given precision that overlap the box
+// [minLat,maxLat] x [minLng,maxLng], or false if there are more than limit.
+func Cells(minLat, minLng, maxLat, maxLng float64, precision, limit int) ([]string, bool) {
+	h, w := CellSize(precision)
+	row := func(lat float64) int { return int(math.Floor((max(-90, min(lat, 90)) + 90) / h)) }
+	col := func(lng float64) int { return int(math.Floor((max(-180, min(lng, 180)) + 180) / w)) }
+	lastRow, lastCol := int(math.Round(180/h))-1, int(math.Round(360/w))-1
+	r0, r1 := row(minLat), min(row(maxLat), lastRow)
+	c0, c1 := col(minLng), min(col(maxLng), lastCol)
+	if r1 < r0 || c1 < c0 || (r1-r0+1)*(c1-c0+1) > limit {
+		return nil, false
+	}
+	cells := make([]string, 0, (r1-r0+1)*(c1-c0+1))
+	for r := r0; r <= r1; r++ {
+		for c := c0; c <= c1; c++ {
+			cells = append(cells, Encode((float64(r)+0.5)*h-90, (float64(c)+0.5)*w-180, precision))
+		}
+	}
+	return cells, true
+}
@@ -3,19 +3,28 @@ package jwt
 import (
 	"context"
 	"errors"
-	"fmt"
+	"log"
 	"net/http"
 	"strings"
 	"time"
 
 	gojwt "github.com/golang-jwt/jwt/v5"
+
+	"ride-service/pkg/apierror"
 )
 
+// TokenTTL is how long an issued token stays valid.
+const TokenTTL = 24 * time.Hour
+
+// ErrRevoked is returned for tokens issued before their account's tokens
+// were revoked.
+var ErrRevoked = errors.New("token revoked")
+
 // Claims represents the JWT payload.
 type Claims struct {
 	UserID string `json:"user_id"`
 	Email  string `json:"email"`
-	Role   string `json:"role"` // "rider" or "driver"
+	Role   string `json:"role"` // "rider", "driver", "support" or "admin"
 	gojwt.RegisteredClaims
 }
 
@@ -23,19 +32,62 @@ type ctxKey string
 
 const claimsCtxKey ctxKey = "jwt_claims"
 
-var secret []byte
+var secret []byte // JWT_SECRET; nil when only LoadKeys' keys are used
+
+// RevocationStore remembers, per account, when all tokens issued so far were
+// revoked. Entries only need to outlive TokenTTL.
+type RevocationStore interface {
+	RevokeTokens(ctx context.Context, userID string, at time.Time, ttl time.Duration) error
+	TokensRevokedAt(ctx context.Context, userID string) (time.Time, bool, error)
+	ClearRevocation(ctx context.Context, userID string) error
+}
+
+var revocations RevocationStore
+
+// SetRevocationStore installs the store Authenticate, Revoke and Unrevoke
+// use. Without one, tokens cannot be revoked.
+func SetRevocationStore(s RevocationStore) { revocations = s }
 
-// Init must be called once at startup with the JWT_SECRET value.
+// Revoke invalidates every token issued to userID until now and ends their
+// sessions.
+func Revoke(ctx context.Context, userID string) error {
+	if revocations != nil {
+		if err := revocations.RevokeTokens(ctx, userID, time.Now(), TokenTTL); err != nil {
+			return err
+		}
+	}
+	if sessions == nil {
+		return nil
+	}
+	return sessions.EndSessions(ctx, userID)
+}
+
+// Unrevoke lets userID's tokens through again (e.g. after an account is
+// restored). Unexpired tokens issued before the revocation without a session
+// work again too; the sessions Revoke ended stay ended.
+func Unrevoke(ctx context.Context, userID string) error {
+	if revocations == nil {
+		return nil
+	}
+	return revocations.ClearRevocation(ctx, userID)
+}
+
+// Init must be called once at startup with the JWT_SECRET value. It may be
+// empty only if LoadKeys then provides a signing key.
 func Init(s string) error {
-	if s == "" {
-		return errors.New("JWT_SECRET is required")
+	secret = nil
+	if s != "" {
+		secret = []byte(s)
 	}
-	secret = []byte(s)
+	// Millisecond iat, so revocation can tell tokens issued just before it
+	// from the ones issued right after.
+	gojwt.TimePrecision = time.Millisecond
 	return nil
 }
 
-// Generate creates a signed JWT for the given user.
-func Generate(userID, email, role string) (string, error) {
+// Generate creates a signed JWT for the given user, opening a session for
+// the device of the request in ctx (see CaptureDevice).
+func Generate(ctx context.Context, userID, email, role string) (string, error) {
 	claims := Claims{
 		UserID: userID,
 		Email:  email,
@@ -43,20 +95,25 @@ func Generate(userID, email, role string) (string, error) {
 		RegisteredClaims: gojwt.RegisteredClaims{
 			Subject:   userID,
 			IssuedAt:  gojwt.NewNumericDate(time.Now()),
-			ExpiresAt: gojwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ExpiresAt: gojwt.NewNumericDate(time.Now().Add(TokenTTL)),
 		},
 	}
+	claims.ID = startSession(ctx, &claims)
+	if current != nil {
+		token := gojwt.NewWithClaims(current.method, claims)
+		token.Header["kid"] = current.id
+		return token.SignedString(current.sign)
+	}
+	if secret == nil {
+		return "", errors.New("jwt: no signing key configured")
+	}
 	return gojwt.NewWithClaims(gojwt.SigningMethodHS256, claims).SignedString(secret)
 }
 
-// Validate parses and validates a raw JWT string.
+// Validate parses and validates a raw JWT string, signed with the key its
+// kid names or, without a kid, with the JWT_SECRET.
 func Validate(raw string) (*Claims, error) {
-	token, err := gojwt.ParseWithClaims(raw, &Claims{}, func(t *gojwt.Token) (any, error) {
-		if _, ok := t.Method.(*gojwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
-		}
-		return secret, nil
-	})
+	token, err := gojwt.ParseWithClaims(raw, &Claims{}, verificationKey)
 	if err != nil {
 		return nil, err
 	}
@@ -67,6 +124,37 @@ func Validate(raw string) (*Claims, error) {
 	return claims, nil
 }
 
+// Authenticate validates raw and rejects it with ErrRevoked if its account's
+// tokens were revoked after it was issued, or if its session was ended. If
+// the revocation or session store cannot be reached the token is accepted,
+// so an outage there does not lock everyone out.
+func Authenticate(ctx context.Context, raw string) (*Claims, error) {
+	claims, err := Validate(raw)
+	if err != nil {
+		return nil, err
+	}
+	if revocations != nil {
+		at, ok, err := revocations.TokensRevokedAt(ctx, claims.UserID)
+		if err != nil {
+			log.Printf("jwt: revocation check for %s failed, accepting token: %v", claims.UserID, err)
+		}
+		// A token issued in the millisecond of the revocation is kept: it is
+		// the replacement handed out by a password change.
+		if err == nil && ok && claims.IssuedAt != nil && claims.IssuedAt.Before(at) {
+			return nil, ErrRevoked
+		}
+	}
+	if sessions != nil && claims.ID != "" {
+		open, err := sessions.TouchSession(ctx, claims.ID, time.Now())
+		if err != nil {
+			log.Printf("jwt: session check for %s failed, accepting token: %v", claims.UserID, err)
+		} else if !open {
+			return nil, ErrRevoked
+		}
+	}
+	return claims, nil
+}
+
 // ---- HTTP Middleware ----
 
 // OptionalAuth extracts JWT claims into context if a Bearer token is present.
@@ -74,8 +162,8 @@ func Validate(raw string) (*Claims, error) {
 func OptionalAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
-			if claims, err := Validate(auth[7:]); err == nil {
-				r = r.WithContext(context.WithValue(r.Context(), claimsCtxKey, claims))
+			if claims, err := Authenticate(r.Context(), auth[7:]); err == nil {
+				r = r.WithContext(WithClaims(r.Context(), claims))
 			}
 		}
 		next.ServeHTTP(w, r)
@@ -86,13 +174,40 @@ func OptionalAuth(next http.Handler) http.Handler {
 func RequireAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if GetClaims(r.Context()) == nil {
-			http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+			apierror.Write(w, apierror.Unauthorized("unauthorized"))
 			return
 		}
 		next.ServeHTTP(w, r)
 	})
 }
 
+// RequireRole rejects requests whose JWT role is not one of roles.
+// It must run after RequireAuth (or on routes where claims are guaranteed).
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := GetClaims(r.Context())
+			if claims == nil {
+				apierror.Write(w, apierror.Unauthorized("unauthorized"))
+				return
+			}
+			for _, role := range roles {
+				if claims.Role == role {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			apierror.Write(w, apierror.Forbidden("forbidden"))
+		})
+	}
+}
+
+// WithClaims returns ctx carrying claims, for transports other than HTTP
+// that authenticate on their own.
+func WithClaims(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsCtxKey, claims)
+}
+
 // GetClaims retrieves the parsed claims from context (nil if absent).
 func GetClaims(ctx context.Context) *Claims {
 	c, _ := ctx.Value(claimsCtxKey).(*Claims)
@@ -0,0 +1,183 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+
+	"ride-service/pkg/apierror"
+)
+
+// Signing algorithms a key may use.
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+)
+
+// KeySpec describes a key by ID. File holds the HMAC secret for HS256, or a
+// PEM key for RS256 and EdDSA: a private key signs and verifies, a public
+// key only verifies (e.g. another instance's key during a rotation).
+type KeySpec struct {
+	ID   string
+	Alg  string
+	File string
+}
+
+type key struct {
+	id     string
+	method gojwt.SigningMethod
+	sign   any // nil: verification only
+	verify any
+}
+
+var (
+	keys    map[string]*key
+	current *key // nil: tokens are signed with the JWT_SECRET, without a kid
+)
+
+// LoadKeys reads the keys tokens are signed and verified with, next to the
+// JWT_SECRET from Init. Tokens are signed with the key named current and
+// carry its ID in the kid header; a token is verified with the key its kid
+// names, so every key listed keeps its tokens valid. Tokens without a kid
+// are checked against the JWT_SECRET.
+func LoadKeys(specs []KeySpec, currentID string) error {
+	loaded := make(map[string]*key, len(specs))
+	for _, s := range specs {
+		if s.ID == "" {
+			return errors.New("jwt: key without an id")
+		}
+		if _, dup := loaded[s.ID]; dup {
+			return fmt.Errorf("jwt: key %q listed twice", s.ID)
+		}
+		data, err := os.ReadFile(s.File)
+		if err != nil {
+			return fmt.Errorf("jwt: key %q: %w", s.ID, err)
+		}
+		k, err := parseKey(s.ID, s.Alg, data)
+		if err != nil {
+			return fmt.Errorf("jwt: key %q: %w", s.ID, err)
+		}
+		loaded[s.ID] = k
+	}
+	var cur *key
+	if currentID != "" {
+		cur = loaded[currentID]
+		if cur == nil {
+			return fmt.Errorf("jwt: signing key %q is not among the keys", currentID)
+		}
+		if cur.sign == nil {
+			return fmt.Errorf("jwt: signing key %q has no private key", currentID)
+		}
+	}
+	keys, current = loaded, cur
+	return nil
+}
+
+func parseKey(id, alg string, data []byte) (*key, error) {
+	k := &key{id: id}
+	switch alg {
+	case HS256:
+		secret := []byte(strings.TrimSpace(string(data)))
+		if len(secret) < 32 {
+			return nil, errors.New("HS256 secret must be at least 32 bytes")
+		}
+		k.method, k.sign, k.verify = gojwt.SigningMethodHS256, secret, secret
+	case RS256:
+		k.method = gojwt.SigningMethodRS256
+		if priv, err := gojwt.ParseRSAPrivateKeyFromPEM(data); err == nil {
+			k.sign, k.verify = priv, &priv.PublicKey
+		} else if pub, err := gojwt.ParseRSAPublicKeyFromPEM(data); err == nil {
+			k.verify = pub
+		} else {
+			return nil, errors.New("not a PEM RSA private or public key")
+		}
+	case EdDSA:
+		k.method = gojwt.SigningMethodEdDSA
+		if priv, err := gojwt.ParseEdPrivateKeyFromPEM(data); err == nil {
+			edPriv, ok := priv.(ed25519.PrivateKey)
+			if !ok {
+				return nil, errors.New("not an Ed25519 private key")
+			}
+			k.sign, k.verify = edPriv, edPriv.Public()
+		} else if pub, err := gojwt.ParseEdPublicKeyFromPEM(data); err == nil {
+			k.verify = pub
+		} else {
+			return nil, errors.New("not a PEM Ed25519 private or public key")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported algorithm %q (HS256, RS256 or EdDSA)", alg)
+	}
+	return k, nil
+}
+
+// verificationKey picks the key a token was signed with and refuses a token
+// whose algorithm is not that key's.
+func verificationKey(t *gojwt.Token) (any, error) {
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		if _, ok := t.Method.(*gojwt.SigningMethodHMAC); !ok || secret == nil {
+			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+		return secret, nil
+	}
+	k, ok := keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	if t.Method.Alg() != k.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %v for key %q", t.Header["alg"], kid)
+	}
+	return k.verify, nil
+}
+
+// JWK is a public key in a JSON Web Key Set.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`   // RSA modulus
+	E   string `json:"e,omitempty"`   // RSA exponent
+	Crv string `json:"crv,omitempty"` // OKP curve
+	X   string `json:"x,omitempty"`   // OKP public key
+}
+
+// JWKSet is GET /.well-known/jwks.json.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicKeys returns the RS256 and EdDSA keys tokens may be verified with.
+// HS256 keys are secrets and never published.
+func PublicKeys() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	b64 := base64.RawURLEncoding.EncodeToString
+	for _, k := range keys {
+		switch pub := k.verify.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{Kty: "RSA", Kid: k.id, Use: "sig", Alg: RS256,
+				N: b64(pub.N.Bytes()), E: b64(big.NewInt(int64(pub.E)).Bytes())})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JWK{Kty: "OKP", Kid: k.id, Use: "sig", Alg: EdDSA, Crv: "Ed25519", X: b64(pub)})
+		}
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
+
+// JWKS serves PublicKeys for other services verifying tokens. Verifiers may
+// cache it for a few minutes; a new key is published before it signs.
+func JWKS(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	apierror.WriteJSON(w, http.StatusOK, PublicKeys())
+}
@@ -0,0 +1,173 @@
+package jwt
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Session is a token issued to one device. Its ID is the token's jti, so
+// ending the session stops that token and no other.
+type Session struct {
+	ID        string    `json:"id"`
+	UserID    string    `json:"user_id"`
+	Role      string    `json:"role"`
+	UserAgent string    `json:"user_agent"`
+	IP        string    `json:"ip"`
+	IssuedAt  time.Time `json:"issued_at"`
+	LastSeen  time.Time `json:"last_seen_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Current   bool      `json:"current"` // the session of the token asking
+}
+
+// SessionStore keeps the sessions of unexpired tokens. Sessions only need
+// to outlive TokenTTL.
+type SessionStore interface {
+	// StartSession records s, then ends the account's oldest sessions beyond
+	// max (0: no limit) and returns their IDs.
+	StartSession(ctx context.Context, s Session, max int, ttl time.Duration) (evicted []string, err error)
+	// TouchSession marks the session seen at at and reports whether it is
+	// still open.
+	TouchSession(ctx context.Context, id string, at time.Time) (bool, error)
+	Sessions(ctx context.Context, userID string) ([]Session, error)
+	EndSession(ctx context.Context, userID, id string) (bool, error)
+	EndSessions(ctx context.Context, userID string) error
+}
+
+var (
+	sessions    SessionStore
+	maxSessions int
+)
+
+// SetSessionStore installs the store Generate records sessions in and
+// Authenticate checks them against, allowing at most max sessions per
+// account (0: no limit). Without one, tokens carry no session.
+func SetSessionStore(s SessionStore, max int) { sessions, maxSessions = s, max }
+
+// startSession records a session for claims and returns its ID, or "" if it
+// could not be recorded: the token is then issued without one, and only
+// Revoke can end it before it expires.
+func startSession(ctx context.Context, claims *Claims) string {
+	if sessions == nil {
+		return ""
+	}
+	d, _ := ctx.Value(deviceCtxKey).(device)
+	s := Session{
+		ID: uuid.NewString(), UserID: claims.UserID, Role: claims.Role,
+		UserAgent: d.userAgent, IP: d.ip,
+		IssuedAt: claims.IssuedAt.Time, ExpiresAt: claims.ExpiresAt.Time,
+	}
+	evicted, err := sessions.StartSession(ctx, s, maxSessions, TokenTTL)
+	if err != nil {
+		log.Printf("jwt: recording session for %s failed, issuing a token without one: %v", claims.UserID, err)
+		return ""
+	}
+	if len(evicted) > 0 {
+		log.Printf("jwt: %s is over %d sessions, ended %v", claims.UserID, maxSessions, evicted)
+	}
+	return s.ID
+}
+
+// Sessions returns userID's open sessions, newest first, marking the one
+// current names.
+func Sessions(ctx context.Context, userID, current string) ([]Session, error) {
+	if sessions == nil {
+		return []Session{}, nil
+	}
+	list, err := sessions.Sessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range list {
+		list[i].Current = list[i].ID == current
+	}
+	return list, nil
+}
+
+// EndSession stops the token of userID's session id. It reports false if
+// userID has no such session.
+func EndSession(ctx context.Context, userID, id string) (bool, error) {
+	if sessions == nil {
+		return false, nil
+	}
+	return sessions.EndSession(ctx, userID, id)
+}
+
+type device struct{ userAgent, ip string }
+
+const deviceCtxKey ctxKey = "jwt_device"
+
+// ClientIP returns the client IP CaptureDevice saw for the request in ctx,
+// or "" outside a request.
+func ClientIP(ctx context.Context) string {
+	d, _ := ctx.Value(deviceCtxKey).(device)
+	return d.ip
+}
+
+// maxUserAgent caps the user agent kept with a session, in bytes.
+const maxUserAgent = 256
+
+var trustedProxies []netip.Prefix
+
+// TrustProxies sets the proxies whose X-Forwarded-For CaptureDevice
+// believes. Without any, the client IP is the connection's peer.
+func TrustProxies(prefixes []netip.Prefix) {
+	trustedProxies = prefixes
+}
+
+func trusted(ip netip.Addr) bool {
+	for _, p := range trustedProxies {
+		if p.Contains(ip.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP is the peer of r or, when the peer is a trusted proxy, the
+// right-most X-Forwarded-For hop that is not: hops left of it were written
+// by the client and prove nothing. True-Client-IP and X-Real-IP are never
+// read, since anyone can send them.
+func clientIP(r *http.Request) string {
+	host := r.RemoteAddr
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil || !trusted(ip) {
+		return host
+	}
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		ip = hop
+		if !trusted(hop) {
+			break
+		}
+	}
+	return ip.Unmap().String()
+}
+
+// CaptureDevice remembers the request's user agent and client IP, which
+// Generate records with the session of a token issued while handling it,
+// and sets the request's RemoteAddr to that IP for the handlers after it.
+func CaptureDevice(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r)
+		r.RemoteAddr = ip
+		ua := r.UserAgent()
+		if len(ua) > maxUserAgent {
+			ua = ua[:maxUserAgent]
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), deviceCtxKey, device{userAgent: ua, ip: ip})))
+	})
+}
@@ -5,34 +5,81 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	kafkago "github.com/segmentio/kafka-go"
-)
 
-// Well-known topic names.
-const (
-	TopicRideRequested  = "ride.requested"
-	TopicDriverAssigned = "driver.assigned"
-	TopicTripCompleted  = "trip.completed"
+	"ride-service/pkg/eventbus"
+	"ride-service/pkg/faults"
+	"ride-service/pkg/logging"
 )
 
-// Client wraps Kafka operations.
+var logger = logging.For("kafka")
+
+// Options tunes a Client.
+type Options struct {
+	ConnectAttempts int           // startup retries in EnsureTopics
+	MaxRetries      int           // handler retries per message before dead-lettering
+	RetryBackoff    time.Duration // first retry delay; doubles on each attempt
+
+	Consumer ConsumerOptions            // defaults for every subscription
+	Topics   map[string]ConsumerOptions // per-topic overrides; zero fields inherit
+}
+
+// ConsumerOptions tunes how one subscription processes and commits messages.
+type ConsumerOptions struct {
+	Concurrency    int           // workers; each owns a subset of partitions so order per partition holds
+	CommitBatch    int           // commit after this many handled messages...
+	CommitInterval time.Duration // ...or after this long, whichever comes first
+}
+
+// consumerOptions resolves the effective options for topic.
+func (c *Client) consumerOptions(topic string) ConsumerOptions {
+	o := c.opts.Consumer
+	if t, ok := c.opts.Topics[topic]; ok {
+		if t.Concurrency > 0 {
+			o.Concurrency = t.Concurrency
+		}
+		if t.CommitBatch > 0 {
+			o.CommitBatch = t.CommitBatch
+		}
+		if t.CommitInterval > 0 {
+			o.CommitInterval = t.CommitInterval
+		}
+	}
+	if o.Concurrency < 1 {
+		o.Concurrency = 1
+	}
+	if o.CommitBatch < 1 {
+		o.CommitBatch = 1
+	}
+	if o.CommitInterval <= 0 {
+		o.CommitInterval = time.Second
+	}
+	return o
+}
+
+// Client is the Kafka eventbus.Bus.
 type Client struct {
 	brokers []string
+	opts    Options
+	wg      sync.WaitGroup // one per running subscriber goroutine
 }
 
+var _ eventbus.Bus = (*Client)(nil)
+
 // NewClient returns a Client connected to the given brokers.
-func NewClient(brokers []string) *Client {
-	return &Client{brokers: brokers}
+func NewClient(brokers []string, opts Options) *Client {
+	return &Client{brokers: brokers, opts: opts}
 }
 
 // EnsureTopics creates topics if they don't already exist (with retry).
 func (c *Client) EnsureTopics(ctx context.Context, topics ...string) error {
-	for attempt := 1; attempt <= 20; attempt++ {
+	for attempt := 1; attempt <= c.opts.ConnectAttempts; attempt++ {
 		conn, err := kafkago.DialContext(ctx, "tcp", c.brokers[0])
 		if err != nil {
-			log.Printf("Kafka not ready, retrying in 3s... (%d/20)", attempt)
+			log.Printf("Kafka not ready, retrying in 3s... (%d/%d)", attempt, c.opts.ConnectAttempts)
 			time.Sleep(3 * time.Second)
 			continue
 		}
@@ -54,7 +101,24 @@ func (c *Client) EnsureTopics(ctx context.Context, topics ...string) error {
 		log.Println("Kafka topics ensured")
 		return nil
 	}
-	return fmt.Errorf("kafka: could not connect after 20 attempts")
+	return fmt.Errorf("kafka: could not connect after %d attempts", c.opts.ConnectAttempts)
+}
+
+// Ping checks that a broker accepts connections and answers a metadata request.
+func (c *Client) Ping(ctx context.Context) error {
+	var err error
+	for _, b := range c.brokers {
+		var conn *kafkago.Conn
+		if conn, err = kafkago.DialContext(ctx, "tcp", b); err != nil {
+			continue
+		}
+		_, err = conn.Brokers()
+		conn.Close()
+		if err == nil {
+			return nil
+		}
+	}
+	return err
 }
 
 // Publish sends a JSON-serialised message to a topic.
@@ -63,6 +127,14 @@ func (c *Client) Publish(ctx context.Context, topic, key string, value any) erro
 	if err != nil {
 		return err
 	}
+	return c.PublishRaw(ctx, topic, key, data)
+}
+
+// PublishRaw sends pre-serialised bytes to a topic unchanged.
+func (c *Client) PublishRaw(ctx context.Context, topic, key string, value []byte) error {
+	if err := faults.Inject(ctx, faults.TargetKafka); err != nil {
+		return err
+	}
 	w := &kafkago.Writer{
 		Addr:     kafkago.TCP(c.brokers...),
 		Topic:    topic,
@@ -72,35 +144,6 @@ func (c *Client) Publish(ctx context.Context, topic, key string, value any) erro
 
 	return w.WriteMessages(ctx, kafkago.Message{
 		Key:   []byte(key),
-		Value: data,
-	})
-}
-
-// Subscribe starts a background goroutine that reads from a topic.
-func (c *Client) Subscribe(ctx context.Context, topic, groupID string, handler func([]byte) error) {
-	r := kafkago.NewReader(kafkago.ReaderConfig{
-		Brokers:  c.brokers,
-		Topic:    topic,
-		GroupID:  groupID,
-		MinBytes: 1,
-		MaxBytes: 10e6,
+		Value: value,
 	})
-
-	go func() {
-		defer r.Close()
-		for {
-			msg, err := r.ReadMessage(ctx)
-			if err != nil {
-				if ctx.Err() != nil {
-					return
-				}
-				log.Printf("[kafka] read error on %s: %v", topic, err)
-				time.Sleep(time.Second)
-				continue
-			}
-			if err := handler(msg.Value); err != nil {
-				log.Printf("[kafka] handler error on %s: %v", topic, err)
-			}
-		}
-	}()
 }
@@ -0,0 +1,151 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+
+	"ride-service/pkg/eventbus"
+)
+
+// Subscribe starts consuming topic in the background.
+//
+// Offsets are committed manually and only once a message has been handled:
+// either the handler succeeded, or it failed Options.MaxRetries times and the
+// message was moved to the topic's dead-letter queue. Commits are batched per
+// ConsumerOptions. Messages are spread over ConsumerOptions.Concurrency
+// workers by partition, so ordering within a partition is preserved.
+//
+// Cancelling ctx stops fetching; each worker finishes its current message and
+// commits what it has handled before the subscription exits (see Wait).
+func (c *Client) Subscribe(ctx context.Context, topic, groupID string, handler eventbus.Handler) {
+	opts := c.consumerOptions(topic)
+	r := kafkago.NewReader(kafkago.ReaderConfig{
+		Brokers:  c.brokers,
+		Topic:    topic,
+		GroupID:  groupID,
+		MinBytes: 1,
+		MaxBytes: 10e6,
+	})
+	handlerCtx := context.WithoutCancel(ctx)
+
+	queues := make([]chan kafkago.Message, opts.Concurrency)
+	var workers sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan kafkago.Message)
+		workers.Add(1)
+		go func(in <-chan kafkago.Message) {
+			defer workers.Done()
+			c.work(ctx, handlerCtx, r, groupID, opts, in, handler)
+		}(queues[i])
+	}
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		c.fetch(ctx, r, topic, groupID, queues)
+		for _, q := range queues {
+			close(q)
+		}
+		workers.Wait()
+		r.Close()
+		logger.Info("consumer stopped", "group", groupID, "topic", topic)
+	}()
+	logger.Info("consumer started", "group", groupID, "topic", topic,
+		"concurrency", opts.Concurrency, "commit_batch", opts.CommitBatch, "commit_interval", opts.CommitInterval)
+}
+
+// fetch reads messages and hands each to the worker owning its partition
+// until ctx is cancelled.
+func (c *Client) fetch(ctx context.Context, r *kafkago.Reader, topic, groupID string, queues []chan kafkago.Message) {
+	for {
+		msg, err := r.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Error("read failed", "topic", topic, "err", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		logger.Debug("message fetched", "topic", topic, "group", groupID, "partition", msg.Partition, "offset", msg.Offset)
+		select {
+		case queues[msg.Partition%len(queues)] <- msg:
+		case <-ctx.Done():
+			// Never handed to a worker, so never committed: redelivered later.
+			return
+		}
+	}
+}
+
+// work handles messages from in and commits them in batches.
+func (c *Client) work(ctx, handlerCtx context.Context, r *kafkago.Reader, groupID string,
+	opts ConsumerOptions, in <-chan kafkago.Message, handler eventbus.Handler) {
+	var pending []kafkago.Message
+	flush := func() {
+		if len(pending) == 0 {
+			return
+		}
+		if err := r.CommitMessages(handlerCtx, pending...); err != nil {
+			last := pending[len(pending)-1]
+			logger.Error("commit failed", "topic", last.Topic, "partition", last.Partition, "offset", last.Offset, "err", err)
+		}
+		pending = pending[:0]
+	}
+	defer flush()
+
+	ticker := time.NewTicker(opts.CommitInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case msg, ok := <-in:
+			if !ok {
+				return
+			}
+			if !c.handle(ctx, handlerCtx, groupID, msg, handler) {
+				// Shutdown mid-retry: leave it uncommitted so it is redelivered.
+				return
+			}
+			pending = append(pending, msg)
+			if len(pending) >= opts.CommitBatch {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// handle runs handler through eventbus.Deliver with the client's retries.
+func (c *Client) handle(ctx, handlerCtx context.Context, groupID string, msg kafkago.Message, handler eventbus.Handler) bool {
+	retry := eventbus.Retry{MaxRetries: c.opts.MaxRetries, Backoff: c.opts.RetryBackoff}
+	return eventbus.Deliver(ctx, handlerCtx, c, retry, groupID, eventbus.Message{
+		Topic: msg.Topic, Partition: msg.Partition, Offset: msg.Offset, Key: msg.Key, Value: msg.Value,
+	}, handler)
+}
+
+// Wait blocks until every subscriber has finished its in-flight messages and
+// committed their offsets, or until ctx expires. Cancel the context passed to
+// Subscribe first.
+func (c *Client) Wait(ctx context.Context) error {
+	return wait(ctx, &c.wg)
+}
+
+// wait blocks until wg is done or ctx expires.
+func wait(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("kafka: consumers did not drain: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,174 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"ride-service/pkg/eventbus"
+	"ride-service/pkg/faults"
+)
+
+// memoryRetain is how many of a topic's latest messages Memory keeps for Tail
+// and ReadAt after every subscription has handled them.
+const memoryRetain = 1000
+
+// Memory stands in for the brokers in a single process, for tests and
+// in-memory mode: each topic is one partition, and each group reads it from
+// its own offset. Nothing survives a restart.
+type Memory struct {
+	retry eventbus.Retry
+	wg    sync.WaitGroup // one per running subscriber goroutine
+
+	mu     sync.Mutex
+	topics map[string]*memoryTopic
+}
+
+type memoryTopic struct {
+	base   int64 // offset of msgs[0]
+	msgs   []eventbus.Record
+	groups map[string]*int64 // next offset per group
+	wake   chan struct{}     // closed and replaced on every publish
+}
+
+// NewMemory returns an empty in-memory bus.
+func NewMemory(retry eventbus.Retry) *Memory {
+	return &Memory{retry: retry, topics: map[string]*memoryTopic{}}
+}
+
+// topic returns name's state, creating it. b.mu must be held.
+func (b *Memory) topic(name string) *memoryTopic {
+	t, ok := b.topics[name]
+	if !ok {
+		t = &memoryTopic{groups: map[string]*int64{}, wake: make(chan struct{})}
+		b.topics[name] = t
+	}
+	return t
+}
+
+// EnsureTopics does nothing: topics exist once used.
+func (b *Memory) EnsureTopics(ctx context.Context, topics ...string) error { return nil }
+
+func (b *Memory) Ping(ctx context.Context) error { return nil }
+
+func (b *Memory) Publish(ctx context.Context, topic, key string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return b.PublishRaw(ctx, topic, key, data)
+}
+
+func (b *Memory) PublishRaw(ctx context.Context, topic, key string, value []byte) error {
+	if err := faults.Inject(ctx, faults.TargetKafka); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t := b.topic(topic)
+	t.msgs = append(t.msgs, eventbus.Record{
+		Offset: t.base + int64(len(t.msgs)), Key: key, Value: value, Time: time.Now(),
+	})
+	t.trim()
+	close(t.wake)
+	t.wake = make(chan struct{})
+	return nil
+}
+
+// Subscribe handles topic's messages one at a time, in order.
+func (b *Memory) Subscribe(ctx context.Context, topic, groupID string, handler eventbus.Handler) {
+	handlerCtx := context.WithoutCancel(ctx)
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		for {
+			rec, ok := b.next(ctx, topic, groupID)
+			if !ok {
+				break
+			}
+			msg := eventbus.Message{Topic: topic, Offset: rec.Offset, Key: []byte(rec.Key), Value: rec.Value}
+			if !eventbus.Deliver(ctx, handlerCtx, b, b.retry, groupID, msg, handler) {
+				break // shutdown mid-retry
+			}
+		}
+		logger.Info("consumer stopped", "group", groupID, "topic", topic)
+	}()
+	logger.Info("consumer started", "group", groupID, "topic", topic, "bus", eventbus.BackendMemory)
+}
+
+// next blocks until groupID has a message to handle on topic and claims it.
+// It returns false once ctx is done.
+func (b *Memory) next(ctx context.Context, topic, groupID string) (eventbus.Record, bool) {
+	for {
+		b.mu.Lock()
+		t := b.topic(topic)
+		off, ok := t.groups[groupID]
+		if !ok {
+			off = new(int64)
+			*off = t.base
+			t.groups[groupID] = off
+		}
+		if i := *off - t.base; i < int64(len(t.msgs)) {
+			rec := t.msgs[i]
+			*off++
+			t.trim()
+			b.mu.Unlock()
+			return rec, true
+		}
+		wake := t.wake
+		b.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return eventbus.Record{}, false
+		}
+	}
+}
+
+// trim drops messages every group has handled, keeping the latest
+// memoryRetain.
+func (t *memoryTopic) trim() {
+	end := t.base + int64(len(t.msgs))
+	drop := end - memoryRetain
+	for _, off := range t.groups {
+		drop = min(drop, *off)
+	}
+	if n := drop - t.base; n > 0 {
+		t.msgs = append([]eventbus.Record(nil), t.msgs[n:]...)
+		t.base = drop
+	}
+}
+
+// records returns the messages of topic from offset on, up to limit.
+func (b *Memory) records(topic string, offset int64, limit int) []eventbus.Record {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t := b.topic(topic)
+	var out []eventbus.Record
+	for i := max(offset-t.base, 0); i < int64(len(t.msgs)) && len(out) < limit; i++ {
+		out = append(out, t.msgs[i])
+	}
+	return out
+}
+
+func (b *Memory) Tail(ctx context.Context, topic string, limit int) ([]eventbus.Record, error) {
+	b.mu.Lock()
+	t := b.topic(topic)
+	end := t.base + int64(len(t.msgs))
+	b.mu.Unlock()
+	return b.records(topic, end-int64(limit), limit), nil
+}
+
+func (b *Memory) ReadAt(ctx context.Context, topic string, partition int, offset int64) (*eventbus.Record, error) {
+	recs := b.records(topic, offset, 1)
+	if partition != 0 || len(recs) == 0 || recs[0].Offset != offset {
+		return nil, eventbus.ErrNoRecord
+	}
+	return &recs[0], nil
+}
+
+func (b *Memory) Wait(ctx context.Context) error {
+	return wait(ctx, &b.wg)
+}
@@ -0,0 +1,111 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+
+	"ride-service/pkg/eventbus"
+)
+
+// Tail returns up to limit of the most recent records from each partition of
+// topic. It reads directly from partition leaders and commits nothing, so it
+// is safe for inspection tools.
+func (c *Client) Tail(ctx context.Context, topic string, limit int) ([]eventbus.Record, error) {
+	conn, err := kafkago.DialContext(ctx, "tcp", c.brokers[0])
+	if err != nil {
+		return nil, err
+	}
+	partitions, err := conn.ReadPartitions(topic)
+	conn.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var out []eventbus.Record
+	for _, p := range partitions {
+		recs, err := c.tailPartition(ctx, topic, p.ID, limit)
+		if err != nil {
+			return nil, fmt.Errorf("partition %d: %w", p.ID, err)
+		}
+		out = append(out, recs...)
+	}
+	return out, nil
+}
+
+func (c *Client) tailPartition(ctx context.Context, topic string, partition, limit int) ([]eventbus.Record, error) {
+	conn, err := kafkago.DialLeader(ctx, "tcp", c.brokers[0], topic, partition)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	first, last, err := conn.ReadOffsets()
+	if err != nil {
+		return nil, err
+	}
+	start := last - int64(limit)
+	if start < first {
+		start = first
+	}
+	if start >= last {
+		return nil, nil
+	}
+	if _, err := conn.Seek(start, kafkago.SeekAbsolute); err != nil {
+		return nil, err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	batch := conn.ReadBatch(1, 10e6)
+	defer batch.Close()
+
+	var out []eventbus.Record
+	for {
+		msg, err := batch.ReadMessage()
+		if err != nil {
+			break
+		}
+		out = append(out, eventbus.Record{
+			Partition: partition, Offset: msg.Offset,
+			Key: string(msg.Key), Value: msg.Value, Time: msg.Time,
+		})
+		if msg.Offset >= last-1 {
+			break
+		}
+	}
+	return out, nil
+}
+
+// ReadAt fetches the single record at partition/offset of topic.
+func (c *Client) ReadAt(ctx context.Context, topic string, partition int, offset int64) (*eventbus.Record, error) {
+	conn, err := kafkago.DialLeader(ctx, "tcp", c.brokers[0], topic, partition)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	first, last, err := conn.ReadOffsets()
+	if err != nil {
+		return nil, err
+	}
+	if offset < first || offset >= last {
+		return nil, eventbus.ErrNoRecord
+	}
+	if _, err := conn.Seek(offset, kafkago.SeekAbsolute); err != nil {
+		return nil, err
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	msg, err := conn.ReadMessage(10e6)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Offset != offset {
+		return nil, eventbus.ErrNoRecord
+	}
+	return &eventbus.Record{
+		Partition: partition, Offset: msg.Offset,
+		Key: string(msg.Key), Value: msg.Value, Time: msg.Time,
+	}, nil
+}
@@ -0,0 +1,162 @@
+// Package lockout slows down password guessing. Failed logins are counted per
+// account and per client IP; past a few failures each further attempt on the
+// account must wait twice as long as the last, and past more the account is
+// locked for a while. An IP that fails on many accounts is locked too.
+//
+// Accounts are counted by the email tried, whether or not an account has it,
+// so a lockout says nothing about which emails are registered.
+package lockout
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/logging"
+)
+
+var logger = logging.For("lockout")
+
+var ErrLocked = apierror.New(http.StatusTooManyRequests, apierror.CodeRateLimited, "too many failed logins").WithCode("login_locked")
+
+// Policy is when failures slow down and lock logins. A zero threshold turns
+// its step off.
+type Policy struct {
+	DelayAfter  int           // account failures before each further one is delayed
+	BaseDelay   time.Duration // the first delay; it doubles with each failure
+	MaxDelay    time.Duration
+	LockAfter   int           // account failures that lock the account
+	LockFor     time.Duration // how long an account or IP stays locked
+	IPLockAfter int           // failures from one IP, on any accounts, that lock it
+	Window      time.Duration // failures are forgotten after this long without one
+}
+
+// Store counts failures and keeps locks; the Redis client implements it.
+type Store interface {
+	LoginFailure(ctx context.Context, key string, window time.Duration) (int, error)
+	LoginLock(ctx context.Context, key string) (time.Duration, error)
+	LockLogin(ctx context.Context, key string, d time.Duration) error
+	ClearLoginFailures(ctx context.Context, key string) error
+}
+
+// Guard applies a Policy to login attempts. A nil Guard lets every attempt
+// through.
+type Guard struct {
+	store  Store
+	policy Policy
+}
+
+// New returns a Guard keeping its counts in store.
+func New(store Store, p Policy) *Guard { return &Guard{store: store, policy: p} }
+
+// Outcome is what a failed login led to, as recorded in the audit log.
+type Outcome struct {
+	Failures      int       `json:"failures"`
+	IP            string    `json:"ip,omitempty"`
+	AccountLocked bool      `json:"account_locked,omitempty"`
+	IPLocked      bool      `json:"ip_locked,omitempty"`
+	Until         time.Time `json:"until,omitempty"` // the account's next attempt
+}
+
+// Check refuses an attempt on account from ip with ErrLocked while either is
+// locked or delayed. If the store cannot be reached the attempt is let
+// through, so an outage there does not stop everyone logging in.
+func (g *Guard) Check(ctx context.Context, account, ip string) error {
+	if g == nil {
+		return nil
+	}
+	for _, key := range keys(account, ip) {
+		d, err := g.store.LoginLock(ctx, key)
+		if err != nil {
+			logger.Error("lockout check failed, allowing login", "err", err)
+			return nil
+		}
+		if d > 0 {
+			e := *ErrLocked
+			e.RetryAfter = d
+			return fmt.Errorf("%w; try again in %s", &e, d.Round(time.Second))
+		}
+	}
+	return nil
+}
+
+// Failed counts a failed attempt on account from ip and delays or locks
+// them as the policy says.
+func (g *Guard) Failed(ctx context.Context, account, ip string) Outcome {
+	out := Outcome{IP: ip}
+	if g == nil {
+		return out
+	}
+	p := g.policy
+	acct := accountKey(account)
+	n, err := g.store.LoginFailure(ctx, acct, p.Window)
+	if err != nil {
+		logger.Error("counting login failure failed", "err", err)
+		return out
+	}
+	out.Failures = n
+	var wait time.Duration
+	switch {
+	case p.LockAfter > 0 && n >= p.LockAfter:
+		wait, out.AccountLocked = p.LockFor, true
+	case p.DelayAfter > 0 && n >= p.DelayAfter:
+		wait = p.BaseDelay
+		for i := p.DelayAfter; i < n && wait < p.MaxDelay; i++ {
+			wait *= 2
+		}
+		wait = min(wait, p.MaxDelay)
+	}
+	if wait > 0 {
+		out.Until = time.Now().Add(wait).UTC()
+		g.lock(ctx, acct, wait)
+	}
+
+	if ip != "" && p.IPLockAfter > 0 {
+		n, err := g.store.LoginFailure(ctx, "ip:"+ip, p.Window)
+		if err != nil {
+			logger.Error("counting login failure failed", "err", err)
+		} else if n >= p.IPLockAfter {
+			out.IPLocked = true
+			g.lock(ctx, "ip:"+ip, p.LockFor)
+		}
+	}
+	if out.AccountLocked || out.IPLocked {
+		logger.Warn("logins locked", "failures", out.Failures, "ip", ip, "account", out.AccountLocked, "ip_locked", out.IPLocked)
+	}
+	return out
+}
+
+// Succeeded forgets account's failures. Its IP's are kept: one right
+// password does not excuse guessing at other accounts.
+func (g *Guard) Succeeded(ctx context.Context, account string) {
+	if g == nil {
+		return
+	}
+	if err := g.store.ClearLoginFailures(ctx, accountKey(account)); err != nil {
+		logger.Warn("clearing login failures failed", "err", err)
+	}
+}
+
+func (g *Guard) lock(ctx context.Context, key string, d time.Duration) {
+	if err := g.store.LockLogin(ctx, key, d); err != nil {
+		logger.Error("locking logins failed", "err", err)
+	}
+}
+
+// accountKey hashes account, so the emails tried are not kept in Redis.
+func accountKey(account string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(account))))
+	return "account:" + hex.EncodeToString(sum[:])
+}
+
+func keys(account, ip string) []string {
+	if ip == "" {
+		return []string{accountKey(account)}
+	}
+	return []string{accountKey(account), "ip:" + ip}
+}
@@ -0,0 +1,110 @@
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/jwt"
+)
+
+// registry holds one dynamically adjustable level per module.
+var (
+	mu     sync.Mutex
+	levels = map[string]*slog.LevelVar{}
+)
+
+// For returns the logger for module. Every logger writes structured text to
+// stderr tagged with module=<name>; its level can be changed at runtime with
+// SetLevel without touching other modules.
+func For(module string) *slog.Logger {
+	mu.Lock()
+	lv, ok := levels[module]
+	if !ok {
+		lv = new(slog.LevelVar) // Info by default
+		levels[module] = lv
+	}
+	mu.Unlock()
+
+	h := slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: lv})
+	return slog.New(h).With("module", module)
+}
+
+// SetLevel changes module's level. level is debug, info, warn or error.
+func SetLevel(module, level string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("unknown level %q", level)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	lv, ok := levels[module]
+	if !ok {
+		return fmt.Errorf("unknown module %q", module)
+	}
+	lv.Set(l)
+	return nil
+}
+
+// Levels returns the current level of every registered module.
+func Levels() map[string]string {
+	mu.Lock()
+	defer mu.Unlock()
+	out := make(map[string]string, len(levels))
+	for m, lv := range levels {
+		out[m] = strings.ToLower(lv.Level().String())
+	}
+	return out
+}
+
+// Modules returns the registered module names in order.
+func Modules() []string {
+	mu.Lock()
+	defer mu.Unlock()
+	out := make([]string, 0, len(levels))
+	for m := range levels {
+		out = append(out, m)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// ---- Admin HTTP API ----
+
+// Routes returns a chi.Router for the /admin/log-levels mount point.
+func Routes() chi.Router {
+	r := chi.NewRouter()
+	r.Use(jwt.RequireAuth)
+	r.Use(jwt.RequireRole("admin"))
+
+	r.Get("/", func(w http.ResponseWriter, _ *http.Request) {
+		apierror.WriteJSON(w, http.StatusOK, map[string]any{"levels": Levels()})
+	})
+	r.Put("/{module}", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Level string `json:"level"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apierror.Write(w, apierror.Validation("invalid body"))
+			return
+		}
+		module := chi.URLParam(r, "module")
+		if err := SetLevel(module, req.Level); err != nil {
+			apierror.Write(w, apierror.Validation(err.Error()))
+			return
+		}
+		For("logging").Info("log level changed", "target", module, "level", req.Level,
+			"by", jwt.GetClaims(r.Context()).UserID)
+		apierror.WriteJSON(w, http.StatusOK, map[string]any{"levels": Levels()})
+	})
+
+	return r
+}
@@ -0,0 +1,118 @@
+package money
+
+import "strings"
+
+// Currency describes an ISO 4217 currency.
+type Currency struct {
+	Code     string
+	Exponent int    // minor-unit digits: 2 for INR, 0 for JPY, 3 for KWD
+	Symbol   string // as written in Format
+	Locale   string // default locale for Format
+}
+
+// currencies are the currencies pricing can be configured in.
+var currencies = map[string]Currency{
+	"INR": {"INR", 2, "₹", "en-IN"},
+	"USD": {"USD", 2, "$", "en-US"},
+	"EUR": {"EUR", 2, "€", "de-DE"},
+	"GBP": {"GBP", 2, "£", "en-GB"},
+	"AED": {"AED", 2, "AED", "en-AE"},
+	"SGD": {"SGD", 2, "S$", "en-SG"},
+	"AUD": {"AUD", 2, "A$", "en-AU"},
+	"CAD": {"CAD", 2, "CA$", "en-CA"},
+	"BRL": {"BRL", 2, "R$", "pt-BR"},
+	"MXN": {"MXN", 2, "MX$", "es-MX"},
+	"IDR": {"IDR", 2, "Rp", "id-ID"},
+	"ZAR": {"ZAR", 2, "R", "en-ZA"},
+	"JPY": {"JPY", 0, "¥", "ja-JP"},
+	"KRW": {"KRW", 0, "₩", "ko-KR"},
+	"KWD": {"KWD", 3, "KD", "en-KW"},
+}
+
+// Unit is the number of minor units in one major unit: 100 for INR.
+func (c Currency) Unit() int64 {
+	u := int64(1)
+	for i := 0; i < c.Exponent; i++ {
+		u *= 10
+	}
+	return u
+}
+
+// Lookup returns the currency for an ISO 4217 code, case-insensitively.
+func Lookup(code string) (Currency, bool) {
+	c, ok := currencies[strings.ToUpper(code)]
+	return c, ok
+}
+
+// locale is how a locale writes amounts.
+type locale struct {
+	decimal, group string
+	indian         bool // 12,34,567: groups of two above the thousands
+	suffix         bool // symbol after the amount, separated by a space
+}
+
+var locales = map[string]locale{
+	"en":    {decimal: ".", group: ","},
+	"en-IN": {decimal: ".", group: ",", indian: true},
+	"hi-IN": {decimal: ".", group: ",", indian: true},
+	"de-DE": {decimal: ",", group: ".", suffix: true},
+	"fr-FR": {decimal: ",", group: " ", suffix: true},
+	"es-ES": {decimal: ",", group: ".", suffix: true},
+	"it-IT": {decimal: ",", group: ".", suffix: true},
+	"nl-NL": {decimal: ",", group: "."},
+	"pt-BR": {decimal: ",", group: "."},
+	"id-ID": {decimal: ",", group: "."},
+	"en-ZA": {decimal: ".", group: " "},
+}
+
+// Format renders m for display in locale (a BCP 47 tag such as "en-IN" or
+// "de-DE"); an empty or unknown locale falls back to the currency's own,
+// then to English. ₹12,34,567.50 in en-IN, 1.234,50 € in de-DE.
+func (m Money) Format(tag string) string {
+	c, ok := Lookup(m.Currency)
+	if !ok {
+		return m.String()
+	}
+	l, ok := locales[tag]
+	if !ok {
+		if l, ok = locales[c.Locale]; !ok {
+			l = locales["en"]
+		}
+	}
+	dec := m.Decimal()
+	sign := ""
+	if strings.HasPrefix(dec, "-") {
+		sign, dec = "-", dec[1:]
+	}
+	whole, frac, _ := strings.Cut(dec, ".")
+	n := group(whole, l)
+	if frac != "" {
+		n += l.decimal + frac
+	}
+	if l.suffix {
+		return sign + n + " " + c.Symbol
+	}
+	if len(c.Symbol) > 1 && c.Symbol == c.Code {
+		return sign + c.Symbol + " " + n
+	}
+	return sign + c.Symbol + n
+}
+
+// group inserts l's group separators into a run of digits.
+func group(digits string, l locale) string {
+	if len(digits) <= 3 {
+		return digits
+	}
+	head, tail := digits[:len(digits)-3], digits[len(digits)-3:]
+	size := 3
+	if l.indian {
+		size = 2
+	}
+	var parts []string
+	for len(head) > size {
+		parts = append([]string{head[len(head)-size:]}, parts...)
+		head = head[:len(head)-size]
+	}
+	parts = append([]string{head}, parts...)
+	return strings.Join(append(parts, tail), l.group)
+}
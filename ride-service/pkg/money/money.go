@@ -0,0 +1,135 @@
+// Package money represents amounts as integer minor units (paise, cents) of
+// an ISO 4217 currency, so fares and balances add up exactly.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrCurrency = errors.New("unknown currency")
+	ErrAmount   = errors.New("invalid amount")
+	ErrMismatch = errors.New("currency mismatch")
+)
+
+// Money is an amount in the minor unit of its currency: {"amount":35600,
+// "currency":"INR"} is ₹356.00.
+type Money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// New returns amount minor units of currency.
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: strings.ToUpper(currency)}
+}
+
+// Parse reads a decimal amount in major units ("356", "12.50", "-3.5") of
+// currency. More fractional digits than the currency has are rejected
+// rather than rounded.
+func Parse(s, currency string) (Money, error) {
+	c, ok := Lookup(currency)
+	if !ok {
+		return Money{}, fmt.Errorf("%w %q", ErrCurrency, currency)
+	}
+	s = strings.TrimSpace(s)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "-"), "+")
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" || len(frac) > c.Exponent {
+		return Money{}, fmt.Errorf("%w %q for %s", ErrAmount, s, c.Code)
+	}
+	frac += strings.Repeat("0", c.Exponent-len(frac))
+	digits := whole + frac
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return Money{}, fmt.Errorf("%w %q", ErrAmount, s)
+		}
+	}
+	var n int64
+	if digits = strings.TrimLeft(digits, "0"); digits != "" {
+		var err error
+		if n, err = strconv.ParseInt(digits, 10, 64); err != nil {
+			return Money{}, fmt.Errorf("%w %q: out of range", ErrAmount, s)
+		}
+	}
+	if neg {
+		n = -n
+	}
+	return Money{Amount: n, Currency: c.Code}, nil
+}
+
+// FromMajor converts a legacy floating-point amount in major units, rounding
+// to the nearest minor unit. Only for data written before amounts were
+// stored in minor units.
+func FromMajor(v float64, currency string) Money {
+	c, _ := Lookup(currency)
+	return Money{Amount: int64(math.Round(v * math.Pow10(c.Exponent))), Currency: strings.ToUpper(currency)}
+}
+
+// Major returns the amount in major units as a float, for interfaces that
+// predate Money (the gRPC API, v1 event fields). Never compute with it.
+func (m Money) Major() float64 {
+	c, _ := Lookup(m.Currency)
+	return float64(m.Amount) / math.Pow10(c.Exponent)
+}
+
+// Add returns m+o. Both must be in the same currency.
+func (m Money) Add(o Money) (Money, error) {
+	if m.Currency != o.Currency {
+		return Money{}, fmt.Errorf("%w: %s + %s", ErrMismatch, m.Currency, o.Currency)
+	}
+	return Money{Amount: m.Amount + o.Amount, Currency: m.Currency}, nil
+}
+
+// MulRatio returns m × num/den, rounded half away from zero to the minor
+// unit.
+func (m Money) MulRatio(num, den int64) Money {
+	p := m.Amount * num
+	q := p / den
+	if r := p % den; 2*abs(r) >= abs(den) {
+		if (p < 0) != (den < 0) {
+			q--
+		} else {
+			q++
+		}
+	}
+	return Money{Amount: q, Currency: m.Currency}
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// IsZero reports whether m is the zero value.
+func (m Money) IsZero() bool { return m == Money{} }
+
+// Decimal renders the amount in major units without grouping or symbol:
+// "356.00", "-0.05", "500" for JPY. It round-trips through Parse.
+func (m Money) Decimal() string {
+	c, _ := Lookup(m.Currency)
+	sign := ""
+	n := m.Amount
+	if n < 0 {
+		sign, n = "-", -n
+	}
+	s := strconv.FormatInt(n, 10)
+	if c.Exponent == 0 {
+		return sign + s
+	}
+	if len(s) <= c.Exponent {
+		s = strings.Repeat("0", c.Exponent-len(s)+1) + s
+	}
+	cut := len(s) - c.Exponent
+	return sign + s[:cut] + "." + s[cut:]
+}
+
+// String renders m as "356.00 INR".
+func (m Money) String() string { return m.Decimal() + " " + m.Currency }
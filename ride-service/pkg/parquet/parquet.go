@@ -0,0 +1,302 @@
+// Package parquet writes flat tables as Apache Parquet files: optional
+// columns of strings, integers, floats and timestamps, PLAIN encoded and
+// uncompressed, one data page per column in each row group. That is enough
+// for exports to load into Spark, DuckDB or pandas without pulling in a
+// full Parquet library.
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Type is the type of a column's values.
+type Type int
+
+const (
+	String    Type = iota // UTF-8 text
+	Int64                 // signed 64-bit integer
+	Double                // 64-bit float
+	Timestamp             // microseconds since the Unix epoch, UTC
+)
+
+// Column names a column and the type of its values.
+type Column struct {
+	Name string
+	Type Type
+}
+
+// RowGroupSize is how many rows are buffered before they are written out as
+// a row group.
+const RowGroupSize = 10000
+
+const magic = "PAR1"
+
+// Physical and converted types, encodings and repetition from parquet.thrift.
+const (
+	physInt64     = 2
+	physDouble    = 5
+	physByteArray = 6
+
+	convUTF8            = 0
+	convTimestampMicros = 10
+
+	encPlain = 0
+	encRLE   = 3
+
+	repOptional = 1
+)
+
+// Writer writes rows to a Parquet file. Call Close to write the footer; the
+// file is unreadable without it.
+type Writer struct {
+	out    io.Writer
+	offset int64
+	cols   []Column
+	chunks []chunk
+	rows   int // in the buffered row group
+	groups []rowGroup
+	total  int64 // rows in the written row groups
+	err    error
+}
+
+// chunk buffers one column of the current row group.
+type chunk struct {
+	present []bool // one definition level per row
+	values  bytes.Buffer
+}
+
+type rowGroup struct {
+	rows   int
+	chunks []chunkMeta
+}
+
+type chunkMeta struct {
+	offset, size int64
+	values       int
+}
+
+// NewWriter returns a Writer of cols to out.
+func NewWriter(out io.Writer, cols []Column) *Writer {
+	w := &Writer{out: out, cols: cols, chunks: make([]chunk, len(cols))}
+	w.write([]byte(magic))
+	return w
+}
+
+// Write adds a row: one value per column, in order, of the column's type
+// (string, int64, float64 or time.Time), or nil for null.
+func (w *Writer) Write(row []any) error {
+	if w.err != nil {
+		return w.err
+	}
+	if len(row) != len(w.cols) {
+		return fmt.Errorf("parquet: row has %d values for %d columns", len(row), len(w.cols))
+	}
+	for i, v := range row {
+		if !fits(w.cols[i].Type, v) {
+			return fmt.Errorf("parquet: %T value for column %q", v, w.cols[i].Name)
+		}
+	}
+	for i, v := range row {
+		w.chunks[i].add(v)
+	}
+	w.rows++
+	if w.rows >= RowGroupSize {
+		w.flush()
+	}
+	return w.err
+}
+
+// fits reports whether v may go in a column of type t.
+func fits(t Type, v any) bool {
+	switch v.(type) {
+	case nil:
+		return true
+	case string:
+		return t == String
+	case int64:
+		return t == Int64
+	case float64:
+		return t == Double
+	case time.Time:
+		return t == Timestamp
+	}
+	return false
+}
+
+// add appends v, PLAIN encoded, to the column.
+func (c *chunk) add(v any) {
+	var scratch [8]byte
+	switch x := v.(type) {
+	case nil:
+		c.present = append(c.present, false)
+		return
+	case string:
+		binary.LittleEndian.PutUint32(scratch[:4], uint32(len(x)))
+		c.values.Write(scratch[:4])
+		c.values.WriteString(x)
+	case int64:
+		binary.LittleEndian.PutUint64(scratch[:], uint64(x))
+		c.values.Write(scratch[:])
+	case float64:
+		binary.LittleEndian.PutUint64(scratch[:], math.Float64bits(x))
+		c.values.Write(scratch[:])
+	case time.Time:
+		binary.LittleEndian.PutUint64(scratch[:], uint64(x.UnixMicro()))
+		c.values.Write(scratch[:])
+	}
+	c.present = append(c.present, true)
+}
+
+// Close writes the buffered rows and the footer. It does not close the
+// underlying writer.
+func (w *Writer) Close() error {
+	if w.rows > 0 {
+		w.flush()
+	}
+	if w.err != nil {
+		return w.err
+	}
+	footer := w.footer()
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(len(footer)))
+	w.write(footer)
+	w.write(size[:])
+	w.write([]byte(magic))
+	return w.err
+}
+
+// flush writes the buffered rows as a row group, one data page per column.
+func (w *Writer) flush() {
+	g := rowGroup{rows: w.rows}
+	for i := range w.chunks {
+		c := &w.chunks[i]
+		levels := definitionLevels(c.present)
+		body := make([]byte, 0, 4+len(levels)+c.values.Len())
+		body = binary.LittleEndian.AppendUint32(body, uint32(len(levels)))
+		body = append(body, levels...)
+		body = append(body, c.values.Bytes()...)
+		header := pageHeader(len(c.present), len(body))
+
+		meta := chunkMeta{offset: w.offset, size: int64(len(header) + len(body)), values: len(c.present)}
+		w.write(header)
+		w.write(body)
+		g.chunks = append(g.chunks, meta)
+		c.present = c.present[:0]
+		c.values.Reset()
+	}
+	w.groups = append(w.groups, g)
+	w.total += int64(w.rows)
+	w.rows = 0
+}
+
+func (w *Writer) write(p []byte) {
+	if w.err != nil {
+		return
+	}
+	n, err := w.out.Write(p)
+	w.offset += int64(n)
+	w.err = err
+}
+
+// definitionLevels encodes one level per value (1 present, 0 null) as a
+// single bit-packed run of the RLE/bit-packing hybrid, bit width 1.
+func definitionLevels(present []bool) []byte {
+	groups := (len(present) + 7) / 8
+	out := binary.AppendUvarint(nil, uint64(groups)<<1|1)
+	packed := make([]byte, groups)
+	for i, p := range present {
+		if p {
+			packed[i/8] |= 1 << (i % 8)
+		}
+	}
+	return append(out, packed...)
+}
+
+// pageHeader is the PageHeader of an uncompressed DATA_PAGE of n values.
+func pageHeader(n, size int) []byte {
+	var t thrift
+	t.i32(1, 0) // DATA_PAGE
+	t.i32(2, int32(size))
+	t.i32(3, int32(size))
+	t.begin(5) // DataPageHeader
+	t.i32(1, int32(n))
+	t.i32(2, encPlain)
+	t.i32(3, encRLE) // definition levels
+	t.i32(4, encRLE) // repetition levels
+	t.end()
+	t.stop()
+	return t.buf.Bytes()
+}
+
+// footer is the FileMetaData: the schema, a flat list of optional columns,
+// and where each row group's column chunks are.
+func (w *Writer) footer() []byte {
+	var t thrift
+	t.i32(1, 1) // version
+	t.list(2, typeStruct, len(w.cols)+1)
+	t.item()
+	t.str(4, "schema")
+	t.i32(5, int32(len(w.cols)))
+	t.end()
+	for _, c := range w.cols {
+		t.item()
+		t.i32(1, physical(c.Type))
+		t.i32(3, repOptional)
+		t.str(4, c.Name)
+		switch c.Type {
+		case String:
+			t.i32(6, convUTF8)
+		case Timestamp:
+			t.i32(6, convTimestampMicros)
+		}
+		t.end()
+	}
+	t.i64(3, w.total)
+	t.list(4, typeStruct, len(w.groups))
+	for _, g := range w.groups {
+		t.item()
+		t.list(1, typeStruct, len(g.chunks))
+		var size int64
+		for i, m := range g.chunks {
+			size += m.size
+			t.item() // ColumnChunk
+			t.i64(2, m.offset)
+			t.begin(3) // ColumnMetaData
+			t.i32(1, physical(w.cols[i].Type))
+			t.list(2, typeI32, 2)
+			t.elemI32(encPlain)
+			t.elemI32(encRLE)
+			t.list(3, typeBinary, 1)
+			t.elemStr(w.cols[i].Name)
+			t.i32(4, 0) // UNCOMPRESSED
+			t.i64(5, int64(m.values))
+			t.i64(6, m.size)
+			t.i64(7, m.size)
+			t.i64(9, m.offset)
+			t.end()
+			t.end()
+		}
+		t.i64(2, size)
+		t.i64(3, int64(g.rows))
+		t.end()
+	}
+	t.str(6, "ride-service")
+	t.stop()
+	return t.buf.Bytes()
+}
+
+func physical(t Type) int32 {
+	switch t {
+	case Int64, Timestamp:
+		return physInt64
+	case Double:
+		return physDouble
+	default:
+		return physByteArray
+	}
+}
@@ -0,0 +1,309 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+// The tests read files back with a minimal reader of their own: the Thrift
+// compact protocol into maps of field id to value, then the PLAIN pages the
+// footer points at.
+
+type tstruct map[int16]any
+
+type treader struct {
+	b   []byte
+	pos int
+	err error
+}
+
+func (r *treader) byte() byte {
+	if r.pos >= len(r.b) {
+		r.err = fmt.Errorf("thrift: short read at %d", r.pos)
+		return 0
+	}
+	r.pos++
+	return r.b[r.pos-1]
+}
+
+func (r *treader) uvarint() uint64 {
+	v, n := binary.Uvarint(r.b[r.pos:])
+	if n <= 0 {
+		r.err = fmt.Errorf("thrift: bad varint at %d", r.pos)
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+func (r *treader) varint() int64 {
+	u := r.uvarint()
+	return int64(u>>1) ^ -int64(u&1)
+}
+
+func (r *treader) value(typ byte) any {
+	switch typ {
+	case 1:
+		return true
+	case 2:
+		return false
+	case 3:
+		return int64(int8(r.byte()))
+	case 4, 5, 6:
+		return r.varint()
+	case 7:
+		v := math.Float64frombits(binary.LittleEndian.Uint64(r.b[r.pos:]))
+		r.pos += 8
+		return v
+	case typeBinary:
+		n := int(r.uvarint())
+		s := string(r.b[r.pos : r.pos+n])
+		r.pos += n
+		return s
+	case typeList:
+		h := r.byte()
+		n, elem := int(h>>4), h&0x0f
+		if n == 15 {
+			n = int(r.uvarint())
+		}
+		l := make([]any, n)
+		for i := range l {
+			l[i] = r.value(elem)
+		}
+		return l
+	case typeStruct:
+		return r.strct()
+	}
+	r.err = fmt.Errorf("thrift: unknown type %d at %d", typ, r.pos)
+	return nil
+}
+
+func (r *treader) strct() tstruct {
+	s := tstruct{}
+	var last int16
+	for r.err == nil {
+		h := r.byte()
+		if h == 0 {
+			break
+		}
+		id := last + int16(h>>4)
+		if h>>4 == 0 {
+			id = int16(r.varint())
+		}
+		last = id
+		s[id] = r.value(h & 0x0f)
+	}
+	return s
+}
+
+// readFile decodes a whole file written by Writer: its footer, and its rows
+// with nulls as nil and timestamps as UTC times.
+func readFile(t *testing.T, file []byte) (tstruct, [][]any) {
+	t.Helper()
+	n := len(file)
+	if n < 12 || string(file[:4]) != magic || string(file[n-4:]) != magic {
+		t.Fatalf("not framed by %s", magic)
+	}
+	size := int(binary.LittleEndian.Uint32(file[n-8:]))
+	fr := &treader{b: file[n-8-size : n-8]}
+	meta := fr.strct()
+	if fr.err != nil || fr.pos != size {
+		t.Fatalf("footer: read %d of %d bytes: %v", fr.pos, size, fr.err)
+	}
+
+	schema := meta[2].([]any)
+	cols := len(schema) - 1
+	var rows [][]any
+	for gi, g := range meta[4].([]any) {
+		group := g.(tstruct)
+		groupRows := int(group[3].(int64))
+		out := make([][]any, groupRows)
+		for i := range out {
+			out[i] = make([]any, cols)
+		}
+		for ci, cc := range group[1].([]any) {
+			cm := cc.(tstruct)[3].(tstruct)
+			offset := int(cm[9].(int64))
+			if offset != int(cc.(tstruct)[2].(int64)) {
+				t.Fatalf("group %d column %d: data page at %d, chunk at %d", gi, ci, offset, cc.(tstruct)[2])
+			}
+			if int(cm[5].(int64)) != groupRows {
+				t.Fatalf("group %d column %d: %d values for %d rows", gi, ci, cm[5], groupRows)
+			}
+			pr := &treader{b: file[offset:]}
+			page := pr.strct()
+			if pr.err != nil || page[1].(int64) != 0 {
+				t.Fatalf("group %d column %d: bad page header: %v", gi, ci, pr.err)
+			}
+			body := file[offset+pr.pos : offset+pr.pos+int(page[3].(int64))]
+			if int64(pr.pos)+page[3].(int64) != cm[6].(int64) {
+				t.Fatalf("group %d column %d: chunk size %d, page %d+%d", gi, ci, cm[6], pr.pos, page[3])
+			}
+			present, values := levels(t, body, groupRows)
+			el := schema[ci+1].(tstruct)
+			for i := range out {
+				if present[i] {
+					out[i][ci], values = plain(t, el, values)
+				}
+			}
+			if len(values) != 0 {
+				t.Fatalf("group %d column %d: %d bytes left over", gi, ci, len(values))
+			}
+		}
+		rows = append(rows, out...)
+	}
+	return meta, rows
+}
+
+// levels decodes the definition levels, bit width 1 in the RLE/bit-packing
+// hybrid, ahead of a page's values.
+func levels(t *testing.T, body []byte, n int) ([]bool, []byte) {
+	t.Helper()
+	size := int(binary.LittleEndian.Uint32(body))
+	r := &treader{b: body[4 : 4+size]}
+	var present []bool
+	for r.pos < len(r.b) && r.err == nil {
+		h := r.uvarint()
+		if h&1 == 1 {
+			for i := 0; i < int(h>>1); i++ {
+				b := r.byte()
+				for bit := 0; bit < 8; bit++ {
+					present = append(present, b&(1<<bit) != 0)
+				}
+			}
+		} else {
+			v := r.byte() == 1
+			for i := 0; i < int(h>>1); i++ {
+				present = append(present, v)
+			}
+		}
+	}
+	if r.err != nil || len(present) < n {
+		t.Fatalf("levels: %d for %d values: %v", len(present), n, r.err)
+	}
+	return present[:n], body[4+size:]
+}
+
+// plain decodes one PLAIN value of the column described by el.
+func plain(t *testing.T, el tstruct, b []byte) (any, []byte) {
+	t.Helper()
+	switch el[1].(int64) {
+	case physByteArray:
+		n := int(binary.LittleEndian.Uint32(b))
+		return string(b[4 : 4+n]), b[4+n:]
+	case physDouble:
+		return math.Float64frombits(binary.LittleEndian.Uint64(b)), b[8:]
+	case physInt64:
+		v := int64(binary.LittleEndian.Uint64(b))
+		if conv, ok := el[6]; ok && conv.(int64) == convTimestampMicros {
+			return time.UnixMicro(v).UTC(), b[8:]
+		}
+		return v, b[8:]
+	}
+	t.Fatalf("column %v: unknown physical type %v", el[4], el[1])
+	return nil, nil
+}
+
+var testColumns = []Column{
+	{Name: "trip_id", Type: String},
+	{Name: "fare_paise", Type: Int64},
+	{Name: "distance_km", Type: Double},
+	{Name: "completed_at", Type: Timestamp},
+}
+
+// testRow gives every column nulls on its own cycle, so rows with none, some
+// and all of them null all occur.
+func testRow(i int) []any {
+	row := []any{
+		fmt.Sprintf("trip-%d-ü", i),
+		int64(i)*1000 - 500000,
+		float64(i) / 3,
+		time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(i) * 1234567 * time.Microsecond),
+	}
+	if i%100 == 7 {
+		row[0] = ""
+	}
+	for c, every := range []int{2, 3, 5, 7} {
+		if i%every == 1 || i%210 == 0 {
+			row[c] = nil
+		}
+	}
+	return row
+}
+
+func TestRoundTrip(t *testing.T) {
+	const n = 2*RowGroupSize + 37 // two full row groups and a partial one
+	var buf bytes.Buffer
+	w := NewWriter(&buf, testColumns)
+	for i := 0; i < n; i++ {
+		if err := w.Write(testRow(i)); err != nil {
+			t.Fatalf("row %d: %v", i, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	meta, rows := readFile(t, buf.Bytes())
+	if got := meta[3].(int64); got != n {
+		t.Errorf("num_rows = %d, want %d", got, n)
+	}
+	if got := len(meta[4].([]any)); got != 3 {
+		t.Errorf("%d row groups, want 3", got)
+	}
+	schema := meta[2].([]any)
+	if root := schema[0].(tstruct); root[4] != "schema" || root[5] != int64(len(testColumns)) {
+		t.Errorf("schema root = %v", root)
+	}
+	for i, c := range testColumns {
+		el := schema[i+1].(tstruct)
+		if el[4] != c.Name || el[3] != int64(repOptional) || el[1] != int64(physical(c.Type)) {
+			t.Errorf("schema element %d = %v, want %s", i+1, el, c.Name)
+		}
+	}
+	if len(rows) != n {
+		t.Fatalf("read %d rows, want %d", len(rows), n)
+	}
+	for i, got := range rows {
+		want := testRow(i)
+		for c := range want {
+			if wt, ok := want[c].(time.Time); ok {
+				if gt, ok := got[c].(time.Time); !ok || !gt.Equal(wt) {
+					t.Fatalf("row %d %s = %v, want %v", i, testColumns[c].Name, got[c], wt)
+				}
+				continue
+			}
+			if got[c] != want[c] {
+				t.Fatalf("row %d %s = %#v, want %#v", i, testColumns[c].Name, got[c], want[c])
+			}
+		}
+	}
+}
+
+func TestEmptyFile(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewWriter(&buf, testColumns).Close(); err != nil {
+		t.Fatal(err)
+	}
+	meta, rows := readFile(t, buf.Bytes())
+	if meta[3].(int64) != 0 || len(meta[4].([]any)) != 0 || len(rows) != 0 {
+		t.Errorf("empty file has %v rows in %d groups", meta[3], len(meta[4].([]any)))
+	}
+}
+
+func TestWriteRejectsMismatchedRows(t *testing.T) {
+	w := NewWriter(&bytes.Buffer{}, testColumns)
+	if err := w.Write([]any{"a", int64(1), 1.5}); err == nil {
+		t.Error("short row accepted")
+	}
+	if err := w.Write([]any{"a", 1, 1.5, nil}); err == nil {
+		t.Error("int in an Int64 column accepted")
+	}
+	if err := w.Write([]any{nil, nil, nil, nil}); err != nil {
+		t.Errorf("all-null row: %v", err)
+	}
+}
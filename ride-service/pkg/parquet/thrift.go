@@ -0,0 +1,93 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// Thrift compact protocol type ids.
+const (
+	typeI32    = 5
+	typeI64    = 6
+	typeBinary = 8
+	typeList   = 9
+	typeStruct = 12
+)
+
+// thrift encodes the Parquet metadata structs with the Thrift compact
+// protocol. Fields are written in the order given; each struct, nested or
+// in a list, is opened with begin or item and closed with end.
+type thrift struct {
+	buf   bytes.Buffer
+	last  int16   // id of the previous field in the open struct
+	outer []int16 // last of the enclosing structs
+}
+
+func (t *thrift) field(id int16, typ byte) {
+	if d := id - t.last; d > 0 && d <= 15 {
+		t.buf.WriteByte(byte(d)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.uvarint(uint64(uint16(id<<1 ^ id>>15)))
+	}
+	t.last = id
+}
+
+func (t *thrift) uvarint(v uint64) { t.buf.Write(binary.AppendUvarint(nil, v)) }
+
+func zigzag32(v int32) uint64 { return uint64(uint32(v<<1 ^ v>>31)) }
+
+func (t *thrift) i32(id int16, v int32) {
+	t.field(id, typeI32)
+	t.uvarint(zigzag32(v))
+}
+
+func (t *thrift) i64(id int16, v int64) {
+	t.field(id, typeI64)
+	t.uvarint(uint64(v<<1 ^ v>>63))
+}
+
+func (t *thrift) str(id int16, s string) {
+	t.field(id, typeBinary)
+	t.elemStr(s)
+}
+
+// list starts a list field of n elements of elem type.
+func (t *thrift) list(id int16, elem byte, n int) {
+	t.field(id, typeList)
+	if n < 15 {
+		t.buf.WriteByte(byte(n)<<4 | elem)
+		return
+	}
+	t.buf.WriteByte(0xf0 | elem)
+	t.uvarint(uint64(n))
+}
+
+func (t *thrift) elemI32(v int32) { t.uvarint(zigzag32(v)) }
+
+func (t *thrift) elemStr(s string) {
+	t.uvarint(uint64(len(s)))
+	t.buf.WriteString(s)
+}
+
+// begin opens a struct field.
+func (t *thrift) begin(id int16) {
+	t.field(id, typeStruct)
+	t.item()
+}
+
+// item opens a struct that is a list element.
+func (t *thrift) item() {
+	t.outer = append(t.outer, t.last)
+	t.last = 0
+}
+
+// end closes the innermost open struct.
+func (t *thrift) end() {
+	t.stop()
+	t.last = t.outer[len(t.outer)-1]
+	t.outer = t.outer[:len(t.outer)-1]
+}
+
+// stop ends the top-level struct.
+func (t *thrift) stop() { t.buf.WriteByte(0) }
@@ -0,0 +1,157 @@
+// Package pii encrypts personal data stored at rest, such as emails and phone
+// numbers, with AES-256-GCM.
+//
+// A ciphertext is stored as text, "pii:<key id>:<base64 nonce+sealed>", so
+// the key it was sealed with travels with it: keys can be rotated by adding a
+// new one, making it current and letting the rekeyer rewrite old rows (see
+// StartRekeyer). Values without the prefix are plaintext written before
+// encryption was enabled and are returned as they are.
+//
+// Encrypted values cannot be compared in SQL, so lookups and uniqueness go
+// through a blind index: an HMAC-SHA256 of the normalized value under a
+// separate key that is never rotated, since every index would have to be
+// rebuilt with it.
+package pii
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Fields encrypted and indexed. The field is bound to the ciphertext, so an
+// email cannot be passed off as a phone number.
+const (
+	Email = "email"
+	Phone = "phone"
+)
+
+const prefix = "pii:"
+
+var ErrUnknownKey = errors.New("pii: value sealed with an unknown key")
+
+// Cipher seals and opens values and computes their blind index.
+type Cipher struct {
+	current string
+	keys    map[string]cipher.AEAD
+	index   []byte
+}
+
+// New builds a Cipher from base64 keys by ID. current names the key new
+// values are sealed with; the others only open existing values.
+func New(keys map[string]string, current, indexKey string) (*Cipher, error) {
+	c := &Cipher{current: current, keys: make(map[string]cipher.AEAD, len(keys))}
+	for id, k := range keys {
+		if !validID(id) {
+			return nil, fmt.Errorf("pii: key id %q must be letters, digits and dashes", id)
+		}
+		raw, err := base64.StdEncoding.DecodeString(k)
+		if err != nil || len(raw) != 32 {
+			return nil, fmt.Errorf("pii: key %q must be 32 bytes, base64-encoded", id)
+		}
+		block, err := aes.NewCipher(raw)
+		if err != nil {
+			return nil, err
+		}
+		if c.keys[id], err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := c.keys[current]; !ok {
+		return nil, fmt.Errorf("pii: current key %q is not among the keys", current)
+	}
+	raw, err := base64.StdEncoding.DecodeString(indexKey)
+	if err != nil || len(raw) < 32 {
+		return nil, errors.New("pii: index key must be at least 32 bytes, base64-encoded")
+	}
+	c.index = raw
+	return c, nil
+}
+
+// Encrypt seals value for field under the current key.
+func (c *Cipher) Encrypt(field, value string) (string, error) {
+	aead := c.keys[c.current]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(value)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(field))
+	return prefix + c.current + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt opens a value Encrypt sealed for field. Plaintext, from before
+// encryption, is returned unchanged.
+func (c *Cipher) Decrypt(field, stored string) (string, error) {
+	if !strings.HasPrefix(stored, prefix) {
+		return stored, nil
+	}
+	id, data, ok := strings.Cut(stored[len(prefix):], ":")
+	if !ok {
+		return "", errors.New("pii: malformed ciphertext")
+	}
+	aead, ok := c.keys[id]
+	if !ok {
+		return "", fmt.Errorf("%w %q", ErrUnknownKey, id)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(data)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", errors.New("pii: malformed ciphertext")
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(field))
+	if err != nil {
+		return "", fmt.Errorf("pii: cannot open %s: %w", field, err)
+	}
+	return string(plain), nil
+}
+
+// CurrentPrefix is how every value sealed with the current key starts, for
+// finding the rest in SQL.
+func (c *Cipher) CurrentPrefix() string { return prefix + c.current + ":" }
+
+// validID keeps key IDs free of the separator and of LIKE wildcards.
+func validID(id string) bool {
+	if id == "" || len(id) > 32 {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// Index returns the blind index of value for field. Emails are compared
+// case-insensitively, so they are lower-cased first.
+func (c *Cipher) Index(field, value string) string {
+	value = strings.TrimSpace(value)
+	if field == Email {
+		value = strings.ToLower(value)
+	}
+	mac := hmac.New(sha256.New, c.index)
+	mac.Write([]byte(field + ":" + value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Seal returns value encrypted for field together with its blind index, as
+// repositories store them.
+func (c *Cipher) Seal(field, value string) (stored, index string, err error) {
+	stored, err = c.Encrypt(field, value)
+	return stored, c.Index(field, value), err
+}
+
+// SealOptional is Seal for an optional column update: nil stays nil.
+func (c *Cipher) SealOptional(field string, value *string) (stored, index *string, err error) {
+	if value == nil {
+		return nil, nil, nil
+	}
+	s, i, err := c.Seal(field, *value)
+	return &s, &i, err
+}
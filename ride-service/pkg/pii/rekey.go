@@ -0,0 +1,116 @@
+package pii
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"ride-service/pkg/logging"
+)
+
+var logger = logging.For("pii")
+
+const rekeyBatch = 500
+
+// StartRekeyer brings the email and phone columns of tables up to date, at
+// once and then every interval until ctx is cancelled: plaintext from
+// before encryption is sealed, values sealed with an older key are sealed
+// again with the current one, and missing blind indexes (email_idx,
+// phone_idx) are filled in. Rows are rewritten one at a time and only if
+// unchanged since they were read, so concurrent profile updates win.
+func StartRekeyer(ctx context.Context, pool *pgxpool.Pool, c *Cipher, every time.Duration, tables ...string) {
+	go func() {
+		t := time.NewTicker(every)
+		defer t.Stop()
+		for {
+			for _, table := range tables {
+				n, err := rekey(ctx, pool, c, table)
+				if err != nil && ctx.Err() == nil {
+					logger.Error("rekey failed", "table", table, "err", err)
+				}
+				if n > 0 {
+					logger.Info("rekeyed", "table", table, "rows", n)
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+		}
+	}()
+}
+
+type staleRow struct{ id, email, phone string }
+
+// rekey makes one pass over table in id order and returns how many rows it
+// rewrote. A row whose blind index clashes with another account's (two
+// legacy emails differing only in case) is logged and left for staff.
+func rekey(ctx context.Context, pool *pgxpool.Pool, c *Cipher, table string) (int, error) {
+	current := c.CurrentPrefix() + "%"
+	after := "00000000-0000-0000-0000-000000000000"
+	done := 0
+	for {
+		rows, err := pool.Query(ctx,
+			`SELECT id, email, phone FROM `+table+`
+			 WHERE id > $1 AND (email NOT LIKE $2 OR phone NOT LIKE $2 OR email_idx IS NULL OR phone_idx IS NULL)
+			 ORDER BY id LIMIT $3`, after, current, rekeyBatch)
+		if err != nil {
+			return done, err
+		}
+		batch, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (staleRow, error) {
+			var r staleRow
+			err := row.Scan(&r.id, &r.email, &r.phone)
+			return r, err
+		})
+		if err != nil {
+			return done, err
+		}
+		if len(batch) == 0 {
+			return done, nil
+		}
+		for _, r := range batch {
+			after = r.id
+			ok, err := rewrite(ctx, pool, c, table, r)
+			var pgErr *pgconn.PgError
+			if errors.As(err, &pgErr) && pgErr.Code == "23505" { // unique violation
+				logger.Warn("blind index clashes with another account; row left as is", "table", table, "id", r.id)
+				continue
+			}
+			if err != nil {
+				return done, err
+			}
+			if ok {
+				done++
+			}
+		}
+	}
+}
+
+func rewrite(ctx context.Context, pool *pgxpool.Pool, c *Cipher, table string, r staleRow) (bool, error) {
+	email, err := c.Decrypt(Email, r.email)
+	if err != nil {
+		return false, err
+	}
+	phone, err := c.Decrypt(Phone, r.phone)
+	if err != nil {
+		return false, err
+	}
+	sealedEmail, emailIdx, err := c.Seal(Email, email)
+	if err != nil {
+		return false, err
+	}
+	sealedPhone, phoneIdx, err := c.Seal(Phone, phone)
+	if err != nil {
+		return false, err
+	}
+	tag, err := pool.Exec(ctx,
+		`UPDATE `+table+` SET email=$2, phone=$3, email_idx=$4, phone_idx=$5
+		 WHERE id=$1 AND email=$6 AND phone=$7`,
+		r.id, sealedEmail, sealedPhone, emailIdx, phoneIdx, r.email, r.phone)
+	return tag.RowsAffected() == 1, err
+}
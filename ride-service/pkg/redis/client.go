@@ -2,79 +2,761 @@ package redis
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math"
+	"strconv"
 	"time"
 
 	goredis "github.com/redis/go-redis/v9"
+
+	"ride-service/pkg/geo"
+	"ride-service/pkg/jwt"
 )
 
-// Client wraps the Redis connection.
+// Client wraps the Redis connection. It is the Redis geo.Index.
 type Client struct {
-	rdb *goredis.Client
+	rdb       *goredis.Client
+	geo       Locator
+	locations *locationBuffer // nil: SetDriverLocation writes straight away
+	memory    *memoryServer   // set by NewMemoryClient
 }
 
-// NewClient connects to Redis with retry.
-func NewClient(addr string) (*Client, error) {
+// NewClient connects to Redis, retrying up to attempts times.
+func NewClient(addr string, attempts int) (*Client, error) {
 	rdb := goredis.NewClient(&goredis.Options{Addr: addr})
-	for i := 0; i < 20; i++ {
+	for i := 0; i < attempts; i++ {
 		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 		if err := rdb.Ping(ctx).Err(); err == nil {
 			cancel()
 			log.Println("Connected to Redis")
-			return &Client{rdb: rdb}, nil
+			return &Client{rdb: rdb, geo: Locator{Precision: DefaultShardPrecision}}, nil
 		}
 		cancel()
-		log.Printf("Waiting for Redis... (%d/20)", i+1)
+		log.Printf("Waiting for Redis... (%d/%d)", i+1, attempts)
 		time.Sleep(2 * time.Second)
 	}
-	return nil, fmt.Errorf("redis: failed to connect after 20 attempts")
+	return nil, fmt.Errorf("redis: failed to connect after %d attempts", attempts)
 }
 
-// SetDriverLocation stores a driver's position in a Redis GEO set.
+// DriverPosition is a driver's last reported coordinate.
+type DriverPosition = geo.Position
+
+// SetDriverLocation stores a driver's position in the GEO sets of its shard.
+// The position is written both to the matchable pool (driver:locations:<cell>)
+// and to driver:positions:<cell>, which keeps every driver's last known
+// coordinate even while they are assigned and out of the pool. A driver who
+// crossed into another cell leaves the old one. With BufferLocations it waits
+// for the next flush.
 func (c *Client) SetDriverLocation(ctx context.Context, driverID string, lat, lng float64) error {
-	return c.rdb.GeoAdd(ctx, "driver:locations", &goredis.GeoLocation{
-		Name:      driverID,
-		Longitude: lng,
-		Latitude:  lat,
-	}).Err()
+	pos := DriverPosition{DriverID: driverID, Lat: lat, Lng: lng}
+	if c.locations != nil {
+		return c.locations.add(ctx, pos)
+	}
+	return c.storePositions(ctx, []DriverPosition{pos}, poolJoin)
+}
+
+// SetDriverLocations is SetDriverLocation for many drivers at once, in a
+// single round trip.
+func (c *Client) SetDriverLocations(ctx context.Context, positions []DriverPosition) error {
+	return c.storePositions(ctx, positions, poolJoin)
+}
+
+// SetDriverPositions stores the last known positions of drivers who must
+// not be matched, such as those on a trip, taking them out of the pool.
+// It is written straight away, and supersedes their buffered updates.
+func (c *Client) SetDriverPositions(ctx context.Context, positions []DriverPosition) error {
+	if c.locations != nil {
+		for _, p := range positions {
+			c.locations.drop(p.DriverID)
+		}
+	}
+	return c.storePositions(ctx, positions, poolLeave)
+}
+
+// GetDriversInBox returns the last known positions of all drivers inside the
+// bounding box [minLat,maxLat] x [minLng,maxLng].
+func (c *Client) GetDriversInBox(ctx context.Context, minLat, minLng, maxLat, maxLng float64) ([]DriverPosition, error) {
+	centerLat := (minLat + maxLat) / 2
+	centerLng := (minLng + maxLng) / 2
+
+	// GEOSEARCH BYBOX works in distance units around a centre point, so convert
+	// the degree spans to km (with a little slack) and filter exactly below.
+	// Redis measures each point's east-west offset along its own parallel,
+	// so the width is taken where a degree of longitude is longest: at the
+	// latitude in the box closest to the equator.
+	equatorward := 0.0
+	if minLat > 0 {
+		equatorward = minLat
+	} else if maxLat < 0 {
+		equatorward = maxLat
+	}
+	heightKm := (maxLat-minLat)*111.0 + 1
+	widthKm := (maxLng-minLng)*111.0*math.Cos(equatorward*math.Pi/180) + 1
+
+	shards, err := c.shards(ctx, minLat, minLng, maxLat, maxLng)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.searchShards(ctx, positionPrefix, shards, &goredis.GeoSearchLocationQuery{
+		GeoSearchQuery: goredis.GeoSearchQuery{
+			Longitude: centerLng,
+			Latitude:  centerLat,
+			BoxWidth:  widthKm,
+			BoxHeight: heightKm,
+			BoxUnit:   "km",
+		},
+		WithCoord: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]DriverPosition, 0, len(res))
+	for _, loc := range res {
+		if loc.Latitude < minLat || loc.Latitude > maxLat || loc.Longitude < minLng || loc.Longitude > maxLng {
+			continue
+		}
+		out = append(out, DriverPosition{DriverID: loc.Name, Lat: loc.Latitude, Lng: loc.Longitude})
+	}
+	return out, nil
 }
 
-// GetNearbyDrivers returns driver IDs within radiusKm of (lat,lng).
+// GetNearbyDrivers returns driver IDs within radiusKm of (lat,lng), nearest
+// first.
 func (c *Client) GetNearbyDrivers(ctx context.Context, lat, lng, radiusKm float64, count int) ([]string, error) {
-	res, err := c.rdb.GeoSearch(ctx, "driver:locations", &goredis.GeoSearchQuery{
-		Longitude:  lng,
-		Latitude:   lat,
-		Radius:     radiusKm,
-		RadiusUnit: "km",
-		Count:      count,
-		Sort:       "ASC",
-	}).Result()
+	nearby, err := c.SearchNearbyDrivers(ctx, lat, lng, radiusKm, count)
 	if err != nil {
 		return nil, err
 	}
-	return res, nil
+	ids := make([]string, len(nearby))
+	for i, d := range nearby {
+		ids[i] = d.DriverID
+	}
+	return ids, nil
 }
 
-// RemoveDriverLocation removes a driver from the GEO set (e.g. when assigned).
+// NearbyDriver is a matchable driver and their distance from the search point.
+type NearbyDriver = geo.Nearby
+
+// SearchNearbyDrivers is GetNearbyDrivers with each driver's distance. Near a
+// cell border it searches the neighbouring shards too.
+func (c *Client) SearchNearbyDrivers(ctx context.Context, lat, lng, radiusKm float64, count int) ([]NearbyDriver, error) {
+	minLat, minLng, maxLat, maxLng := circleBox(lat, lng, radiusKm)
+	shards, err := c.shards(ctx, minLat, minLng, maxLat, maxLng)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.searchShards(ctx, poolPrefix, shards, &goredis.GeoSearchLocationQuery{
+		GeoSearchQuery: goredis.GeoSearchQuery{
+			Longitude:  lng,
+			Latitude:   lat,
+			Radius:     radiusKm,
+			RadiusUnit: "km",
+			Count:      count,
+			Sort:       "ASC",
+		},
+		WithDist: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]NearbyDriver, len(res))
+	for i, loc := range res {
+		out[i] = NearbyDriver{DriverID: loc.Name, DistanceKm: loc.Dist}
+	}
+	return out, nil
+}
+
+// RemoveDriverLocation takes a driver out of the matchable pool of their
+// shard (e.g. when assigned). Their buffered updates are dropped so a later
+// flush cannot put them back.
 func (c *Client) RemoveDriverLocation(ctx context.Context, driverID string) error {
-	return c.rdb.ZRem(ctx, "driver:locations", driverID).Err()
+	if c.locations != nil {
+		c.locations.drop(driverID)
+	}
+	return leaveScript.Run(ctx, c.rdb, nil, driverID).Err()
+}
+
+// reserveScript takes driver:reservation:<driver> for a trip unless another
+// trip holds it. Re-reserving for the same trip refreshes the TTL, so a
+// redelivered ride.requested is not mistaken for a clash.
+var reserveScript = goredis.NewScript(`
+local cur = redis.call("GET", KEYS[1])
+if cur == ARGV[1] then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	return 1
+end
+if cur then
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+return 1`)
+
+// releaseScript deletes the reservation only if it still belongs to the trip.
+var releaseScript = goredis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// ReserveDriver atomically reserves a driver for a trip for ttl. It reports
+// false if the driver is already reserved for a different trip, so that
+// matcher instances racing for the same driver cannot both assign them.
+func (c *Client) ReserveDriver(ctx context.Context, driverID, tripID string, ttl time.Duration) (bool, error) {
+	n, err := reserveScript.Run(ctx, c.rdb, []string{"driver:reservation:" + driverID}, tripID, ttl.Milliseconds()).Int()
+	return n == 1, err
+}
+
+// ReleaseDriver drops the driver's reservation if it is held for tripID.
+func (c *Client) ReleaseDriver(ctx context.Context, driverID, tripID string) error {
+	return releaseScript.Run(ctx, c.rdb, []string{"driver:reservation:" + driverID}, tripID).Err()
+}
+
+// Queue zones are sorted sets, queue:<zone>, of driver IDs scored by when
+// they joined; queue:driver:<id> names the zone a driver is queued in, so
+// they are in at most one.
+
+// joinQueueScript moves a driver into the queue of zone ARGV[2] unless they
+// are already in it, keeping their place if so.
+var joinQueueScript = goredis.NewScript(`
+local cur = redis.call("GET", KEYS[1])
+if cur == ARGV[2] then
+	return 0
+end
+if cur then
+	redis.call("ZREM", "queue:" .. cur, ARGV[1])
+end
+redis.call("SET", KEYS[1], ARGV[2])
+redis.call("ZADD", "queue:" .. ARGV[2], "NX", ARGV[3], ARGV[1])
+return 1`)
+
+// leaveQueueScript takes a driver out of whichever queue they are in.
+var leaveQueueScript = goredis.NewScript(`
+local cur = redis.call("GET", KEYS[1])
+if not cur then
+	return 0
+end
+redis.call("ZREM", "queue:" .. cur, ARGV[1])
+redis.call("DEL", KEYS[1])
+return 1`)
+
+// JoinQueue puts driverID at the back of zone's queue as of at, leaving any
+// other queue. A driver already in zone's queue keeps their place; joined
+// reports whether they were new to it.
+func (c *Client) JoinQueue(ctx context.Context, zone, driverID string, at time.Time) (joined bool, err error) {
+	n, err := joinQueueScript.Run(ctx, c.rdb, []string{"queue:driver:" + driverID}, driverID, zone, at.UnixMilli()).Int()
+	return n == 1, err
+}
+
+// LeaveQueue takes driverID out of their queue, if they are in one.
+func (c *Client) LeaveQueue(ctx context.Context, driverID string) error {
+	return leaveQueueScript.Run(ctx, c.rdb, []string{"queue:driver:" + driverID}, driverID).Err()
+}
+
+// QueuePosition returns the zone driverID is queued in, their 1-based place
+// and the queue's length; ok is false when they are not queued.
+func (c *Client) QueuePosition(ctx context.Context, driverID string) (zone string, place, size int64, ok bool, err error) {
+	zone, err = c.rdb.Get(ctx, "queue:driver:"+driverID).Result()
+	if errors.Is(err, goredis.Nil) {
+		return "", 0, 0, false, nil
+	} else if err != nil {
+		return "", 0, 0, false, err
+	}
+	pipe := c.rdb.Pipeline()
+	rank := pipe.ZRank(ctx, "queue:"+zone, driverID)
+	card := pipe.ZCard(ctx, "queue:"+zone)
+	if _, err := pipe.Exec(ctx); errors.Is(err, goredis.Nil) {
+		return "", 0, 0, false, nil // left between the two reads
+	} else if err != nil {
+		return "", 0, 0, false, err
+	}
+	return zone, rank.Val() + 1, card.Val(), true, nil
+}
+
+// QueueHead returns the first n drivers in zone's queue, longest waiting
+// first.
+func (c *Client) QueueHead(ctx context.Context, zone string, n int64) ([]string, error) {
+	return c.rdb.ZRange(ctx, "queue:"+zone, 0, n-1).Result()
+}
+
+// RevokeTokens records that userID's tokens issued up to at are revoked,
+// for ttl (the token lifetime).
+func (c *Client) RevokeTokens(ctx context.Context, userID string, at time.Time, ttl time.Duration) error {
+	return c.rdb.Set(ctx, "tokens:revoked:"+userID, at.UnixMilli(), ttl).Err()
+}
+
+// TokensRevokedAt returns when userID's tokens were revoked, if they were.
+func (c *Client) TokensRevokedAt(ctx context.Context, userID string) (time.Time, bool, error) {
+	ms, err := c.rdb.Get(ctx, "tokens:revoked:"+userID).Int64()
+	if errors.Is(err, goredis.Nil) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	return time.UnixMilli(ms), true, nil
+}
+
+// ClearRevocation forgets userID's token revocation.
+func (c *Client) ClearRevocation(ctx context.Context, userID string) error {
+	return c.rdb.Del(ctx, "tokens:revoked:"+userID).Err()
+}
+
+// LoginFailure counts a failed login under key and returns the count,
+// which is forgotten window after the last failure.
+func (c *Client) LoginFailure(ctx context.Context, key string, window time.Duration) (int, error) {
+	pipe := c.rdb.TxPipeline()
+	incr := pipe.Incr(ctx, "login:fail:"+key)
+	pipe.PExpire(ctx, "login:fail:"+key, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return int(incr.Val()), nil
+}
+
+// LoginLock returns how long logins under key stay locked; 0 if they are not.
+func (c *Client) LoginLock(ctx context.Context, key string) (time.Duration, error) {
+	d, err := c.rdb.PTTL(ctx, "login:lock:"+key).Result()
+	if err != nil || d < 0 {
+		return 0, err
+	}
+	return d, nil
+}
+
+// LockLogin locks logins under key for d.
+func (c *Client) LockLogin(ctx context.Context, key string, d time.Duration) error {
+	return c.rdb.Set(ctx, "login:lock:"+key, 1, d).Err()
+}
+
+// ClearLoginFailures forgets key's failed logins and lifts its lock.
+func (c *Client) ClearLoginFailures(ctx context.Context, key string) error {
+	return c.rdb.Del(ctx, "login:fail:"+key, "login:lock:"+key).Err()
+}
+
+// Sessions are hashes, session:<id>, expiring with their token; each
+// account's session IDs are in the sorted set sessions:<user id>, scored by
+// when they were issued.
+
+// startSessionScript records session ARGV[1] and ends the oldest beyond
+// ARGV[4] (0: no limit), returning their IDs. Expired IDs are dropped from
+// the set first, so they do not count.
+var startSessionScript = goredis.NewScript(`
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", tonumber(ARGV[2]) - tonumber(ARGV[3]))
+redis.call("HSET", KEYS[2], "user_id", ARGV[5], "role", ARGV[6], "user_agent", ARGV[7], "ip", ARGV[8],
+	"issued_at", ARGV[2], "last_seen", ARGV[2], "expires_at", ARGV[9])
+redis.call("PEXPIRE", KEYS[2], ARGV[3])
+redis.call("ZADD", KEYS[1], ARGV[2], ARGV[1])
+redis.call("PEXPIRE", KEYS[1], ARGV[3])
+local max = tonumber(ARGV[4])
+local evicted = {}
+if max > 0 then
+	local over = redis.call("ZCARD", KEYS[1]) - max
+	if over > 0 then
+		evicted = redis.call("ZRANGE", KEYS[1], 0, over - 1)
+		redis.call("ZREMRANGEBYRANK", KEYS[1], 0, over - 1)
+		for _, id in ipairs(evicted) do
+			redis.call("DEL", "session:" .. id)
+		end
+	end
+end
+return evicted`)
+
+// touchSessionScript reports whether the session exists, moving its
+// last_seen to ARGV[1] if that is at least ARGV[2] ms later, so a busy
+// client does not write on every request.
+var touchSessionScript = goredis.NewScript(`
+local seen = redis.call("HGET", KEYS[1], "last_seen")
+if not seen then
+	return 0
+end
+if tonumber(ARGV[1]) - tonumber(seen) >= tonumber(ARGV[2]) then
+	redis.call("HSET", KEYS[1], "last_seen", ARGV[1])
+end
+return 1`)
+
+// endSessionScript ends session ARGV[1] if it belongs to the account.
+var endSessionScript = goredis.NewScript(`
+if redis.call("ZREM", KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call("DEL", "session:" .. ARGV[1])
+return 1`)
+
+// endSessionsScript ends all of an account's sessions.
+var endSessionsScript = goredis.NewScript(`
+local ids = redis.call("ZRANGE", KEYS[1], 0, -1)
+for _, id in ipairs(ids) do
+	redis.call("DEL", "session:" .. id)
+end
+redis.call("DEL", KEYS[1])
+return #ids`)
+
+// sessionSeenEvery is how often a session's last_seen is moved forward.
+const sessionSeenEvery = time.Minute
+
+// StartSession records s for ttl and ends userID's oldest sessions beyond
+// max, returning their IDs.
+func (c *Client) StartSession(ctx context.Context, s jwt.Session, max int, ttl time.Duration) ([]string, error) {
+	return startSessionScript.Run(ctx, c.rdb, []string{"sessions:" + s.UserID, "session:" + s.ID},
+		s.ID, s.IssuedAt.UnixMilli(), ttl.Milliseconds(), max,
+		s.UserID, s.Role, s.UserAgent, s.IP, s.ExpiresAt.UnixMilli()).StringSlice()
+}
+
+// TouchSession marks session id seen at at, at most once a minute, and
+// reports whether it is still open.
+func (c *Client) TouchSession(ctx context.Context, id string, at time.Time) (bool, error) {
+	n, err := touchSessionScript.Run(ctx, c.rdb, []string{"session:" + id}, at.UnixMilli(), sessionSeenEvery.Milliseconds()).Int()
+	return n == 1, err
+}
+
+// Sessions returns userID's open sessions, newest first.
+func (c *Client) Sessions(ctx context.Context, userID string) ([]jwt.Session, error) {
+	ids, err := c.rdb.ZRevRange(ctx, "sessions:"+userID, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	pipe := c.rdb.Pipeline()
+	cmds := make([]*goredis.MapStringStringCmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = pipe.HGetAll(ctx, "session:"+id)
+	}
+	if len(ids) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, err
+		}
+	}
+	out := make([]jwt.Session, 0, len(ids))
+	for i, cmd := range cmds {
+		h := cmd.Val()
+		if len(h) == 0 {
+			continue // expired since the set was read
+		}
+		out = append(out, jwt.Session{
+			ID: ids[i], UserID: h["user_id"], Role: h["role"], UserAgent: h["user_agent"], IP: h["ip"],
+			IssuedAt: unixMilli(h["issued_at"]), LastSeen: unixMilli(h["last_seen"]), ExpiresAt: unixMilli(h["expires_at"]),
+		})
+	}
+	return out, nil
+}
+
+// EndSession ends userID's session id, reporting false if they have none
+// by that ID.
+func (c *Client) EndSession(ctx context.Context, userID, id string) (bool, error) {
+	n, err := endSessionScript.Run(ctx, c.rdb, []string{"sessions:" + userID}, id).Int()
+	return n == 1, err
+}
+
+// EndSessions ends all of userID's sessions.
+func (c *Client) EndSessions(ctx context.Context, userID string) error {
+	return endSessionsScript.Run(ctx, c.rdb, []string{"sessions:" + userID}).Err()
+}
+
+func unixMilli(s string) time.Time {
+	ms, _ := strconv.ParseInt(s, 10, 64)
+	return time.UnixMilli(ms).UTC()
 }
 
-// CacheTrip stores trip data in a hash with TTL.
-func (c *Client) CacheTrip(ctx context.Context, tripID string, data map[string]string) error {
-	key := "trip:" + tripID
+// PutVerification stores a pending change awaiting a code under key,
+// replacing any earlier one, with no attempts used yet.
+func (c *Client) PutVerification(ctx context.Context, key, value, codeHash string, ttl time.Duration) error {
+	k := "verify:" + key
+	pipe := c.rdb.TxPipeline()
+	pipe.Del(ctx, k)
+	pipe.HSet(ctx, k, "value", value, "code", codeHash, "attempts", 0)
+	pipe.Expire(ctx, k, ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// VerificationAttempt counts an attempt at key's code and returns the pending
+// value, the code hash and the attempts made including this one. ok is false
+// when nothing is pending.
+func (c *Client) VerificationAttempt(ctx context.Context, key string) (value, codeHash string, attempts int, ok bool, err error) {
+	k := "verify:" + key
+	if n, err := c.rdb.Exists(ctx, k).Result(); err != nil || n == 0 {
+		return "", "", 0, false, err
+	}
+	n, err := c.rdb.HIncrBy(ctx, k, "attempts", 1).Result()
+	if err != nil {
+		return "", "", 0, false, err
+	}
+	v, err := c.rdb.HMGet(ctx, k, "value", "code").Result()
+	if err != nil {
+		return "", "", 0, false, err
+	}
+	value, _ = v[0].(string)
+	codeHash, _ = v[1].(string)
+	if value == "" { // expired between the calls
+		return "", "", 0, false, nil
+	}
+	return value, codeHash, int(n), true, nil
+}
+
+// DeleteVerification drops the pending change under key.
+func (c *Client) DeleteVerification(ctx context.Context, key string) error {
+	return c.rdb.Del(ctx, "verify:"+key).Err()
+}
+
+// PutContact stores a masked-call session value under token and its dial-in
+// pin for ttl, listed under the trip so it can be dropped when the trip ends.
+// ok is false, and nothing is stored, when pin is already in use.
+func (c *Client) PutContact(ctx context.Context, tripID, token, pin, value string, ttl time.Duration) (ok bool, err error) {
+	pinKey := "contact:pin:" + pin
+	if ok, err := c.rdb.SetNX(ctx, pinKey, token, ttl).Result(); err != nil || !ok {
+		return false, err
+	}
+	tripKey := "contact:trip:" + tripID
+	pipe := c.rdb.TxPipeline()
+	pipe.Set(ctx, "contact:"+token, value, ttl)
+	pipe.SAdd(ctx, tripKey, "contact:"+token, pinKey)
+	pipe.Expire(ctx, tripKey, ttl)
+	_, err = pipe.Exec(ctx)
+	return err == nil, err
+}
+
+// Contact returns the session value stored under token.
+func (c *Client) Contact(ctx context.Context, token string) (value string, ok bool, err error) {
+	value, err = c.rdb.Get(ctx, "contact:"+token).Result()
+	if errors.Is(err, goredis.Nil) {
+		return "", false, nil
+	}
+	return value, err == nil, err
+}
+
+// ContactByPIN returns the token and session value for a dial-in pin.
+func (c *Client) ContactByPIN(ctx context.Context, pin string) (token, value string, ok bool, err error) {
+	token, err = c.rdb.Get(ctx, "contact:pin:"+pin).Result()
+	if errors.Is(err, goredis.Nil) {
+		return "", "", false, nil
+	} else if err != nil {
+		return "", "", false, err
+	}
+	value, ok, err = c.Contact(ctx, token)
+	return token, value, ok, err
+}
+
+// DeleteTripContacts drops every masked-call session of the trip.
+func (c *Client) DeleteTripContacts(ctx context.Context, tripID string) error {
+	tripKey := "contact:trip:" + tripID
+	keys, err := c.rdb.SMembers(ctx, tripKey).Result()
+	if err != nil {
+		return err
+	}
+	return c.rdb.Del(ctx, append(keys, tripKey)...).Err()
+}
+
+// Heatmap counts live in one-minute buckets, heat:<kind>:<unix minute>, that
+// expire on their own: a window is read by merging its buckets.
+
+func heatKey(kind string, minute int64) string { return fmt.Sprintf("heat:%s:%d", kind, minute) }
+
+// heatBuckets lists the minutes from since to until, inclusive.
+func heatBuckets(since, until time.Time) []int64 {
+	var out []int64
+	for m := since.Unix() / 60; m <= until.Unix()/60; m++ {
+		out = append(out, m)
+	}
+	return out
+}
+
+// AddDemand counts a ride request in cell at time at, kept for keep.
+func (c *Client) AddDemand(ctx context.Context, cell string, at time.Time, keep time.Duration) error {
+	k := heatKey("demand", at.Unix()/60)
 	pipe := c.rdb.Pipeline()
-	pipe.HSet(ctx, key, data)
-	pipe.Expire(ctx, key, 24*time.Hour)
+	pipe.HIncrBy(ctx, k, cell, 1)
+	pipe.Expire(ctx, k, keep+time.Minute)
 	_, err := pipe.Exec(ctx)
 	return err
 }
 
-// GetCachedTrip retrieves a cached trip hash.
-func (c *Client) GetCachedTrip(ctx context.Context, tripID string) (map[string]string, error) {
-	return c.rdb.HGetAll(ctx, "trip:"+tripID).Result()
+// SetSupply records that driverID was in cell at time at, kept for keep.
+func (c *Client) SetSupply(ctx context.Context, driverID, cell string, at time.Time, keep time.Duration) error {
+	k := heatKey("supply", at.Unix()/60)
+	pipe := c.rdb.Pipeline()
+	pipe.HSet(ctx, k, driverID, cell)
+	pipe.Expire(ctx, k, keep+time.Minute)
+	_, err := pipe.Exec(ctx)
+	return err
 }
 
-// Close tears down the Redis connection.
-func (c *Client) Close() error { return c.rdb.Close() }
+// ClearSupply removes driverID from the supply buckets between since and until.
+func (c *Client) ClearSupply(ctx context.Context, driverID string, since, until time.Time) error {
+	pipe := c.rdb.Pipeline()
+	for _, m := range heatBuckets(since, until) {
+		pipe.HDel(ctx, heatKey("supply", m), driverID)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Demand returns ride requests per cell between since and until.
+func (c *Client) Demand(ctx context.Context, since, until time.Time) (map[string]int, error) {
+	pipe := c.rdb.Pipeline()
+	var cmds []*goredis.MapStringStringCmd
+	for _, m := range heatBuckets(since, until) {
+		cmds = append(cmds, pipe.HGetAll(ctx, heatKey("demand", m)))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	out := map[string]int{}
+	for _, cmd := range cmds {
+		for cell, v := range cmd.Val() {
+			n, _ := strconv.Atoi(v)
+			out[cell] += n
+		}
+	}
+	return out, nil
+}
+
+// Supply returns each driver's latest cell between since and until.
+func (c *Client) Supply(ctx context.Context, since, until time.Time) (map[string]string, error) {
+	pipe := c.rdb.Pipeline()
+	var cmds []*goredis.MapStringStringCmd
+	for _, m := range heatBuckets(since, until) {
+		cmds = append(cmds, pipe.HGetAll(ctx, heatKey("supply", m)))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	out := map[string]string{}
+	for _, cmd := range cmds { // oldest first, so later cells win
+		for driver, cell := range cmd.Val() {
+			out[driver] = cell
+		}
+	}
+	return out, nil
+}
+
+// Ping is a driver location at a point in time.
+type Ping struct {
+	Lat, Lng float64
+	At       time.Time
+}
+
+// SwapLastPing stores p as the driver's latest ping, kept for ttl, and returns
+// the one it replaces; ok is false when there was none.
+func (c *Client) SwapLastPing(ctx context.Context, driverID string, p Ping, ttl time.Duration) (prev Ping, ok bool, err error) {
+	val := fmt.Sprintf("%f,%f,%d", p.Lat, p.Lng, p.At.UnixMilli())
+	old, err := c.rdb.SetArgs(ctx, "ping:last:"+driverID, val, goredis.SetArgs{Get: true, TTL: ttl}).Result()
+	if errors.Is(err, goredis.Nil) {
+		return Ping{}, false, nil
+	} else if err != nil {
+		return Ping{}, false, err
+	}
+	var ms int64
+	if _, err := fmt.Sscanf(old, "%f,%f,%d", &prev.Lat, &prev.Lng, &ms); err != nil {
+		return Ping{}, false, nil // unreadable: treat as the first ping
+	}
+	prev.At = time.UnixMilli(ms)
+	return prev, true, nil
+}
+
+// ClearLastPing forgets the driver's latest ping.
+func (c *Client) ClearLastPing(ctx context.Context, driverID string) error {
+	return c.rdb.Del(ctx, "ping:last:"+driverID).Err()
+}
+
+// Each trip's socket messages are kept in a stream, ws:history:<trip>, capped
+// at a length and expiring a while after the last message.
+
+// TripMessage is one message from a trip's socket history.
+type TripMessage struct {
+	ID   string // stream ID, e.g. 1771439400000-0
+	Data []byte
+}
+
+// AppendTripMessage adds data to tripID's history, keeping the last keep
+// messages for ttl, and returns its ID.
+func (c *Client) AppendTripMessage(ctx context.Context, tripID string, data []byte, keep int64, ttl time.Duration) (string, error) {
+	k := "ws:history:" + tripID
+	pipe := c.rdb.Pipeline()
+	add := pipe.XAdd(ctx, &goredis.XAddArgs{Stream: k, MaxLen: keep, Values: []any{"m", data}})
+	pipe.Expire(ctx, k, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return "", err
+	}
+	return add.Val(), nil
+}
+
+// TripMessages returns tripID's history after the message with ID since, or
+// all of it when since is empty, oldest first.
+func (c *Client) TripMessages(ctx context.Context, tripID, since string) ([]TripMessage, error) {
+	start := "-"
+	if since != "" {
+		start = "(" + since
+	}
+	res, err := c.rdb.XRange(ctx, "ws:history:"+tripID, start, "+").Result()
+	if err != nil {
+		return nil, err
+	}
+	out := make([]TripMessage, 0, len(res))
+	for _, m := range res {
+		if data, ok := m.Values["m"].(string); ok {
+			out = append(out, TripMessage{ID: m.ID, Data: []byte(data)})
+		}
+	}
+	return out, nil
+}
+
+// Feature flags are one hash, featureflags, of each flag's JSON by key.
+
+// FeatureFlags returns every stored flag's JSON by key.
+func (c *Client) FeatureFlags(ctx context.Context) (map[string]string, error) {
+	return c.rdb.HGetAll(ctx, "featureflags").Result()
+}
+
+// SetFeatureFlag stores a flag's JSON under key.
+func (c *Client) SetFeatureFlag(ctx context.Context, key, value string) error {
+	return c.rdb.HSet(ctx, "featureflags", key, value).Err()
+}
+
+// DeleteFeatureFlag removes the flag stored under key, reporting whether
+// there was one.
+func (c *Client) DeleteFeatureFlag(ctx context.Context, key string) (bool, error) {
+	n, err := c.rdb.HDel(ctx, "featureflags", key).Result()
+	return n > 0, err
+}
+
+// GetCached returns the value cached under key, if any.
+func (c *Client) GetCached(ctx context.Context, key string) ([]byte, bool, error) {
+	data, err := c.rdb.Get(ctx, "cache:"+key).Bytes()
+	if errors.Is(err, goredis.Nil) {
+		return nil, false, nil
+	}
+	return data, err == nil, err
+}
+
+// SetCached caches value under key for ttl.
+func (c *Client) SetCached(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return c.rdb.Set(ctx, "cache:"+key, value, ttl).Err()
+}
+
+// DeleteCached drops the cached values of keys.
+func (c *Client) DeleteCached(ctx context.Context, keys ...string) error {
+	full := make([]string, len(keys))
+	for i, k := range keys {
+		full[i] = "cache:" + k
+	}
+	return c.rdb.Del(ctx, full...).Err()
+}
+
+// Ping checks that Redis is reachable.
+func (c *Client) Ping(ctx context.Context) error { return c.rdb.Ping(ctx).Err() }
+
+// AddHook installs a go-redis hook (e.g. for fault injection) on the client.
+func (c *Client) AddHook(h goredis.Hook) { c.rdb.AddHook(h) }
+
+// Close flushes buffered locations and tears down the Redis connection.
+func (c *Client) Close() error {
+	if c.locations != nil {
+		c.locations.close()
+	}
+	err := c.rdb.Close()
+	if c.memory != nil {
+		c.memory.close()
+	}
+	return err
+}
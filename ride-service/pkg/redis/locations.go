@@ -0,0 +1,201 @@
+package redis
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// flushTimeout bounds one flush of buffered locations.
+const flushTimeout = 5 * time.Second
+
+// FlushStats describes the buffered location writes since startup.
+type FlushStats struct {
+	Enabled    bool  `json:"enabled"`
+	IntervalMs int64 `json:"interval_ms"`
+	Size       int   `json:"size"`
+	Pending    int   `json:"pending"` // updates waiting for the next flush
+	Updates    int64 `json:"updates"` // updates buffered
+	// Written are the positions sent to Redis. An update superseded by a
+	// newer one for the same driver in the same flush, or dropped because
+	// the driver left the pool, is Coalesced instead.
+	Written   int64 `json:"written"`
+	Coalesced int64 `json:"coalesced"`
+	Flushes   int64 `json:"flushes"`
+	// FullFlushes were started by the buffer reaching Size rather than by
+	// the interval.
+	FullFlushes   int64      `json:"full_flushes"`
+	FailedFlushes int64      `json:"failed_flushes"`
+	LastFlushSize int        `json:"last_flush_size"`
+	LastFlushMs   float64    `json:"last_flush_ms"`
+	LastFlushAt   *time.Time `json:"last_flush_at,omitempty"`
+}
+
+type locationWrite struct {
+	pos  DriverPosition
+	done chan error
+}
+
+// locationBuffer collects SetDriverLocation calls and writes them with
+// SetDriverLocations.
+type locationBuffer struct {
+	c        *Client
+	interval time.Duration
+	size     int
+
+	mu      sync.Mutex
+	pending []locationWrite
+	closed  bool
+	stats   FlushStats
+
+	full    chan struct{} // the buffer reached size
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// BufferLocations makes SetDriverLocation queue updates and write them in
+// one pipeline every interval, or as soon as size are waiting. Each call
+// still returns the result of its flush. Call it before serving; Close
+// flushes what is left.
+func (c *Client) BufferLocations(interval time.Duration, size int) {
+	if interval <= 0 || size < 1 {
+		return
+	}
+	b := &locationBuffer{
+		c: c, interval: interval, size: size,
+		full: make(chan struct{}, 1), stop: make(chan struct{}), stopped: make(chan struct{}),
+	}
+	b.stats.Enabled, b.stats.IntervalMs, b.stats.Size = true, interval.Milliseconds(), size
+	c.locations = b
+	go b.run()
+}
+
+// LocationFlushStats reports on buffered location writes.
+func (c *Client) LocationFlushStats() FlushStats {
+	if c.locations == nil {
+		return FlushStats{}
+	}
+	b := c.locations
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st := b.stats
+	st.Pending = len(b.pending)
+	return st
+}
+
+// add queues pos and waits for it to be flushed.
+func (b *locationBuffer) add(ctx context.Context, pos DriverPosition) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return b.c.SetDriverLocations(ctx, []DriverPosition{pos})
+	}
+	w := locationWrite{pos: pos, done: make(chan error, 1)}
+	b.pending = append(b.pending, w)
+	b.stats.Updates++
+	if len(b.pending) >= b.size {
+		select {
+		case b.full <- struct{}{}:
+		default:
+		}
+	}
+	b.mu.Unlock()
+
+	select {
+	case err := <-w.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// drop discards driverID's pending updates; their callers get nil.
+func (b *locationBuffer) drop(driverID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	kept := b.pending[:0]
+	for _, w := range b.pending {
+		if w.pos.DriverID == driverID {
+			w.done <- nil
+			b.stats.Coalesced++
+			continue
+		}
+		kept = append(kept, w)
+	}
+	b.pending = kept
+}
+
+func (b *locationBuffer) run() {
+	defer close(b.stopped)
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.flush(false)
+		case <-b.full:
+			b.flush(true)
+		case <-b.stop:
+			b.flush(false)
+			return
+		}
+	}
+}
+
+// flush writes everything pending, keeping each driver's latest position,
+// and hands the result to every waiting caller.
+func (b *locationBuffer) flush(full bool) {
+	b.mu.Lock()
+	batch := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+	if len(batch) == 0 {
+		return
+	}
+
+	index := make(map[string]int, len(batch))
+	positions := make([]DriverPosition, 0, len(batch))
+	for _, w := range batch {
+		if i, ok := index[w.pos.DriverID]; ok {
+			positions[i] = w.pos
+			continue
+		}
+		index[w.pos.DriverID] = len(positions)
+		positions = append(positions, w.pos)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	start := time.Now()
+	err := b.c.SetDriverLocations(ctx, positions)
+	took := time.Since(start)
+	cancel()
+	for _, w := range batch {
+		w.done <- err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st := &b.stats
+	st.Flushes++
+	if full {
+		st.FullFlushes++
+	}
+	if err != nil {
+		st.FailedFlushes++
+	} else {
+		st.Written += int64(len(positions))
+	}
+	st.Coalesced += int64(len(batch) - len(positions))
+	st.LastFlushSize = len(positions)
+	st.LastFlushMs = float64(took.Microseconds()) / 1000
+	st.LastFlushAt = &start
+}
+
+// close flushes what is pending and stops the buffer; later updates are
+// written on their own.
+func (b *locationBuffer) close() {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	close(b.stop)
+	<-b.stopped
+}
@@ -0,0 +1,57 @@
+package redis
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// memoryServer is a Redis stand-in running inside the process.
+type memoryServer struct {
+	srv  *miniredis.Miniredis
+	done chan struct{}
+}
+
+// NewMemoryClient starts a Redis stand-in inside the process and connects
+// to it, for STORAGE=memory. It listens on a loopback port only this client
+// knows, and everything in it is lost when the client closes.
+func NewMemoryClient() (*Client, error) {
+	srv, err := miniredis.Run()
+	if err != nil {
+		return nil, fmt.Errorf("redis: start in-memory server: %w", err)
+	}
+	c, err := NewClient(srv.Addr(), 1)
+	if err != nil {
+		srv.Close()
+		return nil, err
+	}
+	m := &memoryServer{srv: srv, done: make(chan struct{})}
+	go m.tick()
+	c.memory = m
+	log.Println("Redis: in memory")
+	return c, nil
+}
+
+// tick moves the stand-in's clock with the wall clock. It only expires keys
+// when told time has passed, so without this no TTL would ever run out.
+func (m *memoryServer) tick() {
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+	last := time.Now()
+	for {
+		select {
+		case now := <-t.C:
+			m.srv.FastForward(now.Sub(last))
+			last = now
+		case <-m.done:
+			return
+		}
+	}
+}
+
+func (m *memoryServer) close() {
+	close(m.done)
+	m.srv.Close()
+}
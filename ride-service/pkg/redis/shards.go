@@ -0,0 +1,296 @@
+package redis
+
+import (
+	"context"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"ride-service/pkg/geohash"
+)
+
+// Driver locations are sharded by geohash cell: the matchable pool of a cell
+// is driver:locations:<cell> and every driver's last known position there is
+// driver:positions:<cell>. driver:shard maps each driver to the cell they
+// were last seen in, driver:seen scores them by when, in Unix milliseconds,
+// and driver:shards lists the cells ever used. The scripts below name keys
+// they derive from driver:shard, so the shards must live on one Redis node.
+const (
+	poolPrefix     = "driver:locations:"
+	positionPrefix = "driver:positions:"
+	shardOfKey     = "driver:shard"
+	seenKey        = "driver:seen"
+	shardsKey      = "driver:shards"
+
+	// DefaultShardPrecision makes cells about 156 km across, so a city and
+	// its suburbs usually share one.
+	DefaultShardPrecision = 3
+	// maxQueryShards caps the cells one search enumerates; wider searches
+	// go through the cells in use instead.
+	maxQueryShards = 64
+)
+
+// Locator picks the shard, or shards, a location read or write goes to.
+type Locator struct {
+	Precision int // geohash length of a shard's cell
+}
+
+// Shard returns the shard holding lat, lng.
+func (l Locator) Shard(lat, lng float64) string {
+	return geohash.Encode(lat, lng, l.Precision)
+}
+
+// ShardsInBox returns the shards overlapping the box, or false if there are
+// more than maxQueryShards.
+func (l Locator) ShardsInBox(minLat, minLng, maxLat, maxLng float64) ([]string, bool) {
+	return geohash.Cells(minLat, minLng, maxLat, maxLng, l.Precision, maxQueryShards)
+}
+
+// circleBox returns a box around the circle of radiusKm at lat, lng.
+func circleBox(lat, lng, radiusKm float64) (minLat, minLng, maxLat, maxLng float64) {
+	dLat := radiusKm / 111.0
+	dLng := 180.0
+	if c := math.Cos(lat * math.Pi / 180); c > 0.01 {
+		dLng = min(radiusKm/(111.0*c), 180)
+	}
+	return lat - dLat, lng - dLng, lat + dLat, lng + dLng
+}
+
+// overlaps reports whether shard's cell overlaps the box.
+func overlaps(shard string, minLat, minLng, maxLat, maxLng float64) bool {
+	sMinLat, sMinLng, sMaxLat, sMaxLng, ok := geohash.Bounds(shard)
+	return ok && sMinLat <= maxLat && sMaxLat >= minLat && sMinLng <= maxLng && sMaxLng >= minLng
+}
+
+// SetShardPrecision changes the geohash length of shard cells. Call it
+// before serving. Positions stored under another precision are found again
+// once their drivers report.
+func (c *Client) SetShardPrecision(precision int) {
+	c.geo = Locator{Precision: precision}
+}
+
+// shards returns the shards overlapping the box: the cells it covers or,
+// for a wide box, the cells in use that overlap it.
+func (c *Client) shards(ctx context.Context, minLat, minLng, maxLat, maxLng float64) ([]string, error) {
+	if cells, ok := c.geo.ShardsInBox(minLat, minLng, maxLat, maxLng); ok {
+		return cells, nil
+	}
+	used, err := c.rdb.SMembers(ctx, shardsKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	var cells []string
+	for _, s := range used {
+		if len(s) == c.geo.Precision && overlaps(s, minLat, minLng, maxLat, maxLng) {
+			cells = append(cells, s)
+		}
+	}
+	return cells, nil
+}
+
+// moveScript stores drivers' positions as seen at ARGV[1], each following
+// group of ARGV being driver, lng, lat, shard and a poolMode. A driver who
+// changed shards is taken out of the old one first, atomically, so searches
+// never see them twice.
+var moveScript = goredis.NewScript(`
+for i = 2, #ARGV, 5 do
+	local id, lng, lat, shard = ARGV[i], ARGV[i+1], ARGV[i+2], ARGV[i+3]
+	local old = redis.call("HGET", "` + shardOfKey + `", id)
+	if old and old ~= shard then
+		redis.call("ZREM", "` + poolPrefix + `" .. old, id)
+		redis.call("ZREM", "` + positionPrefix + `" .. old, id)
+	end
+	if ARGV[i+4] == "join" then
+		redis.call("GEOADD", "` + poolPrefix + `" .. shard, lng, lat, id)
+	elseif ARGV[i+4] == "leave" then
+		redis.call("ZREM", "` + poolPrefix + `" .. shard, id)
+	end
+	redis.call("GEOADD", "` + positionPrefix + `" .. shard, lng, lat, id)
+	redis.call("HSET", "` + shardOfKey + `", id, shard)
+	redis.call("ZADD", "` + seenKey + `", ARGV[1], id)
+	redis.call("SADD", "` + shardsKey + `", shard)
+end
+return (#ARGV - 1) / 5`)
+
+// leaveScript takes a driver out of the matchable pool of their shard.
+var leaveScript = goredis.NewScript(`
+local shard = redis.call("HGET", "` + shardOfKey + `", ARGV[1])
+if shard then
+	return redis.call("ZREM", "` + poolPrefix + `" .. shard, ARGV[1])
+end
+return 0`)
+
+// poolMode says what storePositions does with the drivers' matchable pool
+// membership.
+type poolMode string
+
+const (
+	poolJoin  poolMode = "join"
+	poolKeep  poolMode = "keep" // except that the pool of a shard left behind is left too
+	poolLeave poolMode = "leave"
+)
+
+// storePositions runs moveScript for positions.
+func (c *Client) storePositions(ctx context.Context, positions []DriverPosition, mode poolMode) error {
+	if len(positions) == 0 {
+		return nil
+	}
+	args := make([]any, 0, 1+5*len(positions))
+	args = append(args, time.Now().UnixMilli())
+	for _, p := range positions {
+		args = append(args, p.DriverID,
+			strconv.FormatFloat(p.Lng, 'f', -1, 64), strconv.FormatFloat(p.Lat, 'f', -1, 64),
+			c.geo.Shard(p.Lat, p.Lng), string(mode))
+	}
+	return moveScript.Run(ctx, c.rdb, nil, args...).Err()
+}
+
+// forgetScript drops up to ARGV[2] drivers last seen at or before ARGV[1]
+// from their shard's pool and positions, and returns how many it dropped.
+var forgetScript = goredis.NewScript(`
+local gone = redis.call("ZRANGEBYSCORE", "` + seenKey + `", "-inf", ARGV[1], "LIMIT", 0, ARGV[2])
+for _, id in ipairs(gone) do
+	local shard = redis.call("HGET", "` + shardOfKey + `", id)
+	if shard then
+		redis.call("ZREM", "` + poolPrefix + `" .. shard, id)
+		redis.call("ZREM", "` + positionPrefix + `" .. shard, id)
+	end
+	redis.call("HDEL", "` + shardOfKey + `", id)
+	redis.call("ZREM", "` + seenKey + `", id)
+end
+return #gone`)
+
+// forgetBatch is how many drivers one run of forgetScript drops.
+const forgetBatch = 500
+
+// ForgetPositions drops the drivers last seen before cutoff, pooled or not,
+// so those who went offline or stopped reporting leave the ops map and
+// nearby search. It returns how many it dropped. Drivers whose positions
+// predate driver:seen are only dropped once they have reported again.
+func (c *Client) ForgetPositions(ctx context.Context, cutoff time.Time) (int, error) {
+	total := 0
+	for {
+		n, err := forgetScript.Run(ctx, c.rdb, nil, cutoff.UnixMilli(), forgetBatch).Int()
+		total += n
+		if err != nil || n < forgetBatch {
+			return total, err
+		}
+	}
+}
+
+// StartForgettingPositions runs ForgetPositions every minute for drivers
+// not seen for ttl, until ctx is done. A ttl of zero keeps positions.
+func (c *Client) StartForgettingPositions(ctx context.Context, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	go func() {
+		t := time.NewTicker(min(ttl, time.Minute))
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				n, err := c.ForgetPositions(ctx, time.Now().Add(-ttl))
+				switch {
+				case err != nil && ctx.Err() == nil:
+					log.Printf("redis: forgetting stale driver positions: %v", err)
+				case n > 0:
+					log.Printf("redis: forgot %d driver positions not reported for %s", n, ttl)
+				}
+			}
+		}
+	}()
+}
+
+// searchShards runs GEOSEARCH against each shard's key in one pipeline and
+// merges the results, nearest first, keeping each driver once.
+func (c *Client) searchShards(ctx context.Context, prefix string, shards []string, q *goredis.GeoSearchLocationQuery) ([]goredis.GeoLocation, error) {
+	if len(shards) == 0 {
+		return nil, nil
+	}
+	pipe := c.rdb.Pipeline()
+	cmds := make([]*goredis.GeoSearchLocationCmd, len(shards))
+	for i, s := range shards {
+		cmds[i] = pipe.GeoSearchLocation(ctx, prefix+s, q)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, err
+	}
+	seen := map[string]int{}
+	var out []goredis.GeoLocation
+	for _, cmd := range cmds {
+		for _, loc := range cmd.Val() {
+			if i, ok := seen[loc.Name]; ok {
+				if loc.Dist < out[i].Dist {
+					out[i] = loc
+				}
+				continue
+			}
+			seen[loc.Name] = len(out)
+			out = append(out, loc)
+		}
+	}
+	if q.WithDist {
+		sort.SliceStable(out, func(i, j int) bool { return out[i].Dist < out[j].Dist })
+	}
+	if q.Count > 0 && len(out) > q.Count {
+		out = out[:q.Count]
+	}
+	return out, nil
+}
+
+// MigrateUnshardedLocations moves positions from the single driver:locations
+// and driver:positions keys used before sharding into their shards, then
+// deletes those keys. It returns how many positions moved; with nothing to
+// move it does nothing.
+func (c *Client) MigrateUnshardedLocations(ctx context.Context) (int, error) {
+	const oldPool, oldPositions = "driver:locations", "driver:positions"
+	moved := 0
+	for _, key := range []string{oldPool, oldPositions} {
+		var cursor uint64
+		for {
+			ids, next, err := c.rdb.ZScan(ctx, key, cursor, "", 500).Result()
+			if err != nil {
+				return moved, err
+			}
+			// ZSCAN returns member, score pairs.
+			members := make([]string, 0, len(ids)/2)
+			for i := 0; i < len(ids); i += 2 {
+				members = append(members, ids[i])
+			}
+			if len(members) > 0 {
+				coords, err := c.rdb.GeoPos(ctx, key, members...).Result()
+				if err != nil {
+					return moved, err
+				}
+				positions := make([]DriverPosition, 0, len(members))
+				for i, p := range coords {
+					if p != nil {
+						positions = append(positions, DriverPosition{DriverID: members[i], Lat: p.Latitude, Lng: p.Longitude})
+					}
+				}
+				mode := poolKeep
+				if key == oldPool {
+					mode = poolJoin
+				}
+				if err := c.storePositions(ctx, positions, mode); err != nil {
+					return moved, err
+				}
+				moved += len(positions)
+			}
+			if cursor = next; cursor == 0 {
+				break
+			}
+		}
+		if err := c.rdb.Del(ctx, key).Err(); err != nil {
+			return moved, err
+		}
+	}
+	return moved, nil
+}
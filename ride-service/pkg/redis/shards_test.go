@@ -0,0 +1,47 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestForgetPositions(t *testing.T) {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	c, err := NewClient(mr.Addr(), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetDriverLocations(ctx, []DriverPosition{{DriverID: "gone", Lat: 12.97, Lng: 77.59}}); err != nil {
+		t.Fatal(err)
+	}
+	cutoff := time.Now()
+	time.Sleep(2 * time.Millisecond)
+	if err := c.SetDriverLocations(ctx, []DriverPosition{{DriverID: "here", Lat: 12.98, Lng: 77.60}}); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := c.ForgetPositions(ctx, cutoff)
+	if err != nil || n != 1 {
+		t.Fatalf("ForgetPositions = %d, %v; want 1", n, err)
+	}
+	shard := c.geo.Shard(12.97, 77.59)
+	for _, key := range []string{poolPrefix + shard, positionPrefix + shard} {
+		members, err := mr.ZMembers(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(members) != 1 || members[0] != "here" {
+			t.Errorf("%s holds %v, want [here]", key, members)
+		}
+	}
+	if got, _ := mr.HKeys(shardOfKey); len(got) != 1 || got[0] != "here" {
+		t.Errorf("%s holds %v, want [here]", shardOfKey, got)
+	}
+	if n, _ := c.ForgetPositions(ctx, cutoff); n != 0 {
+		t.Errorf("second run forgot %d", n)
+	}
+}
@@ -0,0 +1,79 @@
+package validation
+
+import (
+	"regexp"
+	"strings"
+
+	"ride-service/pkg/apierror"
+)
+
+// DefaultCountry is assumed for accounts that do not state one.
+const DefaultCountry = "IN"
+
+var (
+	ErrInvalidPhone       = apierror.Validation("invalid phone number for country")
+	ErrUnsupportedCountry = apierror.Validation("unsupported country")
+)
+
+// phoneRule describes a country's numbering plan in the libphonenumber sense:
+// its calling code, the trunk prefix dialled before national numbers, and the
+// shape of the national significant number (NSN) for mobile/geographic lines.
+type phoneRule struct {
+	callingCode string
+	trunkPrefix string
+	nsn         *regexp.Regexp
+}
+
+var phoneRules = map[string]phoneRule{
+	"IN": {"91", "0", regexp.MustCompile(`^[6-9]\d{9}$`)},
+	"US": {"1", "1", regexp.MustCompile(`^[2-9]\d{2}[2-9]\d{6}$`)},
+	"CA": {"1", "1", regexp.MustCompile(`^[2-9]\d{2}[2-9]\d{6}$`)},
+	"GB": {"44", "0", regexp.MustCompile(`^(7\d{9}|[1-3]\d{8,9})$`)},
+	"AE": {"971", "0", regexp.MustCompile(`^(5[024568]\d{7}|[2-479]\d{7})$`)},
+	"SG": {"65", "", regexp.MustCompile(`^[3689]\d{7}$`)},
+	"AU": {"61", "0", regexp.MustCompile(`^[2-478]\d{8}$`)},
+	"DE": {"49", "0", regexp.MustCompile(`^[1-9]\d{6,12}$`)},
+	"FR": {"33", "0", regexp.MustCompile(`^[1-9]\d{8}$`)},
+}
+
+// phoneFormatting matches the separators people type between digits.
+var phoneFormatting = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "", "\u00a0", "")
+
+// NormalizePhone validates raw against country's numbering plan and returns it
+// in canonical E.164 form (+<calling code><NSN>). raw may be international
+// (+91 98765 43210, 0091…) or national (098765 43210, 98765-43210); all of
+// them normalise to the same string, so uniqueness checks compare like with like.
+func NormalizePhone(raw, country string) (string, error) {
+	country = strings.ToUpper(strings.TrimSpace(country))
+	if country == "" {
+		country = DefaultCountry
+	}
+	rule, ok := phoneRules[country]
+	if !ok {
+		return "", ErrUnsupportedCountry
+	}
+
+	n := phoneFormatting.Replace(strings.TrimSpace(raw))
+	if len(n) > 20 {
+		return "", ErrInvalidPhone
+	}
+	switch {
+	case strings.HasPrefix(n, "+"):
+		n = n[1:]
+		if !strings.HasPrefix(n, rule.callingCode) {
+			return "", ErrInvalidPhone
+		}
+		n = n[len(rule.callingCode):]
+	case strings.HasPrefix(n, "00"+rule.callingCode):
+		n = n[2+len(rule.callingCode):]
+	case strings.HasPrefix(n, rule.callingCode) && !rule.nsn.MatchString(n) &&
+		rule.nsn.MatchString(n[len(rule.callingCode):]):
+		n = n[len(rule.callingCode):]
+	case rule.trunkPrefix != "" && strings.HasPrefix(n, rule.trunkPrefix) && !rule.nsn.MatchString(n):
+		n = n[len(rule.trunkPrefix):]
+	}
+	if !rule.nsn.MatchString(n) {
+		return "", ErrInvalidPhone
+	}
+	return "+" + rule.callingCode + n, nil
+}
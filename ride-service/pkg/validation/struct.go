@@ -0,0 +1,244 @@
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"ride-service/pkg/apierror"
+)
+
+// Request structs declare their constraints as `validate:"..."` tags, which
+// Struct enforces and the OpenAPI document publishes:
+//
+//	required            strings non-blank, pointers, slices and times set
+//	min=N, max=N        numeric bounds
+//	minLength=N, maxLength=N
+//	maxItems=N
+//	format=F            email | uuid | sha256 | hmac-sha256
+//
+// Numbers and booleans cannot be told apart from their zero value once
+// decoded, so required only documents them; the OpenAPI layer checks their
+// presence in the raw body. Optional strings that are empty skip their
+// length and format rules.
+
+// Formats maps format=… to the pattern values must match.
+var Formats = map[string]string{
+	"email":       EmailPattern,
+	"uuid":        `^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`,
+	"sha256":      `^[0-9a-f]{64}$`,
+	"hmac-sha256": `^[0-9a-fA-F]{64}$`,
+}
+
+var formatRegex = func() map[string]*regexp.Regexp {
+	m := make(map[string]*regexp.Regexp, len(Formats))
+	for name, p := range Formats {
+		m[name] = regexp.MustCompile(p)
+	}
+	return m
+}()
+
+// Rules are the constraints of one validate tag.
+type Rules struct {
+	Required  bool
+	Min, Max  *float64
+	MinLength *int
+	MaxLength *int
+	MaxItems  *int
+	Format    string
+}
+
+// ParseRules parses a validate tag.
+func ParseRules(tag string) (Rules, error) {
+	var r Rules
+	for _, opt := range strings.Split(tag, ",") {
+		key, val, _ := strings.Cut(opt, "=")
+		switch key {
+		case "":
+		case "required":
+			r.Required = true
+		case "min", "max":
+			n, err := strconv.ParseFloat(val, 64)
+			if err != nil {
+				return Rules{}, fmt.Errorf("bad validate tag %q: %w", opt, err)
+			}
+			if key == "min" {
+				r.Min = &n
+			} else {
+				r.Max = &n
+			}
+		case "minLength", "maxLength", "maxItems":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 0 {
+				return Rules{}, fmt.Errorf("bad validate tag %q", opt)
+			}
+			switch key {
+			case "minLength":
+				r.MinLength = &n
+			case "maxLength":
+				r.MaxLength = &n
+			default:
+				r.MaxItems = &n
+			}
+		case "format":
+			if _, ok := Formats[val]; !ok {
+				return Rules{}, fmt.Errorf("unknown validate format %q", val)
+			}
+			r.Format = val
+		default:
+			return Rules{}, fmt.Errorf("unknown validate tag option %q", opt)
+		}
+	}
+	return r, nil
+}
+
+// Struct checks v, a struct or a pointer to one, against the validate tags
+// of its fields, descending into nested structs and slices of them. It
+// returns nil or an *apierror.Error listing every invalid field by its JSON
+// path.
+func Struct(v any) error {
+	var errs []apierror.FieldError
+	check(reflect.ValueOf(v), "", &errs)
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierror.InvalidFields(errs)
+}
+
+// field is a struct field with its JSON name and parsed rules.
+type field struct {
+	index int
+	name  string // "" for embedded structs, whose fields are inlined
+	rules Rules
+}
+
+var fieldCache sync.Map // reflect.Type → []field
+
+func fieldsOf(t reflect.Type) []field {
+	if fs, ok := fieldCache.Load(t); ok {
+		return fs.([]field)
+	}
+	var fs []field
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" && !f.Anonymous {
+			name = f.Name
+		}
+		rules, err := ParseRules(f.Tag.Get("validate"))
+		if err != nil {
+			panic(fmt.Sprintf("validation: %s.%s: %v", t, f.Name, err))
+		}
+		fs = append(fs, field{index: i, name: name, rules: rules})
+	}
+	fieldCache.Store(t, fs)
+	return fs
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func check(v reflect.Value, path string, errs *[]apierror.FieldError) {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	switch {
+	case v.Kind() == reflect.Struct && v.Type() != timeType:
+		for _, f := range fieldsOf(v.Type()) {
+			fv := v.Field(f.index)
+			p := join(path, f.name)
+			if reason := f.rules.check(fv); reason != "" {
+				*errs = append(*errs, apierror.FieldError{Field: p, Reason: reason})
+				continue
+			}
+			check(fv, p, errs)
+		}
+	case v.Kind() == reflect.Slice || v.Kind() == reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			check(v.Index(i), join(path, strconv.Itoa(i)), errs)
+		}
+	}
+}
+
+func join(path, name string) string {
+	switch {
+	case name == "":
+		return path
+	case path == "":
+		return name
+	}
+	return path + "." + name
+}
+
+// check returns why v breaks r, or "" if it does not.
+func (r Rules) check(v reflect.Value) string {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			if r.Required {
+				return "is required"
+			}
+			return ""
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.String:
+		s := v.String()
+		if strings.TrimSpace(s) == "" {
+			if r.Required {
+				return "is required"
+			}
+			return ""
+		}
+		n := utf8.RuneCountInString(s)
+		switch {
+		case r.MinLength != nil && n < *r.MinLength:
+			return fmt.Sprintf("must be at least %d characters", *r.MinLength)
+		case r.MaxLength != nil && n > *r.MaxLength:
+			return fmt.Sprintf("must be at most %d characters", *r.MaxLength)
+		case r.Format != "" && !formatRegex[r.Format].MatchString(s):
+			return "must be a valid " + r.Format
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return r.bounds(float64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return r.bounds(float64(v.Uint()))
+	case reflect.Float32, reflect.Float64:
+		return r.bounds(v.Float())
+	case reflect.Slice, reflect.Map:
+		if v.IsNil() && r.Required {
+			return "is required"
+		}
+		if r.MaxItems != nil && v.Len() > *r.MaxItems {
+			return fmt.Sprintf("must have at most %d items", *r.MaxItems)
+		}
+	case reflect.Struct:
+		if t, ok := v.Interface().(time.Time); ok && t.IsZero() && r.Required {
+			return "is required"
+		}
+	}
+	return ""
+}
+
+func (r Rules) bounds(n float64) string {
+	switch {
+	case r.Min != nil && n < *r.Min:
+		return "must be at least " + strconv.FormatFloat(*r.Min, 'g', -1, 64)
+	case r.Max != nil && n > *r.Max:
+		return "must be at most " + strconv.FormatFloat(*r.Max, 'g', -1, 64)
+	}
+	return ""
+}
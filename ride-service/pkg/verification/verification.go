@@ -0,0 +1,120 @@
+// Package verification confirms that an account owns a new email address or
+// phone number before the change is applied: a one-time code is sent to the
+// new address and the change waits until the code comes back.
+package verification
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"net/http"
+	"time"
+
+	"ride-service/pkg/apierror"
+	"ride-service/pkg/logging"
+)
+
+var logger = logging.For("verification")
+
+// Channels a code can be sent over.
+const (
+	Email = "email"
+	Phone = "phone"
+)
+
+var (
+	ErrNoPending       = apierror.NotFound("no pending change to verify")
+	ErrWrongCode       = apierror.Validation("wrong verification code")
+	ErrTooManyAttempts = apierror.New(http.StatusTooManyRequests, apierror.CodeRateLimited, "too many wrong codes; request a new one")
+)
+
+// Sender delivers a message to an email address or phone number.
+type Sender interface {
+	Send(ctx context.Context, channel, to, message string) error
+}
+
+// LogSender writes messages to the log instead of delivering them, for
+// development and for channels without a configured provider.
+type LogSender struct{}
+
+func (LogSender) Send(_ context.Context, channel, to, message string) error {
+	logger.Info("message not delivered (log sender)", "channel", channel, "to", to, "message", message)
+	return nil
+}
+
+// Store keeps pending changes; the Redis client implements it.
+type Store interface {
+	PutVerification(ctx context.Context, key, value, codeHash string, ttl time.Duration) error
+	VerificationAttempt(ctx context.Context, key string) (value, codeHash string, attempts int, ok bool, err error)
+	DeleteVerification(ctx context.Context, key string) error
+}
+
+// Codes issues and checks verification codes.
+type Codes struct {
+	store       Store
+	sender      Sender
+	ttl         time.Duration
+	maxAttempts int
+}
+
+// New returns Codes valid for ttl that allow maxAttempts guesses each.
+func New(store Store, sender Sender, ttl time.Duration, maxAttempts int) *Codes {
+	return &Codes{store: store, sender: sender, ttl: ttl, maxAttempts: maxAttempts}
+}
+
+// Start records that account wants channel changed to value and sends a code
+// to the address to. A newer Start replaces the pending change and its code.
+func (c *Codes) Start(ctx context.Context, account, channel, to, value string) error {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+	if err := c.store.PutVerification(ctx, key(account, channel), value, hash(code), c.ttl); err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("Your verification code is %s. It expires in %s.", code, c.ttl)
+	if err := c.sender.Send(ctx, channel, to, msg); err != nil {
+		c.store.DeleteVerification(ctx, key(account, channel))
+		return fmt.Errorf("send code: %w", err)
+	}
+	return nil
+}
+
+// Confirm checks code against account's pending change of channel and, if it
+// matches, consumes the change and returns the new value. The change is
+// dropped after maxAttempts wrong codes.
+func (c *Codes) Confirm(ctx context.Context, account, channel, code string) (string, error) {
+	k := key(account, channel)
+	value, want, attempts, ok, err := c.store.VerificationAttempt(ctx, k)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", ErrNoPending
+	}
+	if subtle.ConstantTimeCompare([]byte(hash(code)), []byte(want)) != 1 {
+		if attempts >= c.maxAttempts {
+			c.store.DeleteVerification(ctx, k)
+			return "", ErrTooManyAttempts
+		}
+		return "", ErrWrongCode
+	}
+	return value, c.store.DeleteVerification(ctx, k)
+}
+
+// Cancel drops account's pending change of channel, if any.
+func (c *Codes) Cancel(ctx context.Context, account, channel string) error {
+	return c.store.DeleteVerification(ctx, key(account, channel))
+}
+
+func key(account, channel string) string { return account + ":" + channel }
+
+func hash(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
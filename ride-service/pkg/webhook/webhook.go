@@ -0,0 +1,66 @@
+// Package webhook holds what every outgoing webhook shares: URL rules, the
+// body signature and an HTTP client that will not call internal addresses.
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// SignatureHeader carries Sign's result on every webhook request.
+const SignatureHeader = "X-Ride-Signature"
+
+var (
+	ErrBadURL    = errors.New("webhook address must be an https URL")
+	ErrNotPublic = errors.New("webhook address is not public")
+)
+
+// ValidURL accepts absolute https URLs.
+func ValidURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return ErrBadURL
+	}
+	return nil
+}
+
+// Sign returns "sha256=<hex HMAC-SHA256 of body>", which receivers recompute
+// with the shared secret to check a request came from us.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is Sign(secret, body), for requests
+// partners send us signed the same way. An empty secret verifies nothing.
+func Verify(secret, body []byte, signature string) bool {
+	return len(secret) > 0 && hmac.Equal([]byte(signature), []byte(Sign(secret, body)))
+}
+
+// NewClient returns a client whose requests time out after timeout and that
+// refuses to connect to private, loopback and link-local addresses, so a
+// registered URL cannot reach internal services. The check runs on the
+// resolved address, after DNS.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second, Control: func(_, address string, _ syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		if ip := net.ParseIP(host); ip == nil || !ip.IsGlobalUnicast() || ip.IsPrivate() {
+			return fmt.Errorf("%w: %s", ErrNotPublic, host)
+		}
+		return nil
+	}}
+	transport := &http.Transport{DialContext: dialer.DialContext, TLSHandshakeTimeout: 5 * time.Second}
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
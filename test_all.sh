@@ -24,6 +24,25 @@ parse_response() {
   CODE=$(echo "$resp" | tail -n 1)
 }
 
+# Current version of a trip, for the If-Match header on trip transitions
+trip_version() {
+  curl -s "$BASE/trips/$1" -H "Authorization: Bearer $RIDER_TOKEN" | jq -r '.version'
+}
+
+# Prints a phone number unique to this run: an Indian mobile (the default
+# country) whose first two digits, $1 (60-99), tell the accounts apart.
+phone() {
+  echo "+91$1${TS: -8}"
+}
+
+# Registers another rider and prints their token. A rider can have only one
+# trip in progress, so tests that request trips of their own use a new one;
+# $1 is a digit keeping the email and phone unique.
+new_rider() {
+  curl -s -X POST "$BASE/users/register" -H "Content-Type: application/json" \
+    -d "{\"name\":\"Rider $1 $TS\",\"email\":\"rider$1_${TS}@test.com\",\"phone\":\"$(phone $((60+$1)))\",\"password\":\"password123\",$ACCEPT}" | jq -r '.token'
+}
+
 assert_status() {
   local test_name="$1" expected="$2" actual="$3"
   TOTAL=$((TOTAL+1))
@@ -67,6 +86,21 @@ assert_json_equals() {
 # Unique suffix to avoid collisions on re-runs
 TS=$(date +%s)
 
+# The terms versions in force (infra/docker-compose.yml sets them). Accounts
+# registered below accept them, or the terms gate would hold their trip
+# changes back; the rider in section 33 leaves them out on purpose.
+TERMS_STATUS=$(curl -s "$BASE/terms")
+ACCEPT="\"terms_version\":\"$(echo "$TERMS_STATUS" | jq -r '.terms_version // ""')\",\"privacy_version\":\"$(echo "$TERMS_STATUS" | jq -r '.privacy_version // ""')\""
+
+# A staff token for the /admin checks. There is no API that makes staff: a new
+# rider is promoted in the database (the postgres container from
+# infra/docker-compose.yml) and signs in again for a token with the role.
+ADMIN_ID=$(curl -s -X POST "$BASE/users/register" -H "Content-Type: application/json" \
+  -d "{\"name\":\"Admin $TS\",\"email\":\"admin_${TS}@test.com\",\"phone\":\"$(phone 97)\",\"password\":\"password123\",$ACCEPT}" | jq -r '.user.id')
+docker exec postgres1 sh -c "psql -q -U \"\$POSTGRES_USER\" -d \"\$POSTGRES_DB\" -c \"UPDATE users SET role = 'admin' WHERE id = '$ADMIN_ID'\"" > /dev/null
+ADMIN_TOKEN=$(curl -s -X POST "$BASE/users/login" -H "Content-Type: application/json" \
+  -d "{\"email\":\"admin_${TS}@test.com\",\"password\":\"password123\"}" | jq -r '.token')
+
 # ═════════════════════════════════════════════════════════════════════════════
 bold "═══════════════════════════════════════════════════════════════"
 bold "    RIDE-HAILING SYSTEM — FULL TEST SUITE"
@@ -82,6 +116,43 @@ parse_response "$RESP"
 assert_status "GET /health returns 200" "200" "$CODE"
 assert_json_equals "Health status is ok" "$BODY" ".status" "ok"
 assert_json_equals "Service name is ride-service" "$BODY" ".service" "ride-service"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/.well-known/jwks.json")
+parse_response "$RESP"
+assert_status "GET /.well-known/jwks.json returns 200" "200" "$CODE"
+assert_json_field "JWKS lists keys" "$BODY" ".keys"
+
+# Public status: coarse health per component, and an incident banner on its
+# city until it is resolved
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/status")
+parse_response "$RESP"
+assert_status "GET /status — no token needed" "200" "$CODE"
+assert_json_equals "Every component reported" "$BODY" '[.components[].status | IN("operational","degraded")] | all' "true"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/admin/status/incidents" \
+  -H "Authorization: Bearer $ADMIN_TOKEN" -H "Content-Type: application/json" \
+  -d "{\"city\":\"Testville $TS\",\"message\":\"Slow matching\",\"severity\":\"degraded\"}")
+parse_response "$RESP"
+assert_status "POST /admin/status/incidents" "201" "$CODE"
+INCIDENT_ID=$(echo "$BODY" | jq -r '.id')
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/status")
+parse_response "$RESP"
+assert_json_equals "City degraded by the incident" "$BODY" ".cities[] | select(.name == \"Testville $TS\") | .status" "degraded"
+assert_json_equals "City shows the banner" "$BODY" ".cities[] | select(.name == \"Testville $TS\") | .banners[0].message" "Slow matching"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/admin/status/incidents/$INCIDENT_ID/resolve" -H "Authorization: Bearer $ADMIN_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /admin/status/incidents/:id/resolve" "200" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/status")
+parse_response "$RESP"
+assert_json_equals "Banner gone once resolved" "$BODY" "[.cities[] | select(.name == \"Testville $TS\")] | length" "0"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/admin/status/incidents" \
+  -H "Content-Type: application/json" -d '{"message":"x","severity":"info"}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /admin/status/incidents — no token gets 401" "401" "$CODE"
 echo ""
 
 # ─────────────────────────────────────────────────────────────────────────────
@@ -91,30 +162,51 @@ bold "2. USER REGISTRATION"
 # 2a. Successful registration
 RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/users/register" \
   -H "Content-Type: application/json" \
-  -d "{\"name\":\"Test Rider $TS\",\"email\":\"rider_${TS}@test.com\",\"phone\":\"+1${TS}\",\"password\":\"password123\"}")
+  -d "{\"name\":\"Test Rider $TS\",\"email\":\"rider_${TS}@test.com\",\"phone\":\"$(phone 91)\",\"password\":\"password123\",$ACCEPT}")
 parse_response "$RESP"
 assert_status "POST /users/register — success" "201" "$CODE"
 assert_json_field "Registration returns token" "$BODY" ".token"
 assert_json_field "Registration returns user.id" "$BODY" ".user.id"
 assert_json_equals "Registration returns correct email" "$BODY" ".user.email" "rider_${TS}@test.com"
 assert_json_equals "Registration returns rating 5" "$BODY" ".user.rating" "5"
+assert_json_equals "Phone stored in E.164" "$BODY" ".user.phone" "$(phone 91)"
 RIDER_TOKEN=$(echo "$BODY" | jq -r '.token')
 RIDER_ID=$(echo "$BODY" | jq -r '.user.id')
 
-# 2b. Duplicate email
+# 2b. Duplicate email, also in another letter case (emails are looked up by a
+# lower-cased blind index)
 RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/users/register" \
   -H "Content-Type: application/json" \
-  -d "{\"name\":\"Dup\",\"email\":\"rider_${TS}@test.com\",\"phone\":\"+9999999\",\"password\":\"abc\"}")
+  -d "{\"name\":\"Dup\",\"email\":\"rider_${TS}@test.com\",\"phone\":\"$(phone 90)\",\"password\":\"abc\"}")
 CODE=$(echo "$RESP" | tail -n 1)
 assert_status "POST /users/register — duplicate email" "409" "$CODE"
 
-# 2c. Duplicate phone
 RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/users/register" \
   -H "Content-Type: application/json" \
-  -d "{\"name\":\"Dup2\",\"email\":\"other_${TS}@test.com\",\"phone\":\"+1${TS}\",\"password\":\"abc\"}")
+  -d "{\"name\":\"Dup\",\"email\":\"RIDER_${TS}@Test.com\",\"phone\":\"$(phone 95)\",\"password\":\"password123\"}")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /users/register — duplicate email, other case" "409" "$CODE"
+
+# 2c. Duplicate phone, also written another way (numbers are stored in E.164)
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/users/register" \
+  -H "Content-Type: application/json" \
+  -d "{\"name\":\"Dup2\",\"email\":\"other_${TS}@test.com\",\"phone\":\"$(phone 91)\",\"password\":\"abc\"}")
 CODE=$(echo "$RESP" | tail -n 1)
 assert_status "POST /users/register — duplicate phone" "409" "$CODE"
 
+NATIONAL=$(phone 91 | sed -E 's/^\+91([0-9]{5})([0-9]{5})$/0\1-\2/')
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/users/register" \
+  -H "Content-Type: application/json" \
+  -d "{\"name\":\"Dup3\",\"email\":\"other_${TS}@test.com\",\"phone\":\"$NATIONAL\",\"password\":\"password123\"}")
+parse_response "$RESP"
+assert_status "POST /users/register — duplicate phone, national format" "409" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/users/register" \
+  -H "Content-Type: application/json" \
+  -d "{\"name\":\"Bad Phone\",\"email\":\"other_${TS}@test.com\",\"phone\":\"12345\",\"password\":\"password123\"}")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /users/register — phone invalid for the country" "400" "$CODE"
+
 # 2d. Invalid body
 RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/users/register" \
   -H "Content-Type: application/json" \
@@ -153,7 +245,7 @@ assert_status "POST /users/login — wrong password" "401" "$CODE"
 # 3c. Non-existent email
 RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/users/login" \
   -H "Content-Type: application/json" \
-  -d "{\"email\":\"nonexistent@test.com\",\"password\":\"abc\"}")
+  -d "{\"email\":\"nonexistent_${TS}@test.com\",\"password\":\"abc\"}")
 CODE=$(echo "$RESP" | tail -n 1)
 assert_status "POST /users/login — email not found" "401" "$CODE"
 
@@ -163,6 +255,25 @@ RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/users/login" \
   -d "bad")
 CODE=$(echo "$RESP" | tail -n 1)
 assert_status "POST /users/login — invalid body" "400" "$CODE"
+
+# 3e. Repeated wrong passwords delay the next attempt (3 failures by default)
+for i in 1 2 3; do
+  curl -s -o /dev/null -X POST "$BASE/users/login" -H "Content-Type: application/json" \
+    -d "{\"email\":\"guess_${TS}@test.com\",\"password\":\"guess$i\"}"
+done
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/users/login" \
+  -H "Content-Type: application/json" \
+  -d "{\"email\":\"guess_${TS}@test.com\",\"password\":\"guess4\"}")
+parse_response "$RESP"
+assert_status "POST /users/login — after repeated failures" "429" "$CODE"
+assert_json_equals "Lockout code is login_locked" "$BODY" ".code" "login_locked"
+
+# Forwarding headers from the client are not believed, so they change nothing
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/users/login" \
+  -H "Content-Type: application/json" -H "True-Client-IP: 203.0.113.7" -H "X-Forwarded-For: 203.0.113.7" \
+  -d "{\"email\":\"guess_${TS}@test.com\",\"password\":\"guess5\"}")
+parse_response "$RESP"
+assert_status "POST /users/login — spoofed client IP still locked" "429" "$CODE"
 echo ""
 
 # ─────────────────────────────────────────────────────────────────────────────
@@ -193,6 +304,72 @@ RESP=$(curl -s -w "\n%{http_code}" "$BASE/users/$RIDER_ID" \
   -H "Authorization: Bearer invalid.jwt.token")
 CODE=$(echo "$RESP" | tail -n 1)
 assert_status "GET /users/:id — invalid token" "401" "$CODE"
+
+# 4e. Terms — the rider accepted the versions in force when registering
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/terms" -H "Authorization: Bearer $RIDER_TOKEN")
+parse_response "$RESP"
+assert_status "GET /terms" "200" "$CODE"
+assert_json_equals "Rider's acceptance is current" "$BODY" ".current" "true"
+
+# 4f. Accepting a version that is not in force
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/terms/accept" \
+  -H "Authorization: Bearer $RIDER_TOKEN" -H "Content-Type: application/json" \
+  -d '{"terms_version":"1999-01","privacy_version":"1999-01"}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /terms/accept — stale version" "400" "$CODE"
+
+# 4g. Data export
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/users/$RIDER_ID/export" -H "Authorization: Bearer $RIDER_TOKEN")
+parse_response "$RESP"
+assert_status "GET /users/:id/export" "200" "$CODE"
+assert_json_equals "Export is of the rider" "$BODY" ".user_id" "$RIDER_ID"
+assert_json_equals "Export leaves out the password hash" "$BODY" ".profile.password_hash" "null"
+assert_json_equals "Export has the rider's support tickets" "$BODY" '.sections | has("support_tickets") and has("support_ticket_messages") and has("support_ticket_attachments")' "true"
+assert_json_equals "Export has the rider's fare quotes" "$BODY" '.sections | has("fare_quotes")' "true"
+
+# 4h. Another rider cannot export it
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/users/$RIDER_ID/export" -H "Authorization: Bearer $(new_rider 7)")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /users/:id/export — another rider" "403" "$CODE"
+
+# 4i. Erasure is scheduled, then cancelled within the grace period
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/users/$RIDER_ID/erasure" -H "Authorization: Bearer $RIDER_TOKEN")
+parse_response "$RESP"
+assert_status "POST /users/:id/erasure" "202" "$CODE"
+assert_json_equals "Erasure is pending" "$BODY" ".status" "pending"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/users/$RIDER_ID/erasure" -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /users/:id/erasure — already requested" "409" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X DELETE "$BASE/users/$RIDER_ID/erasure" -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "DELETE /users/:id/erasure" "200" "$CODE"
+
+# 4j. A second login is a second session, which the first can sign out. Its
+# spoofed forwarding headers must not change the client IP it is counted under.
+SECOND_TOKEN=$(curl -s -X POST "$BASE/users/login" -H "Content-Type: application/json" -H "User-Agent: test-phone" \
+  -H "True-Client-IP: 203.0.113.7" -H "X-Forwarded-For: 203.0.113.7" \
+  -d "{\"email\":\"rider_${TS}@test.com\",\"password\":\"password123\"}" | jq -r '.token')
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/users/$RIDER_ID/sessions" -H "Authorization: Bearer $SECOND_TOKEN")
+parse_response "$RESP"
+assert_status "GET /users/:id/sessions" "200" "$CODE"
+assert_json_equals "Newest session is the caller's" "$BODY" ".sessions[0].current" "true"
+assert_json_equals "Session records the user agent" "$BODY" ".sessions[0].user_agent" "test-phone"
+assert_json_equals "Spoofed headers do not set the session IP" "$BODY" '.sessions[0].ip != "203.0.113.7" and .sessions[0].ip == .sessions[1].ip' "true"
+SESSION_ID=$(echo "$BODY" | jq -r '.sessions[0].id')
+
+RESP=$(curl -s -w "\n%{http_code}" -X DELETE "$BASE/users/$RIDER_ID/sessions/$SESSION_ID" -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "DELETE /users/:id/sessions/:sid" "200" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/users/$RIDER_ID" -H "Authorization: Bearer $SECOND_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "Signed-out session's token is refused" "401" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/users/$RIDER_ID" -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "Other session still works" "200" "$CODE"
 echo ""
 
 # ─────────────────────────────────────────────────────────────────────────────
@@ -202,7 +379,7 @@ bold "5. DRIVER REGISTRATION"
 # 5a. Successful registration
 RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/drivers/register" \
   -H "Content-Type: application/json" \
-  -d "{\"name\":\"Test Driver $TS\",\"email\":\"driver_${TS}@test.com\",\"phone\":\"+2${TS}\",\"password\":\"driverpass\",\"vehicle_type\":\"suv\",\"license_plate\":\"KA-01-AB-${TS}\"}")
+  -d "{\"name\":\"Test Driver $TS\",\"email\":\"driver_${TS}@test.com\",\"phone\":\"$(phone 92)\",\"password\":\"driverpass\",\"vehicle_type\":\"suv\",\"license_plate\":\"KA-01-AB-${TS}\",$ACCEPT}")
 parse_response "$RESP"
 assert_status "POST /drivers/register — success" "201" "$CODE"
 assert_json_field "Driver registration returns token" "$BODY" ".token"
@@ -216,14 +393,14 @@ DRIVER_ID=$(echo "$BODY" | jq -r '.driver.id')
 # 5b. Duplicate email
 RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/drivers/register" \
   -H "Content-Type: application/json" \
-  -d "{\"name\":\"Dup Driver\",\"email\":\"driver_${TS}@test.com\",\"phone\":\"+9${TS}\",\"password\":\"abc\",\"vehicle_type\":\"sedan\",\"license_plate\":\"X\"}")
+  -d "{\"name\":\"Dup Driver\",\"email\":\"driver_${TS}@test.com\",\"phone\":\"$(phone 99)\",\"password\":\"abc\",\"vehicle_type\":\"sedan\",\"license_plate\":\"X\"}")
 CODE=$(echo "$RESP" | tail -n 1)
 assert_status "POST /drivers/register — duplicate email" "409" "$CODE"
 
 # 5c. Default vehicle_type when empty
 RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/drivers/register" \
   -H "Content-Type: application/json" \
-  -d "{\"name\":\"Default VT\",\"email\":\"defvt_${TS}@test.com\",\"phone\":\"+3${TS}\",\"password\":\"abc\",\"license_plate\":\"Y\"}")
+  -d "{\"name\":\"Default VT\",\"email\":\"defvt_${TS}@test.com\",\"phone\":\"$(phone 93)\",\"password\":\"abc\",\"license_plate\":\"Y\",$ACCEPT}")
 parse_response "$RESP"
 assert_status "POST /drivers/register — default vehicle_type" "201" "$CODE"
 assert_json_equals "Default vehicle_type is sedan" "$BODY" ".driver.vehicle_type" "sedan"
@@ -259,7 +436,7 @@ assert_status "POST /drivers/login — wrong password" "401" "$CODE"
 # 6c. Non-existent email
 RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/drivers/login" \
   -H "Content-Type: application/json" \
-  -d "{\"email\":\"nope@test.com\",\"password\":\"abc\"}")
+  -d "{\"email\":\"nope_${TS}@test.com\",\"password\":\"abc\"}")
 CODE=$(echo "$RESP" | tail -n 1)
 assert_status "POST /drivers/login — email not found" "401" "$CODE"
 
@@ -269,6 +446,25 @@ RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/drivers/login" \
   -d "bad")
 CODE=$(echo "$RESP" | tail -n 1)
 assert_status "POST /drivers/login — invalid body" "400" "$CODE"
+
+# 6e. Two-factor enrollment: a secret to scan, enabled only by a right code
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/two-factor" -H "Authorization: Bearer $DRIVER_TOKEN")
+parse_response "$RESP"
+assert_status "POST /two-factor — driver" "201" "$CODE"
+assert_json_field "Enrollment returns an otpauth URI" "$BODY" ".otpauth_uri"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/two-factor/confirm" -H "Authorization: Bearer $DRIVER_TOKEN" \
+  -H "Content-Type: application/json" -d '{"code":"000000x"}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /two-factor/confirm — wrong code" "400" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/two-factor" -H "Authorization: Bearer $DRIVER_TOKEN")
+parse_response "$RESP"
+assert_json_equals "Two-factor not enabled before confirming" "$BODY" ".enabled" "false"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/two-factor" -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /two-factor — rider" "403" "$CODE"
 echo ""
 
 # ─────────────────────────────────────────────────────────────────────────────
@@ -292,6 +488,89 @@ RESP=$(curl -s -w "\n%{http_code}" "$BASE/drivers/00000000-0000-0000-0000-000000
   -H "Authorization: Bearer $DRIVER_TOKEN")
 CODE=$(echo "$RESP" | tail -n 1)
 assert_status "GET /drivers/:id — not found" "404" "$CODE"
+
+# 7d. Background check — a new driver has not started one
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/drivers/$DRIVER_ID/background-check" \
+  -H "Authorization: Bearer $DRIVER_TOKEN")
+parse_response "$RESP"
+assert_status "GET /drivers/:id/background-check" "200" "$CODE"
+assert_json_equals "Background check status" "$BODY" ".status" "not_started"
+
+# 7e. An unsigned vendor callback is refused
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/drivers/$DRIVER_ID/background-check/callback" \
+  -H "Content-Type: application/json" \
+  -d '{"vendor":"acme","reference":"chk_1","status":"passed"}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /drivers/:id/background-check/callback — unsigned" "401" "$CODE"
+
+# 7f. Vehicle photo — sniffed, not trusted from Content-Type; riders see it on
+# the vehicle card of their trip (12a)
+RESP=$(printf 'not an image' | curl -s -w "\n%{http_code}" -X PUT "$BASE/drivers/$DRIVER_ID/vehicle/photo" \
+  -H "Authorization: Bearer $DRIVER_TOKEN" -H "Content-Type: image/png" --data-binary @-)
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "PUT /drivers/:id/vehicle/photo — not an image" "415" "$CODE"
+
+RESP=$(printf '\211PNG\r\n\032\n' | curl -s -w "\n%{http_code}" -X PUT "$BASE/drivers/$DRIVER_ID/vehicle/photo" \
+  -H "Authorization: Bearer $DRIVER_TOKEN" -H "Content-Type: image/png" --data-binary @-)
+parse_response "$RESP"
+assert_status "PUT /drivers/:id/vehicle/photo — png" "200" "$CODE"
+assert_json_equals "Photo updated" "$BODY" ".status" "photo_updated"
+
+CODE=$(curl -s -o /dev/null -w "%{http_code} %{content_type}" "$BASE/drivers/$DRIVER_ID/vehicle/photo" -H "Authorization: Bearer $RIDER_TOKEN")
+assert_status "GET /drivers/:id/vehicle/photo — served as png" "200 image/png" "$CODE"
+
+# 7g. Documents — uploaded by the driver, reviewed by an admin
+RESP=$(printf '%%PDF-1.4\n' | curl -s -w "\n%{http_code}" -X POST "$BASE/drivers/$DRIVER_ID/documents/passport" \
+  -H "Authorization: Bearer $DRIVER_TOKEN" --data-binary @-)
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /drivers/:id/documents/:kind — unknown kind" "400" "$CODE"
+
+RESP=$(printf 'plain text' | curl -s -w "\n%{http_code}" -X POST "$BASE/drivers/$DRIVER_ID/documents/license" \
+  -H "Authorization: Bearer $DRIVER_TOKEN" --data-binary @-)
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /drivers/:id/documents/:kind — not a pdf or image" "415" "$CODE"
+
+RESP=$(printf '%%PDF-1.4\n' | curl -s -w "\n%{http_code}" -X POST "$BASE/drivers/$DRIVER_ID/documents/license" \
+  -H "Authorization: Bearer $DRIVER_TOKEN" --data-binary @-)
+parse_response "$RESP"
+assert_status "POST /drivers/:id/documents/license" "201" "$CODE"
+assert_json_equals "License awaits review" "$BODY" ".status" "pending"
+LICENSE_DOC_ID=$(echo "$BODY" | jq -r '.id')
+
+RESP=$(printf '\211PNG\r\n\032\n' | curl -s -w "\n%{http_code}" -X POST "$BASE/drivers/$DRIVER_ID/documents/insurance" \
+  -H "Authorization: Bearer $DRIVER_TOKEN" --data-binary @-)
+parse_response "$RESP"
+assert_status "POST /drivers/:id/documents/insurance" "201" "$CODE"
+INSURANCE_DOC_ID=$(echo "$BODY" | jq -r '.id')
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/admin/documents?limit=100" -H "Authorization: Bearer $DRIVER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /admin/documents — driver gets 403" "403" "$CODE"
+
+CODE=$(curl -s -o /dev/null -w "%{http_code} %{content_type}" "$BASE/admin/documents/$LICENSE_DOC_ID/file" -H "Authorization: Bearer $ADMIN_TOKEN")
+assert_status "GET /admin/documents/:id/file — admin" "200 application/pdf" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/admin/documents/$LICENSE_DOC_ID/approve" -H "Authorization: Bearer $ADMIN_TOKEN")
+parse_response "$RESP"
+assert_status "POST /admin/documents/:id/approve" "200" "$CODE"
+assert_json_equals "License approved" "$BODY" ".status" "approved"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/admin/documents/$INSURANCE_DOC_ID/reject" \
+  -H "Authorization: Bearer $ADMIN_TOKEN" -H "Content-Type: application/json" -d '{"reason":"Policy number unreadable"}')
+parse_response "$RESP"
+assert_status "POST /admin/documents/:id/reject" "200" "$CODE"
+assert_json_equals "Rejection reason kept" "$BODY" ".reject_reason" "Policy number unreadable"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/admin/documents/$LICENSE_DOC_ID/reject" \
+  -H "Authorization: Bearer $ADMIN_TOKEN" -H "Content-Type: application/json" -d '{"reason":"Changed my mind"}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /admin/documents/:id/reject — already reviewed" "409" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/drivers/$DRIVER_ID/documents" -H "Authorization: Bearer $DRIVER_TOKEN")
+parse_response "$RESP"
+assert_status "GET /drivers/:id/documents" "200" "$CODE"
+assert_json_equals "Registration and insurance still missing" "$BODY" ".missing | join(\",\")" "registration,insurance"
+assert_json_equals "Not verified yet" "$BODY" ".verified" "false"
 echo ""
 
 # ─────────────────────────────────────────────────────────────────────────────
@@ -321,6 +600,45 @@ RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/drivers/$DRIVER_ID/location"
   -d "bad")
 CODE=$(echo "$RESP" | tail -n 1)
 assert_status "PATCH /drivers/:id/location — invalid body" "400" "$CODE"
+
+# 8d. Queue position outside any queue zone (none are configured here)
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/drivers/$DRIVER_ID/queue" -H "Authorization: Bearer $DRIVER_TOKEN")
+parse_response "$RESP"
+assert_status "GET /drivers/:id/queue — not queued" "404" "$CODE"
+assert_json_equals "Not queued code" "$BODY" ".code" "not_queued"
+
+# 8e. Another user's queue position
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/drivers/$DRIVER_ID/queue" -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /drivers/:id/queue — rider gets 403" "403" "$CODE"
+
+# 8f. Online sessions — the location update in 8a opened one
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/drivers/$DRIVER_ID/sessions" -H "Authorization: Bearer $DRIVER_TOKEN")
+parse_response "$RESP"
+assert_status "GET /drivers/:id/sessions" "200" "$CODE"
+assert_json_equals "Driver is online" "$BODY" ".online" "true"
+assert_json_equals "One open session" "$BODY" "[.sessions[] | select(.ended_at == null)] | length" "1"
+assert_json_field "Per-day totals present" "$BODY" ".days"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/drivers/$DRIVER_ID/sessions?from=2024-01-01&to=2024-03-01" -H "Authorization: Bearer $DRIVER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /drivers/:id/sessions — range over 31 days" "400" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/drivers/$DRIVER_ID/sessions?from=2024-03-01&to=2024-02-01" -H "Authorization: Bearer $DRIVER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /drivers/:id/sessions — from after to" "400" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/drivers/$DRIVER_ID/sessions?from=yesterday" -H "Authorization: Bearer $DRIVER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /drivers/:id/sessions — malformed bound" "400" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/drivers/$DRIVER_ID/sessions" -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /drivers/:id/sessions — rider gets 403" "403" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/drivers/$DRIVER_ID/sessions" -H "Authorization: Bearer $ADMIN_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /drivers/:id/sessions — admin" "200" "$CODE"
 echo ""
 
 # ─────────────────────────────────────────────────────────────────────────────
@@ -381,6 +699,26 @@ RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/request" \
   -d "bad")
 CODE=$(echo "$RESP" | tail -n 1)
 assert_status "POST /trips/request — invalid body" "400" "$CODE"
+
+# 10d. A second trip while the first is in progress
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/request" \
+  -H "Content-Type: application/json" \
+  -H "Authorization: Bearer $RIDER_TOKEN" \
+  -d '{"pickupLat": 12.9716, "pickupLng": 77.5946, "dropLat": 12.2958, "dropLng": 76.6394}')
+parse_response "$RESP"
+assert_status "POST /trips/request — rider already has an active trip" "409" "$CODE"
+assert_json_equals "Active trip error code" "$BODY" ".code" "active_trip"
+
+# 10e. The caller's trips in progress
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/trips/active" \
+  -H "Authorization: Bearer $RIDER_TOKEN")
+parse_response "$RESP"
+assert_status "GET /trips/active — success" "200" "$CODE"
+assert_json_equals "Active trips hold the requested trip" "$BODY" ".trips | map(.id) | join(\",\")" "$TRIP_ID"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/trips/active")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /trips/active — no token" "401" "$CODE"
 echo ""
 
 # ─────────────────────────────────────────────────────────────────────────────
@@ -403,18 +741,26 @@ assert_status "GET /trips/:id — no token" "401" "$CODE"
 # 11c. Non-existent trip
 RESP=$(curl -s -w "\n%{http_code}" "$BASE/trips/00000000-0000-0000-0000-000000000000" \
   -H "Authorization: Bearer $RIDER_TOKEN")
-CODE=$(echo "$RESP" | tail -n 1)
+parse_response "$RESP"
 assert_status "GET /trips/:id — not found" "404" "$CODE"
+assert_json_equals "Not found error code" "$BODY" ".code" "not_found"
+
+# 11d. Malformed trip ID is not found, not a server error
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/trips/not-a-uuid" \
+  -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /trips/:id — malformed id" "404" "$CODE"
 echo ""
 
 # ─────────────────────────────────────────────────────────────────────────────
 bold "12. MANUAL TRIP LIFECYCLE (request → assign → start → end)"
 # ─────────────────────────────────────────────────────────────────────────────
 
-# Create a second trip for manual lifecycle testing
+# Create a second trip, for another rider, for manual lifecycle testing
+MANUAL_RIDER_TOKEN=$(new_rider 1)
 RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/request" \
   -H "Content-Type: application/json" \
-  -H "Authorization: Bearer $RIDER_TOKEN" \
+  -H "Authorization: Bearer $MANUAL_RIDER_TOKEN" \
   -d '{"pickupLat": 28.6139, "pickupLng": 77.2090, "dropLat": 28.7041, "dropLng": 77.1025}')
 parse_response "$RESP"
 assert_status "Create trip for manual lifecycle" "201" "$CODE"
@@ -425,6 +771,7 @@ sleep 1
 
 # 12a. Assign driver — success
 RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/trips/$MANUAL_TRIP_ID/assign" \
+  -H "If-Match: \"$(trip_version $MANUAL_TRIP_ID)\"" \
   -H "Content-Type: application/json" \
   -H "Authorization: Bearer $RIDER_TOKEN" \
   -d "{\"driverId\":\"$DRIVER_ID\"}")
@@ -433,64 +780,372 @@ assert_status "PATCH /trips/:id/assign — success" "200" "$CODE"
 assert_json_equals "Trip status after assign" "$BODY" ".status" "DRIVER_ASSIGNED"
 assert_json_equals "Assigned driver_id" "$BODY" ".driver_id" "$DRIVER_ID"
 
+# The rider sees which car is coming
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/trips/$MANUAL_TRIP_ID" -H "Authorization: Bearer $RIDER_TOKEN")
+parse_response "$RESP"
+assert_status "GET /trips/:id — assigned" "200" "$CODE"
+assert_json_equals "Vehicle card type" "$BODY" ".vehicle.type" "suv"
+assert_json_equals "Vehicle card plate" "$BODY" ".vehicle.plate" "KA-01-AB-${TS}"
+assert_json_equals "Vehicle card photo" "$BODY" ".vehicle.photo_url" "/drivers/$DRIVER_ID/vehicle/photo"
+
+# The ops map finds the trip by where its driver is (Bangalore, since 8a)
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/admin/trips/active?bbox=77.5,12.9,77.7,13.1" -H "Authorization: Bearer $ADMIN_TOKEN")
+parse_response "$RESP"
+assert_status "GET /admin/trips/active?bbox= — admin" "200" "$CODE"
+assert_json_equals "Trip whose driver is in the box is listed" "$BODY" "[.trips[] | select(.id == \"$MANUAL_TRIP_ID\")] | length" "1"
+assert_json_equals "Listed with the driver's position" "$BODY" ".trips[] | select(.id == \"$MANUAL_TRIP_ID\") | .driver_lat" "12.9716"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/admin/trips/active?bbox=72.7,18.8,73.0,19.3" -H "Authorization: Bearer $ADMIN_TOKEN")
+parse_response "$RESP"
+assert_json_equals "Not listed for a box elsewhere" "$BODY" "[.trips[] | select(.id == \"$MANUAL_TRIP_ID\")] | length" "0"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/admin/trips/active?bbox=77.5,12.9,77.7" -H "Authorization: Bearer $ADMIN_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /admin/trips/active — malformed bbox" "400" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/admin/trips/active?bbox=77.5,12.9,77.7,13.1" -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /admin/trips/active — rider gets 403" "403" "$CODE"
+
+# Audio recording: each party consents for themselves, and a recording is
+# registered only for time their consent covers
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/$MANUAL_TRIP_ID/recording/consent" -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /trips/:id/recording/consent — not a participant" "403" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/$MANUAL_TRIP_ID/recording" \
+  -H "Authorization: Bearer $DRIVER_TOKEN" -H "Content-Type: application/json" \
+  -d "{\"device_id\":\"phone-$TS\",\"started_at\":\"2026-01-01T00:00:00Z\",\"ended_at\":\"2026-01-01T00:05:00Z\",\"size_bytes\":1024,\"sha256\":\"$(printf '%064d' 0)\"}")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /trips/:id/recording — without consent" "409" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/$MANUAL_TRIP_ID/recording/consent" -H "Authorization: Bearer $DRIVER_TOKEN")
+parse_response "$RESP"
+assert_status "POST /trips/:id/recording/consent — driver" "200" "$CODE"
+assert_json_equals "Consent is the driver's" "$BODY" ".party" "driver"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/trips/$MANUAL_TRIP_ID/recording/consent" -H "Authorization: Bearer $DRIVER_TOKEN")
+parse_response "$RESP"
+assert_status "GET /trips/:id/recording/consent" "200" "$CODE"
+assert_json_equals "Driver has consented" "$BODY" ".driver.account_id" "$DRIVER_ID"
+assert_json_equals "Rider has not" "$BODY" ".rider" "null"
+
+sleep 1
+REC_START=$(date -u +%Y-%m-%dT%H:%M:%SZ)
+sleep 1
+REC_END=$(date -u +%Y-%m-%dT%H:%M:%SZ)
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/$MANUAL_TRIP_ID/recording" \
+  -H "Authorization: Bearer $DRIVER_TOKEN" -H "Content-Type: application/json" \
+  -d "{\"device_id\":\"phone-$TS\",\"started_at\":\"$REC_START\",\"ended_at\":\"$REC_END\",\"size_bytes\":1024,\"sha256\":\"$(printf '%064d' 0)\"}")
+parse_response "$RESP"
+assert_status "POST /trips/:id/recording — covered by consent" "201" "$CODE"
+assert_json_equals "Recording is the driver's" "$BODY" ".party" "driver"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/admin/trips/$MANUAL_TRIP_ID/recordings?incident_id=inc-$TS" -H "Authorization: Bearer $ADMIN_TOKEN")
+parse_response "$RESP"
+assert_status "GET /admin/trips/:id/recordings — admin" "200" "$CODE"
+assert_json_equals "One recording registered" "$BODY" ".recordings | length" "1"
+
+RESP=$(curl -s -w "\n%{http_code}" -X DELETE "$BASE/trips/$MANUAL_TRIP_ID/recording/consent" -H "Authorization: Bearer $DRIVER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "DELETE /trips/:id/recording/consent" "200" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X DELETE "$BASE/trips/$MANUAL_TRIP_ID/recording/consent" -H "Authorization: Bearer $DRIVER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "DELETE /trips/:id/recording/consent — already withdrawn" "409" "$CODE"
+
+# Re-consenting opens a new interval and keeps the old one; a recording
+# spanning the gap between them is not covered
+sleep 1
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/$MANUAL_TRIP_ID/recording/consent" -H "Authorization: Bearer $DRIVER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /trips/:id/recording/consent — again after withdrawing" "200" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/trips/$MANUAL_TRIP_ID/recording/consent" -H "Authorization: Bearer $DRIVER_TOKEN")
+parse_response "$RESP"
+assert_status "GET /trips/:id/recording/consent — history" "200" "$CODE"
+assert_json_equals "Both consents are kept" "$BODY" ".history | length" "2"
+assert_json_equals "The first stays revoked" "$BODY" ".history[0].revoked_at != null" "true"
+assert_json_equals "The latest is open" "$BODY" ".driver.revoked_at" "null"
+
+REC_NOW=$(date -u +%Y-%m-%dT%H:%M:%SZ)
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/$MANUAL_TRIP_ID/recording" \
+  -H "Authorization: Bearer $DRIVER_TOKEN" -H "Content-Type: application/json" \
+  -d "{\"device_id\":\"phone-$TS\",\"started_at\":\"$REC_START\",\"ended_at\":\"$REC_NOW\",\"size_bytes\":1024,\"sha256\":\"$(printf '%064d' 0)\"}")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /trips/:id/recording — across a withdrawal" "409" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X DELETE "$BASE/trips/$MANUAL_TRIP_ID/recording/consent" -H "Authorization: Bearer $DRIVER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "DELETE /trips/:id/recording/consent — second consent" "200" "$CODE"
+
+# 12a'. Transition without If-Match / with a stale version
+RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/trips/$MANUAL_TRIP_ID/start" \
+  -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "PATCH /trips/:id/start — missing If-Match" "428" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/trips/$MANUAL_TRIP_ID/start" \
+  -H "If-Match: \"1\"" \
+  -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "PATCH /trips/:id/start — stale If-Match" "409" "$CODE"
+
 # 12b. Assign again (invalid state)
 RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/trips/$MANUAL_TRIP_ID/assign" \
+  -H "If-Match: \"$(trip_version $MANUAL_TRIP_ID)\"" \
   -H "Content-Type: application/json" \
   -H "Authorization: Bearer $RIDER_TOKEN" \
   -d "{\"driverId\":\"$DRIVER_ID\"}")
-CODE=$(echo "$RESP" | tail -n 1)
+parse_response "$RESP"
 assert_status "PATCH /trips/:id/assign — already assigned" "400" "$CODE"
+assert_json_equals "Invalid transition error code" "$BODY" ".code" "invalid_transition"
+
+# 12b'. Offer responses — only the assigned driver can answer
+RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/trips/$MANUAL_TRIP_ID/accept" \
+  -H "If-Match: \"$(trip_version $MANUAL_TRIP_ID)\"" \
+  -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "PATCH /trips/:id/accept — not the assigned driver" "403" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/trips/$MANUAL_TRIP_ID/accept" \
+  -H "If-Match: \"$(trip_version $MANUAL_TRIP_ID)\"" \
+  -H "Authorization: Bearer $DRIVER_TOKEN")
+parse_response "$RESP"
+assert_status "PATCH /trips/:id/accept — success" "200" "$CODE"
+assert_json_equals "Trip still assigned after accept" "$BODY" ".status" "DRIVER_ASSIGNED"
+
+RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/trips/$MANUAL_TRIP_ID/decline" \
+  -H "If-Match: \"$(trip_version $MANUAL_TRIP_ID)\"" \
+  -H "Authorization: Bearer $DRIVER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "PATCH /trips/:id/decline — already accepted" "409" "$CODE"
+
+# 12b'''. The driver's trip in progress, for apps that poll instead of holding a socket
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/drivers/$DRIVER_ID/current-trip" -H "Authorization: Bearer $DRIVER_TOKEN")
+parse_response "$RESP"
+assert_status "GET /drivers/:id/current-trip — success" "200" "$CODE"
+assert_json_equals "Current trip is the assigned one" "$BODY" ".id" "$MANUAL_TRIP_ID"
+assert_json_equals "Current trip offer accepted" "$BODY" ".offer" "accepted"
+assert_json_equals "Current trip next step" "$BODY" ".next" "drive_to_pickup"
+
+CODE=$(curl -s -o /dev/null -w "%{http_code}" "$BASE/drivers/$DRIVER_ID/current-trip" \
+  -H "If-None-Match: \"$(trip_version $MANUAL_TRIP_ID)\"" \
+  -H "Authorization: Bearer $DRIVER_TOKEN")
+assert_status "GET /drivers/:id/current-trip — unchanged since last poll" "304" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/drivers/$DRIVER_ID/current-trip" -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /drivers/:id/current-trip — rider gets 403" "403" "$CODE"
+
+# 12b''. Pickup reports — the driver is nowhere near this pickup and has not arrived
+RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/trips/$MANUAL_TRIP_ID/arrive" \
+  -H "If-Match: \"$(trip_version $MANUAL_TRIP_ID)\"" \
+  -H "Authorization: Bearer $DRIVER_TOKEN")
+parse_response "$RESP"
+assert_status "PATCH /trips/:id/arrive — driver not at pickup" "409" "$CODE"
+assert_json_equals "Not at pickup error code" "$BODY" ".code" "not_at_pickup"
+
+RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/trips/$MANUAL_TRIP_ID/no-show" \
+  -H "If-Match: \"$(trip_version $MANUAL_TRIP_ID)\"" \
+  -H "Authorization: Bearer $DRIVER_TOKEN")
+parse_response "$RESP"
+assert_status "PATCH /trips/:id/no-show — before arriving" "409" "$CODE"
+assert_json_equals "Wait not over error code" "$BODY" ".code" "wait_not_over"
+
+RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/trips/$MANUAL_TRIP_ID/no-show" \
+  -H "If-Match: \"$(trip_version $MANUAL_TRIP_ID)\"" \
+  -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "PATCH /trips/:id/no-show — not the assigned driver" "403" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/drivers/$DRIVER_ID" -H "Authorization: Bearer $DRIVER_TOKEN")
+parse_response "$RESP"
+assert_json_field "Driver profile has offer scores" "$BODY" ".scores.window_days"
 
 # 12c. Start trip before assigning (use the first trip that may not be assigned)
 # Create a fresh trip just for this test
 RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/request" \
   -H "Content-Type: application/json" \
-  -H "Authorization: Bearer $RIDER_TOKEN" \
+  -H "Authorization: Bearer $(new_rider 2)" \
   -d '{"pickupLat": 0.001, "pickupLng": 0.001, "dropLat": 0.002, "dropLng": 0.002}')
 FRESH_TRIP_ID=$(echo "$RESP" | sed '$d' | jq -r '.trip_id')
 # Try to start without driver assigned
 RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/trips/$FRESH_TRIP_ID/start" \
+  -H "If-Match: \"$(trip_version $FRESH_TRIP_ID)\"" \
   -H "Authorization: Bearer $RIDER_TOKEN")
 CODE=$(echo "$RESP" | tail -n 1)
 assert_status "PATCH /trips/:id/start — not in DRIVER_ASSIGNED" "400" "$CODE"
 
+# 12c'. Assign a driver who is already on another trip
+RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/trips/$FRESH_TRIP_ID/assign" \
+  -H "If-Match: \"$(trip_version $FRESH_TRIP_ID)\"" \
+  -H "Content-Type: application/json" \
+  -H "Authorization: Bearer $RIDER_TOKEN" \
+  -d "{\"driverId\":\"$DRIVER_ID\"}")
+parse_response "$RESP"
+assert_status "PATCH /trips/:id/assign — driver already on a trip" "409" "$CODE"
+assert_json_equals "Driver busy error code" "$BODY" ".code" "driver_busy"
+
 # 12d. Start trip — success (use manual trip)
 RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/trips/$MANUAL_TRIP_ID/start" \
+  -H "If-Match: \"$(trip_version $MANUAL_TRIP_ID)\"" \
   -H "Authorization: Bearer $RIDER_TOKEN")
 parse_response "$RESP"
 assert_status "PATCH /trips/:id/start — success" "200" "$CODE"
 assert_json_equals "Trip status after start" "$BODY" ".status" "STARTED"
 assert_json_field "started_at is set" "$BODY" ".started_at"
 
+# 12d'. An offline completion must carry the signature of one of the
+# driver's registered devices
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/drivers/$DRIVER_ID/devices" \
+  -H "Authorization: Bearer $DRIVER_TOKEN" -H "Content-Type: application/json" -d '{"label":"test phone"}')
+parse_response "$RESP"
+assert_status "POST /drivers/:id/devices" "201" "$CODE"
+assert_json_field "Device key issued" "$BODY" ".key"
+DEVICE_ID=$(echo "$BODY" | jq -r '.device_id')
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/$MANUAL_TRIP_ID/offline-completion" \
+  -H "Authorization: Bearer $DRIVER_TOKEN" -H "Content-Type: application/json" \
+  -d "{\"device_id\":\"$DEVICE_ID\",\"started_at\":\"2026-01-01T00:00:00Z\",\"ended_at\":\"2026-01-01T00:30:00Z\",\"distance_km\":15,\"signature\":\"$(printf '%064d' 0)\"}")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /trips/:id/offline-completion — bad signature" "403" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/trips/$MANUAL_TRIP_ID" -H "Authorization: Bearer $RIDER_TOKEN")
+parse_response "$RESP"
+assert_json_equals "Trip still STARTED after a rejected completion" "$BODY" ".status" "STARTED"
+
+# 12d''. Route changes wait for the driver: one is approved, the next rejected
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/$MANUAL_TRIP_ID/modifications" \
+  -H "Authorization: Bearer $MANUAL_RIDER_TOKEN" -H "Content-Type: application/json" \
+  -d '{"drop":{"lat":28.7100,"lng":77.1000},"stops":[{"lat":28.6500,"lng":77.1500}]}')
+parse_response "$RESP"
+assert_status "POST /trips/:id/modifications — rider" "202" "$CODE"
+assert_json_equals "Change awaits the driver" "$BODY" ".status" "PENDING"
+assert_json_field "Fare estimate with the change" "$BODY" ".fare_estimate.amount"
+MOD_ID=$(echo "$BODY" | jq -r '.id')
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/$MANUAL_TRIP_ID/modifications" \
+  -H "Authorization: Bearer $MANUAL_RIDER_TOKEN" -H "Content-Type: application/json" -d '{"stops":[{"lat":28.6600,"lng":77.1600}]}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /trips/:id/modifications — one already pending" "409" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/$MANUAL_TRIP_ID/modifications/$MOD_ID/approve" \
+  -H "If-Match: \"$(trip_version $MANUAL_TRIP_ID)\"" \
+  -H "Authorization: Bearer $MANUAL_RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /trips/:id/modifications/:modID/approve — rider refused" "403" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/$MANUAL_TRIP_ID/modifications/$MOD_ID/approve" -H "Authorization: Bearer $DRIVER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /trips/:id/modifications/:modID/approve — missing If-Match" "428" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/$MANUAL_TRIP_ID/modifications/$MOD_ID/approve" \
+  -H "If-Match: \"1\"" \
+  -H "Authorization: Bearer $DRIVER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /trips/:id/modifications/:modID/approve — stale If-Match" "409" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/$MANUAL_TRIP_ID/modifications/$MOD_ID/approve" \
+  -H "If-Match: \"$(trip_version $MANUAL_TRIP_ID)\"" \
+  -H "Authorization: Bearer $DRIVER_TOKEN")
+parse_response "$RESP"
+assert_status "POST /trips/:id/modifications/:modID/approve — driver" "200" "$CODE"
+assert_json_equals "Change approved" "$BODY" ".status" "APPROVED"
+assert_json_equals "Replaced drop kept" "$BODY" ".previous_drop.lat" "28.7041"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/trips/$MANUAL_TRIP_ID" -H "Authorization: Bearer $MANUAL_RIDER_TOKEN")
+parse_response "$RESP"
+assert_json_equals "Trip drop moved" "$BODY" ".drop_lat" "28.71"
+assert_json_equals "Destination change counted" "$BODY" ".destination_changes" "1"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/$MANUAL_TRIP_ID/modifications/$MOD_ID/reject" -H "Authorization: Bearer $DRIVER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /trips/:id/modifications/:modID/reject — already decided" "409" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/$MANUAL_TRIP_ID/modifications" \
+  -H "Authorization: Bearer $MANUAL_RIDER_TOKEN" -H "Content-Type: application/json" -d '{"stops":[{"lat":28.6600,"lng":77.1600}]}')
+MOD_ID=$(echo "$RESP" | sed '$d' | jq -r '.id')
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/$MANUAL_TRIP_ID/modifications/$MOD_ID/reject" -H "Authorization: Bearer $DRIVER_TOKEN")
+parse_response "$RESP"
+assert_status "POST /trips/:id/modifications/:modID/reject — driver" "200" "$CODE"
+assert_json_equals "Change rejected" "$BODY" ".status" "REJECTED"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/trips/$MANUAL_TRIP_ID/modifications" -H "Authorization: Bearer $DRIVER_TOKEN")
+parse_response "$RESP"
+assert_json_equals "Both changes in the history" "$BODY" ".modifications | length" "2"
+
 # 12e. Start again (invalid state)
 RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/trips/$MANUAL_TRIP_ID/start" \
+  -H "If-Match: \"$(trip_version $MANUAL_TRIP_ID)\"" \
   -H "Authorization: Bearer $RIDER_TOKEN")
 CODE=$(echo "$RESP" | tail -n 1)
 assert_status "PATCH /trips/:id/start — already started" "400" "$CODE"
 
 # 12f. End trip before starting (use the first trip)
 RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/trips/$FRESH_TRIP_ID/end" \
+  -H "If-Match: \"$(trip_version $FRESH_TRIP_ID)\"" \
   -H "Content-Type: application/json" \
   -H "Authorization: Bearer $RIDER_TOKEN" \
   -d '{}')
 CODE=$(echo "$RESP" | tail -n 1)
 assert_status "PATCH /trips/:id/end — not in STARTED state" "400" "$CODE"
 
+# 12f'. Pause and resume — the trip stays STARTED
+RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/trips/$MANUAL_TRIP_ID/pause" \
+  -H "If-Match: \"$(trip_version $MANUAL_TRIP_ID)\"" \
+  -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "PATCH /trips/:id/pause — another rider refused" "403" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/trips/$MANUAL_TRIP_ID/pause" \
+  -H "If-Match: \"$(trip_version $MANUAL_TRIP_ID)\"" \
+  -H "Authorization: Bearer $MANUAL_RIDER_TOKEN")
+parse_response "$RESP"
+assert_status "PATCH /trips/:id/pause — success" "200" "$CODE"
+assert_json_equals "Trip status while paused" "$BODY" ".status" "STARTED"
+assert_json_field "paused_at is set" "$BODY" ".paused_at"
+
+RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/trips/$MANUAL_TRIP_ID/pause" \
+  -H "If-Match: \"$(trip_version $MANUAL_TRIP_ID)\"" \
+  -H "Authorization: Bearer $MANUAL_RIDER_TOKEN")
+parse_response "$RESP"
+assert_status "PATCH /trips/:id/pause — already paused" "409" "$CODE"
+assert_json_equals "Already paused error code" "$BODY" ".code" "already_paused"
+
+sleep 1
+RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/trips/$MANUAL_TRIP_ID/resume" \
+  -H "If-Match: \"$(trip_version $MANUAL_TRIP_ID)\"" \
+  -H "Authorization: Bearer $MANUAL_RIDER_TOKEN")
+parse_response "$RESP"
+assert_status "PATCH /trips/:id/resume — success" "200" "$CODE"
+assert_json_equals "paused_at cleared on resume" "$BODY" ".paused_at" "null"
+
+RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/trips/$MANUAL_TRIP_ID/resume" \
+  -H "If-Match: \"$(trip_version $MANUAL_TRIP_ID)\"" \
+  -H "Authorization: Bearer $MANUAL_RIDER_TOKEN")
+parse_response "$RESP"
+assert_status "PATCH /trips/:id/resume — not paused" "409" "$CODE"
+assert_json_equals "Not paused error code" "$BODY" ".code" "not_paused"
+
 # 12g. End trip — success (auto fare calculation via haversine)
 RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/trips/$MANUAL_TRIP_ID/end" \
+  -H "If-Match: \"$(trip_version $MANUAL_TRIP_ID)\"" \
   -H "Content-Type: application/json" \
   -H "Authorization: Bearer $RIDER_TOKEN" \
   -d '{}')
 parse_response "$RESP"
 assert_status "PATCH /trips/:id/end — success (haversine)" "200" "$CODE"
 assert_json_equals "Trip status after end" "$BODY" ".status" "COMPLETED"
-assert_json_field "Fare is set" "$BODY" ".fare"
+assert_json_field "Fare is set" "$BODY" ".fare.amount"
 assert_json_field "completed_at is set" "$BODY" ".completed_at"
-FARE_HAVERSINE=$(echo "$BODY" | jq -r '.fare')
-yellow "  ℹ  Fare (haversine): ₹${FARE_HAVERSINE}"
+assert_json_equals "Paused minute charged as waiting" "$BODY" '.surcharges[] | select(.name == "waiting") | .units' "1"
+FARE_HAVERSINE=$(echo "$BODY" | jq -r '"\(.fare.amount / 100) \(.fare.currency)"')
+yellow "  ℹ  Fare (haversine): ${FARE_HAVERSINE}"
 
 # 12h. End again (invalid state)
 RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/trips/$MANUAL_TRIP_ID/end" \
+  -H "If-Match: \"$(trip_version $MANUAL_TRIP_ID)\"" \
   -H "Content-Type: application/json" \
   -H "Authorization: Bearer $RIDER_TOKEN" \
   -d '{}')
@@ -503,42 +1158,125 @@ bold "13. END TRIP WITH EXPLICIT DISTANCE"
 # ─────────────────────────────────────────────────────────────────────────────
 
 # Create → Assign → Start → End with explicit distance
+DIST_RIDER_TOKEN=$(new_rider 3)
 RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/request" \
   -H "Content-Type: application/json" \
-  -H "Authorization: Bearer $RIDER_TOKEN" \
+  -H "Authorization: Bearer $DIST_RIDER_TOKEN" \
   -d '{"pickupLat": 19.0760, "pickupLng": 72.8777, "dropLat": 18.5204, "dropLng": 73.8567}')
 DIST_TRIP_ID=$(echo "$RESP" | sed '$d' | jq -r '.trip_id')
 sleep 1
 
 curl -s -X PATCH "$BASE/trips/$DIST_TRIP_ID/assign" \
+  -H "If-Match: \"$(trip_version $DIST_TRIP_ID)\"" \
   -H "Content-Type: application/json" \
   -H "Authorization: Bearer $RIDER_TOKEN" \
   -d "{\"driverId\":\"$DRIVER_ID\"}" > /dev/null
 
 curl -s -X PATCH "$BASE/trips/$DIST_TRIP_ID/start" \
+  -H "If-Match: \"$(trip_version $DIST_TRIP_ID)\"" \
   -H "Authorization: Bearer $RIDER_TOKEN" > /dev/null
 
 RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/trips/$DIST_TRIP_ID/end" \
+  -H "If-Match: \"$(trip_version $DIST_TRIP_ID)\"" \
   -H "Content-Type: application/json" \
   -H "Authorization: Bearer $RIDER_TOKEN" \
   -d '{"distanceKm": 25.5}')
 parse_response "$RESP"
 assert_status "End trip with explicit distance" "200" "$CODE"
 assert_json_equals "Trip status is COMPLETED" "$BODY" ".status" "COMPLETED"
-FARE_EXPLICIT=$(echo "$BODY" | jq -r '.fare')
-# 50 + 25.5 * 12 = 356
-assert_json_equals "Fare = 50 + 25.5×12 = 356" "$BODY" ".fare" "356"
-yellow "  ℹ  Fare (explicit 25.5km): ₹${FARE_EXPLICIT}"
-echo ""
+FARE_EXPLICIT=$(echo "$BODY" | jq -r '"\(.fare.amount / 100) \(.fare.currency)"')
+# 50 + 25.5 * 12 = 356 rupees = 35600 paise
+assert_json_equals "Fare = 50 + 25.5×12 = 356" "$BODY" ".fare.amount" "35600"
+assert_json_equals "Fare currency" "$BODY" ".fare.currency" "INR"
+assert_json_field "Fare rule version recorded" "$BODY" ".pricing_version"
+assert_json_field "Commission rule version recorded" "$BODY" ".commission_version"
+assert_json_equals "Commission is 20% of the fare" "$BODY" ".commission.amount" "7120"
+yellow "  ℹ  Fare (explicit 25.5km): ${FARE_EXPLICIT}"
+
+# The rider disputes the fare, once
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/$DIST_TRIP_ID/dispute" \
+  -H "Authorization: Bearer $DIST_RIDER_TOKEN" -H "Content-Type: application/json" -d '{"reason":"detour"}')
+parse_response "$RESP"
+assert_status "POST /trips/:id/dispute — unknown reason" "400" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/$DIST_TRIP_ID/dispute" \
+  -H "Authorization: Bearer $DRIVER_TOKEN" -H "Content-Type: application/json" -d '{"reason":"long_route"}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /trips/:id/dispute — driver forbidden" "403" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/$DIST_TRIP_ID/dispute" \
+  -H "Authorization: Bearer $DIST_RIDER_TOKEN" -H "Content-Type: application/json" \
+  -d '{"reason":"long_route","comment":"The driver went the long way round"}')
+parse_response "$RESP"
+assert_status "POST /trips/:id/dispute" "201" "$CODE"
+assert_json_equals "Dispute is open" "$BODY" ".status" "open"
+assert_json_equals "Disputed fare recorded" "$BODY" ".fare.amount" "35600"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/$DIST_TRIP_ID/dispute" \
+  -H "Authorization: Bearer $DIST_RIDER_TOKEN" -H "Content-Type: application/json" -d '{"reason":"other"}')
+parse_response "$RESP"
+assert_status "POST /trips/:id/dispute — already disputed" "409" "$CODE"
+assert_json_equals "Already disputed error code" "$BODY" ".code" "already_disputed"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/trips/$DIST_TRIP_ID/dispute" -H "Authorization: Bearer $DRIVER_TOKEN")
+parse_response "$RESP"
+assert_status "GET /trips/:id/dispute — driver" "200" "$CODE"
+assert_json_equals "Dispute reason" "$BODY" ".reason" "long_route"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/admin/disputes" -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /admin/disputes — rider gets 403" "403" "$CODE"
+
+# The rider blocks the driver, then lifts the block
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/$DIST_TRIP_ID/block" \
+  -H "Authorization: Bearer $RIDER_TOKEN" -H "Content-Type: application/json" -d '{}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /trips/:id/block — not a participant" "403" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/$DIST_TRIP_ID/block" \
+  -H "Authorization: Bearer $DIST_RIDER_TOKEN" -H "Content-Type: application/json" -d '{"reason":"Rude driver"}')
+parse_response "$RESP"
+assert_status "POST /trips/:id/block" "201" "$CODE"
+assert_json_equals "Blocked by the rider" "$BODY" ".blocked_by" "rider"
+assert_json_equals "Blocked driver" "$BODY" ".driver_id" "$DRIVER_ID"
+BLOCK_ID=$(echo "$BODY" | jq -r '.id')
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/$DIST_TRIP_ID/block" \
+  -H "Authorization: Bearer $DIST_RIDER_TOKEN")
+parse_response "$RESP"
+assert_status "POST /trips/:id/block — again" "409" "$CODE"
+assert_json_equals "Already blocked error code" "$BODY" ".code" "already_blocked"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/blocks" -H "Authorization: Bearer $DIST_RIDER_TOKEN")
+parse_response "$RESP"
+assert_status "GET /blocks" "200" "$CODE"
+assert_json_equals "One block listed" "$BODY" ".blocks | length" "1"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/blocks" -H "Authorization: Bearer $DRIVER_TOKEN")
+parse_response "$RESP"
+assert_json_equals "The blocked driver does not see it" "$BODY" ".blocks | length" "0"
+
+RESP=$(curl -s -w "\n%{http_code}" -X DELETE "$BASE/blocks/$BLOCK_ID" -H "Authorization: Bearer $DRIVER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "DELETE /blocks/:id — someone else's block" "404" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/admin/blocks" -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /admin/blocks — rider gets 403" "403" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X DELETE "$BASE/blocks/$BLOCK_ID" -H "Authorization: Bearer $DIST_RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "DELETE /blocks/:id" "200" "$CODE"
+echo ""
 
 # ─────────────────────────────────────────────────────────────────────────────
-bold "14. KAFKA AUTO-MATCHING (E2E FLOW)"
-# ─────────────────────────────────────────────────────────────────────────────
+bold "14. KAFKA AUTO-MATCHING (E2E FLOW)"
+# ─────────────────────────────────────────────────────────────────────────────
 
 # Register a new driver near Bangalore and set their location
 RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/drivers/register" \
   -H "Content-Type: application/json" \
-  -d "{\"name\":\"Auto Driver $TS\",\"email\":\"autodriver_${TS}@test.com\",\"phone\":\"+4${TS}\",\"password\":\"auto123\",\"vehicle_type\":\"auto\",\"license_plate\":\"KA-AUTO-${TS}\"}")
+  -d "{\"name\":\"Auto Driver $TS\",\"email\":\"autodriver_${TS}@test.com\",\"phone\":\"$(phone 94)\",\"password\":\"auto123\",\"vehicle_type\":\"auto\",\"license_plate\":\"KA-AUTO-${TS}\",$ACCEPT}")
 BODY=$(echo "$RESP" | sed '$d')
 AUTO_DRIVER_TOKEN=$(echo "$BODY" | jq -r '.token')
 AUTO_DRIVER_ID=$(echo "$BODY" | jq -r '.driver.id')
@@ -552,7 +1290,7 @@ curl -s -X PATCH "$BASE/drivers/$AUTO_DRIVER_ID/location" \
 # Request a trip near that driver
 RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/request" \
   -H "Content-Type: application/json" \
-  -H "Authorization: Bearer $RIDER_TOKEN" \
+  -H "Authorization: Bearer $(new_rider 4)" \
   -d '{"pickupLat": 12.9716, "pickupLng": 77.5946, "dropLat": 12.9352, "dropLng": 77.6245}')
 parse_response "$RESP"
 assert_status "Trip request for auto-matching" "201" "$CODE"
@@ -577,6 +1315,13 @@ else
   TOTAL=$((TOTAL+1)); FAIL=$((FAIL+1))
   red "  ❌ FAIL [$TOTAL] Kafka auto-matching — status=$MATCH_STATUS driver=$MATCH_DRIVER (expected DRIVER_ASSIGNED)"
 fi
+
+# The matched driver is marked busy once driver.assigned is consumed
+if [ -n "$MATCH_DRIVER" ]; then
+  RESP=$(curl -s -w "\n%{http_code}" "$BASE/drivers/$MATCH_DRIVER" -H "Authorization: Bearer $AUTO_DRIVER_TOKEN")
+  parse_response "$RESP"
+  assert_json_equals "Matched driver status is busy" "$BODY" ".status" "busy"
+fi
 echo ""
 
 # ─────────────────────────────────────────────────────────────────────────────
@@ -585,6 +1330,7 @@ bold "15. ASSIGN/START/END — MISSING FIELDS & EDGE CASES"
 
 # 15a. Assign with invalid body
 RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/trips/$TRIP_ID/assign" \
+  -H "If-Match: \"$(trip_version $TRIP_ID)\"" \
   -H "Content-Type: application/json" \
   -H "Authorization: Bearer $RIDER_TOKEN" \
   -d "bad")
@@ -612,25 +1358,28 @@ assert_status "PATCH /trips/:id/end — no token" "401" "$CODE"
 
 # 15e. Non-existent trip assign
 RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/trips/00000000-0000-0000-0000-000000000000/assign" \
+  -H "If-Match: \"1\"" \
   -H "Content-Type: application/json" \
   -H "Authorization: Bearer $RIDER_TOKEN" \
   -d "{\"driverId\":\"$DRIVER_ID\"}")
 CODE=$(echo "$RESP" | tail -n 1)
-assert_status "PATCH assign — non-existent trip" "400" "$CODE"
+assert_status "PATCH assign — non-existent trip" "404" "$CODE"
 
 # 15f. Non-existent trip start
 RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/trips/00000000-0000-0000-0000-000000000000/start" \
+  -H "If-Match: \"1\"" \
   -H "Authorization: Bearer $RIDER_TOKEN")
 CODE=$(echo "$RESP" | tail -n 1)
-assert_status "PATCH start — non-existent trip" "400" "$CODE"
+assert_status "PATCH start — non-existent trip" "404" "$CODE"
 
 # 15g. Non-existent trip end
 RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/trips/00000000-0000-0000-0000-000000000000/end" \
+  -H "If-Match: \"1\"" \
   -H "Content-Type: application/json" \
   -H "Authorization: Bearer $RIDER_TOKEN" \
   -d '{}')
 CODE=$(echo "$RESP" | tail -n 1)
-assert_status "PATCH end — non-existent trip" "400" "$CODE"
+assert_status "PATCH end — non-existent trip" "404" "$CODE"
 echo ""
 
 # ─────────────────────────────────────────────────────────────────────────────
@@ -659,6 +1408,45 @@ else
     FAIL=$((FAIL+1))
   fi
 fi
+
+# Replay cursor must be a message ID
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/ws/trips/$TRIP_ID?since=yesterday")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "WS /ws/trips/:id?since= — malformed cursor" "400" "$CODE"
+
+# SSE fallback streams the same updates (curl stops after --max-time)
+RESP=$(curl -s -N --max-time 2 -D - -o /dev/null "$BASE/sse/trips/$TRIP_ID" 2>&1 || true)
+TOTAL=$((TOTAL+1))
+if echo "$RESP" | grep -qi "content-type: text/event-stream"; then
+  green "  ✅ PASS [$TOTAL] SSE /sse/trips/:id — event stream opened"
+  PASS=$((PASS+1))
+else
+  red "  ❌ FAIL [$TOTAL] SSE /sse/trips/:id — no event stream"
+  FAIL=$((FAIL+1))
+fi
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/sse/trips/$TRIP_ID?since=yesterday")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "SSE /sse/trips/:id?since= — malformed cursor" "400" "$CODE"
+
+# Route change notices in the manual trip's history replay to its rider, but
+# not to a stream without their token, nor to another rider's
+SSE_RIDER=$(curl -s -N --max-time 2 "$BASE/sse/trips/$MANUAL_TRIP_ID" -H "Authorization: Bearer $MANUAL_RIDER_TOKEN" 2>/dev/null || true)
+SSE_ANON=$(curl -s -N --max-time 2 "$BASE/sse/trips/$MANUAL_TRIP_ID" 2>/dev/null || true)
+SSE_OTHER=$(curl -s -N --max-time 2 "$BASE/sse/trips/$MANUAL_TRIP_ID" -H "Authorization: Bearer $RIDER_TOKEN" 2>/dev/null || true)
+TOTAL=$((TOTAL+1))
+if echo "$SSE_RIDER" | grep -q '"type":"modification\.' && ! echo "$SSE_ANON$SSE_OTHER" | grep -q '"type":'; then
+  green "  ✅ PASS [$TOTAL] SSE /sse/trips/:id — only the trip's rider gets its route changes"
+  PASS=$((PASS+1))
+else
+  red "  ❌ FAIL [$TOTAL] SSE /sse/trips/:id — route changes replayed to the wrong clients"
+  FAIL=$((FAIL+1))
+fi
+
+# Connection stats are for admins only
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/admin/ws/stats" -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /admin/ws/stats — rider gets 403" "403" "$CODE"
 echo ""
 
 # ─────────────────────────────────────────────────────────────────────────────
@@ -677,10 +1465,24 @@ RESP=$(curl -s -w "\n%{http_code}" "$BASE/drivers/$DRIVER_ID" \
 CODE=$(echo "$RESP" | tail -n 1)
 assert_status "Rider token can GET /drivers/:id" "200" "$CODE"
 
+# Driver listing is for staff only
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/drivers?q=TEST" \
+  -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "Rider token cannot GET /drivers" "403" "$CODE"
+
+# Match weights are admin-only
+RESP=$(curl -s -w "\n%{http_code}" -X PUT "$BASE/admin/matching/weights" \
+  -H "Content-Type: application/json" \
+  -H "Authorization: Bearer $RIDER_TOKEN" \
+  -d '{"distance":1}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "Rider token cannot PUT /admin/matching/weights" "403" "$CODE"
+
 # User token can request trips
 RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/request" \
   -H "Content-Type: application/json" \
-  -H "Authorization: Bearer $RIDER_TOKEN" \
+  -H "Authorization: Bearer $(new_rider 5)" \
   -d '{"pickupLat": 1.0, "pickupLng": 1.0, "dropLat": 2.0, "dropLng": 2.0}')
 CODE=$(echo "$RESP" | tail -n 1)
 assert_status "Rider token can POST /trips/request" "201" "$CODE"
@@ -694,7 +1496,7 @@ bold "18. MULTIPLE DRIVERS — LOCATION & NEARBY"
 for i in 1 2 3; do
   RESP=$(curl -s -X POST "$BASE/drivers/register" \
     -H "Content-Type: application/json" \
-    -d "{\"name\":\"Multi Driver $i $TS\",\"email\":\"multi${i}_${TS}@test.com\",\"phone\":\"+5${i}${TS}\",\"password\":\"pass\",\"vehicle_type\":\"sedan\",\"license_plate\":\"MUL-$i-${TS}\"}")
+    -d "{\"name\":\"Multi Driver $i $TS\",\"email\":\"multi${i}_${TS}@test.com\",\"phone\":\"$(phone 8$i)\",\"password\":\"pass\",\"vehicle_type\":\"sedan\",\"license_plate\":\"MUL-$i-${TS}\",$ACCEPT}")
   local_token=$(echo "$RESP" | jq -r '.token')
   local_id=$(echo "$RESP" | jq -r '.driver.id')
 
@@ -724,6 +1526,859 @@ else
 fi
 echo ""
 
+# ─────────────────────────────────────────────────────────────────────────────
+bold "19. ACCOUNT DEACTIVATION"
+# ─────────────────────────────────────────────────────────────────────────────
+
+RESP=$(curl -s -X POST "$BASE/users/register" \
+  -H "Content-Type: application/json" \
+  -d "{\"name\":\"Leaving Rider $TS\",\"email\":\"leaving_${TS}@test.com\",\"phone\":\"$(phone 98)\",\"password\":\"password123\",$ACCEPT}")
+LEAVING_TOKEN=$(echo "$RESP" | jq -r '.token')
+LEAVING_ID=$(echo "$RESP" | jq -r '.user.id')
+
+RESP=$(curl -s -w "\n%{http_code}" -X DELETE "$BASE/users/$LEAVING_ID" \
+  -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "DELETE /users/:id — someone else's account" "403" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X DELETE "$BASE/users/$LEAVING_ID" \
+  -H "Authorization: Bearer $LEAVING_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "DELETE /users/:id — own account" "200" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/users/$LEAVING_ID" \
+  -H "Authorization: Bearer $LEAVING_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "Token of a deactivated account is revoked" "401" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/users/login" \
+  -H "Content-Type: application/json" \
+  -d "{\"email\":\"leaving_${TS}@test.com\",\"password\":\"password123\"}")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /users/login — deactivated account" "401" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/admin/users/$LEAVING_ID/restore" \
+  -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /admin/users/:id/restore — rider gets 403" "403" "$CODE"
+echo ""
+
+# ─────────────────────────────────────────────────────────────────────────────
+bold "20. PROFILE UPDATES"
+# ─────────────────────────────────────────────────────────────────────────────
+
+RESP=$(curl -s -X POST "$BASE/users/register" \
+  -H "Content-Type: application/json" \
+  -d "{\"name\":\"Profile Rider $TS\",\"email\":\"profile_${TS}@test.com\",\"phone\":\"$(phone 96)\",\"password\":\"password123\",$ACCEPT}")
+PROFILE_TOKEN=$(echo "$RESP" | jq -r '.token')
+PROFILE_ID=$(echo "$RESP" | jq -r '.user.id')
+
+RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/users/$PROFILE_ID" \
+  -H "Authorization: Bearer $RIDER_TOKEN" -H "Content-Type: application/json" \
+  -d '{"name":"Not Mine"}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "PATCH /users/:id — someone else's profile" "403" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/users/$PROFILE_ID" \
+  -H "Authorization: Bearer $PROFILE_TOKEN" -H "Content-Type: application/json" \
+  -d "{\"name\":\"Renamed Rider\",\"email\":\"profile_new_${TS}@test.com\"}")
+parse_response "$RESP"
+assert_status "PATCH /users/:id — name and email" "200" "$CODE"
+assert_json_equals "Name changes at once" "$BODY" ".user.name" "Renamed Rider"
+assert_json_equals "Email waits for verification" "$BODY" ".pending_verification[0]" "email"
+assert_json_equals "Email is unchanged until verified" "$BODY" ".user.email" "profile_${TS}@test.com"
+
+RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/users/$PROFILE_ID" \
+  -H "Authorization: Bearer $PROFILE_TOKEN" -H "Content-Type: application/json" \
+  -d "{\"email\":\"rider_${TS}@test.com\"}")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "PATCH /users/:id — email of another account" "409" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/users/$PROFILE_ID/verify" \
+  -H "Authorization: Bearer $PROFILE_TOKEN" -H "Content-Type: application/json" \
+  -d '{"field":"email","code":"000000"}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /users/:id/verify — wrong code" "400" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/users/$PROFILE_ID" \
+  -H "Authorization: Bearer $PROFILE_TOKEN" -H "Content-Type: application/json" \
+  -d '{"password":"newpassword1","current_password":"wrong"}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "PATCH /users/:id — wrong current password" "403" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/users/$PROFILE_ID" \
+  -H "Authorization: Bearer $PROFILE_TOKEN" -H "Content-Type: application/json" \
+  -d '{"password":"newpassword1","current_password":"password123"}')
+parse_response "$RESP"
+assert_status "PATCH /users/:id — password change" "200" "$CODE"
+assert_json_field "Password change returns a fresh token" "$BODY" ".token"
+NEW_PROFILE_TOKEN=$(echo "$BODY" | jq -r '.token')
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/users/$PROFILE_ID" -H "Authorization: Bearer $PROFILE_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "Tokens from before the password change are revoked" "401" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/users/$PROFILE_ID" -H "Authorization: Bearer $NEW_PROFILE_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "The fresh token works" "200" "$CODE"
+echo ""
+
+# ─────────────────────────────────────────────────────────────────────────────
+bold "21. AUDIT LOG"
+# ─────────────────────────────────────────────────────────────────────────────
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/admin/audit" -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /admin/audit — rider gets 403" "403" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/admin/audit")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /admin/audit — no token" "401" "$CODE"
+echo ""
+
+# ─────────────────────────────────────────────────────────────────────────────
+bold "22. NOTIFICATION PREFERENCES"
+# ─────────────────────────────────────────────────────────────────────────────
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/notifications/preferences" -H "Authorization: Bearer $RIDER_TOKEN")
+parse_response "$RESP"
+assert_status "GET /notifications/preferences" "200" "$CODE"
+assert_json_equals "Push is on by default" "$BODY" '.preferences[] | select(.channel=="push") | .enabled' "true"
+assert_json_equals "SMS is off by default" "$BODY" '.preferences[] | select(.channel=="sms") | .enabled' "false"
+
+RESP=$(curl -s -w "\n%{http_code}" -X PUT "$BASE/notifications/preferences" \
+  -H "Authorization: Bearer $RIDER_TOKEN" -H "Content-Type: application/json" \
+  -d '{"preferences":[{"channel":"sms","enabled":true,"events":["trip.matched"]}]}')
+parse_response "$RESP"
+assert_status "PUT /notifications/preferences — enable SMS for matches" "200" "$CODE"
+assert_json_equals "SMS is now on" "$BODY" '.preferences[] | select(.channel=="sms") | .enabled' "true"
+
+RESP=$(curl -s -w "\n%{http_code}" -X PUT "$BASE/notifications/preferences" \
+  -H "Authorization: Bearer $RIDER_TOKEN" -H "Content-Type: application/json" \
+  -d '{"preferences":[{"channel":"webhook","enabled":true,"address":"http://example.com/hook"}]}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "PUT /notifications/preferences — plain-http webhook rejected" "400" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X PUT "$BASE/notifications/preferences" \
+  -H "Authorization: Bearer $RIDER_TOKEN" -H "Content-Type: application/json" \
+  -d '{"preferences":[{"channel":"push","enabled":true,"events":["trip.unknown"]}]}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "PUT /notifications/preferences — unknown event rejected" "400" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/notifications/preferences")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /notifications/preferences — no token" "401" "$CODE"
+echo ""
+
+# ─────────────────────────────────────────────────────────────────────────────
+bold "23. PARTNER WEBHOOKS"
+# ─────────────────────────────────────────────────────────────────────────────
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/admin/webhooks" -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /admin/webhooks — rider gets 403" "403" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/admin/webhooks" -H "Content-Type: application/json" \
+  -d '{"name":"Acme","url":"https://example.com/hook","events":["trip.completed"]}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /admin/webhooks — no token" "401" "$CODE"
+echo ""
+
+# ─────────────────────────────────────────────────────────────────────────────
+bold "24. DAILY REPORTS"
+# ─────────────────────────────────────────────────────────────────────────────
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/admin/reports/daily" -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /admin/reports/daily — rider gets 403" "403" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/admin/reports/daily?from=2024-01-01&to=2024-01-07")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /admin/reports/daily — no token" "401" "$CODE"
+echo ""
+
+# ─────────────────────────────────────────────────────────────────────────────
+bold "25. HEATMAP"
+# ─────────────────────────────────────────────────────────────────────────────
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/admin/heatmap" -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /admin/heatmap — rider gets 403" "403" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/admin/heatmap?precision=5")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /admin/heatmap — no token" "401" "$CODE"
+echo ""
+
+# ─────────────────────────────────────────────────────────────────────────────
+bold "26. DRIVER QUESTS"
+# ─────────────────────────────────────────────────────────────────────────────
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/admin/quests" -H "Authorization: Bearer $RIDER_TOKEN" \
+  -H "Content-Type: application/json" \
+  -d '{"name":"Weekend 10","trips_required":10,"bonus":{"amount":50000,"currency":"INR"},"starts_at":"2030-01-04T00:00:00Z","ends_at":"2030-01-06T00:00:00Z"}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /admin/quests — rider gets 403" "403" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/drivers/$DRIVER_ID/quests" -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /drivers/:id/quests — other account gets 403" "403" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/drivers/$DRIVER_ID/wallet")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /drivers/:id/wallet — no token" "401" "$CODE"
+echo ""
+
+# ─────────────────────────────────────────────────────────────────────────────
+bold "27. FRAUD REVIEW QUEUE"
+# ─────────────────────────────────────────────────────────────────────────────
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/admin/fraud" -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /admin/fraud — rider gets 403" "403" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X PUT "$BASE/admin/pricing/fares/default" -H "Authorization: Bearer $RIDER_TOKEN" \
+  -H "Content-Type: application/json" -d '{"currency":"INR","base_fare":"1","per_km":"1"}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "PUT /admin/pricing/fares/:city — rider gets 403" "403" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/admin/fraud/00000000-0000-0000-0000-000000000000/review" \
+  -H "Content-Type: application/json" -d '{"status":"dismissed"}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /admin/fraud/:id/review — no token" "401" "$CODE"
+echo ""
+
+# ─────────────────────────────────────────────────────────────────────────────
+bold "28. TRIP CHAT"
+# ─────────────────────────────────────────────────────────────────────────────
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/00000000-0000-0000-0000-000000000000/messages" \
+  -H "Authorization: Bearer $RIDER_TOKEN" -H "Content-Type: application/json" -d '{"body":"hello"}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /trips/:id/messages — unknown trip" "404" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/trips/00000000-0000-0000-0000-000000000000/messages")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /trips/:id/messages — no token" "401" "$CODE"
+echo ""
+
+# ─────────────────────────────────────────────────────────────────────────────
+bold "29. MASKED CONTACT"
+# ─────────────────────────────────────────────────────────────────────────────
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/trips/00000000-0000-0000-0000-000000000000/contact")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /trips/:id/contact — no token" "401" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/contact/resolve" \
+  -H "Content-Type: application/json" -d '{"pin":"000000"}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /contact/resolve — no secret" "401" "$CODE"
+echo ""
+
+# ─────────────────────────────────────────────────────────────────────────────
+bold "30. LOST AND FOUND"
+# ─────────────────────────────────────────────────────────────────────────────
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/00000000-0000-0000-0000-000000000000/lost-item" \
+  -H "Authorization: Bearer $RIDER_TOKEN" -H "Content-Type: application/json" -d '{"description":"Black umbrella"}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /trips/:id/lost-item — unknown trip" "404" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/admin/lost-items" -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /admin/lost-items — rider forbidden" "403" "$CODE"
+echo ""
+
+# ─────────────────────────────────────────────────────────────────────────────
+bold "31. TAXES AND INVOICES"
+# ─────────────────────────────────────────────────────────────────────────────
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/trips/00000000-0000-0000-0000-000000000000/invoice" \
+  -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /trips/:id/invoice — unknown trip" "404" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/drivers/$DRIVER_ID/tax-summary" -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /drivers/:id/tax-summary — rider forbidden" "403" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/drivers/$DRIVER_ID/tax-summary?month=2026-13" -H "Authorization: Bearer $DRIVER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /drivers/:id/tax-summary — bad month" "400" "$CODE"
+echo ""
+
+# ─────────────────────────────────────────────────────────────────────────────
+bold "32. SPLIT FARES"
+# ─────────────────────────────────────────────────────────────────────────────
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/00000000-0000-0000-0000-000000000000/split" \
+  -H "Authorization: Bearer $RIDER_TOKEN" -H "Content-Type: application/json" -d '{"emails":["nobody@example.com"]}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /trips/:id/split — unknown trip" "404" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/split-invites" -H "Authorization: Bearer $RIDER_TOKEN")
+BODY=$(echo "$RESP" | sed '$d')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /split-invites" "200" "$CODE"
+assert_json_equals "No open invites" "$BODY" ".invites | length" "0"
+echo ""
+
+# ─────────────────────────────────────────────────────────────────────────────
+bold "33. TIPS"
+# ─────────────────────────────────────────────────────────────────────────────
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/00000000-0000-0000-0000-000000000000/tip" \
+  -H "Authorization: Bearer $RIDER_TOKEN" -H "Content-Type: application/json" -d '{"amount":"40"}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /trips/:id/tip — unknown trip" "404" "$CODE"
+
+# A rider who never accepted the terms is held back on /trips subroutes too
+STALE_TOKEN=$(curl -s -X POST "$BASE/users/register" -H "Content-Type: application/json" \
+  -d "{\"name\":\"Stale Terms $TS\",\"email\":\"stale_${TS}@test.com\",\"phone\":\"$(phone 74)\",\"password\":\"password123\"}" | jq -r '.token')
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/00000000-0000-0000-0000-000000000000/tip" \
+  -H "Authorization: Bearer $STALE_TOKEN" -H "Content-Type: application/json" -d '{"amount":"40"}')
+parse_response "$RESP"
+assert_status "POST /trips/:id/tip — terms not accepted" "428" "$CODE"
+assert_json_equals "Terms gate error code" "$BODY" ".code" "terms_not_accepted"
+echo ""
+
+# ─────────────────────────────────────────────────────────────────────────────
+bold "34. DRIVER PREFERENCES"
+# ─────────────────────────────────────────────────────────────────────────────
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/drivers/$DRIVER_ID/preferences" -H "Authorization: Bearer $DRIVER_TOKEN")
+BODY=$(echo "$RESP" | sed '$d')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /drivers/:id/preferences" "200" "$CODE"
+assert_json_equals "Not winding down" "$BODY" ".winding_down" "false"
+
+RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/drivers/$DRIVER_ID/preferences" \
+  -H "Authorization: Bearer $DRIVER_TOKEN" -H "Content-Type: application/json" -d '{"go_home":true}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "PATCH /drivers/:id/preferences — go home without a home area" "400" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/drivers/$DRIVER_ID/preferences" \
+  -H "Authorization: Bearer $DRIVER_TOKEN" -H "Content-Type: application/json" -d '{"time_zone":"Mars/Olympus"}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "PATCH /drivers/:id/preferences — unknown time zone" "400" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/drivers/$DRIVER_ID/preferences" \
+  -H "Authorization: Bearer $RIDER_TOKEN" -H "Content-Type: application/json" -d '{"go_home":false}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "PATCH /drivers/:id/preferences — rider forbidden" "403" "$CODE"
+echo ""
+
+# ─────────────────────────────────────────────────────────────────────────────
+bold "35. VEHICLES"
+# ─────────────────────────────────────────────────────────────────────────────
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/drivers/$DRIVER_ID/vehicles" -H "Authorization: Bearer $DRIVER_TOKEN")
+BODY=$(echo "$RESP" | sed '$d')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /drivers/:id/vehicles" "200" "$CODE"
+assert_json_equals "Registered vehicle is active" "$BODY" ".vehicles[0].active" "true"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/drivers/$DRIVER_ID/vehicles" \
+  -H "Authorization: Bearer $DRIVER_TOKEN" -H "Content-Type: application/json" \
+  -d '{"vehicle_type":"xl","license_plate":"KA-99-XL-0001","accessibility":["jetpack"]}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /drivers/:id/vehicles — unknown accessibility feature" "400" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/request" \
+  -H "Authorization: Bearer $RIDER_TOKEN" -H "Content-Type: application/json" \
+  -d '{"pickupLat": 12.9716, "pickupLng": 77.5946, "dropLat": 12.9352, "dropLng": 77.6245, "seats": 20}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /trips/request — too many seats" "400" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/request" \
+  -H "Authorization: Bearer $RIDER_TOKEN" -H "Content-Type: application/json" \
+  -d '{"pickupLat": 12.9716, "pickupLng": 77.5946, "dropLat": 12.9352, "dropLng": 77.6245, "childSeats": 4}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /trips/request — too many child seats" "400" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/request" \
+  -H "Authorization: Bearer $RIDER_TOKEN" -H "Content-Type: application/json" \
+  -d '{"pickupLat": 95, "pickupLng": 77.5946, "dropLat": 12.9352, "dropLng": 200}')
+parse_response "$RESP"
+assert_status "POST /trips/request — coordinates out of range" "400" "$CODE"
+assert_json_equals "Every invalid field is reported" "$BODY" ".fields | length" "2"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/drivers/$DRIVER_ID/vehicles" \
+  -H "Authorization: Bearer $DRIVER_TOKEN" -H "Content-Type: application/json" \
+  -d '{"vehicle_type":"xl","license_plate":"KA-99-XL-0002","luggage_litres":-1}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /drivers/:id/vehicles — negative luggage space" "400" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/request" \
+  -H "Authorization: Bearer $(new_rider 6)" -H "Content-Type: application/json" \
+  -d '{"pickupLat": 12.9716, "pickupLng": 77.5946, "dropLat": 12.9352, "dropLng": 77.6245, "accessibility": ["wheelchair", "assistance"]}')
+BODY=$(echo "$RESP" | sed '$d')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /trips/request — no wheelchair-accessible vehicle nearby" "409" "$CODE"
+echo ""
+
+# ─────────────────────────────────────────────────────────────────────────────
+bold "36. FLEET LOCATION BATCH"
+# ─────────────────────────────────────────────────────────────────────────────
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/drivers/locations/batch" \
+  -H "Content-Type: application/json" \
+  -d "[{\"driverID\":\"$DRIVER_ID\",\"lat\":12.9716,\"lng\":77.5946,\"ts\":\"$(date -u +%Y-%m-%dT%H:%M:%SZ)\"}]")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /drivers/locations/batch — no fleet secret" "401" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/admin/drivers/location-flushes" -H "Authorization: Bearer $DRIVER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /admin/drivers/location-flushes — driver forbidden" "403" "$CODE"
+echo ""
+
+# ─────────────────────────────────────────────────────────────────────────────
+bold "37. GPS HISTORY EXPORT"
+# ─────────────────────────────────────────────────────────────────────────────
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/admin/trips/00000000-0000-0000-0000-000000000000/gps?incident_id=INC-1" \
+  -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /admin/trips/:id/gps — rider forbidden" "403" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/admin/gps-history")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /admin/gps-history — no token" "401" "$CODE"
+echo ""
+
+# ─────────────────────────────────────────────────────────────────────────────
+bold "38. SUPPORT TICKETS"
+# ─────────────────────────────────────────────────────────────────────────────
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/support/tickets" \
+  -H "Authorization: Bearer $RIDER_TOKEN" -H "Content-Type: application/json" \
+  -d '{"subject":"Charged twice","body":"My card was charged twice for one ride."}')
+BODY=$(echo "$RESP" | sed '$d')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /support/tickets" "201" "$CODE"
+assert_json_equals "Ticket is open" "$BODY" ".status" "open"
+assert_json_equals "Requester sees no SLA" "$BODY" ".sla" "null"
+TICKET_ID=$(echo "$BODY" | jq -r '.id')
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/support/tickets/$TICKET_ID/messages" \
+  -H "Authorization: Bearer $RIDER_TOKEN" -H "Content-Type: application/json" -d '{"body":"Order reference 1234."}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /support/tickets/:id/messages" "201" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/support/tickets/$TICKET_ID" -H "Authorization: Bearer $RIDER_TOKEN")
+BODY=$(echo "$RESP" | sed '$d')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /support/tickets/:id" "200" "$CODE"
+assert_json_equals "Thread has both messages" "$BODY" ".messages | length" "2"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/support/tickets/$TICKET_ID" -H "Authorization: Bearer $(new_rider 8)")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /support/tickets/:id — another rider" "404" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/admin/support/tickets" -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /admin/support/tickets — rider forbidden" "403" "$CODE"
+
+# Staff find the thread by full-text search over ticket messages
+curl -s -o /dev/null -X POST "$BASE/support/tickets/$TICKET_ID/messages" \
+  -H "Authorization: Bearer $RIDER_TOKEN" -H "Content-Type: application/json" -d "{\"body\":\"The receipts say ref$TS both times.\"}"
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/admin/search?q=ref$TS" -H "Authorization: Bearer $ADMIN_TOKEN")
+parse_response "$RESP"
+assert_status "GET /admin/search — admin" "200" "$CODE"
+assert_json_equals "Finds the ticket message" "$BODY" ".results[0].ticket_id" "$TICKET_ID"
+assert_json_equals "As a ticket message" "$BODY" ".results[0].kind" "ticket_message"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/admin/search?q=ref$TS%20-receipt" -H "Authorization: Bearer $ADMIN_TOKEN")
+parse_response "$RESP"
+assert_json_equals "Excluded word drops it" "$BODY" ".results | length" "0"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/admin/search" -H "Authorization: Bearer $ADMIN_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /admin/search — no query" "400" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/admin/search?q=charged" -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /admin/search — rider forbidden" "403" "$CODE"
+echo ""
+
+# ─────────────────────────────────────────────────────────────────────────────
+bold "39. CANCELLATIONS"
+# ─────────────────────────────────────────────────────────────────────────────
+
+CANCEL_RIDER_TOKEN=$(new_rider 9)
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/request" \
+  -H "Authorization: Bearer $CANCEL_RIDER_TOKEN" -H "Content-Type: application/json" \
+  -d '{"pickupLat": 19.0760, "pickupLng": 72.8777, "dropLat": 19.2183, "dropLng": 72.9781}')
+parse_response "$RESP"
+assert_status "Create trip to cancel" "201" "$CODE"
+CANCEL_TRIP_ID=$(echo "$BODY" | jq -r '.trip_id')
+
+RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/trips/$CANCEL_TRIP_ID/cancel" \
+  -H "If-Match: \"$(trip_version $CANCEL_TRIP_ID)\"" \
+  -H "Authorization: Bearer $CANCEL_RIDER_TOKEN" -H "Content-Type: application/json" -d '{"reason":"vehicle_issue"}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "PATCH /trips/:id/cancel — driver's reason from the rider" "400" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/trips/$CANCEL_TRIP_ID/cancel" \
+  -H "If-Match: \"$(trip_version $CANCEL_TRIP_ID)\"" \
+  -H "Authorization: Bearer $CANCEL_RIDER_TOKEN" -H "Content-Type: application/json" -d '{"reason":"other"}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "PATCH /trips/:id/cancel — other without a note" "400" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/trips/$CANCEL_TRIP_ID/cancel" \
+  -H "If-Match: \"$(trip_version $CANCEL_TRIP_ID)\"" \
+  -H "Authorization: Bearer $RIDER_TOKEN" -H "Content-Type: application/json" -d '{"reason":"changed_plans"}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "PATCH /trips/:id/cancel — another rider" "403" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/trips/$CANCEL_TRIP_ID/cancel" \
+  -H "If-Match: \"$(trip_version $CANCEL_TRIP_ID)\"" \
+  -H "Authorization: Bearer $CANCEL_RIDER_TOKEN" -H "Content-Type: application/json" -d '{"reason":"changed_plans"}')
+parse_response "$RESP"
+assert_status "PATCH /trips/:id/cancel — rider" "200" "$CODE"
+assert_json_equals "Trip is cancelled" "$BODY" ".status" "CANCELLED"
+assert_json_equals "Cancelled by the rider" "$BODY" ".cancellation.by" "rider"
+assert_json_equals "With their reason" "$BODY" ".cancellation.reason" "changed_plans"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/admin/reports/cancellations" -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /admin/reports/cancellations — rider forbidden" "403" "$CODE"
+echo ""
+
+# ─────────────────────────────────────────────────────────────────────────────
+bold "40. FARE QUOTES"
+# ─────────────────────────────────────────────────────────────────────────────
+
+QUOTE_RIDER_TOKEN=$(new_rider 10)
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/fares/estimate" \
+  -H "Authorization: Bearer $QUOTE_RIDER_TOKEN" -H "Content-Type: application/json" \
+  -d '{"pickupLat": 19.0760, "pickupLng": 72.8777, "dropLat": 19.2183, "dropLng": 72.9781}')
+parse_response "$RESP"
+assert_status "POST /fares/estimate" "201" "$CODE"
+QUOTE_ID=$(echo "$BODY" | jq -r '.id')
+assert_json_equals "Quote is unused" "$BODY" ".trip_id" "null"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/fares/quotes/$QUOTE_ID" -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /fares/quotes/:id — another rider" "404" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/request" \
+  -H "Authorization: Bearer $QUOTE_RIDER_TOKEN" -H "Content-Type: application/json" \
+  -d '{"pickupLat": 28.6139, "pickupLng": 77.2090, "dropLat": 28.5355, "dropLng": 77.3910, "quoteId": "'"$QUOTE_ID"'"}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /trips/request — quote for another route" "400" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/request" \
+  -H "Authorization: Bearer $QUOTE_RIDER_TOKEN" -H "Content-Type: application/json" \
+  -d '{"pickupLat": 19.0760, "pickupLng": 72.8777, "dropLat": 19.2183, "dropLng": 72.9781, "quoteId": "'"$QUOTE_ID"'"}')
+parse_response "$RESP"
+assert_status "POST /trips/request — with the quote" "201" "$CODE"
+QUOTE_TRIP_ID=$(echo "$BODY" | jq -r '.trip_id')
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/trips/$QUOTE_TRIP_ID" -H "Authorization: Bearer $QUOTE_RIDER_TOKEN")
+parse_response "$RESP"
+assert_json_equals "Trip keeps its quote" "$BODY" ".quote_id" "$QUOTE_ID"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/fares/quotes/$QUOTE_ID" -H "Authorization: Bearer $QUOTE_RIDER_TOKEN")
+parse_response "$RESP"
+assert_json_equals "Quote is used by the trip" "$BODY" ".trip_id" "$QUOTE_TRIP_ID"
+
+curl -s -o /dev/null -X PATCH "$BASE/trips/$QUOTE_TRIP_ID/cancel" \
+  -H "If-Match: \"$(trip_version $QUOTE_TRIP_ID)\"" \
+  -H "Authorization: Bearer $QUOTE_RIDER_TOKEN" -H "Content-Type: application/json" -d '{"reason":"changed_plans"}'
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/request" \
+  -H "Authorization: Bearer $QUOTE_RIDER_TOKEN" -H "Content-Type: application/json" \
+  -d '{"pickupLat": 19.0760, "pickupLng": 72.8777, "dropLat": 19.2183, "dropLng": 72.9781, "quoteId": "'"$QUOTE_ID"'"}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /trips/request — quote already used" "409" "$CODE"
+echo ""
+
+# ─────────────────────────────────────────────────────────────────────────────
+bold "41. FAVORITE DRIVERS"
+# ─────────────────────────────────────────────────────────────────────────────
+
+# The rider of the completed trip from section 13 favorites its driver
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/$DIST_TRIP_ID/favorite" -H "Authorization: Bearer $DRIVER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /trips/:id/favorite — driver gets 403" "403" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/$QUOTE_TRIP_ID/favorite" -H "Authorization: Bearer $QUOTE_RIDER_TOKEN")
+parse_response "$RESP"
+assert_status "POST /trips/:id/favorite — cancelled trip" "409" "$CODE"
+assert_json_equals "Trip not completed error code" "$BODY" ".code" "trip_not_completed"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/$DIST_TRIP_ID/favorite" -H "Authorization: Bearer $DIST_RIDER_TOKEN")
+parse_response "$RESP"
+assert_status "POST /trips/:id/favorite" "201" "$CODE"
+assert_json_equals "Favorite driver" "$BODY" ".driver_id" "$DRIVER_ID"
+FAVORITE_ID=$(echo "$BODY" | jq -r '.id')
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/$DIST_TRIP_ID/favorite" -H "Authorization: Bearer $DIST_RIDER_TOKEN")
+parse_response "$RESP"
+assert_status "POST /trips/:id/favorite — again" "409" "$CODE"
+assert_json_equals "Already favorite error code" "$BODY" ".code" "already_favorite"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/favorites" -H "Authorization: Bearer $DIST_RIDER_TOKEN")
+parse_response "$RESP"
+assert_status "GET /favorites" "200" "$CODE"
+assert_json_equals "One favorite listed" "$BODY" ".favorites | length" "1"
+
+RESP=$(curl -s -w "\n%{http_code}" -X DELETE "$BASE/favorites/$FAVORITE_ID" -H "Authorization: Bearer $QUOTE_RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "DELETE /favorites/:id — someone else's favorite" "404" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X DELETE "$BASE/favorites/$FAVORITE_ID" -H "Authorization: Bearer $DIST_RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "DELETE /favorites/:id" "200" "$CODE"
+echo ""
+
+# ─────────────────────────────────────────────────────────────────────────────
+bold "42. WOMEN-ONLY RIDES"
+# ─────────────────────────────────────────────────────────────────────────────
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/users/register" -H "Content-Type: application/json" \
+  -d "{\"name\":\"Rider 11 $TS\",\"email\":\"rider11_${TS}@test.com\",\"phone\":\"$(phone 71)\",\"password\":\"password123\",\"gender\":\"robot\"}")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /users/register — unknown gender" "400" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/users/register" -H "Content-Type: application/json" \
+  -d "{\"name\":\"Rider 11 $TS\",\"email\":\"rider11_${TS}@test.com\",\"phone\":\"$(phone 71)\",\"password\":\"password123\",\"gender\":\"Female\",$ACCEPT}")
+parse_response "$RESP"
+assert_status "POST /users/register — with gender" "201" "$CODE"
+assert_json_equals "Gender is stored lower-case" "$BODY" ".user.gender" "female"
+WOMAN_RIDER_TOKEN=$(echo "$BODY" | jq -r '.token')
+WOMAN_RIDER_ID=$(echo "$BODY" | jq -r '.user.id')
+
+# No city offers women-only rides unless WOMEN_ONLY_CITIES is set
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/request" \
+  -H "Authorization: Bearer $WOMAN_RIDER_TOKEN" -H "Content-Type: application/json" \
+  -d '{"pickupLat": 19.0760, "pickupLng": 72.8777, "dropLat": 19.2183, "dropLng": 72.9781, "womenOnly": true}')
+parse_response "$RESP"
+assert_status "POST /trips/request — women-only where not offered" "400" "$CODE"
+assert_json_equals "Women-only unavailable error code" "$BODY" ".code" "women_only_unavailable"
+
+RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/users/$WOMAN_RIDER_ID" \
+  -H "Authorization: Bearer $WOMAN_RIDER_TOKEN" -H "Content-Type: application/json" -d '{"gender":"nonbinary"}')
+parse_response "$RESP"
+assert_status "PATCH /users/:id — gender" "200" "$CODE"
+assert_json_equals "Gender changed" "$BODY" ".user.gender" "nonbinary"
+echo ""
+
+# ─────────────────────────────────────────────────────────────────────────────
+bold "43. MID-TRIP DESTINATION CHANGE"
+# ─────────────────────────────────────────────────────────────────────────────
+
+RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/trips/$DIST_TRIP_ID/destination" \
+  -H "Authorization: Bearer $DIST_RIDER_TOKEN" -H "Content-Type: application/json" -d '{"dropLat": 95}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "PATCH /trips/:id/destination — invalid drop" "400" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/trips/$DIST_TRIP_ID/destination" \
+  -H "Authorization: Bearer $DRIVER_TOKEN" -H "Content-Type: application/json" \
+  -d '{"dropLat": 19.1000, "dropLng": 72.9000}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "PATCH /trips/:id/destination — driver refused" "403" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X PATCH "$BASE/trips/$DIST_TRIP_ID/destination" \
+  -H "Authorization: Bearer $DIST_RIDER_TOKEN" -H "Content-Type: application/json" \
+  -d '{"dropLat": 19.1000, "dropLng": 72.9000}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "PATCH /trips/:id/destination — completed trip" "409" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/trips/$DIST_TRIP_ID/modifications" -H "Authorization: Bearer $DIST_RIDER_TOKEN")
+parse_response "$RESP"
+assert_status "GET /trips/:id/modifications — history" "200" "$CODE"
+assert_json_equals "No changes were requested" "$BODY" ".modifications | length" "0"
+echo ""
+
+# ─────────────────────────────────────────────────────────────────────────────
+bold "44. TRIP SHARING"
+# ─────────────────────────────────────────────────────────────────────────────
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/$DIST_TRIP_ID/share" -H "Authorization: Bearer $DIST_RIDER_TOKEN")
+parse_response "$RESP"
+assert_status "POST /trips/:id/share — completed trip" "409" "$CODE"
+assert_json_equals "Trip over error code" "$BODY" ".code" "trip_over"
+
+SHARE_RIDER_TOKEN=$(new_rider 12)
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/request" \
+  -H "Authorization: Bearer $SHARE_RIDER_TOKEN" -H "Content-Type: application/json" \
+  -d '{"pickupLat": 19.0760, "pickupLng": 72.8777, "dropLat": 19.2183, "dropLng": 72.9781}')
+parse_response "$RESP"
+assert_status "Create trip to share" "201" "$CODE"
+SHARE_TRIP_ID=$(echo "$BODY" | jq -r '.trip_id')
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/$SHARE_TRIP_ID/share" -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /trips/:id/share — another rider" "403" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/$SHARE_TRIP_ID/share" -H "Authorization: Bearer $SHARE_RIDER_TOKEN")
+parse_response "$RESP"
+assert_status "POST /trips/:id/share — rider" "201" "$CODE"
+SHARE_TOKEN=$(echo "$BODY" | jq -r '.token')
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/shared/$SHARE_TOKEN")
+parse_response "$RESP"
+assert_status "GET /shared/:token — no account needed" "200" "$CODE"
+assert_json_equals "Shows the drop" "$BODY" ".drop.lat" "19.2183"
+assert_json_equals "Not the pickup" "$BODY" ".pickup_lat" "null"
+
+RESP=$(curl -s -w "\n%{http_code}" -X DELETE "$BASE/trips/$SHARE_TRIP_ID/share" -H "Authorization: Bearer $SHARE_RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "DELETE /trips/:id/share — revoke" "200" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/shared/$SHARE_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /shared/:token — revoked" "404" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/shared/$SHARE_TOKEN/sse")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /shared/:token/sse — revoked" "404" "$CODE"
+
+curl -s -o /dev/null -X PATCH "$BASE/trips/$SHARE_TRIP_ID/cancel" \
+  -H "If-Match: \"$(trip_version $SHARE_TRIP_ID)\"" \
+  -H "Authorization: Bearer $SHARE_RIDER_TOKEN" -H "Content-Type: application/json" -d '{"reason":"changed_plans"}'
+echo ""
+
+# ─────────────────────────────────────────────────────────────────────────────
+bold "45. EMERGENCY CONTACTS"
+# ─────────────────────────────────────────────────────────────────────────────
+
+SOS_RIDER_TOKEN=$(new_rider 13)
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/emergency-contacts" \
+  -H "Authorization: Bearer $SOS_RIDER_TOKEN" -H "Content-Type: application/json" \
+  -d '{"name":"Asha","phone":"98765 43210","email":"asha@example.com"}')
+parse_response "$RESP"
+assert_status "POST /emergency-contacts" "201" "$CODE"
+assert_json_equals "Phone normalized" "$BODY" ".phone" "+919876543210"
+CONTACT_ID=$(echo "$BODY" | jq -r '.id')
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/emergency-contacts" \
+  -H "Authorization: Bearer $SOS_RIDER_TOKEN" -H "Content-Type: application/json" -d '{"name":"Nobody"}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /emergency-contacts — no phone or email" "400" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/emergency-contacts" -H "Authorization: Bearer $SOS_RIDER_TOKEN")
+parse_response "$RESP"
+assert_status "GET /emergency-contacts" "200" "$CODE"
+assert_json_equals "Email decrypted" "$BODY" ".contacts[0].email" "asha@example.com"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/$DIST_TRIP_ID/sos" -H "Authorization: Bearer $DIST_RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /trips/:id/sos — completed trip" "409" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/trips/$DIST_TRIP_ID/sos" -H "Authorization: Bearer $SOS_RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /trips/:id/sos — not the rider" "403" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X DELETE "$BASE/emergency-contacts/$CONTACT_ID" -H "Authorization: Bearer $SOS_RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "DELETE /emergency-contacts/:id" "200" "$CODE"
+echo ""
+
+# ─────────────────────────────────────────────────────────────────────────────
+bold "46. ROUTE DEVIATIONS"
+# ─────────────────────────────────────────────────────────────────────────────
+
+# Deviation traces are for staff only
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/admin/trips/$DIST_TRIP_ID/deviations" -H "Authorization: Bearer $DIST_RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /admin/trips/:id/deviations — rider gets 403" "403" "$CODE"
+echo ""
+
+# ─────────────────────────────────────────────────────────────────────────────
+bold "47. DRIVING SAFETY"
+# ─────────────────────────────────────────────────────────────────────────────
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/admin/safety" -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /admin/safety — rider gets 403" "403" "$CODE"
+echo ""
+
+# ─────────────────────────────────────────────────────────────────────────────
+bold "48. TRIP SEARCH"
+# ─────────────────────────────────────────────────────────────────────────────
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/admin/trips?status=COMPLETED" -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /admin/trips — rider gets 403" "403" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/admin/trips?format=csv" -H "Authorization: Bearer $DRIVER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /admin/trips?format=csv — driver gets 403" "403" "$CODE"
+echo ""
+
+# ─────────────────────────────────────────────────────────────────────────────
+bold "49. BULK EXPORTS"
+# ─────────────────────────────────────────────────────────────────────────────
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/admin/exports" \
+  -H "Authorization: Bearer $RIDER_TOKEN" -H "Content-Type: application/json" \
+  -d '{"dataset":"trips","format":"parquet"}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /admin/exports — rider gets 403" "403" "$CODE"
+
+# A made-up signature is refused before the job is looked up
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/exports/$DIST_TRIP_ID/download?expires=9999999999&sig=00")
+parse_response "$RESP"
+assert_status "GET /exports/:id/download — forged link gets 403" "403" "$CODE"
+assert_json_equals "Forged link error code" "$BODY" ".code" "export_link_invalid"
+echo ""
+
+# ─────────────────────────────────────────────────────────────────────────────
+bold "50. FEATURE FLAGS"
+# ─────────────────────────────────────────────────────────────────────────────
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/admin/feature-flags" -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /admin/feature-flags — rider gets 403" "403" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" -X PUT "$BASE/admin/feature-flags/pricing.surge_v2" \
+  -H "Authorization: Bearer $DRIVER_TOKEN" -H "Content-Type: application/json" \
+  -d '{"enabled":true,"percent":100}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "PUT /admin/feature-flags/:key — driver gets 403" "403" "$CODE"
+echo ""
+
+# ─────────────────────────────────────────────────────────────────────────────
+bold "51. DEAD-LETTER QUEUES"
+# ─────────────────────────────────────────────────────────────────────────────
+
+# A message no consumer can decode is retried, then dead-lettered
+echo "poison-$TS" | docker exec -i kafka1 kafka-console-producer --bootstrap-server kafka:9092 --topic driver.assigned
+for i in $(seq 1 20); do
+  RESP=$(curl -s -w "\n%{http_code}" "$BASE/admin/dlq/driver.assigned?limit=500" -H "Authorization: Bearer $ADMIN_TOKEN")
+  parse_response "$RESP"
+  DEAD=$(echo "$BODY" | jq -c "first(.messages[] | select(.payload == \"poison-$TS\")) // empty")
+  [ -n "$DEAD" ] && break
+  sleep 1
+done
+assert_status "GET /admin/dlq/:topic — admin" "200" "$CODE"
+assert_json_equals "Poison message dead-lettered" "$DEAD" ".topic" "driver.assigned"
+assert_json_equals "Kept as a string, since it is not JSON" "$DEAD" ".encoding" "string"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/admin/dlq/driver.assigned/replay" \
+  -H "Authorization: Bearer $ADMIN_TOKEN" -H "Content-Type: application/json" \
+  -d "{\"partition\":$(echo "$DEAD" | jq '.dlq_partition'),\"offset\":$(echo "$DEAD" | jq '.dlq_offset')}")
+parse_response "$RESP"
+assert_status "POST /admin/dlq/:topic/replay" "200" "$CODE"
+assert_json_equals "Replayed the poison message" "$BODY" ".message.payload" "poison-$TS"
+
+RESP=$(curl -s -w "\n%{http_code}" -X POST "$BASE/admin/dlq/driver.assigned/replay" \
+  -H "Authorization: Bearer $ADMIN_TOKEN" -H "Content-Type: application/json" -d '{"partition":0,"offset":999999999}')
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "POST /admin/dlq/:topic/replay — no such dead letter" "404" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/admin/dlq/no.such.topic" -H "Authorization: Bearer $ADMIN_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /admin/dlq/:topic — unknown topic" "404" "$CODE"
+
+RESP=$(curl -s -w "\n%{http_code}" "$BASE/admin/dlq/driver.assigned" -H "Authorization: Bearer $RIDER_TOKEN")
+CODE=$(echo "$RESP" | tail -n 1)
+assert_status "GET /admin/dlq/:topic — rider gets 403" "403" "$CODE"
+echo ""
+
 # ═════════════════════════════════════════════════════════════════════════════
 # RESULTS
 # ═════════════════════════════════════════════════════════════════════════════